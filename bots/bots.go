@@ -0,0 +1,157 @@
+package bots
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Families reported for requests that are classified by how they were made rather than by user agent
+const (
+	FamilyHead        = "HEAD request"
+	FamilyPrefetch    = "Prefetch"
+	FamilyNoUserAgent = "No user agent"
+	FamilyOther       = "Other"
+)
+
+// builtins are the crawlers, link unfurlers and http clients recognized without a patterns file.
+// The generic Other pattern is always checked last.
+var builtins = []struct{ family, pattern string }{
+	{"Slack", `Slackbot|Slack-ImgProxy`},
+	{"Microsoft Teams", `SkypeUriPreview|MicrosoftPreview|TeamsBot`},
+	{"Discord", `Discordbot`},
+	{"Facebook", `facebookexternalhit|facebookcatalog|meta-externalagent`},
+	{"Twitter", `Twitterbot`},
+	{"LinkedIn", `LinkedInBot`},
+	{"Telegram", `TelegramBot`},
+	{"WhatsApp", `WhatsApp`},
+	{"Mastodon", `Mastodon`},
+	{"Pinterest", `Pinterest(bot)?`},
+	{"Reddit", `redditbot`},
+	{"Google", `Googlebot|Google-InspectionTool|AdsBot-Google|Mediapartners-Google|APIs-Google|FeedFetcher-Google|GoogleOther`},
+	{"Bing", `bingbot|BingPreview|msnbot`},
+	{"Apple", `Applebot`},
+	{"Yandex", `YandexBot|YandexImages`},
+	{"Baidu", `Baiduspider`},
+	{"DuckDuckGo", `DuckDuckBot`},
+	{"HTTP client", `^(curl|Wget|python-requests|Python-urllib|Go-http-client|okhttp|axios|node-fetch|libwww-perl|Java)/|HeadlessChrome|PhantomJS`},
+}
+
+var other = regexp.MustCompile(`(?i)bot|crawl|spider|slurp|preview|fetcher|scanner|monitor`)
+
+type pattern struct {
+	family string
+	re     *regexp.Regexp
+}
+
+// Classifier decides whether a request was made by a bot rather than a person.
+// A nil Classifier is valid and uses the built-in patterns.
+type Classifier struct {
+	patterns []pattern
+}
+
+var defaultClassifier = sync.OnceValue(func() *Classifier {
+	c, _ := NewClassifier("")
+	return c
+})
+
+// NewClassifier returns a Classifier using the built-in patterns plus any in the file at path, which take precedence.
+// Each line of the file is a family name and a case-insensitive regular expression for the user agent,
+// separated by a tab or " = ". Blank lines and lines starting with # are ignored.
+func NewClassifier(path string) (*Classifier, error) {
+	c := &Classifier{}
+
+	if path != "" {
+		if err := c.load(path); err != nil {
+			return nil, err
+		}
+		log.Printf("Loaded %d bot patterns from %s", len(c.patterns), path)
+	}
+
+	for _, b := range builtins {
+		c.patterns = append(c.patterns, pattern{family: b.family, re: regexp.MustCompile("(?i)" + b.pattern)})
+	}
+	return c, nil
+}
+
+func (c *Classifier) load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		family, expr, ok := strings.Cut(line, "\t")
+		if !ok {
+			family, expr, ok = strings.Cut(line, " = ")
+		}
+		family, expr = strings.TrimSpace(family), strings.TrimSpace(expr)
+		if !ok || family == "" || expr == "" {
+			return fmt.Errorf("%s:%d: expected a family and a pattern", path, n)
+		}
+		// family names are used as keys in stored stats, which can't contain these in every database
+		if strings.ContainsAny(family, ".$") {
+			return fmt.Errorf("%s:%d: family %q can't contain '.' or '$'", path, n, family)
+		}
+
+		re, err := regexp.Compile("(?i)" + expr)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		c.patterns = append(c.patterns, pattern{family: family, re: re})
+	}
+	return scanner.Err()
+}
+
+// Classify returns the bot family that made r, or an empty string if it looks like a person.
+// Known user agents are checked first, then HEAD requests, prefetch headers and missing user agents,
+// then a generic pattern for anything calling itself a bot, crawler or spider.
+func (c *Classifier) Classify(r *http.Request) string {
+	if c == nil {
+		c = defaultClassifier()
+	}
+
+	ua := r.UserAgent()
+	for _, p := range c.patterns {
+		if p.re.MatchString(ua) {
+			return p.family
+		}
+	}
+
+	switch {
+	case r.Method == http.MethodHead:
+		return FamilyHead
+	case isPrefetch(r.Header):
+		return FamilyPrefetch
+	case strings.TrimSpace(ua) == "":
+		return FamilyNoUserAgent
+	case other.MatchString(ua):
+		return FamilyOther
+	}
+	return ""
+}
+
+// isPrefetch reports whether the browser is speculatively loading the link rather than following it
+func isPrefetch(h http.Header) bool {
+	for _, name := range []string{"Sec-Purpose", "Purpose", "X-Purpose", "X-Moz"} {
+		v := strings.ToLower(h.Get(name))
+		if strings.Contains(v, "prefetch") || strings.Contains(v, "preview") || strings.Contains(v, "prerender") {
+			return true
+		}
+	}
+	return false
+}
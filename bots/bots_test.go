@@ -0,0 +1,97 @@
+package bots
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClassifier_Classify(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		ua      string
+		headers map[string]string
+		want    string
+	}{
+		{"browser", http.MethodGet, "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_0) AppleWebKit/605.1.15 Safari/605.1.15", nil, ""},
+		{"slack", http.MethodGet, "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", nil, "Slack"},
+		{"slack head", http.MethodHead, "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", nil, "Slack"},
+		{"teams", http.MethodGet, "Mozilla/5.0 (Windows NT 6.1; WOW64) SkypeUriPreview Preview/0.5", nil, "Microsoft Teams"},
+		{"facebook", http.MethodGet, "facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)", nil, "Facebook"},
+		{"googlebot", http.MethodGet, "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", nil, "Google"},
+		{"curl", http.MethodGet, "curl/8.4.0", nil, "HTTP client"},
+		{"generic crawler", http.MethodGet, "SomeCrawler/1.0", nil, FamilyOther},
+		{"head", http.MethodHead, "Mozilla/5.0", nil, FamilyHead},
+		{"chrome prefetch", http.MethodGet, "Mozilla/5.0", map[string]string{"Sec-Purpose": "prefetch;prerender"}, FamilyPrefetch},
+		{"firefox prefetch", http.MethodGet, "Mozilla/5.0", map[string]string{"X-Moz": "prefetch"}, FamilyPrefetch},
+		{"no user agent", http.MethodGet, "", nil, FamilyNoUserAgent},
+	}
+
+	var c *Classifier
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/abc", nil)
+			r.Header.Set("User-Agent", tt.ua)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			if got := c.Classify(r); got != tt.want {
+				t.Errorf("Classify() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewClassifier_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bots.txt")
+	content := "# custom crawlers\n\nUptime Checker\tuptime-kuma\nInternal = ^acme-(fetch|probe)\nMy Slack\tslackbot\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewClassifier(path)
+	if err != nil {
+		t.Fatalf("NewClassifier() error = %v", err)
+	}
+
+	tests := map[string]string{
+		"Uptime-Kuma/1.23.0":    "Uptime Checker",
+		"acme-probe/2":          "Internal",
+		"Slackbot 1.0":          "My Slack", // file patterns take precedence over the built-ins
+		"Discordbot/2.0":        "Discord",
+		"Mozilla/5.0 (X11) Foo": "",
+	}
+	for ua, want := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/abc", nil)
+		r.Header.Set("User-Agent", ua)
+		if got := c.Classify(r); got != want {
+			t.Errorf("Classify(%q) = %q, want %q", ua, got, want)
+		}
+	}
+}
+
+func TestNewClassifier_BadFile(t *testing.T) {
+	tests := map[string]string{
+		"missing pattern": "Lonely\n",
+		"bad regexp":      "Broken\t([a-z\n",
+		"dotted family":   "example.com\texample\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "bots.txt")
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := NewClassifier(path); err == nil {
+				t.Error("NewClassifier() returned no error")
+			}
+		})
+	}
+
+	if _, err := NewClassifier(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("NewClassifier() with missing file returned no error")
+	}
+}
@@ -0,0 +1,201 @@
+// Package charts renders small inline SVG charts for the HTML pages, so they need no JavaScript
+package charts
+
+import (
+	"cmp"
+	"fmt"
+	"html/template"
+	"maps"
+	"slices"
+	"strings"
+)
+
+const (
+	width      = 720
+	fontSize   = 11
+	color      = "#1f77b4"
+	emptyColor = "#eeeeee"
+	axisColor  = "#999999"
+
+	lineHeight    = 200
+	lineMargin    = 40
+	maxLineLabels = 6
+
+	barHeight     = 20
+	barGap        = 4
+	barLabelWidth = 180
+	barValueWidth = 60
+	maxLabelChars = 28
+
+	cellWidth     = 26
+	cellHeight    = 20
+	heatLabel     = 40
+	heatLabelStep = 3 // label every third column
+)
+
+// Point is one labelled value of a chart
+type Point struct {
+	Label string
+	Value int
+}
+
+// Sorted returns counts as points with the largest first, ties ordered by label, keeping at most
+// limit of them when limit is positive
+func Sorted(counts map[string]int, limit int) []Point {
+	points := make([]Point, 0, len(counts))
+	for _, label := range slices.Sorted(maps.Keys(counts)) {
+		points = append(points, Point{Label: label, Value: counts[label]})
+	}
+	slices.SortStableFunc(points, func(a, b Point) int {
+		return cmp.Compare(b.Value, a.Value)
+	})
+	if limit > 0 && len(points) > limit {
+		points = points[:limit]
+	}
+	return points
+}
+
+// Line draws points left to right as a line chart, labelling a few of them along the x axis
+func Line(title string, points []Point) template.HTML {
+	if len(points) == 0 {
+		return empty(title)
+	}
+
+	var b strings.Builder
+	open(&b, title, lineHeight)
+
+	top, bottom, left, right := 10.0, float64(lineHeight-24), float64(lineMargin), float64(width-10)
+	most := max(maxValue(points), 1)
+	x := func(i int) float64 {
+		if len(points) == 1 {
+			return (left + right) / 2
+		}
+		return left + (right-left)*float64(i)/float64(len(points)-1)
+	}
+	y := func(v int) float64 {
+		return bottom - (bottom-top)*float64(v)/float64(most)
+	}
+
+	for _, v := range []int{0, most / 2, most} {
+		fmt.Fprintf(&b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s" stroke-width="0.5"/>`,
+			left, y(v), right, y(v), axisColor)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" text-anchor="end">%d</text>`, left-4, y(v)+4, v)
+	}
+
+	coords := make([]string, len(points))
+	for i, p := range points {
+		coords[i] = fmt.Sprintf("%.1f,%.1f", x(i), y(p.Value))
+	}
+	fmt.Fprintf(&b, `<polyline fill="none" stroke="%s" stroke-width="2" points="%s"/>`, color, strings.Join(coords, " "))
+
+	step := max(1, (len(points)+maxLineLabels-1)/maxLineLabels)
+	for i, p := range points {
+		fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="3" fill="%s"><title>%s: %d</title></circle>`,
+			x(i), y(p.Value), color, escape(p.Label), p.Value)
+		if i%step == 0 {
+			fmt.Fprintf(&b, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`, x(i), lineHeight-6, escape(p.Label))
+		}
+	}
+
+	return finish(&b)
+}
+
+// Bars draws points as horizontal bars, top to bottom in the order given
+func Bars(title string, points []Point) template.HTML {
+	if len(points) == 0 {
+		return empty(title)
+	}
+
+	var b strings.Builder
+	open(&b, title, len(points)*(barHeight+barGap)+barGap)
+
+	most := max(maxValue(points), 1)
+	span := float64(width - barLabelWidth - barValueWidth)
+	for i, p := range points {
+		y := barGap + i*(barHeight+barGap)
+		w := max(span*float64(p.Value)/float64(most), 1)
+		fmt.Fprintf(&b, `<g><title>%s: %d</title>`, escape(p.Label), p.Value)
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">%s</text>`,
+			barLabelWidth-6, y+barHeight-6, escape(truncate(p.Label)))
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%.1f" height="%d" fill="%s"/>`, barLabelWidth, y, w, barHeight, color)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d">%d</text></g>`, float64(barLabelWidth)+w+4, y+barHeight-6, p.Value)
+	}
+
+	return finish(&b)
+}
+
+// Heatmap draws values as a grid of cells shaded by their size, values[row][column]
+func Heatmap(title string, rows, columns []string, values [][]int) template.HTML {
+	most := 0
+	for _, row := range values {
+		for _, v := range row {
+			most = max(most, v)
+		}
+	}
+	if most == 0 {
+		return empty(title)
+	}
+
+	var b strings.Builder
+	open(&b, title, cellHeight*(len(rows)+1))
+
+	for c, column := range columns {
+		if c%heatLabelStep == 0 {
+			fmt.Fprintf(&b, `<text x="%d" y="%d">%s</text>`, heatLabel+c*cellWidth, cellHeight-6, escape(column))
+		}
+	}
+	for r, row := range rows {
+		y := cellHeight * (r + 1)
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">%s</text>`, heatLabel-6, y+cellHeight-6, escape(row))
+		for c, v := range values[r] {
+			fill, opacity := color, 0.1+0.9*float64(v)/float64(most)
+			if v == 0 {
+				fill, opacity = emptyColor, 1
+			}
+			fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s" fill-opacity="%.2f" stroke="#ffffff">`,
+				heatLabel+c*cellWidth, y, cellWidth, cellHeight, fill, opacity)
+			fmt.Fprintf(&b, `<title>%s %s: %d</title></rect>`, escape(row), escape(columns[c]), v)
+		}
+	}
+
+	return finish(&b)
+}
+
+func open(b *strings.Builder, title string, height int) {
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" role="img" width="%d" height="%d" viewBox="0 0 %d %d" `+
+		`font-family="sans-serif" font-size="%d" aria-label="%s"><title>%s</title>`,
+		width, height, width, height, fontSize, escape(title), escape(title))
+}
+
+func finish(b *strings.Builder) template.HTML {
+	b.WriteString(`</svg>`)
+	// labels and titles are escaped as they're written
+	return template.HTML(b.String())
+}
+
+func empty(title string) template.HTML {
+	var b strings.Builder
+	open(&b, title, 2*fontSize)
+	fmt.Fprintf(&b, `<text x="0" y="%d" fill="%s">No data</text>`, fontSize+4, axisColor)
+	return finish(&b)
+}
+
+func maxValue(points []Point) int {
+	most := 0
+	for _, p := range points {
+		most = max(most, p.Value)
+	}
+	return most
+}
+
+func truncate(label string) string {
+	runes := []rune(label)
+	if len(runes) <= maxLabelChars {
+		return label
+	}
+	return string(runes[:maxLabelChars-1]) + "…"
+}
+
+func escape(s string) string {
+	return template.HTMLEscapeString(s)
+}
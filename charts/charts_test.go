@@ -0,0 +1,97 @@
+package charts
+
+import (
+	"encoding/xml"
+	"html/template"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// elements parses svg as XML and counts its elements by name
+func elements(t *testing.T, svg template.HTML) map[string]int {
+	t.Helper()
+	counts := make(map[string]int)
+	decoder := xml.NewDecoder(strings.NewReader(string(svg)))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return counts
+		}
+		if err != nil {
+			t.Fatalf("invalid SVG %v: %s", err, svg)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			counts[start.Name.Local]++
+		}
+	}
+}
+
+func TestSorted(t *testing.T) {
+	counts := map[string]int{"b": 2, "a": 2, "c": 5, "d": 1}
+
+	want := []Point{{"c", 5}, {"a", 2}, {"b", 2}, {"d", 1}}
+	if got := Sorted(counts, 0); !slices.Equal(got, want) {
+		t.Errorf("Sorted() = %v, want %v", got, want)
+	}
+	if got := Sorted(counts, 2); !slices.Equal(got, want[:2]) {
+		t.Errorf("Sorted(limit 2) = %v, want %v", got, want[:2])
+	}
+	if got := Sorted(nil, 3); len(got) != 0 {
+		t.Errorf("Sorted(nil) = %v, want none", got)
+	}
+}
+
+func TestLine(t *testing.T) {
+	points := []Point{{"2024-03-01", 3}, {"2024-03-02", 0}, {"2024-03-03", 7}}
+	svg := Line("Daily <hits>", points)
+
+	counts := elements(t, svg)
+	if counts["polyline"] != 1 || counts["circle"] != len(points) {
+		t.Errorf("Line() has %v, want a polyline and %d points", counts, len(points))
+	}
+	if !strings.Contains(string(svg), "Daily &lt;hits&gt;") {
+		t.Errorf("Line() doesn't escape the title: %s", svg)
+	}
+	if !strings.Contains(string(svg), "2024-03-03: 7") {
+		t.Errorf("Line() is missing a point's tooltip: %s", svg)
+	}
+}
+
+func TestBars(t *testing.T) {
+	svg := Bars("Referrers", []Point{{"news.ycombinator.com", 4}, {`"><script>`, 1}})
+
+	counts := elements(t, svg)
+	if counts["rect"] != 2 {
+		t.Errorf("Bars() has %d bars, want 2", counts["rect"])
+	}
+	if strings.Contains(string(svg), "<script>") {
+		t.Errorf("Bars() doesn't escape labels: %s", svg)
+	}
+}
+
+func TestHeatmap(t *testing.T) {
+	values := [][]int{{0, 1, 2}, {3, 0, 0}}
+	svg := Heatmap("Heat", []string{"Mon", "Tue"}, []string{"00", "01", "02"}, values)
+
+	if counts := elements(t, svg); counts["rect"] != 6 {
+		t.Errorf("Heatmap() has %d cells, want 6", counts["rect"])
+	}
+	if !strings.Contains(string(svg), "Tue 00: 3") {
+		t.Errorf("Heatmap() is missing a cell's tooltip: %s", svg)
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	for name, svg := range map[string]template.HTML{
+		"Line":    Line("Empty", nil),
+		"Bars":    Bars("Empty", nil),
+		"Heatmap": Heatmap("Empty", []string{"Mon"}, []string{"00"}, [][]int{{0}}),
+	} {
+		elements(t, svg)
+		if !strings.Contains(string(svg), "No data") {
+			t.Errorf("%s() with no data = %s, want a No data message", name, svg)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Create returns a link to u, the one it already has or a new one
+func (c *Client) Create(ctx context.Context, u string) (Link, error) {
+	return c.CreateLink(ctx, CreateRequest{Url: u})
+}
+
+// CreateLink creates the link req asks for. Asking for a name that already links elsewhere fails with a 409 *Error.
+func (c *Client) CreateLink(ctx context.Context, req CreateRequest) (Link, error) {
+	var link Link
+	r, err := jsonRequest(http.MethodPost, "/", req)
+	if err != nil {
+		return link, err
+	}
+	err = c.call(ctx, r, &link)
+	return link, err
+}
+
+// CreateBatch creates the links of reqs several at a time. The batch has how each of them went; a transactional one
+// creates either all of them or, when one fails, none, and then fails with the status of the first failure along
+// with the batch.
+func (c *Client) CreateBatch(ctx context.Context, reqs []CreateRequest, transactional bool) (Batch, error) {
+	var batch Batch
+	r, err := jsonRequest(http.MethodPost, "/api/links:batch", reqs)
+	if err != nil {
+		return batch, err
+	}
+	if transactional {
+		r.query = url.Values{"transactional": {"true"}}
+	}
+	r.keepFailed = true
+
+	resp, err := c.do(ctx, r)
+	if err != nil {
+		return batch, err
+	}
+	if resp.StatusCode != http.StatusOK && !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return batch, readError(resp)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if err := json.NewDecoder(resp.Body).Decode(&batch); err != nil {
+		return batch, fmt.Errorf("invalid response to batch: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return batch, &Error{StatusCode: resp.StatusCode, Message: fmt.Sprintf("%d of %d requests failed", batch.Failed, len(batch.Results))}
+	}
+	return batch, nil
+}
+
+// Follow returns where the link path, a name followed by any path passed through, redirects a visitor right now.
+// Unlike Stats it counts as a hit.
+func (c *Client) Follow(ctx context.Context, path string) (string, error) {
+	resp, err := c.do(ctx, request{method: http.MethodGet, path: "/" + path})
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return "", &Error{StatusCode: resp.StatusCode, Message: "no redirect"}
+	}
+	return location, nil
+}
+
+// Delete deletes the link abv. Deleting a link that doesn't exist isn't an error.
+func (c *Client) Delete(ctx context.Context, abv string) error {
+	resp, err := c.do(ctx, request{method: http.MethodDelete, path: linkPath(abv)})
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Stats returns the link abv with its hits, and a series of them shaped by q, which can be nil
+func (c *Client) Stats(ctx context.Context, abv string, q *StatsQuery) (Stats, error) {
+	var stats Stats
+	r := request{method: http.MethodGet, path: linkPath(abv, "stats"), query: url.Values{}}
+	if q != nil {
+		setIf(r.query, "granularity", q.Granularity)
+		setIf(r.query, "tz", q.TimeZone)
+		if !q.From.IsZero() {
+			r.query.Set("from", q.From.Format(time.RFC3339))
+		}
+		if !q.To.IsZero() {
+			r.query.Set("to", q.To.Format(time.RFC3339))
+		}
+	}
+	err := c.call(ctx, r, &stats)
+	return stats, err
+}
+
+// QrCode returns a QR code of the short link abv, shaped by q, which can be nil
+func (c *Client) QrCode(ctx context.Context, abv string, q *QrQuery) ([]byte, error) {
+	r := request{method: http.MethodGet, path: linkPath(abv, "qr"), query: url.Values{}}
+	if q != nil {
+		setIf(r.query, "format", q.Format)
+		setIf(r.query, "ecc", q.Ecc)
+		setIf(r.query, "fg", q.Fg)
+		setIf(r.query, "bg", q.Bg)
+		if q.Size > 0 {
+			r.query.Set("size", strconv.Itoa(q.Size))
+		}
+		if q.Margin != nil {
+			r.query.Set("margin", strconv.Itoa(*q.Margin))
+		}
+		if q.Logo {
+			r.query.Set("logo", "true")
+		}
+	}
+	resp, err := c.do(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	return io.ReadAll(resp.Body)
+}
+
+// Options returns the redirect options of the link abv
+func (c *Client) Options(ctx context.Context, abv string) (Options, error) {
+	var options Options
+	err := c.call(ctx, request{method: http.MethodGet, path: linkPath(abv, "options")}, &options)
+	return options, err
+}
+
+// SetOptions replaces the redirect options of the link abv, returning them as saved
+func (c *Client) SetOptions(ctx context.Context, abv string, options Options) (Options, error) {
+	return c.putOptions(ctx, linkPath(abv, "options"), options)
+}
+
+// SetExperiment replaces just the experiment of the link abv, ending it when experiment is nil, and returns the
+// link's options as saved
+func (c *Client) SetExperiment(ctx context.Context, abv string, experiment *Experiment) (Options, error) {
+	return c.putOptions(ctx, linkPath(abv, "experiment"), experiment)
+}
+
+func (c *Client) putOptions(ctx context.Context, path string, body any) (Options, error) {
+	var options Options
+	r, err := jsonRequest(http.MethodPut, path, body)
+	if err != nil {
+		return options, err
+	}
+	err = c.call(ctx, r, &options)
+	return options, err
+}
+
+// SetPassword protects the link abv with password, or removes its protection when password is empty, and returns
+// whether it's protected
+func (c *Client) SetPassword(ctx context.Context, abv, password string) (bool, error) {
+	var protected struct {
+		Protected bool `json:"protected"`
+	}
+	r, err := jsonRequest(http.MethodPut, linkPath(abv, "password"), map[string]string{"password": password})
+	if err != nil {
+		return false, err
+	}
+	err = c.call(ctx, r, &protected)
+	return protected.Protected, err
+}
+
+// Unlock sends password for the protected link abv. The cookie the right one earns is kept by the jar of the
+// client's http.Client, if it has one; a wrong one fails with a 403 *Error.
+func (c *Client) Unlock(ctx context.Context, abv, password string) error {
+	r := request{
+		method:      http.MethodPost,
+		path:        linkPath(abv, "unlock"),
+		body:        []byte(url.Values{"password": {password}}.Encode()),
+		contentType: "application/x-www-form-urlencoded",
+	}
+	resp, err := c.do(ctx, r)
+	if err != nil {
+		var e *Error
+		if errors.As(err, &e) && e.StatusCode == http.StatusForbidden {
+			e.Message = "wrong password"
+		}
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// AddTags tags the link abv, returning all of its tags and its collection
+func (c *Client) AddTags(ctx context.Context, abv string, tags ...string) (Groups, error) {
+	var groups Groups
+	r, err := jsonRequest(http.MethodPost, linkPath(abv, "tags"), tags)
+	if err != nil {
+		return groups, err
+	}
+	err = c.call(ctx, r, &groups)
+	return groups, err
+}
+
+// RemoveTag takes tag off the link abv, returning the tags left and its collection
+func (c *Client) RemoveTag(ctx context.Context, abv, tag string) (Groups, error) {
+	var groups Groups
+	err := c.call(ctx, request{method: http.MethodDelete, path: linkPath(abv, "tags", tag)}, &groups)
+	return groups, err
+}
+
+// SetCollection puts the link abv in collection, or takes it out of its collection when collection is empty
+func (c *Client) SetCollection(ctx context.Context, abv, collection string) (Groups, error) {
+	var groups Groups
+	r, err := jsonRequest(http.MethodPut, linkPath(abv, "collection"), collection)
+	if err != nil {
+		return groups, err
+	}
+	err = c.call(ctx, r, &groups)
+	return groups, err
+}
+
+// TagLinks returns up to limit links with tag, by name; 0 leaves the limit to the service
+func (c *Client) TagLinks(ctx context.Context, tag string, limit int) (GroupLinks, error) {
+	return c.groupLinks(ctx, "/api/tags/"+url.PathEscape(tag), limit)
+}
+
+// CollectionLinks returns up to limit links in collection, by name; 0 leaves the limit to the service
+func (c *Client) CollectionLinks(ctx context.Context, collection string, limit int) (GroupLinks, error) {
+	return c.groupLinks(ctx, "/api/collections/"+url.PathEscape(collection), limit)
+}
+
+func (c *Client) groupLinks(ctx context.Context, path string, limit int) (GroupLinks, error) {
+	var links GroupLinks
+	r := request{method: http.MethodGet, path: path, query: url.Values{}}
+	if limit > 0 {
+		r.query.Set("limit", strconv.Itoa(limit))
+	}
+	err := c.call(ctx, r, &links)
+	return links, err
+}
+
+// TagStats adds up the hits on the links with tag over w, which can be nil
+func (c *Client) TagStats(ctx context.Context, tag string, w *Window) (GroupStats, error) {
+	var stats GroupStats
+	err := c.call(ctx, windowRequest("/api/tags/"+url.PathEscape(tag)+"/stats", w), &stats)
+	return stats, err
+}
+
+// CollectionStats adds up the hits on the links in collection over w, which can be nil
+func (c *Client) CollectionStats(ctx context.Context, collection string, w *Window) (GroupStats, error) {
+	var stats GroupStats
+	err := c.call(ctx, windowRequest("/api/collections/"+url.PathEscape(collection)+"/stats", w), &stats)
+	return stats, err
+}
+
+// Analytics returns the hits and new links across all links over w, which can be nil
+func (c *Client) Analytics(ctx context.Context, w *Window) (Analytics, error) {
+	var analytics Analytics
+	err := c.call(ctx, windowRequest("/api/analytics", w), &analytics)
+	return analytics, err
+}
+
+// Links returns up to limit links whose names start with prefix, or all of them when prefix is empty, by name;
+// 0 leaves the limit to the service
+func (c *Client) Links(ctx context.Context, prefix string, limit int) ([]LinkSummary, error) {
+	var links struct {
+		Links []LinkSummary `json:"links"`
+	}
+	r := request{method: http.MethodGet, path: "/api/links", query: url.Values{}}
+	setIf(r.query, "prefix", prefix)
+	if limit > 0 {
+		r.query.Set("limit", strconv.Itoa(limit))
+	}
+	err := c.call(ctx, r, &links)
+	return links.Links, err
+}
+
+// Unhealthy returns up to limit links whose destinations failed their last check, dead ones first; 0 leaves the
+// limit to the service
+func (c *Client) Unhealthy(ctx context.Context, limit int) ([]UnhealthyLink, error) {
+	var unhealthy struct {
+		Links []UnhealthyLink `json:"links"`
+	}
+	r := request{method: http.MethodGet, path: "/api/links/unhealthy", query: url.Values{}}
+	if limit > 0 {
+		r.query.Set("limit", strconv.Itoa(limit))
+	}
+	err := c.call(ctx, r, &unhealthy)
+	return unhealthy.Links, err
+}
+
+// Status returns the health of the service
+func (c *Client) Status(ctx context.Context) (Status, error) {
+	var status Status
+	err := c.call(ctx, request{method: http.MethodGet, path: "/diag/status"}, &status)
+	return status, err
+}
+
+// Metrics returns the request counts of the instance that answers
+func (c *Client) Metrics(ctx context.Context) (Metrics, error) {
+	var metrics Metrics
+	err := c.call(ctx, request{method: http.MethodGet, path: "/diag/metrics"}, &metrics)
+	return metrics, err
+}
+
+// OpenApi returns the OpenAPI document describing the service's API
+func (c *Client) OpenApi(ctx context.Context) ([]byte, error) {
+	resp, err := c.do(ctx, request{method: http.MethodGet, path: "/api/openapi.json"})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	return io.ReadAll(resp.Body)
+}
+
+func windowRequest(path string, w *Window) request {
+	r := request{method: http.MethodGet, path: path, query: url.Values{}}
+	if w == nil {
+		return r
+	}
+	if !w.From.IsZero() {
+		r.query.Set("from", w.From.Format(time.DateOnly))
+	}
+	if !w.To.IsZero() {
+		r.query.Set("to", w.To.Format(time.DateOnly))
+	}
+	if w.Days > 0 {
+		r.query.Set("days", strconv.Itoa(w.Days))
+	}
+	if w.Limit > 0 {
+		r.query.Set("limit", strconv.Itoa(w.Limit))
+	}
+	return r
+}
+
+func setIf(query url.Values, key, value string) {
+	if value != "" {
+		query.Set(key, value)
+	}
+}
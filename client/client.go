@@ -0,0 +1,258 @@
+// Package client is a typed client of the shorturl HTTP API, described by the OpenAPI document the service serves
+// at /api/openapi.json. Requests take a context, and ones that fail in ways a retry can fix are retried.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRetries  = 2
+	defaultBackoff  = 200 * time.Millisecond
+	maxBackoff      = 10 * time.Second
+	maxErrorMessage = 4096
+)
+
+// Client makes requests to a shorturl service. It's safe to use from several goroutines.
+type Client struct {
+	base    *url.URL
+	http    *http.Client
+	host    string
+	header  http.Header
+	retries int
+	backoff time.Duration
+}
+
+// Option changes how a Client makes requests
+type Option func(*Client)
+
+// WithHTTPClient makes the requests with c, for its transport, timeout or cookie jar. The cookie that unlocks a
+// password-protected link is only kept when c has a jar.
+func WithHTTPClient(c *http.Client) Option {
+	return func(client *Client) {
+		client.http = c
+	}
+}
+
+// WithHost sends requests with host as their Host header, which picks the tenant the links belong to when the
+// service is reached by another name
+func WithHost(host string) Option {
+	return func(client *Client) {
+		client.host = host
+	}
+}
+
+// WithHeader adds a header to every request, such as the credentials of a proxy in front of the service
+func WithHeader(key, value string) Option {
+	return func(client *Client) {
+		client.header.Add(key, value)
+	}
+}
+
+// WithRetries sets how many times a failed request is retried, and the wait before the first retry, which doubles
+// for each one after it. Connection errors, 429 and 502 to 504 responses are retried.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(client *Client) {
+		client.retries = max(0, retries)
+		client.backoff = backoff
+	}
+}
+
+// New returns a Client of the service at baseUrl, like http://localhost:8800
+func New(baseUrl string, options ...Option) (*Client, error) {
+	base, err := url.Parse(strings.TrimSuffix(baseUrl, "/"))
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("invalid base url %q", baseUrl)
+	}
+	c := &Client{
+		base:    base,
+		http:    http.DefaultClient,
+		header:  make(http.Header),
+		retries: defaultRetries,
+		backoff: defaultBackoff,
+	}
+	for _, option := range options {
+		option(c)
+	}
+
+	// the service answers with redirects that are the point of the request, so they're never followed
+	noRedirects := *c.http
+	noRedirects.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	c.http = &noRedirects
+	return c, nil
+}
+
+// Error is a response from the service that wasn't a success
+type Error struct {
+	StatusCode int
+	Message    string
+	// Rejection is why the destination policy turned down a url, when that's why the request failed
+	Rejection *Rejection
+}
+
+func (e *Error) Error() string {
+	if e.Rejection != nil {
+		return fmt.Sprintf("%d %s: %s", e.StatusCode, e.Rejection.Code, e.Rejection.Reason)
+	}
+	return fmt.Sprintf("%d %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound returns whether err is the service saying there's no such link
+func IsNotFound(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.StatusCode == http.StatusNotFound
+}
+
+// request is a request to the service
+type request struct {
+	method      string
+	path        string // already escaped
+	query       url.Values
+	body        []byte
+	contentType string
+	keepFailed  bool // failed responses are returned as they are rather than read into an *Error
+}
+
+func jsonRequest(method, path string, body any) (request, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return request{}, err
+	}
+	return request{method: method, path: path, body: b, contentType: "application/json"}, nil
+}
+
+// do makes r, retrying it when that could help, and returns the final response. Unless r keeps them, responses
+// other than 2xx and 3xx are returned as an *Error.
+func (c *Client) do(ctx context.Context, r request) (*http.Response, error) {
+	u := *c.base
+	u.Path += pathUnescaped(r.path)
+	u.RawPath = c.base.EscapedPath() + r.path
+	u.RawQuery = r.query.Encode()
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, r.method, u.String(), bytes.NewReader(r.body))
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range c.header {
+			req.Header[key] = values
+		}
+		if r.contentType != "" {
+			req.Header.Set("Content-Type", r.contentType)
+		}
+		if c.host != "" {
+			req.Host = c.host
+		}
+
+		resp, err := c.http.Do(req)
+		wait, retry := c.retryAfter(attempt, resp, err)
+		if !retry {
+			if err != nil {
+				return nil, err
+			}
+			if resp.StatusCode >= 400 && !r.keepFailed {
+				return nil, readError(resp)
+			}
+			return resp, nil
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryAfter returns whether the outcome of attempt is worth retrying, and how long to wait before doing so
+func (c *Client) retryAfter(attempt int, resp *http.Response, err error) (time.Duration, bool) {
+	if attempt >= c.retries {
+		return 0, false
+	}
+	if err != nil {
+		// a canceled or expired context won't get any better
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return 0, false
+		}
+	} else {
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		default:
+			return 0, false
+		}
+	}
+
+	wait := min(c.backoff<<attempt, maxBackoff)
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			wait = min(time.Duration(seconds)*time.Second, maxBackoff)
+		}
+	}
+	return wait, true
+}
+
+// readError reads the body of a failed response into an *Error
+func readError(resp *http.Response) error {
+	defer func() { _ = resp.Body.Close() }()
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorMessage))
+
+	e := &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(b))}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		var rejection Rejection
+		if json.Unmarshal(b, &rejection) == nil && rejection.Code != "" {
+			e.Rejection = &rejection
+			e.Message = rejection.Reason
+		}
+	}
+	if e.Message == "" {
+		e.Message = http.StatusText(resp.StatusCode)
+	}
+	return e
+}
+
+// call makes r and decodes the JSON response into out
+func (c *Client) call(ctx context.Context, r request, out any) error {
+	resp, err := c.do(ctx, r)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid response to %s %s: %v", r.method, r.path, err)
+	}
+	return nil
+}
+
+// linkPath returns the path of abv, followed by more segments, escaping the slashes of multi-segment names
+func linkPath(abv string, segments ...string) string {
+	escaped := []string{"", url.PathEscape(abv)}
+	for _, segment := range segments {
+		escaped = append(escaped, url.PathEscape(segment))
+	}
+	return strings.Join(escaped, "/")
+}
+
+func pathUnescaped(escaped string) string {
+	if s, err := url.PathUnescape(escaped); err == nil {
+		return s
+	}
+	return escaped
+}
@@ -0,0 +1,232 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/ericfialkowski/shorturl/handlers"
+	"github.com/ericfialkowski/shorturl/status"
+	"github.com/labstack/echo/v5"
+)
+
+// testServer runs the service's handlers on an in-memory database
+func testServer(t *testing.T) (*httptest.Server, dao.ShortUrlDao) {
+	t.Helper()
+	db := dao.CreateMemoryDB()
+	s := status.NewStatus()
+	s.Ok("test")
+	h := handlers.CreateHandlers(db, s, "test-id", nil)
+	e := echo.New()
+	h.SetUp(e)
+	srv := httptest.NewServer(e)
+	t.Cleanup(func() {
+		srv.Close()
+		db.Cleanup()
+	})
+	return srv, db
+}
+
+func TestNew(t *testing.T) {
+	for _, u := range []string{"", "localhost:8800", "ftp://host", "http://"} {
+		if _, err := New(u); err == nil {
+			t.Errorf("New(%q) = nil error, want one", u)
+		}
+	}
+	if _, err := New("http://localhost:8800/"); err != nil {
+		t.Errorf("New() error = %v", err)
+	}
+}
+
+func TestClient_Links(t *testing.T) {
+	srv, _ := testServer(t)
+	ctx := context.Background()
+	jar, _ := cookiejar.New(nil)
+	c, err := New(srv.URL, WithHTTPClient(&http.Client{Jar: jar}), WithHost("sho.rt"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	link, err := c.Create(ctx, "https://example.com")
+	if err != nil || link.Abv == "" || link.UrlLink != "/"+link.Abv {
+		t.Fatalf("Create() = %+v, %v", link, err)
+	}
+	if again, _ := c.Create(ctx, "https://example.com"); again.Abv != link.Abv {
+		t.Errorf("Create() of the same url = %s, want %s", again.Abv, link.Abv)
+	}
+	named, err := c.CreateLink(ctx, CreateRequest{Url: "https://wiki.com", Name: "team/wiki"})
+	if err != nil || named.Abv != "team/wiki" {
+		t.Errorf("CreateLink() = %+v, %v", named, err)
+	}
+
+	var e *Error
+	if _, err := c.CreateLink(ctx, CreateRequest{Url: "https://other.com", Name: "team/wiki"}); !errors.As(err, &e) || e.StatusCode != http.StatusConflict {
+		t.Errorf("CreateLink() of a taken name error = %v, want a 409", err)
+	}
+	if _, err := c.Create(ctx, "https://bit.ly/abc"); !errors.As(err, &e) || e.Rejection == nil || e.Rejection.Code != "known_shortener" {
+		t.Errorf("Create() of a shortener error = %v, want its rejection", err)
+	}
+
+	if dest, err := c.Follow(ctx, "team%2Fwiki"); err != nil || dest != "https://wiki.com" {
+		t.Errorf("Follow() = %q, %v, want https://wiki.com", dest, err)
+	}
+	// Go's user agent is counted as a bot
+	stats, err := c.Stats(ctx, "team/wiki", &StatsQuery{Granularity: "hour", TimeZone: "Europe/Berlin"})
+	if err != nil || stats.Url != "https://wiki.com" || stats.BotHits != 1 || stats.Series.Granularity != "hour" {
+		t.Errorf("Stats() = %+v, %v", stats, err)
+	}
+
+	options, err := c.SetOptions(ctx, "team/wiki", Options{Passthrough: &Passthrough{Path: true}, Status: 308})
+	if err != nil || options.Status != 308 || options.Passthrough == nil || !options.Passthrough.Path {
+		t.Errorf("SetOptions() = %+v, %v", options, err)
+	}
+	if dest, err := c.Follow(ctx, "team/wiki/page"); err != nil || dest != "https://wiki.com/page" {
+		t.Errorf("Follow() with a path = %q, %v, want https://wiki.com/page", dest, err)
+	}
+	experiment := &Experiment{Variants: []Variant{{Name: "a", Url: "https://a.com", Weight: 1}}}
+	if options, err = c.SetExperiment(ctx, "team/wiki", experiment); err != nil || options.Experiment == nil || options.Status != 308 {
+		t.Errorf("SetExperiment() = %+v, %v", options, err)
+	}
+	if options, err = c.SetExperiment(ctx, "team/wiki", nil); err != nil || options.Experiment != nil {
+		t.Errorf("SetExperiment(nil) = %+v, %v", options, err)
+	}
+	if options, err = c.Options(ctx, "team/wiki"); err != nil || options.Status != 308 {
+		t.Errorf("Options() = %+v, %v", options, err)
+	}
+
+	if groups, err := c.AddTags(ctx, link.Abv, "Spring", "email"); err != nil || !slices.Equal(groups.Tags, []string{"email", "spring"}) {
+		t.Errorf("AddTags() = %+v, %v", groups, err)
+	}
+	if groups, err := c.RemoveTag(ctx, link.Abv, "email"); err != nil || !slices.Equal(groups.Tags, []string{"spring"}) {
+		t.Errorf("RemoveTag() = %+v, %v", groups, err)
+	}
+	if groups, err := c.SetCollection(ctx, link.Abv, "launch"); err != nil || groups.Collection != "launch" {
+		t.Errorf("SetCollection() = %+v, %v", groups, err)
+	}
+	if links, err := c.TagLinks(ctx, "spring", 10); err != nil || len(links.Links) != 1 || links.Links[0].Abbreviation != link.Abv {
+		t.Errorf("TagLinks() = %+v, %v", links, err)
+	}
+	if links, err := c.CollectionLinks(ctx, "launch", 0); err != nil || len(links.Links) != 1 {
+		t.Errorf("CollectionLinks() = %+v, %v", links, err)
+	}
+	if stats, err := c.TagStats(ctx, "spring", &Window{Days: 3}); err != nil || stats.Links != 1 || len(stats.Days) != 3 {
+		t.Errorf("TagStats() = %+v, %v", stats, err)
+	}
+	if stats, err := c.CollectionStats(ctx, "launch", nil); err != nil || stats.Kind != "collection" {
+		t.Errorf("CollectionStats() = %+v, %v", stats, err)
+	}
+	if analytics, err := c.Analytics(ctx, &Window{To: time.Now().UTC(), Days: 2, Limit: 5}); err != nil || len(analytics.Days) != 2 || analytics.NeverClickedTotal != 2 {
+		t.Errorf("Analytics() = %+v, %v", analytics, err)
+	}
+	if links, err := c.Links(ctx, "team/", 0); err != nil || len(links) != 1 || links[0].Url != "https://wiki.com" {
+		t.Errorf("Links() = %+v, %v", links, err)
+	}
+	if unhealthy, err := c.Unhealthy(ctx, 10); err != nil || len(unhealthy) != 0 {
+		t.Errorf("Unhealthy() = %+v, %v", unhealthy, err)
+	}
+
+	batch, err := c.CreateBatch(ctx, []CreateRequest{{Url: "https://one.com"}, {Url: "ftp://two.com"}}, false)
+	if err != nil || batch.Succeeded != 1 || batch.Failed != 1 || batch.Results[0].Abv == "" || batch.Results[1].Rejection == nil {
+		t.Errorf("CreateBatch() = %+v, %v", batch, err)
+	}
+	if _, err := c.CreateBatch(ctx, []CreateRequest{{Url: "https://three.com"}}, true); !errors.As(err, &e) || e.StatusCode != http.StatusBadRequest {
+		t.Errorf("CreateBatch() transactional on memory error = %v, want a 400", err)
+	}
+
+	if png, err := c.QrCode(ctx, link.Abv, &QrQuery{Size: 64}); err != nil || !bytes.HasPrefix(png, []byte("\x89PNG")) {
+		t.Errorf("QrCode() = %d bytes, %v, want a PNG", len(png), err)
+	}
+	if svg, err := c.QrCode(ctx, link.Abv, &QrQuery{Format: "svg"}); err != nil || !bytes.Contains(svg, []byte("<svg")) {
+		t.Errorf("QrCode(svg) = %d bytes, %v, want an SVG", len(svg), err)
+	}
+	if doc, err := c.OpenApi(ctx); err != nil || !bytes.Contains(doc, []byte(`"openapi"`)) {
+		t.Errorf("OpenApi() = %d bytes, %v", len(doc), err)
+	}
+	if s, err := c.Status(ctx); err != nil || s.Code != 0 {
+		t.Errorf("Status() = %+v, %v", s, err)
+	}
+	if m, err := c.Metrics(ctx); err != nil || m.NewUrls == 0 || m.Uptime == "" {
+		t.Errorf("Metrics() = %+v, %v", m, err)
+	}
+
+	if protected, err := c.SetPassword(ctx, link.Abv, "correct horse battery"); err != nil || !protected {
+		t.Errorf("SetPassword() = %v, %v", protected, err)
+	}
+	if stats, _ := c.Stats(ctx, link.Abv, nil); stats.Url != "" {
+		t.Errorf("Stats() of a locked link has url %q", stats.Url)
+	}
+	if err := c.Unlock(ctx, link.Abv, "wrong password"); !errors.As(err, &e) || e.StatusCode != http.StatusForbidden {
+		t.Errorf("Unlock() with the wrong password error = %v, want a 403", err)
+	}
+	if err := c.Unlock(ctx, link.Abv, "correct horse battery"); err != nil {
+		t.Errorf("Unlock() error = %v", err)
+	}
+	if dest, err := c.Follow(ctx, link.Abv); err != nil || dest != "https://example.com" {
+		t.Errorf("Follow() once unlocked = %q, %v", dest, err)
+	}
+
+	if err := c.Delete(ctx, link.Abv); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+	if _, err := c.Stats(ctx, link.Abv, nil); !IsNotFound(err) {
+		t.Errorf("Stats() of a deleted link error = %v, want not found", err)
+	}
+}
+
+func TestClient_Retries(t *testing.T) {
+	var attempts, failures, status atomic.Int32
+	var retryAfter atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) <= failures.Load() {
+			if retryAfter.Load() {
+				w.Header().Set("Retry-After", "0")
+			}
+			w.WriteHeader(int(status.Load()))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status_code": 0, "status_msg": "ok", "timestamp": "now"}`))
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+	failures.Store(2)
+	status.Store(http.StatusServiceUnavailable)
+	retryAfter.Store(true)
+
+	c, _ := New(srv.URL, WithRetries(2, time.Hour))
+	if s, err := c.Status(ctx); err != nil || s.Message != "ok" || attempts.Load() != 3 {
+		t.Errorf("Status() = %+v, %v after %d attempts, want ok after 3", s, err, attempts.Load())
+	}
+
+	attempts.Store(0)
+	failures.Store(3)
+	if _, err := c.Status(ctx); err == nil || attempts.Load() != 3 {
+		t.Errorf("Status() error = %v after %d attempts, want an error after 3", err, attempts.Load())
+	}
+
+	// errors of the service itself aren't retried
+	attempts.Store(0)
+	status.Store(http.StatusInternalServerError)
+	var e *Error
+	if _, err := c.Status(ctx); !errors.As(err, &e) || e.StatusCode != http.StatusInternalServerError || attempts.Load() != 1 {
+		t.Errorf("Status() error = %v after %d attempts, want a 500 after 1", err, attempts.Load())
+	}
+
+	// nor is waiting for a retry once the context is done
+	attempts.Store(0)
+	status.Store(http.StatusServiceUnavailable)
+	retryAfter.Store(false)
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.Status(ctx); !errors.Is(err, context.DeadlineExceeded) || attempts.Load() != 1 {
+		t.Errorf("Status() error = %v after %d attempts, want the context's after 1", err, attempts.Load())
+	}
+}
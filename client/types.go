@@ -0,0 +1,290 @@
+package client
+
+import "time"
+
+// CreateRequest asks for a link to Url, called Name when it isn't empty, that stops redirecting at Expires when
+// that isn't nil
+type CreateRequest struct {
+	Url     string     `json:"url"`
+	Name    string     `json:"name,omitempty"`
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// Link is a short link and where to find out about it, as paths on the service
+type Link struct {
+	Abv         string `json:"abv"`
+	UrlLink     string `json:"url_link"`
+	StatsLink   string `json:"stats_link"`
+	StatsUiLink string `json:"stats_ui_link"`
+	QrLink      string `json:"qr_link"`
+}
+
+// Rejection is why the destination policy turned down a url
+type Rejection struct {
+	Code   string `json:"code"`
+	Reason string `json:"reason"`
+	Rule   string `json:"rule,omitempty"`
+}
+
+// Batch is how each request of a batch went, in the order they were sent
+type Batch struct {
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Results   []BatchResult `json:"results"`
+}
+
+// BatchResult is the link a request of a batch created when Status is 200, or why it failed otherwise
+type BatchResult struct {
+	Status int `json:"status"`
+	Link
+	Error     string     `json:"error,omitempty"`
+	Rejection *Rejection `json:"rejection,omitempty"`
+}
+
+// Stats is a link and its hits. Until a password-protected link is unlocked, Url, Options, Health and Metadata
+// are left out.
+type Stats struct {
+	Domain       string           `json:"domain,omitempty"`
+	Abbreviation string           `json:"abbreviation"`
+	Url          string           `json:"url"`
+	Hits         int              `json:"hits"`
+	LastAccess   time.Time        `json:"last_access"`
+	DailyHits    map[string]int   `json:"daily_hits"`
+	CountryHits  map[string]int   `json:"country_hits"`
+	RegionHits   map[string]int   `json:"region_hits"`
+	ReferrerHits map[string]int   `json:"referrer_hits"`
+	VariantHits  map[string]int   `json:"variant_hits,omitempty"`
+	Uniques      int64            `json:"uniques"`
+	DailyUniques map[string]int64 `json:"daily_uniques"`
+	BotHits      int              `json:"bot_hits"`
+	BotFamilies  map[string]int   `json:"bot_families"`
+	Blocked      string           `json:"blocked,omitempty"`
+	Protected    bool             `json:"protected,omitempty"`
+	Tags         []string         `json:"tags,omitempty"`
+	Collection   string           `json:"collection,omitempty"`
+	Options      *Options         `json:"options,omitempty"`
+	Health       *Health          `json:"health,omitempty"`
+	Metadata     *Metadata        `json:"metadata,omitempty"`
+	Redirect     Redirect         `json:"redirect"`
+	Series       Series           `json:"series"`
+}
+
+// Redirect is how a link redirects and how long the redirect can be cached
+type Redirect struct {
+	Status       int    `json:"status"`
+	CacheControl string `json:"cache_control"`
+	Note         string `json:"note,omitempty"`
+}
+
+// Series is the hits of a link in buckets of Granularity, zero-filled
+type Series struct {
+	From        time.Time     `json:"from"`
+	To          time.Time     `json:"to"`
+	Granularity string        `json:"granularity"`
+	TimeZone    string        `json:"tz"`
+	Uniques     int64         `json:"uniques"`
+	Points      []SeriesPoint `json:"points"`
+}
+
+// SeriesPoint is the hits in the bucket starting at Start. Hourly points have no Uniques.
+type SeriesPoint struct {
+	Start   time.Time `json:"start"`
+	Hits    int       `json:"hits"`
+	Uniques *int64    `json:"uniques,omitempty"`
+}
+
+// StatsQuery shapes the series of a link's stats. Zero fields are left to the service's defaults.
+type StatsQuery struct {
+	Granularity string // hour, day, week or month
+	TimeZone    string // IANA zone the buckets are aligned to
+	From        time.Time
+	To          time.Time
+}
+
+// Options change how a link redirects. The zero value redirects to the destination as it is.
+type Options struct {
+	Passthrough *Passthrough `json:"passthrough,omitempty"`
+	Rules       []Rule       `json:"rules,omitempty"`
+	Experiment  *Experiment  `json:"experiment,omitempty"`
+	Status      int          `json:"status,omitempty"`
+	Expires     *time.Time   `json:"expires,omitempty"`
+}
+
+// Passthrough is what of the request is carried over to the destination
+type Passthrough struct {
+	Path      bool   `json:"path,omitempty"`
+	Query     bool   `json:"query,omitempty"`
+	Conflicts string `json:"conflicts,omitempty"` // keep, replace or append
+}
+
+// Rule sends the visitors it matches to Url instead of the destination
+type Rule struct {
+	Platforms []string `json:"platforms,omitempty"`
+	Languages []string `json:"languages,omitempty"`
+	Countries []string `json:"countries,omitempty"`
+	Days      []string `json:"days,omitempty"`
+	From      string   `json:"from,omitempty"`
+	To        string   `json:"to,omitempty"`
+	TimeZone  string   `json:"tz,omitempty"`
+	Url       string   `json:"url"`
+}
+
+// Experiment splits visitors between weighted destinations
+type Experiment struct {
+	Variants []Variant `json:"variants"`
+	Winner   string    `json:"winner,omitempty"`
+}
+
+// Variant is one of the destinations of an experiment
+type Variant struct {
+	Name   string `json:"name"`
+	Url    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+// Health is the last check of a link's destination
+type Health struct {
+	Status    int       `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Redirects []string  `json:"redirects,omitempty"`
+	Checked   time.Time `json:"checked"`
+	Failures  int       `json:"failures"`
+	Dead      bool      `json:"dead"`
+}
+
+// Metadata describes a link's destination
+type Metadata struct {
+	Title       string    `json:"title,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Image       string    `json:"image,omitempty"`
+	SiteName    string    `json:"site_name,omitempty"`
+	Favicon     string    `json:"favicon,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Fetched     time.Time `json:"fetched"`
+}
+
+// UnhealthyLink is a link whose destination failed its last check
+type UnhealthyLink struct {
+	Domain       string `json:"domain,omitempty"`
+	Abbreviation string `json:"abbreviation"`
+	Url          string `json:"url"`
+	Health       Health `json:"health"`
+}
+
+// Groups are the tags and collection of a link
+type Groups struct {
+	Tags       []string `json:"tags"`
+	Collection string   `json:"collection"`
+}
+
+// LinkSummary is a link in a list of links
+type LinkSummary struct {
+	Abbreviation string `json:"abbreviation"`
+	Url          string `json:"url"` // empty for protected links
+	Protected    bool   `json:"protected,omitempty"`
+}
+
+// GroupLinks are the links with a tag or in a collection
+type GroupLinks struct {
+	Kind  string        `json:"kind"`
+	Name  string        `json:"name"`
+	Links []LinkSummary `json:"links"`
+}
+
+// GroupStats add up the hits on the links with a tag or in a collection over a window of UTC dates
+type GroupStats struct {
+	Kind       string      `json:"kind"`
+	Name       string      `json:"name"`
+	From       string      `json:"from"`
+	To         string      `json:"to"`
+	Limit      int         `json:"limit"`
+	Links      int         `json:"links"`
+	Hits       int         `json:"hits"`
+	WindowHits int         `json:"window_hits"`
+	Days       []DayHits   `json:"days"`
+	TopLinks   []LinkCount `json:"top_links"`
+}
+
+// DayHits is the hits on a UTC date
+type DayHits struct {
+	Date string `json:"date"`
+	Hits int    `json:"hits"`
+}
+
+// LinkCount is the hits of a link in a window, and in the window before it
+type LinkCount struct {
+	Domain       string `json:"domain,omitempty"`
+	Abbreviation string `json:"abbreviation"`
+	Url          string `json:"url"`
+	Hits         int    `json:"hits"`
+	PriorHits    int    `json:"prior_hits"`
+}
+
+// Window is a range of UTC dates, either From to To or the Days ending with To. Zero fields are left to the
+// service's defaults, the last week ending today.
+type Window struct {
+	From  time.Time
+	To    time.Time
+	Days  int
+	Limit int // number of links in each list
+}
+
+// Analytics are the hits and new links across all links over a window of UTC dates
+type Analytics struct {
+	From              string         `json:"from"`
+	To                string         `json:"to"`
+	PriorFrom         string         `json:"prior_from"`
+	PriorTo           string         `json:"prior_to"`
+	Limit             int            `json:"limit"`
+	Days              []AnalyticsDay `json:"days"`
+	TopLinks          []LinkCount    `json:"top_links"`
+	Trending          []LinkCount    `json:"trending"`
+	NeverClicked      []LinkCount    `json:"never_clicked"`
+	NeverClickedTotal int            `json:"never_clicked_total"`
+}
+
+// AnalyticsDay is the hits on every link and the links created on a UTC date
+type AnalyticsDay struct {
+	Date    string `json:"date"`
+	Hits    int    `json:"hits"`
+	Created int    `json:"created"`
+}
+
+// QrQuery shapes a QR code. Zero fields are left to the service's defaults, a 256 pixel PNG.
+type QrQuery struct {
+	Format string // png or svg
+	Size   int
+	Ecc    string // L, M, Q or H
+	Margin *int
+	Fg     string // hex color
+	Bg     string
+	Logo   bool
+}
+
+// Status is the health of the service
+type Status struct {
+	Code      int    `json:"status_code"` // 0 ok, 1 warning, 2 critical, 3 unknown
+	Message   string `json:"status_msg"`
+	Timestamp string `json:"timestamp"`
+}
+
+// Metrics are the request counts of the instance that answered since it started
+type Metrics struct {
+	Redirects    uint64 `json:"redirect_counts"`
+	BotRedirects uint64 `json:"bot_redirect_counts"`
+	UrlStats     uint64 `json:"redirect_stats_counts"`
+	NewUrls      uint64 `json:"new_url_counts"`
+	Rejected     uint64 `json:"rejected_url_counts"`
+	Blocked      uint64 `json:"blocked_redirect_counts"`
+	Unavailable  uint64 `json:"unavailable_redirect_counts"`
+	Deletes      uint64 `json:"delete_counts"`
+	Metrics      uint64 `json:"metric_request_counts"`
+	Status       uint64 `json:"stats_requests_counts"`
+	Analytics    uint64 `json:"analytics_request_counts"`
+	QrCodes      uint64 `json:"qr_code_counts"`
+	LinkHealth   uint64 `json:"link_health_request_counts"`
+	Options      uint64 `json:"options_request_counts"`
+	Searches     uint64 `json:"search_counts"`
+	Groups       uint64 `json:"group_request_counts"`
+	Uptime       string `json:"uptime"`
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ericfialkowski/shorturl/client"
+)
+
+const (
+	defaultDays = 30
+	maxLinks    = 1000
+	topCounts   = 5
+)
+
+// command is a subcommand, which parses its own flags from args
+type command struct {
+	args    string
+	summary string
+	run     func(ctx context.Context, c *cli, flags *flag.FlagSet, args []string) error
+}
+
+var (
+	commands = map[string]command{
+		"create": {"[-name alias] [-tag tag]... [-collection name] [-password password] [-expires when] url", "create a link to url", createCommand},
+		"get":    {"name", "show a link without counting a hit", getCommand},
+		"expand": {"path", "show where a link, and any path after it, redirects to right now, counting a hit", expandCommand},
+		"stats":  {"[-days n] name", "show the hits of a link, with a sparkline of the last days", statsCommand},
+		"delete": {"name...", "delete links", deleteCommand},
+		"list":   {"[-prefix prefix | -tag tag | -collection name] [-limit n]", "list links by name", listCommand},
+		"search": {"[-limit n] words...", "list the links whose names start with the words, as segments", searchCommand},
+		"export": {"[-prefix prefix] [-format json|csv] [-limit n]", "write links with their tags, collection and hits", exportCommand},
+	}
+	commandOrder = []string{"create", "get", "expand", "stats", "delete", "list", "search", "export"}
+)
+
+// stringList is a flag that can be repeated, or given as a comma separated list
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// parseArgs parses the flags of a command and checks it was given between lo and hi arguments, hi < 0 meaning
+// any number
+func parseArgs(flags *flag.FlagSet, args []string, lo, hi int) error {
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() < lo || (hi >= 0 && flags.NArg() > hi) {
+		flags.Usage()
+		return flag.ErrHelp
+	}
+	return nil
+}
+
+// createdLink is a new link with how it was organized
+type createdLink struct {
+	client.Link
+	ShortUrl   string     `json:"short_url"`
+	Url        string     `json:"url"`
+	Tags       []string   `json:"tags,omitempty"`
+	Collection string     `json:"collection,omitempty"`
+	Protected  bool       `json:"protected,omitempty"`
+	Expires    *time.Time `json:"expires,omitempty"`
+}
+
+// parseExpiry reads when a link expires, as a duration from now, a date or an RFC 3339 time
+func parseExpiry(s string, now time.Time) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		t := now.Add(d)
+		return &t, nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid expiry %q, want a duration like 720h, a date like 2026-12-31 or an RFC 3339 time", s)
+}
+
+func createCommand(ctx context.Context, c *cli, flags *flag.FlagSet, args []string) error {
+	name := flags.String("name", "", "alias of the link, which can have several segments like team/wiki")
+	var tags stringList
+	flags.Var(&tags, "tag", "tag the link, repeatable or comma separated")
+	collection := flags.String("collection", "", "put the link in a collection")
+	password := flags.String("password", "", "protect the link with a password")
+	expires := flags.String("expires", "", "stop redirecting after a duration like 720h, or at a date or RFC 3339 time")
+	if err := parseArgs(flags, args, 1, 1); err != nil {
+		return err
+	}
+	expiry, err := parseExpiry(*expires, time.Now())
+	if err != nil {
+		return err
+	}
+
+	link, err := c.client.CreateLink(ctx, client.CreateRequest{Url: flags.Arg(0), Name: *name, Expires: expiry})
+	if err != nil {
+		return err
+	}
+	created := createdLink{Link: link, ShortUrl: c.shortUrl(link.UrlLink), Url: flags.Arg(0), Expires: expiry}
+	if len(tags) > 0 {
+		groups, err := c.client.AddTags(ctx, link.Abv, tags...)
+		if err != nil {
+			return fmt.Errorf("created %s, but tagging it failed: %v", link.Abv, err)
+		}
+		created.Tags = groups.Tags
+	}
+	if *collection != "" {
+		groups, err := c.client.SetCollection(ctx, link.Abv, *collection)
+		if err != nil {
+			return fmt.Errorf("created %s, but putting it in %s failed: %v", link.Abv, *collection, err)
+		}
+		created.Collection = groups.Collection
+	}
+	if *password != "" {
+		if created.Protected, err = c.client.SetPassword(ctx, link.Abv, *password); err != nil {
+			return fmt.Errorf("created %s, but protecting it failed: %v", link.Abv, err)
+		}
+	}
+
+	return c.out.print(created, func(w io.Writer) {
+		row(w, "name", created.Abv)
+		row(w, "short url", created.ShortUrl)
+		row(w, "url", created.Url)
+		if len(created.Tags) > 0 {
+			row(w, "tags", strings.Join(created.Tags, ", "))
+		}
+		if created.Collection != "" {
+			row(w, "collection", created.Collection)
+		}
+		if created.Protected {
+			row(w, "protected", "yes")
+		}
+		if created.Expires != nil {
+			row(w, "expires", created.Expires.Local().Format(time.DateTime))
+		}
+	})
+}
+
+func getCommand(ctx context.Context, c *cli, flags *flag.FlagSet, args []string) error {
+	if err := parseArgs(flags, args, 1, 1); err != nil {
+		return err
+	}
+	stats, err := c.client.Stats(ctx, flags.Arg(0), nil)
+	if err != nil {
+		return err
+	}
+	return c.out.print(stats, func(w io.Writer) {
+		row(w, "name", stats.Abbreviation)
+		row(w, "short url", c.shortUrl("/"+stats.Abbreviation))
+		if stats.Protected && stats.Url == "" {
+			row(w, "url", "(protected)")
+		} else {
+			row(w, "url", stats.Url)
+		}
+		row(w, "hits", stats.Hits)
+		if !stats.LastAccess.IsZero() {
+			row(w, "last access", stats.LastAccess.Local().Format(time.DateTime))
+		}
+		if len(stats.Tags) > 0 {
+			row(w, "tags", strings.Join(stats.Tags, ", "))
+		}
+		if stats.Collection != "" {
+			row(w, "collection", stats.Collection)
+		}
+		row(w, "redirect", stats.Redirect.Status)
+		if stats.Options != nil && stats.Options.Expires != nil {
+			row(w, "expires", stats.Options.Expires.Local().Format(time.DateTime))
+		}
+		if stats.Blocked != "" {
+			row(w, "blocked", stats.Blocked)
+		}
+		if stats.Health != nil && stats.Health.Dead {
+			row(w, "dead since", stats.Health.Checked.Local().Format(time.DateTime))
+		}
+	})
+}
+
+func expandCommand(ctx context.Context, c *cli, flags *flag.FlagSet, args []string) error {
+	if err := parseArgs(flags, args, 1, 1); err != nil {
+		return err
+	}
+	path := strings.TrimPrefix(flags.Arg(0), "/")
+	dest, err := c.client.Follow(ctx, path)
+	if err != nil {
+		return err
+	}
+	expanded := struct {
+		Path string `json:"path"`
+		Url  string `json:"url"`
+	}{path, dest}
+	return c.out.print(expanded, func(w io.Writer) {
+		row(w, dest)
+	})
+}
+
+func statsCommand(ctx context.Context, c *cli, flags *flag.FlagSet, args []string) error {
+	days := flags.Int("days", defaultDays, "number of days in the sparkline")
+	if err := parseArgs(flags, args, 1, 1); err != nil {
+		return err
+	}
+	if *days < 1 {
+		return fmt.Errorf("invalid days %d", *days)
+	}
+	stats, err := c.client.Stats(ctx, flags.Arg(0), nil)
+	if err != nil {
+		return err
+	}
+
+	return c.out.print(stats, func(w io.Writer) {
+		hits := lastDays(stats.DailyHits, *days, time.Now())
+		total := 0
+		for _, h := range hits {
+			total += h
+		}
+		row(w, "name", stats.Abbreviation)
+		row(w, "hits", stats.Hits)
+		row(w, "uniques", stats.Uniques)
+		row(w, "bot hits", stats.BotHits)
+		if !stats.LastAccess.IsZero() {
+			row(w, "last access", stats.LastAccess.Local().Format(time.DateTime))
+		}
+		row(w, fmt.Sprintf("last %d days", *days), fmt.Sprintf("%s %d", sparkline(hits), total))
+		if len(stats.CountryHits) > 0 {
+			row(w, "countries", top(stats.CountryHits, topCounts))
+		}
+		if len(stats.ReferrerHits) > 0 {
+			row(w, "referrers", top(stats.ReferrerHits, topCounts))
+		}
+		if len(stats.VariantHits) > 0 {
+			row(w, "variants", top(stats.VariantHits, topCounts))
+		}
+	})
+}
+
+func deleteCommand(ctx context.Context, c *cli, flags *flag.FlagSet, args []string) error {
+	if err := parseArgs(flags, args, 1, -1); err != nil {
+		return err
+	}
+	deleted := struct {
+		Deleted []string `json:"deleted"`
+	}{}
+	for _, abv := range flags.Args() {
+		if err := c.client.Delete(ctx, abv); err != nil {
+			return fmt.Errorf("error deleting %s: %v", abv, err)
+		}
+		deleted.Deleted = append(deleted.Deleted, abv)
+	}
+	return c.out.print(deleted, func(w io.Writer) {
+		for _, abv := range deleted.Deleted {
+			row(w, "deleted", abv)
+		}
+	})
+}
+
+func listCommand(ctx context.Context, c *cli, flags *flag.FlagSet, args []string) error {
+	prefix := flags.String("prefix", "", "only links whose names start with prefix")
+	tag := flags.String("tag", "", "only links with tag")
+	collection := flags.String("collection", "", "only links in collection")
+	limit := flags.Int("limit", 0, fmt.Sprintf("most links listed, up to %d (default the service's)", maxLinks))
+	if err := parseArgs(flags, args, 0, 0); err != nil {
+		return err
+	}
+
+	var links []client.LinkSummary
+	var err error
+	switch {
+	case *tag != "" && *collection != "", (*tag != "" || *collection != "") && *prefix != "":
+		return fmt.Errorf("only one of -prefix, -tag and -collection can be given")
+	case *tag != "":
+		var group client.GroupLinks
+		group, err = c.client.TagLinks(ctx, *tag, *limit)
+		links = group.Links
+	case *collection != "":
+		var group client.GroupLinks
+		group, err = c.client.CollectionLinks(ctx, *collection, *limit)
+		links = group.Links
+	default:
+		links, err = c.client.Links(ctx, *prefix, *limit)
+	}
+	if err != nil {
+		return err
+	}
+	return c.printLinks(links)
+}
+
+func searchCommand(ctx context.Context, c *cli, flags *flag.FlagSet, args []string) error {
+	limit := flags.Int("limit", 0, fmt.Sprintf("most links listed, up to %d (default the service's)", maxLinks))
+	if err := parseArgs(flags, args, 1, -1); err != nil {
+		return err
+	}
+	// like the service's search, "team infra" means team/infra
+	words := strings.Fields(strings.ReplaceAll(strings.Join(flags.Args(), " "), "/", " "))
+	links, err := c.client.Links(ctx, strings.Join(words, "/"), *limit)
+	if err != nil {
+		return err
+	}
+	return c.printLinks(links)
+}
+
+func (c *cli) printLinks(links []client.LinkSummary) error {
+	if links == nil {
+		links = []client.LinkSummary{}
+	}
+	return c.out.print(links, func(w io.Writer) {
+		row(w, "NAME", "URL")
+		for _, link := range links {
+			u := link.Url
+			// the service doesn't list where protected links lead
+			if link.Protected {
+				u = strings.TrimSpace(u + " (protected)")
+			}
+			row(w, link.Abbreviation, u)
+		}
+	})
+}
+
+// exportedLink is a link as exported, with what organizes it and its hits
+type exportedLink struct {
+	Abbreviation string          `json:"abbreviation"`
+	Url          string          `json:"url"`
+	Protected    bool            `json:"protected,omitempty"`
+	Tags         []string        `json:"tags,omitempty"`
+	Collection   string          `json:"collection,omitempty"`
+	Hits         int             `json:"hits"`
+	LastAccess   time.Time       `json:"last_access"`
+	Options      *client.Options `json:"options,omitempty"`
+}
+
+var exportColumns = []string{"abbreviation", "url", "protected", "tags", "collection", "hits", "last_access"}
+
+func exportCommand(ctx context.Context, c *cli, flags *flag.FlagSet, args []string) error {
+	prefix := flags.String("prefix", "", "only links whose names start with prefix")
+	format := flags.String("format", "json", "json, which has the redirect options too, or csv")
+	limit := flags.Int("limit", maxLinks, fmt.Sprintf("most links exported, up to %d", maxLinks))
+	if err := parseArgs(flags, args, 0, 0); err != nil {
+		return err
+	}
+	if *format != "json" && *format != "csv" {
+		return fmt.Errorf("unknown format %q, want json or csv", *format)
+	}
+
+	links, err := c.client.Links(ctx, *prefix, *limit)
+	if err != nil {
+		return err
+	}
+	exported := make([]exportedLink, 0, len(links))
+	for _, link := range links {
+		stats, err := c.client.Stats(ctx, link.Abbreviation, nil)
+		if err != nil {
+			return fmt.Errorf("error exporting %s: %v", link.Abbreviation, err)
+		}
+		exported = append(exported, exportedLink{
+			Abbreviation: link.Abbreviation,
+			Url:          link.Url,
+			Protected:    link.Protected,
+			Tags:         stats.Tags,
+			Collection:   stats.Collection,
+			Hits:         stats.Hits,
+			LastAccess:   stats.LastAccess,
+			Options:      stats.Options,
+		})
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(c.out.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(exported)
+	}
+	w := csv.NewWriter(c.out.w)
+	_ = w.Write(exportColumns)
+	for _, link := range exported {
+		lastAccess := ""
+		if !link.LastAccess.IsZero() {
+			lastAccess = link.LastAccess.UTC().Format(time.RFC3339)
+		}
+		_ = w.Write([]string{link.Abbreviation, link.Url, strconv.FormatBool(link.Protected),
+			strings.Join(link.Tags, " "), link.Collection, strconv.Itoa(link.Hits), lastAccess})
+	}
+	w.Flush()
+	return w.Error()
+}
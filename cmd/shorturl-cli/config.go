@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/ericfialkowski/shorturl/client"
+	"github.com/ericfialkowski/shorturl/env"
+)
+
+const (
+	defaultServer = "http://localhost:8800"
+	outputTable   = "table"
+	outputJson    = "json"
+)
+
+// config is where the service is and how to reach it, as kept in the config file:
+//
+//	{"server": "https://sho.rt", "token": "..."}
+type config struct {
+	Server   string `json:"server,omitempty"`
+	Host     string `json:"host,omitempty"`
+	Token    string `json:"token,omitempty"` // sent as a bearer token
+	User     string `json:"user,omitempty"`  // sent with Password as basic auth, when there's no token
+	Password string `json:"password,omitempty"`
+	Output   string `json:"output,omitempty"`
+}
+
+// defaultConfigPath returns where the config file is looked for when no other is given
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "shorturl-cli.json"
+	}
+	return filepath.Join(dir, "shorturl", "cli.json")
+}
+
+// loadConfig reads the config file at path, or the one named by the environment or the default one when path is
+// empty, and then overrides it with the environment. Only a default file can be missing.
+func loadConfig(path string) (config, error) {
+	cfg := config{Server: defaultServer, Output: outputTable}
+	explicit := path != ""
+	if !explicit {
+		path = env.StringOrDefault("shorturl_config", "")
+		explicit = path != ""
+	}
+	if !explicit {
+		path = defaultConfigPath()
+	}
+
+	b, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && !explicit:
+	case err != nil:
+		return cfg, fmt.Errorf("error reading config: %v", err)
+	default:
+		var file config
+		if err := json.Unmarshal(b, &file); err != nil {
+			return cfg, fmt.Errorf("error reading config %s: %v", path, err)
+		}
+		cfg.override(file)
+	}
+
+	cfg.override(config{
+		Server:   env.StringOrDefault("shorturl_server", ""),
+		Host:     env.StringOrDefault("shorturl_host", ""),
+		Token:    env.StringOrDefault("shorturl_token", ""),
+		User:     env.StringOrDefault("shorturl_user", ""),
+		Password: env.StringOrDefault("shorturl_password", ""),
+		Output:   env.StringOrDefault("shorturl_output", ""),
+	})
+	return cfg, nil
+}
+
+// override replaces the settings of c that o has
+func (c *config) override(o config) {
+	for _, s := range []struct{ to, from *string }{
+		{&c.Server, &o.Server}, {&c.Host, &o.Host}, {&c.Token, &o.Token},
+		{&c.User, &o.User}, {&c.Password, &o.Password}, {&c.Output, &o.Output},
+	} {
+		if *s.from != "" {
+			*s.to = *s.from
+		}
+	}
+}
+
+func (c *config) newClient() (*client.Client, error) {
+	var options []client.Option
+	if c.Host != "" {
+		options = append(options, client.WithHost(c.Host))
+	}
+	switch {
+	case c.Token != "":
+		options = append(options, client.WithHeader("Authorization", "Bearer "+c.Token))
+	case c.User != "":
+		basic := base64.StdEncoding.EncodeToString([]byte(c.User + ":" + c.Password))
+		options = append(options, client.WithHeader("Authorization", "Basic "+basic))
+	}
+	return client.New(c.Server, options...)
+}
+
+// shareBase returns where the short links are shared from, the tenant's domain when there is one
+func (c *config) shareBase() string {
+	if c.Host == "" {
+		return c.Server
+	}
+	u, err := url.Parse(c.Server)
+	if err != nil {
+		return c.Server
+	}
+	return u.Scheme + "://" + c.Host
+}
@@ -0,0 +1,98 @@
+// Command shorturl-cli manages the links of a shorturl service from a terminal, using the client package. The
+// server and credentials come from flags, then the environment, then a JSON config file.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/ericfialkowski/shorturl/client"
+)
+
+// cli is what the commands share
+type cli struct {
+	client *client.Client
+	out    printer
+	base   string // where short links are shared from, like https://sho.rt
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "shorturl-cli: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// run runs the command in args, writing what it prints to stdout and usage to stderr
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("shorturl-cli", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configPath := flags.String("config", "", "JSON config file (default $shorturl_config or "+defaultConfigPath()+")")
+	server := flags.String("server", "", "base url of the service (default $shorturl_server or http://localhost:8800)")
+	host := flags.String("host", "", "Host header picking the tenant of the links ($shorturl_host)")
+	output := flags.String("o", "", "output: table or json ($shorturl_output)")
+	flags.Usage = func() { usage(stderr, flags) }
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return flag.ErrHelp
+	}
+	name := flags.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		flags.Usage()
+		return fmt.Errorf("unknown command %q", name)
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	cfg.override(config{Server: *server, Host: *host, Output: *output})
+	if cfg.Output != outputTable && cfg.Output != outputJson {
+		return fmt.Errorf("unknown output %q, want %s or %s", cfg.Output, outputTable, outputJson)
+	}
+	c, err := cfg.newClient()
+	if err != nil {
+		return err
+	}
+
+	sub := flag.NewFlagSet(name, flag.ContinueOnError)
+	sub.SetOutput(stderr)
+	sub.Usage = func() {
+		_, _ = fmt.Fprintf(stderr, "usage: shorturl-cli %s %s\n\n%s\n", name, cmd.args, cmd.summary)
+		sub.PrintDefaults()
+	}
+	return cmd.run(ctx, &cli{client: c, out: printer{w: stdout, json: cfg.Output == outputJson}, base: cfg.shareBase()}, sub, flags.Args()[1:])
+}
+
+func usage(w io.Writer, flags *flag.FlagSet) {
+	_, _ = fmt.Fprintf(w, "usage: shorturl-cli [flags] <command> [command flags] [args]\n\ncommands:\n")
+	for _, name := range commandOrder {
+		_, _ = fmt.Fprintf(w, "  %-8s %s\n", name, commands[name].summary)
+	}
+	_, _ = fmt.Fprintf(w, "\nflags:\n")
+	flags.PrintDefaults()
+	_, _ = fmt.Fprintf(w, "\ncredentials for a proxy in front of the service come from $shorturl_token, or\n"+
+		"$shorturl_user and $shorturl_password, or the config file\n")
+}
+
+// shortUrl returns the url of the link at path to share
+func (c *cli) shortUrl(path string) string {
+	return strings.TrimSuffix(c.base, "/") + path
+}
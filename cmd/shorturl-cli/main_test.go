@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ericfialkowski/shorturl/client"
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/ericfialkowski/shorturl/handlers"
+	"github.com/ericfialkowski/shorturl/status"
+	"github.com/labstack/echo/v5"
+)
+
+// testServer runs the service's handlers on an in-memory database, remembering the Authorization header of the
+// last request
+func testServer(t *testing.T) (*httptest.Server, *string) {
+	t.Helper()
+	t.Setenv("logrequests", "false")
+	db := dao.CreateMemoryDB()
+	s := status.NewStatus()
+	s.Ok("test")
+	h := handlers.CreateHandlers(db, s, "test-id", nil)
+	e := echo.New()
+	h.SetUp(e)
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		e.ServeHTTP(w, r)
+	}))
+	t.Cleanup(func() {
+		srv.Close()
+		db.Cleanup()
+	})
+	return srv, &auth
+}
+
+// testConfig points the config at a file of the test with cfg in it, and clears the environment
+func testConfig(t *testing.T, cfg config) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "cli.json")
+	b, _ := json.Marshal(cfg)
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("shorturl_config", path)
+	for _, key := range []string{"shorturl_server", "shorturl_host", "shorturl_token", "shorturl_user", "shorturl_password", "shorturl_output"} {
+		t.Setenv(key, "")
+	}
+}
+
+func runCli(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var stdout bytes.Buffer
+	err := run(context.Background(), args, &stdout, io.Discard)
+	return stdout.String(), err
+}
+
+func TestLoadConfig(t *testing.T) {
+	testConfig(t, config{Server: "https://file.example", Token: "file-token", Output: outputJson})
+
+	cfg, err := loadConfig("")
+	if err != nil || cfg.Server != "https://file.example" || cfg.Token != "file-token" || cfg.Output != outputJson {
+		t.Errorf("loadConfig() = %+v, %v, want the file's settings", cfg, err)
+	}
+	t.Setenv("shorturl_server", "https://env.example")
+	if cfg, _ = loadConfig(""); cfg.Server != "https://env.example" || cfg.Token != "file-token" {
+		t.Errorf("loadConfig() = %+v, want the environment over the file", cfg)
+	}
+
+	if _, err := loadConfig(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("loadConfig() of a missing file = nil error, want one")
+	}
+	t.Setenv("shorturl_config", "")
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	if cfg, err = loadConfig(""); err != nil || cfg.Server != "https://env.example" || cfg.Output != outputTable {
+		t.Errorf("loadConfig() without a file = %+v, %v, want the defaults", cfg, err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	srv, auth := testServer(t)
+	testConfig(t, config{Server: srv.URL, User: "me", Password: "secret"})
+
+	out, err := runCli(t, "create", "-name", "team/wiki", "-tag", "docs,team", "-collection", "launch", "https://wiki.com")
+	if err != nil || !strings.Contains(out, srv.URL+"/team/wiki") || !strings.Contains(out, "docs, team") || !strings.Contains(out, "launch") {
+		t.Errorf("create = %q, %v", out, err)
+	}
+	if *auth != "Basic bWU6c2VjcmV0" {
+		t.Errorf("Authorization = %q, want the config's basic auth", *auth)
+	}
+	if out, err = runCli(t, "-host", "sho.rt", "-o", "json", "create", "https://example.com"); err != nil {
+		t.Fatalf("create error = %v", err)
+	}
+	var created createdLink
+	if err := json.Unmarshal([]byte(out), &created); err != nil || created.Abv == "" || created.ShortUrl != "http://sho.rt/"+created.Abv {
+		t.Errorf("create -o json = %q, %v", out, err)
+	}
+	t.Setenv("shorturl_token", "env-token")
+	if _, err := runCli(t, "create", "-password", "correct horse", "https://secret.com"); err != nil {
+		t.Errorf("create -password error = %v", err)
+	}
+	if *auth != "Bearer env-token" {
+		t.Errorf("Authorization = %q, want the environment's token", *auth)
+	}
+
+	if out, err = runCli(t, "expand", "team/wiki"); err != nil || out != "https://wiki.com\n" {
+		t.Errorf("expand = %q, %v", out, err)
+	}
+	// the cli's hits count as a bot's, so a browser's is made for the stats
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/team/wiki", nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) Firefox/140.0")
+	if resp, err := (&http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}).Do(req); err == nil {
+		_ = resp.Body.Close()
+	}
+	if out, err = runCli(t, "get", "team/wiki"); err != nil || !strings.Contains(out, "https://wiki.com") || !strings.Contains(out, "hits         1") {
+		t.Errorf("get = %q, %v", out, err)
+	}
+	if out, err = runCli(t, "stats", "-days", "7", "team/wiki"); err != nil || !strings.Contains(out, "last 7 days  ▁▁▁▁▁▁█ 1") {
+		t.Errorf("stats = %q, %v", out, err)
+	}
+	var stats client.Stats
+	if out, err = runCli(t, "-o", "json", "stats", "team/wiki"); err != nil || json.Unmarshal([]byte(out), &stats) != nil || stats.Hits != 1 {
+		t.Errorf("stats -o json = %q, %v", out, err)
+	}
+
+	if out, err = runCli(t, "list"); err != nil || strings.Count(out, "\n") != 4 || !strings.Contains(out, "(protected)") || strings.Contains(out, "secret.com") {
+		t.Errorf("list = %q, %v", out, err)
+	}
+	var links []client.LinkSummary
+	if out, err = runCli(t, "-o", "json", "list", "-tag", "docs"); err != nil || json.Unmarshal([]byte(out), &links) != nil || len(links) != 1 {
+		t.Errorf("list -tag = %q, %v", out, err)
+	}
+	if out, err = runCli(t, "-o", "json", "search", "nothing"); err != nil || strings.TrimSpace(out) != "[]" {
+		t.Errorf("search for nothing = %q, %v", out, err)
+	}
+	if out, err = runCli(t, "search", "team", "wi"); err != nil || !strings.Contains(out, "team/wiki") {
+		t.Errorf("search = %q, %v", out, err)
+	}
+	if _, err = runCli(t, "list", "-tag", "docs", "-prefix", "team"); err == nil {
+		t.Error("list with a tag and a prefix = nil error, want one")
+	}
+
+	if out, err = runCli(t, "export", "-format", "csv", "-prefix", "team"); err != nil {
+		t.Fatalf("export error = %v", err)
+	}
+	records, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	if err != nil || len(records) != 2 || records[1][0] != "team/wiki" || records[1][3] != "docs team" || records[1][5] != "1" {
+		t.Errorf("export -format csv = %q, %v", out, err)
+	}
+	var exported []exportedLink
+	if out, err = runCli(t, "export"); err != nil || json.Unmarshal([]byte(out), &exported) != nil || len(exported) != 3 {
+		t.Errorf("export = %q, %v", out, err)
+	}
+
+	if out, err = runCli(t, "delete", "team/wiki"); err != nil || !strings.Contains(out, "team/wiki") {
+		t.Errorf("delete = %q, %v", out, err)
+	}
+	if _, err = runCli(t, "get", "team/wiki"); !client.IsNotFound(err) {
+		t.Errorf("get of a deleted link error = %v, want not found", err)
+	}
+
+	if out, err = runCli(t, "create", "-name", "launch", "-expires", "24h", "https://launch.com"); err != nil || !strings.Contains(out, "expires") {
+		t.Errorf("create -expires = %q, %v", out, err)
+	}
+	if out, err = runCli(t, "get", "launch"); err != nil || !strings.Contains(out, "expires") {
+		t.Errorf("get of an expiring link = %q, %v", out, err)
+	}
+	if _, err = runCli(t, "create", "-expires", "soon", "https://soon.com"); err == nil {
+		t.Errorf("create -expires soon error = nil, want an invalid expiry")
+	}
+
+	for _, args := range [][]string{{}, {"get"}, {"expand", "a", "b"}} {
+		if _, err := runCli(t, args...); !errors.Is(err, flag.ErrHelp) {
+			t.Errorf("run(%q) error = %v, want usage", args, err)
+		}
+	}
+	if _, err := runCli(t, "unknown"); err == nil {
+		t.Error("run(unknown) = nil error, want one")
+	}
+	if _, err := runCli(t, "-o", "yaml", "list"); err == nil {
+		t.Error("run(-o yaml) = nil error, want one")
+	}
+}
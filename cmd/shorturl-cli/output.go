@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// sparks are the bars of a sparkline, from lowest to highest
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// printer writes what a command returns as aligned columns, or as the JSON the service answered with
+type printer struct {
+	w    io.Writer
+	json bool
+}
+
+// print writes v as indented JSON, or calls table to write its rows, tab separated, as aligned columns
+func (p printer) print(v any, table func(w io.Writer)) error {
+	if p.json {
+		enc := json.NewEncoder(p.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	table(tw)
+	return tw.Flush()
+}
+
+// row writes cells as a row of a table
+func row(w io.Writer, cells ...any) {
+	s := make([]string, len(cells))
+	for i, cell := range cells {
+		s[i] = fmt.Sprint(cell)
+	}
+	_, _ = fmt.Fprintln(w, strings.Join(s, "\t"))
+}
+
+// sparkline draws values as bars scaled to the largest of them. Any hits at all get more than the lowest bar.
+func sparkline(values []int) string {
+	if len(values) == 0 {
+		return ""
+	}
+	top := slices.Max(values)
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if v > 0 && top > 0 {
+			i = max(1, v*(len(sparks)-1)/top)
+		}
+		b.WriteRune(sparks[i])
+	}
+	return b.String()
+}
+
+// lastDays returns the hits of daily, keyed by UTC date, on each of the days ending with the one today is in
+func lastDays(daily map[string]int, days int, today time.Time) []int {
+	hits := make([]int, days)
+	for i := range hits {
+		hits[i] = daily[today.UTC().AddDate(0, 0, i-days+1).Format(time.DateOnly)]
+	}
+	return hits
+}
+
+// top returns the up to n keys of counts with the most, as "key count" pairs
+func top(counts map[string]int, n int) string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		if counts[a] != counts[b] {
+			return counts[b] - counts[a]
+		}
+		return strings.Compare(a, b)
+	})
+	pairs := make([]string, 0, n)
+	for _, k := range keys[:min(n, len(keys))] {
+		pairs = append(pairs, fmt.Sprintf("%s %d", k, counts[k]))
+	}
+	return strings.Join(pairs, ", ")
+}
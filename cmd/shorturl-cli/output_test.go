@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestSparkline(t *testing.T) {
+	for _, test := range []struct {
+		values []int
+		want   string
+	}{
+		{nil, ""},
+		{[]int{0, 0, 0}, "▁▁▁"},
+		{[]int{0, 1, 2, 3, 4, 5, 6, 7}, "▁▂▃▄▅▆▇█"},
+		{[]int{1, 1000}, "▂█"},
+		{[]int{5}, "█"},
+	} {
+		if got := sparkline(test.values); got != test.want {
+			t.Errorf("sparkline(%v) = %q, want %q", test.values, got, test.want)
+		}
+	}
+}
+
+func TestLastDays(t *testing.T) {
+	today := time.Date(2026, 3, 1, 23, 0, 0, 0, time.UTC)
+	daily := map[string]int{"2026-02-27": 3, "2026-03-01": 5, "2026-02-01": 9}
+	got := lastDays(daily, 4, today)
+	want := []int{0, 3, 0, 5}
+	if len(got) != len(want) {
+		t.Fatalf("lastDays() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("lastDays() = %v, want %v", got, want)
+			break
+		}
+	}
+}
+
+func TestTop(t *testing.T) {
+	counts := map[string]int{"us": 3, "de": 5, "fr": 3, "gb": 1}
+	if got := top(counts, 3); got != "de 5, fr 3, us 3" {
+		t.Errorf("top() = %q", got)
+	}
+	if got := top(nil, 3); got != "" {
+		t.Errorf("top(nil) = %q", got)
+	}
+}
+
+func TestPrinter(t *testing.T) {
+	var b bytes.Buffer
+	table := func(w io.Writer) {
+		row(w, "name", "url")
+		row(w, "team/wiki", "https://wiki.com")
+	}
+	if err := (printer{w: &b}).print(nil, table); err != nil || b.String() != "name       url\nteam/wiki  https://wiki.com\n" {
+		t.Errorf("print() as a table = %q, %v", b.String(), err)
+	}
+	b.Reset()
+	if err := (printer{w: &b, json: true}).print(map[string]int{"hits": 1}, table); err != nil || b.String() != "{\n  \"hits\": 1\n}\n" {
+		t.Errorf("print() as json = %q, %v", b.String(), err)
+	}
+}
@@ -5,44 +5,66 @@ import (
 	"github.com/ericfialkowski/shorturl/env"
 	"github.com/ericfialkowski/shorturl/rando"
 	"log"
+	"sync/atomic"
 )
 
-var keySize = env.IntOrDefault("startingkeysize", 1)
+// Abbreviator makes random abbreviations from an alphabet, growing their length when short ones keep clashing
+type Abbreviator struct {
+	alphabet string
+	keySize  atomic.Int64
+}
+
+var defaultAbbreviator = NewAbbreviator(rando.Chars, env.IntOrDefault("startingkeysize", 1))
+
+// NewAbbreviator makes an Abbreviator of keySize characters from alphabet
+func NewAbbreviator(alphabet string, keySize int) *Abbreviator {
+	a := &Abbreviator{alphabet: alphabet}
+	a.keySize.Store(int64(keySize))
+	return a
+}
+
+// grow makes the abbreviations one longer, for more randomness
+func (a *Abbreviator) grow() {
+	log.Printf("Growing keySize to be %d", a.keySize.Add(1))
+}
 
-func randString() string {
+func (a *Abbreviator) randString() string {
 	tries := 0
 	for {
-		s := rando.RandStrn(keySize)
+		s := rando.RandStrnFrom(a.alphabet, int(a.keySize.Load()))
 		if AcceptableWord(s) {
 			return s
 		}
 		// if we haven't found a good word in a certain number of tries, we need to grow the keysize for more randomness
 		if tries = tries + 1; tries > env.IntOrDefault("keygrowretries", 10) {
 			tries = 0
-			keySize = keySize + 1
-			log.Printf("Growing keySize to be %d", keySize)
+			a.grow()
 		}
 	}
 }
 
-func CreateAbbreviation(url string, dao ShortUrlDao) (string, error) {
+// Create returns an abbreviation for url that isn't taken by another url in dao
+func (a *Abbreviator) Create(url string, dao ShortUrlDao) (string, error) {
 	tries := 0
-	abv := randString()
+	abv := a.randString()
 	u, _ := dao.GetUrl(abv)
 	for len(u) != 0 && url != u {
 		// if we haven't found a good word in a certain number of tries, we need to grow the keysize for more randomness
 		if tries = tries + 1; tries > env.IntOrDefault("keygrowretries", 10) {
 			tries = 0
-			keySize = keySize + 1
-			log.Printf("Growing keySize to be %d", keySize)
+			a.grow()
 		}
 		_, err := dao.GetUrl(abv)
 		if err != nil {
 			return "", fmt.Errorf("error checking abbreviation %v", err)
 		}
-		abv = randString()
+		abv = a.randString()
 		u, _ = dao.GetUrl(abv)
 	}
 
 	return abv, nil
 }
+
+func CreateAbbreviation(url string, dao ShortUrlDao) (string, error) {
+	return defaultAbbreviator.Create(url, dao)
+}
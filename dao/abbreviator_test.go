@@ -1,6 +1,7 @@
 package dao
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -95,3 +96,17 @@ func BenchmarkCreateAbbreviation(b *testing.B) {
 		_, _ = CreateAbbreviation("https://benchmark.com/"+string(rune(i)), dao)
 	}
 }
+
+func TestAbbreviator_Create(t *testing.T) {
+	dao := CreateMemoryDB()
+	defer dao.Cleanup()
+
+	a := NewAbbreviator("XYZ", 6)
+	abv, err := a.Create("https://example.com", dao)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if len(abv) != 6 || strings.Trim(abv, "XYZ") != "" {
+		t.Errorf("Create() = %q, want 6 of X, Y and Z", abv)
+	}
+}
@@ -0,0 +1,50 @@
+package dao
+
+import (
+	"fmt"
+	"time"
+)
+
+// LinkCount is the number of hits a link had in a window, and in the window before it when comparing trends
+type LinkCount struct {
+	Domain       string `json:"domain,omitempty"`
+	Abbreviation string `json:"abbreviation"`
+	Url          string `json:"url"`
+	Hits         int    `json:"hits"`
+	PriorHits    int    `json:"prior_hits"`
+}
+
+// GlobalStats summarizes all the links of a domain over a window of UTC dates. Only hits from people are counted.
+type GlobalStats struct {
+	HitsPerDay        map[string]int // UTC date -> hits on every link
+	CreatedPerDay     map[string]int // UTC date -> links created
+	TopLinks          []LinkCount    // most hits in the window
+	Trending          []LinkCount    // biggest increase over the prior window of the same length
+	NeverClicked      []LinkCount    // links that have never had a hit, oldest first where known
+	NeverClickedTotal int
+}
+
+// PriorWindow returns the window of the same number of days immediately before the inclusive UTC dates from and to
+func PriorWindow(from, to string) (string, string, error) {
+	start, err := time.Parse(dateLayout, from)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid from date %q: %v", from, err)
+	}
+	end, err := time.Parse(dateLayout, to)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid to date %q: %v", to, err)
+	}
+	if end.Before(start) {
+		return "", "", fmt.Errorf("to date %s is before from date %s", to, from)
+	}
+
+	days := int(end.Sub(start).Hours()/24) + 1
+	return start.AddDate(0, 0, -days).Format(dateLayout), start.AddDate(0, 0, -1).Format(dateLayout), nil
+}
+
+// windowTimes returns the instants bounding the inclusive UTC dates from and to, for comparing timestamps
+func windowTimes(from, to string) (time.Time, time.Time) {
+	start, _ := time.Parse(dateLayout, from)
+	end, _ := time.Parse(dateLayout, to)
+	return start, end.AddDate(0, 0, 1)
+}
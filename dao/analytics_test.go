@@ -0,0 +1,29 @@
+package dao
+
+import "testing"
+
+func TestPriorWindow(t *testing.T) {
+	tests := []struct {
+		from, to         string
+		wantFrom, wantTo string
+		wantErr          bool
+	}{
+		{"2024-03-10", "2024-03-10", "2024-03-09", "2024-03-09", false},
+		{"2024-03-01", "2024-03-07", "2024-02-23", "2024-02-29", false},
+		{"2024-01-01", "2024-01-30", "2023-12-02", "2023-12-31", false},
+		{"2024-03-07", "2024-03-01", "", "", true},
+		{"yesterday", "2024-03-01", "", "", true},
+		{"2024-03-01", "", "", "", true},
+	}
+
+	for _, tt := range tests {
+		from, to, err := PriorWindow(tt.from, tt.to)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("PriorWindow(%s, %s) error = %v, wantErr %v", tt.from, tt.to, err, tt.wantErr)
+			continue
+		}
+		if from != tt.wantFrom || to != tt.wantTo {
+			t.Errorf("PriorWindow(%s, %s) = %s, %s, want %s, %s", tt.from, tt.to, from, to, tt.wantFrom, tt.wantTo)
+		}
+	}
+}
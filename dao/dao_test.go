@@ -1,8 +1,16 @@
 package dao
 
 import (
+	"database/sql"
+	"errors"
+	"maps"
+	"path/filepath"
+	"reflect"
+	"slices"
 	"testing"
 	"time"
+
+	"github.com/ericfialkowski/shorturl/rules"
 )
 
 // DAOTestSuite runs the same tests against any ShortUrlDao implementation
@@ -144,6 +152,736 @@ func runDAOTests(t *testing.T, name string, createDAO func() ShortUrlDao) {
 			}
 		})
 
+		t.Run("GetUrlWithHit records country, region, referrer and variant", func(t *testing.T) {
+			dao := createDAO()
+			defer dao.Cleanup()
+
+			_ = dao.Save("geo1", "https://geo.com")
+
+			hits := []Hit{
+				{Time: time.Now(), Country: "US", Region: "US-CA", Referrer: "news.ycombinator.com", Variant: "a"},
+				{Time: time.Now(), Country: "US", Region: "US-WA", Referrer: "www.reddit.com", Variant: "b"},
+				{Time: time.Now(), Country: "US", Region: "US-CA", Referrer: "news.ycombinator.com", Variant: "a"},
+				{Time: time.Now(), Country: "SE"},
+				{Time: time.Now()},
+			}
+			for _, hit := range hits {
+				url, err := dao.GetUrlWithHit("geo1", hit)
+				if err != nil {
+					t.Fatalf("GetUrlWithHit() error = %v", err)
+				}
+				if url != "https://geo.com" {
+					t.Errorf("GetUrlWithHit() = %v, want %v", url, "https://geo.com")
+				}
+			}
+
+			// Give async updates time to complete
+			time.Sleep(100 * time.Millisecond)
+
+			stats, err := dao.GetStats("geo1")
+			if err != nil {
+				t.Fatalf("GetStats() error = %v", err)
+			}
+			if stats.Hits != 5 {
+				t.Errorf("GetStats().Hits = %v, want 5", stats.Hits)
+			}
+			wantCountries := map[string]int{"US": 3, "SE": 1}
+			if !maps.Equal(stats.CountryHits, wantCountries) {
+				t.Errorf("GetStats().CountryHits = %v, want %v", stats.CountryHits, wantCountries)
+			}
+			wantRegions := map[string]int{"US-CA": 2, "US-WA": 1}
+			if !maps.Equal(stats.RegionHits, wantRegions) {
+				t.Errorf("GetStats().RegionHits = %v, want %v", stats.RegionHits, wantRegions)
+			}
+			wantReferrers := map[string]int{"news.ycombinator.com": 2, "www.reddit.com": 1}
+			if !maps.Equal(stats.ReferrerHits, wantReferrers) {
+				t.Errorf("GetStats().ReferrerHits = %v, want %v", stats.ReferrerHits, wantReferrers)
+			}
+			wantVariants := map[string]int{"a": 2, "b": 1}
+			if !maps.Equal(stats.VariantHits, wantVariants) {
+				t.Errorf("GetStats().VariantHits = %v, want %v", stats.VariantHits, wantVariants)
+			}
+		})
+
+		t.Run("GetHourlyHits returns UTC buckets in range", func(t *testing.T) {
+			dao := createDAO()
+			defer dao.Cleanup()
+
+			_ = dao.Save("hour1", "https://hourly.com")
+
+			base := time.Date(2024, 3, 10, 22, 15, 0, 0, time.UTC)
+			tokyo, _ := time.LoadLocation("Asia/Tokyo")
+			hits := []time.Time{
+				base,
+				base.Add(10 * time.Minute),
+				base.Add(time.Hour).In(tokyo), // stored in UTC regardless of the hit's zone
+				base.Add(3 * time.Hour),
+			}
+			for _, ht := range hits {
+				if _, err := dao.GetUrlWithHit("hour1", Hit{Time: ht}); err != nil {
+					t.Fatalf("GetUrlWithHit() error = %v", err)
+				}
+			}
+
+			// Give async updates time to complete
+			time.Sleep(100 * time.Millisecond)
+
+			got, err := dao.GetHourlyHits("hour1", base.Truncate(time.Hour), base.Add(3*time.Hour).Truncate(time.Hour))
+			if err != nil {
+				t.Fatalf("GetHourlyHits() error = %v", err)
+			}
+			want := map[time.Time]int{
+				time.Date(2024, 3, 10, 22, 0, 0, 0, time.UTC): 2,
+				time.Date(2024, 3, 10, 23, 0, 0, 0, time.UTC): 1,
+			}
+			if !maps.Equal(got, want) {
+				t.Errorf("GetHourlyHits() = %v, want %v", got, want)
+			}
+
+			stats, _ := dao.GetStats("hour1")
+			wantDaily := map[string]int{"2024-03-10": 3, "2024-03-11": 1}
+			if !maps.Equal(stats.DailyHits, wantDaily) {
+				t.Errorf("GetStats().DailyHits = %v, want %v", stats.DailyHits, wantDaily)
+			}
+		})
+
+		t.Run("CountUniques counts distinct visitors per bucket of days", func(t *testing.T) {
+			dao := createDAO()
+			defer dao.Cleanup()
+
+			_ = dao.Save("uv1", "https://uniques.com")
+
+			day1 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+			day2 := day1.AddDate(0, 0, 1)
+			hits := []Hit{
+				{Time: day1, Visitor: "alice"},
+				{Time: day1, Visitor: "alice"},
+				{Time: day1, Visitor: "bob"},
+				{Time: day2, Visitor: "alice"},
+				{Time: day2, Visitor: "carol"},
+				{Time: day2}, // unidentified hits aren't counted as visitors
+			}
+			for _, hit := range hits {
+				if _, err := dao.GetUrlWithHit("uv1", hit); err != nil {
+					t.Fatalf("GetUrlWithHit() error = %v", err)
+				}
+			}
+
+			// Give async updates time to complete
+			time.Sleep(100 * time.Millisecond)
+
+			got, err := dao.CountUniques("uv1", [][]string{{"2024-05-01"}, {"2024-05-02"}, {"2024-05-01", "2024-05-02"}, {"2024-05-03"}, {}})
+			if err != nil {
+				t.Fatalf("CountUniques() error = %v", err)
+			}
+			want := []int64{2, 2, 3, 0, 0}
+			if !slices.Equal(got, want) {
+				t.Errorf("CountUniques() = %v, want %v", got, want)
+			}
+
+			stats, _ := dao.GetStats("uv1")
+			if stats.Uniques != 3 {
+				t.Errorf("GetStats().Uniques = %v, want 3", stats.Uniques)
+			}
+			wantDaily := map[string]int64{"2024-05-01": 2, "2024-05-02": 2}
+			if !maps.Equal(stats.DailyUniques, wantDaily) {
+				t.Errorf("GetStats().DailyUniques = %v, want %v", stats.DailyUniques, wantDaily)
+			}
+		})
+
+		t.Run("GetUrlWithHit counts bots separately", func(t *testing.T) {
+			dao := createDAO()
+			defer dao.Cleanup()
+
+			_ = dao.Save("bot1", "https://bots.com")
+
+			hits := []Hit{
+				{Time: time.Now(), Country: "US", Visitor: "alice"},
+				{Time: time.Now(), Country: "US", Visitor: "slack", Bot: "Slack"},
+				{Time: time.Now(), Country: "US", Visitor: "slack", Bot: "Slack"},
+				{Time: time.Now(), Visitor: "google", Bot: "Google"},
+			}
+			for _, hit := range hits {
+				url, err := dao.GetUrlWithHit("bot1", hit)
+				if err != nil {
+					t.Fatalf("GetUrlWithHit() error = %v", err)
+				}
+				if url != "https://bots.com" {
+					t.Errorf("GetUrlWithHit() = %v, want %v", url, "https://bots.com")
+				}
+			}
+
+			// Give async updates time to complete
+			time.Sleep(100 * time.Millisecond)
+
+			stats, err := dao.GetStats("bot1")
+			if err != nil {
+				t.Fatalf("GetStats() error = %v", err)
+			}
+			if stats.Hits != 1 || stats.BotHits != 3 {
+				t.Errorf("GetStats() = %d hits and %d bot hits, want 1 and 3", stats.Hits, stats.BotHits)
+			}
+			wantFamilies := map[string]int{"Slack": 2, "Google": 1}
+			if !maps.Equal(stats.BotFamilies, wantFamilies) {
+				t.Errorf("GetStats().BotFamilies = %v, want %v", stats.BotFamilies, wantFamilies)
+			}
+			if !maps.Equal(stats.CountryHits, map[string]int{"US": 1}) {
+				t.Errorf("GetStats().CountryHits = %v, want only the human hit", stats.CountryHits)
+			}
+			if stats.Uniques != 1 {
+				t.Errorf("GetStats().Uniques = %v, want 1", stats.Uniques)
+			}
+		})
+
+		t.Run("SetBlocked stops hits until unblocked", func(t *testing.T) {
+			dao := createDAO()
+			defer dao.Cleanup()
+
+			_ = dao.Save("blk1", "https://blocked.com")
+			if err := dao.SetBlocked("blk1", "malware"); err != nil {
+				t.Fatalf("SetBlocked() error = %v", err)
+			}
+
+			url, err := dao.GetUrlWithHit("blk1", NewHit())
+			var blocked *BlockedError
+			if !errors.As(err, &blocked) || blocked.Reason != "malware" {
+				t.Fatalf("GetUrlWithHit() error = %v, want it blocked for malware", err)
+			}
+			if url != "https://blocked.com" {
+				t.Errorf("GetUrlWithHit() = %v, want %v", url, "https://blocked.com")
+			}
+			if url, err := dao.GetUrl("blk1"); err != nil || url != "https://blocked.com" {
+				t.Errorf("GetUrl() = %v, %v, want the url without an error", url, err)
+			}
+
+			time.Sleep(100 * time.Millisecond)
+			stats, _ := dao.GetStats("blk1")
+			if stats.Blocked != "malware" || stats.Hits != 0 {
+				t.Errorf("GetStats() = blocked %q with %d hits, want malware and 0", stats.Blocked, stats.Hits)
+			}
+
+			if err := dao.SetBlocked("blk1", ""); err != nil {
+				t.Fatalf("SetBlocked() error = %v", err)
+			}
+			if _, err := dao.GetUrlWithHit("blk1", NewHit()); err != nil {
+				t.Errorf("GetUrlWithHit() after unblocking error = %v", err)
+			}
+			if err := dao.SetBlocked("missing", "malware"); err != nil {
+				t.Errorf("SetBlocked() of a missing link error = %v", err)
+			}
+		})
+
+		t.Run("SetHealth tracks which links to check and which are unhealthy", func(t *testing.T) {
+			dao := createDAO()
+			defer dao.Cleanup()
+
+			_ = dao.Save("ok1", "https://ok.com")
+			_ = dao.Save("gone1", "https://gone.com")
+			_ = dao.Save("new1", "https://new.com")
+			_ = dao.Save("blk2", "https://blocked.com")
+			_ = dao.SetBlocked("blk2", "malware")
+
+			now := time.Now().UTC().Truncate(time.Second)
+			_ = dao.SetHealth("ok1", Health{Status: 200, Checked: now.Add(-48 * time.Hour)})
+			gone := Health{Status: 404, Error: "404 Not Found", Redirects: []string{"https://gone.com/moved"}, Checked: now, Failures: 3, Dead: true}
+			if err := dao.SetHealth("gone1", gone); err != nil {
+				t.Fatalf("SetHealth() error = %v", err)
+			}
+
+			links, err := dao.GetLinksToCheck(now.Add(-24*time.Hour), 10)
+			if err != nil {
+				t.Fatalf("GetLinksToCheck() error = %v", err)
+			}
+			var abvs []string
+			for _, link := range links {
+				abvs = append(abvs, link.Abbreviation)
+			}
+			if !slices.Equal(abvs, []string{"new1", "ok1"}) {
+				t.Errorf("GetLinksToCheck() = %v, want the never checked link then the stale one", abvs)
+			}
+			if len(links) == 2 && (links[1].Url != "https://ok.com" || links[1].Health.Status != 200) {
+				t.Errorf("GetLinksToCheck()[1] = %+v, want ok1 with its last check", links[1])
+			}
+
+			unhealthy, err := dao.GetUnhealthy(10)
+			if err != nil {
+				t.Fatalf("GetUnhealthy() error = %v", err)
+			}
+			if len(unhealthy) != 1 || unhealthy[0].Abbreviation != "gone1" || !unhealthy[0].Health.Checked.Equal(now) ||
+				!slices.Equal(unhealthy[0].Health.Redirects, gone.Redirects) || !unhealthy[0].Health.Dead {
+				t.Errorf("GetUnhealthy() = %+v, want gone1 with %+v", unhealthy, gone)
+			}
+
+			stats, _ := dao.GetStats("gone1")
+			if stats.Health == nil || stats.Health.Status != 404 || stats.Health.Failures != 3 {
+				t.Errorf("GetStats().Health = %+v, want the last check", stats.Health)
+			}
+
+			_ = dao.SetHealth("gone1", Health{Status: 200, Checked: now})
+			if unhealthy, _ := dao.GetUnhealthy(10); len(unhealthy) != 0 {
+				t.Errorf("GetUnhealthy() after recovering = %+v, want none", unhealthy)
+			}
+		})
+
+		t.Run("SetMetadata is returned in stats and ages out", func(t *testing.T) {
+			dao := createDAO()
+			defer dao.Cleanup()
+
+			_ = dao.Save("meta1", "https://meta.com")
+			_ = dao.Save("meta2", "https://fresh.com")
+			_ = dao.Save("blk3", "https://blocked.com")
+			_ = dao.SetBlocked("blk3", "malware")
+
+			now := time.Now().UTC().Truncate(time.Second)
+			metadata := Metadata{
+				Title:       "Meta & Co",
+				Description: "All about meta",
+				Image:       "https://meta.com/card.png",
+				SiteName:    "Meta",
+				Favicon:     "https://meta.com/favicon.ico",
+				Fetched:     now.Add(-48 * time.Hour),
+			}
+			if err := dao.SetMetadata("meta1", metadata); err != nil {
+				t.Fatalf("SetMetadata() error = %v", err)
+			}
+			_ = dao.SetMetadata("meta2", Metadata{Error: "timeout", Fetched: now})
+
+			stats, _ := dao.GetStats("meta1")
+			if stats.Metadata == nil || *stats.Metadata != metadata {
+				t.Errorf("GetStats().Metadata = %+v, want %+v", stats.Metadata, metadata)
+			}
+
+			links, err := dao.GetStaleMetadata(now.Add(-24*time.Hour), 10)
+			if err != nil {
+				t.Fatalf("GetStaleMetadata() error = %v", err)
+			}
+			if len(links) != 1 || links[0].Abbreviation != "meta1" || links[0].Url != "https://meta.com" || links[0].Metadata != metadata {
+				t.Errorf("GetStaleMetadata() = %+v, want meta1 with its metadata", links)
+			}
+
+			_ = dao.Save("meta3", "https://new.com")
+			links, _ = dao.GetStaleMetadata(now.Add(time.Hour), 1)
+			if len(links) != 1 || links[0].Abbreviation != "meta3" || !links[0].Metadata.Fetched.IsZero() {
+				t.Errorf("GetStaleMetadata() = %+v, want the never fetched link first", links)
+			}
+		})
+
+		t.Run("SetPassword protects links", func(t *testing.T) {
+			dao := createDAO()
+			defer dao.Cleanup()
+
+			_ = dao.Save("pw1", "https://password.com")
+			_ = dao.Save("pw2", "https://password.com/open")
+			if err := dao.SetPassword("pw1", "hash-of-secret"); err != nil {
+				t.Fatalf("SetPassword() error = %v", err)
+			}
+
+			if got, err := dao.GetPassword("pw1"); err != nil || got != "hash-of-secret" {
+				t.Errorf("GetPassword() = %q, %v, want the hash", got, err)
+			}
+			if stats, _ := dao.GetStats("pw1"); !stats.Protected {
+				t.Error("GetStats().Protected = false, want true")
+			}
+			if stats, _ := dao.GetStats("pw2"); stats.Protected {
+				t.Error("GetStats().Protected of an open link = true, want false")
+			}
+			links, _ := dao.SearchLinks("pw", 10)
+			if len(links) != 2 || !links[0].Protected || links[1].Protected {
+				t.Errorf("SearchLinks() = %+v, want pw1 protected and pw2 not", links)
+			}
+
+			_ = dao.SetPassword("pw1", "")
+			if got, _ := dao.GetPassword("pw1"); got != "" {
+				t.Errorf("GetPassword() after removing = %q, want none", got)
+			}
+			if stats, _ := dao.GetStats("pw1"); stats.Protected {
+				t.Error("GetStats().Protected after removing = true, want false")
+			}
+			if got, err := dao.GetPassword("missing"); err != nil || got != "" {
+				t.Errorf("GetPassword(missing) = %q, %v, want none", got, err)
+			}
+		})
+
+		t.Run("SetOptions round trips and clears", func(t *testing.T) {
+			dao := createDAO()
+			defer dao.Cleanup()
+
+			_ = dao.Save("opt1", "https://options.com")
+			options := Options{
+				Passthrough: &Passthrough{Path: true, Query: true, Conflicts: ConflictAppend},
+				Rules: []rules.Rule{
+					{Platforms: []string{rules.PlatformIOS}, Url: "https://apps.apple.com/app/options"},
+					{Languages: []string{"fr"}, Days: []string{"sat", "sun"}, From: "22:00", To: "06:00", TimeZone: "Europe/Paris", Url: "https://options.com/fr"},
+				},
+			}
+			if err := dao.SetOptions("opt1", options); err != nil {
+				t.Fatalf("SetOptions() error = %v", err)
+			}
+
+			got, err := dao.GetOptions("opt1")
+			if err != nil {
+				t.Fatalf("GetOptions() error = %v", err)
+			}
+			if got.Passthrough == nil || *got.Passthrough != *options.Passthrough {
+				t.Errorf("GetOptions() = %+v, want %+v", got.Passthrough, options.Passthrough)
+			}
+			if !reflect.DeepEqual(got.Rules, options.Rules) {
+				t.Errorf("GetOptions().Rules = %+v, want %+v", got.Rules, options.Rules)
+			}
+			stats, _ := dao.GetStats("opt1")
+			if stats.Options == nil || stats.Options.Passthrough == nil || !stats.Options.Passthrough.Path {
+				t.Errorf("GetStats().Options = %+v, want the options", stats.Options)
+			}
+
+			_ = dao.SetOptions("opt1", Options{})
+			if got, _ := dao.GetOptions("opt1"); !got.IsZero() {
+				t.Errorf("GetOptions() after clearing = %+v, want none", got)
+			}
+			if stats, _ := dao.GetStats("opt1"); stats.Options != nil {
+				t.Errorf("GetStats().Options after clearing = %+v, want nil", stats.Options)
+			}
+			if got, err := dao.GetOptions("missing"); err != nil || !got.IsZero() {
+				t.Errorf("GetOptions(missing) = %+v, %v, want none", got, err)
+			}
+		})
+
+		t.Run("FindLink and SearchLinks match names", func(t *testing.T) {
+			dao := createDAO()
+			defer dao.Cleanup()
+
+			_ = dao.Save("team", "https://team.com")
+			_ = dao.Save("team/infra", "https://infra.com")
+			_ = dao.Save("team/infra/oncall", "https://oncall.com")
+			_ = dao.Save("team_x", "https://underscore.com")
+			_ = dao.Save("tea%", "https://percent.com")
+
+			link, err := dao.FindLink([]string{"team/infra/oncall/today", "team/infra/oncall", "team/infra", "team"})
+			if err != nil {
+				t.Fatalf("FindLink() error = %v", err)
+			}
+			if link.Abbreviation != "team/infra/oncall" || link.Url != "https://oncall.com" {
+				t.Errorf("FindLink() = %+v, want the longest name", link)
+			}
+			if link, _ := dao.FindLink([]string{"nope/x", "nope"}); link.Abbreviation != "" {
+				t.Errorf("FindLink() of missing names = %+v, want none", link)
+			}
+
+			links, err := dao.SearchLinks("team/", 10)
+			if err != nil {
+				t.Fatalf("SearchLinks() error = %v", err)
+			}
+			if len(links) != 2 || links[0].Abbreviation != "team/infra" || links[1].Url != "https://oncall.com" {
+				t.Errorf("SearchLinks(team/) = %+v, want team/infra and team/infra/oncall", links)
+			}
+			// LIKE wildcards in the prefix are matched literally
+			if links, _ := dao.SearchLinks("team_", 10); len(links) != 1 || links[0].Abbreviation != "team_x" {
+				t.Errorf("SearchLinks(team_) = %+v, want team_x", links)
+			}
+			if links, _ := dao.SearchLinks("", 2); len(links) != 2 {
+				t.Errorf("SearchLinks() with limit 2 = %+v, want 2 links", links)
+			}
+		})
+
+		t.Run("GetGlobalStats ranks links over a window", func(t *testing.T) {
+			dao := createDAO()
+			defer dao.Cleanup()
+
+			today := time.Now().UTC()
+			day := func(offset int) time.Time { return today.AddDate(0, 0, offset) }
+			hits := map[string][]time.Time{
+				"g1": {day(0), day(0), day(0), day(-4)},                                                          // growing
+				"g2": {day(-1), day(-1), day(-1), day(-1), day(-1), day(-3), day(-3), day(-3), day(-3), day(-3)}, // flat
+				"g3": {day(-2)},                                                                                  // new
+				"g4": nil,                                                                                        // never clicked
+				"g5": {day(-10)},                                                                                 // before both windows
+			}
+			for abv, times := range hits {
+				_ = dao.Save(abv, "https://"+abv+".com")
+				for _, ht := range times {
+					if _, err := dao.GetUrlWithHit(abv, Hit{Time: ht}); err != nil {
+						t.Fatalf("GetUrlWithHit() error = %v", err)
+					}
+				}
+			}
+			_, _ = dao.GetUrlWithHit("g4", Hit{Time: day(0), Bot: "Slack"}) // bots don't count as clicks
+
+			// Give async updates time to complete
+			time.Sleep(100 * time.Millisecond)
+
+			stats, err := dao.GetGlobalStats(day(-2).Format("2006-01-02"), day(0).Format("2006-01-02"), 10)
+			if err != nil {
+				t.Fatalf("GetGlobalStats() error = %v", err)
+			}
+
+			wantTop := []LinkCount{{"", "g2", "https://g2.com", 5, 0}, {"", "g1", "https://g1.com", 3, 0}, {"", "g3", "https://g3.com", 1, 0}}
+			if !slices.Equal(stats.TopLinks, wantTop) {
+				t.Errorf("GetGlobalStats().TopLinks = %v, want %v", stats.TopLinks, wantTop)
+			}
+			wantTrending := []LinkCount{{"", "g1", "https://g1.com", 3, 1}, {"", "g3", "https://g3.com", 1, 0}}
+			if !slices.Equal(stats.Trending, wantTrending) {
+				t.Errorf("GetGlobalStats().Trending = %v, want %v", stats.Trending, wantTrending)
+			}
+			wantNever := []LinkCount{{Abbreviation: "g4", Url: "https://g4.com"}}
+			if !slices.Equal(stats.NeverClicked, wantNever) || stats.NeverClickedTotal != 1 {
+				t.Errorf("GetGlobalStats().NeverClicked = %v (%d), want %v", stats.NeverClicked, stats.NeverClickedTotal, wantNever)
+			}
+			wantHits := map[string]int{day(0).Format("2006-01-02"): 3, day(-1).Format("2006-01-02"): 5, day(-2).Format("2006-01-02"): 1}
+			if !maps.Equal(stats.HitsPerDay, wantHits) {
+				t.Errorf("GetGlobalStats().HitsPerDay = %v, want %v", stats.HitsPerDay, wantHits)
+			}
+			wantCreated := map[string]int{Date(): 5}
+			if !maps.Equal(stats.CreatedPerDay, wantCreated) {
+				t.Errorf("GetGlobalStats().CreatedPerDay = %v, want %v", stats.CreatedPerDay, wantCreated)
+			}
+
+			limited, _ := dao.GetGlobalStats(day(-2).Format("2006-01-02"), day(0).Format("2006-01-02"), 1)
+			if len(limited.TopLinks) != 1 || len(limited.Trending) != 1 {
+				t.Errorf("GetGlobalStats() with limit 1 = %d top and %d trending links", len(limited.TopLinks), len(limited.Trending))
+			}
+		})
+
+		t.Run("GetGlobalStats and GetUnhealthy stay in their domain", func(t *testing.T) {
+			dao := createDAO()
+			defer dao.Cleanup()
+			acme := dao.ForDomain("acme.link")
+
+			now := time.Now().UTC()
+			today := now.Format("2006-01-02")
+			dead := Health{Status: 404, Checked: now, Failures: 3, Dead: true}
+			for _, d := range []ShortUrlDao{dao, acme} {
+				_ = d.Save("mine", "https://mine.com")
+				_ = d.Save("idle", "https://idle.com")
+				_ = d.SetHealth("mine", dead)
+			}
+			_, _ = acme.GetUrlWithHit("mine", Hit{Time: now})
+			_, _ = acme.GetUrlWithHit("mine", Hit{Time: now})
+
+			// Give async updates time to complete
+			time.Sleep(100 * time.Millisecond)
+
+			for _, tt := range []struct {
+				name   string
+				d      ShortUrlDao
+				domain string
+				hits   int
+			}{
+				{"default", dao, "", 0},
+				{"acme.link", acme, "acme.link", 2},
+			} {
+				stats, err := tt.d.GetGlobalStats(today, today, 10)
+				if err != nil {
+					t.Fatalf("GetGlobalStats() in %s error = %v", tt.name, err)
+				}
+				if stats.HitsPerDay[today] != tt.hits || stats.CreatedPerDay[today] != 2 {
+					t.Errorf("GetGlobalStats() in %s = %d hits and %d created, want %d and 2", tt.name, stats.HitsPerDay[today], stats.CreatedPerDay[today], tt.hits)
+				}
+				for _, lc := range slices.Concat(stats.TopLinks, stats.Trending, stats.NeverClicked) {
+					if lc.Domain != tt.domain {
+						t.Errorf("GetGlobalStats() in %s listed %+v", tt.name, lc)
+					}
+				}
+				if wantNever := 2 - min(tt.hits, 1); stats.NeverClickedTotal != wantNever {
+					t.Errorf("GetGlobalStats() in %s has %d never clicked, want %d", tt.name, stats.NeverClickedTotal, wantNever)
+				}
+
+				unhealthy, err := tt.d.GetUnhealthy(10)
+				if err != nil {
+					t.Fatalf("GetUnhealthy() in %s error = %v", tt.name, err)
+				}
+				if len(unhealthy) != 1 || unhealthy[0].Domain != tt.domain || unhealthy[0].Abbreviation != "mine" {
+					t.Errorf("GetUnhealthy() in %s = %+v, want its own link", tt.name, unhealthy)
+				}
+			}
+
+			deadLinks, err := dao.GetDeadLinks(10)
+			if err != nil {
+				t.Fatalf("GetDeadLinks() error = %v", err)
+			}
+			if len(deadLinks) != 2 {
+				t.Errorf("GetDeadLinks() = %+v, want the dead link of each domain", deadLinks)
+			}
+		})
+
+		t.Run("Tags and collections", func(t *testing.T) {
+			dao := createDAO()
+			defer dao.Cleanup()
+
+			now := time.Now().UTC()
+			today := now.Format("2006-01-02")
+			for _, abv := range []string{"t1", "t2", "t3"} {
+				_ = dao.Save(abv, "https://"+abv+".com")
+			}
+			for range 3 {
+				_, _ = dao.GetUrlWithHit("t1", Hit{Time: now})
+			}
+			_, _ = dao.GetUrlWithHit("t2", Hit{Time: now})
+			_, _ = dao.GetUrlWithHit("t2", Hit{Time: now.AddDate(0, 0, -30)})
+			_, _ = dao.GetUrlWithHit("t3", Hit{Time: now})
+
+			if err := dao.AddTags("t1", []string{"spring", "email"}); err != nil {
+				t.Fatalf("AddTags() error = %v", err)
+			}
+			_ = dao.AddTags("t2", []string{"spring"})
+			_ = dao.AddTags("t2", []string{"spring"}) // tagging again changes nothing
+			_ = dao.AddTags("t3", []string{"email"})
+			_ = dao.AddTags("missing", []string{"spring"})
+			if err := dao.SetCollection("t1", "launch"); err != nil {
+				t.Fatalf("SetCollection() error = %v", err)
+			}
+			_ = dao.SetCollection("t3", "other")
+			_ = dao.SetCollection("t3", "launch") // moves it out of other
+
+			// Give async updates time to complete
+			time.Sleep(100 * time.Millisecond)
+
+			stats, _ := dao.GetStats("t1")
+			if !slices.Equal(stats.Tags, []string{"email", "spring"}) || stats.Collection != "launch" {
+				t.Errorf("GetStats() tags = %v, collection = %q, want [email spring] and launch", stats.Tags, stats.Collection)
+			}
+
+			names := func(links []Link) []string {
+				var abvs []string
+				for _, l := range links {
+					abvs = append(abvs, l.Abbreviation)
+				}
+				return abvs
+			}
+			tests := []struct {
+				group Group
+				want  []string
+			}{
+				{Group{TagGroup, "spring"}, []string{"t1", "t2"}},
+				{Group{TagGroup, "email"}, []string{"t1", "t3"}},
+				{Group{TagGroup, "none"}, nil},
+				{Group{CollectionGroup, "launch"}, []string{"t1", "t3"}},
+				{Group{CollectionGroup, "other"}, nil},
+			}
+			for _, tt := range tests {
+				links, err := dao.GetGroupLinks(tt.group, 10)
+				if err != nil {
+					t.Fatalf("GetGroupLinks(%v) error = %v", tt.group, err)
+				}
+				if got := names(links); !slices.Equal(got, tt.want) {
+					t.Errorf("GetGroupLinks(%v) = %v, want %v", tt.group, got, tt.want)
+				}
+			}
+			if links, _ := dao.GetGroupLinks(Group{TagGroup, "spring"}, 1); len(links) != 1 {
+				t.Errorf("GetGroupLinks() with limit 1 = %v", links)
+			}
+
+			group, err := dao.GetGroupStats(Group{TagGroup, "spring"}, now.AddDate(0, 0, -6).Format("2006-01-02"), today, 10)
+			if err != nil {
+				t.Fatalf("GetGroupStats() error = %v", err)
+			}
+			wantTop := []LinkCount{{"", "t1", "https://t1.com", 3, 0}, {"", "t2", "https://t2.com", 1, 0}}
+			if group.Links != 2 || group.Hits != 5 || !maps.Equal(group.HitsPerDay, map[string]int{today: 4}) || !slices.Equal(group.TopLinks, wantTop) {
+				t.Errorf("GetGroupStats() = %+v, want 2 links, 5 hits, 4 today and top links %v", group, wantTop)
+			}
+
+			_ = dao.RemoveTags("t1", []string{"spring", "unknown"})
+			_ = dao.SetCollection("t1", "")
+			_ = dao.DeleteAbv("t3")
+			if links, _ := dao.GetGroupLinks(Group{TagGroup, "spring"}, 10); !slices.Equal(names(links), []string{"t2"}) {
+				t.Errorf("GetGroupLinks() after untagging = %v, want [t2]", names(links))
+			}
+			if links, _ := dao.GetGroupLinks(Group{CollectionGroup, "launch"}, 10); len(links) != 0 {
+				t.Errorf("GetGroupLinks() of an emptied collection = %v, want none", names(links))
+			}
+			if stats, _ := dao.GetStats("t1"); !slices.Equal(stats.Tags, []string{"email"}) || stats.Collection != "" {
+				t.Errorf("GetStats() after untagging = %v, %q, want [email] and no collection", stats.Tags, stats.Collection)
+			}
+		})
+
+		t.Run("Domains keep their own links", func(t *testing.T) {
+			dao := createDAO()
+			defer dao.Cleanup()
+			acme := dao.ForDomain("acme.link")
+
+			if err := dao.Save("same", "https://default.com"); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+			if err := acme.Save("same", "https://acme.com"); err != nil {
+				t.Fatalf("ForDomain().Save() error = %v", err)
+			}
+			if err := acme.Save("other", "https://default.com"); err != nil {
+				t.Fatalf("ForDomain().Save() of a url in another domain error = %v", err)
+			}
+
+			if u, _ := dao.GetUrl("same"); u != "https://default.com" {
+				t.Errorf("GetUrl() = %v, want %v", u, "https://default.com")
+			}
+			if u, _ := acme.GetUrl("same"); u != "https://acme.com" {
+				t.Errorf("ForDomain().GetUrl() = %v, want %v", u, "https://acme.com")
+			}
+			if abv, _ := acme.GetAbv("https://default.com"); abv != "other" {
+				t.Errorf("ForDomain().GetAbv() = %v, want %v", abv, "other")
+			}
+			if u, _ := dao.GetUrl("other"); u != "" {
+				t.Errorf("GetUrl() of a link in another domain = %v, want empty", u)
+			}
+			if stats, _ := acme.GetStats("same"); stats.Domain != "acme.link" || stats.Url != "https://acme.com" {
+				t.Errorf("ForDomain().GetStats() = %v/%v, want acme.link/https://acme.com", stats.Domain, stats.Url)
+			}
+
+			_ = acme.SetBlocked("same", "phishing")
+			if _, err := dao.GetUrlWithHit("same", Hit{}); err != nil {
+				t.Errorf("GetUrlWithHit() of a link blocked in another domain error = %v", err)
+			}
+
+			links, err := dao.GetLinksToCheck(time.Now(), 10)
+			if err != nil {
+				t.Fatalf("GetLinksToCheck() error = %v", err)
+			}
+			domains := map[string]string{}
+			for _, l := range links {
+				domains[l.Abbreviation] = l.Domain
+			}
+			if want := map[string]string{"same": "", "other": "acme.link"}; !maps.Equal(domains, want) {
+				t.Errorf("GetLinksToCheck() domains = %v, want %v", domains, want)
+			}
+
+			if err := acme.DeleteAbv("other"); err != nil {
+				t.Fatalf("ForDomain().DeleteAbv() error = %v", err)
+			}
+			if u, _ := acme.GetUrl("other"); u != "" {
+				t.Errorf("ForDomain().GetUrl() after delete = %v, want empty", u)
+			}
+			if u, _ := dao.GetUrl("same"); u != "https://default.com" {
+				t.Errorf("GetUrl() after deleting in another domain = %v, want %v", u, "https://default.com")
+			}
+		})
+
+		t.Run("SaveAll saves every link or none", func(t *testing.T) {
+			dao := createDAO()
+			defer dao.Cleanup()
+			saver, ok := dao.ForDomain("acme.link").(BatchSaver)
+			if !ok {
+				t.Skip("not a BatchSaver")
+			}
+			acme := dao.ForDomain("acme.link")
+
+			if err := saver.SaveAll([]Link{{Abbreviation: "b1", Url: "https://b1.com"}, {Abbreviation: "b2", Url: "https://b2.com"}}); err != nil {
+				t.Fatalf("SaveAll() error = %v", err)
+			}
+			for _, link := range []Link{{Abbreviation: "b1", Url: "https://b1.com"}, {Abbreviation: "b2", Url: "https://b2.com"}} {
+				if u, _ := acme.GetUrl(link.Abbreviation); u != link.Url {
+					t.Errorf("GetUrl(%s) = %v, want %v", link.Abbreviation, u, link.Url)
+				}
+			}
+
+			if err := saver.SaveAll([]Link{{Abbreviation: "b3", Url: "https://b3.com"}, {Abbreviation: "b1", Url: "https://other.com"}}); err == nil {
+				t.Errorf("SaveAll() with a taken name error = nil, want one")
+			}
+			if err := saver.SaveAll([]Link{{Abbreviation: "b4", Url: "https://b4.com"}, {Abbreviation: "b5", Url: "https://b2.com"}}); err == nil {
+				t.Errorf("SaveAll() with a taken url error = nil, want one")
+			}
+			for _, abv := range []string{"b3", "b4", "b5"} {
+				if u, _ := acme.GetUrl(abv); u != "" {
+					t.Errorf("GetUrl(%s) after a failed SaveAll() = %v, want empty", abv, u)
+				}
+			}
+		})
+
 		t.Run("Multiple saves and retrieves", func(t *testing.T) {
 			dao := createDAO()
 			defer dao.Cleanup()
@@ -209,9 +947,59 @@ func TestSQLiteDB_HitTracking(t *testing.T) {
 	}
 }
 
+func TestSQLiteDB_MigrateDomains(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.db")
+	old, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	// the schema from before links had domains, with one link that has been visited
+	for _, stmt := range []string{
+		`CREATE TABLE short_urls (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			abbreviation TEXT NOT NULL UNIQUE,
+			url TEXT NOT NULL UNIQUE,
+			hits INTEGER NOT NULL DEFAULT 0,
+			last_access DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE daily_hits (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			short_url_id INTEGER NOT NULL REFERENCES short_urls(id) ON DELETE CASCADE,
+			hit_date DATE NOT NULL,
+			hits INTEGER NOT NULL DEFAULT 0,
+			UNIQUE(short_url_id, hit_date)
+		)`,
+		`INSERT INTO short_urls (abbreviation, url, hits) VALUES ('old', 'https://old.com', 3)`,
+		`INSERT INTO daily_hits (short_url_id, hit_date, hits) VALUES (1, '2024-01-02', 3)`,
+	} {
+		if _, err := old.Exec(stmt); err != nil {
+			t.Fatalf("Exec(%s) error = %v", stmt, err)
+		}
+	}
+	_ = old.Close()
+
+	dao := CreateSQLiteDB(path)
+	defer dao.Cleanup()
+
+	stats, err := dao.GetStats("old")
+	if err != nil {
+		t.Fatalf("GetStats() error = %v", err)
+	}
+	if stats.Url != "https://old.com" || stats.Hits != 3 || stats.DailyHits["2024-01-02"] != 3 {
+		t.Errorf("GetStats() after migrating = %v, %v hits, %v daily, want https://old.com with 3 hits", stats.Url, stats.Hits, stats.DailyHits)
+	}
+	if err := dao.ForDomain("acme.link").Save("old", "https://old.com"); err != nil {
+		t.Errorf("Save() of the same link in another domain after migrating error = %v", err)
+	}
+	if err := dao.Save("old", "https://new.com"); err == nil {
+		t.Errorf("Save() of a taken name after migrating succeeded, want an error")
+	}
+}
+
 func TestDate(t *testing.T) {
 	result := Date()
-	expected := time.Now().Format("2006-01-02")
+	expected := time.Now().UTC().Format("2006-01-02")
 	if result != expected {
 		t.Errorf("Date() = %v, want %v", result, expected)
 	}
@@ -0,0 +1,89 @@
+package dao
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// The kinds of Group
+const (
+	TagGroup        = "tag"
+	CollectionGroup = "collection"
+)
+
+// groupNamePattern is what tags and collection names look like once lowercased
+var groupNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+// Group is either the links with a tag or the links in a collection. Links can have any number of tags but are
+// in at most one collection, which suits a campaign.
+type Group struct {
+	Kind string // TagGroup or CollectionGroup
+	Name string
+}
+
+// GroupStats summarizes the links of a group over a window of UTC dates. Only hits from people are counted.
+type GroupStats struct {
+	Links      int            // links in the group
+	Hits       int            // hits on them ever
+	HitsPerDay map[string]int // UTC date -> hits on them in the window
+	TopLinks   []LinkCount    // most hits in the window
+}
+
+// NormalizeGroupName returns name lowercased, or an error when it can't name a tag or collection
+func NormalizeGroupName(name string) (string, error) {
+	normalized := strings.ToLower(strings.TrimSpace(name))
+	if !groupNamePattern.MatchString(normalized) {
+		return "", fmt.Errorf("invalid name %q, expected up to 64 letters, digits, '.', '_' or '-' starting with a letter or digit", name)
+	}
+	return normalized, nil
+}
+
+// addTags returns the sorted union of tags and more
+func addTags(tags, more []string) []string {
+	merged := slices.Concat(tags, more)
+	slices.Sort(merged)
+	return slices.Compact(merged)
+}
+
+// removeTags returns tags without any of less
+func removeTags(tags, less []string) []string {
+	return slices.DeleteFunc(slices.Clone(tags), func(tag string) bool { return slices.Contains(less, tag) })
+}
+
+// groupLink is a link of a group with its hits, ever and on each UTC date
+type groupLink struct {
+	abv       string
+	url       string
+	hits      int
+	dailyHits map[string]int
+}
+
+// summarizeGroup adds up the hits of the links of a group in domain over the inclusive UTC dates from and to
+func summarizeGroup(domain string, links []groupLink, from, to string, limit int) GroupStats {
+	stats := GroupStats{Links: len(links), HitsPerDay: make(map[string]int)}
+	counts := make([]LinkCount, 0, len(links))
+	for _, l := range links {
+		stats.Hits += l.hits
+		lc := LinkCount{Domain: domain, Abbreviation: l.abv, Url: l.url}
+		for date, hits := range l.dailyHits {
+			if date >= from && date <= to {
+				lc.Hits += hits
+				stats.HitsPerDay[date] += hits
+			}
+		}
+		counts = append(counts, lc)
+	}
+	stats.TopLinks = rankLinks(counts, limit, func(lc LinkCount) int { return lc.Hits })
+	return stats
+}
+
+// groupSource returns what the SQL stores select the links of group from, as short_urls s, and the column that
+// has to equal the group's name
+func groupSource(group Group) (from, column string) {
+	if group.Kind == CollectionGroup {
+		return "short_urls s", "s.collection"
+	}
+	return "short_urls s JOIN link_tags g ON g.short_url_id = s.id", "g.tag"
+}
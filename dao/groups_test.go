@@ -0,0 +1,36 @@
+package dao
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeGroupName(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"spring-2024", "spring-2024", false},
+		{" Email.Q2_a ", "email.q2_a", false},
+		{"9", "9", false},
+		{"", "", true},
+		{"-leading", "", true},
+		{"has space", "", true},
+		{"a:b", "", true},
+		{"a/b", "", true},
+		{strings.Repeat("a", 64), strings.Repeat("a", 64), false},
+		{strings.Repeat("a", 65), "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeGroupName(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NormalizeGroupName(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeGroupName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package dao
+
+import (
+	"cmp"
+	"encoding/json"
+	"slices"
+	"time"
+)
+
+// Health is the result of the last check of a link's destination
+type Health struct {
+	Status    int       `json:"status" bson:"status"`                           // status of the final response, 0 when there wasn't one
+	Error     string    `json:"error,omitempty" bson:"error,omitempty"`         // why the check failed, empty when it passed
+	Redirects []string  `json:"redirects,omitempty" bson:"redirects,omitempty"` // URLs the destination redirected through, in order
+	Checked   time.Time `json:"checked" bson:"checked"`
+	Failures  int       `json:"failures" bson:"failures"` // consecutive failed checks
+	Dead      bool      `json:"dead" bson:"dead"`         // failed enough checks in a row that visitors aren't sent there
+}
+
+// LinkHealth is a link with the last check of its destination, which is zero if it's never been checked
+type LinkHealth struct {
+	Domain       string `json:"domain,omitempty"`
+	Abbreviation string `json:"abbreviation"`
+	Url          string `json:"url"`
+	Protected    bool   `json:"protected,omitempty"` // has a password, so the url isn't shown to everyone
+	Health       Health `json:"health"`
+}
+
+// redirectsJSON encodes the redirect chain for the stores that keep it as text
+func redirectsJSON(redirects []string) string {
+	if len(redirects) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(redirects)
+	return string(b)
+}
+
+func parseRedirects(s string) []string {
+	var redirects []string
+	if s != "" {
+		_ = json.Unmarshal([]byte(s), &redirects)
+	}
+	return redirects
+}
+
+// sortToCheck orders links by when they were last checked, never checked ones first
+func sortToCheck(links []LinkHealth) {
+	slices.SortFunc(links, func(a, b LinkHealth) int {
+		return cmp.Or(a.Health.Checked.Compare(b.Health.Checked), cmp.Compare(a.Abbreviation, b.Abbreviation),
+			cmp.Compare(a.Domain, b.Domain))
+	})
+}
+
+// sortUnhealthy orders links with dead ones first, then by the most consecutive failures
+func sortUnhealthy(links []LinkHealth) {
+	slices.SortFunc(links, func(a, b LinkHealth) int {
+		if a.Health.Dead != b.Health.Dead {
+			if a.Health.Dead {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Or(cmp.Compare(b.Health.Failures, a.Health.Failures), cmp.Compare(a.Abbreviation, b.Abbreviation),
+			cmp.Compare(a.Domain, b.Domain))
+	})
+}
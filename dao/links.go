@@ -0,0 +1,25 @@
+package dao
+
+import "strings"
+
+// Link is a link's name and where it leads
+type Link struct {
+	Abbreviation string `json:"abbreviation"`
+	Url          string `json:"url"`
+	Protected    bool   `json:"protected,omitempty"` // whether visitors need a password to follow it
+}
+
+// firstLink returns the first of names that's in found, which maps names to their urls
+func firstLink(names []string, found map[string]string) Link {
+	for _, name := range names {
+		if url, ok := found[name]; ok {
+			return Link{Abbreviation: name, Url: url}
+		}
+	}
+	return Link{}
+}
+
+// likePrefix returns a LIKE pattern matching strings starting with prefix, escaped with '!'
+func likePrefix(prefix string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(prefix) + "%"
+}
@@ -1,39 +1,87 @@
 package dao
 
 import (
+	"cmp"
+	"maps"
+	"slices"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/ericfialkowski/shorturl/hll"
 )
 
+// MemoryDB holds the links of one domain. Every domain's MemoryDB shares the lock and the map of domains.
 type MemoryDB struct {
-	mu        sync.RWMutex
-	urlNdxMap map[string]*ShortUrl
-	abvNdxMap map[string]*ShortUrl
+	mu         *sync.RWMutex
+	domain     string
+	domains    map[string]*MemoryDB
+	urlNdxMap  map[string]*ShortUrl
+	abvNdxMap  map[string]*ShortUrl
+	hourlyHits map[string]map[time.Time]int
+	sketches   map[string]map[string]*hll.Sketch
+	created    map[string]time.Time
+	passwords  map[string]string // hashes of the passwords protecting links
 }
 
 func CreateMemoryDB() ShortUrlDao {
-	return &MemoryDB{
-		urlNdxMap: make(map[string]*ShortUrl),
-		abvNdxMap: make(map[string]*ShortUrl),
+	return newMemoryDomain(&sync.RWMutex{}, make(map[string]*MemoryDB), "")
+}
+
+// newMemoryDomain makes the empty MemoryDB of domain and adds it to domains
+func newMemoryDomain(mu *sync.RWMutex, domains map[string]*MemoryDB, domain string) *MemoryDB {
+	d := &MemoryDB{
+		mu:         mu,
+		domain:     domain,
+		domains:    domains,
+		urlNdxMap:  make(map[string]*ShortUrl),
+		abvNdxMap:  make(map[string]*ShortUrl),
+		hourlyHits: make(map[string]map[time.Time]int),
+		sketches:   make(map[string]map[string]*hll.Sketch),
+		created:    make(map[string]time.Time),
+		passwords:  make(map[string]string),
 	}
+	domains[domain] = d
+	return d
 }
 
 func (d *MemoryDB) IsLikelyOk() bool {
 	return true
 }
 
+func (d *MemoryDB) ForDomain(domain string) ShortUrlDao {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if ns, ok := d.domains[domain]; ok {
+		return ns
+	}
+	return newMemoryDomain(d.mu, d.domains, domain)
+}
+
 func (d *MemoryDB) Save(abv string, url string) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
 	su := &ShortUrl{
+		Domain:       d.domain,
 		Abbreviation: abv,
 		Url:          url,
 		Hits:         0,
 		DailyHits:    make(map[string]int),
+		CountryHits:  make(map[string]int),
+		RegionHits:   make(map[string]int),
+		ReferrerHits: make(map[string]int),
+		VariantHits:  make(map[string]int),
+		BotFamilies:  make(map[string]int),
 	}
 	d.urlNdxMap[url] = su
 	d.abvNdxMap[abv] = su
+	d.hourlyHits[abv] = make(map[time.Time]int)
+	d.sketches[abv] = make(map[string]*hll.Sketch)
+	if _, ok := d.created[abv]; !ok {
+		d.created[abv] = time.Now()
+	}
 	return nil
 }
 
@@ -45,6 +93,10 @@ func (d *MemoryDB) DeleteAbv(abv string) error {
 	if ok {
 		delete(d.urlNdxMap, su.Url)
 		delete(d.abvNdxMap, abv)
+		delete(d.hourlyHits, abv)
+		delete(d.sketches, abv)
+		delete(d.created, abv)
+		delete(d.passwords, abv)
 	}
 	return nil
 }
@@ -57,20 +109,68 @@ func (d *MemoryDB) DeleteUrl(url string) error {
 	if ok {
 		delete(d.abvNdxMap, su.Abbreviation)
 		delete(d.urlNdxMap, url)
+		delete(d.hourlyHits, su.Abbreviation)
+		delete(d.sketches, su.Abbreviation)
+		delete(d.created, su.Abbreviation)
+		delete(d.passwords, su.Abbreviation)
 	}
 	return nil
 }
 
 func (d *MemoryDB) GetUrl(abv string) (string, error) {
+	return unblocked(d.GetUrlWithHit(abv, NewHit()))
+}
+
+func (d *MemoryDB) LookupUrl(abv string) (string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	su, ok := d.abvNdxMap[abv]
+	if !ok {
+		return "", nil
+	}
+	if su.Blocked != "" {
+		return su.Url, &BlockedError{Abv: abv, Reason: su.Blocked}
+	}
+	return su.Url, nil
+}
+
+func (d *MemoryDB) GetUrlWithHit(abv string, hit Hit) (string, error) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
 	su, ok := d.abvNdxMap[abv]
+	if ok && su.Blocked != "" {
+		return su.Url, &BlockedError{Abv: abv, Reason: su.Blocked}
+	}
+	if ok && len(su.Url) > 0 && hit.Bot != "" {
+		su.BotHits++
+		su.BotFamilies[hit.Bot]++
+		return su.Url, nil
+	}
 	if ok && len(su.Url) > 0 {
 		su.Hits++
-		su.LastAccess = time.Now()
-		date := Date()
-		su.DailyHits[date]++
+		su.LastAccess = hit.Time
+		su.DailyHits[hit.Date()]++
+		d.hourlyHits[abv][hit.Hour()]++
+		if hit.Country != "" {
+			su.CountryHits[hit.Country]++
+		}
+		if hit.Region != "" {
+			su.RegionHits[hit.Region]++
+		}
+		if hit.Referrer != "" {
+			su.ReferrerHits[hit.Referrer]++
+		}
+		if hit.Variant != "" {
+			su.VariantHits[hit.Variant]++
+		}
+		if hit.Visitor != "" {
+			if d.sketches[abv][hit.Date()] == nil {
+				d.sketches[abv][hit.Date()] = hll.New()
+			}
+			d.sketches[abv][hit.Date()].Add(hit.Visitor)
+		}
 		return su.Url, nil
 	}
 	return "", nil
@@ -94,11 +194,352 @@ func (d *MemoryDB) GetStats(abv string) (ShortUrl, error) {
 	su, ok := d.abvNdxMap[abv]
 	if ok {
 		// Return a copy to avoid external modifications
-		return *su, nil
+		c := *su
+		c.Protected = d.passwords[abv] != ""
+		c.DailyHits = maps.Clone(su.DailyHits)
+		c.CountryHits = maps.Clone(su.CountryHits)
+		c.RegionHits = maps.Clone(su.RegionHits)
+		c.ReferrerHits = maps.Clone(su.ReferrerHits)
+		c.VariantHits = maps.Clone(su.VariantHits)
+		c.BotFamilies = maps.Clone(su.BotFamilies)
+		if su.Health != nil {
+			health := *su.Health
+			c.Health = &health
+		}
+		if su.Metadata != nil {
+			metadata := *su.Metadata
+			c.Metadata = &metadata
+		}
+		c.Tags = slices.Clone(su.Tags)
+		c.Options = cloneOptions(su.Options)
+		fillUniques(&c, d.sketches[abv])
+		return c, nil
 	}
 	return ShortUrl{}, nil
 }
 
+func (d *MemoryDB) FindLink(names []string) (Link, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	for _, name := range names {
+		if su, ok := d.abvNdxMap[name]; ok {
+			return Link{Abbreviation: name, Url: su.Url}, nil
+		}
+	}
+	return Link{}, nil
+}
+
+func (d *MemoryDB) SearchLinks(prefix string, limit int) ([]Link, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var links []Link
+	for abv, su := range d.abvNdxMap {
+		if strings.HasPrefix(abv, prefix) {
+			links = append(links, Link{Abbreviation: abv, Url: su.Url, Protected: d.passwords[abv] != ""})
+		}
+	}
+	slices.SortFunc(links, func(a, b Link) int { return strings.Compare(a.Abbreviation, b.Abbreviation) })
+	return links[:min(limit, len(links))], nil
+}
+
+func (d *MemoryDB) SetBlocked(abv, reason string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if su, ok := d.abvNdxMap[abv]; ok {
+		su.Blocked = reason
+	}
+	return nil
+}
+
+func (d *MemoryDB) SetOptions(abv string, options Options) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if su, ok := d.abvNdxMap[abv]; ok {
+		su.Options = cloneOptions(&options)
+	}
+	return nil
+}
+
+func (d *MemoryDB) GetOptions(abv string) (Options, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if su, ok := d.abvNdxMap[abv]; ok && su.Options != nil {
+		return *cloneOptions(su.Options), nil
+	}
+	return Options{}, nil
+}
+
+func (d *MemoryDB) SetPassword(abv, hash string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.abvNdxMap[abv]; !ok {
+		return nil
+	}
+	if hash == "" {
+		delete(d.passwords, abv)
+	} else {
+		d.passwords[abv] = hash
+	}
+	return nil
+}
+
+func (d *MemoryDB) GetPassword(abv string) (string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.passwords[abv], nil
+}
+
+func (d *MemoryDB) AddTags(abv string, tags []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if su, ok := d.abvNdxMap[abv]; ok {
+		su.Tags = addTags(su.Tags, tags)
+	}
+	return nil
+}
+
+func (d *MemoryDB) RemoveTags(abv string, tags []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if su, ok := d.abvNdxMap[abv]; ok {
+		su.Tags = removeTags(su.Tags, tags)
+	}
+	return nil
+}
+
+func (d *MemoryDB) SetCollection(abv, collection string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if su, ok := d.abvNdxMap[abv]; ok {
+		su.Collection = collection
+	}
+	return nil
+}
+
+// inGroup returns whether su is one of the links of group
+func inGroup(su *ShortUrl, group Group) bool {
+	if group.Kind == CollectionGroup {
+		return su.Collection == group.Name
+	}
+	return slices.Contains(su.Tags, group.Name)
+}
+
+func (d *MemoryDB) GetGroupLinks(group Group, limit int) ([]Link, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	links := make([]Link, 0)
+	for abv, su := range d.abvNdxMap {
+		if inGroup(su, group) {
+			links = append(links, Link{Abbreviation: abv, Url: su.Url, Protected: d.passwords[abv] != ""})
+		}
+	}
+	slices.SortFunc(links, func(a, b Link) int { return strings.Compare(a.Abbreviation, b.Abbreviation) })
+	return links[:min(limit, len(links))], nil
+}
+
+func (d *MemoryDB) GetGroupStats(group Group, from, to string, limit int) (GroupStats, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var links []groupLink
+	for abv, su := range d.abvNdxMap {
+		if inGroup(su, group) {
+			links = append(links, groupLink{abv: abv, url: su.Url, hits: int(su.Hits), dailyHits: su.DailyHits})
+		}
+	}
+	return summarizeGroup(d.domain, links, from, to, limit), nil
+}
+
+func (d *MemoryDB) SetHealth(abv string, health Health) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if su, ok := d.abvNdxMap[abv]; ok {
+		su.Health = &health
+	}
+	return nil
+}
+
+func (d *MemoryDB) GetLinksToCheck(checkedBefore time.Time, limit int) ([]LinkHealth, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	links := make([]LinkHealth, 0)
+	for _, ns := range d.domains {
+		for abv, su := range ns.abvNdxMap {
+			if su.Blocked != "" || (su.Health != nil && !su.Health.Checked.Before(checkedBefore)) {
+				continue
+			}
+			link := LinkHealth{Domain: ns.domain, Abbreviation: abv, Url: su.Url, Protected: ns.passwords[abv] != ""}
+			if su.Health != nil {
+				link.Health = *su.Health
+			}
+			links = append(links, link)
+		}
+	}
+	sortToCheck(links)
+	return links[:min(limit, len(links))], nil
+}
+
+func (d *MemoryDB) GetUnhealthy(limit int) ([]LinkHealth, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	links := make([]LinkHealth, 0)
+	for abv, su := range d.abvNdxMap {
+		if su.Health != nil && su.Health.Failures > 0 {
+			links = append(links, LinkHealth{Domain: d.domain, Abbreviation: abv, Url: su.Url, Protected: d.passwords[abv] != "", Health: *su.Health})
+		}
+	}
+	sortUnhealthy(links)
+	return links[:min(limit, len(links))], nil
+}
+
+func (d *MemoryDB) GetDeadLinks(limit int) ([]LinkHealth, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	links := make([]LinkHealth, 0)
+	for _, ns := range d.domains {
+		for abv, su := range ns.abvNdxMap {
+			if su.Health != nil && su.Health.Dead {
+				links = append(links, LinkHealth{Domain: ns.domain, Abbreviation: abv, Url: su.Url, Health: *su.Health})
+			}
+		}
+	}
+	sortUnhealthy(links)
+	return links[:min(limit, len(links))], nil
+}
+
+func (d *MemoryDB) SetMetadata(abv string, metadata Metadata) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if su, ok := d.abvNdxMap[abv]; ok {
+		su.Metadata = &metadata
+	}
+	return nil
+}
+
+func (d *MemoryDB) GetStaleMetadata(fetchedBefore time.Time, limit int) ([]LinkMetadata, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	links := make([]LinkMetadata, 0)
+	for _, ns := range d.domains {
+		for abv, su := range ns.abvNdxMap {
+			if su.Blocked != "" || (su.Metadata != nil && !su.Metadata.Fetched.Before(fetchedBefore)) {
+				continue
+			}
+			link := LinkMetadata{Domain: ns.domain, Abbreviation: abv, Url: su.Url}
+			if su.Metadata != nil {
+				link.Metadata = *su.Metadata
+			}
+			links = append(links, link)
+		}
+	}
+	slices.SortFunc(links, func(a, b LinkMetadata) int {
+		return cmp.Or(a.Metadata.Fetched.Compare(b.Metadata.Fetched), cmp.Compare(a.Abbreviation, b.Abbreviation),
+			cmp.Compare(a.Domain, b.Domain))
+	})
+	return links[:min(limit, len(links))], nil
+}
+
+func (d *MemoryDB) GetHourlyHits(abv string, from, to time.Time) (map[time.Time]int, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	hits := make(map[time.Time]int)
+	for hour, count := range d.hourlyHits[abv] {
+		if !hour.Before(from) && hour.Before(to) {
+			hits[hour] = count
+		}
+	}
+	return hits, nil
+}
+
+func (d *MemoryDB) CountUniques(abv string, buckets [][]string) ([]int64, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return countBuckets(d.sketches[abv], buckets), nil
+}
+
+func (d *MemoryDB) GetGlobalStats(from, to string, limit int) (GlobalStats, error) {
+	priorFrom, priorTo, err := PriorWindow(from, to)
+	if err != nil {
+		return GlobalStats{}, err
+	}
+	start, end := windowTimes(from, to)
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	stats := GlobalStats{HitsPerDay: make(map[string]int), CreatedPerDay: make(map[string]int)}
+	var counts []LinkCount
+	never := make([]LinkCount, 0)
+	created := make(map[LinkCount]time.Time)
+	for abv, su := range d.abvNdxMap {
+		lc := LinkCount{Domain: d.domain, Abbreviation: abv, Url: su.Url}
+		for date, hits := range su.DailyHits {
+			if date >= from && date <= to {
+				lc.Hits += hits
+				stats.HitsPerDay[date] += hits
+			} else if date >= priorFrom && date <= priorTo {
+				lc.PriorHits += hits
+			}
+		}
+		counts = append(counts, lc)
+
+		if su.Hits == 0 {
+			never = append(never, lc)
+			created[lc] = d.created[abv]
+		}
+		if c := d.created[abv]; !c.Before(start) && c.Before(end) {
+			stats.CreatedPerDay[c.UTC().Format(dateLayout)]++
+		}
+	}
+
+	stats.Trending = rankLinks(counts, limit, func(lc LinkCount) int { return lc.Hits - lc.PriorHits })
+	for i := range counts {
+		counts[i].PriorHits = 0 // only trends compare with the prior window
+	}
+	stats.TopLinks = rankLinks(counts, limit, func(lc LinkCount) int { return lc.Hits })
+
+	slices.SortFunc(never, func(a, b LinkCount) int {
+		return cmp.Or(created[a].Compare(created[b]), cmp.Compare(a.Abbreviation, b.Abbreviation), cmp.Compare(a.Domain, b.Domain))
+	})
+	stats.NeverClickedTotal = len(never)
+	stats.NeverClicked = never[:min(limit, len(never))]
+
+	return stats, nil
+}
+
+// rankLinks returns up to limit of the links with a positive score, highest first
+func rankLinks(counts []LinkCount, limit int, score func(LinkCount) int) []LinkCount {
+	ranked := make([]LinkCount, 0)
+	for _, lc := range counts {
+		if score(lc) > 0 {
+			ranked = append(ranked, lc)
+		}
+	}
+	slices.SortFunc(ranked, func(a, b LinkCount) int {
+		return cmp.Or(cmp.Compare(score(b), score(a)), cmp.Compare(a.Abbreviation, b.Abbreviation), cmp.Compare(a.Domain, b.Domain))
+	})
+	return ranked[:min(limit, len(ranked))]
+}
+
 func (d *MemoryDB) Cleanup() {
 	// no op
 }
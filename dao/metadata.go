@@ -0,0 +1,22 @@
+package dao
+
+import "time"
+
+// Metadata describes the page a link leads to, read from its HTML
+type Metadata struct {
+	Title       string    `json:"title,omitempty" bson:"title,omitempty"`
+	Description string    `json:"description,omitempty" bson:"description,omitempty"`
+	Image       string    `json:"image,omitempty" bson:"image,omitempty"` // preview image from OpenGraph or Twitter card tags
+	SiteName    string    `json:"site_name,omitempty" bson:"site_name,omitempty"`
+	Favicon     string    `json:"favicon,omitempty" bson:"favicon,omitempty"`
+	Error       string    `json:"error,omitempty" bson:"error,omitempty"` // why the last fetch failed, the rest is from the one before
+	Fetched     time.Time `json:"fetched" bson:"fetched"`
+}
+
+// LinkMetadata is a link with the metadata of its destination, which is zero if it's never been fetched
+type LinkMetadata struct {
+	Domain       string   `json:"domain,omitempty"`
+	Abbreviation string   `json:"abbreviation"`
+	Url          string   `json:"url"`
+	Metadata     Metadata `json:"metadata"`
+}
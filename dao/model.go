@@ -2,10 +2,68 @@ package dao
 
 import "time"
 
+const (
+	dateLayout = "2006-01-02"
+	hourLayout = "2006-01-02T15" // key format for hourly buckets in document/key-value stores
+)
+
 type ShortUrl struct {
+	// Domain is the host the link belongs to, empty for the default domain
+	Domain       string         `json:"domain,omitempty" bson:"domain"`
 	Abbreviation string         `json:"abbreviation" bson:"abv"`
 	Url          string         `json:"url" bson:"url"`
-	Hits         int32          `json:"hits" bson:"hits"`
+	Hits         int32          `json:"hits" bson:"hits"` // hits from people; bots are counted in BotHits
 	LastAccess   time.Time      `json:"last_access" bson:"last_access,omitempty"`
 	DailyHits    map[string]int `json:"daily_hits" bson:"daily_hits,omitempty"`
+	CountryHits  map[string]int `json:"country_hits" bson:"country_hits,omitempty"`
+	RegionHits   map[string]int `json:"region_hits" bson:"region_hits,omitempty"`
+	// ReferrerHits is keyed by referring host; Mongo keeps it in its own collection since hosts contain dots
+	ReferrerHits map[string]int `json:"referrer_hits" bson:"-"`
+	// VariantHits is keyed by the name of the A/B variant visitors were sent to
+	VariantHits map[string]int `json:"variant_hits,omitempty" bson:"variant_hits,omitempty"`
+	// Uniques and DailyUniques are approximate distinct visitor counts, computed from stored sketches
+	Uniques      int64            `json:"uniques" bson:"-"`
+	DailyUniques map[string]int64 `json:"daily_uniques" bson:"-"`
+	// BotHits counts crawlers and link unfurlers, which don't affect any of the other stats
+	BotHits     int32          `json:"bot_hits" bson:"bot_hits"`
+	BotFamilies map[string]int `json:"bot_families" bson:"bot_families,omitempty"`
+	// Blocked is why the link no longer redirects, empty while it works
+	Blocked string `json:"blocked,omitempty" bson:"blocked,omitempty"`
+	// Protected is whether visitors need a password to follow the link
+	Protected bool `json:"protected,omitempty" bson:"-"`
+	// Tags and Collection organize links into groups, see Group. Tags are sorted.
+	Tags       []string `json:"tags,omitempty" bson:"tags,omitempty"`
+	Collection string   `json:"collection,omitempty" bson:"collection,omitempty"`
+	// Options change how the link redirects, nil when it redirects plainly
+	Options *Options `json:"options,omitempty" bson:"options,omitempty"`
+	// Health is the last check of the destination, nil until it's been checked
+	Health *Health `json:"health,omitempty" bson:"health,omitempty"`
+	// Metadata describes the destination, nil until it's been fetched
+	Metadata *Metadata `json:"metadata,omitempty" bson:"metadata,omitempty"`
+}
+
+// Hit describes a single access of a short url. Fields that couldn't be determined are left empty.
+type Hit struct {
+	Time     time.Time
+	Country  string // ISO 3166-1 alpha-2 code, e.g. "US"
+	Region   string // ISO 3166-2 code, e.g. "US-CA"
+	Visitor  string // opaque id of who made the request, used to count unique visitors
+	Bot      string // bot family that made the request, empty for people
+	Referrer string // host of the referring page, empty for direct visits
+	Variant  string // A/B variant the visitor was sent to, empty for links without any
+}
+
+// NewHit returns a Hit for the current time with no other details.
+func NewHit() Hit {
+	return Hit{Time: time.Now()}
+}
+
+// Date returns the UTC date bucket of the hit.
+func (h Hit) Date() string {
+	return h.Time.UTC().Format(dateLayout)
+}
+
+// Hour returns the start of the UTC hour bucket of the hit.
+func (h Hit) Hour() time.Time {
+	return h.Time.UTC().Truncate(time.Hour)
 }
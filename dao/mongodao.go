@@ -4,11 +4,14 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"regexp"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/ericfialkowski/shorturl/env"
+	"github.com/ericfialkowski/shorturl/hll"
 
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
@@ -18,18 +21,76 @@ import (
 
 type MongoDB struct {
 	client *mongo.Client
+	domain string
 }
 
 const (
-	dbName              = "shorturl"
-	collectionName      = "urls"
-	urlFieldName        = "url"
-	abvFieldName        = "abv"
-	hitsFieldName       = "hits"
-	lastAccessFieldName = "last_access"
-	dailyHitsFieldName  = "daily_hits"
+	dbName               = "shorturl"
+	collectionName       = "urls"
+	domainFieldName      = "domain"
+	urlFieldName         = "url"
+	abvFieldName         = "abv"
+	hitsFieldName        = "hits"
+	lastAccessFieldName  = "last_access"
+	dailyHitsFieldName   = "daily_hits"
+	countryHitsFieldName = "country_hits"
+	variantHitsFieldName = "variant_hits"
+	regionHitsFieldName  = "region_hits"
+	hourlyHitsFieldName  = "hourly_hits"
+	botHitsFieldName     = "bot_hits"
+	botFamiliesFieldName = "bot_families"
+	blockedFieldName     = "blocked"
+	healthFieldName      = "health"
+	metadataFieldName    = "metadata"
+	optionsFieldName     = "options"
+	passwordFieldName    = "password"
+	tagsFieldName        = "tags"
+	collectionFieldName  = "collection"
+
+	sketchCollectionName = "visitor_sketches"
+	periodFieldName      = "period"
+	sketchFieldName      = "sketch"
+	versionFieldName     = "version"
+
+	referrerCollectionName = "referrer_hits"
+	referrerFieldName      = "referrer"
+
+	dailyHitsCollectionName = "daily_hits"
+	dayFieldName            = "day"
 )
 
+// linkDoc is a link's document with the password hash, which ShortUrl leaves out
+type linkDoc struct {
+	ShortUrl `bson:",inline"`
+	Password string `bson:"password,omitempty"`
+}
+
+// referrerDoc counts the hits on one link from one referring host
+type referrerDoc struct {
+	Domain       string `bson:"domain"`
+	Abbreviation string `bson:"abv"`
+	Referrer     string `bson:"referrer"`
+	Hits         int    `bson:"hits"`
+}
+
+// dailyHitsDoc counts the hits on one link on one UTC day. Links keep their own daily hits too, but analytics
+// across links read these, so they only touch the days they're for.
+type dailyHitsDoc struct {
+	Domain       string `bson:"domain"`
+	Day          string `bson:"day"`
+	Abbreviation string `bson:"abv"`
+	Hits         int    `bson:"hits"`
+}
+
+// sketchDoc is a unique visitor sketch for one link and period, versioned for optimistic updates
+type sketchDoc struct {
+	Domain       string `bson:"domain"`
+	Abbreviation string `bson:"abv"`
+	Period       string `bson:"period"`
+	Sketch       []byte `bson:"sketch"`
+	Version      int64  `bson:"version"`
+}
+
 var once sync.Once
 
 func newContext() (context.Context, context.CancelFunc) {
@@ -48,29 +109,146 @@ func CreateMongoDB(uri string) ShortUrlDao {
 	defer cancel()
 
 	once.Do(func() {
+		collection := client.Database(dbName).Collection(collectionName)
+		sketches := client.Database(dbName).Collection(sketchCollectionName)
+		referrers := client.Database(dbName).Collection(referrerCollectionName)
+		dailyHits := client.Database(dbName).Collection(dailyHitsCollectionName)
+
+		// documents from before domains existed are in the default domain
+		for _, c := range []*mongo.Collection{collection, sketches, referrers} {
+			filter := bson.M{domainFieldName: bson.M{"$exists": false}}
+			if _, err = c.UpdateMany(ctx, filter, bson.M{"$set": bson.M{domainFieldName: ""}}); err != nil {
+				log.Printf("Error adding domains %v", err)
+			}
+		}
+
 		mod := mongo.IndexModel{
-			Keys: bson.M{
-				abvFieldName: 1, // index in ascending order
-			}, Options: options.Index().SetUnique(true).SetName("abv_uniqueness_ndx"),
+			Keys: bson.D{
+				{Key: domainFieldName, Value: 1},
+				{Key: abvFieldName, Value: 1},
+			}, Options: options.Index().SetUnique(true).SetName("domain_abv_uniqueness_ndx"),
 		}
-		collection := client.Database(dbName).Collection(collectionName)
 		if _, err = collection.Indexes().CreateOne(ctx, mod); err != nil {
 			log.Printf("Error creating index %v", err)
 		}
 
 		mod = mongo.IndexModel{
-			Keys: bson.M{
-				urlFieldName: 1, // index in ascending order
-			}, Options: options.Index().SetUnique(true).SetName("url_uniqueness_ndx"),
+			Keys: bson.D{
+				{Key: domainFieldName, Value: 1},
+				{Key: urlFieldName, Value: 1},
+			}, Options: options.Index().SetUnique(true).SetName("domain_url_uniqueness_ndx"),
 		}
 		if _, err = collection.Indexes().CreateOne(ctx, mod); err != nil {
 			log.Printf("Error creating index %v", err)
 		}
+
+		mod = mongo.IndexModel{
+			Keys: bson.D{
+				{Key: domainFieldName, Value: 1},
+				{Key: abvFieldName, Value: 1},
+				{Key: periodFieldName, Value: 1},
+			}, Options: options.Index().SetUnique(true).SetName("domain_abv_period_uniqueness_ndx"),
+		}
+		if _, err = sketches.Indexes().CreateOne(ctx, mod); err != nil {
+			log.Printf("Error creating index %v", err)
+		}
+
+		mod = mongo.IndexModel{
+			Keys: bson.D{
+				{Key: domainFieldName, Value: 1},
+				{Key: abvFieldName, Value: 1},
+				{Key: referrerFieldName, Value: 1},
+			}, Options: options.Index().SetUnique(true).SetName("domain_abv_referrer_uniqueness_ndx"),
+		}
+		if _, err = referrers.Indexes().CreateOne(ctx, mod); err != nil {
+			log.Printf("Error creating index %v", err)
+		}
+
+		mod = mongo.IndexModel{
+			Keys: bson.D{
+				{Key: domainFieldName, Value: 1},
+				{Key: dayFieldName, Value: 1},
+				{Key: abvFieldName, Value: 1},
+			}, Options: options.Index().SetUnique(true).SetName("domain_day_abv_uniqueness_ndx"),
+		}
+		if _, err = dailyHits.Indexes().CreateOne(ctx, mod); err != nil {
+			log.Printf("Error creating index %v", err)
+		}
+		mod = mongo.IndexModel{
+			Keys: bson.D{
+				{Key: domainFieldName, Value: 1},
+				{Key: abvFieldName, Value: 1},
+			}, Options: options.Index().SetName("domain_abv_ndx"),
+		}
+		if _, err = dailyHits.Indexes().CreateOne(ctx, mod); err != nil {
+			log.Printf("Error creating index %v", err)
+		}
+		// links hit before the daily hits had their own collection fill it from theirs
+		if n, err := dailyHits.EstimatedDocumentCount(ctx); err == nil && n == 0 {
+			if err := fillDailyHits(ctx, collection); err != nil {
+				log.Printf("Error filling daily hits %v", err)
+			}
+		}
+
+		for _, field := range []string{tagsFieldName, collectionFieldName} {
+			mod = mongo.IndexModel{
+				Keys: bson.D{
+					{Key: domainFieldName, Value: 1},
+					{Key: field, Value: 1},
+				}, Options: options.Index().SetName("domain_" + field + "_ndx"),
+			}
+			if _, err = collection.Indexes().CreateOne(ctx, mod); err != nil {
+				log.Printf("Error creating index %v", err)
+			}
+		}
+
+		// names and URLs used to be unique on their own, now they're unique within a domain
+		for c, names := range map[*mongo.Collection][]string{
+			collection: {"abv_uniqueness_ndx", "url_uniqueness_ndx"},
+			sketches:   {"abv_period_uniqueness_ndx"},
+			referrers:  {"abv_referrer_uniqueness_ndx"},
+		} {
+			for _, name := range names {
+				if err = c.Indexes().DropOne(ctx, name); err != nil && !strings.Contains(err.Error(), "index not found") {
+					log.Printf("Error dropping index %v", err)
+				}
+			}
+		}
 	})
 
 	return &MongoDB{client: client}
 }
 
+// fillDailyHits copies the daily hits of the links in collection into the daily hits collection
+func fillDailyHits(ctx context.Context, collection *mongo.Collection) error {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: dailyHitsFieldName, Value: bson.D{{Key: "$exists", Value: true}}}}}},
+		{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: 0},
+			{Key: domainFieldName, Value: 1},
+			{Key: abvFieldName, Value: 1},
+			{Key: "day", Value: bson.D{{Key: "$objectToArray", Value: "$" + dailyHitsFieldName}}},
+		}}},
+		{{Key: "$unwind", Value: "$day"}},
+		{{Key: "$project", Value: bson.D{
+			{Key: domainFieldName, Value: 1},
+			{Key: abvFieldName, Value: 1},
+			{Key: dayFieldName, Value: "$day.k"},
+			{Key: hitsFieldName, Value: "$day.v"},
+		}}},
+		{{Key: "$merge", Value: bson.D{
+			{Key: "into", Value: dailyHitsCollectionName},
+			{Key: "on", Value: bson.A{domainFieldName, dayFieldName, abvFieldName}},
+			{Key: "whenMatched", Value: "keepExisting"},
+		}}},
+	}
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	return cursor.Close(ctx)
+}
+
 func (d *MongoDB) Cleanup() {
 	ctx, cancel := newContext()
 	defer cancel()
@@ -87,11 +265,20 @@ func (d *MongoDB) IsLikelyOk() bool {
 	return true
 }
 
+func (d *MongoDB) ForDomain(domain string) ShortUrlDao {
+	return &MongoDB{client: d.client, domain: domain}
+}
+
+// byAbv is the filter matching abv in the dao's domain
+func (d *MongoDB) byAbv(abv string) bson.M {
+	return bson.M{domainFieldName: d.domain, abvFieldName: abv}
+}
+
 func (d *MongoDB) Save(abv string, url string) error {
 	ctx, cancel := newContext()
 	defer cancel()
 	collection := d.client.Database(dbName).Collection(collectionName)
-	data := ShortUrl{Abbreviation: abv, Url: url, Hits: 0}
+	data := ShortUrl{Domain: d.domain, Abbreviation: abv, Url: url, Hits: 0}
 	if _, err := collection.InsertOne(ctx, data); err != nil {
 		if !strings.Contains(err.Error(), "E11000 duplicate") {
 			return fmt.Errorf("couldn't store (%s, %s): %v", abv, url, err)
@@ -104,32 +291,154 @@ func (d *MongoDB) DeleteAbv(abv string) error {
 	ctx, cancel := newContext()
 	defer cancel()
 	collection := d.client.Database(dbName).Collection(collectionName)
-	m := bson.M{abvFieldName: abv}
+	m := d.byAbv(abv)
 	if _, err := collection.DeleteOne(ctx, m); err != nil {
 		return fmt.Errorf("couldn't delete Abbreviation %s: %v", abv, err)
 	}
 
-	return nil
+	return d.deleteLinkData(ctx, abv)
 }
 
 func (d *MongoDB) DeleteUrl(url string) error {
 	ctx, cancel := newContext()
 	defer cancel()
 	collection := d.client.Database(dbName).Collection(collectionName)
-	m := bson.M{urlFieldName: url}
-	if _, err := collection.DeleteOne(ctx, m); err != nil {
+	m := bson.M{domainFieldName: d.domain, urlFieldName: url}
+	var data ShortUrl
+	if err := collection.FindOneAndDelete(ctx, m).Decode(&data); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
 		return fmt.Errorf("couldn't delete Url %s: %v", url, err)
 	}
 
+	return d.deleteLinkData(ctx, data.Abbreviation)
+}
+
+// deleteLinkData removes the stats abv keeps outside of its url document
+func (d *MongoDB) deleteLinkData(ctx context.Context, abv string) error {
+	collection := d.client.Database(dbName).Collection(sketchCollectionName)
+	if _, err := collection.DeleteMany(ctx, d.byAbv(abv)); err != nil {
+		return fmt.Errorf("couldn't delete visitor sketches for %s: %v", abv, err)
+	}
+	collection = d.client.Database(dbName).Collection(referrerCollectionName)
+	if _, err := collection.DeleteMany(ctx, d.byAbv(abv)); err != nil {
+		return fmt.Errorf("couldn't delete referrer hits for %s: %v", abv, err)
+	}
+	collection = d.client.Database(dbName).Collection(dailyHitsCollectionName)
+	if _, err := collection.DeleteMany(ctx, d.byAbv(abv)); err != nil {
+		return fmt.Errorf("couldn't delete daily hits for %s: %v", abv, err)
+	}
+	return nil
+}
+
+// addDailyHit counts a hit on abv on day
+func (d *MongoDB) addDailyHit(ctx context.Context, abv, day string) error {
+	collection := d.client.Database(dbName).Collection(dailyHitsCollectionName)
+	filter := bson.M{domainFieldName: d.domain, dayFieldName: day, abvFieldName: abv}
+	update := bson.M{"$inc": bson.M{hitsFieldName: 1}}
+	if _, err := collection.UpdateOne(ctx, filter, update, options.UpdateOne().SetUpsert(true)); err != nil {
+		return fmt.Errorf("couldn't update daily hits of %s on %s: %v", abv, day, err)
+	}
 	return nil
 }
 
+// addReferrer counts a hit on abv from referrer. Referrers are hosts, and the dots in them can't be
+// used in field paths, so they're kept in their own collection rather than a map on the url document.
+func (d *MongoDB) addReferrer(ctx context.Context, abv, referrer string) error {
+	collection := d.client.Database(dbName).Collection(referrerCollectionName)
+	filter := bson.M{domainFieldName: d.domain, abvFieldName: abv, referrerFieldName: referrer}
+	update := bson.M{"$inc": bson.M{hitsFieldName: 1}}
+	if _, err := collection.UpdateOne(ctx, filter, update, options.UpdateOne().SetUpsert(true)); err != nil {
+		return fmt.Errorf("couldn't update referrer %s for %s: %v", referrer, abv, err)
+	}
+	return nil
+}
+
+// findReferrers returns the hits on abv per referring host
+func (d *MongoDB) findReferrers(ctx context.Context, abv string) (map[string]int, error) {
+	collection := d.client.Database(dbName).Collection(referrerCollectionName)
+	cursor, err := collection.Find(ctx, d.byAbv(abv))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't find referrers for %s: %v", abv, err)
+	}
+	var docs []referrerDoc
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("couldn't decode referrers for %s: %v", abv, err)
+	}
+	referrers := make(map[string]int, len(docs))
+	for _, doc := range docs {
+		referrers[doc.Referrer] = doc.Hits
+	}
+	return referrers, nil
+}
+
+// addVisitor adds visitor to a stored sketch. Updates are conditional on the version read, and
+// retried when another writer got there first.
+func (d *MongoDB) addVisitor(ctx context.Context, abv, period, visitor string) error {
+	collection := d.client.Database(dbName).Collection(sketchCollectionName)
+	key := bson.M{domainFieldName: d.domain, abvFieldName: abv, periodFieldName: period}
+
+	for range maxSketchRetries {
+		var doc sketchDoc
+		if err := collection.FindOne(ctx, key).Decode(&doc); err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+
+		updated, err := addToSketch(doc.Sketch, visitor)
+		if err != nil || updated == nil {
+			return err
+		}
+
+		// a missing document upserts at version 1; a duplicate key error means we lost a race
+		filter := bson.M{domainFieldName: d.domain, abvFieldName: abv, periodFieldName: period, versionFieldName: doc.Version}
+		update := bson.M{
+			"$set": bson.M{sketchFieldName: updated},
+			"$inc": bson.M{versionFieldName: 1},
+		}
+		result, err := collection.UpdateOne(ctx, filter, update, options.UpdateOne().SetUpsert(true))
+		if err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				continue
+			}
+			return err
+		}
+		if result.MatchedCount > 0 || result.UpsertedCount > 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("too much contention updating visitor sketch %s/%s", abv, period)
+}
+
+// findSketches returns the decoded visitor sketches of abv matching filter
+func (d *MongoDB) findSketches(ctx context.Context, filter bson.M) (map[string]*hll.Sketch, error) {
+	collection := d.client.Database(dbName).Collection(sketchCollectionName)
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []sketchDoc
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	encoded := make(map[string][]byte, len(docs))
+	for _, doc := range docs {
+		encoded[doc.Period] = doc.Sketch
+	}
+	return parseSketches(encoded), nil
+}
+
 func (d *MongoDB) GetUrl(abv string) (string, error) {
+	return unblocked(d.GetUrlWithHit(abv, NewHit()))
+}
+
+func (d *MongoDB) LookupUrl(abv string) (string, error) {
 	ctx, cancel := newContext()
 	defer cancel()
 	collection := d.client.Database(dbName).Collection(collectionName)
-	abvKey := bson.M{abvFieldName: abv}
-	result := collection.FindOne(ctx, abvKey)
+	result := collection.FindOne(ctx, d.byAbv(abv))
 
 	if result.Err() != nil {
 		return "", nil
@@ -137,48 +446,504 @@ func (d *MongoDB) GetUrl(abv string) (string, error) {
 
 	var data ShortUrl
 	if err := result.Decode(&data); err != nil {
-		return "", fmt.Errorf("error decoding return %s: %v", abv, result.Err())
+		return "", fmt.Errorf("error decoding return %s: %v", abv, err)
+	}
+	if data.Blocked != "" {
+		return data.Url, &BlockedError{Abv: abv, Reason: data.Blocked}
+	}
+	return data.Url, nil
+}
+
+func (d *MongoDB) GetUrlWithHit(abv string, hit Hit) (string, error) {
+	url, err := d.LookupUrl(abv)
+	if err != nil || url == "" {
+		return url, err
 	}
+	collection := d.client.Database(dbName).Collection(collectionName)
+	abvKey := d.byAbv(abv)
 
 	go func() {
 		ctx, cancel := newContext()
 		defer cancel()
-		update := bson.D{{Key: "$inc", Value: bson.D{{Key: hitsFieldName, Value: 1}}},
-			{Key: "$currentDate", Value: bson.D{{Key: lastAccessFieldName, Value: true}}},
-			{Key: "$inc", Value: bson.D{{Key: dailyHitsFieldName + "." + Date(), Value: 1}}},
+
+		// Bots only count towards the bot stats
+		if hit.Bot != "" {
+			update := bson.D{{Key: "$inc", Value: bson.D{
+				{Key: botHitsFieldName, Value: 1},
+				{Key: botFamiliesFieldName + "." + hit.Bot, Value: 1},
+			}}}
+			if _, err := collection.UpdateOne(ctx, abvKey, update); err != nil {
+				log.Printf("Error updating doc %v", err)
+			}
+			return
+		}
+
+		inc := bson.D{
+			{Key: hitsFieldName, Value: 1},
+			{Key: dailyHitsFieldName + "." + hit.Date(), Value: 1},
+			{Key: hourlyHitsFieldName + "." + hit.Hour().Format(hourLayout), Value: 1},
+		}
+		if hit.Country != "" {
+			inc = append(inc, bson.E{Key: countryHitsFieldName + "." + hit.Country, Value: 1})
+		}
+		if hit.Region != "" {
+			inc = append(inc, bson.E{Key: regionHitsFieldName + "." + hit.Region, Value: 1})
+		}
+		if hit.Variant != "" {
+			// variant names can't contain dots
+			inc = append(inc, bson.E{Key: variantHitsFieldName + "." + hit.Variant, Value: 1})
+		}
+		update := bson.D{{Key: "$inc", Value: inc},
+			{Key: "$set", Value: bson.D{{Key: lastAccessFieldName, Value: hit.Time}}},
 		}
 		if _, err := collection.UpdateOne(ctx, abvKey, update); err != nil {
 			log.Printf("Error updating doc %v", err)
 		}
+		if err := d.addDailyHit(ctx, abv, hit.Date()); err != nil {
+			log.Printf("Error updating daily hits %v", err)
+		}
+
+		if hit.Referrer != "" {
+			if err := d.addReferrer(ctx, abv, hit.Referrer); err != nil {
+				log.Printf("Error updating referrer %v", err)
+			}
+		}
+
+		if hit.Visitor != "" {
+			if err := d.addVisitor(ctx, abv, hit.Date(), hit.Visitor); err != nil {
+				log.Printf("Error updating visitor sketch %v", err)
+			}
+		}
 	}()
-	return data.Url, nil
+	return url, nil
 }
 
 func (d *MongoDB) GetStats(abv string) (ShortUrl, error) {
 	ctx, cancel := newContext()
 	defer cancel()
 	collection := d.client.Database(dbName).Collection(collectionName)
-	m := bson.M{abvFieldName: abv}
-	result := collection.FindOne(ctx, m)
+	m := d.byAbv(abv)
+	// hourly buckets can get large and are only read through GetHourlyHits
+	opts := options.FindOne().SetProjection(bson.M{hourlyHitsFieldName: 0})
+	result := collection.FindOne(ctx, m, opts)
 
 	if result.Err() != nil {
 		log.Printf("error getting stats %v", result.Err())
 		return ShortUrl{}, nil
 	}
 
-	var data ShortUrl
-	if err := result.Decode(&data); err != nil {
+	var doc linkDoc
+	if err := result.Decode(&doc); err != nil {
 		return ShortUrl{}, fmt.Errorf("error decoding return %s: %v", abv, result.Err())
 	}
+	data := doc.ShortUrl
+	data.Protected = doc.Password != ""
+	slices.Sort(data.Tags) // $addToSet appends
+
+	referrers, err := d.findReferrers(ctx, abv)
+	if err != nil {
+		log.Printf("error getting referrers %v", err)
+	}
+	data.ReferrerHits = referrers
+
+	sketches, err := d.findSketches(ctx, d.byAbv(abv))
+	if err != nil {
+		log.Printf("error getting visitor sketches %v", err)
+		return data, nil
+	}
+	fillUniques(&data, sketches)
 
 	return data, nil
 }
 
+func (d *MongoDB) FindLink(names []string) (Link, error) {
+	if len(names) == 0 {
+		return Link{}, nil
+	}
+	links, err := d.findLinks(bson.M{domainFieldName: d.domain, abvFieldName: bson.M{"$in": names}}, 0)
+	if err != nil {
+		return Link{}, err
+	}
+	found := make(map[string]string, len(links))
+	for _, link := range links {
+		found[link.Abbreviation] = link.Url
+	}
+	return firstLink(names, found), nil
+}
+
+func (d *MongoDB) SearchLinks(prefix string, limit int) ([]Link, error) {
+	return d.findLinks(bson.M{domainFieldName: d.domain, abvFieldName: bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)}}, limit)
+}
+
+// findLinks returns up to limit links matching filter ordered by name, all of them when limit is 0
+func (d *MongoDB) findLinks(filter bson.M, limit int) ([]Link, error) {
+	ctx, cancel := newContext()
+	defer cancel()
+	collection := d.client.Database(dbName).Collection(collectionName)
+	opts := options.Find().
+		SetSort(bson.D{{Key: abvFieldName, Value: 1}}).
+		SetLimit(int64(limit)).
+		SetProjection(bson.M{abvFieldName: 1, urlFieldName: 1, passwordFieldName: 1})
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error finding links: %v", err)
+	}
+	var docs []linkDoc
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("error decoding links: %v", err)
+	}
+	links := make([]Link, 0, len(docs))
+	for _, doc := range docs {
+		links = append(links, Link{Abbreviation: doc.Abbreviation, Url: doc.Url, Protected: doc.Password != ""})
+	}
+	return links, nil
+}
+
+func (d *MongoDB) SetBlocked(abv, reason string) error {
+	ctx, cancel := newContext()
+	defer cancel()
+	collection := d.client.Database(dbName).Collection(collectionName)
+	update := bson.M{"$set": bson.M{blockedFieldName: reason}}
+	if reason == "" {
+		update = bson.M{"$unset": bson.M{blockedFieldName: ""}}
+	}
+	if _, err := collection.UpdateOne(ctx, d.byAbv(abv), update); err != nil {
+		return fmt.Errorf("couldn't block abbreviation %s: %v", abv, err)
+	}
+	return nil
+}
+
+func (d *MongoDB) SetOptions(abv string, linkOptions Options) error {
+	ctx, cancel := newContext()
+	defer cancel()
+	collection := d.client.Database(dbName).Collection(collectionName)
+	update := bson.M{"$set": bson.M{optionsFieldName: linkOptions}}
+	if linkOptions.IsZero() {
+		update = bson.M{"$unset": bson.M{optionsFieldName: ""}}
+	}
+	if _, err := collection.UpdateOne(ctx, d.byAbv(abv), update); err != nil {
+		return fmt.Errorf("couldn't set options of %s: %v", abv, err)
+	}
+	return nil
+}
+
+func (d *MongoDB) GetOptions(abv string) (Options, error) {
+	ctx, cancel := newContext()
+	defer cancel()
+	collection := d.client.Database(dbName).Collection(collectionName)
+	opts := options.FindOne().SetProjection(bson.M{optionsFieldName: 1})
+	result := collection.FindOne(ctx, d.byAbv(abv), opts)
+
+	if result.Err() != nil {
+		if result.Err() == mongo.ErrNoDocuments {
+			return Options{}, nil
+		}
+		return Options{}, fmt.Errorf("error getting options of %s: %v", abv, result.Err())
+	}
+
+	var data ShortUrl
+	if err := result.Decode(&data); err != nil {
+		return Options{}, fmt.Errorf("error decoding options of %s: %v", abv, err)
+	}
+	if data.Options == nil {
+		return Options{}, nil
+	}
+	return *data.Options, nil
+}
+
+func (d *MongoDB) SetPassword(abv, hash string) error {
+	ctx, cancel := newContext()
+	defer cancel()
+	collection := d.client.Database(dbName).Collection(collectionName)
+	update := bson.M{"$set": bson.M{passwordFieldName: hash}}
+	if hash == "" {
+		update = bson.M{"$unset": bson.M{passwordFieldName: ""}}
+	}
+	if _, err := collection.UpdateOne(ctx, d.byAbv(abv), update); err != nil {
+		return fmt.Errorf("couldn't set password of %s: %v", abv, err)
+	}
+	return nil
+}
+
+func (d *MongoDB) AddTags(abv string, tags []string) error {
+	ctx, cancel := newContext()
+	defer cancel()
+	collection := d.client.Database(dbName).Collection(collectionName)
+	update := bson.M{"$addToSet": bson.M{tagsFieldName: bson.M{"$each": tags}}}
+	if _, err := collection.UpdateOne(ctx, d.byAbv(abv), update); err != nil {
+		return fmt.Errorf("couldn't tag %s: %v", abv, err)
+	}
+	return nil
+}
+
+func (d *MongoDB) RemoveTags(abv string, tags []string) error {
+	ctx, cancel := newContext()
+	defer cancel()
+	collection := d.client.Database(dbName).Collection(collectionName)
+	update := bson.M{"$pull": bson.M{tagsFieldName: bson.M{"$in": tags}}}
+	if _, err := collection.UpdateOne(ctx, d.byAbv(abv), update); err != nil {
+		return fmt.Errorf("couldn't untag %s: %v", abv, err)
+	}
+	return nil
+}
+
+func (d *MongoDB) SetCollection(abv, name string) error {
+	ctx, cancel := newContext()
+	defer cancel()
+	collection := d.client.Database(dbName).Collection(collectionName)
+	update := bson.M{"$set": bson.M{collectionFieldName: name}}
+	if name == "" {
+		update = bson.M{"$unset": bson.M{collectionFieldName: ""}}
+	}
+	if _, err := collection.UpdateOne(ctx, d.byAbv(abv), update); err != nil {
+		return fmt.Errorf("couldn't set collection of %s: %v", abv, err)
+	}
+	return nil
+}
+
+// byGroup returns the filter matching the links of group
+func (d *MongoDB) byGroup(group Group) bson.M {
+	if group.Kind == CollectionGroup {
+		return bson.M{domainFieldName: d.domain, collectionFieldName: group.Name}
+	}
+	return bson.M{domainFieldName: d.domain, tagsFieldName: group.Name}
+}
+
+func (d *MongoDB) GetGroupLinks(group Group, limit int) ([]Link, error) {
+	return d.findLinks(d.byGroup(group), limit)
+}
+
+func (d *MongoDB) GetGroupStats(group Group, from, to string, limit int) (GroupStats, error) {
+	ctx, cancel := newContext()
+	defer cancel()
+	collection := d.client.Database(dbName).Collection(collectionName)
+	opts := options.Find().SetProjection(bson.M{abvFieldName: 1, urlFieldName: 1, hitsFieldName: 1, dailyHitsFieldName: 1})
+	cursor, err := collection.Find(ctx, d.byGroup(group), opts)
+	if err != nil {
+		return GroupStats{}, fmt.Errorf("error finding links of %s %s: %v", group.Kind, group.Name, err)
+	}
+	var docs []ShortUrl
+	if err := cursor.All(ctx, &docs); err != nil {
+		return GroupStats{}, fmt.Errorf("error decoding links of %s %s: %v", group.Kind, group.Name, err)
+	}
+
+	links := make([]groupLink, 0, len(docs))
+	for _, doc := range docs {
+		links = append(links, groupLink{abv: doc.Abbreviation, url: doc.Url, hits: int(doc.Hits), dailyHits: doc.DailyHits})
+	}
+	return summarizeGroup(d.domain, links, from, to, limit), nil
+}
+
+func (d *MongoDB) GetPassword(abv string) (string, error) {
+	ctx, cancel := newContext()
+	defer cancel()
+	collection := d.client.Database(dbName).Collection(collectionName)
+	opts := options.FindOne().SetProjection(bson.M{passwordFieldName: 1})
+	result := collection.FindOne(ctx, d.byAbv(abv), opts)
+
+	if result.Err() != nil {
+		if result.Err() == mongo.ErrNoDocuments {
+			return "", nil
+		}
+		return "", fmt.Errorf("error getting password of %s: %v", abv, result.Err())
+	}
+
+	var doc linkDoc
+	if err := result.Decode(&doc); err != nil {
+		return "", fmt.Errorf("error decoding password of %s: %v", abv, err)
+	}
+	return doc.Password, nil
+}
+
+func (d *MongoDB) SetHealth(abv string, health Health) error {
+	ctx, cancel := newContext()
+	defer cancel()
+	collection := d.client.Database(dbName).Collection(collectionName)
+	update := bson.M{"$set": bson.M{healthFieldName: health}}
+	if _, err := collection.UpdateOne(ctx, d.byAbv(abv), update); err != nil {
+		return fmt.Errorf("couldn't record health of %s: %v", abv, err)
+	}
+	return nil
+}
+
+func (d *MongoDB) GetLinksToCheck(checkedBefore time.Time, limit int) ([]LinkHealth, error) {
+	filter := bson.M{
+		blockedFieldName: bson.M{"$in": bson.A{nil, ""}},
+		"$or": bson.A{
+			bson.M{healthFieldName: bson.M{"$exists": false}},
+			bson.M{healthFieldName + ".checked": bson.M{"$lt": checkedBefore}},
+		},
+	}
+	// missing check times sort first
+	sort := bson.D{{Key: healthFieldName + ".checked", Value: 1}, {Key: abvFieldName, Value: 1}, {Key: domainFieldName, Value: 1}}
+	links, err := d.findLinkHealth(filter, sort, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error getting links to check: %v", err)
+	}
+	return links, nil
+}
+
+func (d *MongoDB) GetUnhealthy(limit int) ([]LinkHealth, error) {
+	filter := bson.M{domainFieldName: d.domain, healthFieldName + ".failures": bson.M{"$gt": 0}}
+	sort := bson.D{
+		{Key: healthFieldName + ".dead", Value: -1},
+		{Key: healthFieldName + ".failures", Value: -1},
+		{Key: abvFieldName, Value: 1},
+	}
+	links, err := d.findLinkHealth(filter, sort, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error getting unhealthy links: %v", err)
+	}
+	return links, nil
+}
+
+func (d *MongoDB) GetDeadLinks(limit int) ([]LinkHealth, error) {
+	filter := bson.M{healthFieldName + ".dead": true}
+	sort := bson.D{
+		{Key: healthFieldName + ".failures", Value: -1},
+		{Key: abvFieldName, Value: 1},
+		{Key: domainFieldName, Value: 1},
+	}
+	links, err := d.findLinkHealth(filter, sort, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error getting dead links: %v", err)
+	}
+	return links, nil
+}
+
+func (d *MongoDB) findLinkHealth(filter bson.M, sort bson.D, limit int) ([]LinkHealth, error) {
+	ctx, cancel := newContext()
+	defer cancel()
+	collection := d.client.Database(dbName).Collection(collectionName)
+	opts := options.Find().
+		SetSort(sort).
+		SetLimit(int64(limit)).
+		SetProjection(bson.M{domainFieldName: 1, abvFieldName: 1, urlFieldName: 1, healthFieldName: 1, passwordFieldName: 1})
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var docs []linkDoc
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	links := make([]LinkHealth, 0, len(docs))
+	for _, doc := range docs {
+		lh := LinkHealth{Domain: doc.Domain, Abbreviation: doc.Abbreviation, Url: doc.Url, Protected: doc.Password != ""}
+		if doc.Health != nil {
+			lh.Health = *doc.Health
+		}
+		links = append(links, lh)
+	}
+	return links, nil
+}
+
+func (d *MongoDB) SetMetadata(abv string, metadata Metadata) error {
+	ctx, cancel := newContext()
+	defer cancel()
+	collection := d.client.Database(dbName).Collection(collectionName)
+	update := bson.M{"$set": bson.M{metadataFieldName: metadata}}
+	if _, err := collection.UpdateOne(ctx, d.byAbv(abv), update); err != nil {
+		return fmt.Errorf("couldn't store metadata of %s: %v", abv, err)
+	}
+	return nil
+}
+
+func (d *MongoDB) GetStaleMetadata(fetchedBefore time.Time, limit int) ([]LinkMetadata, error) {
+	ctx, cancel := newContext()
+	defer cancel()
+	collection := d.client.Database(dbName).Collection(collectionName)
+	filter := bson.M{
+		blockedFieldName: bson.M{"$in": bson.A{nil, ""}},
+		"$or": bson.A{
+			bson.M{metadataFieldName: bson.M{"$exists": false}},
+			bson.M{metadataFieldName + ".fetched": bson.M{"$lt": fetchedBefore}},
+		},
+	}
+	// missing fetch times sort first
+	opts := options.Find().
+		SetSort(bson.D{{Key: metadataFieldName + ".fetched", Value: 1}, {Key: abvFieldName, Value: 1}, {Key: domainFieldName, Value: 1}}).
+		SetLimit(int64(limit)).
+		SetProjection(bson.M{domainFieldName: 1, abvFieldName: 1, urlFieldName: 1, metadataFieldName: 1})
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error getting links with stale metadata: %v", err)
+	}
+	var docs []ShortUrl
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("error decoding links with stale metadata: %v", err)
+	}
+	links := make([]LinkMetadata, 0, len(docs))
+	for _, su := range docs {
+		lm := LinkMetadata{Domain: su.Domain, Abbreviation: su.Abbreviation, Url: su.Url}
+		if su.Metadata != nil {
+			lm.Metadata = *su.Metadata
+		}
+		links = append(links, lm)
+	}
+	return links, nil
+}
+
+func (d *MongoDB) CountUniques(abv string, buckets [][]string) ([]int64, error) {
+	first, last, ok := dateRange(buckets)
+	if !ok {
+		return countBuckets(nil, buckets), nil
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+	filter := bson.M{
+		domainFieldName: d.domain,
+		abvFieldName:    abv,
+		periodFieldName: bson.M{"$gte": first, "$lte": last},
+	}
+	sketches, err := d.findSketches(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("error counting uniques for %s: %v", abv, err)
+	}
+	return countBuckets(sketches, buckets), nil
+}
+
+func (d *MongoDB) GetHourlyHits(abv string, from, to time.Time) (map[time.Time]int, error) {
+	ctx, cancel := newContext()
+	defer cancel()
+	collection := d.client.Database(dbName).Collection(collectionName)
+	m := d.byAbv(abv)
+	opts := options.FindOne().SetProjection(bson.M{hourlyHitsFieldName: 1})
+	result := collection.FindOne(ctx, m, opts)
+
+	hits := make(map[time.Time]int)
+	if result.Err() != nil {
+		if result.Err() == mongo.ErrNoDocuments {
+			return hits, nil
+		}
+		return nil, fmt.Errorf("error getting hourly hits for %s: %v", abv, result.Err())
+	}
+
+	var data struct {
+		HourlyHits map[string]int `bson:"hourly_hits"`
+	}
+	if err := result.Decode(&data); err != nil {
+		return nil, fmt.Errorf("error decoding hourly hits for %s: %v", abv, err)
+	}
+
+	for key, count := range data.HourlyHits {
+		hour, err := time.Parse(hourLayout, key)
+		if err != nil {
+			continue
+		}
+		if !hour.Before(from) && hour.Before(to) {
+			hits[hour] = count
+		}
+	}
+	return hits, nil
+}
+
 func (d *MongoDB) GetAbv(url string) (string, error) {
 	ctx, cancel := newContext()
 	defer cancel()
 	collection := d.client.Database(dbName).Collection(collectionName)
-	m := bson.M{urlFieldName: url}
+	m := bson.M{domainFieldName: d.domain, urlFieldName: url}
 	result := collection.FindOne(ctx, m)
 
 	if result.Err() != nil {
@@ -193,3 +958,186 @@ func (d *MongoDB) GetAbv(url string) (string, error) {
 
 	return data.Abbreviation, nil
 }
+
+func (d *MongoDB) GetGlobalStats(from, to string, limit int) (GlobalStats, error) {
+	priorFrom, _, err := PriorWindow(from, to)
+	if err != nil {
+		return GlobalStats{}, err
+	}
+	start, end := windowTimes(from, to)
+
+	ctx, cancel := newContext()
+	defer cancel()
+	collection := d.client.Database(dbName).Collection(collectionName)
+	dailyHits := d.client.Database(dbName).Collection(dailyHitsCollectionName)
+
+	inDays := func(first, last string) bson.D {
+		return bson.D{{Key: "$match", Value: bson.D{
+			{Key: domainFieldName, Value: d.domain},
+			{Key: dayFieldName, Value: bson.D{{Key: "$gte", Value: first}, {Key: "$lte", Value: last}}},
+		}}}
+	}
+	groupByLink := func(hits, priorHits any) bson.D {
+		return bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$" + abvFieldName},
+			{Key: "hits", Value: bson.D{{Key: "$sum", Value: hits}}},
+			{Key: "prior_hits", Value: bson.D{{Key: "$sum", Value: priorHits}}},
+		}}}
+	}
+	inWindow := bson.D{{Key: "$gte", Value: bson.A{"$" + dayFieldName, from}}}
+
+	var stats GlobalStats
+
+	hitsPerDay := mongo.Pipeline{
+		inDays(from, to),
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$" + dayFieldName},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: "$" + hitsFieldName}}},
+		}}},
+	}
+	if stats.HitsPerDay, err = aggregateDayCounts(ctx, dailyHits, hitsPerDay); err != nil {
+		return GlobalStats{}, fmt.Errorf("error getting hits per day: %v", err)
+	}
+
+	// links don't store when they were created, but their generated ids do
+	createdPerDay := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: domainFieldName, Value: d.domain}, {Key: "_id", Value: bson.D{
+			{Key: "$gte", Value: bson.NewObjectIDFromTimestamp(start)},
+			{Key: "$lt", Value: bson.NewObjectIDFromTimestamp(end)},
+		}}}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{{Key: "$dateToString", Value: bson.D{
+				{Key: "format", Value: "%Y-%m-%d"},
+				{Key: "date", Value: bson.D{{Key: "$toDate", Value: "$_id"}}},
+			}}}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+	}
+	if stats.CreatedPerDay, err = aggregateDayCounts(ctx, collection, createdPerDay); err != nil {
+		return GlobalStats{}, fmt.Errorf("error getting links created per day: %v", err)
+	}
+
+	topLinks := mongo.Pipeline{
+		inDays(from, to),
+		groupByLink("$"+hitsFieldName, 0),
+		{{Key: "$sort", Value: bson.D{{Key: "hits", Value: -1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$limit", Value: limit}},
+	}
+	if stats.TopLinks, err = d.aggregateLinkCounts(ctx, topLinks); err != nil {
+		return GlobalStats{}, fmt.Errorf("error getting top links: %v", err)
+	}
+
+	trending := mongo.Pipeline{
+		inDays(priorFrom, to),
+		groupByLink(
+			bson.D{{Key: "$cond", Value: bson.A{inWindow, "$" + hitsFieldName, 0}}},
+			bson.D{{Key: "$cond", Value: bson.A{inWindow, 0, "$" + hitsFieldName}}},
+		),
+		{{Key: "$set", Value: bson.D{{Key: "growth", Value: bson.D{{Key: "$subtract", Value: bson.A{"$hits", "$prior_hits"}}}}}}},
+		{{Key: "$match", Value: bson.D{{Key: "growth", Value: bson.D{{Key: "$gt", Value: 0}}}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "growth", Value: -1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$limit", Value: limit}},
+	}
+	if stats.Trending, err = d.aggregateLinkCounts(ctx, trending); err != nil {
+		return GlobalStats{}, fmt.Errorf("error getting trending links: %v", err)
+	}
+
+	neverClicked := bson.M{domainFieldName: d.domain, hitsFieldName: 0}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetLimit(int64(limit)).
+		SetProjection(bson.M{domainFieldName: 1, abvFieldName: 1, urlFieldName: 1})
+	cursor, err := collection.Find(ctx, neverClicked, opts)
+	if err != nil {
+		return GlobalStats{}, fmt.Errorf("error getting never clicked links: %v", err)
+	}
+	var links []ShortUrl
+	if err := cursor.All(ctx, &links); err != nil {
+		return GlobalStats{}, fmt.Errorf("error decoding never clicked links: %v", err)
+	}
+	stats.NeverClicked = make([]LinkCount, 0, len(links))
+	for _, su := range links {
+		stats.NeverClicked = append(stats.NeverClicked, LinkCount{Domain: su.Domain, Abbreviation: su.Abbreviation, Url: su.Url})
+	}
+	total, err := collection.CountDocuments(ctx, neverClicked)
+	if err != nil {
+		return GlobalStats{}, fmt.Errorf("error counting never clicked links: %v", err)
+	}
+	stats.NeverClickedTotal = int(total)
+
+	return stats, nil
+}
+
+// aggregateDayCounts runs a pipeline producing {_id: date, count} documents
+func aggregateDayCounts(ctx context.Context, collection *mongo.Collection, pipeline mongo.Pipeline) (map[string]int, error) {
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		Day   string `bson:"_id"`
+		Count int    `bson:"count"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.Day] = row.Count
+	}
+	return counts, nil
+}
+
+// aggregateLinkCounts runs a pipeline over the daily hits producing {_id: abv, hits, prior_hits} documents, and
+// looks up the urls of the links
+func (d *MongoDB) aggregateLinkCounts(ctx context.Context, pipeline mongo.Pipeline) ([]LinkCount, error) {
+	cursor, err := d.client.Database(dbName).Collection(dailyHitsCollectionName).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		Abbreviation string `bson:"_id"`
+		Hits         int    `bson:"hits"`
+		PriorHits    int    `bson:"prior_hits"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	links := make([]LinkCount, 0, len(rows))
+	if len(rows) == 0 {
+		return links, nil
+	}
+
+	abvs := make([]string, len(rows))
+	for i, row := range rows {
+		abvs[i] = row.Abbreviation
+	}
+	filter := bson.M{domainFieldName: d.domain, abvFieldName: bson.M{"$in": abvs}}
+	opts := options.Find().SetProjection(bson.M{abvFieldName: 1, urlFieldName: 1})
+	cursor, err = d.client.Database(dbName).Collection(collectionName).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var docs []ShortUrl
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	urls := make(map[string]string, len(docs))
+	for _, doc := range docs {
+		urls[doc.Abbreviation] = doc.Url
+	}
+
+	for _, row := range rows {
+		links = append(links, LinkCount{
+			Domain:       d.domain,
+			Abbreviation: row.Abbreviation,
+			Url:          urls[row.Abbreviation],
+			Hits:         row.Hits,
+			PriorHits:    row.PriorHits,
+		})
+	}
+	return links, nil
+}
@@ -9,11 +9,13 @@ import (
 	"time"
 
 	"github.com/ericfialkowski/shorturl/env"
+	"github.com/ericfialkowski/shorturl/hll"
 	_ "github.com/go-sql-driver/mysql"
 )
 
 type MySQLDB struct {
-	db *sql.DB
+	db     *sql.DB
+	domain string
 }
 
 func newMySQLContext() (context.Context, context.CancelFunc) {
@@ -63,12 +65,18 @@ func (d *MySQLDB) initSchema() {
 	createTableSQL := `
 		CREATE TABLE IF NOT EXISTS short_urls (
 			id INT AUTO_INCREMENT PRIMARY KEY,
-			abbreviation VARCHAR(50) NOT NULL UNIQUE,
+			domain VARCHAR(191) NOT NULL DEFAULT '',
+			abbreviation VARCHAR(50) NOT NULL,
 			url TEXT NOT NULL,
 			hits INT NOT NULL DEFAULT 0,
 			last_access DATETIME,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			UNIQUE KEY idx_url (url(255))
+			blocked VARCHAR(255) NOT NULL DEFAULT '',
+			options TEXT,
+			password TEXT,
+			collection VARCHAR(64) NOT NULL DEFAULT '',
+			UNIQUE KEY idx_domain_abbreviation (domain, abbreviation),
+			UNIQUE KEY idx_domain_url (domain, url(255))
 		)
 	`
 
@@ -76,6 +84,35 @@ func (d *MySQLDB) initSchema() {
 		log.Printf("Error creating short_urls table: %v", err)
 	}
 
+	// Add the columns introduced since short_urls was first created, which fails harmlessly when they exist
+	if _, err := d.db.ExecContext(ctx, `ALTER TABLE short_urls ADD COLUMN blocked VARCHAR(255) NOT NULL DEFAULT ''`); err != nil && !strings.Contains(err.Error(), "Duplicate column name") {
+		log.Printf("Error adding blocked column: %v", err)
+	}
+	if _, err := d.db.ExecContext(ctx, `ALTER TABLE short_urls ADD COLUMN options TEXT`); err != nil && !strings.Contains(err.Error(), "Duplicate column name") {
+		log.Printf("Error adding options column: %v", err)
+	}
+	if _, err := d.db.ExecContext(ctx, `ALTER TABLE short_urls ADD COLUMN password TEXT`); err != nil && !strings.Contains(err.Error(), "Duplicate column name") {
+		log.Printf("Error adding password column: %v", err)
+	}
+	if _, err := d.db.ExecContext(ctx, `ALTER TABLE short_urls ADD COLUMN domain VARCHAR(191) NOT NULL DEFAULT ''`); err != nil && !strings.Contains(err.Error(), "Duplicate column name") {
+		log.Printf("Error adding domain column: %v", err)
+	}
+	if _, err := d.db.ExecContext(ctx, `ALTER TABLE short_urls ADD COLUMN collection VARCHAR(64) NOT NULL DEFAULT ''`); err != nil && !strings.Contains(err.Error(), "Duplicate column name") {
+		log.Printf("Error adding collection column: %v", err)
+	}
+
+	// Names and URLs used to be unique on their own, now they're unique within a domain
+	for _, stmt := range []string{
+		`ALTER TABLE short_urls ADD UNIQUE KEY idx_domain_abbreviation (domain, abbreviation)`,
+		`ALTER TABLE short_urls ADD UNIQUE KEY idx_domain_url (domain, url(255))`,
+		`ALTER TABLE short_urls DROP INDEX abbreviation`,
+		`ALTER TABLE short_urls DROP INDEX idx_url`,
+	} {
+		if _, err := d.db.ExecContext(ctx, stmt); err != nil && !strings.Contains(err.Error(), "Duplicate key name") && !strings.Contains(err.Error(), "check that column/key exists") {
+			log.Printf("Error adding domains: %v", err)
+		}
+	}
+
 	// Create index on abbreviation
 	createAbvIndex := `CREATE INDEX IF NOT EXISTS idx_short_urls_abbreviation ON short_urls(abbreviation)`
 	if _, err := d.db.ExecContext(ctx, createAbvIndex); err != nil {
@@ -85,6 +122,37 @@ func (d *MySQLDB) initSchema() {
 		}
 	}
 
+	// Create index on creation time for the global analytics
+	createCreatedAtIndex := `CREATE INDEX idx_short_urls_created_at ON short_urls(created_at)`
+	if _, err := d.db.ExecContext(ctx, createCreatedAtIndex); err != nil {
+		if !strings.Contains(err.Error(), "Duplicate key name") {
+			log.Printf("Error creating created_at index: %v", err)
+		}
+	}
+
+	// Create index on collection for listing and summarizing collections
+	createCollectionIndex := `CREATE INDEX idx_short_urls_collection ON short_urls(domain, collection)`
+	if _, err := d.db.ExecContext(ctx, createCollectionIndex); err != nil {
+		if !strings.Contains(err.Error(), "Duplicate key name") {
+			log.Printf("Error creating collection index: %v", err)
+		}
+	}
+
+	// Create the link_tags table for the tags of each link
+	createLinkTagsSQL := `
+		CREATE TABLE IF NOT EXISTS link_tags (
+			short_url_id INT NOT NULL,
+			tag VARCHAR(64) NOT NULL,
+			PRIMARY KEY (short_url_id, tag),
+			KEY idx_tag (tag),
+			FOREIGN KEY (short_url_id) REFERENCES short_urls(id) ON DELETE CASCADE
+		)
+	`
+
+	if _, err := d.db.ExecContext(ctx, createLinkTagsSQL); err != nil {
+		log.Printf("Error creating link_tags table: %v", err)
+	}
+
 	// Create the daily_hits table for tracking hits per day
 	createDailyHitsSQL := `
 		CREATE TABLE IF NOT EXISTS daily_hits (
@@ -100,6 +168,143 @@ func (d *MySQLDB) initSchema() {
 	if _, err := d.db.ExecContext(ctx, createDailyHitsSQL); err != nil {
 		log.Printf("Error creating daily_hits table: %v", err)
 	}
+
+	// Create the hourly_hits table for tracking hits per UTC hour
+	createHourlyHitsSQL := `
+		CREATE TABLE IF NOT EXISTS hourly_hits (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			short_url_id INT NOT NULL,
+			hit_hour DATETIME NOT NULL,
+			hits INT NOT NULL DEFAULT 0,
+			UNIQUE KEY idx_url_hour (short_url_id, hit_hour),
+			KEY idx_hourly_hits_hour (hit_hour),
+			FOREIGN KEY (short_url_id) REFERENCES short_urls(id) ON DELETE CASCADE
+		)
+	`
+
+	if _, err := d.db.ExecContext(ctx, createHourlyHitsSQL); err != nil {
+		log.Printf("Error creating hourly_hits table: %v", err)
+	}
+
+	// Create the geo_hits table for tracking hits per country and region
+	createGeoHitsSQL := `
+		CREATE TABLE IF NOT EXISTS geo_hits (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			short_url_id INT NOT NULL,
+			country VARCHAR(2) NOT NULL,
+			region VARCHAR(10) NOT NULL DEFAULT '',
+			hits INT NOT NULL DEFAULT 0,
+			UNIQUE KEY idx_url_geo (short_url_id, country, region),
+			FOREIGN KEY (short_url_id) REFERENCES short_urls(id) ON DELETE CASCADE
+		)
+	`
+
+	if _, err := d.db.ExecContext(ctx, createGeoHitsSQL); err != nil {
+		log.Printf("Error creating geo_hits table: %v", err)
+	}
+
+	// Create the referrer_hits table for tracking hits per referring host
+	createReferrerHitsSQL := `
+		CREATE TABLE IF NOT EXISTS referrer_hits (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			short_url_id INT NOT NULL,
+			referrer VARCHAR(255) NOT NULL,
+			hits INT NOT NULL DEFAULT 0,
+			UNIQUE KEY idx_url_referrer (short_url_id, referrer),
+			FOREIGN KEY (short_url_id) REFERENCES short_urls(id) ON DELETE CASCADE
+		)
+	`
+
+	if _, err := d.db.ExecContext(ctx, createReferrerHitsSQL); err != nil {
+		log.Printf("Error creating referrer_hits table: %v", err)
+	}
+
+	// Create the variant_hits table for tracking hits per A/B variant
+	createVariantHitsSQL := `
+		CREATE TABLE IF NOT EXISTS variant_hits (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			short_url_id INT NOT NULL,
+			variant VARCHAR(32) NOT NULL,
+			hits INT NOT NULL DEFAULT 0,
+			UNIQUE KEY idx_url_variant (short_url_id, variant),
+			FOREIGN KEY (short_url_id) REFERENCES short_urls(id) ON DELETE CASCADE
+		)
+	`
+
+	if _, err := d.db.ExecContext(ctx, createVariantHitsSQL); err != nil {
+		log.Printf("Error creating variant_hits table: %v", err)
+	}
+
+	// Create the bot_hits table for tracking crawler and unfurler hits per bot family
+	createBotHitsSQL := `
+		CREATE TABLE IF NOT EXISTS bot_hits (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			short_url_id INT NOT NULL,
+			family VARCHAR(50) NOT NULL,
+			hits INT NOT NULL DEFAULT 0,
+			UNIQUE KEY idx_url_family (short_url_id, family),
+			FOREIGN KEY (short_url_id) REFERENCES short_urls(id) ON DELETE CASCADE
+		)
+	`
+
+	if _, err := d.db.ExecContext(ctx, createBotHitsSQL); err != nil {
+		log.Printf("Error creating bot_hits table: %v", err)
+	}
+
+	// Create the visitor_sketches table for counting unique visitors per UTC day
+	createVisitorSketchesSQL := `
+		CREATE TABLE IF NOT EXISTS visitor_sketches (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			short_url_id INT NOT NULL,
+			period VARCHAR(10) NOT NULL,
+			sketch MEDIUMBLOB NOT NULL,
+			UNIQUE KEY idx_url_period (short_url_id, period),
+			FOREIGN KEY (short_url_id) REFERENCES short_urls(id) ON DELETE CASCADE
+		)
+	`
+
+	if _, err := d.db.ExecContext(ctx, createVisitorSketchesSQL); err != nil {
+		log.Printf("Error creating visitor_sketches table: %v", err)
+	}
+
+	// Create the link_health table for the last check of each destination
+	createLinkHealthSQL := `
+		CREATE TABLE IF NOT EXISTS link_health (
+			short_url_id INT PRIMARY KEY,
+			status INT NOT NULL DEFAULT 0,
+			error TEXT NOT NULL,
+			redirects TEXT NOT NULL,
+			checked DATETIME NOT NULL,
+			failures INT NOT NULL DEFAULT 0,
+			dead BOOLEAN NOT NULL DEFAULT FALSE,
+			INDEX idx_link_health_checked (checked),
+			FOREIGN KEY (short_url_id) REFERENCES short_urls(id) ON DELETE CASCADE
+		)
+	`
+
+	if _, err := d.db.ExecContext(ctx, createLinkHealthSQL); err != nil {
+		log.Printf("Error creating link_health table: %v", err)
+	}
+
+	// Create the link_metadata table for what was fetched from each destination
+	createLinkMetadataSQL := `
+		CREATE TABLE IF NOT EXISTS link_metadata (
+			short_url_id INT PRIMARY KEY,
+			title TEXT NOT NULL,
+			description TEXT NOT NULL,
+			image TEXT NOT NULL,
+			site_name TEXT NOT NULL,
+			favicon TEXT NOT NULL,
+			error TEXT NOT NULL,
+			fetched DATETIME NOT NULL,
+			INDEX idx_link_metadata_fetched (fetched),
+			FOREIGN KEY (short_url_id) REFERENCES short_urls(id) ON DELETE CASCADE
+		)
+	`
+
+	if _, err := d.db.ExecContext(ctx, createLinkMetadataSQL); err != nil {
+		log.Printf("Error creating link_metadata table: %v", err)
+	}
 }
 
 func (d *MySQLDB) Cleanup() {
@@ -117,13 +322,17 @@ func (d *MySQLDB) IsLikelyOk() bool {
 	return true
 }
 
+func (d *MySQLDB) ForDomain(domain string) ShortUrlDao {
+	return &MySQLDB{db: d.db, domain: domain}
+}
+
 func (d *MySQLDB) Save(abv string, url string) error {
 	ctx, cancel := newMySQLContext()
 	defer cancel()
 
-	sqlStmt := `INSERT IGNORE INTO short_urls (abbreviation, url, hits) VALUES (?, ?, 0)`
+	sqlStmt := `INSERT IGNORE INTO short_urls (domain, abbreviation, url, hits) VALUES (?, ?, ?, 0)`
 
-	result, err := d.db.ExecContext(ctx, sqlStmt, abv, url)
+	result, err := d.db.ExecContext(ctx, sqlStmt, d.domain, abv, url)
 	if err != nil {
 		if strings.Contains(err.Error(), "Duplicate entry") {
 			return nil // Treat duplicate as success
@@ -135,7 +344,7 @@ func (d *MySQLDB) Save(abv string, url string) error {
 	if rowsAffected == 0 {
 		// Check if it was a conflict on abbreviation vs url
 		var existingUrl string
-		err := d.db.QueryRowContext(ctx, "SELECT url FROM short_urls WHERE abbreviation = ?", abv).Scan(&existingUrl)
+		err := d.db.QueryRowContext(ctx, "SELECT url FROM short_urls WHERE domain = ? AND abbreviation = ?", d.domain, abv).Scan(&existingUrl)
 		if err == nil && existingUrl != url {
 			return fmt.Errorf("abbreviation %s already exists with different URL", abv)
 		}
@@ -144,12 +353,36 @@ func (d *MySQLDB) Save(abv string, url string) error {
 	return nil
 }
 
+func (d *MySQLDB) SaveAll(links []Link) error {
+	ctx, cancel := newMySQLContext()
+	defer cancel()
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("couldn't start saving links: %v", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	sqlStmt := `INSERT INTO short_urls (domain, abbreviation, url, hits) VALUES (?, ?, ?, 0)`
+	for _, link := range links {
+		if _, err := tx.ExecContext(ctx, sqlStmt, d.domain, link.Abbreviation, link.Url); err != nil {
+			return fmt.Errorf("couldn't store (%s, %s): %v", link.Abbreviation, link.Url, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("couldn't save links: %v", err)
+	}
+	return nil
+}
+
 func (d *MySQLDB) DeleteAbv(abv string) error {
 	ctx, cancel := newMySQLContext()
 	defer cancel()
 
-	sqlStmt := `DELETE FROM short_urls WHERE abbreviation = ?`
-	if _, err := d.db.ExecContext(ctx, sqlStmt, abv); err != nil {
+	sqlStmt := `DELETE FROM short_urls WHERE domain = ? AND abbreviation = ?`
+	if _, err := d.db.ExecContext(ctx, sqlStmt, d.domain, abv); err != nil {
 		return fmt.Errorf("couldn't delete abbreviation %s: %v", abv, err)
 	}
 	return nil
@@ -159,27 +392,50 @@ func (d *MySQLDB) DeleteUrl(url string) error {
 	ctx, cancel := newMySQLContext()
 	defer cancel()
 
-	sqlStmt := `DELETE FROM short_urls WHERE url = ?`
-	if _, err := d.db.ExecContext(ctx, sqlStmt, url); err != nil {
+	sqlStmt := `DELETE FROM short_urls WHERE domain = ? AND url = ?`
+	if _, err := d.db.ExecContext(ctx, sqlStmt, d.domain, url); err != nil {
 		return fmt.Errorf("couldn't delete URL %s: %v", url, err)
 	}
 	return nil
 }
 
 func (d *MySQLDB) GetUrl(abv string) (string, error) {
+	return unblocked(d.GetUrlWithHit(abv, NewHit()))
+}
+
+func (d *MySQLDB) LookupUrl(abv string) (string, error) {
+	_, url, err := d.lookupUrl(abv)
+	return url, err
+}
+
+// lookupUrl returns the id and url of abv, with a *BlockedError for blocked links
+func (d *MySQLDB) lookupUrl(abv string) (int, string, error) {
 	ctx, cancel := newMySQLContext()
 	defer cancel()
 
 	var url string
 	var shortUrlId int
-	sqlStmt := `SELECT id, url FROM short_urls WHERE abbreviation = ?`
-	err := d.db.QueryRowContext(ctx, sqlStmt, abv).Scan(&shortUrlId, &url)
+	var blocked string
+	sqlStmt := `SELECT id, url, blocked FROM short_urls WHERE domain = ? AND abbreviation = ?`
+	err := d.db.QueryRowContext(ctx, sqlStmt, d.domain, abv).Scan(&shortUrlId, &url, &blocked)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return "", nil
+			return 0, "", nil
 		}
-		return "", fmt.Errorf("error getting URL for %s: %v", abv, err)
+		return 0, "", fmt.Errorf("error getting URL for %s: %v", abv, err)
+	}
+
+	if blocked != "" {
+		return shortUrlId, url, &BlockedError{Abv: abv, Reason: blocked}
+	}
+	return shortUrlId, url, nil
+}
+
+func (d *MySQLDB) GetUrlWithHit(abv string, hit Hit) (string, error) {
+	shortUrlId, url, err := d.lookupUrl(abv)
+	if err != nil || url == "" {
+		return url, err
 	}
 
 	// Update stats asynchronously
@@ -187,33 +443,160 @@ func (d *MySQLDB) GetUrl(abv string) (string, error) {
 		ctx, cancel := newMySQLContext()
 		defer cancel()
 
+		// Bots only count towards the bot stats
+		if hit.Bot != "" {
+			botHitSQL := `
+				INSERT INTO bot_hits (short_url_id, family, hits)
+				VALUES (?, ?, 1)
+				ON DUPLICATE KEY UPDATE hits = hits + 1
+			`
+			if _, err := d.db.ExecContext(ctx, botHitSQL, shortUrlId, hit.Bot); err != nil {
+				log.Printf("Error updating bot_hits: %v", err)
+			}
+			return
+		}
+
 		// Update total hits and last_access in short_urls
-		updateSQL := `UPDATE short_urls SET hits = hits + 1, last_access = NOW() WHERE id = ?`
-		if _, err := d.db.ExecContext(ctx, updateSQL, shortUrlId); err != nil {
+		updateSQL := `UPDATE short_urls SET hits = hits + 1, last_access = ? WHERE id = ?`
+		if _, err := d.db.ExecContext(ctx, updateSQL, hit.Time.UTC(), shortUrlId); err != nil {
 			log.Printf("Error updating short_urls stats: %v", err)
 		}
 
 		// Insert or update daily hit count
 		dailyHitSQL := `
 			INSERT INTO daily_hits (short_url_id, hit_date, hits)
-			VALUES (?, CURDATE(), 1)
+			VALUES (?, ?, 1)
 			ON DUPLICATE KEY UPDATE hits = hits + 1
 		`
-		if _, err := d.db.ExecContext(ctx, dailyHitSQL, shortUrlId); err != nil {
+		if _, err := d.db.ExecContext(ctx, dailyHitSQL, shortUrlId, hit.Date()); err != nil {
 			log.Printf("Error updating daily_hits: %v", err)
 		}
+
+		// Insert or update hourly hit count
+		hourlyHitSQL := `
+			INSERT INTO hourly_hits (short_url_id, hit_hour, hits)
+			VALUES (?, ?, 1)
+			ON DUPLICATE KEY UPDATE hits = hits + 1
+		`
+		if _, err := d.db.ExecContext(ctx, hourlyHitSQL, shortUrlId, hit.Hour()); err != nil {
+			log.Printf("Error updating hourly_hits: %v", err)
+		}
+
+		// Insert or update country/region hit count
+		if hit.Country != "" {
+			geoHitSQL := `
+				INSERT INTO geo_hits (short_url_id, country, region, hits)
+				VALUES (?, ?, ?, 1)
+				ON DUPLICATE KEY UPDATE hits = hits + 1
+			`
+			if _, err := d.db.ExecContext(ctx, geoHitSQL, shortUrlId, hit.Country, hit.Region); err != nil {
+				log.Printf("Error updating geo_hits: %v", err)
+			}
+		}
+
+		// Insert or update referrer hit count
+		if hit.Referrer != "" {
+			referrerHitSQL := `
+				INSERT INTO referrer_hits (short_url_id, referrer, hits)
+				VALUES (?, ?, 1)
+				ON DUPLICATE KEY UPDATE hits = hits + 1
+			`
+			if _, err := d.db.ExecContext(ctx, referrerHitSQL, shortUrlId, hit.Referrer); err != nil {
+				log.Printf("Error updating referrer_hits: %v", err)
+			}
+		}
+
+		// Insert or update the hit count of the A/B variant the visitor was sent to
+		if hit.Variant != "" {
+			variantHitSQL := `
+				INSERT INTO variant_hits (short_url_id, variant, hits)
+				VALUES (?, ?, 1)
+				ON DUPLICATE KEY UPDATE hits = hits + 1
+			`
+			if _, err := d.db.ExecContext(ctx, variantHitSQL, shortUrlId, hit.Variant); err != nil {
+				log.Printf("Error updating variant_hits: %v", err)
+			}
+		}
+
+		// Add the visitor to the day's sketch
+		if hit.Visitor != "" {
+			if err := d.addVisitor(ctx, shortUrlId, hit.Date(), hit.Visitor); err != nil {
+				log.Printf("Error updating visitor_sketches: %v", err)
+			}
+		}
 	}()
 
 	return url, nil
 }
 
+// addVisitor adds visitor to a stored sketch. Most visitors were counted already, so the sketch is read without a
+// lock, and only written when it changed and nobody else wrote it in between; otherwise it's read again.
+func (d *MySQLDB) addVisitor(ctx context.Context, shortUrlId int, period, visitor string) error {
+	selectSQL := `SELECT sketch FROM visitor_sketches WHERE short_url_id = ? AND period = ?`
+	insertSQL := `INSERT IGNORE INTO visitor_sketches (short_url_id, period, sketch) VALUES (?, ?, ?)`
+	updateSQL := `UPDATE visitor_sketches SET sketch = ? WHERE short_url_id = ? AND period = ? AND sketch = ?`
+
+	for range maxSketchRetries {
+		var data []byte
+		err := d.db.QueryRowContext(ctx, selectSQL, shortUrlId, period).Scan(&data)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		missing := err == sql.ErrNoRows
+
+		updated, err := addToSketch(data, visitor)
+		if err != nil || updated == nil {
+			return err
+		}
+
+		var result sql.Result
+		if missing {
+			result, err = d.db.ExecContext(ctx, insertSQL, shortUrlId, period, updated)
+		} else {
+			result, err = d.db.ExecContext(ctx, updateSQL, updated, shortUrlId, period, data)
+		}
+		if err != nil {
+			return err
+		}
+		if written, err := result.RowsAffected(); err != nil || written > 0 {
+			return err
+		}
+	}
+	return fmt.Errorf("too much contention updating visitor sketch %d/%s", shortUrlId, period)
+}
+
+// querySketches reads (period, sketch) rows into decoded sketches
+func (d *MySQLDB) querySketches(ctx context.Context, query string, args ...any) (map[string]*hll.Sketch, error) {
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	encoded := make(map[string][]byte)
+	for rows.Next() {
+		var period string
+		var data []byte
+		if err := rows.Scan(&period, &data); err != nil {
+			return nil, err
+		}
+		encoded[period] = data
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return parseSketches(encoded), nil
+}
+
 func (d *MySQLDB) GetAbv(url string) (string, error) {
 	ctx, cancel := newMySQLContext()
 	defer cancel()
 
 	var abv string
-	sqlStmt := `SELECT abbreviation FROM short_urls WHERE url = ?`
-	err := d.db.QueryRowContext(ctx, sqlStmt, url).Scan(&abv)
+	sqlStmt := `SELECT abbreviation FROM short_urls WHERE domain = ? AND url = ?`
+	err := d.db.QueryRowContext(ctx, sqlStmt, d.domain, url).Scan(&abv)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -233,19 +616,25 @@ func (d *MySQLDB) GetStats(abv string) (ShortUrl, error) {
 	var data ShortUrl
 	var shortUrlId int
 	var lastAccess sql.NullTime
+	var options string
 
 	// Get main short_url data
 	sqlStmt := `
-		SELECT id, abbreviation, url, hits, last_access
+		SELECT id, domain, abbreviation, url, hits, last_access, blocked, COALESCE(options, ''), COALESCE(password, '') <> '', collection
 		FROM short_urls
-		WHERE abbreviation = ?
+		WHERE domain = ? AND abbreviation = ?
 	`
-	err := d.db.QueryRowContext(ctx, sqlStmt, abv).Scan(
+	err := d.db.QueryRowContext(ctx, sqlStmt, d.domain, abv).Scan(
 		&shortUrlId,
+		&data.Domain,
 		&data.Abbreviation,
 		&data.Url,
 		&data.Hits,
 		&lastAccess,
+		&data.Blocked,
+		&options,
+		&data.Protected,
+		&data.Collection,
 	)
 
 	if err != nil {
@@ -256,10 +645,20 @@ func (d *MySQLDB) GetStats(abv string) (ShortUrl, error) {
 		return ShortUrl{}, fmt.Errorf("error getting stats for %s: %v", abv, err)
 	}
 
+	if o, err := parseOptions(options); err != nil {
+		log.Printf("Error reading options of %s: %v", abv, err)
+	} else {
+		data.Options = optionsPtr(o)
+	}
+
 	if lastAccess.Valid {
 		data.LastAccess = lastAccess.Time
 	}
 
+	if data.Tags, err = d.queryTags(ctx, shortUrlId); err != nil {
+		log.Printf("Error querying link_tags: %v", err)
+	}
+
 	// Get daily hits from separate table
 	data.DailyHits = make(map[string]int)
 	dailyHitsSQL := `
@@ -287,5 +686,753 @@ func (d *MySQLDB) GetStats(abv string) (ShortUrl, error) {
 		data.DailyHits[hitDate.Format("2006-01-02")] = hits
 	}
 
+	// Get country and region hits
+	data.CountryHits = make(map[string]int)
+	data.RegionHits = make(map[string]int)
+	geoHitsSQL := `
+		SELECT country, region, hits
+		FROM geo_hits
+		WHERE short_url_id = ?
+	`
+	geoRows, err := d.db.QueryContext(ctx, geoHitsSQL, shortUrlId)
+	if err != nil {
+		log.Printf("Error querying geo_hits: %v", err)
+		return data, nil
+	}
+	defer func() {
+		_ = geoRows.Close()
+	}()
+
+	for geoRows.Next() {
+		var country, region string
+		var hits int
+		if err := geoRows.Scan(&country, &region, &hits); err != nil {
+			log.Printf("Error scanning geo_hits row: %v", err)
+			continue
+		}
+		data.CountryHits[country] += hits
+		if region != "" {
+			data.RegionHits[region] += hits
+		}
+	}
+
+	// Get referrer hits
+	data.ReferrerHits = make(map[string]int)
+	referrerHitsSQL := `
+		SELECT referrer, hits
+		FROM referrer_hits
+		WHERE short_url_id = ?
+	`
+	refRows, err := d.db.QueryContext(ctx, referrerHitsSQL, shortUrlId)
+	if err != nil {
+		log.Printf("Error querying referrer_hits: %v", err)
+		return data, nil
+	}
+	defer func() {
+		_ = refRows.Close()
+	}()
+
+	for refRows.Next() {
+		var referrer string
+		var hits int
+		if err := refRows.Scan(&referrer, &hits); err != nil {
+			log.Printf("Error scanning referrer_hits row: %v", err)
+			continue
+		}
+		data.ReferrerHits[referrer] = hits
+	}
+
+	// Get A/B variant hits
+	data.VariantHits = make(map[string]int)
+	variantHitsSQL := `
+		SELECT variant, hits
+		FROM variant_hits
+		WHERE short_url_id = ?
+	`
+	variantRows, err := d.db.QueryContext(ctx, variantHitsSQL, shortUrlId)
+	if err != nil {
+		log.Printf("Error querying variant_hits: %v", err)
+		return data, nil
+	}
+	defer func() {
+		_ = variantRows.Close()
+	}()
+
+	for variantRows.Next() {
+		var variant string
+		var hits int
+		if err := variantRows.Scan(&variant, &hits); err != nil {
+			log.Printf("Error scanning variant_hits row: %v", err)
+			continue
+		}
+		data.VariantHits[variant] = hits
+	}
+
+	// Get bot hits per family
+	data.BotFamilies = make(map[string]int)
+	botHitsSQL := `
+		SELECT family, hits
+		FROM bot_hits
+		WHERE short_url_id = ?
+	`
+	botRows, err := d.db.QueryContext(ctx, botHitsSQL, shortUrlId)
+	if err != nil {
+		log.Printf("Error querying bot_hits: %v", err)
+		return data, nil
+	}
+	defer func() {
+		_ = botRows.Close()
+	}()
+
+	for botRows.Next() {
+		var family string
+		var hits int
+		if err := botRows.Scan(&family, &hits); err != nil {
+			log.Printf("Error scanning bot_hits row: %v", err)
+			continue
+		}
+		data.BotFamilies[family] = hits
+		data.BotHits += int32(hits)
+	}
+
+	// Get the last check of the destination
+	healthSQL := `
+		SELECT s.domain, s.abbreviation, s.url, COALESCE(s.password, '') <> '', h.status, h.error, h.redirects, h.checked, h.failures, h.dead
+		FROM link_health h
+		JOIN short_urls s ON s.id = h.short_url_id
+		WHERE h.short_url_id = ?
+	`
+	if health, err := d.queryLinkHealth(ctx, healthSQL, shortUrlId); err != nil {
+		log.Printf("Error querying link_health: %v", err)
+	} else if len(health) > 0 {
+		data.Health = &health[0].Health
+	}
+
+	// Get the metadata of the destination
+	metadataSQL := `
+		SELECT s.domain, s.abbreviation, s.url, m.title, m.description, m.image, m.site_name, m.favicon, m.error, m.fetched
+		FROM link_metadata m
+		JOIN short_urls s ON s.id = m.short_url_id
+		WHERE m.short_url_id = ?
+	`
+	if metadata, err := d.queryLinkMetadata(ctx, metadataSQL, shortUrlId); err != nil {
+		log.Printf("Error querying link_metadata: %v", err)
+	} else if len(metadata) > 0 {
+		data.Metadata = &metadata[0].Metadata
+	}
+
+	// Get unique visitor counts
+	sketches, err := d.querySketches(ctx, `SELECT period, sketch FROM visitor_sketches WHERE short_url_id = ?`, shortUrlId)
+	if err != nil {
+		log.Printf("Error querying visitor_sketches: %v", err)
+		return data, nil
+	}
+	fillUniques(&data, sketches)
+
 	return data, nil
 }
+
+func (d *MySQLDB) FindLink(names []string) (Link, error) {
+	if len(names) == 0 {
+		return Link{}, nil
+	}
+	ctx, cancel := newMySQLContext()
+	defer cancel()
+
+	args := []any{d.domain}
+	for _, name := range names {
+		args = append(args, name)
+	}
+	sqlStmt := `SELECT abbreviation, url FROM short_urls WHERE domain = ? AND abbreviation IN (?` + strings.Repeat(", ?", len(names)-1) + `)`
+	rows, err := d.db.QueryContext(ctx, sqlStmt, args...)
+	if err != nil {
+		return Link{}, fmt.Errorf("error finding links: %v", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	found := make(map[string]string)
+	for rows.Next() {
+		var abv, url string
+		if err := rows.Scan(&abv, &url); err != nil {
+			return Link{}, fmt.Errorf("error scanning link: %v", err)
+		}
+		found[abv] = url
+	}
+	return firstLink(names, found), rows.Err()
+}
+
+func (d *MySQLDB) SearchLinks(prefix string, limit int) ([]Link, error) {
+	ctx, cancel := newMySQLContext()
+	defer cancel()
+
+	sqlStmt := `SELECT abbreviation, url, COALESCE(password, '') <> '' FROM short_urls WHERE domain = ? AND abbreviation LIKE ? ESCAPE '!' ORDER BY abbreviation LIMIT ?`
+	rows, err := d.db.QueryContext(ctx, sqlStmt, d.domain, likePrefix(prefix), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error searching links: %v", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var links []Link
+	for rows.Next() {
+		var link Link
+		if err := rows.Scan(&link.Abbreviation, &link.Url, &link.Protected); err != nil {
+			return nil, fmt.Errorf("error scanning link: %v", err)
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+func (d *MySQLDB) SetBlocked(abv, reason string) error {
+	ctx, cancel := newMySQLContext()
+	defer cancel()
+
+	sqlStmt := `UPDATE short_urls SET blocked = ? WHERE domain = ? AND abbreviation = ?`
+	if _, err := d.db.ExecContext(ctx, sqlStmt, reason, d.domain, abv); err != nil {
+		return fmt.Errorf("couldn't block abbreviation %s: %v", abv, err)
+	}
+	return nil
+}
+
+func (d *MySQLDB) SetOptions(abv string, options Options) error {
+	ctx, cancel := newMySQLContext()
+	defer cancel()
+
+	sqlStmt := `UPDATE short_urls SET options = ? WHERE domain = ? AND abbreviation = ?`
+	if _, err := d.db.ExecContext(ctx, sqlStmt, optionsJSON(options), d.domain, abv); err != nil {
+		return fmt.Errorf("couldn't set options of %s: %v", abv, err)
+	}
+	return nil
+}
+
+func (d *MySQLDB) GetOptions(abv string) (Options, error) {
+	ctx, cancel := newMySQLContext()
+	defer cancel()
+
+	var options string
+	sqlStmt := `SELECT COALESCE(options, '') FROM short_urls WHERE domain = ? AND abbreviation = ?`
+	if err := d.db.QueryRowContext(ctx, sqlStmt, d.domain, abv).Scan(&options); err != nil {
+		if err == sql.ErrNoRows {
+			return Options{}, nil
+		}
+		return Options{}, fmt.Errorf("error getting options of %s: %v", abv, err)
+	}
+	return parseOptions(options)
+}
+
+func (d *MySQLDB) SetPassword(abv, hash string) error {
+	ctx, cancel := newMySQLContext()
+	defer cancel()
+
+	sqlStmt := `UPDATE short_urls SET password = ? WHERE domain = ? AND abbreviation = ?`
+	if _, err := d.db.ExecContext(ctx, sqlStmt, hash, d.domain, abv); err != nil {
+		return fmt.Errorf("couldn't set password of %s: %v", abv, err)
+	}
+	return nil
+}
+
+func (d *MySQLDB) AddTags(abv string, tags []string) error {
+	ctx, cancel := newMySQLContext()
+	defer cancel()
+
+	sqlStmt := `INSERT IGNORE INTO link_tags (short_url_id, tag) SELECT id, ? FROM short_urls WHERE domain = ? AND abbreviation = ?`
+	for _, tag := range tags {
+		if _, err := d.db.ExecContext(ctx, sqlStmt, tag, d.domain, abv); err != nil {
+			return fmt.Errorf("couldn't tag %s: %v", abv, err)
+		}
+	}
+	return nil
+}
+
+func (d *MySQLDB) RemoveTags(abv string, tags []string) error {
+	ctx, cancel := newMySQLContext()
+	defer cancel()
+
+	sqlStmt := `DELETE t FROM link_tags t JOIN short_urls s ON s.id = t.short_url_id WHERE t.tag = ? AND s.domain = ? AND s.abbreviation = ?`
+	for _, tag := range tags {
+		if _, err := d.db.ExecContext(ctx, sqlStmt, tag, d.domain, abv); err != nil {
+			return fmt.Errorf("couldn't untag %s: %v", abv, err)
+		}
+	}
+	return nil
+}
+
+func (d *MySQLDB) SetCollection(abv, collection string) error {
+	ctx, cancel := newMySQLContext()
+	defer cancel()
+
+	sqlStmt := `UPDATE short_urls SET collection = ? WHERE domain = ? AND abbreviation = ?`
+	if _, err := d.db.ExecContext(ctx, sqlStmt, collection, d.domain, abv); err != nil {
+		return fmt.Errorf("couldn't set collection of %s: %v", abv, err)
+	}
+	return nil
+}
+
+// queryTags returns the tags of the link with id shortUrlId, sorted
+func (d *MySQLDB) queryTags(ctx context.Context, shortUrlId int) ([]string, error) {
+	rows, err := d.db.QueryContext(ctx, `SELECT tag FROM link_tags WHERE short_url_id = ? ORDER BY tag`, shortUrlId)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+func (d *MySQLDB) GetGroupLinks(group Group, limit int) ([]Link, error) {
+	ctx, cancel := newMySQLContext()
+	defer cancel()
+
+	from, column := groupSource(group)
+	sqlStmt := `SELECT s.abbreviation, s.url, COALESCE(s.password, '') <> '' FROM ` + from + ` WHERE s.domain = ? AND ` + column + ` = ? ORDER BY s.abbreviation LIMIT ?`
+	rows, err := d.db.QueryContext(ctx, sqlStmt, d.domain, group.Name, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error listing links of %s %s: %v", group.Kind, group.Name, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	links := make([]Link, 0)
+	for rows.Next() {
+		var link Link
+		if err := rows.Scan(&link.Abbreviation, &link.Url, &link.Protected); err != nil {
+			return nil, fmt.Errorf("error scanning link: %v", err)
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+func (d *MySQLDB) GetGroupStats(group Group, from, to string, limit int) (GroupStats, error) {
+	ctx, cancel := newMySQLContext()
+	defer cancel()
+
+	source, column := groupSource(group)
+	rows, err := d.db.QueryContext(ctx, `SELECT s.id, s.abbreviation, s.url, s.hits FROM `+source+` WHERE s.domain = ? AND `+column+` = ?`, d.domain, group.Name)
+	if err != nil {
+		return GroupStats{}, fmt.Errorf("error getting links of %s %s: %v", group.Kind, group.Name, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	byId := make(map[int]*groupLink)
+	for rows.Next() {
+		var id int
+		link := groupLink{dailyHits: make(map[string]int)}
+		if err := rows.Scan(&id, &link.abv, &link.url, &link.hits); err != nil {
+			return GroupStats{}, fmt.Errorf("error scanning link: %v", err)
+		}
+		byId[id] = &link
+	}
+	if err := rows.Err(); err != nil {
+		return GroupStats{}, fmt.Errorf("error getting links of %s %s: %v", group.Kind, group.Name, err)
+	}
+
+	hitsSQL := `
+		SELECT s.id, DATE_FORMAT(h.hit_date, '%Y-%m-%d'), h.hits
+		FROM ` + source + `
+		JOIN daily_hits h ON h.short_url_id = s.id
+		WHERE s.domain = ? AND ` + column + ` = ? AND h.hit_date BETWEEN ? AND ?
+	`
+	hitRows, err := d.db.QueryContext(ctx, hitsSQL, d.domain, group.Name, from, to)
+	if err != nil {
+		return GroupStats{}, fmt.Errorf("error getting hits of %s %s: %v", group.Kind, group.Name, err)
+	}
+	defer func() { _ = hitRows.Close() }()
+
+	for hitRows.Next() {
+		var id, hits int
+		var date string
+		if err := hitRows.Scan(&id, &date, &hits); err != nil {
+			return GroupStats{}, fmt.Errorf("error scanning hits: %v", err)
+		}
+		if link, ok := byId[id]; ok {
+			link.dailyHits[date] += hits
+		}
+	}
+	if err := hitRows.Err(); err != nil {
+		return GroupStats{}, fmt.Errorf("error getting hits of %s %s: %v", group.Kind, group.Name, err)
+	}
+
+	links := make([]groupLink, 0, len(byId))
+	for _, link := range byId {
+		links = append(links, *link)
+	}
+	return summarizeGroup(d.domain, links, from, to, limit), nil
+}
+
+func (d *MySQLDB) GetPassword(abv string) (string, error) {
+	ctx, cancel := newMySQLContext()
+	defer cancel()
+
+	var hash string
+	sqlStmt := `SELECT COALESCE(password, '') FROM short_urls WHERE domain = ? AND abbreviation = ?`
+	if err := d.db.QueryRowContext(ctx, sqlStmt, d.domain, abv).Scan(&hash); err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", fmt.Errorf("error getting password of %s: %v", abv, err)
+	}
+	return hash, nil
+}
+
+func (d *MySQLDB) SetHealth(abv string, health Health) error {
+	ctx, cancel := newMySQLContext()
+	defer cancel()
+
+	sqlStmt := `
+		INSERT INTO link_health (short_url_id, status, error, redirects, checked, failures, dead)
+		SELECT id, ?, ?, ?, ?, ?, ? FROM short_urls WHERE domain = ? AND abbreviation = ?
+		ON DUPLICATE KEY UPDATE status = VALUES(status), error = VALUES(error), redirects = VALUES(redirects),
+			checked = VALUES(checked), failures = VALUES(failures), dead = VALUES(dead)
+	`
+	_, err := d.db.ExecContext(ctx, sqlStmt, health.Status, health.Error, redirectsJSON(health.Redirects),
+		health.Checked.UTC(), health.Failures, health.Dead, d.domain, abv)
+	if err != nil {
+		return fmt.Errorf("couldn't record health of %s: %v", abv, err)
+	}
+	return nil
+}
+
+func (d *MySQLDB) GetLinksToCheck(checkedBefore time.Time, limit int) ([]LinkHealth, error) {
+	ctx, cancel := newMySQLContext()
+	defer cancel()
+
+	sqlStmt := `
+		SELECT s.domain, s.abbreviation, s.url, COALESCE(s.password, '') <> '', h.status, h.error, h.redirects, h.checked, h.failures, h.dead
+		FROM short_urls s
+		LEFT JOIN link_health h ON h.short_url_id = s.id
+		WHERE s.blocked = '' AND (h.checked IS NULL OR h.checked < ?)
+		ORDER BY h.checked IS NOT NULL, h.checked, s.abbreviation, s.domain
+		LIMIT ?
+	`
+	links, err := d.queryLinkHealth(ctx, sqlStmt, checkedBefore.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error getting links to check: %v", err)
+	}
+	return links, nil
+}
+
+func (d *MySQLDB) GetUnhealthy(limit int) ([]LinkHealth, error) {
+	ctx, cancel := newMySQLContext()
+	defer cancel()
+
+	sqlStmt := `
+		SELECT s.domain, s.abbreviation, s.url, COALESCE(s.password, '') <> '', h.status, h.error, h.redirects, h.checked, h.failures, h.dead
+		FROM link_health h
+		JOIN short_urls s ON s.id = h.short_url_id
+		WHERE s.domain = ? AND h.failures > 0
+		ORDER BY h.dead DESC, h.failures DESC, s.abbreviation
+		LIMIT ?
+	`
+	links, err := d.queryLinkHealth(ctx, sqlStmt, d.domain, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error getting unhealthy links: %v", err)
+	}
+	return links, nil
+}
+
+func (d *MySQLDB) GetDeadLinks(limit int) ([]LinkHealth, error) {
+	ctx, cancel := newMySQLContext()
+	defer cancel()
+
+	sqlStmt := `
+		SELECT s.domain, s.abbreviation, s.url, COALESCE(s.password, '') <> '', h.status, h.error, h.redirects, h.checked, h.failures, h.dead
+		FROM link_health h
+		JOIN short_urls s ON s.id = h.short_url_id
+		WHERE h.dead
+		ORDER BY h.failures DESC, s.abbreviation, s.domain
+		LIMIT ?
+	`
+	links, err := d.queryLinkHealth(ctx, sqlStmt, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error getting dead links: %v", err)
+	}
+	return links, nil
+}
+
+// queryLinkHealth reads rows of domain, abbreviation, url, whether it's protected and the link_health columns, which are null for links never checked
+func (d *MySQLDB) queryLinkHealth(ctx context.Context, query string, args ...any) ([]LinkHealth, error) {
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	links := make([]LinkHealth, 0)
+	for rows.Next() {
+		var lh LinkHealth
+		var status, failures sql.NullInt64
+		var checkErr, redirects sql.NullString
+		var checked sql.NullTime
+		var dead sql.NullBool
+		if err := rows.Scan(&lh.Domain, &lh.Abbreviation, &lh.Url, &lh.Protected, &status, &checkErr, &redirects, &checked, &failures, &dead); err != nil {
+			return nil, err
+		}
+		lh.Health = Health{
+			Status:    int(status.Int64),
+			Error:     checkErr.String,
+			Redirects: parseRedirects(redirects.String),
+			Checked:   checked.Time,
+			Failures:  int(failures.Int64),
+			Dead:      dead.Bool,
+		}
+		links = append(links, lh)
+	}
+	return links, rows.Err()
+}
+
+func (d *MySQLDB) SetMetadata(abv string, metadata Metadata) error {
+	ctx, cancel := newMySQLContext()
+	defer cancel()
+
+	sqlStmt := `
+		INSERT INTO link_metadata (short_url_id, title, description, image, site_name, favicon, error, fetched)
+		SELECT id, ?, ?, ?, ?, ?, ?, ? FROM short_urls WHERE domain = ? AND abbreviation = ?
+		ON DUPLICATE KEY UPDATE title = VALUES(title), description = VALUES(description), image = VALUES(image),
+			site_name = VALUES(site_name), favicon = VALUES(favicon), error = VALUES(error), fetched = VALUES(fetched)
+	`
+	_, err := d.db.ExecContext(ctx, sqlStmt, metadata.Title, metadata.Description, metadata.Image, metadata.SiteName,
+		metadata.Favicon, metadata.Error, metadata.Fetched.UTC(), d.domain, abv)
+	if err != nil {
+		return fmt.Errorf("couldn't store metadata of %s: %v", abv, err)
+	}
+	return nil
+}
+
+func (d *MySQLDB) GetStaleMetadata(fetchedBefore time.Time, limit int) ([]LinkMetadata, error) {
+	ctx, cancel := newMySQLContext()
+	defer cancel()
+
+	sqlStmt := `
+		SELECT s.domain, s.abbreviation, s.url, m.title, m.description, m.image, m.site_name, m.favicon, m.error, m.fetched
+		FROM short_urls s
+		LEFT JOIN link_metadata m ON m.short_url_id = s.id
+		WHERE s.blocked = '' AND (m.fetched IS NULL OR m.fetched < ?)
+		ORDER BY m.fetched IS NOT NULL, m.fetched, s.abbreviation, s.domain
+		LIMIT ?
+	`
+	links, err := d.queryLinkMetadata(ctx, sqlStmt, fetchedBefore.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error getting links with stale metadata: %v", err)
+	}
+	return links, nil
+}
+
+// queryLinkMetadata reads rows of domain, abbreviation, url and the link_metadata columns, which are null for links never fetched
+func (d *MySQLDB) queryLinkMetadata(ctx context.Context, query string, args ...any) ([]LinkMetadata, error) {
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	links := make([]LinkMetadata, 0)
+	for rows.Next() {
+		var lm LinkMetadata
+		var title, description, image, siteName, favicon, fetchErr sql.NullString
+		var fetched sql.NullTime
+		if err := rows.Scan(&lm.Domain, &lm.Abbreviation, &lm.Url, &title, &description, &image, &siteName, &favicon, &fetchErr, &fetched); err != nil {
+			return nil, err
+		}
+		lm.Metadata = Metadata{
+			Title:       title.String,
+			Description: description.String,
+			Image:       image.String,
+			SiteName:    siteName.String,
+			Favicon:     favicon.String,
+			Error:       fetchErr.String,
+			Fetched:     fetched.Time,
+		}
+		links = append(links, lm)
+	}
+	return links, rows.Err()
+}
+
+func (d *MySQLDB) GetHourlyHits(abv string, from, to time.Time) (map[time.Time]int, error) {
+	ctx, cancel := newMySQLContext()
+	defer cancel()
+
+	sqlStmt := `
+		SELECT h.hit_hour, h.hits
+		FROM hourly_hits h
+		JOIN short_urls s ON s.id = h.short_url_id
+		WHERE s.domain = ? AND s.abbreviation = ? AND h.hit_hour >= ? AND h.hit_hour < ?
+	`
+	rows, err := d.db.QueryContext(ctx, sqlStmt, d.domain, abv, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("error getting hourly hits for %s: %v", abv, err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	hits := make(map[time.Time]int)
+	for rows.Next() {
+		var hour time.Time
+		var count int
+		if err := rows.Scan(&hour, &count); err != nil {
+			return nil, fmt.Errorf("error scanning hourly hits for %s: %v", abv, err)
+		}
+		hits[hour.UTC()] = count
+	}
+
+	return hits, rows.Err()
+}
+
+func (d *MySQLDB) CountUniques(abv string, buckets [][]string) ([]int64, error) {
+	first, last, ok := dateRange(buckets)
+	if !ok {
+		return countBuckets(nil, buckets), nil
+	}
+
+	ctx, cancel := newMySQLContext()
+	defer cancel()
+
+	sqlStmt := `
+		SELECT v.period, v.sketch
+		FROM visitor_sketches v
+		JOIN short_urls s ON s.id = v.short_url_id
+		WHERE s.domain = ? AND s.abbreviation = ? AND v.period BETWEEN ? AND ?
+	`
+	sketches, err := d.querySketches(ctx, sqlStmt, d.domain, abv, first, last)
+	if err != nil {
+		return nil, fmt.Errorf("error counting uniques for %s: %v", abv, err)
+	}
+	return countBuckets(sketches, buckets), nil
+}
+
+func (d *MySQLDB) GetGlobalStats(from, to string, limit int) (GlobalStats, error) {
+	priorFrom, _, err := PriorWindow(from, to)
+	if err != nil {
+		return GlobalStats{}, err
+	}
+	start, end := windowTimes(from, to)
+
+	ctx, cancel := newMySQLContext()
+	defer cancel()
+
+	var stats GlobalStats
+
+	hitsPerDaySQL := `
+		SELECT DATE_FORMAT(h.hit_date, '%Y-%m-%d'), SUM(h.hits)
+		FROM daily_hits h
+		JOIN short_urls s ON s.id = h.short_url_id
+		WHERE s.domain = ? AND h.hit_date BETWEEN ? AND ?
+		GROUP BY h.hit_date
+	`
+	if stats.HitsPerDay, err = d.queryDayCounts(ctx, hitsPerDaySQL, d.domain, from, to); err != nil {
+		return GlobalStats{}, fmt.Errorf("error getting hits per day: %v", err)
+	}
+
+	createdPerDaySQL := `
+		SELECT DATE_FORMAT(created_at, '%Y-%m-%d') AS created_day, COUNT(*)
+		FROM short_urls
+		WHERE domain = ? AND created_at >= ? AND created_at < ?
+		GROUP BY created_day
+	`
+	if stats.CreatedPerDay, err = d.queryDayCounts(ctx, createdPerDaySQL, d.domain, start, end); err != nil {
+		return GlobalStats{}, fmt.Errorf("error getting links created per day: %v", err)
+	}
+
+	topLinksSQL := `
+		SELECT s.domain, s.abbreviation, s.url, SUM(h.hits) AS window_hits, 0
+		FROM daily_hits h
+		JOIN short_urls s ON s.id = h.short_url_id
+		WHERE s.domain = ? AND h.hit_date BETWEEN ? AND ?
+		GROUP BY s.id, s.domain, s.abbreviation, s.url
+		ORDER BY window_hits DESC, s.abbreviation, s.domain
+		LIMIT ?
+	`
+	if stats.TopLinks, err = d.queryLinkCounts(ctx, topLinksSQL, d.domain, from, to, limit); err != nil {
+		return GlobalStats{}, fmt.Errorf("error getting top links: %v", err)
+	}
+
+	trendingSQL := `
+		SELECT domain, abbreviation, url, window_hits, prior_hits
+		FROM (
+			SELECT s.domain, s.abbreviation, s.url,
+				SUM(CASE WHEN h.hit_date >= ? THEN h.hits ELSE 0 END) AS window_hits,
+				SUM(CASE WHEN h.hit_date < ? THEN h.hits ELSE 0 END) AS prior_hits
+			FROM daily_hits h
+			JOIN short_urls s ON s.id = h.short_url_id
+			WHERE s.domain = ? AND h.hit_date BETWEEN ? AND ?
+			GROUP BY s.id, s.domain, s.abbreviation, s.url
+		) t
+		WHERE window_hits > prior_hits
+		ORDER BY window_hits - prior_hits DESC, abbreviation, domain
+		LIMIT ?
+	`
+	if stats.Trending, err = d.queryLinkCounts(ctx, trendingSQL, from, from, d.domain, priorFrom, to, limit); err != nil {
+		return GlobalStats{}, fmt.Errorf("error getting trending links: %v", err)
+	}
+
+	neverClickedSQL := `
+		SELECT domain, abbreviation, url, 0, 0
+		FROM short_urls
+		WHERE domain = ? AND hits = 0
+		ORDER BY created_at, abbreviation, domain
+		LIMIT ?
+	`
+	if stats.NeverClicked, err = d.queryLinkCounts(ctx, neverClickedSQL, d.domain, limit); err != nil {
+		return GlobalStats{}, fmt.Errorf("error getting never clicked links: %v", err)
+	}
+	if err := d.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM short_urls WHERE domain = ? AND hits = 0`, d.domain).Scan(&stats.NeverClickedTotal); err != nil {
+		return GlobalStats{}, fmt.Errorf("error counting never clicked links: %v", err)
+	}
+
+	return stats, nil
+}
+
+// queryDayCounts reads (date, count) rows
+func (d *MySQLDB) queryDayCounts(ctx context.Context, query string, args ...any) (map[string]int, error) {
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var day string
+		var count int
+		if err := rows.Scan(&day, &count); err != nil {
+			return nil, err
+		}
+		counts[day] = count
+	}
+	return counts, rows.Err()
+}
+
+// queryLinkCounts reads (domain, abbreviation, url, hits, prior hits) rows
+func (d *MySQLDB) queryLinkCounts(ctx context.Context, query string, args ...any) ([]LinkCount, error) {
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	links := make([]LinkCount, 0)
+	for rows.Next() {
+		var lc LinkCount
+		if err := rows.Scan(&lc.Domain, &lc.Abbreviation, &lc.Url, &lc.Hits, &lc.PriorHits); err != nil {
+			return nil, err
+		}
+		links = append(links, lc)
+	}
+	return links, rows.Err()
+}
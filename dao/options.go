@@ -0,0 +1,180 @@
+package dao
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/ericfialkowski/shorturl/rules"
+)
+
+const (
+	MaxVariants = 20
+	maxWeight   = 1000000
+)
+
+var variantNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// How a query parameter that's in both the request and the destination is passed through
+const (
+	ConflictKeep    = "keep"    // the destination's values are kept and the request's dropped
+	ConflictReplace = "replace" // the request's values replace the destination's
+	ConflictAppend  = "append"  // the request's values are added after the destination's
+)
+
+// Options change how a link redirects. The zero value redirects to the destination as it is.
+type Options struct {
+	Passthrough *Passthrough `json:"passthrough,omitempty" bson:"passthrough,omitempty"`
+	// Rules send visitors elsewhere by their device, language, country or the time; the first that matches wins
+	Rules []rules.Rule `json:"rules,omitempty" bson:"rules,omitempty"`
+	// Experiment splits the visitors no rule matched between weighted destinations
+	Experiment *Experiment `json:"experiment,omitempty" bson:"experiment,omitempty"`
+	// Status is the HTTP status the link redirects with, 0 for the service's default
+	Status int `json:"status,omitempty" bson:"status,omitempty"`
+	// Expires is when the link stops redirecting, nil for never
+	Expires *time.Time `json:"expires,omitempty" bson:"expires,omitempty"`
+}
+
+// Experiment is an A/B test of destinations. Visitors keep the variant they were first sent to while its
+// weight isn't zero, and once there's a winner everyone goes to it.
+type Experiment struct {
+	Variants []Variant `json:"variants" bson:"variants"`
+	Winner   string    `json:"winner,omitempty" bson:"winner,omitempty"` // name of the variant everyone is sent to
+}
+
+// Variant is one of the destinations of an experiment, sent weight out of the total weight of visitors
+type Variant struct {
+	Name   string `json:"name" bson:"name"`
+	Url    string `json:"url" bson:"url"`
+	Weight int    `json:"weight" bson:"weight"`
+}
+
+// ValidRedirectStatus returns whether links can redirect with status
+func ValidRedirectStatus(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// Find returns the variant called name, and whether there is one
+func (e *Experiment) Find(name string) (Variant, bool) {
+	if e != nil {
+		for _, v := range e.Variants {
+			if v.Name == name {
+				return v, true
+			}
+		}
+	}
+	return Variant{}, false
+}
+
+func (e *Experiment) validate() error {
+	if len(e.Variants) == 0 || len(e.Variants) > MaxVariants {
+		return fmt.Errorf("experiments need between 1 and %d variants", MaxVariants)
+	}
+	total := 0
+	seen := make(map[string]bool, len(e.Variants))
+	for _, v := range e.Variants {
+		if !variantNamePattern.MatchString(v.Name) {
+			return fmt.Errorf("invalid variant name %q, want up to 32 letters, digits, '_' or '-'", v.Name)
+		}
+		if seen[v.Name] {
+			return fmt.Errorf("variant %s is there twice", v.Name)
+		}
+		seen[v.Name] = true
+		if u, err := url.ParseRequestURI(v.Url); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid url %q for variant %s", v.Url, v.Name)
+		}
+		if v.Weight < 0 || v.Weight > maxWeight {
+			return fmt.Errorf("weight of variant %s isn't between 0 and %d", v.Name, maxWeight)
+		}
+		total += v.Weight
+	}
+	if e.Winner != "" {
+		if !seen[e.Winner] {
+			return fmt.Errorf("winner %s isn't one of the variants", e.Winner)
+		}
+	} else if total == 0 {
+		return fmt.Errorf("variants need some weight, or a winner")
+	}
+	return nil
+}
+
+// Passthrough is what of the request is carried over to the destination
+type Passthrough struct {
+	Path      bool   `json:"path,omitempty" bson:"path,omitempty"`   // path after the abbreviation is appended to the destination's
+	Query     bool   `json:"query,omitempty" bson:"query,omitempty"` // query parameters are merged into the destination's
+	Conflicts string `json:"conflicts,omitempty" bson:"conflicts,omitempty"`
+}
+
+// Validate returns why the options can't be used, or nil if they can
+func (o Options) Validate() error {
+	if o.Status != 0 && !ValidRedirectStatus(o.Status) {
+		return fmt.Errorf("invalid status %d, want 301, 302, 307 or 308", o.Status)
+	}
+	if p := o.Passthrough; p != nil {
+		switch p.Conflicts {
+		case "", ConflictKeep, ConflictReplace, ConflictAppend:
+		default:
+			return fmt.Errorf("unknown passthrough conflicts %q, want %s, %s or %s", p.Conflicts, ConflictKeep, ConflictReplace, ConflictAppend)
+		}
+	}
+	if o.Experiment != nil {
+		if err := o.Experiment.validate(); err != nil {
+			return err
+		}
+	}
+	return rules.Validate(o.Rules)
+}
+
+// Expired returns whether the link has stopped redirecting by now
+func (o Options) Expired(now time.Time) bool {
+	return o.Expires != nil && !now.Before(*o.Expires)
+}
+
+// IsZero returns whether the options leave the link redirecting plainly
+func (o Options) IsZero() bool {
+	return optionsJSON(o) == ""
+}
+
+// optionsJSON encodes options for the stores that keep them as text, empty when there aren't any
+func optionsJSON(o Options) string {
+	b, _ := json.Marshal(o)
+	if string(b) == "{}" {
+		return ""
+	}
+	return string(b)
+}
+
+func parseOptions(s string) (Options, error) {
+	var o Options
+	if s == "" {
+		return o, nil
+	}
+	if err := json.Unmarshal([]byte(s), &o); err != nil {
+		return o, fmt.Errorf("invalid options %q: %v", s, err)
+	}
+	return o, nil
+}
+
+// optionsPtr is options for ShortUrl, which leaves them out when there aren't any
+func optionsPtr(o Options) *Options {
+	if o.IsZero() {
+		return nil
+	}
+	return &o
+}
+
+// cloneOptions deep copies options, so the memory store's can't be changed from outside it
+func cloneOptions(o *Options) *Options {
+	if o == nil {
+		return nil
+	}
+	c, _ := parseOptions(optionsJSON(*o))
+	return optionsPtr(c)
+}
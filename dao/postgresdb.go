@@ -8,12 +8,15 @@ import (
 	"time"
 
 	"github.com/ericfialkowski/shorturl/env"
+	"github.com/ericfialkowski/shorturl/hll"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type PostgresDB struct {
-	pool *pgxpool.Pool
+	pool   *pgxpool.Pool
+	domain string
 }
 
 func newPgContext() (context.Context, context.CancelFunc) {
@@ -52,20 +55,71 @@ func (d *PostgresDB) initSchema() {
 	createTableSQL := `
 		CREATE TABLE IF NOT EXISTS short_urls (
 			id SERIAL PRIMARY KEY,
-			abbreviation VARCHAR(50) NOT NULL UNIQUE,
-			url TEXT NOT NULL UNIQUE,
+			domain VARCHAR(255) NOT NULL DEFAULT '',
+			abbreviation VARCHAR(50) NOT NULL,
+			url TEXT NOT NULL,
 			hits INTEGER NOT NULL DEFAULT 0,
 			last_access TIMESTAMP WITH TIME ZONE,
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			blocked TEXT NOT NULL DEFAULT '',
+			options TEXT NOT NULL DEFAULT '',
+			password TEXT NOT NULL DEFAULT '',
+			collection VARCHAR(64) NOT NULL DEFAULT ''
 		);
 		CREATE INDEX IF NOT EXISTS idx_short_urls_abbreviation ON short_urls(abbreviation);
 		CREATE INDEX IF NOT EXISTS idx_short_urls_url ON short_urls(url);
+		CREATE INDEX IF NOT EXISTS idx_short_urls_created_at ON short_urls(created_at);
 	`
 
 	if _, err := d.pool.Exec(ctx, createTableSQL); err != nil {
 		log.Printf("Error creating short_urls table: %v", err)
 	}
 
+	// Add the columns introduced since short_urls was first created
+	if _, err := d.pool.Exec(ctx, `ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS blocked TEXT NOT NULL DEFAULT ''`); err != nil {
+		log.Printf("Error adding blocked column: %v", err)
+	}
+	if _, err := d.pool.Exec(ctx, `ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS options TEXT NOT NULL DEFAULT ''`); err != nil {
+		log.Printf("Error adding options column: %v", err)
+	}
+	if _, err := d.pool.Exec(ctx, `ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS password TEXT NOT NULL DEFAULT ''`); err != nil {
+		log.Printf("Error adding password column: %v", err)
+	}
+	if _, err := d.pool.Exec(ctx, `ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS domain VARCHAR(255) NOT NULL DEFAULT ''`); err != nil {
+		log.Printf("Error adding domain column: %v", err)
+	}
+	if _, err := d.pool.Exec(ctx, `ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS collection VARCHAR(64) NOT NULL DEFAULT ''`); err != nil {
+		log.Printf("Error adding collection column: %v", err)
+	}
+
+	// Names and URLs used to be unique on their own, now they're unique within a domain
+	domainsSQL := `
+		ALTER TABLE short_urls DROP CONSTRAINT IF EXISTS short_urls_abbreviation_key;
+		ALTER TABLE short_urls DROP CONSTRAINT IF EXISTS short_urls_url_key;
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_short_urls_domain_abbreviation ON short_urls(domain, abbreviation);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_short_urls_domain_url ON short_urls(domain, url);
+	`
+	if _, err := d.pool.Exec(ctx, domainsSQL); err != nil {
+		log.Printf("Error adding domains: %v", err)
+	}
+	if _, err := d.pool.Exec(ctx, `CREATE INDEX IF NOT EXISTS idx_short_urls_collection ON short_urls(domain, collection)`); err != nil {
+		log.Printf("Error creating collection index: %v", err)
+	}
+
+	// Create the link_tags table for the tags of each link
+	createLinkTagsSQL := `
+		CREATE TABLE IF NOT EXISTS link_tags (
+			short_url_id INTEGER NOT NULL REFERENCES short_urls(id) ON DELETE CASCADE,
+			tag VARCHAR(64) NOT NULL,
+			PRIMARY KEY (short_url_id, tag)
+		);
+		CREATE INDEX IF NOT EXISTS idx_link_tags_tag ON link_tags(tag);
+	`
+
+	if _, err := d.pool.Exec(ctx, createLinkTagsSQL); err != nil {
+		log.Printf("Error creating link_tags table: %v", err)
+	}
+
 	// Create the daily_hits table for tracking hits per day
 	createDailyHitsSQL := `
 		CREATE TABLE IF NOT EXISTS daily_hits (
@@ -82,6 +136,136 @@ func (d *PostgresDB) initSchema() {
 	if _, err := d.pool.Exec(ctx, createDailyHitsSQL); err != nil {
 		log.Printf("Error creating daily_hits table: %v", err)
 	}
+
+	// Create the hourly_hits table for tracking hits per UTC hour
+	createHourlyHitsSQL := `
+		CREATE TABLE IF NOT EXISTS hourly_hits (
+			id SERIAL PRIMARY KEY,
+			short_url_id INTEGER NOT NULL REFERENCES short_urls(id) ON DELETE CASCADE,
+			hit_hour TIMESTAMP WITH TIME ZONE NOT NULL,
+			hits INTEGER NOT NULL DEFAULT 0,
+			UNIQUE(short_url_id, hit_hour)
+		);
+		CREATE INDEX IF NOT EXISTS idx_hourly_hits_hour ON hourly_hits(hit_hour);
+	`
+
+	if _, err := d.pool.Exec(ctx, createHourlyHitsSQL); err != nil {
+		log.Printf("Error creating hourly_hits table: %v", err)
+	}
+
+	// Create the geo_hits table for tracking hits per country and region
+	createGeoHitsSQL := `
+		CREATE TABLE IF NOT EXISTS geo_hits (
+			id SERIAL PRIMARY KEY,
+			short_url_id INTEGER NOT NULL REFERENCES short_urls(id) ON DELETE CASCADE,
+			country VARCHAR(2) NOT NULL,
+			region VARCHAR(10) NOT NULL DEFAULT '',
+			hits INTEGER NOT NULL DEFAULT 0,
+			UNIQUE(short_url_id, country, region)
+		);
+		CREATE INDEX IF NOT EXISTS idx_geo_hits_short_url_id ON geo_hits(short_url_id);
+	`
+
+	if _, err := d.pool.Exec(ctx, createGeoHitsSQL); err != nil {
+		log.Printf("Error creating geo_hits table: %v", err)
+	}
+
+	// Create the referrer_hits table for tracking hits per referring host
+	createReferrerHitsSQL := `
+		CREATE TABLE IF NOT EXISTS referrer_hits (
+			id SERIAL PRIMARY KEY,
+			short_url_id INTEGER NOT NULL REFERENCES short_urls(id) ON DELETE CASCADE,
+			referrer VARCHAR(255) NOT NULL,
+			hits INTEGER NOT NULL DEFAULT 0,
+			UNIQUE(short_url_id, referrer)
+		);
+	`
+
+	if _, err := d.pool.Exec(ctx, createReferrerHitsSQL); err != nil {
+		log.Printf("Error creating referrer_hits table: %v", err)
+	}
+
+	// Create the variant_hits table for tracking hits per A/B variant
+	createVariantHitsSQL := `
+		CREATE TABLE IF NOT EXISTS variant_hits (
+			id SERIAL PRIMARY KEY,
+			short_url_id INTEGER NOT NULL REFERENCES short_urls(id) ON DELETE CASCADE,
+			variant VARCHAR(32) NOT NULL,
+			hits INTEGER NOT NULL DEFAULT 0,
+			UNIQUE(short_url_id, variant)
+		);
+	`
+
+	if _, err := d.pool.Exec(ctx, createVariantHitsSQL); err != nil {
+		log.Printf("Error creating variant_hits table: %v", err)
+	}
+
+	// Create the bot_hits table for tracking crawler and unfurler hits per bot family
+	createBotHitsSQL := `
+		CREATE TABLE IF NOT EXISTS bot_hits (
+			id SERIAL PRIMARY KEY,
+			short_url_id INTEGER NOT NULL REFERENCES short_urls(id) ON DELETE CASCADE,
+			family VARCHAR(50) NOT NULL,
+			hits INTEGER NOT NULL DEFAULT 0,
+			UNIQUE(short_url_id, family)
+		);
+	`
+
+	if _, err := d.pool.Exec(ctx, createBotHitsSQL); err != nil {
+		log.Printf("Error creating bot_hits table: %v", err)
+	}
+
+	// Create the visitor_sketches table for counting unique visitors per UTC day
+	createVisitorSketchesSQL := `
+		CREATE TABLE IF NOT EXISTS visitor_sketches (
+			id SERIAL PRIMARY KEY,
+			short_url_id INTEGER NOT NULL REFERENCES short_urls(id) ON DELETE CASCADE,
+			period VARCHAR(10) NOT NULL,
+			sketch BYTEA NOT NULL,
+			UNIQUE(short_url_id, period)
+		);
+	`
+
+	if _, err := d.pool.Exec(ctx, createVisitorSketchesSQL); err != nil {
+		log.Printf("Error creating visitor_sketches table: %v", err)
+	}
+
+	// Create the link_health table for the last check of each destination
+	createLinkHealthSQL := `
+		CREATE TABLE IF NOT EXISTS link_health (
+			short_url_id INTEGER PRIMARY KEY REFERENCES short_urls(id) ON DELETE CASCADE,
+			status INTEGER NOT NULL DEFAULT 0,
+			error TEXT NOT NULL DEFAULT '',
+			redirects TEXT NOT NULL DEFAULT '',
+			checked TIMESTAMP WITH TIME ZONE NOT NULL,
+			failures INTEGER NOT NULL DEFAULT 0,
+			dead BOOLEAN NOT NULL DEFAULT FALSE
+		);
+		CREATE INDEX IF NOT EXISTS idx_link_health_checked ON link_health(checked);
+	`
+
+	if _, err := d.pool.Exec(ctx, createLinkHealthSQL); err != nil {
+		log.Printf("Error creating link_health table: %v", err)
+	}
+
+	// Create the link_metadata table for what was fetched from each destination
+	createLinkMetadataSQL := `
+		CREATE TABLE IF NOT EXISTS link_metadata (
+			short_url_id INTEGER PRIMARY KEY REFERENCES short_urls(id) ON DELETE CASCADE,
+			title TEXT NOT NULL DEFAULT '',
+			description TEXT NOT NULL DEFAULT '',
+			image TEXT NOT NULL DEFAULT '',
+			site_name TEXT NOT NULL DEFAULT '',
+			favicon TEXT NOT NULL DEFAULT '',
+			error TEXT NOT NULL DEFAULT '',
+			fetched TIMESTAMP WITH TIME ZONE NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_link_metadata_fetched ON link_metadata(fetched);
+	`
+
+	if _, err := d.pool.Exec(ctx, createLinkMetadataSQL); err != nil {
+		log.Printf("Error creating link_metadata table: %v", err)
+	}
 }
 
 func (d *PostgresDB) Cleanup() {
@@ -99,17 +283,21 @@ func (d *PostgresDB) IsLikelyOk() bool {
 	return true
 }
 
+func (d *PostgresDB) ForDomain(domain string) ShortUrlDao {
+	return &PostgresDB{pool: d.pool, domain: domain}
+}
+
 func (d *PostgresDB) Save(abv string, url string) error {
 	ctx, cancel := newPgContext()
 	defer cancel()
 
 	sql := `
-		INSERT INTO short_urls (abbreviation, url, hits)
-		VALUES ($1, $2, 0)
-		ON CONFLICT (abbreviation) DO NOTHING
+		INSERT INTO short_urls (abbreviation, url, hits, domain)
+		VALUES ($1, $2, 0, $3)
+		ON CONFLICT (domain, abbreviation) DO NOTHING
 	`
 
-	result, err := d.pool.Exec(ctx, sql, abv, url)
+	result, err := d.pool.Exec(ctx, sql, abv, url, d.domain)
 	if err != nil {
 		if strings.Contains(err.Error(), "duplicate key") || strings.Contains(err.Error(), "unique constraint") {
 			return nil // Treat duplicate as success (same as MongoDB impl)
@@ -120,7 +308,7 @@ func (d *PostgresDB) Save(abv string, url string) error {
 	if result.RowsAffected() == 0 {
 		// Check if it was a conflict on abbreviation vs url
 		var existingUrl string
-		err := d.pool.QueryRow(ctx, "SELECT url FROM short_urls WHERE abbreviation = $1", abv).Scan(&existingUrl)
+		err := d.pool.QueryRow(ctx, "SELECT url FROM short_urls WHERE abbreviation = $1 AND domain = $2", abv, d.domain).Scan(&existingUrl)
 		if err == nil && existingUrl != url {
 			return fmt.Errorf("abbreviation %s already exists with different URL", abv)
 		}
@@ -129,12 +317,36 @@ func (d *PostgresDB) Save(abv string, url string) error {
 	return nil
 }
 
+func (d *PostgresDB) SaveAll(links []Link) error {
+	ctx, cancel := newPgContext()
+	defer cancel()
+
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't start saving links: %v", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	sql := `INSERT INTO short_urls (abbreviation, url, hits, domain) VALUES ($1, $2, 0, $3)`
+	for _, link := range links {
+		if _, err := tx.Exec(ctx, sql, link.Abbreviation, link.Url, d.domain); err != nil {
+			return fmt.Errorf("couldn't store (%s, %s): %v", link.Abbreviation, link.Url, err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("couldn't save links: %v", err)
+	}
+	return nil
+}
+
 func (d *PostgresDB) DeleteAbv(abv string) error {
 	ctx, cancel := newPgContext()
 	defer cancel()
 
-	sql := `DELETE FROM short_urls WHERE abbreviation = $1`
-	if _, err := d.pool.Exec(ctx, sql, abv); err != nil {
+	sql := `DELETE FROM short_urls WHERE abbreviation = $1 AND domain = $2`
+	if _, err := d.pool.Exec(ctx, sql, abv, d.domain); err != nil {
 		return fmt.Errorf("couldn't delete abbreviation %s: %v", abv, err)
 	}
 	return nil
@@ -144,27 +356,50 @@ func (d *PostgresDB) DeleteUrl(url string) error {
 	ctx, cancel := newPgContext()
 	defer cancel()
 
-	sql := `DELETE FROM short_urls WHERE url = $1`
-	if _, err := d.pool.Exec(ctx, sql, url); err != nil {
+	sql := `DELETE FROM short_urls WHERE url = $1 AND domain = $2`
+	if _, err := d.pool.Exec(ctx, sql, url, d.domain); err != nil {
 		return fmt.Errorf("couldn't delete URL %s: %v", url, err)
 	}
 	return nil
 }
 
 func (d *PostgresDB) GetUrl(abv string) (string, error) {
+	return unblocked(d.GetUrlWithHit(abv, NewHit()))
+}
+
+func (d *PostgresDB) LookupUrl(abv string) (string, error) {
+	_, url, err := d.lookupUrl(abv)
+	return url, err
+}
+
+// lookupUrl returns the id and url of abv, with a *BlockedError for blocked links
+func (d *PostgresDB) lookupUrl(abv string) (int, string, error) {
 	ctx, cancel := newPgContext()
 	defer cancel()
 
 	var url string
 	var shortUrlId int
-	sql := `SELECT id, url FROM short_urls WHERE abbreviation = $1`
-	err := d.pool.QueryRow(ctx, sql, abv).Scan(&shortUrlId, &url)
+	var blocked string
+	sql := `SELECT id, url, blocked FROM short_urls WHERE abbreviation = $1 AND domain = $2`
+	err := d.pool.QueryRow(ctx, sql, abv, d.domain).Scan(&shortUrlId, &url, &blocked)
 
 	if err != nil {
 		if err == pgx.ErrNoRows {
-			return "", nil
+			return 0, "", nil
 		}
-		return "", fmt.Errorf("error getting URL for %s: %v", abv, err)
+		return 0, "", fmt.Errorf("error getting URL for %s: %v", abv, err)
+	}
+
+	if blocked != "" {
+		return shortUrlId, url, &BlockedError{Abv: abv, Reason: blocked}
+	}
+	return shortUrlId, url, nil
+}
+
+func (d *PostgresDB) GetUrlWithHit(abv string, hit Hit) (string, error) {
+	shortUrlId, url, err := d.lookupUrl(abv)
+	if err != nil || url == "" {
+		return url, err
 	}
 
 	// Update stats asynchronously
@@ -172,39 +407,173 @@ func (d *PostgresDB) GetUrl(abv string) (string, error) {
 		ctx, cancel := newPgContext()
 		defer cancel()
 
+		// Bots only count towards the bot stats
+		if hit.Bot != "" {
+			botHitSQL := `
+				INSERT INTO bot_hits (short_url_id, family, hits)
+				VALUES ($1, $2, 1)
+				ON CONFLICT (short_url_id, family)
+				DO UPDATE SET hits = bot_hits.hits + 1
+			`
+			if _, err := d.pool.Exec(ctx, botHitSQL, shortUrlId, hit.Bot); err != nil {
+				log.Printf("Error updating bot_hits: %v", err)
+			}
+			return
+		}
+
 		// Update total hits and last_access in short_urls
 		updateSQL := `
 			UPDATE short_urls
 			SET hits = hits + 1,
-				last_access = CURRENT_TIMESTAMP
+				last_access = $2
 			WHERE id = $1
 		`
-		if _, err := d.pool.Exec(ctx, updateSQL, shortUrlId); err != nil {
+		if _, err := d.pool.Exec(ctx, updateSQL, shortUrlId, hit.Time); err != nil {
 			log.Printf("Error updating short_urls stats: %v", err)
 		}
 
 		// Insert or update daily hit count
 		dailyHitSQL := `
 			INSERT INTO daily_hits (short_url_id, hit_date, hits)
-			VALUES ($1, CURRENT_DATE, 1)
+			VALUES ($1, $2, 1)
 			ON CONFLICT (short_url_id, hit_date)
 			DO UPDATE SET hits = daily_hits.hits + 1
 		`
-		if _, err := d.pool.Exec(ctx, dailyHitSQL, shortUrlId); err != nil {
+		if _, err := d.pool.Exec(ctx, dailyHitSQL, shortUrlId, hit.Date()); err != nil {
 			log.Printf("Error updating daily_hits: %v", err)
 		}
+
+		// Insert or update hourly hit count
+		hourlyHitSQL := `
+			INSERT INTO hourly_hits (short_url_id, hit_hour, hits)
+			VALUES ($1, $2, 1)
+			ON CONFLICT (short_url_id, hit_hour)
+			DO UPDATE SET hits = hourly_hits.hits + 1
+		`
+		if _, err := d.pool.Exec(ctx, hourlyHitSQL, shortUrlId, hit.Hour()); err != nil {
+			log.Printf("Error updating hourly_hits: %v", err)
+		}
+
+		// Insert or update country/region hit count
+		if hit.Country != "" {
+			geoHitSQL := `
+				INSERT INTO geo_hits (short_url_id, country, region, hits)
+				VALUES ($1, $2, $3, 1)
+				ON CONFLICT (short_url_id, country, region)
+				DO UPDATE SET hits = geo_hits.hits + 1
+			`
+			if _, err := d.pool.Exec(ctx, geoHitSQL, shortUrlId, hit.Country, hit.Region); err != nil {
+				log.Printf("Error updating geo_hits: %v", err)
+			}
+		}
+
+		// Insert or update referrer hit count
+		if hit.Referrer != "" {
+			referrerHitSQL := `
+				INSERT INTO referrer_hits (short_url_id, referrer, hits)
+				VALUES ($1, $2, 1)
+				ON CONFLICT (short_url_id, referrer)
+				DO UPDATE SET hits = referrer_hits.hits + 1
+			`
+			if _, err := d.pool.Exec(ctx, referrerHitSQL, shortUrlId, hit.Referrer); err != nil {
+				log.Printf("Error updating referrer_hits: %v", err)
+			}
+		}
+
+		// Insert or update the hit count of the A/B variant the visitor was sent to
+		if hit.Variant != "" {
+			variantHitSQL := `
+				INSERT INTO variant_hits (short_url_id, variant, hits)
+				VALUES ($1, $2, 1)
+				ON CONFLICT (short_url_id, variant)
+				DO UPDATE SET hits = variant_hits.hits + 1
+			`
+			if _, err := d.pool.Exec(ctx, variantHitSQL, shortUrlId, hit.Variant); err != nil {
+				log.Printf("Error updating variant_hits: %v", err)
+			}
+		}
+
+		// Add the visitor to the day's sketch
+		if hit.Visitor != "" {
+			if err := d.addVisitor(ctx, shortUrlId, hit.Date(), hit.Visitor); err != nil {
+				log.Printf("Error updating visitor_sketches: %v", err)
+			}
+		}
 	}()
 
 	return url, nil
 }
 
+// addVisitor adds visitor to a stored sketch. Most visitors were counted already, so the sketch is read without a
+// lock, and only written when it changed and nobody else wrote it in between; otherwise it's read again.
+func (d *PostgresDB) addVisitor(ctx context.Context, shortUrlId int, period, visitor string) error {
+	selectSQL := `SELECT sketch FROM visitor_sketches WHERE short_url_id = $1 AND period = $2`
+	insertSQL := `
+		INSERT INTO visitor_sketches (short_url_id, period, sketch)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (short_url_id, period) DO NOTHING
+	`
+	updateSQL := `UPDATE visitor_sketches SET sketch = $3 WHERE short_url_id = $1 AND period = $2 AND sketch = $4`
+
+	for range maxSketchRetries {
+		var data []byte
+		err := d.pool.QueryRow(ctx, selectSQL, shortUrlId, period).Scan(&data)
+		if err != nil && err != pgx.ErrNoRows {
+			return err
+		}
+		missing := err == pgx.ErrNoRows
+
+		updated, err := addToSketch(data, visitor)
+		if err != nil || updated == nil {
+			return err
+		}
+
+		var tag pgconn.CommandTag
+		if missing {
+			tag, err = d.pool.Exec(ctx, insertSQL, shortUrlId, period, updated)
+		} else {
+			tag, err = d.pool.Exec(ctx, updateSQL, shortUrlId, period, updated, data)
+		}
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() > 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("too much contention updating visitor sketch %d/%s", shortUrlId, period)
+}
+
+// querySketches reads (period, sketch) rows into decoded sketches
+func (d *PostgresDB) querySketches(ctx context.Context, query string, args ...any) (map[string]*hll.Sketch, error) {
+	rows, err := d.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	encoded := make(map[string][]byte)
+	for rows.Next() {
+		var period string
+		var data []byte
+		if err := rows.Scan(&period, &data); err != nil {
+			return nil, err
+		}
+		encoded[period] = data
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return parseSketches(encoded), nil
+}
+
 func (d *PostgresDB) GetAbv(url string) (string, error) {
 	ctx, cancel := newPgContext()
 	defer cancel()
 
 	var abv string
-	sql := `SELECT abbreviation FROM short_urls WHERE url = $1`
-	err := d.pool.QueryRow(ctx, sql, url).Scan(&abv)
+	sql := `SELECT abbreviation FROM short_urls WHERE url = $1 AND domain = $2`
+	err := d.pool.QueryRow(ctx, sql, url, d.domain).Scan(&abv)
 
 	if err != nil {
 		if err == pgx.ErrNoRows {
@@ -224,19 +593,25 @@ func (d *PostgresDB) GetStats(abv string) (ShortUrl, error) {
 	var data ShortUrl
 	var shortUrlId int
 	var lastAccess *time.Time
+	var options string
 
 	// Get main short_url data
 	sql := `
-		SELECT id, abbreviation, url, hits, last_access
+		SELECT id, domain, abbreviation, url, hits, last_access, blocked, options, password <> '', collection
 		FROM short_urls
-		WHERE abbreviation = $1
+		WHERE abbreviation = $1 AND domain = $2
 	`
-	err := d.pool.QueryRow(ctx, sql, abv).Scan(
+	err := d.pool.QueryRow(ctx, sql, abv, d.domain).Scan(
 		&shortUrlId,
+		&data.Domain,
 		&data.Abbreviation,
 		&data.Url,
 		&data.Hits,
 		&lastAccess,
+		&data.Blocked,
+		&options,
+		&data.Protected,
+		&data.Collection,
 	)
 
 	if err != nil {
@@ -247,10 +622,26 @@ func (d *PostgresDB) GetStats(abv string) (ShortUrl, error) {
 		return ShortUrl{}, fmt.Errorf("error getting stats for %s: %v", abv, err)
 	}
 
+	if o, err := parseOptions(options); err != nil {
+		log.Printf("Error reading options of %s: %v", abv, err)
+	} else {
+		data.Options = optionsPtr(o)
+	}
+
 	if lastAccess != nil {
 		data.LastAccess = *lastAccess
 	}
 
+	tagRows, err := d.pool.Query(ctx, `SELECT tag FROM link_tags WHERE short_url_id = $1 ORDER BY tag`, shortUrlId)
+	if err != nil {
+		log.Printf("Error querying link_tags: %v", err)
+	} else {
+		data.Tags, err = pgx.CollectRows(tagRows, pgx.RowTo[string])
+		if err != nil {
+			log.Printf("Error scanning link_tags: %v", err)
+		}
+	}
+
 	// Get daily hits from separate table
 	data.DailyHits = make(map[string]int)
 	dailyHitsSQL := `
@@ -276,5 +667,719 @@ func (d *PostgresDB) GetStats(abv string) (ShortUrl, error) {
 		data.DailyHits[hitDate.Format("2006-01-02")] = hits
 	}
 
+	// Get country and region hits
+	data.CountryHits = make(map[string]int)
+	data.RegionHits = make(map[string]int)
+	geoHitsSQL := `
+		SELECT country, region, hits
+		FROM geo_hits
+		WHERE short_url_id = $1
+	`
+	geoRows, err := d.pool.Query(ctx, geoHitsSQL, shortUrlId)
+	if err != nil {
+		log.Printf("Error querying geo_hits: %v", err)
+		return data, nil
+	}
+	defer geoRows.Close()
+
+	for geoRows.Next() {
+		var country, region string
+		var hits int
+		if err := geoRows.Scan(&country, &region, &hits); err != nil {
+			log.Printf("Error scanning geo_hits row: %v", err)
+			continue
+		}
+		data.CountryHits[country] += hits
+		if region != "" {
+			data.RegionHits[region] += hits
+		}
+	}
+
+	// Get referrer hits
+	data.ReferrerHits = make(map[string]int)
+	referrerHitsSQL := `
+		SELECT referrer, hits
+		FROM referrer_hits
+		WHERE short_url_id = $1
+	`
+	refRows, err := d.pool.Query(ctx, referrerHitsSQL, shortUrlId)
+	if err != nil {
+		log.Printf("Error querying referrer_hits: %v", err)
+		return data, nil
+	}
+	defer refRows.Close()
+
+	for refRows.Next() {
+		var referrer string
+		var hits int
+		if err := refRows.Scan(&referrer, &hits); err != nil {
+			log.Printf("Error scanning referrer_hits row: %v", err)
+			continue
+		}
+		data.ReferrerHits[referrer] = hits
+	}
+
+	// Get A/B variant hits
+	data.VariantHits = make(map[string]int)
+	variantHitsSQL := `
+		SELECT variant, hits
+		FROM variant_hits
+		WHERE short_url_id = $1
+	`
+	variantRows, err := d.pool.Query(ctx, variantHitsSQL, shortUrlId)
+	if err != nil {
+		log.Printf("Error querying variant_hits: %v", err)
+		return data, nil
+	}
+	defer variantRows.Close()
+
+	for variantRows.Next() {
+		var variant string
+		var hits int
+		if err := variantRows.Scan(&variant, &hits); err != nil {
+			log.Printf("Error scanning variant_hits row: %v", err)
+			continue
+		}
+		data.VariantHits[variant] = hits
+	}
+
+	// Get bot hits per family
+	data.BotFamilies = make(map[string]int)
+	botHitsSQL := `
+		SELECT family, hits
+		FROM bot_hits
+		WHERE short_url_id = $1
+	`
+	botRows, err := d.pool.Query(ctx, botHitsSQL, shortUrlId)
+	if err != nil {
+		log.Printf("Error querying bot_hits: %v", err)
+		return data, nil
+	}
+	defer botRows.Close()
+
+	for botRows.Next() {
+		var family string
+		var hits int
+		if err := botRows.Scan(&family, &hits); err != nil {
+			log.Printf("Error scanning bot_hits row: %v", err)
+			continue
+		}
+		data.BotFamilies[family] = hits
+		data.BotHits += int32(hits)
+	}
+
+	// Get the last check of the destination
+	healthSQL := `
+		SELECT s.domain, s.abbreviation, s.url, s.password <> '', h.status, h.error, h.redirects, h.checked, h.failures, h.dead
+		FROM link_health h
+		JOIN short_urls s ON s.id = h.short_url_id
+		WHERE h.short_url_id = $1
+	`
+	if health, err := d.queryLinkHealth(ctx, healthSQL, shortUrlId); err != nil {
+		log.Printf("Error querying link_health: %v", err)
+	} else if len(health) > 0 {
+		data.Health = &health[0].Health
+	}
+
+	// Get the metadata of the destination
+	metadataSQL := `
+		SELECT s.domain, s.abbreviation, s.url, m.title, m.description, m.image, m.site_name, m.favicon, m.error, m.fetched
+		FROM link_metadata m
+		JOIN short_urls s ON s.id = m.short_url_id
+		WHERE m.short_url_id = $1
+	`
+	if metadata, err := d.queryLinkMetadata(ctx, metadataSQL, shortUrlId); err != nil {
+		log.Printf("Error querying link_metadata: %v", err)
+	} else if len(metadata) > 0 {
+		data.Metadata = &metadata[0].Metadata
+	}
+
+	// Get unique visitor counts
+	sketches, err := d.querySketches(ctx, `SELECT period, sketch FROM visitor_sketches WHERE short_url_id = $1`, shortUrlId)
+	if err != nil {
+		log.Printf("Error querying visitor_sketches: %v", err)
+		return data, nil
+	}
+	fillUniques(&data, sketches)
+
 	return data, nil
 }
+
+func (d *PostgresDB) FindLink(names []string) (Link, error) {
+	ctx, cancel := newPgContext()
+	defer cancel()
+
+	sql := `SELECT abbreviation, url FROM short_urls WHERE abbreviation = ANY($1) AND domain = $2`
+	rows, err := d.pool.Query(ctx, sql, names, d.domain)
+	if err != nil {
+		return Link{}, fmt.Errorf("error finding links: %v", err)
+	}
+	defer rows.Close()
+
+	found := make(map[string]string)
+	for rows.Next() {
+		var abv, url string
+		if err := rows.Scan(&abv, &url); err != nil {
+			return Link{}, fmt.Errorf("error scanning link: %v", err)
+		}
+		found[abv] = url
+	}
+	return firstLink(names, found), rows.Err()
+}
+
+func (d *PostgresDB) SearchLinks(prefix string, limit int) ([]Link, error) {
+	ctx, cancel := newPgContext()
+	defer cancel()
+
+	sql := `SELECT abbreviation, url, password <> '' FROM short_urls WHERE abbreviation LIKE $1 ESCAPE '!' AND domain = $3 ORDER BY abbreviation LIMIT $2`
+	rows, err := d.pool.Query(ctx, sql, likePrefix(prefix), limit, d.domain)
+	if err != nil {
+		return nil, fmt.Errorf("error searching links: %v", err)
+	}
+	defer rows.Close()
+
+	var links []Link
+	for rows.Next() {
+		var link Link
+		if err := rows.Scan(&link.Abbreviation, &link.Url, &link.Protected); err != nil {
+			return nil, fmt.Errorf("error scanning link: %v", err)
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+func (d *PostgresDB) SetBlocked(abv, reason string) error {
+	ctx, cancel := newPgContext()
+	defer cancel()
+
+	sql := `UPDATE short_urls SET blocked = $1 WHERE abbreviation = $2 AND domain = $3`
+	if _, err := d.pool.Exec(ctx, sql, reason, abv, d.domain); err != nil {
+		return fmt.Errorf("couldn't block abbreviation %s: %v", abv, err)
+	}
+	return nil
+}
+
+func (d *PostgresDB) SetOptions(abv string, options Options) error {
+	ctx, cancel := newPgContext()
+	defer cancel()
+
+	sql := `UPDATE short_urls SET options = $1 WHERE abbreviation = $2 AND domain = $3`
+	if _, err := d.pool.Exec(ctx, sql, optionsJSON(options), abv, d.domain); err != nil {
+		return fmt.Errorf("couldn't set options of %s: %v", abv, err)
+	}
+	return nil
+}
+
+func (d *PostgresDB) GetOptions(abv string) (Options, error) {
+	ctx, cancel := newPgContext()
+	defer cancel()
+
+	var options string
+	sql := `SELECT options FROM short_urls WHERE abbreviation = $1 AND domain = $2`
+	if err := d.pool.QueryRow(ctx, sql, abv, d.domain).Scan(&options); err != nil {
+		if err == pgx.ErrNoRows {
+			return Options{}, nil
+		}
+		return Options{}, fmt.Errorf("error getting options of %s: %v", abv, err)
+	}
+	return parseOptions(options)
+}
+
+func (d *PostgresDB) SetPassword(abv, hash string) error {
+	ctx, cancel := newPgContext()
+	defer cancel()
+
+	sql := `UPDATE short_urls SET password = $1 WHERE abbreviation = $2 AND domain = $3`
+	if _, err := d.pool.Exec(ctx, sql, hash, abv, d.domain); err != nil {
+		return fmt.Errorf("couldn't set password of %s: %v", abv, err)
+	}
+	return nil
+}
+
+func (d *PostgresDB) AddTags(abv string, tags []string) error {
+	ctx, cancel := newPgContext()
+	defer cancel()
+
+	sql := `
+		INSERT INTO link_tags (short_url_id, tag)
+		SELECT id, tag FROM short_urls, unnest($1::text[]) AS tag
+		WHERE abbreviation = $2 AND domain = $3
+		ON CONFLICT DO NOTHING
+	`
+	if _, err := d.pool.Exec(ctx, sql, tags, abv, d.domain); err != nil {
+		return fmt.Errorf("couldn't tag %s: %v", abv, err)
+	}
+	return nil
+}
+
+func (d *PostgresDB) RemoveTags(abv string, tags []string) error {
+	ctx, cancel := newPgContext()
+	defer cancel()
+
+	sql := `
+		DELETE FROM link_tags
+		WHERE tag = ANY($1) AND short_url_id = (SELECT id FROM short_urls WHERE abbreviation = $2 AND domain = $3)
+	`
+	if _, err := d.pool.Exec(ctx, sql, tags, abv, d.domain); err != nil {
+		return fmt.Errorf("couldn't untag %s: %v", abv, err)
+	}
+	return nil
+}
+
+func (d *PostgresDB) SetCollection(abv, collection string) error {
+	ctx, cancel := newPgContext()
+	defer cancel()
+
+	sql := `UPDATE short_urls SET collection = $1 WHERE abbreviation = $2 AND domain = $3`
+	if _, err := d.pool.Exec(ctx, sql, collection, abv, d.domain); err != nil {
+		return fmt.Errorf("couldn't set collection of %s: %v", abv, err)
+	}
+	return nil
+}
+
+func (d *PostgresDB) GetGroupLinks(group Group, limit int) ([]Link, error) {
+	ctx, cancel := newPgContext()
+	defer cancel()
+
+	from, column := groupSource(group)
+	sql := `SELECT s.abbreviation, s.url, s.password <> '' FROM ` + from + ` WHERE ` + column + ` = $1 AND s.domain = $3 ORDER BY s.abbreviation LIMIT $2`
+	rows, err := d.pool.Query(ctx, sql, group.Name, limit, d.domain)
+	if err != nil {
+		return nil, fmt.Errorf("error listing links of %s %s: %v", group.Kind, group.Name, err)
+	}
+	defer rows.Close()
+
+	links := make([]Link, 0)
+	for rows.Next() {
+		var link Link
+		if err := rows.Scan(&link.Abbreviation, &link.Url, &link.Protected); err != nil {
+			return nil, fmt.Errorf("error scanning link: %v", err)
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+func (d *PostgresDB) GetGroupStats(group Group, from, to string, limit int) (GroupStats, error) {
+	ctx, cancel := newPgContext()
+	defer cancel()
+
+	source, column := groupSource(group)
+	rows, err := d.pool.Query(ctx, `SELECT s.id, s.abbreviation, s.url, s.hits FROM `+source+` WHERE `+column+` = $1 AND s.domain = $2`, group.Name, d.domain)
+	if err != nil {
+		return GroupStats{}, fmt.Errorf("error getting links of %s %s: %v", group.Kind, group.Name, err)
+	}
+	byId := make(map[int]*groupLink)
+	for rows.Next() {
+		var id int
+		link := groupLink{dailyHits: make(map[string]int)}
+		if err := rows.Scan(&id, &link.abv, &link.url, &link.hits); err != nil {
+			rows.Close()
+			return GroupStats{}, fmt.Errorf("error scanning link: %v", err)
+		}
+		byId[id] = &link
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return GroupStats{}, fmt.Errorf("error getting links of %s %s: %v", group.Kind, group.Name, err)
+	}
+
+	hitsSQL := `
+		SELECT s.id, to_char(h.hit_date, 'YYYY-MM-DD'), h.hits
+		FROM ` + source + `
+		JOIN daily_hits h ON h.short_url_id = s.id
+		WHERE ` + column + ` = $1 AND s.domain = $2 AND h.hit_date BETWEEN $3 AND $4
+	`
+	hitRows, err := d.pool.Query(ctx, hitsSQL, group.Name, d.domain, from, to)
+	if err != nil {
+		return GroupStats{}, fmt.Errorf("error getting hits of %s %s: %v", group.Kind, group.Name, err)
+	}
+	defer hitRows.Close()
+
+	for hitRows.Next() {
+		var id, hits int
+		var date string
+		if err := hitRows.Scan(&id, &date, &hits); err != nil {
+			return GroupStats{}, fmt.Errorf("error scanning hits: %v", err)
+		}
+		if link, ok := byId[id]; ok {
+			link.dailyHits[date] += hits
+		}
+	}
+	if err := hitRows.Err(); err != nil {
+		return GroupStats{}, fmt.Errorf("error getting hits of %s %s: %v", group.Kind, group.Name, err)
+	}
+
+	links := make([]groupLink, 0, len(byId))
+	for _, link := range byId {
+		links = append(links, *link)
+	}
+	return summarizeGroup(d.domain, links, from, to, limit), nil
+}
+
+func (d *PostgresDB) GetPassword(abv string) (string, error) {
+	ctx, cancel := newPgContext()
+	defer cancel()
+
+	var hash string
+	sql := `SELECT password FROM short_urls WHERE abbreviation = $1 AND domain = $2`
+	if err := d.pool.QueryRow(ctx, sql, abv, d.domain).Scan(&hash); err != nil {
+		if err == pgx.ErrNoRows {
+			return "", nil
+		}
+		return "", fmt.Errorf("error getting password of %s: %v", abv, err)
+	}
+	return hash, nil
+}
+
+func (d *PostgresDB) SetHealth(abv string, health Health) error {
+	ctx, cancel := newPgContext()
+	defer cancel()
+
+	sql := `
+		INSERT INTO link_health (short_url_id, status, error, redirects, checked, failures, dead)
+		SELECT id, $1, $2, $3, $4, $5, $6 FROM short_urls WHERE abbreviation = $7 AND domain = $8
+		ON CONFLICT (short_url_id)
+		DO UPDATE SET status = EXCLUDED.status, error = EXCLUDED.error, redirects = EXCLUDED.redirects,
+			checked = EXCLUDED.checked, failures = EXCLUDED.failures, dead = EXCLUDED.dead
+	`
+	_, err := d.pool.Exec(ctx, sql, health.Status, health.Error, redirectsJSON(health.Redirects),
+		health.Checked.UTC(), health.Failures, health.Dead, abv, d.domain)
+	if err != nil {
+		return fmt.Errorf("couldn't record health of %s: %v", abv, err)
+	}
+	return nil
+}
+
+func (d *PostgresDB) GetLinksToCheck(checkedBefore time.Time, limit int) ([]LinkHealth, error) {
+	ctx, cancel := newPgContext()
+	defer cancel()
+
+	sql := `
+		SELECT s.domain, s.abbreviation, s.url, s.password <> '', h.status, h.error, h.redirects, h.checked, h.failures, h.dead
+		FROM short_urls s
+		LEFT JOIN link_health h ON h.short_url_id = s.id
+		WHERE s.blocked = '' AND (h.checked IS NULL OR h.checked < $1)
+		ORDER BY h.checked IS NOT NULL, h.checked, s.abbreviation, s.domain
+		LIMIT $2
+	`
+	links, err := d.queryLinkHealth(ctx, sql, checkedBefore.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error getting links to check: %v", err)
+	}
+	return links, nil
+}
+
+func (d *PostgresDB) GetUnhealthy(limit int) ([]LinkHealth, error) {
+	ctx, cancel := newPgContext()
+	defer cancel()
+
+	sql := `
+		SELECT s.domain, s.abbreviation, s.url, s.password <> '', h.status, h.error, h.redirects, h.checked, h.failures, h.dead
+		FROM link_health h
+		JOIN short_urls s ON s.id = h.short_url_id
+		WHERE h.failures > 0 AND s.domain = $2
+		ORDER BY h.dead DESC, h.failures DESC, s.abbreviation
+		LIMIT $1
+	`
+	links, err := d.queryLinkHealth(ctx, sql, limit, d.domain)
+	if err != nil {
+		return nil, fmt.Errorf("error getting unhealthy links: %v", err)
+	}
+	return links, nil
+}
+
+func (d *PostgresDB) GetDeadLinks(limit int) ([]LinkHealth, error) {
+	ctx, cancel := newPgContext()
+	defer cancel()
+
+	sql := `
+		SELECT s.domain, s.abbreviation, s.url, s.password <> '', h.status, h.error, h.redirects, h.checked, h.failures, h.dead
+		FROM link_health h
+		JOIN short_urls s ON s.id = h.short_url_id
+		WHERE h.dead
+		ORDER BY h.failures DESC, s.abbreviation, s.domain
+		LIMIT $1
+	`
+	links, err := d.queryLinkHealth(ctx, sql, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error getting dead links: %v", err)
+	}
+	return links, nil
+}
+
+// queryLinkHealth reads rows of domain, abbreviation, url, whether it's protected and the link_health columns, which are null for links never checked
+func (d *PostgresDB) queryLinkHealth(ctx context.Context, query string, args ...any) ([]LinkHealth, error) {
+	rows, err := d.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := make([]LinkHealth, 0)
+	for rows.Next() {
+		var lh LinkHealth
+		var status, failures *int
+		var checkErr, redirects *string
+		var checked *time.Time
+		var dead *bool
+		if err := rows.Scan(&lh.Domain, &lh.Abbreviation, &lh.Url, &lh.Protected, &status, &checkErr, &redirects, &checked, &failures, &dead); err != nil {
+			return nil, err
+		}
+		if checked != nil {
+			lh.Health = Health{
+				Status:    *status,
+				Error:     *checkErr,
+				Redirects: parseRedirects(*redirects),
+				Checked:   *checked,
+				Failures:  *failures,
+				Dead:      *dead,
+			}
+		}
+		links = append(links, lh)
+	}
+	return links, rows.Err()
+}
+
+func (d *PostgresDB) SetMetadata(abv string, metadata Metadata) error {
+	ctx, cancel := newPgContext()
+	defer cancel()
+
+	sql := `
+		INSERT INTO link_metadata (short_url_id, title, description, image, site_name, favicon, error, fetched)
+		SELECT id, $1, $2, $3, $4, $5, $6, $7 FROM short_urls WHERE abbreviation = $8 AND domain = $9
+		ON CONFLICT (short_url_id)
+		DO UPDATE SET title = EXCLUDED.title, description = EXCLUDED.description, image = EXCLUDED.image,
+			site_name = EXCLUDED.site_name, favicon = EXCLUDED.favicon, error = EXCLUDED.error, fetched = EXCLUDED.fetched
+	`
+	_, err := d.pool.Exec(ctx, sql, metadata.Title, metadata.Description, metadata.Image, metadata.SiteName,
+		metadata.Favicon, metadata.Error, metadata.Fetched.UTC(), abv, d.domain)
+	if err != nil {
+		return fmt.Errorf("couldn't store metadata of %s: %v", abv, err)
+	}
+	return nil
+}
+
+func (d *PostgresDB) GetStaleMetadata(fetchedBefore time.Time, limit int) ([]LinkMetadata, error) {
+	ctx, cancel := newPgContext()
+	defer cancel()
+
+	sql := `
+		SELECT s.domain, s.abbreviation, s.url, m.title, m.description, m.image, m.site_name, m.favicon, m.error, m.fetched
+		FROM short_urls s
+		LEFT JOIN link_metadata m ON m.short_url_id = s.id
+		WHERE s.blocked = '' AND (m.fetched IS NULL OR m.fetched < $1)
+		ORDER BY m.fetched IS NOT NULL, m.fetched, s.abbreviation, s.domain
+		LIMIT $2
+	`
+	links, err := d.queryLinkMetadata(ctx, sql, fetchedBefore.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error getting links with stale metadata: %v", err)
+	}
+	return links, nil
+}
+
+// queryLinkMetadata reads rows of domain, abbreviation, url and the link_metadata columns, which are null for links never fetched
+func (d *PostgresDB) queryLinkMetadata(ctx context.Context, query string, args ...any) ([]LinkMetadata, error) {
+	rows, err := d.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := make([]LinkMetadata, 0)
+	for rows.Next() {
+		var lm LinkMetadata
+		var title, description, image, siteName, favicon, fetchErr *string
+		var fetched *time.Time
+		if err := rows.Scan(&lm.Domain, &lm.Abbreviation, &lm.Url, &title, &description, &image, &siteName, &favicon, &fetchErr, &fetched); err != nil {
+			return nil, err
+		}
+		if fetched != nil {
+			lm.Metadata = Metadata{
+				Title:       *title,
+				Description: *description,
+				Image:       *image,
+				SiteName:    *siteName,
+				Favicon:     *favicon,
+				Error:       *fetchErr,
+				Fetched:     *fetched,
+			}
+		}
+		links = append(links, lm)
+	}
+	return links, rows.Err()
+}
+
+func (d *PostgresDB) GetHourlyHits(abv string, from, to time.Time) (map[time.Time]int, error) {
+	ctx, cancel := newPgContext()
+	defer cancel()
+
+	sql := `
+		SELECT h.hit_hour, h.hits
+		FROM hourly_hits h
+		JOIN short_urls s ON s.id = h.short_url_id
+		WHERE s.abbreviation = $1 AND s.domain = $4 AND h.hit_hour >= $2 AND h.hit_hour < $3
+	`
+	rows, err := d.pool.Query(ctx, sql, abv, from, to, d.domain)
+	if err != nil {
+		return nil, fmt.Errorf("error getting hourly hits for %s: %v", abv, err)
+	}
+	defer rows.Close()
+
+	hits := make(map[time.Time]int)
+	for rows.Next() {
+		var hour time.Time
+		var count int
+		if err := rows.Scan(&hour, &count); err != nil {
+			return nil, fmt.Errorf("error scanning hourly hits for %s: %v", abv, err)
+		}
+		hits[hour.UTC()] = count
+	}
+
+	return hits, rows.Err()
+}
+
+func (d *PostgresDB) CountUniques(abv string, buckets [][]string) ([]int64, error) {
+	first, last, ok := dateRange(buckets)
+	if !ok {
+		return countBuckets(nil, buckets), nil
+	}
+
+	ctx, cancel := newPgContext()
+	defer cancel()
+
+	sql := `
+		SELECT v.period, v.sketch
+		FROM visitor_sketches v
+		JOIN short_urls s ON s.id = v.short_url_id
+		WHERE s.abbreviation = $1 AND s.domain = $4 AND v.period BETWEEN $2 AND $3
+	`
+	sketches, err := d.querySketches(ctx, sql, abv, first, last, d.domain)
+	if err != nil {
+		return nil, fmt.Errorf("error counting uniques for %s: %v", abv, err)
+	}
+	return countBuckets(sketches, buckets), nil
+}
+
+func (d *PostgresDB) GetGlobalStats(from, to string, limit int) (GlobalStats, error) {
+	priorFrom, _, err := PriorWindow(from, to)
+	if err != nil {
+		return GlobalStats{}, err
+	}
+	start, end := windowTimes(from, to)
+
+	ctx, cancel := newPgContext()
+	defer cancel()
+
+	var stats GlobalStats
+
+	hitsPerDaySQL := `
+		SELECT to_char(h.hit_date, 'YYYY-MM-DD'), SUM(h.hits)
+		FROM daily_hits h
+		JOIN short_urls s ON s.id = h.short_url_id
+		WHERE h.hit_date BETWEEN $1 AND $2 AND s.domain = $3
+		GROUP BY h.hit_date
+	`
+	if stats.HitsPerDay, err = d.queryDayCounts(ctx, hitsPerDaySQL, from, to, d.domain); err != nil {
+		return GlobalStats{}, fmt.Errorf("error getting hits per day: %v", err)
+	}
+
+	createdPerDaySQL := `
+		SELECT to_char(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS created_day, COUNT(*)
+		FROM short_urls
+		WHERE created_at >= $1 AND created_at < $2 AND domain = $3
+		GROUP BY created_day
+	`
+	if stats.CreatedPerDay, err = d.queryDayCounts(ctx, createdPerDaySQL, start, end, d.domain); err != nil {
+		return GlobalStats{}, fmt.Errorf("error getting links created per day: %v", err)
+	}
+
+	topLinksSQL := `
+		SELECT s.domain, s.abbreviation, s.url, SUM(h.hits) AS window_hits, 0
+		FROM daily_hits h
+		JOIN short_urls s ON s.id = h.short_url_id
+		WHERE h.hit_date BETWEEN $1 AND $2 AND s.domain = $4
+		GROUP BY s.id, s.domain, s.abbreviation, s.url
+		ORDER BY window_hits DESC, s.abbreviation, s.domain
+		LIMIT $3
+	`
+	if stats.TopLinks, err = d.queryLinkCounts(ctx, topLinksSQL, from, to, limit, d.domain); err != nil {
+		return GlobalStats{}, fmt.Errorf("error getting top links: %v", err)
+	}
+
+	trendingSQL := `
+		SELECT domain, abbreviation, url, window_hits, prior_hits
+		FROM (
+			SELECT s.domain, s.abbreviation, s.url,
+				SUM(CASE WHEN h.hit_date >= $1 THEN h.hits ELSE 0 END) AS window_hits,
+				SUM(CASE WHEN h.hit_date < $2 THEN h.hits ELSE 0 END) AS prior_hits
+			FROM daily_hits h
+			JOIN short_urls s ON s.id = h.short_url_id
+			WHERE h.hit_date BETWEEN $3 AND $4 AND s.domain = $6
+			GROUP BY s.id, s.domain, s.abbreviation, s.url
+		) t
+		WHERE window_hits > prior_hits
+		ORDER BY window_hits - prior_hits DESC, abbreviation, domain
+		LIMIT $5
+	`
+	if stats.Trending, err = d.queryLinkCounts(ctx, trendingSQL, from, from, priorFrom, to, limit, d.domain); err != nil {
+		return GlobalStats{}, fmt.Errorf("error getting trending links: %v", err)
+	}
+
+	neverClickedSQL := `
+		SELECT domain, abbreviation, url, 0, 0
+		FROM short_urls
+		WHERE hits = 0 AND domain = $2
+		ORDER BY created_at, abbreviation, domain
+		LIMIT $1
+	`
+	if stats.NeverClicked, err = d.queryLinkCounts(ctx, neverClickedSQL, limit, d.domain); err != nil {
+		return GlobalStats{}, fmt.Errorf("error getting never clicked links: %v", err)
+	}
+	if err := d.pool.QueryRow(ctx, `SELECT COUNT(*) FROM short_urls WHERE hits = 0 AND domain = $1`, d.domain).Scan(&stats.NeverClickedTotal); err != nil {
+		return GlobalStats{}, fmt.Errorf("error counting never clicked links: %v", err)
+	}
+
+	return stats, nil
+}
+
+// queryDayCounts reads (date, count) rows
+func (d *PostgresDB) queryDayCounts(ctx context.Context, query string, args ...any) (map[string]int, error) {
+	rows, err := d.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var day string
+		var count int
+		if err := rows.Scan(&day, &count); err != nil {
+			return nil, err
+		}
+		counts[day] = count
+	}
+	return counts, rows.Err()
+}
+
+// queryLinkCounts reads (domain, abbreviation, url, hits, prior hits) rows
+func (d *PostgresDB) queryLinkCounts(ctx context.Context, query string, args ...any) ([]LinkCount, error) {
+	rows, err := d.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := make([]LinkCount, 0)
+	for rows.Next() {
+		var lc LinkCount
+		if err := rows.Scan(&lc.Domain, &lc.Abbreviation, &lc.Url, &lc.Hits, &lc.PriorHits); err != nil {
+			return nil, err
+		}
+		links = append(links, lc)
+	}
+	return links, rows.Err()
+}
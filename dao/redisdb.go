@@ -2,9 +2,13 @@ package dao
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/json"
 	"fmt"
 	"log"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ericfialkowski/shorturl/env"
@@ -13,12 +17,39 @@ import (
 
 type RedisDB struct {
 	client *redis.Client
+	domain string
 }
 
 const (
-	abvKeyPrefix   = "shorturl:abv:"   // Hash: url, hits, last_access
-	urlKeyPrefix   = "shorturl:url:"   // String: abbreviation
-	dailyKeyPrefix = "shorturl:daily:" // Hash: date -> hit count
+	abvKeyPrefix     = "shorturl:abv:"      // Hash: url, hits, last_access, created, blocked, options, password, collection
+	urlKeyPrefix     = "shorturl:url:"      // String: abbreviation
+	dailyKeyPrefix   = "shorturl:daily:"    // Hash: date -> hit count
+	countryKeyPrefix = "shorturl:country:"  // Hash: country -> hit count
+	regionKeyPrefix  = "shorturl:region:"   // Hash: region -> hit count
+	hourlyKeyPrefix  = "shorturl:hourly:"   // Hash: UTC hour -> hit count
+	referrerPrefix   = "shorturl:referrer:" // Hash: referring host -> hit count
+	variantPrefix    = "shorturl:variant:"  // Hash: A/B variant -> hit count
+	botKeyPrefix     = "shorturl:bots:"     // Hash: bot family -> hit count
+	uniqueKeyPrefix  = "shorturl:uv:"       // HyperLogLog per abbreviation and period: <abv>:<UTC date or all>
+	healthKeyPrefix  = "shorturl:health:"   // String: JSON of the last check of the destination
+	metadataPrefix   = "shorturl:meta:"     // String: JSON of the metadata of the destination
+	tagsKeyPrefix    = "shorturl:tags:"     // Set: tags of the link
+	groupKeyPrefix   = "shorturl:group:"    // Sorted set per <tag or collection>:<name>, with :<domain> for other domains: abbreviations scored 0
+
+	// global rollups, kept up to date on every save and hit so analytics never scan the links
+	globalHitsKeyPrefix = "shorturl:global:hits:"     // Sorted set per UTC date, with :<domain> for other domains: abbreviation -> hits
+	globalDailyKey      = "shorturl:global:daily"     // Hash, with :<domain> for other domains: UTC date -> hits on every link, deleted ones too
+	globalCreatedKey    = "shorturl:global:created"   // Hash, with :<domain> for other domains: UTC date -> links created, deleted ones too
+	unclickedKey        = "shorturl:global:unclicked" // Sorted set, with :<domain> for other domains: abbreviation -> creation time, for links never hit
+	checkedKey          = "shorturl:global:checked"   // Sorted set: abbreviation -> last check time, 0 if never, for links that aren't blocked
+	unhealthyKey        = "shorturl:global:unhealthy" // Sorted set: abbreviation -> consecutive failed checks
+	fetchedKey          = "shorturl:global:fetched"   // Sorted set: abbreviation -> last metadata fetch time, 0 if never, for links that aren't blocked
+	namesKey            = "shorturl:global:names"     // Sorted set: every abbreviation, scored 0 so they're in name order, with :<domain> for other domains
+	tmpKeyPrefix        = "shorturl:tmp:"
+
+	// links outside the default domain are keyed, and listed in the rollups, as @<domain>/<abbreviation>.
+	// Names can't contain @, so these never clash with the default domain's.
+	domainRefPrefix = "@"
 )
 
 func newRedisContext() (context.Context, context.CancelFunc) {
@@ -69,12 +100,47 @@ func (d *RedisDB) IsLikelyOk() bool {
 	return true
 }
 
+func (d *RedisDB) ForDomain(domain string) ShortUrlDao {
+	return &RedisDB{client: d.client, domain: domain}
+}
+
+// ref is what abv, or a url, is keyed under in the dao's domain
+func (d *RedisDB) ref(abv string) string {
+	if d.domain == "" {
+		return abv
+	}
+	return domainRefPrefix + d.domain + "/" + abv
+}
+
+// parseRef splits a ref listed in the rollups into its domain and abbreviation
+func parseRef(ref string) (string, string) {
+	if rest, ok := strings.CutPrefix(ref, domainRefPrefix); ok {
+		if domain, abv, ok := strings.Cut(rest, "/"); ok {
+			return domain, abv
+		}
+	}
+	return "", ref
+}
+
+// namesKey is the sorted set of the names in the dao's domain
+func (d *RedisDB) namesKey() string {
+	return d.domainKey(namesKey)
+}
+
+// domainKey is the key of a rollup kept for each domain, for the dao's domain
+func (d *RedisDB) domainKey(key string) string {
+	if d.domain == "" {
+		return key
+	}
+	return key + ":" + d.domain
+}
+
 func (d *RedisDB) Save(abv string, url string) error {
 	ctx, cancel := newRedisContext()
 	defer cancel()
 
-	abvKey := abvKeyPrefix + abv
-	urlKey := urlKeyPrefix + url
+	abvKey := abvKeyPrefix + d.ref(abv)
+	urlKey := urlKeyPrefix + d.ref(url)
 
 	// Check if abbreviation already exists with a different URL
 	existingUrl, err := d.client.HGet(ctx, abvKey, "url").Result()
@@ -89,6 +155,15 @@ func (d *RedisDB) Save(abv string, url string) error {
 		"hits": 0,
 	})
 	pipe.Set(ctx, urlKey, abv, 0)
+	pipe.ZAddNX(ctx, d.namesKey(), redis.Z{Score: 0, Member: abv})
+	if err == redis.Nil {
+		now := time.Now()
+		pipe.HSet(ctx, abvKey, "created", now.Format(time.RFC3339))
+		pipe.HIncrBy(ctx, d.domainKey(globalCreatedKey), now.UTC().Format(dateLayout), 1)
+		pipe.ZAddNX(ctx, d.domainKey(unclickedKey), redis.Z{Score: float64(now.Unix()), Member: d.ref(abv)})
+		pipe.ZAddNX(ctx, checkedKey, redis.Z{Score: 0, Member: d.ref(abv)})
+		pipe.ZAddNX(ctx, fetchedKey, redis.Z{Score: 0, Member: d.ref(abv)})
+	}
 
 	if _, err := pipe.Exec(ctx); err != nil {
 		return fmt.Errorf("couldn't store (%s, %s): %v", abv, url, err)
@@ -101,7 +176,7 @@ func (d *RedisDB) DeleteAbv(abv string) error {
 	ctx, cancel := newRedisContext()
 	defer cancel()
 
-	abvKey := abvKeyPrefix + abv
+	abvKey := abvKeyPrefix + d.ref(abv)
 
 	// Get the URL first so we can delete the reverse mapping
 	url, err := d.client.HGet(ctx, abvKey, "url").Result()
@@ -112,14 +187,15 @@ func (d *RedisDB) DeleteAbv(abv string) error {
 		return fmt.Errorf("couldn't get URL for abbreviation %s: %v", abv, err)
 	}
 
-	urlKey := urlKeyPrefix + url
-	dailyKey := dailyKeyPrefix + abv
+	urlKey := urlKeyPrefix + d.ref(url)
 
 	// Delete all related keys
 	pipe := d.client.TxPipeline()
 	pipe.Del(ctx, abvKey)
 	pipe.Del(ctx, urlKey)
-	pipe.Del(ctx, dailyKey)
+	pipe.Del(ctx, statsKeys(d.ref(abv))...)
+	pipe.Del(ctx, d.uniqueKeys(ctx, abv)...)
+	d.removeFromRollups(ctx, pipe, abv)
 
 	if _, err := pipe.Exec(ctx); err != nil {
 		return fmt.Errorf("couldn't delete abbreviation %s: %v", abv, err)
@@ -132,7 +208,7 @@ func (d *RedisDB) DeleteUrl(url string) error {
 	ctx, cancel := newRedisContext()
 	defer cancel()
 
-	urlKey := urlKeyPrefix + url
+	urlKey := urlKeyPrefix + d.ref(url)
 
 	// Get the abbreviation first so we can delete the forward mapping
 	abv, err := d.client.Get(ctx, urlKey).Result()
@@ -143,14 +219,15 @@ func (d *RedisDB) DeleteUrl(url string) error {
 		return fmt.Errorf("couldn't get abbreviation for URL %s: %v", url, err)
 	}
 
-	abvKey := abvKeyPrefix + abv
-	dailyKey := dailyKeyPrefix + abv
+	abvKey := abvKeyPrefix + d.ref(abv)
 
 	// Delete all related keys
 	pipe := d.client.TxPipeline()
 	pipe.Del(ctx, abvKey)
 	pipe.Del(ctx, urlKey)
-	pipe.Del(ctx, dailyKey)
+	pipe.Del(ctx, statsKeys(d.ref(abv))...)
+	pipe.Del(ctx, d.uniqueKeys(ctx, abv)...)
+	d.removeFromRollups(ctx, pipe, abv)
 
 	if _, err := pipe.Exec(ctx); err != nil {
 		return fmt.Errorf("couldn't delete URL %s: %v", url, err)
@@ -160,31 +237,77 @@ func (d *RedisDB) DeleteUrl(url string) error {
 }
 
 func (d *RedisDB) GetUrl(abv string) (string, error) {
+	return unblocked(d.GetUrlWithHit(abv, NewHit()))
+}
+
+func (d *RedisDB) LookupUrl(abv string) (string, error) {
 	ctx, cancel := newRedisContext()
 	defer cancel()
 
-	abvKey := abvKeyPrefix + abv
-
-	url, err := d.client.HGet(ctx, abvKey, "url").Result()
-	if err == redis.Nil {
-		return "", nil
-	}
+	fields, err := d.client.HMGet(ctx, abvKeyPrefix+d.ref(abv), "url", "blocked").Result()
 	if err != nil {
 		return "", fmt.Errorf("error getting URL for %s: %v", abv, err)
 	}
+	url, _ := fields[0].(string)
+	if url == "" {
+		return "", nil
+	}
+	if blocked, _ := fields[1].(string); blocked != "" {
+		return url, &BlockedError{Abv: abv, Reason: blocked}
+	}
+	return url, nil
+}
+
+func (d *RedisDB) GetUrlWithHit(abv string, hit Hit) (string, error) {
+	url, err := d.LookupUrl(abv)
+	if err != nil || url == "" {
+		return url, err
+	}
+	abvKey := abvKeyPrefix + d.ref(abv)
 
 	// Update stats asynchronously
 	go func() {
 		ctx, cancel := newRedisContext()
 		defer cancel()
 
-		dailyKey := dailyKeyPrefix + abv
-		date := Date()
+		// Bots only count towards the bot stats
+		if hit.Bot != "" {
+			if err := d.client.HIncrBy(ctx, botKeyPrefix+d.ref(abv), hit.Bot, 1).Err(); err != nil {
+				log.Printf("Error updating Redis bot stats: %v", err)
+			}
+			return
+		}
+
+		dailyKey := dailyKeyPrefix + d.ref(abv)
 
 		pipe := d.client.TxPipeline()
 		pipe.HIncrBy(ctx, abvKey, "hits", 1)
-		pipe.HSet(ctx, abvKey, "last_access", time.Now().Format(time.RFC3339))
-		pipe.HIncrBy(ctx, dailyKey, date, 1)
+		pipe.HSet(ctx, abvKey, "last_access", hit.Time.Format(time.RFC3339))
+		pipe.HIncrBy(ctx, dailyKey, hit.Date(), 1)
+		pipe.HIncrBy(ctx, hourlyKeyPrefix+d.ref(abv), hit.Hour().Format(hourLayout), 1)
+		if hit.Country != "" {
+			pipe.HIncrBy(ctx, countryKeyPrefix+d.ref(abv), hit.Country, 1)
+		}
+		if hit.Region != "" {
+			pipe.HIncrBy(ctx, regionKeyPrefix+d.ref(abv), hit.Region, 1)
+		}
+		if hit.Referrer != "" {
+			pipe.HIncrBy(ctx, referrerPrefix+d.ref(abv), hit.Referrer, 1)
+		}
+		if hit.Variant != "" {
+			pipe.HIncrBy(ctx, variantPrefix+d.ref(abv), hit.Variant, 1)
+		}
+		pipe.ZIncrBy(ctx, d.domainKey(globalHitsKeyPrefix+hit.Date()), 1, d.ref(abv))
+		pipe.HIncrBy(ctx, d.domainKey(globalDailyKey), hit.Date(), 1)
+		pipe.ZRem(ctx, d.domainKey(unclickedKey), d.ref(abv))
+		// links saved before health checks, metadata and searching existed join them once they're used
+		pipe.ZAddNX(ctx, checkedKey, redis.Z{Score: 0, Member: d.ref(abv)})
+		pipe.ZAddNX(ctx, fetchedKey, redis.Z{Score: 0, Member: d.ref(abv)})
+		pipe.ZAddNX(ctx, d.namesKey(), redis.Z{Score: 0, Member: abv})
+		if hit.Visitor != "" {
+			pipe.PFAdd(ctx, uniqueKey(d.ref(abv), hit.Date()), hit.Visitor)
+			pipe.PFAdd(ctx, uniqueKey(d.ref(abv), allTimePeriod), hit.Visitor)
+		}
 
 		if _, err := pipe.Exec(ctx); err != nil {
 			log.Printf("Error updating Redis stats: %v", err)
@@ -198,7 +321,7 @@ func (d *RedisDB) GetAbv(url string) (string, error) {
 	ctx, cancel := newRedisContext()
 	defer cancel()
 
-	urlKey := urlKeyPrefix + url
+	urlKey := urlKeyPrefix + d.ref(url)
 
 	abv, err := d.client.Get(ctx, urlKey).Result()
 	if err == redis.Nil {
@@ -215,7 +338,7 @@ func (d *RedisDB) GetStats(abv string) (ShortUrl, error) {
 	ctx, cancel := newRedisContext()
 	defer cancel()
 
-	abvKey := abvKeyPrefix + abv
+	abvKey := abvKeyPrefix + d.ref(abv)
 
 	// Get all fields from the abbreviation hash
 	result, err := d.client.HGetAll(ctx, abvKey).Result()
@@ -228,8 +351,17 @@ func (d *RedisDB) GetStats(abv string) (ShortUrl, error) {
 	}
 
 	var data ShortUrl
+	data.Domain = d.domain
 	data.Abbreviation = abv
 	data.Url = result["url"]
+	data.Blocked = result["blocked"]
+	data.Protected = result["password"] != ""
+	data.Collection = result["collection"]
+	if o, err := parseOptions(result["options"]); err != nil {
+		log.Printf("Error reading options of %s: %v", abv, err)
+	} else {
+		data.Options = optionsPtr(o)
+	}
 
 	if hitsStr, ok := result["hits"]; ok {
 		hits, _ := strconv.ParseInt(hitsStr, 10, 32)
@@ -243,7 +375,7 @@ func (d *RedisDB) GetStats(abv string) (ShortUrl, error) {
 	}
 
 	// Get daily hits
-	dailyKey := dailyKeyPrefix + abv
+	dailyKey := dailyKeyPrefix + d.ref(abv)
 	dailyHits, err := d.client.HGetAll(ctx, dailyKey).Result()
 	if err != nil {
 		log.Printf("Error getting daily hits for %s: %v", abv, err)
@@ -256,5 +388,761 @@ func (d *RedisDB) GetStats(abv string) (ShortUrl, error) {
 		}
 	}
 
+	// Get the tags
+	if tags, err := d.client.SMembers(ctx, tagsKeyPrefix+d.ref(abv)).Result(); err != nil {
+		log.Printf("Error getting tags for %s: %v", abv, err)
+	} else if len(tags) > 0 {
+		slices.Sort(tags)
+		data.Tags = tags
+	}
+
+	// Get country and region hits
+	data.CountryHits = d.getCounts(ctx, countryKeyPrefix+d.ref(abv))
+	data.RegionHits = d.getCounts(ctx, regionKeyPrefix+d.ref(abv))
+	data.ReferrerHits = d.getCounts(ctx, referrerPrefix+d.ref(abv))
+	data.VariantHits = d.getCounts(ctx, variantPrefix+d.ref(abv))
+
+	// Get bot hits per family
+	data.BotFamilies = d.getCounts(ctx, botKeyPrefix+d.ref(abv))
+	for _, hits := range data.BotFamilies {
+		data.BotHits += int32(hits)
+	}
+
+	// Get the last check of the destination
+	if health, err := d.client.Get(ctx, healthKeyPrefix+d.ref(abv)).Result(); err == nil {
+		data.Health = &Health{}
+		if err := json.Unmarshal([]byte(health), data.Health); err != nil {
+			log.Printf("Error decoding health of %s: %v", abv, err)
+			data.Health = nil
+		}
+	}
+
+	// Get the metadata of the destination
+	if metadata, err := d.client.Get(ctx, metadataPrefix+d.ref(abv)).Result(); err == nil {
+		data.Metadata = &Metadata{}
+		if err := json.Unmarshal([]byte(metadata), data.Metadata); err != nil {
+			log.Printf("Error decoding metadata of %s: %v", abv, err)
+			data.Metadata = nil
+		}
+	}
+
+	// Get unique visitor counts; every day with a unique visitor also has daily hits
+	data.DailyUniques = make(map[string]int64)
+	pipe := d.client.Pipeline()
+	total := pipe.PFCount(ctx, uniqueKey(d.ref(abv), allTimePeriod))
+	daily := make(map[string]*redis.IntCmd, len(data.DailyHits))
+	for date := range data.DailyHits {
+		daily[date] = pipe.PFCount(ctx, uniqueKey(d.ref(abv), date))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Error getting unique visitors for %s: %v", abv, err)
+		return data, nil
+	}
+	data.Uniques = total.Val()
+	for date, cmd := range daily {
+		if cmd.Val() > 0 {
+			data.DailyUniques[date] = cmd.Val()
+		}
+	}
+
 	return data, nil
 }
+
+func (d *RedisDB) FindLink(names []string) (Link, error) {
+	ctx, cancel := newRedisContext()
+	defer cancel()
+
+	urls, err := d.getUrls(ctx, names)
+	if err != nil {
+		return Link{}, err
+	}
+	found := make(map[string]string)
+	for i, name := range names {
+		if urls[i] != "" {
+			found[name] = urls[i]
+		}
+	}
+	return firstLink(names, found), nil
+}
+
+func (d *RedisDB) SearchLinks(prefix string, limit int) ([]Link, error) {
+	ctx, cancel := newRedisContext()
+	defer cancel()
+
+	// names are all scored 0, so they can be ranged over lexically
+	rangeBy := &redis.ZRangeBy{Min: "-", Max: "+", Count: int64(limit)}
+	if prefix != "" {
+		rangeBy.Min, rangeBy.Max = "["+prefix, "["+prefix+"\xff"
+	}
+	names, err := d.client.ZRangeByLex(ctx, d.namesKey(), rangeBy).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error searching links: %v", err)
+	}
+	return d.getLinks(ctx, names)
+}
+
+// getLinks returns the links named names
+func (d *RedisDB) getLinks(ctx context.Context, names []string) ([]Link, error) {
+	pipe := d.client.Pipeline()
+	cmds := make([]*redis.SliceCmd, len(names))
+	for i, name := range names {
+		cmds[i] = pipe.HMGet(ctx, abvKeyPrefix+d.ref(name), "url", "password")
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("error getting links: %v", err)
+	}
+	links := make([]Link, 0, len(names))
+	for i, name := range names {
+		fields := cmds[i].Val()
+		url, _ := fields[0].(string)
+		password, _ := fields[1].(string)
+		links = append(links, Link{Abbreviation: name, Url: url, Protected: password != ""})
+	}
+	return links, nil
+}
+
+// getUrls returns the url of each of names, empty for ones that aren't links
+func (d *RedisDB) getUrls(ctx context.Context, names []string) ([]string, error) {
+	pipe := d.client.Pipeline()
+	cmds := make([]*redis.StringCmd, len(names))
+	for i, name := range names {
+		cmds[i] = pipe.HGet(ctx, abvKeyPrefix+d.ref(name), "url")
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("error getting urls: %v", err)
+	}
+	urls := make([]string, len(names))
+	for i, cmd := range cmds {
+		urls[i] = cmd.Val()
+	}
+	return urls, nil
+}
+
+func (d *RedisDB) SetBlocked(abv, reason string) error {
+	ctx, cancel := newRedisContext()
+	defer cancel()
+
+	abvKey := abvKeyPrefix + d.ref(abv)
+
+	if d.client.Exists(ctx, abvKey).Val() == 0 {
+		return nil
+	}
+
+	// blocked links aren't health checked and don't have their metadata fetched
+	pipe := d.client.TxPipeline()
+	if reason == "" {
+		pipe.HDel(ctx, abvKey, "blocked")
+		pipe.ZAddNX(ctx, checkedKey, redis.Z{Score: 0, Member: d.ref(abv)})
+		pipe.ZAddNX(ctx, fetchedKey, redis.Z{Score: 0, Member: d.ref(abv)})
+	} else {
+		pipe.HSet(ctx, abvKey, "blocked", reason)
+		pipe.ZRem(ctx, checkedKey, d.ref(abv))
+		pipe.ZRem(ctx, fetchedKey, d.ref(abv))
+	}
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't block abbreviation %s: %v", abv, err)
+	}
+	return nil
+}
+
+func (d *RedisDB) SetOptions(abv string, options Options) error {
+	ctx, cancel := newRedisContext()
+	defer cancel()
+
+	abvKey := abvKeyPrefix + d.ref(abv)
+
+	if d.client.Exists(ctx, abvKey).Val() == 0 {
+		return nil
+	}
+
+	var err error
+	if encoded := optionsJSON(options); encoded == "" {
+		err = d.client.HDel(ctx, abvKey, "options").Err()
+	} else {
+		err = d.client.HSet(ctx, abvKey, "options", encoded).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't set options of %s: %v", abv, err)
+	}
+	return nil
+}
+
+func (d *RedisDB) GetOptions(abv string) (Options, error) {
+	ctx, cancel := newRedisContext()
+	defer cancel()
+
+	options, err := d.client.HGet(ctx, abvKeyPrefix+d.ref(abv), "options").Result()
+	if err != nil && err != redis.Nil {
+		return Options{}, fmt.Errorf("error getting options of %s: %v", abv, err)
+	}
+	return parseOptions(options)
+}
+
+func (d *RedisDB) SetPassword(abv, hash string) error {
+	ctx, cancel := newRedisContext()
+	defer cancel()
+
+	abvKey := abvKeyPrefix + d.ref(abv)
+
+	if d.client.Exists(ctx, abvKey).Val() == 0 {
+		return nil
+	}
+
+	var err error
+	if hash == "" {
+		err = d.client.HDel(ctx, abvKey, "password").Err()
+	} else {
+		err = d.client.HSet(ctx, abvKey, "password", hash).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't set password of %s: %v", abv, err)
+	}
+	return nil
+}
+
+// groupKey is the sorted set of the names of the links of group in the dao's domain
+func (d *RedisDB) groupKey(group Group) string {
+	key := groupKeyPrefix + group.Kind + ":" + group.Name
+	if d.domain == "" {
+		return key
+	}
+	return key + ":" + d.domain
+}
+
+func (d *RedisDB) AddTags(abv string, tags []string) error {
+	ctx, cancel := newRedisContext()
+	defer cancel()
+
+	if d.client.Exists(ctx, abvKeyPrefix+d.ref(abv)).Val() == 0 || len(tags) == 0 {
+		return nil
+	}
+
+	pipe := d.client.TxPipeline()
+	for _, tag := range tags {
+		pipe.SAdd(ctx, tagsKeyPrefix+d.ref(abv), tag)
+		pipe.ZAdd(ctx, d.groupKey(Group{Kind: TagGroup, Name: tag}), redis.Z{Score: 0, Member: abv})
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("couldn't tag %s: %v", abv, err)
+	}
+	return nil
+}
+
+func (d *RedisDB) RemoveTags(abv string, tags []string) error {
+	ctx, cancel := newRedisContext()
+	defer cancel()
+
+	if len(tags) == 0 {
+		return nil
+	}
+
+	pipe := d.client.TxPipeline()
+	for _, tag := range tags {
+		pipe.SRem(ctx, tagsKeyPrefix+d.ref(abv), tag)
+		pipe.ZRem(ctx, d.groupKey(Group{Kind: TagGroup, Name: tag}), abv)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("couldn't untag %s: %v", abv, err)
+	}
+	return nil
+}
+
+func (d *RedisDB) SetCollection(abv, collection string) error {
+	ctx, cancel := newRedisContext()
+	defer cancel()
+
+	abvKey := abvKeyPrefix + d.ref(abv)
+
+	if d.client.Exists(ctx, abvKey).Val() == 0 {
+		return nil
+	}
+
+	pipe := d.client.TxPipeline()
+	if previous := d.client.HGet(ctx, abvKey, "collection").Val(); previous != "" {
+		pipe.ZRem(ctx, d.groupKey(Group{Kind: CollectionGroup, Name: previous}), abv)
+	}
+	if collection == "" {
+		pipe.HDel(ctx, abvKey, "collection")
+	} else {
+		pipe.HSet(ctx, abvKey, "collection", collection)
+		pipe.ZAdd(ctx, d.groupKey(Group{Kind: CollectionGroup, Name: collection}), redis.Z{Score: 0, Member: abv})
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("couldn't set collection of %s: %v", abv, err)
+	}
+	return nil
+}
+
+func (d *RedisDB) GetGroupLinks(group Group, limit int) ([]Link, error) {
+	ctx, cancel := newRedisContext()
+	defer cancel()
+
+	// names are all scored 0, so ranging lexically returns them in order
+	rangeBy := &redis.ZRangeBy{Min: "-", Max: "+", Count: int64(limit)}
+	names, err := d.client.ZRangeByLex(ctx, d.groupKey(group), rangeBy).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error listing links of %s %s: %v", group.Kind, group.Name, err)
+	}
+	return d.getLinks(ctx, names)
+}
+
+func (d *RedisDB) GetGroupStats(group Group, from, to string, limit int) (GroupStats, error) {
+	ctx, cancel := newRedisContext()
+	defer cancel()
+
+	names, err := d.client.ZRange(ctx, d.groupKey(group), 0, -1).Result()
+	if err != nil {
+		return GroupStats{}, fmt.Errorf("error getting links of %s %s: %v", group.Kind, group.Name, err)
+	}
+
+	pipe := d.client.Pipeline()
+	fields := make([]*redis.SliceCmd, len(names))
+	daily := make([]*redis.MapStringStringCmd, len(names))
+	for i, name := range names {
+		fields[i] = pipe.HMGet(ctx, abvKeyPrefix+d.ref(name), "url", "hits")
+		daily[i] = pipe.HGetAll(ctx, dailyKeyPrefix+d.ref(name))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return GroupStats{}, fmt.Errorf("error getting hits of %s %s: %v", group.Kind, group.Name, err)
+	}
+
+	links := make([]groupLink, 0, len(names))
+	for i, name := range names {
+		values := fields[i].Val()
+		url, _ := values[0].(string)
+		hits, _ := values[1].(string)
+		link := groupLink{abv: name, url: url, dailyHits: make(map[string]int)}
+		link.hits, _ = strconv.Atoi(hits)
+		for date, s := range daily[i].Val() {
+			link.dailyHits[date], _ = strconv.Atoi(s)
+		}
+		links = append(links, link)
+	}
+	return summarizeGroup(d.domain, links, from, to, limit), nil
+}
+
+func (d *RedisDB) GetPassword(abv string) (string, error) {
+	ctx, cancel := newRedisContext()
+	defer cancel()
+
+	hash, err := d.client.HGet(ctx, abvKeyPrefix+d.ref(abv), "password").Result()
+	if err != nil && err != redis.Nil {
+		return "", fmt.Errorf("error getting password of %s: %v", abv, err)
+	}
+	return hash, nil
+}
+
+func (d *RedisDB) SetHealth(abv string, health Health) error {
+	ctx, cancel := newRedisContext()
+	defer cancel()
+
+	encoded, err := json.Marshal(health)
+	if err != nil {
+		return fmt.Errorf("couldn't encode health of %s: %v", abv, err)
+	}
+	if d.client.Exists(ctx, abvKeyPrefix+d.ref(abv)).Val() == 0 {
+		return nil
+	}
+
+	pipe := d.client.TxPipeline()
+	pipe.Set(ctx, healthKeyPrefix+d.ref(abv), encoded, 0)
+	// XX leaves links that were blocked since they were listed out of the checks
+	pipe.ZAddXX(ctx, checkedKey, redis.Z{Score: float64(health.Checked.Unix()), Member: d.ref(abv)})
+	if health.Failures > 0 {
+		pipe.ZAdd(ctx, unhealthyKey, redis.Z{Score: float64(health.Failures), Member: d.ref(abv)})
+	} else {
+		pipe.ZRem(ctx, unhealthyKey, d.ref(abv))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("couldn't record health of %s: %v", abv, err)
+	}
+	return nil
+}
+
+func (d *RedisDB) GetLinksToCheck(checkedBefore time.Time, limit int) ([]LinkHealth, error) {
+	ctx, cancel := newRedisContext()
+	defer cancel()
+
+	refs, err := d.client.ZRangeByScore(ctx, checkedKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   "(" + strconv.FormatInt(checkedBefore.Unix(), 10),
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error getting links to check: %v", err)
+	}
+
+	links, err := d.getLinkHealth(ctx, refs)
+	if err != nil {
+		return nil, fmt.Errorf("error getting links to check: %v", err)
+	}
+	return links, nil
+}
+
+func (d *RedisDB) GetUnhealthy(limit int) ([]LinkHealth, error) {
+	ctx, cancel := newRedisContext()
+	defer cancel()
+
+	refs, err := d.client.ZRange(ctx, unhealthyKey, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error getting unhealthy links: %v", err)
+	}
+
+	// the unhealthy links of every domain are kept together for GetDeadLinks
+	refs = slices.DeleteFunc(refs, func(ref string) bool {
+		domain, _ := parseRef(ref)
+		return domain != d.domain
+	})
+	links, err := d.getLinkHealth(ctx, refs)
+	if err != nil {
+		return nil, fmt.Errorf("error getting unhealthy links: %v", err)
+	}
+	sortUnhealthy(links)
+	return links[:min(limit, len(links))], nil
+}
+
+func (d *RedisDB) GetDeadLinks(limit int) ([]LinkHealth, error) {
+	ctx, cancel := newRedisContext()
+	defer cancel()
+
+	refs, err := d.client.ZRange(ctx, unhealthyKey, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error getting dead links: %v", err)
+	}
+
+	links, err := d.getLinkHealth(ctx, refs)
+	if err != nil {
+		return nil, fmt.Errorf("error getting dead links: %v", err)
+	}
+	links = slices.DeleteFunc(links, func(lh LinkHealth) bool { return !lh.Health.Dead })
+	sortUnhealthy(links)
+	return links[:min(limit, len(links))], nil
+}
+
+// getLinkHealth reads the url, whether it's protected and last check of each of refs, skipping ones that no longer exist
+func (d *RedisDB) getLinkHealth(ctx context.Context, refs []string) ([]LinkHealth, error) {
+	pipe := d.client.Pipeline()
+	hashes := make([]*redis.SliceCmd, len(refs))
+	healths := make([]*redis.StringCmd, len(refs))
+	for i, ref := range refs {
+		hashes[i] = pipe.HMGet(ctx, abvKeyPrefix+ref, "url", "password")
+		healths[i] = pipe.Get(ctx, healthKeyPrefix+ref)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	links := make([]LinkHealth, 0, len(refs))
+	for i, ref := range refs {
+		fields := hashes[i].Val()
+		url, _ := fields[0].(string)
+		if url == "" {
+			continue
+		}
+		password, _ := fields[1].(string)
+		domain, abv := parseRef(ref)
+		lh := LinkHealth{Domain: domain, Abbreviation: abv, Url: url, Protected: password != ""}
+		if health := healths[i].Val(); health != "" {
+			if err := json.Unmarshal([]byte(health), &lh.Health); err != nil {
+				log.Printf("Error decoding health of %s: %v", abv, err)
+			}
+		}
+		links = append(links, lh)
+	}
+	return links, nil
+}
+
+func (d *RedisDB) SetMetadata(abv string, metadata Metadata) error {
+	ctx, cancel := newRedisContext()
+	defer cancel()
+
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("couldn't encode metadata of %s: %v", abv, err)
+	}
+	if d.client.Exists(ctx, abvKeyPrefix+d.ref(abv)).Val() == 0 {
+		return nil
+	}
+
+	pipe := d.client.TxPipeline()
+	pipe.Set(ctx, metadataPrefix+d.ref(abv), encoded, 0)
+	// XX leaves links that were blocked since they were listed out of the fetches
+	pipe.ZAddXX(ctx, fetchedKey, redis.Z{Score: float64(metadata.Fetched.Unix()), Member: d.ref(abv)})
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("couldn't store metadata of %s: %v", abv, err)
+	}
+	return nil
+}
+
+func (d *RedisDB) GetStaleMetadata(fetchedBefore time.Time, limit int) ([]LinkMetadata, error) {
+	ctx, cancel := newRedisContext()
+	defer cancel()
+
+	refs, err := d.client.ZRangeByScore(ctx, fetchedKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   "(" + strconv.FormatInt(fetchedBefore.Unix(), 10),
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error getting links with stale metadata: %v", err)
+	}
+
+	pipe := d.client.Pipeline()
+	urls := make([]*redis.StringCmd, len(refs))
+	metadata := make([]*redis.StringCmd, len(refs))
+	for i, ref := range refs {
+		urls[i] = pipe.HGet(ctx, abvKeyPrefix+ref, "url")
+		metadata[i] = pipe.Get(ctx, metadataPrefix+ref)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("error getting links with stale metadata: %v", err)
+	}
+
+	links := make([]LinkMetadata, 0, len(refs))
+	for i, ref := range refs {
+		if urls[i].Val() == "" {
+			continue
+		}
+		domain, abv := parseRef(ref)
+		lm := LinkMetadata{Domain: domain, Abbreviation: abv, Url: urls[i].Val()}
+		if encoded := metadata[i].Val(); encoded != "" {
+			if err := json.Unmarshal([]byte(encoded), &lm.Metadata); err != nil {
+				log.Printf("Error decoding metadata of %s: %v", abv, err)
+			}
+		}
+		links = append(links, lm)
+	}
+	return links, nil
+}
+
+func (d *RedisDB) GetHourlyHits(abv string, from, to time.Time) (map[time.Time]int, error) {
+	ctx, cancel := newRedisContext()
+	defer cancel()
+
+	result, err := d.client.HGetAll(ctx, hourlyKeyPrefix+d.ref(abv)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error getting hourly hits for %s: %v", abv, err)
+	}
+
+	hits := make(map[time.Time]int)
+	for key, hitsStr := range result {
+		hour, err := time.Parse(hourLayout, key)
+		if err != nil {
+			continue
+		}
+		if !hour.Before(from) && hour.Before(to) {
+			hits[hour], _ = strconv.Atoi(hitsStr)
+		}
+	}
+	return hits, nil
+}
+
+func (d *RedisDB) CountUniques(abv string, buckets [][]string) ([]int64, error) {
+	ctx, cancel := newRedisContext()
+	defer cancel()
+
+	counts := make([]int64, len(buckets))
+	cmds := make(map[int]*redis.IntCmd, len(buckets))
+	pipe := d.client.Pipeline()
+	for i, dates := range buckets {
+		if len(dates) == 0 {
+			continue
+		}
+		keys := make([]string, len(dates))
+		for j, date := range dates {
+			keys[j] = uniqueKey(d.ref(abv), date)
+		}
+		// PFCOUNT of several keys counts their union
+		cmds[i] = pipe.PFCount(ctx, keys...)
+	}
+	if len(cmds) == 0 {
+		return counts, nil
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("error counting uniques for %s: %v", abv, err)
+	}
+	for i, cmd := range cmds {
+		counts[i] = cmd.Val()
+	}
+	return counts, nil
+}
+
+// removeFromRollups queues taking a deleted link out of the rollups that list links. The hits and links counted
+// per day stay as they were, since they happened, and the link's hits can't be taken back out of them exactly.
+func (d *RedisDB) removeFromRollups(ctx context.Context, pipe redis.Pipeliner, abv string) {
+	pipe.ZRem(ctx, d.domainKey(unclickedKey), d.ref(abv))
+	pipe.ZRem(ctx, checkedKey, d.ref(abv))
+	pipe.ZRem(ctx, unhealthyKey, d.ref(abv))
+	pipe.ZRem(ctx, fetchedKey, d.ref(abv))
+	pipe.ZRem(ctx, d.namesKey(), abv)
+	for _, tag := range d.client.SMembers(ctx, tagsKeyPrefix+d.ref(abv)).Val() {
+		pipe.ZRem(ctx, d.groupKey(Group{Kind: TagGroup, Name: tag}), abv)
+	}
+	pipe.Del(ctx, tagsKeyPrefix+d.ref(abv))
+	if collection := d.client.HGet(ctx, abvKeyPrefix+d.ref(abv), "collection").Val(); collection != "" {
+		pipe.ZRem(ctx, d.groupKey(Group{Kind: CollectionGroup, Name: collection}), abv)
+	}
+	for date := range d.getCounts(ctx, dailyKeyPrefix+d.ref(abv)) {
+		pipe.ZRem(ctx, d.domainKey(globalHitsKeyPrefix+date), d.ref(abv))
+	}
+}
+
+func (d *RedisDB) GetGlobalStats(from, to string, limit int) (GlobalStats, error) {
+	priorFrom, priorTo, err := PriorWindow(from, to)
+	if err != nil {
+		return GlobalStats{}, err
+	}
+	start, end := windowTimes(from, to)
+	priorStart, priorEnd := windowTimes(priorFrom, priorTo)
+	dates := UTCDates(start, end)
+
+	ctx, cancel := newRedisContext()
+	defer cancel()
+
+	// sum the per-day sorted sets into temporary ones: this window, the prior window, and the growth between them
+	tmp := tmpKeyPrefix + rand.Text()
+	current, prior, growth := tmp+":current", tmp+":prior", tmp+":growth"
+	pipe := d.client.TxPipeline()
+	pipe.ZUnionStore(ctx, current, &redis.ZStore{Keys: d.globalHitsKeys(dates)})
+	pipe.ZUnionStore(ctx, prior, &redis.ZStore{Keys: d.globalHitsKeys(UTCDates(priorStart, priorEnd))})
+	pipe.ZUnionStore(ctx, growth, &redis.ZStore{Keys: []string{current, prior}, Weights: []float64{1, -1}})
+	for _, key := range []string{current, prior, growth} {
+		pipe.Expire(ctx, key, time.Minute)
+	}
+	hitsPerDay := pipe.HMGet(ctx, d.domainKey(globalDailyKey), dates...)
+	createdPerDay := pipe.HMGet(ctx, d.domainKey(globalCreatedKey), dates...)
+	top := pipe.ZRevRangeWithScores(ctx, current, 0, int64(limit-1))
+	trending := pipe.ZRevRangeByScore(ctx, growth, &redis.ZRangeBy{Min: "(0", Max: "+inf", Count: int64(limit)})
+	unclicked := pipe.ZRange(ctx, d.domainKey(unclickedKey), 0, int64(limit-1))
+	unclickedTotal := pipe.ZCard(ctx, d.domainKey(unclickedKey))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return GlobalStats{}, fmt.Errorf("error getting global stats: %v", err)
+	}
+	defer d.client.Del(ctx, current, prior, growth)
+
+	stats := GlobalStats{
+		HitsPerDay:        dateCounts(dates, hitsPerDay.Val()),
+		CreatedPerDay:     dateCounts(dates, createdPerDay.Val()),
+		TopLinks:          make([]LinkCount, 0),
+		Trending:          make([]LinkCount, 0),
+		NeverClicked:      make([]LinkCount, 0),
+		NeverClickedTotal: int(unclickedTotal.Val()),
+	}
+
+	// look up the urls of the listed links, and the hits behind each trend
+	pipe = d.client.Pipeline()
+	urls := make(map[string]*redis.StringCmd)
+	lookup := func(ref string) {
+		if _, ok := urls[ref]; !ok {
+			urls[ref] = pipe.HGet(ctx, abvKeyPrefix+ref, "url")
+		}
+	}
+	for _, z := range top.Val() {
+		lookup(z.Member.(string))
+	}
+	for _, ref := range append(trending.Val(), unclicked.Val()...) {
+		lookup(ref)
+	}
+	var currentHits, priorHits *redis.FloatSliceCmd
+	if len(trending.Val()) > 0 {
+		currentHits = pipe.ZMScore(ctx, current, trending.Val()...)
+		priorHits = pipe.ZMScore(ctx, prior, trending.Val()...)
+	}
+	if len(urls) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return GlobalStats{}, fmt.Errorf("error getting global stats links: %v", err)
+		}
+	}
+
+	for _, z := range top.Val() {
+		ref := z.Member.(string)
+		domain, abv := parseRef(ref)
+		stats.TopLinks = append(stats.TopLinks, LinkCount{Domain: domain, Abbreviation: abv, Url: urls[ref].Val(), Hits: int(z.Score)})
+	}
+	for i, ref := range trending.Val() {
+		domain, abv := parseRef(ref)
+		stats.Trending = append(stats.Trending, LinkCount{
+			Domain:       domain,
+			Abbreviation: abv,
+			Url:          urls[ref].Val(),
+			Hits:         int(currentHits.Val()[i]),
+			PriorHits:    int(priorHits.Val()[i]),
+		})
+	}
+	for _, ref := range unclicked.Val() {
+		domain, abv := parseRef(ref)
+		stats.NeverClicked = append(stats.NeverClicked, LinkCount{Domain: domain, Abbreviation: abv, Url: urls[ref].Val()})
+	}
+
+	return stats, nil
+}
+
+func (d *RedisDB) globalHitsKeys(dates []string) []string {
+	keys := make([]string, len(dates))
+	for i, date := range dates {
+		keys[i] = d.domainKey(globalHitsKeyPrefix + date)
+	}
+	return keys
+}
+
+// dateCounts pairs dates with the HMGET values of their counts, skipping missing ones
+func dateCounts(dates []string, values []any) map[string]int {
+	counts := make(map[string]int)
+	for i, v := range values {
+		if s, ok := v.(string); ok {
+			if n, _ := strconv.Atoi(s); n > 0 {
+				counts[dates[i]] = n
+			}
+		}
+	}
+	return counts
+}
+
+// uniqueKeys returns the HyperLogLog keys of abv, found from the dates in its daily hits
+func (d *RedisDB) uniqueKeys(ctx context.Context, abv string) []string {
+	keys := []string{uniqueKey(d.ref(abv), allTimePeriod)}
+	dates, err := d.client.HKeys(ctx, dailyKeyPrefix+d.ref(abv)).Result()
+	if err != nil {
+		log.Printf("Error getting daily hit dates for %s: %v", abv, err)
+		return keys
+	}
+	for _, date := range dates {
+		keys = append(keys, uniqueKey(d.ref(abv), date))
+	}
+	return keys
+}
+
+func uniqueKey(ref, period string) string {
+	return uniqueKeyPrefix + ref + ":" + period
+}
+
+// getCounts reads a hash of name -> hit count
+func (d *RedisDB) getCounts(ctx context.Context, key string) map[string]int {
+	counts := make(map[string]int)
+	result, err := d.client.HGetAll(ctx, key).Result()
+	if err != nil {
+		log.Printf("Error getting %s: %v", key, err)
+		return counts
+	}
+	for name, hitsStr := range result {
+		hits, _ := strconv.Atoi(hitsStr)
+		counts[name] = hits
+	}
+	return counts
+}
+
+// statsKeys returns all the keys holding stats for the link keyed under ref
+func statsKeys(ref string) []string {
+	return []string{
+		dailyKeyPrefix + ref,
+		countryKeyPrefix + ref,
+		regionKeyPrefix + ref,
+		hourlyKeyPrefix + ref,
+		referrerPrefix + ref,
+		variantPrefix + ref,
+		botKeyPrefix + ref,
+		healthKeyPrefix + ref,
+		metadataPrefix + ref,
+	}
+}
@@ -0,0 +1,119 @@
+package dao
+
+import (
+	"fmt"
+	"time"
+)
+
+// Granularity is the size of the buckets in a hit series
+type Granularity string
+
+const (
+	Hour  Granularity = "hour"
+	Day   Granularity = "day"
+	Week  Granularity = "week"
+	Month Granularity = "month"
+)
+
+// SeriesPoint is the number of hits in the bucket beginning at Start
+type SeriesPoint struct {
+	Start   time.Time `json:"start"`
+	Hits    int       `json:"hits"`
+	Uniques *int64    `json:"uniques,omitempty"`
+}
+
+// ParseGranularity validates s, defaulting to Day when empty
+func ParseGranularity(s string) (Granularity, error) {
+	switch g := Granularity(s); g {
+	case "":
+		return Day, nil
+	case Hour, Day, Week, Month:
+		return g, nil
+	default:
+		return "", fmt.Errorf("unknown granularity %q, expected one of hour, day, week or month", s)
+	}
+}
+
+// Truncate returns the start of the bucket containing t, in t's location. Weeks start on Monday.
+func (g Granularity) Truncate(t time.Time) time.Time {
+	y, m, d := t.Date()
+	switch g {
+	case Hour:
+		// subtract rather than rebuild the time so repeated hours at the end of daylight saving time stay distinct
+		return t.Add(-time.Duration(t.Minute())*time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	case Week:
+		return time.Date(y, m, d-(int(t.Weekday())+6)%7, 0, 0, 0, 0, t.Location())
+	case Month:
+		return time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	}
+}
+
+// Next returns the start of the bucket after the one beginning at start
+func (g Granularity) Next(start time.Time) time.Time {
+	y, m, d := start.Date()
+	switch g {
+	case Hour:
+		return start.Add(time.Hour)
+	case Week:
+		return time.Date(y, m, d+7, 0, 0, 0, 0, start.Location())
+	case Month:
+		return time.Date(y, m+1, 1, 0, 0, 0, 0, start.Location())
+	default:
+		return time.Date(y, m, d+1, 0, 0, 0, 0, start.Location())
+	}
+}
+
+// Duration returns the nominal length of a bucket, ignoring daylight saving time and month lengths
+func (g Granularity) Duration() time.Duration {
+	switch g {
+	case Hour:
+		return time.Hour
+	case Week:
+		return 7 * 24 * time.Hour
+	case Month:
+		return 30 * 24 * time.Hour
+	default:
+		return 24 * time.Hour
+	}
+}
+
+// BuildSeries rolls up UTC hourly hits into an ordered, zero-filled series of buckets in loc,
+// starting with the bucket containing from and ending with the bucket containing to.
+func BuildSeries(hourly map[time.Time]int, from, to time.Time, g Granularity, loc *time.Location) []SeriesPoint {
+	points := make([]SeriesPoint, 0)
+	index := make(map[int64]int)
+	for t := g.Truncate(from.In(loc)); t.Before(to); t = g.Next(t) {
+		index[t.Unix()] = len(points)
+		points = append(points, SeriesPoint{Start: t})
+	}
+
+	for hour, hits := range hourly {
+		if i, ok := index[g.Truncate(hour.In(loc)).Unix()]; ok {
+			points[i].Hits += hits
+		}
+	}
+
+	return points
+}
+
+// UTCDates returns the UTC dates overlapping [from, to), which are the daily buckets covering that range
+func UTCDates(from, to time.Time) []string {
+	var dates []string
+	for d := Day.Truncate(from.UTC()); d.Before(to); d = Day.Next(d) {
+		dates = append(dates, d.Format(dateLayout))
+	}
+	return dates
+}
+
+// HourOfWeek totals UTC hourly hits by the day of the week and hour they fall on in loc. Days start
+// with Monday, like weeks do.
+func HourOfWeek(hourly map[time.Time]int, loc *time.Location) [7][24]int {
+	var totals [7][24]int
+	for hour, hits := range hourly {
+		t := hour.In(loc)
+		totals[(t.Weekday()+6)%7][t.Hour()] += hits
+	}
+	return totals
+}
@@ -0,0 +1,176 @@
+package dao
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseGranularity(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Granularity
+		wantErr bool
+	}{
+		{"", Day, false},
+		{"hour", Hour, false},
+		{"day", Day, false},
+		{"week", Week, false},
+		{"month", Month, false},
+		{"year", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseGranularity(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseGranularity(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("ParseGranularity(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestGranularity_Truncate(t *testing.T) {
+	ts := time.Date(2024, 3, 14, 15, 9, 26, 5, time.UTC) // a Thursday
+
+	tests := []struct {
+		g    Granularity
+		want time.Time
+	}{
+		{Hour, time.Date(2024, 3, 14, 15, 0, 0, 0, time.UTC)},
+		{Day, time.Date(2024, 3, 14, 0, 0, 0, 0, time.UTC)},
+		{Week, time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)},
+		{Month, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		if got := tt.g.Truncate(ts); !got.Equal(tt.want) {
+			t.Errorf("%s.Truncate() = %v, want %v", tt.g, got, tt.want)
+		}
+	}
+
+	// Sunday belongs to the week that started the Monday before
+	sunday := time.Date(2024, 3, 17, 12, 0, 0, 0, time.UTC)
+	if got := Week.Truncate(sunday); !got.Equal(time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Week.Truncate(sunday) = %v, want 2024-03-11", got)
+	}
+}
+
+func TestBuildSeries_ZeroFilled(t *testing.T) {
+	hourly := map[time.Time]int{
+		time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC): 2,
+		time.Date(2024, 3, 1, 11, 0, 0, 0, time.UTC): 3,
+		time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC):  1,
+	}
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+
+	points := BuildSeries(hourly, from, to, Day, time.UTC)
+
+	want := []int{5, 0, 0, 1}
+	if len(points) != len(want) {
+		t.Fatalf("BuildSeries() returned %d points, want %d", len(points), len(want))
+	}
+	for i, p := range points {
+		if p.Hits != want[i] {
+			t.Errorf("BuildSeries()[%d].Hits = %d, want %d", i, p.Hits, want[i])
+		}
+		if wantStart := from.AddDate(0, 0, i); !p.Start.Equal(wantStart) {
+			t.Errorf("BuildSeries()[%d].Start = %v, want %v", i, p.Start, wantStart)
+		}
+	}
+}
+
+func TestBuildSeries_TimeZone(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skipf("no zoneinfo: %v", err)
+	}
+
+	// 2024-03-01 20:00 UTC is 2024-03-02 05:00 in Tokyo
+	hourly := map[time.Time]int{
+		time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC): 1,
+		time.Date(2024, 3, 1, 20, 0, 0, 0, time.UTC): 4,
+	}
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, tokyo)
+	to := time.Date(2024, 3, 3, 0, 0, 0, 0, tokyo)
+
+	points := BuildSeries(hourly, from, to, Day, tokyo)
+
+	if len(points) != 2 {
+		t.Fatalf("BuildSeries() returned %d points, want 2", len(points))
+	}
+	if points[0].Hits != 1 || points[1].Hits != 4 {
+		t.Errorf("BuildSeries() hits = [%d %d], want [1 4]", points[0].Hits, points[1].Hits)
+	}
+	if points[1].Start.Location() != tokyo || points[1].Start.Day() != 2 {
+		t.Errorf("BuildSeries()[1].Start = %v, want 2024-03-02 in Tokyo", points[1].Start)
+	}
+}
+
+func TestBuildSeries_Hourly(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no zoneinfo: %v", err)
+	}
+
+	// daylight saving time ends 2024-11-03 at 2:00 local, repeating the 1:00 hour
+	from := time.Date(2024, 11, 3, 0, 0, 0, 0, newYork)
+	to := from.Add(4 * time.Hour)
+	hourly := map[time.Time]int{
+		time.Date(2024, 11, 3, 5, 0, 0, 0, time.UTC): 1, // first 1:00
+		time.Date(2024, 11, 3, 6, 0, 0, 0, time.UTC): 2, // second 1:00
+	}
+
+	points := BuildSeries(hourly, from, to, Hour, newYork)
+
+	if len(points) != 4 {
+		t.Fatalf("BuildSeries() returned %d points, want 4", len(points))
+	}
+	want := []int{0, 1, 2, 0}
+	for i, p := range points {
+		if p.Hits != want[i] {
+			t.Errorf("BuildSeries()[%d].Hits = %d, want %d", i, p.Hits, want[i])
+		}
+	}
+}
+
+func TestBuildSeries_Monthly(t *testing.T) {
+	hourly := map[time.Time]int{
+		time.Date(2024, 1, 31, 23, 0, 0, 0, time.UTC): 1,
+		time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC): 2,
+	}
+	from := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	points := BuildSeries(hourly, from, to, Month, time.UTC)
+
+	if len(points) != 3 {
+		t.Fatalf("BuildSeries() returned %d points, want 3", len(points))
+	}
+	if points[0].Hits != 1 || points[1].Hits != 2 || points[2].Hits != 0 {
+		t.Errorf("BuildSeries() hits = [%d %d %d], want [1 2 0]", points[0].Hits, points[1].Hits, points[2].Hits)
+	}
+}
+
+func TestHourOfWeek(t *testing.T) {
+	chicago, _ := time.LoadLocation("America/Chicago")
+	hourly := map[time.Time]int{
+		// Monday 2024-03-04 15:00 UTC is 09:00 in Chicago
+		time.Date(2024, 3, 4, 15, 0, 0, 0, time.UTC):  2,
+		time.Date(2024, 3, 11, 14, 0, 0, 0, time.UTC): 3,
+		// Sunday 2024-03-10 03:00 UTC is still Saturday evening in Chicago
+		time.Date(2024, 3, 10, 3, 0, 0, 0, time.UTC): 1,
+	}
+
+	totals := HourOfWeek(hourly, time.UTC)
+	if totals[0][15] != 2 || totals[0][14] != 3 || totals[6][3] != 1 {
+		t.Errorf("HourOfWeek(UTC) = %v", totals)
+	}
+
+	// daylight saving time starts on 2024-03-10, so both Mondays are 09:00 local
+	totals = HourOfWeek(hourly, chicago)
+	if totals[0][9] != 5 || totals[5][21] != 1 {
+		t.Errorf("HourOfWeek(Chicago) = %v", totals)
+	}
+}
@@ -1,18 +1,107 @@
 package dao
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
+// ShortUrlDao stores links. Names and URLs are unique within a domain, and every method taking a link's name
+// or URL works within the domain of the dao it's called on, the default one unless it came from ForDomain.
+// The methods that look for links to check or fetch, and GetDeadLinks, span every domain, as they're for the jobs
+// that look after all of them.
 type ShortUrlDao interface {
 	IsLikelyOk() bool
+	// ForDomain returns a dao for the links of domain, sharing this one's connection. The empty domain is the
+	// default one, holding the links made before there were domains.
+	ForDomain(domain string) ShortUrlDao
 	Save(abv string, url string) error
 	DeleteAbv(abv string) error
 	DeleteUrl(url string) error
 	GetUrl(abv string) (string, error) // TODO: make new method that doesn't update stats on a "hit"
+	// LookupUrl returns the url of abv without counting a hit. For blocked links it returns the url with a
+	// *BlockedError.
+	LookupUrl(abv string) (string, error)
+	// GetUrlWithHit returns the url of abv and counts the hit. For blocked links it returns the url with a
+	// *BlockedError and counts nothing.
+	GetUrlWithHit(abv string, hit Hit) (string, error)
 	GetAbv(url string) (string, error)
 	GetStats(abv string) (ShortUrl, error)
+	// FindLink returns the first of names that's a link, or a zero Link when none of them are
+	FindLink(names []string) (Link, error)
+	// SearchLinks returns up to limit links whose names start with prefix, ordered by name
+	SearchLinks(prefix string, limit int) ([]Link, error)
+	// SetBlocked stops abv from redirecting, recording reason. An empty reason unblocks it.
+	SetBlocked(abv, reason string) error
+	// SetOptions replaces the options that change how abv redirects
+	SetOptions(abv string, options Options) error
+	// GetOptions returns the options of abv, which are zero for links without any and links that don't exist
+	GetOptions(abv string) (Options, error)
+	// SetPassword protects abv with the hash of a password. An empty hash removes the protection.
+	SetPassword(abv, hash string) error
+	// GetPassword returns the hash of the password protecting abv, empty for links without one and links
+	// that don't exist
+	GetPassword(abv string) (string, error)
+	// AddTags tags abv with each of tags it doesn't have yet
+	AddTags(abv string, tags []string) error
+	// RemoveTags takes tags off abv
+	RemoveTags(abv string, tags []string) error
+	// SetCollection puts abv in collection, taking it out of any other. An empty collection takes it out of its own.
+	SetCollection(abv, collection string) error
+	// GetGroupLinks returns up to limit links of group, ordered by name
+	GetGroupLinks(group Group, limit int) ([]Link, error)
+	// GetGroupStats summarizes the links of group over the inclusive UTC dates from and to, returning up to limit top links
+	GetGroupStats(group Group, from, to string, limit int) (GroupStats, error)
+	GetHourlyHits(abv string, from, to time.Time) (map[time.Time]int, error)
+	// CountUniques returns the approximate number of distinct visitors across each bucket of UTC dates
+	CountUniques(abv string, buckets [][]string) ([]int64, error)
+	// SetHealth records the result of checking the destination of abv
+	SetHealth(abv string, health Health) error
+	// GetLinksToCheck returns up to limit links that haven't been checked since before checkedBefore, never
+	// checked ones first. Blocked links are left out.
+	GetLinksToCheck(checkedBefore time.Time, limit int) ([]LinkHealth, error)
+	// GetUnhealthy returns up to limit links whose last check failed, dead ones and the most failures first
+	GetUnhealthy(limit int) ([]LinkHealth, error)
+	// GetDeadLinks returns up to limit links whose destinations are dead, the most failures first
+	GetDeadLinks(limit int) ([]LinkHealth, error)
+	// SetMetadata stores what was fetched from the destination of abv
+	SetMetadata(abv string, metadata Metadata) error
+	// GetStaleMetadata returns up to limit links whose metadata was fetched before fetchedBefore, never
+	// fetched ones first. Blocked links are left out.
+	GetStaleMetadata(fetchedBefore time.Time, limit int) ([]LinkMetadata, error)
+	// GetGlobalStats summarizes every link of the domain over the inclusive UTC dates from and to, returning up to
+	// limit links per list
+	GetGlobalStats(from, to string, limit int) (GlobalStats, error)
 	Cleanup()
 }
 
+// BatchSaver is a dao that can save many links at once, all or none of them. The SQL databases are.
+type BatchSaver interface {
+	// SaveAll saves links in a single transaction. If any of their names or urls is taken, none of them are
+	// saved.
+	SaveAll(links []Link) error
+}
+
+// Date returns the current date in UTC, which is how daily stats are bucketed
 func Date() string {
-	return time.Now().Format("2006-01-02")
+	return time.Now().UTC().Format(dateLayout)
+}
+
+// BlockedError is returned by LookupUrl and GetUrlWithHit for links that have been blocked
+type BlockedError struct {
+	Abv    string
+	Reason string
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("%s is blocked: %s", e.Abv, e.Reason)
+}
+
+// unblocked lets GetUrl, which only needs to know a link exists, treat blocked links like the others
+func unblocked(url string, err error) (string, error) {
+	var blocked *BlockedError
+	if errors.As(err, &blocked) {
+		return url, nil
+	}
+	return url, err
 }
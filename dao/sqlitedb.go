@@ -8,12 +8,17 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ericfialkowski/shorturl/hll"
 	_ "modernc.org/sqlite"
 )
 
+// sqliteTimeLayout is how times are stored so that they sort and compare as text
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
 type SQLiteDB struct {
-	db *sql.DB
-	mu sync.RWMutex
+	db     *sql.DB
+	mu     *sync.RWMutex // shared by the daos of every domain, since SQLite has one writer
+	domain string
 }
 
 // CreateSQLiteDB creates a new SQLite-backed ShortUrlDao.
@@ -38,7 +43,7 @@ func CreateSQLiteDB(dbPath string) ShortUrlDao {
 		log.Printf("Warning: could not set busy timeout: %v", err)
 	}
 
-	sqliteDB := &SQLiteDB{db: db}
+	sqliteDB := &SQLiteDB{db: db, mu: &sync.RWMutex{}}
 	sqliteDB.initSchema()
 
 	return sqliteDB
@@ -52,20 +57,60 @@ func (d *SQLiteDB) initSchema() {
 	createTableSQL := `
 		CREATE TABLE IF NOT EXISTS short_urls (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			abbreviation TEXT NOT NULL UNIQUE,
-			url TEXT NOT NULL UNIQUE,
+			domain TEXT NOT NULL DEFAULT '',
+			abbreviation TEXT NOT NULL,
+			url TEXT NOT NULL,
 			hits INTEGER NOT NULL DEFAULT 0,
 			last_access DATETIME,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			blocked TEXT NOT NULL DEFAULT '',
+			options TEXT NOT NULL DEFAULT '',
+			password TEXT NOT NULL DEFAULT '',
+			collection TEXT NOT NULL DEFAULT '',
+			UNIQUE(domain, abbreviation),
+			UNIQUE(domain, url)
 		);
 		CREATE INDEX IF NOT EXISTS idx_short_urls_abbreviation ON short_urls(abbreviation);
 		CREATE INDEX IF NOT EXISTS idx_short_urls_url ON short_urls(url);
+		CREATE INDEX IF NOT EXISTS idx_short_urls_created_at ON short_urls(created_at);
 	`
 
 	if _, err := d.db.Exec(createTableSQL); err != nil {
 		log.Printf("Error creating short_urls table: %v", err)
 	}
 
+	// Add the columns introduced since short_urls was first created, which fails harmlessly when they exist
+	if _, err := d.db.Exec(`ALTER TABLE short_urls ADD COLUMN blocked TEXT NOT NULL DEFAULT ''`); err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+		log.Printf("Error adding blocked column: %v", err)
+	}
+	if _, err := d.db.Exec(`ALTER TABLE short_urls ADD COLUMN options TEXT NOT NULL DEFAULT ''`); err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+		log.Printf("Error adding options column: %v", err)
+	}
+	if _, err := d.db.Exec(`ALTER TABLE short_urls ADD COLUMN password TEXT NOT NULL DEFAULT ''`); err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+		log.Printf("Error adding password column: %v", err)
+	}
+	if _, err := d.db.Exec(`ALTER TABLE short_urls ADD COLUMN collection TEXT NOT NULL DEFAULT ''`); err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+		log.Printf("Error adding collection column: %v", err)
+	}
+	d.migrateDomains()
+	if _, err := d.db.Exec(`CREATE INDEX IF NOT EXISTS idx_short_urls_collection ON short_urls(domain, collection)`); err != nil {
+		log.Printf("Error creating collection index: %v", err)
+	}
+
+	// Create the link_tags table for the tags of each link
+	createLinkTagsSQL := `
+		CREATE TABLE IF NOT EXISTS link_tags (
+			short_url_id INTEGER NOT NULL REFERENCES short_urls(id) ON DELETE CASCADE,
+			tag TEXT NOT NULL,
+			PRIMARY KEY (short_url_id, tag)
+		);
+		CREATE INDEX IF NOT EXISTS idx_link_tags_tag ON link_tags(tag);
+	`
+
+	if _, err := d.db.Exec(createLinkTagsSQL); err != nil {
+		log.Printf("Error creating link_tags table: %v", err)
+	}
+
 	// Create the daily_hits table for tracking hits per day
 	createDailyHitsSQL := `
 		CREATE TABLE IF NOT EXISTS daily_hits (
@@ -83,12 +128,199 @@ func (d *SQLiteDB) initSchema() {
 		log.Printf("Error creating daily_hits table: %v", err)
 	}
 
+	// Create the hourly_hits table for tracking hits per UTC hour
+	createHourlyHitsSQL := `
+		CREATE TABLE IF NOT EXISTS hourly_hits (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			short_url_id INTEGER NOT NULL REFERENCES short_urls(id) ON DELETE CASCADE,
+			hit_hour DATETIME NOT NULL,
+			hits INTEGER NOT NULL DEFAULT 0,
+			UNIQUE(short_url_id, hit_hour)
+		);
+		CREATE INDEX IF NOT EXISTS idx_hourly_hits_hour ON hourly_hits(hit_hour);
+	`
+
+	if _, err := d.db.Exec(createHourlyHitsSQL); err != nil {
+		log.Printf("Error creating hourly_hits table: %v", err)
+	}
+
+	// Create the geo_hits table for tracking hits per country and region
+	createGeoHitsSQL := `
+		CREATE TABLE IF NOT EXISTS geo_hits (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			short_url_id INTEGER NOT NULL REFERENCES short_urls(id) ON DELETE CASCADE,
+			country TEXT NOT NULL,
+			region TEXT NOT NULL DEFAULT '',
+			hits INTEGER NOT NULL DEFAULT 0,
+			UNIQUE(short_url_id, country, region)
+		);
+		CREATE INDEX IF NOT EXISTS idx_geo_hits_short_url_id ON geo_hits(short_url_id);
+	`
+
+	if _, err := d.db.Exec(createGeoHitsSQL); err != nil {
+		log.Printf("Error creating geo_hits table: %v", err)
+	}
+
+	// Create the referrer_hits table for tracking hits per referring host
+	createReferrerHitsSQL := `
+		CREATE TABLE IF NOT EXISTS referrer_hits (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			short_url_id INTEGER NOT NULL REFERENCES short_urls(id) ON DELETE CASCADE,
+			referrer TEXT NOT NULL,
+			hits INTEGER NOT NULL DEFAULT 0,
+			UNIQUE(short_url_id, referrer)
+		);
+	`
+
+	if _, err := d.db.Exec(createReferrerHitsSQL); err != nil {
+		log.Printf("Error creating referrer_hits table: %v", err)
+	}
+
+	// Create the variant_hits table for tracking hits per A/B variant
+	createVariantHitsSQL := `
+		CREATE TABLE IF NOT EXISTS variant_hits (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			short_url_id INTEGER NOT NULL REFERENCES short_urls(id) ON DELETE CASCADE,
+			variant TEXT NOT NULL,
+			hits INTEGER NOT NULL DEFAULT 0,
+			UNIQUE(short_url_id, variant)
+		);
+	`
+
+	if _, err := d.db.Exec(createVariantHitsSQL); err != nil {
+		log.Printf("Error creating variant_hits table: %v", err)
+	}
+
+	// Create the bot_hits table for tracking crawler and unfurler hits per bot family
+	createBotHitsSQL := `
+		CREATE TABLE IF NOT EXISTS bot_hits (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			short_url_id INTEGER NOT NULL REFERENCES short_urls(id) ON DELETE CASCADE,
+			family TEXT NOT NULL,
+			hits INTEGER NOT NULL DEFAULT 0,
+			UNIQUE(short_url_id, family)
+		);
+	`
+
+	if _, err := d.db.Exec(createBotHitsSQL); err != nil {
+		log.Printf("Error creating bot_hits table: %v", err)
+	}
+
+	// Create the visitor_sketches table for counting unique visitors per UTC day
+	createVisitorSketchesSQL := `
+		CREATE TABLE IF NOT EXISTS visitor_sketches (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			short_url_id INTEGER NOT NULL REFERENCES short_urls(id) ON DELETE CASCADE,
+			period TEXT NOT NULL,
+			sketch BLOB NOT NULL,
+			UNIQUE(short_url_id, period)
+		);
+	`
+
+	if _, err := d.db.Exec(createVisitorSketchesSQL); err != nil {
+		log.Printf("Error creating visitor_sketches table: %v", err)
+	}
+
+	// Create the link_health table for the last check of each destination
+	createLinkHealthSQL := `
+		CREATE TABLE IF NOT EXISTS link_health (
+			short_url_id INTEGER PRIMARY KEY REFERENCES short_urls(id) ON DELETE CASCADE,
+			status INTEGER NOT NULL DEFAULT 0,
+			error TEXT NOT NULL DEFAULT '',
+			redirects TEXT NOT NULL DEFAULT '',
+			checked DATETIME NOT NULL,
+			failures INTEGER NOT NULL DEFAULT 0,
+			dead BOOLEAN NOT NULL DEFAULT FALSE
+		);
+		CREATE INDEX IF NOT EXISTS idx_link_health_checked ON link_health(checked);
+	`
+
+	if _, err := d.db.Exec(createLinkHealthSQL); err != nil {
+		log.Printf("Error creating link_health table: %v", err)
+	}
+
+	// Create the link_metadata table for what was fetched from each destination
+	createLinkMetadataSQL := `
+		CREATE TABLE IF NOT EXISTS link_metadata (
+			short_url_id INTEGER PRIMARY KEY REFERENCES short_urls(id) ON DELETE CASCADE,
+			title TEXT NOT NULL DEFAULT '',
+			description TEXT NOT NULL DEFAULT '',
+			image TEXT NOT NULL DEFAULT '',
+			site_name TEXT NOT NULL DEFAULT '',
+			favicon TEXT NOT NULL DEFAULT '',
+			error TEXT NOT NULL DEFAULT '',
+			fetched DATETIME NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_link_metadata_fetched ON link_metadata(fetched);
+	`
+
+	if _, err := d.db.Exec(createLinkMetadataSQL); err != nil {
+		log.Printf("Error creating link_metadata table: %v", err)
+	}
+
 	// Enable foreign key support
 	if _, err := d.db.Exec("PRAGMA foreign_keys = ON"); err != nil {
 		log.Printf("Warning: could not enable foreign keys: %v", err)
 	}
 }
 
+// shortUrlsColumns are the columns of short_urls, other than the domain, that are copied when it's rebuilt
+const shortUrlsColumns = "id, abbreviation, url, hits, last_access, created_at, blocked, options, password, collection"
+
+// migrateDomains rebuilds a short_urls table made before links had domains, when names and URLs were unique
+// on their own. SQLite can't drop those constraints, so the links are copied into a new table that replaces
+// it, keeping their ids. This has to happen before foreign keys are turned on, or dropping the old table
+// would delete the stats of every link.
+func (d *SQLiteDB) migrateDomains() {
+	var hasDomain int
+	if err := d.db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('short_urls') WHERE name = 'domain'`).Scan(&hasDomain); err != nil {
+		log.Printf("Error checking for domain column: %v", err)
+		return
+	}
+	if hasDomain > 0 {
+		return
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Printf("Error adding domains: %v", err)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, stmt := range []string{
+		`CREATE TABLE short_urls_with_domains (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			domain TEXT NOT NULL DEFAULT '',
+			abbreviation TEXT NOT NULL,
+			url TEXT NOT NULL,
+			hits INTEGER NOT NULL DEFAULT 0,
+			last_access DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			blocked TEXT NOT NULL DEFAULT '',
+			options TEXT NOT NULL DEFAULT '',
+			password TEXT NOT NULL DEFAULT '',
+			collection TEXT NOT NULL DEFAULT '',
+			UNIQUE(domain, abbreviation),
+			UNIQUE(domain, url)
+		)`,
+		`INSERT INTO short_urls_with_domains (` + shortUrlsColumns + `) SELECT ` + shortUrlsColumns + ` FROM short_urls`,
+		`DROP TABLE short_urls`,
+		`ALTER TABLE short_urls_with_domains RENAME TO short_urls`,
+		`CREATE INDEX IF NOT EXISTS idx_short_urls_abbreviation ON short_urls(abbreviation)`,
+		`CREATE INDEX IF NOT EXISTS idx_short_urls_url ON short_urls(url)`,
+		`CREATE INDEX IF NOT EXISTS idx_short_urls_created_at ON short_urls(created_at)`,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			log.Printf("Error adding domains: %v", err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error adding domains: %v", err)
+	}
+}
+
 func (d *SQLiteDB) Cleanup() {
 	_ = d.db.Close()
 }
@@ -104,17 +336,21 @@ func (d *SQLiteDB) IsLikelyOk() bool {
 	return true
 }
 
+func (d *SQLiteDB) ForDomain(domain string) ShortUrlDao {
+	return &SQLiteDB{db: d.db, mu: d.mu, domain: domain}
+}
+
 func (d *SQLiteDB) Save(abv string, url string) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
 	sqlStmt := `
-		INSERT INTO short_urls (abbreviation, url, hits)
-		VALUES (?, ?, 0)
-		ON CONFLICT (abbreviation) DO NOTHING
+		INSERT INTO short_urls (domain, abbreviation, url, hits)
+		VALUES (?, ?, ?, 0)
+		ON CONFLICT (domain, abbreviation) DO NOTHING
 	`
 
-	result, err := d.db.Exec(sqlStmt, abv, url)
+	result, err := d.db.Exec(sqlStmt, d.domain, abv, url)
 	if err != nil {
 		if strings.Contains(err.Error(), "UNIQUE constraint") {
 			return nil // Treat duplicate as success
@@ -126,7 +362,7 @@ func (d *SQLiteDB) Save(abv string, url string) error {
 	if rowsAffected == 0 {
 		// Check if it was a conflict on abbreviation vs url
 		var existingUrl string
-		err := d.db.QueryRow("SELECT url FROM short_urls WHERE abbreviation = ?", abv).Scan(&existingUrl)
+		err := d.db.QueryRow("SELECT url FROM short_urls WHERE domain = ? AND abbreviation = ?", d.domain, abv).Scan(&existingUrl)
 		if err == nil && existingUrl != url {
 			return fmt.Errorf("abbreviation %s already exists with different URL", abv)
 		}
@@ -135,12 +371,34 @@ func (d *SQLiteDB) Save(abv string, url string) error {
 	return nil
 }
 
+func (d *SQLiteDB) SaveAll(links []Link) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("couldn't start saving links: %v", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	sqlStmt := `INSERT INTO short_urls (domain, abbreviation, url, hits) VALUES (?, ?, ?, 0)`
+	for _, link := range links {
+		if _, err := tx.Exec(sqlStmt, d.domain, link.Abbreviation, link.Url); err != nil {
+			return fmt.Errorf("couldn't store (%s, %s): %v", link.Abbreviation, link.Url, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("couldn't save links: %v", err)
+	}
+	return nil
+}
+
 func (d *SQLiteDB) DeleteAbv(abv string) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	sqlStmt := `DELETE FROM short_urls WHERE abbreviation = ?`
-	if _, err := d.db.Exec(sqlStmt, abv); err != nil {
+	sqlStmt := `DELETE FROM short_urls WHERE domain = ? AND abbreviation = ?`
+	if _, err := d.db.Exec(sqlStmt, d.domain, abv); err != nil {
 		return fmt.Errorf("couldn't delete abbreviation %s: %v", abv, err)
 	}
 	return nil
@@ -150,26 +408,50 @@ func (d *SQLiteDB) DeleteUrl(url string) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	sqlStmt := `DELETE FROM short_urls WHERE url = ?`
-	if _, err := d.db.Exec(sqlStmt, url); err != nil {
+	sqlStmt := `DELETE FROM short_urls WHERE domain = ? AND url = ?`
+	if _, err := d.db.Exec(sqlStmt, d.domain, url); err != nil {
 		return fmt.Errorf("couldn't delete URL %s: %v", url, err)
 	}
 	return nil
 }
 
 func (d *SQLiteDB) GetUrl(abv string) (string, error) {
+	return unblocked(d.GetUrlWithHit(abv, NewHit()))
+}
+
+func (d *SQLiteDB) LookupUrl(abv string) (string, error) {
+	_, url, err := d.lookupUrl(abv)
+	return url, err
+}
+
+// lookupUrl returns the id and url of abv, with a *BlockedError for blocked links
+func (d *SQLiteDB) lookupUrl(abv string) (int, string, error) {
 	d.mu.RLock()
+	defer d.mu.RUnlock()
+
 	var url string
 	var shortUrlId int
-	sqlStmt := `SELECT id, url FROM short_urls WHERE abbreviation = ?`
-	err := d.db.QueryRow(sqlStmt, abv).Scan(&shortUrlId, &url)
-	d.mu.RUnlock()
+	var blocked string
+	sqlStmt := `SELECT id, url, blocked FROM short_urls WHERE domain = ? AND abbreviation = ?`
+	err := d.db.QueryRow(sqlStmt, d.domain, abv).Scan(&shortUrlId, &url, &blocked)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return "", nil
+			return 0, "", nil
 		}
-		return "", fmt.Errorf("error getting URL for %s: %v", abv, err)
+		return 0, "", fmt.Errorf("error getting URL for %s: %v", abv, err)
+	}
+
+	if blocked != "" {
+		return shortUrlId, url, &BlockedError{Abv: abv, Reason: blocked}
+	}
+	return shortUrlId, url, nil
+}
+
+func (d *SQLiteDB) GetUrlWithHit(abv string, hit Hit) (string, error) {
+	shortUrlId, url, err := d.lookupUrl(abv)
+	if err != nil || url == "" {
+		return url, err
 	}
 
 	// Update stats asynchronously
@@ -177,39 +459,158 @@ func (d *SQLiteDB) GetUrl(abv string) (string, error) {
 		d.mu.Lock()
 		defer d.mu.Unlock()
 
+		// Bots only count towards the bot stats
+		if hit.Bot != "" {
+			botHitSQL := `
+				INSERT INTO bot_hits (short_url_id, family, hits)
+				VALUES (?, ?, 1)
+				ON CONFLICT (short_url_id, family)
+				DO UPDATE SET hits = bot_hits.hits + 1
+			`
+			if _, err := d.db.Exec(botHitSQL, shortUrlId, hit.Bot); err != nil {
+				log.Printf("Error updating bot_hits: %v", err)
+			}
+			return
+		}
+
 		// Update total hits and last_access in short_urls
 		updateSQL := `
 			UPDATE short_urls
 			SET hits = hits + 1,
-				last_access = CURRENT_TIMESTAMP
+				last_access = ?
 			WHERE id = ?
 		`
-		if _, err := d.db.Exec(updateSQL, shortUrlId); err != nil {
+		if _, err := d.db.Exec(updateSQL, hit.Time.UTC().Format(sqliteTimeLayout), shortUrlId); err != nil {
 			log.Printf("Error updating short_urls stats: %v", err)
 		}
 
 		// Insert or update daily hit count
 		dailyHitSQL := `
 			INSERT INTO daily_hits (short_url_id, hit_date, hits)
-			VALUES (?, DATE('now'), 1)
+			VALUES (?, ?, 1)
 			ON CONFLICT (short_url_id, hit_date)
 			DO UPDATE SET hits = daily_hits.hits + 1
 		`
-		if _, err := d.db.Exec(dailyHitSQL, shortUrlId); err != nil {
+		if _, err := d.db.Exec(dailyHitSQL, shortUrlId, hit.Date()); err != nil {
 			log.Printf("Error updating daily_hits: %v", err)
 		}
+
+		// Insert or update hourly hit count
+		hourlyHitSQL := `
+			INSERT INTO hourly_hits (short_url_id, hit_hour, hits)
+			VALUES (?, ?, 1)
+			ON CONFLICT (short_url_id, hit_hour)
+			DO UPDATE SET hits = hourly_hits.hits + 1
+		`
+		if _, err := d.db.Exec(hourlyHitSQL, shortUrlId, hit.Hour().Format(sqliteTimeLayout)); err != nil {
+			log.Printf("Error updating hourly_hits: %v", err)
+		}
+
+		// Insert or update country/region hit count
+		if hit.Country != "" {
+			geoHitSQL := `
+				INSERT INTO geo_hits (short_url_id, country, region, hits)
+				VALUES (?, ?, ?, 1)
+				ON CONFLICT (short_url_id, country, region)
+				DO UPDATE SET hits = geo_hits.hits + 1
+			`
+			if _, err := d.db.Exec(geoHitSQL, shortUrlId, hit.Country, hit.Region); err != nil {
+				log.Printf("Error updating geo_hits: %v", err)
+			}
+		}
+
+		// Insert or update referrer hit count
+		if hit.Referrer != "" {
+			referrerHitSQL := `
+				INSERT INTO referrer_hits (short_url_id, referrer, hits)
+				VALUES (?, ?, 1)
+				ON CONFLICT (short_url_id, referrer)
+				DO UPDATE SET hits = referrer_hits.hits + 1
+			`
+			if _, err := d.db.Exec(referrerHitSQL, shortUrlId, hit.Referrer); err != nil {
+				log.Printf("Error updating referrer_hits: %v", err)
+			}
+		}
+
+		// Insert or update the hit count of the A/B variant the visitor was sent to
+		if hit.Variant != "" {
+			variantHitSQL := `
+				INSERT INTO variant_hits (short_url_id, variant, hits)
+				VALUES (?, ?, 1)
+				ON CONFLICT (short_url_id, variant)
+				DO UPDATE SET hits = variant_hits.hits + 1
+			`
+			if _, err := d.db.Exec(variantHitSQL, shortUrlId, hit.Variant); err != nil {
+				log.Printf("Error updating variant_hits: %v", err)
+			}
+		}
+
+		// Add the visitor to the day's sketch
+		if hit.Visitor != "" {
+			if err := d.addVisitor(shortUrlId, hit.Date(), hit.Visitor); err != nil {
+				log.Printf("Error updating visitor_sketches: %v", err)
+			}
+		}
 	}()
 
 	return url, nil
 }
 
+// addVisitor adds visitor to a stored sketch; callers must hold the write lock
+func (d *SQLiteDB) addVisitor(shortUrlId int, period, visitor string) error {
+	var data []byte
+	err := d.db.QueryRow(`SELECT sketch FROM visitor_sketches WHERE short_url_id = ? AND period = ?`, shortUrlId, period).Scan(&data)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	updated, err := addToSketch(data, visitor)
+	if err != nil || updated == nil {
+		return err
+	}
+
+	upsertSQL := `
+		INSERT INTO visitor_sketches (short_url_id, period, sketch)
+		VALUES (?, ?, ?)
+		ON CONFLICT (short_url_id, period)
+		DO UPDATE SET sketch = excluded.sketch
+	`
+	_, err = d.db.Exec(upsertSQL, shortUrlId, period, updated)
+	return err
+}
+
+// querySketches reads (period, sketch) rows into decoded sketches
+func (d *SQLiteDB) querySketches(query string, args ...any) (map[string]*hll.Sketch, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	encoded := make(map[string][]byte)
+	for rows.Next() {
+		var period string
+		var data []byte
+		if err := rows.Scan(&period, &data); err != nil {
+			return nil, err
+		}
+		encoded[period] = data
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return parseSketches(encoded), nil
+}
+
 func (d *SQLiteDB) GetAbv(url string) (string, error) {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
 
 	var abv string
-	sqlStmt := `SELECT abbreviation FROM short_urls WHERE url = ?`
-	err := d.db.QueryRow(sqlStmt, url).Scan(&abv)
+	sqlStmt := `SELECT abbreviation FROM short_urls WHERE domain = ? AND url = ?`
+	err := d.db.QueryRow(sqlStmt, d.domain, url).Scan(&abv)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -229,19 +630,25 @@ func (d *SQLiteDB) GetStats(abv string) (ShortUrl, error) {
 	var data ShortUrl
 	var shortUrlId int
 	var lastAccess sql.NullTime
+	var options string
 
 	// Get main short_url data
 	sqlStmt := `
-		SELECT id, abbreviation, url, hits, last_access
+		SELECT id, domain, abbreviation, url, hits, last_access, blocked, options, password != '', collection
 		FROM short_urls
-		WHERE abbreviation = ?
+		WHERE domain = ? AND abbreviation = ?
 	`
-	err := d.db.QueryRow(sqlStmt, abv).Scan(
+	err := d.db.QueryRow(sqlStmt, d.domain, abv).Scan(
 		&shortUrlId,
+		&data.Domain,
 		&data.Abbreviation,
 		&data.Url,
 		&data.Hits,
 		&lastAccess,
+		&data.Blocked,
+		&options,
+		&data.Protected,
+		&data.Collection,
 	)
 
 	if err != nil {
@@ -252,10 +659,20 @@ func (d *SQLiteDB) GetStats(abv string) (ShortUrl, error) {
 		return ShortUrl{}, fmt.Errorf("error getting stats for %s: %v", abv, err)
 	}
 
+	if o, err := parseOptions(options); err != nil {
+		log.Printf("Error reading options of %s: %v", abv, err)
+	} else {
+		data.Options = optionsPtr(o)
+	}
+
 	if lastAccess.Valid {
 		data.LastAccess = lastAccess.Time
 	}
 
+	if data.Tags, err = d.queryTags(shortUrlId); err != nil {
+		log.Printf("Error querying link_tags: %v", err)
+	}
+
 	// Get daily hits from separate table
 	data.DailyHits = make(map[string]int)
 	dailyHitsSQL := `
@@ -283,5 +700,755 @@ func (d *SQLiteDB) GetStats(abv string) (ShortUrl, error) {
 		data.DailyHits[hitDate.Format("2006-01-02")] = hits
 	}
 
+	// Get country and region hits
+	data.CountryHits = make(map[string]int)
+	data.RegionHits = make(map[string]int)
+	geoHitsSQL := `
+		SELECT country, region, hits
+		FROM geo_hits
+		WHERE short_url_id = ?
+	`
+	geoRows, err := d.db.Query(geoHitsSQL, shortUrlId)
+	if err != nil {
+		log.Printf("Error querying geo_hits: %v", err)
+		return data, nil
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(geoRows)
+
+	for geoRows.Next() {
+		var country, region string
+		var hits int
+		if err := geoRows.Scan(&country, &region, &hits); err != nil {
+			log.Printf("Error scanning geo_hits row: %v", err)
+			continue
+		}
+		data.CountryHits[country] += hits
+		if region != "" {
+			data.RegionHits[region] += hits
+		}
+	}
+
+	// Get referrer hits
+	data.ReferrerHits = make(map[string]int)
+	referrerHitsSQL := `
+		SELECT referrer, hits
+		FROM referrer_hits
+		WHERE short_url_id = ?
+	`
+	refRows, err := d.db.Query(referrerHitsSQL, shortUrlId)
+	if err != nil {
+		log.Printf("Error querying referrer_hits: %v", err)
+		return data, nil
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(refRows)
+
+	for refRows.Next() {
+		var referrer string
+		var hits int
+		if err := refRows.Scan(&referrer, &hits); err != nil {
+			log.Printf("Error scanning referrer_hits row: %v", err)
+			continue
+		}
+		data.ReferrerHits[referrer] = hits
+	}
+
+	// Get A/B variant hits
+	data.VariantHits = make(map[string]int)
+	variantHitsSQL := `
+		SELECT variant, hits
+		FROM variant_hits
+		WHERE short_url_id = ?
+	`
+	variantRows, err := d.db.Query(variantHitsSQL, shortUrlId)
+	if err != nil {
+		log.Printf("Error querying variant_hits: %v", err)
+		return data, nil
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(variantRows)
+
+	for variantRows.Next() {
+		var variant string
+		var hits int
+		if err := variantRows.Scan(&variant, &hits); err != nil {
+			log.Printf("Error scanning variant_hits row: %v", err)
+			continue
+		}
+		data.VariantHits[variant] = hits
+	}
+
+	// Get bot hits per family
+	data.BotFamilies = make(map[string]int)
+	botHitsSQL := `
+		SELECT family, hits
+		FROM bot_hits
+		WHERE short_url_id = ?
+	`
+	botRows, err := d.db.Query(botHitsSQL, shortUrlId)
+	if err != nil {
+		log.Printf("Error querying bot_hits: %v", err)
+		return data, nil
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(botRows)
+
+	for botRows.Next() {
+		var family string
+		var hits int
+		if err := botRows.Scan(&family, &hits); err != nil {
+			log.Printf("Error scanning bot_hits row: %v", err)
+			continue
+		}
+		data.BotFamilies[family] = hits
+		data.BotHits += int32(hits)
+	}
+
+	// Get the last check of the destination
+	healthSQL := `
+		SELECT s.domain, s.abbreviation, s.url, s.password != '', h.status, h.error, h.redirects, h.checked, h.failures, h.dead
+		FROM link_health h
+		JOIN short_urls s ON s.id = h.short_url_id
+		WHERE h.short_url_id = ?
+	`
+	if health, err := d.queryLinkHealth(healthSQL, shortUrlId); err != nil {
+		log.Printf("Error querying link_health: %v", err)
+	} else if len(health) > 0 {
+		data.Health = &health[0].Health
+	}
+
+	// Get the metadata of the destination
+	metadataSQL := `
+		SELECT s.domain, s.abbreviation, s.url, m.title, m.description, m.image, m.site_name, m.favicon, m.error, m.fetched
+		FROM link_metadata m
+		JOIN short_urls s ON s.id = m.short_url_id
+		WHERE m.short_url_id = ?
+	`
+	if metadata, err := d.queryLinkMetadata(metadataSQL, shortUrlId); err != nil {
+		log.Printf("Error querying link_metadata: %v", err)
+	} else if len(metadata) > 0 {
+		data.Metadata = &metadata[0].Metadata
+	}
+
+	// Get unique visitor counts
+	sketches, err := d.querySketches(`SELECT period, sketch FROM visitor_sketches WHERE short_url_id = ?`, shortUrlId)
+	if err != nil {
+		log.Printf("Error querying visitor_sketches: %v", err)
+		return data, nil
+	}
+	fillUniques(&data, sketches)
+
 	return data, nil
 }
+
+func (d *SQLiteDB) FindLink(names []string) (Link, error) {
+	if len(names) == 0 {
+		return Link{}, nil
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	args := []any{d.domain}
+	for _, name := range names {
+		args = append(args, name)
+	}
+	sqlStmt := `SELECT abbreviation, url FROM short_urls WHERE domain = ? AND abbreviation IN (?` + strings.Repeat(", ?", len(names)-1) + `)`
+	rows, err := d.db.Query(sqlStmt, args...)
+	if err != nil {
+		return Link{}, fmt.Errorf("error finding links: %v", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	found := make(map[string]string)
+	for rows.Next() {
+		var abv, url string
+		if err := rows.Scan(&abv, &url); err != nil {
+			return Link{}, fmt.Errorf("error scanning link: %v", err)
+		}
+		found[abv] = url
+	}
+	return firstLink(names, found), rows.Err()
+}
+
+func (d *SQLiteDB) SearchLinks(prefix string, limit int) ([]Link, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	sqlStmt := `SELECT abbreviation, url, password != '' FROM short_urls WHERE domain = ? AND abbreviation LIKE ? ESCAPE '!' ORDER BY abbreviation LIMIT ?`
+	rows, err := d.db.Query(sqlStmt, d.domain, likePrefix(prefix), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error searching links: %v", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var links []Link
+	for rows.Next() {
+		var link Link
+		if err := rows.Scan(&link.Abbreviation, &link.Url, &link.Protected); err != nil {
+			return nil, fmt.Errorf("error scanning link: %v", err)
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+func (d *SQLiteDB) SetBlocked(abv, reason string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sqlStmt := `UPDATE short_urls SET blocked = ? WHERE domain = ? AND abbreviation = ?`
+	if _, err := d.db.Exec(sqlStmt, reason, d.domain, abv); err != nil {
+		return fmt.Errorf("couldn't block abbreviation %s: %v", abv, err)
+	}
+	return nil
+}
+
+func (d *SQLiteDB) SetOptions(abv string, options Options) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sqlStmt := `UPDATE short_urls SET options = ? WHERE domain = ? AND abbreviation = ?`
+	if _, err := d.db.Exec(sqlStmt, optionsJSON(options), d.domain, abv); err != nil {
+		return fmt.Errorf("couldn't set options of %s: %v", abv, err)
+	}
+	return nil
+}
+
+func (d *SQLiteDB) GetOptions(abv string) (Options, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var options string
+	sqlStmt := `SELECT options FROM short_urls WHERE domain = ? AND abbreviation = ?`
+	if err := d.db.QueryRow(sqlStmt, d.domain, abv).Scan(&options); err != nil {
+		if err == sql.ErrNoRows {
+			return Options{}, nil
+		}
+		return Options{}, fmt.Errorf("error getting options of %s: %v", abv, err)
+	}
+	return parseOptions(options)
+}
+
+func (d *SQLiteDB) SetPassword(abv, hash string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sqlStmt := `UPDATE short_urls SET password = ? WHERE domain = ? AND abbreviation = ?`
+	if _, err := d.db.Exec(sqlStmt, hash, d.domain, abv); err != nil {
+		return fmt.Errorf("couldn't set password of %s: %v", abv, err)
+	}
+	return nil
+}
+
+func (d *SQLiteDB) AddTags(abv string, tags []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sqlStmt := `INSERT OR IGNORE INTO link_tags (short_url_id, tag) SELECT id, ? FROM short_urls WHERE domain = ? AND abbreviation = ?`
+	for _, tag := range tags {
+		if _, err := d.db.Exec(sqlStmt, tag, d.domain, abv); err != nil {
+			return fmt.Errorf("couldn't tag %s: %v", abv, err)
+		}
+	}
+	return nil
+}
+
+func (d *SQLiteDB) RemoveTags(abv string, tags []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sqlStmt := `DELETE FROM link_tags WHERE tag = ? AND short_url_id = (SELECT id FROM short_urls WHERE domain = ? AND abbreviation = ?)`
+	for _, tag := range tags {
+		if _, err := d.db.Exec(sqlStmt, tag, d.domain, abv); err != nil {
+			return fmt.Errorf("couldn't untag %s: %v", abv, err)
+		}
+	}
+	return nil
+}
+
+func (d *SQLiteDB) SetCollection(abv, collection string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sqlStmt := `UPDATE short_urls SET collection = ? WHERE domain = ? AND abbreviation = ?`
+	if _, err := d.db.Exec(sqlStmt, collection, d.domain, abv); err != nil {
+		return fmt.Errorf("couldn't set collection of %s: %v", abv, err)
+	}
+	return nil
+}
+
+// queryTags returns the tags of the link with id shortUrlId, sorted
+func (d *SQLiteDB) queryTags(shortUrlId int) ([]string, error) {
+	rows, err := d.db.Query(`SELECT tag FROM link_tags WHERE short_url_id = ? ORDER BY tag`, shortUrlId)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+func (d *SQLiteDB) GetGroupLinks(group Group, limit int) ([]Link, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	from, column := groupSource(group)
+	sqlStmt := `SELECT s.abbreviation, s.url, s.password != '' FROM ` + from + ` WHERE s.domain = ? AND ` + column + ` = ? ORDER BY s.abbreviation LIMIT ?`
+	rows, err := d.db.Query(sqlStmt, d.domain, group.Name, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error listing links of %s %s: %v", group.Kind, group.Name, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	links := make([]Link, 0)
+	for rows.Next() {
+		var link Link
+		if err := rows.Scan(&link.Abbreviation, &link.Url, &link.Protected); err != nil {
+			return nil, fmt.Errorf("error scanning link: %v", err)
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+func (d *SQLiteDB) GetGroupStats(group Group, from, to string, limit int) (GroupStats, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	source, column := groupSource(group)
+	rows, err := d.db.Query(`SELECT s.id, s.abbreviation, s.url, s.hits FROM `+source+` WHERE s.domain = ? AND `+column+` = ?`, d.domain, group.Name)
+	if err != nil {
+		return GroupStats{}, fmt.Errorf("error getting links of %s %s: %v", group.Kind, group.Name, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	byId := make(map[int]*groupLink)
+	for rows.Next() {
+		var id int
+		link := groupLink{dailyHits: make(map[string]int)}
+		if err := rows.Scan(&id, &link.abv, &link.url, &link.hits); err != nil {
+			return GroupStats{}, fmt.Errorf("error scanning link: %v", err)
+		}
+		byId[id] = &link
+	}
+	if err := rows.Err(); err != nil {
+		return GroupStats{}, fmt.Errorf("error getting links of %s %s: %v", group.Kind, group.Name, err)
+	}
+
+	hitsSQL := `
+		SELECT s.id, strftime('%Y-%m-%d', h.hit_date), h.hits
+		FROM ` + source + `
+		JOIN daily_hits h ON h.short_url_id = s.id
+		WHERE s.domain = ? AND ` + column + ` = ? AND h.hit_date BETWEEN ? AND ?
+	`
+	hitRows, err := d.db.Query(hitsSQL, d.domain, group.Name, from, to)
+	if err != nil {
+		return GroupStats{}, fmt.Errorf("error getting hits of %s %s: %v", group.Kind, group.Name, err)
+	}
+	defer func() { _ = hitRows.Close() }()
+
+	for hitRows.Next() {
+		var id, hits int
+		var date string
+		if err := hitRows.Scan(&id, &date, &hits); err != nil {
+			return GroupStats{}, fmt.Errorf("error scanning hits: %v", err)
+		}
+		if link, ok := byId[id]; ok {
+			link.dailyHits[date] += hits
+		}
+	}
+	if err := hitRows.Err(); err != nil {
+		return GroupStats{}, fmt.Errorf("error getting hits of %s %s: %v", group.Kind, group.Name, err)
+	}
+
+	links := make([]groupLink, 0, len(byId))
+	for _, link := range byId {
+		links = append(links, *link)
+	}
+	return summarizeGroup(d.domain, links, from, to, limit), nil
+}
+
+func (d *SQLiteDB) GetPassword(abv string) (string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var hash string
+	sqlStmt := `SELECT password FROM short_urls WHERE domain = ? AND abbreviation = ?`
+	if err := d.db.QueryRow(sqlStmt, d.domain, abv).Scan(&hash); err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", fmt.Errorf("error getting password of %s: %v", abv, err)
+	}
+	return hash, nil
+}
+
+func (d *SQLiteDB) SetHealth(abv string, health Health) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sqlStmt := `
+		INSERT INTO link_health (short_url_id, status, error, redirects, checked, failures, dead)
+		SELECT id, ?, ?, ?, ?, ?, ? FROM short_urls WHERE domain = ? AND abbreviation = ?
+		ON CONFLICT (short_url_id)
+		DO UPDATE SET status = excluded.status, error = excluded.error, redirects = excluded.redirects,
+			checked = excluded.checked, failures = excluded.failures, dead = excluded.dead
+	`
+	_, err := d.db.Exec(sqlStmt, health.Status, health.Error, redirectsJSON(health.Redirects),
+		health.Checked.UTC().Format(sqliteTimeLayout), health.Failures, health.Dead, d.domain, abv)
+	if err != nil {
+		return fmt.Errorf("couldn't record health of %s: %v", abv, err)
+	}
+	return nil
+}
+
+func (d *SQLiteDB) GetLinksToCheck(checkedBefore time.Time, limit int) ([]LinkHealth, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	sqlStmt := `
+		SELECT s.domain, s.abbreviation, s.url, s.password != '', h.status, h.error, h.redirects, h.checked, h.failures, h.dead
+		FROM short_urls s
+		LEFT JOIN link_health h ON h.short_url_id = s.id
+		WHERE s.blocked = '' AND (h.checked IS NULL OR h.checked < ?)
+		ORDER BY h.checked IS NOT NULL, h.checked, s.abbreviation, s.domain
+		LIMIT ?
+	`
+	links, err := d.queryLinkHealth(sqlStmt, checkedBefore.UTC().Format(sqliteTimeLayout), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error getting links to check: %v", err)
+	}
+	return links, nil
+}
+
+func (d *SQLiteDB) GetUnhealthy(limit int) ([]LinkHealth, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	sqlStmt := `
+		SELECT s.domain, s.abbreviation, s.url, s.password != '', h.status, h.error, h.redirects, h.checked, h.failures, h.dead
+		FROM link_health h
+		JOIN short_urls s ON s.id = h.short_url_id
+		WHERE s.domain = ? AND h.failures > 0
+		ORDER BY h.dead DESC, h.failures DESC, s.abbreviation
+		LIMIT ?
+	`
+	links, err := d.queryLinkHealth(sqlStmt, d.domain, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error getting unhealthy links: %v", err)
+	}
+	return links, nil
+}
+
+func (d *SQLiteDB) GetDeadLinks(limit int) ([]LinkHealth, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	sqlStmt := `
+		SELECT s.domain, s.abbreviation, s.url, s.password != '', h.status, h.error, h.redirects, h.checked, h.failures, h.dead
+		FROM link_health h
+		JOIN short_urls s ON s.id = h.short_url_id
+		WHERE h.dead
+		ORDER BY h.failures DESC, s.abbreviation, s.domain
+		LIMIT ?
+	`
+	links, err := d.queryLinkHealth(sqlStmt, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error getting dead links: %v", err)
+	}
+	return links, nil
+}
+
+// queryLinkHealth reads rows of domain, abbreviation, url, whether it's protected and the link_health columns, which are null for links never checked
+func (d *SQLiteDB) queryLinkHealth(query string, args ...any) ([]LinkHealth, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	links := make([]LinkHealth, 0)
+	for rows.Next() {
+		var lh LinkHealth
+		var status, failures sql.NullInt64
+		var checkErr, redirects sql.NullString
+		var checked sql.NullTime
+		var dead sql.NullBool
+		if err := rows.Scan(&lh.Domain, &lh.Abbreviation, &lh.Url, &lh.Protected, &status, &checkErr, &redirects, &checked, &failures, &dead); err != nil {
+			return nil, err
+		}
+		lh.Health = Health{
+			Status:    int(status.Int64),
+			Error:     checkErr.String,
+			Redirects: parseRedirects(redirects.String),
+			Checked:   checked.Time,
+			Failures:  int(failures.Int64),
+			Dead:      dead.Bool,
+		}
+		links = append(links, lh)
+	}
+	return links, rows.Err()
+}
+
+func (d *SQLiteDB) SetMetadata(abv string, metadata Metadata) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sqlStmt := `
+		INSERT INTO link_metadata (short_url_id, title, description, image, site_name, favicon, error, fetched)
+		SELECT id, ?, ?, ?, ?, ?, ?, ? FROM short_urls WHERE domain = ? AND abbreviation = ?
+		ON CONFLICT (short_url_id)
+		DO UPDATE SET title = excluded.title, description = excluded.description, image = excluded.image,
+			site_name = excluded.site_name, favicon = excluded.favicon, error = excluded.error, fetched = excluded.fetched
+	`
+	_, err := d.db.Exec(sqlStmt, metadata.Title, metadata.Description, metadata.Image, metadata.SiteName,
+		metadata.Favicon, metadata.Error, metadata.Fetched.UTC().Format(sqliteTimeLayout), d.domain, abv)
+	if err != nil {
+		return fmt.Errorf("couldn't store metadata of %s: %v", abv, err)
+	}
+	return nil
+}
+
+func (d *SQLiteDB) GetStaleMetadata(fetchedBefore time.Time, limit int) ([]LinkMetadata, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	sqlStmt := `
+		SELECT s.domain, s.abbreviation, s.url, m.title, m.description, m.image, m.site_name, m.favicon, m.error, m.fetched
+		FROM short_urls s
+		LEFT JOIN link_metadata m ON m.short_url_id = s.id
+		WHERE s.blocked = '' AND (m.fetched IS NULL OR m.fetched < ?)
+		ORDER BY m.fetched IS NOT NULL, m.fetched, s.abbreviation, s.domain
+		LIMIT ?
+	`
+	links, err := d.queryLinkMetadata(sqlStmt, fetchedBefore.UTC().Format(sqliteTimeLayout), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error getting links with stale metadata: %v", err)
+	}
+	return links, nil
+}
+
+// queryLinkMetadata reads rows of domain, abbreviation, url and the link_metadata columns, which are null for links never fetched
+func (d *SQLiteDB) queryLinkMetadata(query string, args ...any) ([]LinkMetadata, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	links := make([]LinkMetadata, 0)
+	for rows.Next() {
+		var lm LinkMetadata
+		var title, description, image, siteName, favicon, fetchErr sql.NullString
+		var fetched sql.NullTime
+		if err := rows.Scan(&lm.Domain, &lm.Abbreviation, &lm.Url, &title, &description, &image, &siteName, &favicon, &fetchErr, &fetched); err != nil {
+			return nil, err
+		}
+		lm.Metadata = Metadata{
+			Title:       title.String,
+			Description: description.String,
+			Image:       image.String,
+			SiteName:    siteName.String,
+			Favicon:     favicon.String,
+			Error:       fetchErr.String,
+			Fetched:     fetched.Time,
+		}
+		links = append(links, lm)
+	}
+	return links, rows.Err()
+}
+
+func (d *SQLiteDB) GetHourlyHits(abv string, from, to time.Time) (map[time.Time]int, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	sqlStmt := `
+		SELECT h.hit_hour, h.hits
+		FROM hourly_hits h
+		JOIN short_urls s ON s.id = h.short_url_id
+		WHERE s.domain = ? AND s.abbreviation = ? AND h.hit_hour >= ? AND h.hit_hour < ?
+	`
+	rows, err := d.db.Query(sqlStmt, d.domain, abv, from.UTC().Format(sqliteTimeLayout), to.UTC().Format(sqliteTimeLayout))
+	if err != nil {
+		return nil, fmt.Errorf("error getting hourly hits for %s: %v", abv, err)
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	hits := make(map[time.Time]int)
+	for rows.Next() {
+		var hour time.Time
+		var count int
+		if err := rows.Scan(&hour, &count); err != nil {
+			return nil, fmt.Errorf("error scanning hourly hits for %s: %v", abv, err)
+		}
+		hits[hour.UTC()] = count
+	}
+
+	return hits, rows.Err()
+}
+
+func (d *SQLiteDB) CountUniques(abv string, buckets [][]string) ([]int64, error) {
+	first, last, ok := dateRange(buckets)
+	if !ok {
+		return countBuckets(nil, buckets), nil
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	sqlStmt := `
+		SELECT v.period, v.sketch
+		FROM visitor_sketches v
+		JOIN short_urls s ON s.id = v.short_url_id
+		WHERE s.domain = ? AND s.abbreviation = ? AND v.period BETWEEN ? AND ?
+	`
+	sketches, err := d.querySketches(sqlStmt, d.domain, abv, first, last)
+	if err != nil {
+		return nil, fmt.Errorf("error counting uniques for %s: %v", abv, err)
+	}
+	return countBuckets(sketches, buckets), nil
+}
+
+func (d *SQLiteDB) GetGlobalStats(from, to string, limit int) (GlobalStats, error) {
+	priorFrom, _, err := PriorWindow(from, to)
+	if err != nil {
+		return GlobalStats{}, err
+	}
+	start, end := windowTimes(from, to)
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var stats GlobalStats
+
+	hitsPerDaySQL := `
+		SELECT strftime('%Y-%m-%d', h.hit_date), SUM(h.hits)
+		FROM daily_hits h
+		JOIN short_urls s ON s.id = h.short_url_id
+		WHERE s.domain = ? AND h.hit_date BETWEEN ? AND ?
+		GROUP BY h.hit_date
+	`
+	if stats.HitsPerDay, err = d.queryDayCounts(hitsPerDaySQL, d.domain, from, to); err != nil {
+		return GlobalStats{}, fmt.Errorf("error getting hits per day: %v", err)
+	}
+
+	createdPerDaySQL := `
+		SELECT strftime('%Y-%m-%d', created_at) AS created_day, COUNT(*)
+		FROM short_urls
+		WHERE domain = ? AND created_at >= ? AND created_at < ?
+		GROUP BY created_day
+	`
+	if stats.CreatedPerDay, err = d.queryDayCounts(createdPerDaySQL, d.domain, start.Format(sqliteTimeLayout), end.Format(sqliteTimeLayout)); err != nil {
+		return GlobalStats{}, fmt.Errorf("error getting links created per day: %v", err)
+	}
+
+	topLinksSQL := `
+		SELECT s.domain, s.abbreviation, s.url, SUM(h.hits) AS window_hits, 0
+		FROM daily_hits h
+		JOIN short_urls s ON s.id = h.short_url_id
+		WHERE s.domain = ? AND h.hit_date BETWEEN ? AND ?
+		GROUP BY s.id, s.domain, s.abbreviation, s.url
+		ORDER BY window_hits DESC, s.abbreviation, s.domain
+		LIMIT ?
+	`
+	if stats.TopLinks, err = d.queryLinkCounts(topLinksSQL, d.domain, from, to, limit); err != nil {
+		return GlobalStats{}, fmt.Errorf("error getting top links: %v", err)
+	}
+
+	trendingSQL := `
+		SELECT domain, abbreviation, url, window_hits, prior_hits
+		FROM (
+			SELECT s.domain, s.abbreviation, s.url,
+				SUM(CASE WHEN h.hit_date >= ? THEN h.hits ELSE 0 END) AS window_hits,
+				SUM(CASE WHEN h.hit_date < ? THEN h.hits ELSE 0 END) AS prior_hits
+			FROM daily_hits h
+			JOIN short_urls s ON s.id = h.short_url_id
+			WHERE s.domain = ? AND h.hit_date BETWEEN ? AND ?
+			GROUP BY s.id, s.domain, s.abbreviation, s.url
+		) t
+		WHERE window_hits > prior_hits
+		ORDER BY window_hits - prior_hits DESC, abbreviation, domain
+		LIMIT ?
+	`
+	if stats.Trending, err = d.queryLinkCounts(trendingSQL, from, from, d.domain, priorFrom, to, limit); err != nil {
+		return GlobalStats{}, fmt.Errorf("error getting trending links: %v", err)
+	}
+
+	neverClickedSQL := `
+		SELECT domain, abbreviation, url, 0, 0
+		FROM short_urls
+		WHERE domain = ? AND hits = 0
+		ORDER BY created_at, abbreviation, domain
+		LIMIT ?
+	`
+	if stats.NeverClicked, err = d.queryLinkCounts(neverClickedSQL, d.domain, limit); err != nil {
+		return GlobalStats{}, fmt.Errorf("error getting never clicked links: %v", err)
+	}
+	if err := d.db.QueryRow(`SELECT COUNT(*) FROM short_urls WHERE domain = ? AND hits = 0`, d.domain).Scan(&stats.NeverClickedTotal); err != nil {
+		return GlobalStats{}, fmt.Errorf("error counting never clicked links: %v", err)
+	}
+
+	return stats, nil
+}
+
+// queryDayCounts reads (date, count) rows
+func (d *SQLiteDB) queryDayCounts(query string, args ...any) (map[string]int, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var day string
+		var count int
+		if err := rows.Scan(&day, &count); err != nil {
+			return nil, err
+		}
+		counts[day] = count
+	}
+	return counts, rows.Err()
+}
+
+// queryLinkCounts reads (domain, abbreviation, url, hits, prior hits) rows
+func (d *SQLiteDB) queryLinkCounts(query string, args ...any) ([]LinkCount, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	links := make([]LinkCount, 0)
+	for rows.Next() {
+		var lc LinkCount
+		if err := rows.Scan(&lc.Domain, &lc.Abbreviation, &lc.Url, &lc.Hits, &lc.PriorHits); err != nil {
+			return nil, err
+		}
+		links = append(links, lc)
+	}
+	return links, rows.Err()
+}
@@ -0,0 +1,83 @@
+package dao
+
+import (
+	"log"
+
+	"github.com/ericfialkowski/shorturl/hll"
+)
+
+// allTimePeriod is the sketch period that held every visitor of a link before the all-time count was merged from
+// the daily sketches when it's read. Links may still have one, which is merged in with them.
+const allTimePeriod = "all"
+
+// maxSketchRetries is how many times a sketch is read and written again after losing a race to another hit
+const maxSketchRetries = 5
+
+// addToSketch adds visitor to the encoded sketch in data and returns the new encoding,
+// or nil if the visitor was already counted and nothing needs to be written.
+func addToSketch(data []byte, visitor string) ([]byte, error) {
+	s, err := hll.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if !s.Add(visitor) && len(data) > 0 {
+		return nil, nil
+	}
+	return s.MarshalBinary()
+}
+
+// parseSketches decodes sketches keyed by period, skipping any that are corrupt
+func parseSketches(encoded map[string][]byte) map[string]*hll.Sketch {
+	sketches := make(map[string]*hll.Sketch, len(encoded))
+	for period, data := range encoded {
+		s, err := hll.Parse(data)
+		if err != nil {
+			log.Printf("Error decoding visitor sketch for %s: %v", period, err)
+			continue
+		}
+		sketches[period] = s
+	}
+	return sketches
+}
+
+// countBuckets merges the daily sketches of each bucket of dates and counts the uniques
+func countBuckets(sketches map[string]*hll.Sketch, buckets [][]string) []int64 {
+	counts := make([]int64, len(buckets))
+	for i, dates := range buckets {
+		merged := hll.New()
+		for _, date := range dates {
+			merged.Merge(sketches[date])
+		}
+		counts[i] = merged.Count()
+	}
+	return counts
+}
+
+// fillUniques sets the daily unique counts of su from its sketches, and the all-time count from all of them merged
+func fillUniques(su *ShortUrl, sketches map[string]*hll.Sketch) {
+	su.DailyUniques = make(map[string]int64)
+	merged := hll.New()
+	for period, s := range sketches {
+		merged.Merge(s)
+		if period != allTimePeriod {
+			su.DailyUniques[period] = s.Count()
+		}
+	}
+	su.Uniques = merged.Count()
+}
+
+// dateRange returns the first and last date in buckets, for querying stores by range
+func dateRange(buckets [][]string) (string, string, bool) {
+	first, last := "", ""
+	for _, dates := range buckets {
+		for _, date := range dates {
+			if first == "" || date < first {
+				first = date
+			}
+			if date > last {
+				last = date
+			}
+		}
+	}
+	return first, last, first != ""
+}
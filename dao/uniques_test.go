@@ -0,0 +1,32 @@
+package dao
+
+import (
+	"testing"
+
+	"github.com/ericfialkowski/shorturl/hll"
+)
+
+func sketchOf(visitors ...string) *hll.Sketch {
+	s := hll.New()
+	for _, v := range visitors {
+		s.Add(v)
+	}
+	return s
+}
+
+func TestFillUniques(t *testing.T) {
+	var su ShortUrl
+	fillUniques(&su, map[string]*hll.Sketch{
+		"2024-05-01": sketchOf("a", "b"),
+		"2024-05-02": sketchOf("b", "c"),
+		// left by links counted before the all-time count was merged from the days
+		allTimePeriod: sketchOf("a", "b", "old"),
+	})
+
+	if su.Uniques != 4 {
+		t.Errorf("Uniques = %d, want the 4 visitors of every sketch", su.Uniques)
+	}
+	if len(su.DailyUniques) != 2 || su.DailyUniques["2024-05-01"] != 2 || su.DailyUniques["2024-05-02"] != 2 {
+		t.Errorf("DailyUniques = %v, want 2 on each day", su.DailyUniques)
+	}
+}
@@ -0,0 +1,87 @@
+package geo
+
+import (
+	"log"
+	"net"
+)
+
+// Location is where a client ip resolved to. Country is an ISO 3166-1 alpha-2 code
+// and Region is an ISO 3166-2 subdivision code prefixed by the country (e.g. "US-CA").
+// Either may be empty if the database doesn't know.
+type Location struct {
+	Country string `json:"country"`
+	Region  string `json:"region"`
+}
+
+// Locator resolves ip addresses to a Location using a local GeoIP2/GeoLite2 Country or City database.
+// A nil Locator is valid and resolves everything to an empty Location.
+type Locator struct {
+	reader *Reader
+}
+
+// NewLocator loads the MaxMind DB file at path. An empty path disables geolocation and returns a nil Locator.
+func NewLocator(path string) (*Locator, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	reader, err := OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("GeoIP database loaded (%v, %v nodes)", reader.Metadata["database_type"], reader.nodeCount)
+	return &Locator{reader: reader}, nil
+}
+
+// Locate returns the Location of ip. Unparseable, private or unknown addresses return an empty Location.
+func (l *Locator) Locate(ip string) Location {
+	if l == nil || l.reader == nil {
+		return Location{}
+	}
+
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return Location{}
+	}
+
+	record, err := l.reader.Lookup(addr)
+	if err != nil {
+		log.Printf("GeoIP lookup of %s failed: %v", ip, err)
+		return Location{}
+	}
+
+	var loc Location
+	loc.Country = isoCode(record, "country")
+	if loc.Country == "" {
+		loc.Country = isoCode(record, "registered_country")
+	}
+	if loc.Country == "" {
+		return Location{}
+	}
+
+	if m, ok := record.(map[string]any); ok {
+		if subdivisions, ok := m["subdivisions"].([]any); ok && len(subdivisions) > 0 {
+			if sub := isoCode(subdivisions[0], ""); sub != "" {
+				loc.Region = loc.Country + "-" + sub
+			}
+		}
+	}
+
+	return loc
+}
+
+// isoCode returns record[key]["iso_code"], or record["iso_code"] if key is empty.
+func isoCode(record any, key string) string {
+	m, ok := record.(map[string]any)
+	if !ok {
+		return ""
+	}
+	if key != "" {
+		if m, ok = m[key].(map[string]any); !ok {
+			return ""
+		}
+	}
+	code, _ := m["iso_code"].(string)
+	return code
+}
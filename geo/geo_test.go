@@ -0,0 +1,69 @@
+package geo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewLocator_EmptyPath(t *testing.T) {
+	l, err := NewLocator("")
+	if err != nil {
+		t.Fatalf("NewLocator(\"\") error = %v", err)
+	}
+	if l != nil {
+		t.Error("NewLocator(\"\") should return a nil Locator")
+	}
+
+	// a nil locator is usable
+	if loc := l.Locate("81.2.69.142"); loc != (Location{}) {
+		t.Errorf("nil Locator.Locate() = %v, want empty", loc)
+	}
+}
+
+func TestNewLocator_MissingFile(t *testing.T) {
+	if _, err := NewLocator(filepath.Join(t.TempDir(), "missing.mmdb")); err == nil {
+		t.Error("NewLocator() with missing file returned no error")
+	}
+}
+
+func TestLocator_Locate(t *testing.T) {
+	db := newTestDB(6, 28)
+	db.insert(t, "81.2.69.0/24", cityRecord("GB", "ENG"))
+	db.insert(t, "216.160.83.0/24", cityRecord("US", "WA"))
+	db.insert(t, "89.160.20.0/24", cityRecord("SE", ""))
+	db.insert(t, "67.43.156.0/24", map[string]any{
+		"registered_country": map[string]any{"iso_code": "BT"},
+	})
+
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := os.WriteFile(path, db.bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := NewLocator(path)
+	if err != nil {
+		t.Fatalf("NewLocator() error = %v", err)
+	}
+
+	tests := []struct {
+		ip   string
+		want Location
+	}{
+		{"81.2.69.142", Location{Country: "GB", Region: "GB-ENG"}},
+		{"216.160.83.56", Location{Country: "US", Region: "US-WA"}},
+		{"89.160.20.112", Location{Country: "SE"}},
+		{"67.43.156.1", Location{Country: "BT"}},
+		{"::ffff:81.2.69.142", Location{Country: "GB", Region: "GB-ENG"}},
+		{"10.1.1.1", Location{}},
+		{"2001:db8::1", Location{}},
+		{"not an ip", Location{}},
+		{"", Location{}},
+	}
+
+	for _, tt := range tests {
+		if got := l.Locate(tt.ip); got != tt.want {
+			t.Errorf("Locate(%q) = %+v, want %+v", tt.ip, got, tt.want)
+		}
+	}
+}
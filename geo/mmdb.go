@@ -0,0 +1,334 @@
+package geo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"os"
+)
+
+// metadataMarker separates the search tree and data section from the metadata at the end of the file.
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+const dataSectionSeparatorSize = 16
+
+// maxDataDepth is how deeply maps, arrays and pointers can nest in the data section, the same limit as
+// libmaxminddb's, so a corrupt file whose pointers loop is an error rather than a stack overflow.
+const maxDataDepth = 512
+
+// data section field types as defined by the MaxMind DB file format spec
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// Reader is a minimal reader for MaxMind DB (.mmdb) files, such as the GeoLite2 and GeoIP2 databases.
+// The whole file is kept in memory and lookups never touch the network.
+type Reader struct {
+	buf        []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint
+	Metadata   map[string]any
+}
+
+// OpenReader reads the MaxMind DB file at path into memory.
+func OpenReader(path string) (*Reader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReader(buf)
+}
+
+// NewReader creates a Reader from the raw contents of a MaxMind DB file.
+func NewReader(buf []byte) (*Reader, error) {
+	start := bytes.LastIndex(buf, metadataMarker)
+	if start == -1 {
+		return nil, errors.New("invalid MaxMind DB file: metadata marker not found")
+	}
+	metaStart := start + len(metadataMarker)
+
+	meta, _, err := decode(buf[metaStart:], 0)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding metadata: %v", err)
+	}
+	metadata, ok := meta.(map[string]any)
+	if !ok {
+		return nil, errors.New("invalid MaxMind DB file: metadata is not a map")
+	}
+
+	r := &Reader{
+		buf:        buf,
+		nodeCount:  metaUint(metadata, "node_count"),
+		recordSize: metaUint(metadata, "record_size"),
+		ipVersion:  metaUint(metadata, "ip_version"),
+		Metadata:   metadata,
+	}
+
+	switch r.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("unsupported record size %d", r.recordSize)
+	}
+
+	treeSize := r.nodeCount * r.recordSize / 4
+	dataStart := treeSize + dataSectionSeparatorSize
+	if dataStart > uint(start) {
+		return nil, errors.New("invalid MaxMind DB file: search tree is larger than file")
+	}
+	r.data = buf[dataStart:start]
+
+	// IPv4 addresses live under ::/96 in IPv6 databases, so find that node once up front
+	if r.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < r.nodeCount; i++ {
+			node = r.readRecord(node, 0)
+		}
+		r.ipv4Start = node
+	}
+
+	return r, nil
+}
+
+// Lookup returns the decoded data record for ip, or nil if the database has no entry for it.
+func (r *Reader) Lookup(ip net.IP) (any, error) {
+	if ip == nil {
+		return nil, errors.New("invalid ip address")
+	}
+
+	node := uint(0)
+	bitCount := 128
+	if ipv4 := ip.To4(); ipv4 != nil {
+		ip = ipv4
+		bitCount = 32
+		node = r.ipv4Start
+	} else if r.ipVersion == 4 {
+		return nil, fmt.Errorf("cannot look up IPv6 address %s in an IPv4-only database", ip)
+	}
+
+	for i := 0; i < bitCount && node < r.nodeCount; i++ {
+		bit := uint(ip[i>>3]>>(7-(i%8))) & 1
+		node = r.readRecord(node, bit)
+	}
+
+	switch {
+	case node == r.nodeCount:
+		return nil, nil
+	case node > r.nodeCount:
+		offset := node - r.nodeCount - dataSectionSeparatorSize
+		if offset >= uint(len(r.data)) {
+			return nil, errors.New("invalid MaxMind DB file: data pointer out of range")
+		}
+		v, _, err := decode(r.data, offset)
+		return v, err
+	default:
+		return nil, errors.New("invalid MaxMind DB file: search tree is too deep")
+	}
+}
+
+// readRecord returns the left (bit 0) or right (bit 1) record of node.
+func (r *Reader) readRecord(node uint, bit uint) uint {
+	switch r.recordSize {
+	case 24:
+		b := r.buf[node*6+bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := r.buf[node*7:]
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(r.buf[node*8+bit*4:]))
+	}
+}
+
+// decode reads the field at offset in section and returns its value along with the offset of the next field.
+func decode(section []byte, offset uint) (any, uint, error) {
+	return decodeAt(section, offset, 0)
+}
+
+// decodeAt decodes the field at offset in section, which is depth maps, arrays and pointers deep.
+func decodeAt(section []byte, offset uint, depth int) (any, uint, error) {
+	if depth > maxDataDepth {
+		return nil, 0, fmt.Errorf("data nested more than %d deep", maxDataDepth)
+	}
+	if offset >= uint(len(section)) {
+		return nil, 0, errors.New("unexpected end of data")
+	}
+	ctrl := section[offset]
+	offset++
+
+	typeNum := uint(ctrl >> 5)
+	if typeNum == typePointer {
+		pointer, next, err := decodePointer(section, ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		v, _, err := decodeAt(section, pointer, depth+1)
+		return v, next, err
+	}
+
+	if typeNum == typeExtended {
+		if offset >= uint(len(section)) {
+			return nil, 0, errors.New("unexpected end of data")
+		}
+		typeNum = 7 + uint(section[offset])
+		offset++
+	}
+
+	size, offset, err := decodeSize(section, ctrl, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch typeNum {
+	case typeMap:
+		m := make(map[string]any, size)
+		for range size {
+			var key, value any
+			if key, offset, err = decodeAt(section, offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, errors.New("map key is not a string")
+			}
+			if value, offset, err = decodeAt(section, offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			m[k] = value
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]any, 0, size)
+		for range size {
+			var value any
+			if value, offset, err = decodeAt(section, offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	case typeContainer, typeEndMarker:
+		return nil, offset, nil
+	}
+
+	end := offset + size
+	if end > uint(len(section)) {
+		return nil, 0, errors.New("unexpected end of data")
+	}
+	b := section[offset:end]
+
+	switch typeNum {
+	case typeString:
+		return string(b), end, nil
+	case typeBytes:
+		return append([]byte(nil), b...), end, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid double size %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), end, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid float size %d", size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), end, nil
+	case typeUint16, typeUint32, typeUint64:
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, end, nil
+	case typeInt32:
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		return int64(int32(v)), end, nil
+	case typeUint128:
+		return new(big.Int).SetBytes(b), end, nil
+	}
+
+	return nil, 0, fmt.Errorf("unknown data type %d", typeNum)
+}
+
+func decodeSize(section []byte, ctrl byte, offset uint) (uint, uint, error) {
+	size := uint(ctrl & 0x1f)
+	if size < 29 {
+		return size, offset, nil
+	}
+
+	extra := size - 28
+	if offset+extra > uint(len(section)) {
+		return 0, 0, errors.New("unexpected end of data")
+	}
+	var v uint
+	for _, c := range section[offset : offset+extra] {
+		v = v<<8 | uint(c)
+	}
+
+	switch size {
+	case 29:
+		size = 29 + v
+	case 30:
+		size = 285 + v
+	default:
+		size = 65821 + v
+	}
+	return size, offset + extra, nil
+}
+
+func decodePointer(section []byte, ctrl byte, offset uint) (uint, uint, error) {
+	pointerSize := uint((ctrl>>3)&0x3) + 1
+	if offset+pointerSize > uint(len(section)) {
+		return 0, 0, errors.New("unexpected end of data")
+	}
+
+	var v uint
+	if pointerSize != 4 {
+		v = uint(ctrl & 0x7)
+	}
+	for _, c := range section[offset : offset+pointerSize] {
+		v = v<<8 | uint(c)
+	}
+
+	switch pointerSize {
+	case 2:
+		v += 2048
+	case 3:
+		v += 526336
+	}
+	return v, offset + pointerSize, nil
+}
+
+func metaUint(m map[string]any, key string) uint {
+	if v, ok := m[key].(uint64); ok {
+		return uint(v)
+	}
+	return 0
+}
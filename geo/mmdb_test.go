@@ -0,0 +1,283 @@
+package geo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"sort"
+	"testing"
+)
+
+// testDB builds a MaxMind DB file in memory so tests don't need a real GeoIP database.
+type testDB struct {
+	ipVersion  int
+	recordSize int
+	nodes      [][2]int // negative values are -(1 + index into records)
+	records    []any
+}
+
+func newTestDB(ipVersion, recordSize int) *testDB {
+	return &testDB{ipVersion: ipVersion, recordSize: recordSize, nodes: [][2]int{{0, 0}}}
+}
+
+// insert maps the network in cidr to record. IPv4 networks are placed under ::/96 in IPv6 databases.
+func (db *testDB) insert(t *testing.T, cidr string, record any) {
+	t.Helper()
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		t.Fatalf("bad cidr %s: %v", cidr, err)
+	}
+	ones, _ := network.Mask.Size()
+	ip := network.IP
+	if db.ipVersion == 6 {
+		if v4 := ip.To4(); v4 != nil {
+			ip = append(make(net.IP, 12), v4...)
+			ones += 96
+		} else {
+			ip = ip.To16()
+		}
+	} else {
+		ip = ip.To4()
+	}
+
+	db.records = append(db.records, record)
+	value := -len(db.records)
+
+	node := 0
+	for i := range ones {
+		bit := int(ip[i/8]>>(7-(i%8))) & 1
+		if i == ones-1 {
+			db.nodes[node][bit] = value
+			return
+		}
+		next := db.nodes[node][bit]
+		if next <= 0 {
+			db.nodes = append(db.nodes, [2]int{0, 0})
+			next = len(db.nodes) - 1
+			db.nodes[node][bit] = next
+		}
+		node = next
+	}
+}
+
+func (db *testDB) bytes() []byte {
+	nodeCount := len(db.nodes)
+
+	var data bytes.Buffer
+	offsets := make([]int, len(db.records))
+	for i, r := range db.records {
+		offsets[i] = data.Len()
+		encodeTestValue(&data, r)
+	}
+
+	resolve := func(v int) uint32 {
+		switch {
+		case v < 0:
+			return uint32(nodeCount + dataSectionSeparatorSize + offsets[-v-1])
+		case v == 0:
+			return uint32(nodeCount) // empty
+		default:
+			return uint32(v)
+		}
+	}
+
+	var out bytes.Buffer
+	for _, n := range db.nodes {
+		l, r := resolve(n[0]), resolve(n[1])
+		switch db.recordSize {
+		case 24:
+			out.Write([]byte{byte(l >> 16), byte(l >> 8), byte(l), byte(r >> 16), byte(r >> 8), byte(r)})
+		case 28:
+			out.Write([]byte{byte(l >> 16), byte(l >> 8), byte(l), byte((l>>24)<<4 | (r>>24)&0x0F), byte(r >> 16), byte(r >> 8), byte(r)})
+		default:
+			_ = binary.Write(&out, binary.BigEndian, []uint32{l, r})
+		}
+	}
+	out.Write(make([]byte, dataSectionSeparatorSize))
+	out.Write(data.Bytes())
+	out.Write(metadataMarker)
+	encodeTestValue(&out, map[string]any{
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(db.recordSize),
+		"ip_version":                  uint16(db.ipVersion),
+		"database_type":               "Test-City",
+		"binary_format_major_version": uint16(2),
+	})
+	return out.Bytes()
+}
+
+func encodeTestValue(buf *bytes.Buffer, v any) {
+	writeCtrl := func(typeNum int, size int) {
+		var sizeBytes []byte
+		switch {
+		case size < 29:
+		case size < 285:
+			sizeBytes = []byte{byte(size - 29)}
+			size = 29
+		default:
+			sizeBytes = []byte{byte((size - 285) >> 8), byte(size - 285)}
+			size = 30
+		}
+		if typeNum > 7 {
+			buf.WriteByte(byte(size))
+			buf.WriteByte(byte(typeNum - 7))
+		} else {
+			buf.WriteByte(byte(typeNum<<5 | size))
+		}
+		buf.Write(sizeBytes)
+	}
+	writeUint := func(typeNum int, v uint64) {
+		var b []byte
+		for ; v > 0; v >>= 8 {
+			b = append([]byte{byte(v)}, b...)
+		}
+		writeCtrl(typeNum, len(b))
+		buf.Write(b)
+	}
+
+	switch v := v.(type) {
+	case string:
+		writeCtrl(typeString, len(v))
+		buf.WriteString(v)
+	case uint16:
+		writeUint(typeUint16, uint64(v))
+	case uint32:
+		writeUint(typeUint32, uint64(v))
+	case bool:
+		if v {
+			writeCtrl(typeBool, 1)
+		} else {
+			writeCtrl(typeBool, 0)
+		}
+	case []any:
+		writeCtrl(typeArray, len(v))
+		for _, e := range v {
+			encodeTestValue(buf, e)
+		}
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		writeCtrl(typeMap, len(v))
+		for _, k := range keys {
+			encodeTestValue(buf, k)
+			encodeTestValue(buf, v[k])
+		}
+	default:
+		panic("unsupported test value")
+	}
+}
+
+func cityRecord(country, subdivision string) map[string]any {
+	r := map[string]any{
+		"country": map[string]any{"iso_code": country},
+	}
+	if subdivision != "" {
+		r["subdivisions"] = []any{map[string]any{"iso_code": subdivision}}
+	}
+	return r
+}
+
+func TestReader_Lookup(t *testing.T) {
+	for _, tc := range []struct {
+		ipVersion  int
+		recordSize int
+	}{
+		{4, 24},
+		{4, 32},
+		{6, 24},
+		{6, 28},
+		{6, 32},
+	} {
+		db := newTestDB(tc.ipVersion, tc.recordSize)
+		db.insert(t, "81.2.69.0/24", cityRecord("GB", "ENG"))
+		db.insert(t, "216.160.83.0/24", cityRecord("US", "WA"))
+		if tc.ipVersion == 6 {
+			db.insert(t, "2001:db8::/32", cityRecord("DE", ""))
+		}
+
+		r, err := NewReader(db.bytes())
+		if err != nil {
+			t.Fatalf("NewReader(v%d, %d bit) error = %v", tc.ipVersion, tc.recordSize, err)
+		}
+
+		got, err := r.Lookup(net.ParseIP("216.160.83.56"))
+		if err != nil {
+			t.Fatalf("Lookup(v%d, %d bit) error = %v", tc.ipVersion, tc.recordSize, err)
+		}
+		if code := isoCode(got, "country"); code != "US" {
+			t.Errorf("Lookup(v%d, %d bit) country = %q, want US", tc.ipVersion, tc.recordSize, code)
+		}
+
+		got, err = r.Lookup(net.ParseIP("10.0.0.1"))
+		if err != nil || got != nil {
+			t.Errorf("Lookup(v%d, %d bit) of unknown ip = %v, %v, want nil, nil", tc.ipVersion, tc.recordSize, got, err)
+		}
+
+		if tc.ipVersion == 6 {
+			got, _ = r.Lookup(net.ParseIP("2001:db8::1"))
+			if code := isoCode(got, "country"); code != "DE" {
+				t.Errorf("Lookup(v%d, %d bit) ipv6 country = %q, want DE", tc.ipVersion, tc.recordSize, code)
+			}
+		}
+	}
+}
+
+func TestReader_Metadata(t *testing.T) {
+	r, err := NewReader(newTestDB(6, 28).bytes())
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	if r.Metadata["database_type"] != "Test-City" {
+		t.Errorf("Metadata[database_type] = %v, want Test-City", r.Metadata["database_type"])
+	}
+}
+
+func TestNewReader_Invalid(t *testing.T) {
+	if _, err := NewReader([]byte("not a database")); err == nil {
+		t.Error("NewReader() with garbage returned no error")
+	}
+}
+
+func TestDecode_LongString(t *testing.T) {
+	for _, n := range []int{28, 29, 284, 285, 1000} {
+		s := string(bytes.Repeat([]byte("x"), n))
+		var buf bytes.Buffer
+		encodeTestValue(&buf, s)
+		v, next, err := decode(buf.Bytes(), 0)
+		if err != nil {
+			t.Fatalf("decode(%d byte string) error = %v", n, err)
+		}
+		if v != s || next != uint(buf.Len()) {
+			t.Errorf("decode(%d byte string) = %d bytes, next %d; want %d bytes, next %d", n, len(v.(string)), next, n, buf.Len())
+		}
+	}
+}
+
+func TestDecode_Pointer(t *testing.T) {
+	// a string followed by a pointer back to it
+	var buf bytes.Buffer
+	encodeTestValue(&buf, "hello")
+	ptr := buf.Len()
+	buf.Write([]byte{typePointer << 5, 0})
+
+	v, next, err := decode(buf.Bytes(), uint(ptr))
+	if err != nil {
+		t.Fatalf("decode() error = %v", err)
+	}
+	if v != "hello" {
+		t.Errorf("decode() = %v, want hello", v)
+	}
+	if next != uint(buf.Len()) {
+		t.Errorf("decode() next = %d, want %d", next, buf.Len())
+	}
+}
+
+func TestDecode_PointerLoop(t *testing.T) {
+	// a pointer to itself, which would recurse forever
+	if _, _, err := decode([]byte{typePointer << 5, 0}, 0); err == nil {
+		t.Error("decode() of a pointer loop = nil error, want one")
+	}
+}
@@ -0,0 +1,114 @@
+// Package golink handles go/ links style names made of several segments, and destinations that are
+// templates filled in from the segments that follow the name, like /bug/1234 for https://tracker/issues/{1}
+package golink
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	MaxNameLength = 50 // the longest abbreviation every database can store
+	MaxSegments   = 8
+)
+
+var (
+	segmentPattern     = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._~-]*$`)
+	placeholderPattern = regexp.MustCompile(`\{(\d+|\*)\}`)
+)
+
+// ValidName returns why name can't be used for a link, or nil if it can. Names are segments of letters,
+// digits, '.', '_', '~' and '-' separated by '/', each starting with a letter or digit.
+func ValidName(name string) error {
+	if len(name) > MaxNameLength {
+		return fmt.Errorf("name is longer than %d characters", MaxNameLength)
+	}
+	segments := strings.Split(name, "/")
+	if len(segments) > MaxSegments {
+		return fmt.Errorf("name has more than %d segments", MaxSegments)
+	}
+	for _, segment := range segments {
+		if !segmentPattern.MatchString(segment) {
+			return fmt.Errorf("invalid name segment %q", segment)
+		}
+	}
+	return nil
+}
+
+// Prefixes returns the names that segments could be a link under, longest first, up to MaxSegments long
+func Prefixes(segments []string) []string {
+	prefixes := make([]string, 0, min(len(segments), MaxSegments))
+	for n := min(len(segments), MaxSegments); n > 0; n-- {
+		prefixes = append(prefixes, strings.Join(segments[:n], "/"))
+	}
+	return prefixes
+}
+
+// IsTemplate returns whether the destination u has placeholders to fill in
+func IsTemplate(u string) bool {
+	return placeholderPattern.MatchString(u)
+}
+
+// Arity returns how many of the segments after a name the template u uses, or -1 if it uses them all
+func Arity(u string) int {
+	arity := 0
+	for _, m := range placeholderPattern.FindAllStringSubmatch(u, -1) {
+		if m[1] == "*" {
+			return -1
+		}
+		n, _ := strconv.Atoi(m[1])
+		arity = max(arity, n)
+	}
+	return arity
+}
+
+// Expand fills in the placeholders of the template u from args: {1} is the first, {2} the second and so
+// on, and {*} is all of them. In the path they're joined with '/' and in the query and fragment with
+// spaces, and escaped to suit where they are.
+func Expand(u string, args []string) (string, error) {
+	if arity := Arity(u); arity > len(args) {
+		return "", fmt.Errorf("the link needs %d path segments after its name, got %d", arity, len(args))
+	}
+	query := strings.IndexAny(u, "?#")
+	if query < 0 {
+		query = len(u)
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, loc := range placeholderPattern.FindAllStringSubmatchIndex(u, -1) {
+		b.WriteString(u[last:loc[0]])
+		last = loc[1]
+
+		values := args
+		if key := u[loc[2]:loc[3]]; key != "*" {
+			n, _ := strconv.Atoi(key)
+			if n == 0 {
+				return "", fmt.Errorf("placeholders start at {1}")
+			}
+			values = args[n-1 : n]
+		}
+		if loc[0] < query {
+			escaped := make([]string, len(values))
+			for i, v := range values {
+				escaped[i] = url.PathEscape(v)
+			}
+			b.WriteString(strings.Join(escaped, "/"))
+		} else {
+			b.WriteString(url.QueryEscape(strings.Join(values, " ")))
+		}
+	}
+	b.WriteString(u[last:])
+	return b.String(), nil
+}
+
+// Base returns the template u up to its first placeholder, which is where it leads without any arguments
+func Base(u string) string {
+	if loc := placeholderPattern.FindStringIndex(u); loc != nil {
+		return u[:loc[0]]
+	}
+	return u
+}
@@ -0,0 +1,92 @@
+package golink
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidName(t *testing.T) {
+	tests := map[string]bool{
+		"bug":                                   true,
+		"team/infra/oncall":                     true,
+		"v1.2_x~y-z":                            true,
+		"":                                      false,
+		"team/":                                 false,
+		"/team":                                 false,
+		"team//infra":                           false,
+		"team/.hidden":                          false,
+		"a b":                                   false,
+		"a%2Fb":                                 false,
+		strings.Repeat("a", MaxNameLength+1):    false,
+		strings.Repeat("a/", MaxSegments) + "a": false,
+	}
+	for name, valid := range tests {
+		if err := ValidName(name); (err == nil) != valid {
+			t.Errorf("ValidName(%q) = %v, want valid %v", name, err, valid)
+		}
+	}
+}
+
+func TestPrefixes(t *testing.T) {
+	got := Prefixes([]string{"team", "infra", "oncall"})
+	want := []string{"team/infra/oncall", "team/infra", "team"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Prefixes() = %v, want %v", got, want)
+	}
+	if got := Prefixes(strings.Split("a/b/c/d/e/f/g/h/i/j", "/")); len(got) != MaxSegments {
+		t.Errorf("Prefixes() of 10 segments returned %d names, want %d", len(got), MaxSegments)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		template string
+		args     []string
+		want     string
+	}{
+		{"https://tracker/issues/{1}", []string{"1234"}, "https://tracker/issues/1234"},
+		{"https://tracker/{2}/issues/{1}", []string{"1234", "web"}, "https://tracker/web/issues/1234"},
+		{"https://docs/{*}", []string{"a b", "c/d"}, "https://docs/a%20b/c%2Fd"},
+		{"https://search?q={*}&x=1", []string{"go", "links&more"}, "https://search?q=go+links%26more&x=1"},
+		{"https://docs/#{1}", []string{"intro"}, "https://docs/#intro"},
+		{"https://plain.com/", nil, "https://plain.com/"},
+	}
+	for _, tt := range tests {
+		got, err := Expand(tt.template, tt.args)
+		if err != nil || got != tt.want {
+			t.Errorf("Expand(%q, %q) = %q, %v, want %q", tt.template, tt.args, got, err, tt.want)
+		}
+	}
+
+	if _, err := Expand("https://tracker/issues/{1}", nil); err == nil {
+		t.Error("Expand() without enough args didn't fail")
+	}
+	if _, err := Expand("https://tracker/issues/{0}", []string{"x"}); err == nil {
+		t.Error("Expand() of {0} didn't fail")
+	}
+}
+
+func TestArityAndBase(t *testing.T) {
+	tests := []struct {
+		template string
+		arity    int
+		base     string
+	}{
+		{"https://tracker/issues/{1}", 1, "https://tracker/issues/"},
+		{"https://x/{3}/{1}", 3, "https://x/"},
+		{"https://docs/{*}", -1, "https://docs/"},
+		{"https://plain.com/", 0, "https://plain.com/"},
+	}
+	for _, tt := range tests {
+		if got := Arity(tt.template); got != tt.arity {
+			t.Errorf("Arity(%q) = %d, want %d", tt.template, got, tt.arity)
+		}
+		if got := Base(tt.template); got != tt.base {
+			t.Errorf("Base(%q) = %q, want %q", tt.template, got, tt.base)
+		}
+		if IsTemplate(tt.template) != (tt.arity != 0) {
+			t.Errorf("IsTemplate(%q) = %v", tt.template, IsTemplate(tt.template))
+		}
+	}
+}
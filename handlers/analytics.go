@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/labstack/echo/v5"
+)
+
+const (
+	analyticsPath   string = "/api/analytics"
+	analyticsUiPath string = "/api/analytics/ui"
+
+	defaultAnalyticsDays  = 7
+	maxAnalyticsDays      = 366
+	defaultAnalyticsLimit = 10
+	maxAnalyticsLimit     = 100
+)
+
+type (
+	analyticsReturn struct {
+		From              string          `json:"from"`
+		To                string          `json:"to"`
+		PriorFrom         string          `json:"prior_from"`
+		PriorTo           string          `json:"prior_to"`
+		Limit             int             `json:"limit"`
+		Days              []analyticsDay  `json:"days"`
+		TopLinks          []dao.LinkCount `json:"top_links"`
+		Trending          []dao.LinkCount `json:"trending"`
+		NeverClicked      []dao.LinkCount `json:"never_clicked"`
+		NeverClickedTotal int             `json:"never_clicked_total"`
+	}
+
+	// analyticsPage is what the analytics dashboard is filled in with
+	analyticsPage struct {
+		analyticsReturn
+		Prefix string
+	}
+
+	// analyticsDay is the hits on every link and the number of links created on a UTC date
+	analyticsDay struct {
+		Date    string `json:"date"`
+		Hits    int    `json:"hits"`
+		Created int    `json:"created"`
+	}
+)
+
+func (h *Handlers) analyticsHandler(c *echo.Context) error {
+	atomic.AddUint64(&h.metrics.Analytics, 1)
+
+	analytics, err := parseAnalyticsQuery(c)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	if err := h.fillAnalytics(h.store(c), &analytics); err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting analytics: %v", err))
+	}
+	return c.JSON(http.StatusOK, analytics)
+}
+
+func (h *Handlers) analyticsUiHandler(c *echo.Context) error {
+	atomic.AddUint64(&h.metrics.Analytics, 1)
+
+	analytics, err := parseAnalyticsQuery(c)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	if err := h.fillAnalytics(h.store(c), &analytics); err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting analytics: %v", err))
+	}
+
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, "analytics.html", analyticsPage{analyticsReturn: analytics, Prefix: h.prefix}); err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error drawing page: %v", err))
+	}
+	return c.HTMLBlob(http.StatusOK, buf.Bytes())
+}
+
+// parseAnalyticsQuery reads the window of UTC dates, which is either from and to, or the last days ending with to
+func parseAnalyticsQuery(c *echo.Context) (analyticsReturn, error) {
+	var analytics analyticsReturn
+
+	to := time.Now().UTC()
+	if s := c.QueryParam("to"); s != "" {
+		t, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			return analytics, fmt.Errorf("invalid to %q, expected a date like 2006-01-02", s)
+		}
+		to = t
+	}
+
+	days := defaultAnalyticsDays
+	if s := c.QueryParam("days"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return analytics, fmt.Errorf("invalid days %q, expected a positive number", s)
+		}
+		days = n
+	}
+	from := to.AddDate(0, 0, 1-days)
+	if s := c.QueryParam("from"); s != "" {
+		t, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			return analytics, fmt.Errorf("invalid from %q, expected a date like 2006-01-02", s)
+		}
+		from = t
+	}
+
+	if to.Before(from) {
+		return analytics, fmt.Errorf("from must not be after to")
+	}
+	if to.Sub(from) >= maxAnalyticsDays*24*time.Hour {
+		return analytics, fmt.Errorf("range too large, at most %d days can be returned", maxAnalyticsDays)
+	}
+
+	analytics.Limit = defaultAnalyticsLimit
+	if s := c.QueryParam("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxAnalyticsLimit {
+			return analytics, fmt.Errorf("invalid limit %q, expected 1 to %d", s, maxAnalyticsLimit)
+		}
+		analytics.Limit = n
+	}
+
+	analytics.From = from.Format(time.DateOnly)
+	analytics.To = to.Format(time.DateOnly)
+	return analytics, nil
+}
+
+// fillAnalytics reads the stats of the links in store for the window and zero-fills its days
+func (h *Handlers) fillAnalytics(store dao.ShortUrlDao, analytics *analyticsReturn) error {
+	stats, err := store.GetGlobalStats(analytics.From, analytics.To, analytics.Limit)
+	if err != nil {
+		return err
+	}
+
+	if analytics.PriorFrom, analytics.PriorTo, err = dao.PriorWindow(analytics.From, analytics.To); err != nil {
+		return err
+	}
+	from, _ := time.Parse(time.DateOnly, analytics.From)
+	to, _ := time.Parse(time.DateOnly, analytics.To)
+	analytics.Days = make([]analyticsDay, 0)
+	for _, date := range dao.UTCDates(from, to.AddDate(0, 0, 1)) {
+		analytics.Days = append(analytics.Days, analyticsDay{Date: date, Hits: stats.HitsPerDay[date], Created: stats.CreatedPerDay[date]})
+	}
+
+	// the analytics are shown to anyone, so they don't tell where protected links lead
+	for _, counts := range [][]dao.LinkCount{stats.TopLinks, stats.Trending, stats.NeverClicked} {
+		if err := hideProtectedCounts(store, counts); err != nil {
+			return err
+		}
+	}
+	analytics.TopLinks = stats.TopLinks
+	analytics.Trending = stats.Trending
+	analytics.NeverClicked = stats.NeverClicked
+	analytics.NeverClickedTotal = stats.NeverClickedTotal
+	return nil
+}
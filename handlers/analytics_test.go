@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ericfialkowski/shorturl/dao"
+)
+
+func TestHandlers_AnalyticsHandler(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+
+	now := time.Now().UTC()
+	_ = h.dao.Save("top1", "https://top.com")
+	_ = h.dao.Save("old1", "https://old.com")
+	_ = h.dao.Save("new1", "https://new.com")
+	for range 3 {
+		_, _ = h.dao.GetUrlWithHit("top1", dao.Hit{Time: now})
+	}
+	_, _ = h.dao.GetUrlWithHit("old1", dao.Hit{Time: now.AddDate(0, 0, -5)})
+
+	req := httptest.NewRequest(http.MethodGet, analyticsPath+"?days=3", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("analyticsHandler() status = %v, want %v: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var result analyticsReturn
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	today := now.Format(time.DateOnly)
+	if result.To != today || result.From != now.AddDate(0, 0, -2).Format(time.DateOnly) || result.Limit != defaultAnalyticsLimit {
+		t.Errorf("analyticsHandler() window = %s to %s limit %d", result.From, result.To, result.Limit)
+	}
+	if len(result.Days) != 3 || result.Days[2].Date != today || result.Days[2].Hits != 3 || result.Days[2].Created != 3 {
+		t.Errorf("analyticsHandler() days = %+v", result.Days)
+	}
+	if len(result.TopLinks) != 1 || result.TopLinks[0].Abbreviation != "top1" {
+		t.Errorf("analyticsHandler() top links = %+v", result.TopLinks)
+	}
+	if len(result.NeverClicked) != 1 || result.NeverClicked[0].Abbreviation != "new1" || result.NeverClickedTotal != 1 {
+		t.Errorf("analyticsHandler() never clicked = %+v (%d)", result.NeverClicked, result.NeverClickedTotal)
+	}
+}
+
+func TestHandlers_AnalyticsHandler_BadQuery(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+
+	queries := []string{
+		"days=0",
+		"days=week",
+		"from=yesterday",
+		"to=2024-13-01",
+		"from=2024-03-05&to=2024-03-01",
+		"from=2020-01-01&to=2024-01-01",
+		"limit=0",
+		"limit=1000",
+	}
+
+	for _, q := range queries {
+		req := httptest.NewRequest(http.MethodGet, analyticsPath+"?"+q, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("analyticsHandler(%s) status = %v, want %v", q, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,406 @@
+package handlers
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"unicode"
+
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/ericfialkowski/shorturl/env"
+	"github.com/ericfialkowski/shorturl/policy"
+	"github.com/ericfialkowski/shorturl/tenant"
+	"github.com/labstack/echo/v5"
+)
+
+// the colon is escaped so the router doesn't take :batch for a parameter
+const batchPath string = "/api/links\\:batch"
+
+var errTooManyItems = errors.New("too many items")
+
+type (
+	// batchReturn is the outcome of each request of a batch, in the order they were sent
+	batchReturn struct {
+		Succeeded int           `json:"succeeded"`
+		Failed    int           `json:"failed"`
+		Results   []batchResult `json:"results"`
+	}
+
+	// batchResult is what a single create request would have answered with
+	batchResult struct {
+		Status int `json:"status"`
+		*urlReturn
+		Error     string            `json:"error,omitempty"`
+		Rejection *policy.Rejection `json:"rejection,omitempty"`
+	}
+
+	// batchClaims are the generated and asked for names that requests of a batch are saving, so two of them
+	// don't end up with the same one
+	batchClaims struct {
+		mu    sync.Mutex
+		names map[string]string // name -> url
+	}
+
+	// claimedDao is a dao that also takes the names claimed by a batch as taken, so the names generated for
+	// its requests don't clash with each other either
+	claimedDao struct {
+		dao.ShortUrlDao
+		claims *batchClaims
+	}
+
+	// keyLocks serialize the requests of a batch for the same url or name, which would otherwise race each
+	// other between checking for a link and saving one
+	keyLocks map[string]*sync.Mutex
+)
+
+func (h *Handlers) succeeded(abv string) batchResult {
+	r := h.createReturn(abv)
+	return batchResult{Status: http.StatusOK, urlReturn: &r}
+}
+
+func failed(err *createError) batchResult {
+	return batchResult{Status: err.status, Error: err.message, Rejection: err.rejection}
+}
+
+func newBatchClaims() *batchClaims {
+	return &batchClaims{names: make(map[string]string)}
+}
+
+// claim takes name for u, returning the url of the link of the batch that has it already, if another does
+func (b *batchClaims) claim(name, u string) (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if claimed, ok := b.names[name]; ok {
+		return claimed, claimed == u
+	}
+	b.names[name] = u
+	return u, true
+}
+
+func (d claimedDao) GetUrl(abv string) (string, error) {
+	d.claims.mu.Lock()
+	u, ok := d.claims.names[abv]
+	d.claims.mu.Unlock()
+	if ok {
+		return u, nil
+	}
+	return d.ShortUrlDao.GetUrl(abv)
+}
+
+// claimName claims the name planned for a link, generating another when a different link of the batch has
+// it, unless it was asked for
+func claimName(t *tenant.Tenant, store claimedDao, plan linkPlan) (linkPlan, *createError) {
+	for {
+		claimed, ok := store.claims.claim(plan.abv, plan.url)
+		if ok {
+			return plan, nil
+		}
+		if plan.named {
+			return plan, &createError{status: http.StatusConflict, message: fmt.Sprintf("%s already links to %s", plan.abv, claimed)}
+		}
+		abv, err := t.Abbreviate(plan.url, store)
+		if err != nil {
+			return plan, &createError{status: http.StatusInternalServerError, message: fmt.Sprintf("Error creating abbreviation: %v", err)}
+		}
+		plan.abv = abv
+	}
+}
+
+// newKeyLocks makes a lock for each url and name in reqs
+func newKeyLocks(reqs []addRequest) keyLocks {
+	locks := make(keyLocks)
+	for _, req := range reqs {
+		for _, key := range lockKeys(req) {
+			locks[key] = &sync.Mutex{}
+		}
+	}
+	return locks
+}
+
+func lockKeys(req addRequest) []string {
+	keys := []string{"url:" + req.Url}
+	if req.Name != "" {
+		keys = append(keys, "name:"+req.Name)
+	}
+	return keys
+}
+
+// lock takes the locks of req, always in the same order so requests sharing two of them can't deadlock,
+// and returns what releases them
+func (l keyLocks) lock(req addRequest) func() {
+	keys := lockKeys(req)
+	slices.Sort(keys)
+	for _, key := range keys {
+		l[key].Lock()
+	}
+	return func() {
+		for _, key := range keys {
+			l[key].Unlock()
+		}
+	}
+}
+
+// readBatch reads the create requests of a batch, which is either a JSON array of them or a stream of them,
+// like NDJSON. Each is a url, or an object with the url and a name for the link.
+func readBatch(r io.Reader, maxItems int) ([]json.RawMessage, error) {
+	br := bufio.NewReader(r)
+	array := false
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !unicode.IsSpace(rune(b)) {
+			array = b == '['
+			_ = br.UnreadByte()
+			break
+		}
+	}
+
+	dec := json.NewDecoder(br)
+	if array {
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+	}
+	var items []json.RawMessage
+	for dec.More() {
+		if len(items) == maxItems {
+			return nil, errTooManyItems
+		}
+		var item json.RawMessage
+		if err := dec.Decode(&item); err != nil {
+			return nil, fmt.Errorf("item %d: %w", len(items), err)
+		}
+		items = append(items, item)
+	}
+	if array {
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+	}
+	if t, err := dec.Token(); err != io.EOF {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("unexpected %v after the requests", t)
+	}
+	return items, nil
+}
+
+// forEach calls do with every index below n, from up to workers goroutines at once
+func forEach(n, workers int, do func(i int)) {
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for range min(workers, n) {
+		wg.Go(func() {
+			for i := range work {
+				do(i)
+			}
+		})
+	}
+	for i := range n {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+}
+
+// batchHandler creates a link for each of the requests in the body, several at once, answering with how each
+// went in the order they were sent. With transactional=true either all of them are created or, if any of them
+// fails, none are; that needs a SQL database.
+func (h *Handlers) batchHandler(c *echo.Context) error {
+	transactional := false
+	if s := c.QueryParam("transactional"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return c.String(http.StatusBadRequest, "Invalid transactional, expected true or false")
+		}
+		transactional = b
+	}
+
+	maxItems := env.IntOrDefault("batch_max_items", 10000)
+	maxBytes := int64(env.IntOrDefault("batch_max_bytes", 32<<20))
+	items, err := readBatch(http.MaxBytesReader(c.Response(), c.Request().Body, maxBytes), maxItems)
+	if errors.Is(err, errTooManyItems) {
+		return c.String(http.StatusRequestEntityTooLarge, fmt.Sprintf("Too many requests, batches can have at most %d", maxItems))
+	}
+	if tooLarge := new(http.MaxBytesError); errors.As(err, &tooLarge) {
+		return c.String(http.StatusRequestEntityTooLarge, fmt.Sprintf("Batch too large, batches can be at most %d bytes", maxBytes))
+	}
+	if err != nil {
+		return c.String(http.StatusBadRequest, fmt.Sprintf("Error parsing batch: %v", err))
+	}
+	if len(items) == 0 {
+		return c.String(http.StatusBadRequest, "Empty batch passed in")
+	}
+
+	reqs := make([]addRequest, len(items))
+	results := make([]batchResult, len(items))
+	for i, item := range items {
+		req, err := parseAddRequest(item)
+		if err != nil {
+			results[i] = failed(&createError{status: http.StatusBadRequest, message: fmt.Sprintf("Error parsing url: %v", err)})
+		}
+		reqs[i] = req
+	}
+
+	host := c.Request().Host
+	t := h.tenantOf(c)
+	store := h.dao.ForDomain(t.Domain)
+	workers := max(1, env.IntOrDefault("batch_concurrency", 8))
+	if transactional {
+		saver, ok := store.(dao.BatchSaver)
+		if !ok {
+			return c.String(http.StatusBadRequest, "Transactional batches need a SQL database")
+		}
+		status := h.createAll(c.Request().Context(), host, t, store, saver, reqs, results, workers)
+		return c.JSON(status, h.countCreated(c, newBatchReturn(results)))
+	}
+
+	claimed := claimedDao{ShortUrlDao: store, claims: newBatchClaims()}
+	locks := newKeyLocks(reqs)
+	forEach(len(reqs), workers, func(i int) {
+		if results[i].Status == 0 {
+			results[i] = h.createOne(c.Request().Context(), host, t, claimed, reqs[i], locks)
+		}
+	})
+	return c.JSON(http.StatusOK, h.countCreated(c, newBatchReturn(results)))
+}
+
+// createOne creates the link of a single request of a batch
+func (h *Handlers) createOne(ctx context.Context, host string, t *tenant.Tenant, store claimedDao, req addRequest, locks keyLocks) batchResult {
+	defer locks.lock(req)()
+
+	plan, cerr := h.planLink(ctx, host, t, store, req)
+	if cerr != nil {
+		return failed(cerr)
+	}
+	if plan.exists {
+		return h.succeeded(plan.abv)
+	}
+	if plan, cerr = claimName(t, store, plan); cerr != nil {
+		return failed(cerr)
+	}
+
+	if err := saveLink(store, plan); err != nil {
+		return failed(&createError{status: http.StatusInternalServerError, message: fmt.Sprintf("Error saving url: %v", err)})
+	}
+	h.unfurler.Describe(t.Domain, plan.abv, plan.url)
+	h.afterCreate(ctx, LinkEvent{Domain: t.Domain, Host: host, Abbreviation: plan.abv, Url: plan.url})
+	return h.succeeded(plan.abv)
+}
+
+// createAll plans the links of every request, then saves the new ones together. When any request fails,
+// nothing is saved and the others are marked as failed because of it. It returns the status to answer with.
+func (h *Handlers) createAll(ctx context.Context, host string, t *tenant.Tenant, store dao.ShortUrlDao, saver dao.BatchSaver, reqs []addRequest, results []batchResult, workers int) int {
+	plans := make([]linkPlan, len(reqs))
+	forEach(len(reqs), workers, func(i int) {
+		if results[i].Status != 0 {
+			return
+		}
+		// the links are saved together without their options
+		if reqs[i].Expires != nil {
+			results[i] = failed(&createError{status: http.StatusBadRequest, message: "Expiring links can't be made in transactional batches"})
+			return
+		}
+		plan, cerr := h.planLink(ctx, host, t, store, reqs[i])
+		if cerr != nil {
+			results[i] = failed(cerr)
+		}
+		plans[i] = plan
+	})
+
+	// the plans were made without seeing each other, so requests for the same url share its link, names
+	// can't be given twice, and generated names that clash are made again
+	var links []dao.Link
+	byUrl := make(map[string]string) // url -> name
+	claimed := claimedDao{ShortUrlDao: store, claims: newBatchClaims()}
+	for i, plan := range plans {
+		if results[i].Status != 0 || plan.exists {
+			continue
+		}
+		if abv, ok := byUrl[plan.url]; ok {
+			if plan.named && plan.abv != abv {
+				results[i] = failed(&createError{status: http.StatusConflict, message: fmt.Sprintf("%s already links to %s", abv, plan.url)})
+				continue
+			}
+			plans[i].abv = abv
+			plans[i].exists = true
+			continue
+		}
+		plan, cerr := claimName(t, claimed, plan)
+		if cerr != nil {
+			results[i] = failed(cerr)
+			continue
+		}
+		plans[i] = plan
+		byUrl[plan.url] = plan.abv
+		links = append(links, dao.Link{Abbreviation: plan.abv, Url: plan.url})
+	}
+
+	status := 0
+	for _, r := range results {
+		status = cmp.Or(status, r.Status)
+	}
+	if status == 0 && len(links) > 0 {
+		if err := saver.SaveAll(links); err != nil {
+			status = http.StatusInternalServerError
+			for i := range results {
+				results[i] = failed(&createError{status: status, message: fmt.Sprintf("Error saving urls: %v", err)})
+			}
+			return status
+		}
+	}
+	if status != 0 {
+		for i := range results {
+			if results[i].Status == 0 {
+				results[i] = failed(&createError{status: http.StatusFailedDependency, message: "Not created, another request of the batch failed"})
+			}
+		}
+		return status
+	}
+
+	for i, plan := range plans {
+		if !plan.exists {
+			h.unfurler.Describe(t.Domain, plan.abv, plan.url)
+			h.afterCreate(ctx, LinkEvent{Domain: t.Domain, Host: host, Abbreviation: plan.abv, Url: plan.url})
+		}
+		results[i] = h.succeeded(plans[i].abv)
+	}
+	return http.StatusOK
+}
+
+// countCreated adds the requests of a batch that succeeded to the metrics, the same way in both of them
+func (h *Handlers) countCreated(c *echo.Context, r batchReturn) batchReturn {
+	atomic.AddUint64(&h.metrics.NewUrls, uint64(r.Succeeded))
+	if h.otelMetrics != nil {
+		h.otelMetrics.UrlsCreated.Add(c.Request().Context(), int64(r.Succeeded))
+	}
+	return r
+}
+
+func newBatchReturn(results []batchResult) batchReturn {
+	r := batchReturn{Results: results}
+	for _, result := range results {
+		if result.Status == http.StatusOK {
+			r.Succeeded++
+		} else {
+			r.Failed++
+		}
+	}
+	return r
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/ericfialkowski/shorturl/status"
+	"github.com/labstack/echo/v5"
+)
+
+// batchResponse is what a client reads from a batch, which can't be decoded into batchReturn since it embeds
+// an unexported type
+type batchResponse struct {
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	Results   []struct {
+		Status int    `json:"status"`
+		Abv    string `json:"abv"`
+		Error  string `json:"error"`
+	} `json:"results"`
+}
+
+func postBatch(e *echo.Echo, query, body string) (*httptest.ResponseRecorder, batchResponse) {
+	req := httptest.NewRequest(http.MethodPost, "/api/links:batch"+query, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	var r batchResponse
+	_ = json.Unmarshal(rec.Body.Bytes(), &r)
+	return rec, r
+}
+
+// manyUrls returns a JSON array of n different urls
+func manyUrls(n int) string {
+	urls := make([]string, n)
+	for i := range urls {
+		urls[i] = "https://many.com/" + strconv.Itoa(i)
+	}
+	b, _ := json.Marshal(urls)
+	return string(b)
+}
+
+func TestHandlers_BatchHandler(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+	_ = h.dao.Save("taken", "https://taken.com")
+
+	body := `["https://a.com", {"url": "https://b.com", "name": "b-link"}, "", "https://a.com",
+		{"url": "https://c.com", "name": "taken"}, 42, "https://taken.com"]`
+	rec, r := postBatch(e, "", body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /api/links:batch = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	want := []int{200, 200, 400, 200, 409, 400, 200}
+	if len(r.Results) != len(want) {
+		t.Fatalf("POST /api/links:batch has %d results, want %d", len(r.Results), len(want))
+	}
+	for i, result := range r.Results {
+		if result.Status != want[i] {
+			t.Errorf("result %d status = %d, want %d: %+v", i, result.Status, want[i], result)
+		}
+	}
+	if r.Succeeded != 4 || r.Failed != 3 {
+		t.Errorf("POST /api/links:batch succeeded/failed = %d/%d, want 4/3", r.Succeeded, r.Failed)
+	}
+	if h.metrics.NewUrls != 4 {
+		t.Errorf("NewUrls = %d after the batch, want the 4 that succeeded", h.metrics.NewUrls)
+	}
+	if r.Results[0].Abv == "" || r.Results[0].Abv != r.Results[3].Abv {
+		t.Errorf("requests for the same url got %q and %q, want the same link", r.Results[0].Abv, r.Results[3].Abv)
+	}
+	if r.Results[1].Abv != "b-link" || r.Results[6].Abv != "taken" {
+		t.Errorf("names = %q, %q, want b-link, taken", r.Results[1].Abv, r.Results[6].Abv)
+	}
+	if r.Results[4].Error == "" {
+		t.Errorf("failed result has no error: %+v", r.Results[4])
+	}
+
+	rec, r = postBatch(e, "", "\"https://d.com\"\n{\"url\": \"https://e.com\", \"name\": \"e-link\"}\n")
+	if rec.Code != http.StatusOK || r.Succeeded != 2 || r.Results[1].Abv != "e-link" {
+		t.Errorf("POST /api/links:batch with NDJSON = %d %+v, want 2 links", rec.Code, r)
+	}
+	if u, _ := h.dao.GetUrl("e-link"); u != "https://e.com" {
+		t.Errorf("GetUrl(e-link) = %v, want %v", u, "https://e.com")
+	}
+
+	rec, r = postBatch(e, "", manyUrls(200))
+	seen := make(map[string]bool)
+	for _, result := range r.Results {
+		seen[result.Abv] = true
+	}
+	if rec.Code != http.StatusOK || r.Succeeded != 200 || len(seen) != 200 {
+		t.Errorf("POST /api/links:batch of 200 urls = %d, %d succeeded with %d names, want 200", rec.Code, r.Succeeded, len(seen))
+	}
+
+	for _, tt := range []struct {
+		query, body string
+		code        int
+	}{
+		{"", `[]`, http.StatusBadRequest},
+		{"", `["https://a.com",`, http.StatusBadRequest},
+		{"", `["https://a.com"] "https://b.com"`, http.StatusBadRequest},
+		{"?transactional=maybe", `["https://a.com"]`, http.StatusBadRequest},
+		{"?transactional=true", `["https://a.com"]`, http.StatusBadRequest},
+	} {
+		if rec, _ := postBatch(e, tt.query, tt.body); rec.Code != tt.code {
+			t.Errorf("POST /api/links:batch%s %s = %d, want %d", tt.query, tt.body, rec.Code, tt.code)
+		}
+	}
+
+	t.Setenv("batch_max_items", "2")
+	if rec, _ := postBatch(e, "", `["https://a.com", "https://b.com", "https://c.com"]`); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("POST /api/links:batch over the limit = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+	t.Setenv("batch_max_bytes", "100")
+	if rec, _ := postBatch(e, "", `["https://a.com/`+strings.Repeat("a", 100)+`"]`); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("POST /api/links:batch over the byte limit = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestHandlers_BatchHandler_Transactional(t *testing.T) {
+	db := dao.CreateSQLiteDB(":memory:")
+	defer db.Cleanup()
+	h := CreateHandlers(db, status.NewStatus(), "test-id", nil)
+	e := echo.New()
+	h.SetUp(e)
+
+	rec, r := postBatch(e, "?transactional=true", `["https://t1.com", {"url": "https://t2.com", "name": "bad/stats"}]`)
+	if rec.Code != http.StatusBadRequest || len(r.Results) != 2 {
+		t.Fatalf("POST /api/links:batch?transactional=true with a bad name = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body)
+	}
+	if r.Results[0].Status != http.StatusFailedDependency || r.Results[1].Status != http.StatusBadRequest {
+		t.Errorf("result statuses = %d, %d, want %d, %d", r.Results[0].Status, r.Results[1].Status, http.StatusFailedDependency, http.StatusBadRequest)
+	}
+	if abv, _ := db.GetAbv("https://t1.com"); abv != "" {
+		t.Errorf("GetAbv() after a failed batch = %v, want empty", abv)
+	}
+
+	rec, r = postBatch(e, "?transactional=true", `["https://t1.com", {"url": "https://t2.com", "name": "t-2"}, "https://t1.com"]`)
+	if rec.Code != http.StatusOK || r.Succeeded != 3 {
+		t.Fatalf("POST /api/links:batch?transactional=true = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	if r.Results[0].Abv != r.Results[2].Abv {
+		t.Errorf("requests for the same url got %q and %q, want the same link", r.Results[0].Abv, r.Results[2].Abv)
+	}
+	if u, _ := db.GetUrl(r.Results[0].Abv); u != "https://t1.com" {
+		t.Errorf("GetUrl(%s) = %v, want %v", r.Results[0].Abv, u, "https://t1.com")
+	}
+	if u, _ := db.GetUrl("t-2"); u != "https://t2.com" {
+		t.Errorf("GetUrl(t-2) = %v, want %v", u, "https://t2.com")
+	}
+
+	rec, r = postBatch(e, "?transactional=true", `[{"url": "https://t3.com", "name": "t-3"}, {"url": "https://t4.com", "name": "t-3"}]`)
+	if rec.Code != http.StatusConflict || r.Results[1].Status != http.StatusConflict {
+		t.Errorf("POST /api/links:batch?transactional=true giving a name twice = %d %+v, want %d", rec.Code, r, http.StatusConflict)
+	}
+
+	rec, r = postBatch(e, "?transactional=true", manyUrls(200))
+	seen := make(map[string]bool)
+	for _, result := range r.Results {
+		seen[result.Abv] = true
+	}
+	if rec.Code != http.StatusOK || len(seen) != 200 {
+		t.Errorf("POST /api/links:batch?transactional=true of 200 urls = %d with %d names, want 200", rec.Code, len(seen))
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/ericfialkowski/shorturl/threats"
+	"github.com/labstack/echo/v5"
+)
+
+// blockedPage is what the warning page shown instead of redirecting is filled in with
+type blockedPage struct {
+	Abv    string
+	Url    string
+	Reason string
+}
+
+// SetThreats sets the lists of known threats that destinations are checked against when links are
+// created and again when they're followed
+func (h *Handlers) SetThreats(t *threats.Lists) {
+	h.threats = t
+}
+
+// blockIfThreat blocks abv in d when u is on a threat list, since lists change after links are created.
+// It returns the reason the link was blocked, or an empty string if it wasn't.
+func (h *Handlers) blockIfThreat(d dao.ShortUrlDao, abv, u string) string {
+	reason := h.threatReason(u)
+	if reason == "" {
+		return ""
+	}
+
+	if err := d.SetBlocked(abv, reason); err != nil {
+		log.Printf("Error blocking %s: %v", abv, err)
+	}
+	return reason
+}
+
+// threatReason returns why u can't be visited when it's on a threat list, or an empty string if it isn't. It's
+// how the targets a visitor's path fills in are checked, which leaves the link alone since others can still
+// use it safely.
+func (h *Handlers) threatReason(u string) string {
+	list, ok := h.threats.Check(u)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("listed on the %s threat list", list)
+}
+
+// blockedHandler shows a warning page in place of the redirect of a blocked link
+func (h *Handlers) blockedHandler(c *echo.Context, page blockedPage) error {
+	atomic.AddUint64(&h.metrics.Blocked, 1)
+	h.recordOtelCounter(c.Request().Context(), "blocked")
+
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, "blocked.html", page); err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error drawing page: %v", err))
+	}
+	return c.HTMLBlob(http.StatusForbidden, buf.Bytes())
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ericfialkowski/shorturl/policy"
+	"github.com/ericfialkowski/shorturl/threats"
+	"github.com/labstack/echo/v5"
+)
+
+// threatServer stands in for a threat list endpoint listing evil.example as malware
+func threatServer(t *testing.T) *threats.Lists {
+	hash := sha256.Sum256([]byte("evil.example/"))
+	body := fmt.Sprintf(`{"lists": [{"name": "malware", "prefixes": [%q]}]}`, hex.EncodeToString(hash[:4]))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	lists := threats.NewLists(server.URL)
+	if err := lists.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	return lists
+}
+
+func TestHandlers_AddHandler_Threat(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+	h.SetThreats(threatServer(t))
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`"https://www.evil.example/login"`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	var rejection policy.Rejection
+	_ = json.Unmarshal(rec.Body.Bytes(), &rejection)
+	if rec.Code != http.StatusBadRequest || rejection.Code != policy.CodeThreat || rejection.Rule != "malware" {
+		t.Errorf("addHandler() = %d %s, want a malware rejection", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandlers_GetHandler_Threat(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+
+	// created before the destination was listed
+	_ = h.dao.Save("evil1", "https://evil.example/download")
+	h.SetThreats(threatServer(t))
+
+	for range 2 {
+		req := httptest.NewRequest(http.MethodGet, "/evil1", nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusForbidden || rec.Header().Get("Location") != "" {
+			t.Fatalf("getHandler() = %d to %q, want the warning page", rec.Code, rec.Header().Get("Location"))
+		}
+		if body := rec.Body.String(); !strings.Contains(body, "malware threat list") || !strings.Contains(body, "https://evil.example/download") {
+			t.Errorf("getHandler() page = %s, want the destination and reason", body)
+		}
+	}
+
+	stats, _ := h.dao.GetStats("evil1")
+	if stats.Blocked == "" {
+		t.Errorf("GetStats().Blocked is empty, want the link blocked")
+	}
+	if h.metrics.Blocked != 2 {
+		t.Errorf("metrics.Blocked = %d, want 2", h.metrics.Blocked)
+	}
+
+	// stays blocked without the lists, since they're only checked to find new threats
+	h.SetThreats(nil)
+	req := httptest.NewRequest(http.MethodGet, "/evil1", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("getHandler() = %d, want the link to stay blocked", rec.Code)
+	}
+}
+
+func TestHandlers_GetHandler_ThreatInTarget(t *testing.T) {
+	t.Setenv("logrequests", "false")
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+	_ = h.dao.Save("out", "https://{1}/download")
+	h.SetThreats(threatServer(t))
+
+	rec := serve(e, http.MethodGet, "/out/evil.example", "")
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "https://evil.example/download") {
+		t.Errorf("GET /out/evil.example = %d to %q, want the warning page", rec.Code, rec.Header().Get("Location"))
+	}
+	// the link stays usable, as it's the visitor's path that led to the threat
+	if rec := serve(e, http.MethodGet, "/out/good.example", ""); rec.Code != http.StatusFound {
+		t.Errorf("GET /out/good.example = %d, want %d", rec.Code, http.StatusFound)
+	}
+	if stats, _ := h.dao.GetStats("out"); stats.Blocked != "" {
+		t.Errorf("GetStats().Blocked = %q, want the link left alone", stats.Blocked)
+	}
+}
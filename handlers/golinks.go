@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/ericfialkowski/shorturl/env"
+	"github.com/ericfialkowski/shorturl/golink"
+	"github.com/labstack/echo/v5"
+)
+
+const (
+	searchPath     string = "/api/search"
+	openSearchPath string = "/opensearch.xml"
+	linksPath      string = "/api/links"
+
+	maxSearchResults = 100
+	maxLinksLimit    = 1000
+)
+
+var (
+	// first segments of names that the service's own paths would hide
+	reservedNames = []string{"api", "diag", "favicon.ico", "opensearch.xml"}
+	// second segments of names that the routes under /:abv would hide
+	reservedSubpaths = []string{"stats", "qr", "options", "experiment", "password", "unlock", "tags", "collection"}
+)
+
+// searchPage is what the page shown when no link matches is filled in with
+type searchPage struct {
+	Prefix string
+	Query  string
+	Links  []dao.Link
+}
+
+// linksReturn is a page of links, by name
+type linksReturn struct {
+	Links []dao.Link `json:"links"`
+}
+
+// openSearchDescription lets browsers use the service as a search keyword
+type openSearchDescription struct {
+	XMLName       xml.Name      `xml:"http://a9.com/-/spec/opensearch/1.1/ OpenSearchDescription"`
+	ShortName     string        `xml:"ShortName"`
+	Description   string        `xml:"Description"`
+	InputEncoding string        `xml:"InputEncoding"`
+	Url           openSearchUrl `xml:"Url"`
+}
+
+type openSearchUrl struct {
+	Type     string `xml:"type,attr"`
+	Method   string `xml:"method,attr"`
+	Template string `xml:"template,attr"`
+}
+
+// abvParam returns the abbreviation in the path. It's unescaped, so names with several segments can be
+// given with their slashes escaped, like /team%2Finfra/stats.
+func abvParam(c *echo.Context) string {
+	abv := c.Param("abv")
+	if unescaped, err := url.PathUnescape(abv); err == nil {
+		return unescaped
+	}
+	return abv
+}
+
+// checkName returns why name can't be given to a new link, or nil if it can
+func checkName(name string) error {
+	if err := golink.ValidName(name); err != nil {
+		return err
+	}
+	segments := strings.Split(name, "/")
+	if slices.Contains(reservedNames, strings.ToLower(segments[0])) {
+		return fmt.Errorf("names can't start with %s", segments[0])
+	}
+	if len(segments) > 1 && slices.Contains(reservedSubpaths, strings.ToLower(segments[1])) {
+		return fmt.Errorf("%s can't be the second segment of a name", segments[1])
+	}
+	return nil
+}
+
+// planNamed plans a link to u called name, which is fine to repeat but not to point at somewhere else
+func planNamed(store dao.ShortUrlDao, name, u string) (linkPlan, *createError) {
+	if err := checkName(name); err != nil {
+		return linkPlan{}, &createError{status: http.StatusBadRequest, message: err.Error()}
+	}
+
+	existing, err := store.FindLink([]string{name})
+	if err != nil {
+		return linkPlan{}, &createError{status: http.StatusInternalServerError, message: fmt.Sprintf("Error finding link: %v", err)}
+	}
+	if existing.Abbreviation != "" {
+		if existing.Url != u {
+			// where a protected link leads is kept from whoever asks for its name
+			hash, err := store.GetPassword(name)
+			if err != nil {
+				return linkPlan{}, &createError{status: http.StatusInternalServerError, message: fmt.Sprintf("Error finding link: %v", err)}
+			}
+			if hash != "" {
+				return linkPlan{}, &createError{status: http.StatusConflict, message: fmt.Sprintf("%s is already taken", name)}
+			}
+			return linkPlan{}, &createError{status: http.StatusConflict, message: fmt.Sprintf("%s already links to %s", name, existing.Url)}
+		}
+		return linkPlan{abv: name, url: u, named: true, exists: true}, nil
+	}
+	// every destination has a single link
+	if abv, _ := store.GetAbv(u); abv != "" {
+		return linkPlan{}, &createError{status: http.StatusConflict, message: fmt.Sprintf("%s already links to %s", abv, u)}
+	}
+	return linkPlan{abv: name, url: u, named: true}, nil
+}
+
+// resolvedPath is the link a request path leads to, and what follows its name
+type resolvedPath struct {
+	abv  string
+	args []string // unescaped segments filling in the link's template
+	rest string   // escaped path left over for passthrough
+}
+
+// resolvePath finds the link with the longest name that the request path starts with. When its destination
+// is a template, the segments after the name fill it in, and the rest is left for passthrough. abv is empty
+// when no link matches.
+func (h *Handlers) resolvePath(c *echo.Context) (resolvedPath, error) {
+	rest := restOfPath(c)
+	if rest == "" {
+		// the common case of a single segment, which GetUrlWithHit tells the existence of
+		return resolvedPath{abv: abvParam(c)}, nil
+	}
+
+	segments := strings.Split(strings.TrimPrefix(c.Request().URL.EscapedPath(), "/"), "/")
+	unescaped := make([]string, len(segments))
+	for i, segment := range segments {
+		s, err := url.PathUnescape(segment)
+		if err != nil {
+			return resolvedPath{}, fmt.Errorf("invalid path: %v", err)
+		}
+		unescaped[i] = s
+	}
+
+	link, err := h.store(c).FindLink(golink.Prefixes(unescaped))
+	if err != nil || link.Abbreviation == "" {
+		return resolvedPath{}, err
+	}
+
+	n := strings.Count(link.Abbreviation, "/") + 1
+	args := 0
+	if golink.IsTemplate(link.Url) {
+		args = len(segments) - n
+		if arity := golink.Arity(link.Url); arity >= 0 {
+			args = min(arity, args)
+		}
+	}
+	return resolvedPath{
+		abv:  link.Abbreviation,
+		args: unescaped[n : n+args],
+		rest: strings.Join(segments[n+args:], "/"),
+	}, nil
+}
+
+// notFoundHandler shows the links whose names start like the path that didn't match one, with a search box
+func (h *Handlers) notFoundHandler(c *echo.Context) error {
+	name, err := url.PathUnescape(strings.TrimPrefix(c.Request().URL.EscapedPath(), "/"))
+	if err != nil {
+		name = c.Request().URL.Path
+	}
+	prefix, _, _ := strings.Cut(name, "/")
+	return h.searchPage(c, http.StatusNotFound, name, prefix)
+}
+
+// searchHandler goes to the link a search like "bug 1234" names, treating the words as path segments, or
+// shows the links whose names start with the first word when there isn't one
+func (h *Handlers) searchHandler(c *echo.Context) error {
+	atomic.AddUint64(&h.metrics.Searches, 1)
+
+	query := strings.TrimSpace(c.QueryParam("q"))
+	words := strings.Fields(strings.ReplaceAll(query, "/", " "))
+	if len(words) == 0 {
+		return h.searchPage(c, http.StatusOK, "", "")
+	}
+
+	link, err := h.store(c).FindLink(golink.Prefixes(words))
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error searching links: %v", err))
+	}
+	if link.Abbreviation == "" {
+		return h.searchPage(c, http.StatusOK, query, words[0])
+	}
+
+	escaped := make([]string, len(words))
+	for i, word := range words {
+		escaped[i] = url.PathEscape(word)
+	}
+	http.Redirect(c.Response(), c.Request(), h.prefix+"/"+strings.Join(escaped, "/"), http.StatusFound)
+	return nil
+}
+
+// linksHandler lists the links whose names start with the prefix query parameter, or all of them without one,
+// by name
+func (h *Handlers) linksHandler(c *echo.Context) error {
+	atomic.AddUint64(&h.metrics.Searches, 1)
+
+	limit, err := queryInt(c, "limit", maxSearchResults, 1, maxLinksLimit)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	links, err := h.store(c).SearchLinks(c.QueryParam("prefix"), limit)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error searching links: %v", err))
+	}
+	return c.JSON(http.StatusOK, linksReturn{Links: hideProtected(links)})
+}
+
+func (h *Handlers) searchPage(c *echo.Context, status int, query, prefix string) error {
+	links, err := h.store(c).SearchLinks(prefix, maxSearchResults)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error searching links: %v", err))
+	}
+
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, "search.html", searchPage{Prefix: h.prefix, Query: query, Links: links}); err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error drawing page: %v", err))
+	}
+	return c.HTMLBlob(status, buf.Bytes())
+}
+
+// openSearchHandler describes the search, so browsers can add the service as a search keyword
+func (h *Handlers) openSearchHandler(c *echo.Context) error {
+	description := openSearchDescription{
+		ShortName:     env.StringOrDefault("opensearch_name", "go"),
+		Description:   "Go to a short link by name",
+		InputEncoding: "UTF-8",
+		Url: openSearchUrl{
+			Type:     "text/html",
+			Method:   "get",
+			Template: fmt.Sprintf("%s://%s%s%s?q={searchTerms}", c.Scheme(), c.Request().Host, h.prefix, searchPath),
+		},
+	}
+	b, err := xml.MarshalIndent(description, "", "  ")
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error describing search: %v", err))
+	}
+	return c.Blob(http.StatusOK, "application/opensearchdescription+xml", append([]byte(xml.Header), b...))
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/labstack/echo/v5"
+)
+
+func TestHandlers_AddHandler_Named(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+	_ = h.dao.Save("taken", "https://taken.com")
+	_ = h.dao.Save("secret", "https://secret.com")
+	_ = h.dao.SetPassword("secret", "hash")
+
+	tests := []struct {
+		body string
+		code int
+		abv  string
+		hide string // what the response can't include
+	}{
+		{`{"url":"https://tracker.com/issues/{1}","name":"bug"}`, http.StatusOK, "bug", ""},
+		{`{"url":"https://tracker.com/issues/{1}","name":"bug"}`, http.StatusOK, "bug", ""},
+		{`{"url":"https://other.com/","name":"bug"}`, http.StatusConflict, "", ""},
+		{`{"url":"https://wiki.com/infra/oncall","name":"team/infra/oncall"}`, http.StatusOK, "team/infra/oncall", ""},
+		{`{"url":"https://taken.com","name":"mine"}`, http.StatusConflict, "", ""},
+		{`{"url":"https://other.com/","name":"secret"}`, http.StatusConflict, "", "secret.com"},
+		{`{"url":"https://x.com/","name":"api/x"}`, http.StatusBadRequest, "", ""},
+		{`{"url":"https://x.com/","name":"team/stats"}`, http.StatusBadRequest, "", ""},
+		{`{"url":"https://x.com/","name":"team/tags"}`, http.StatusBadRequest, "", ""},
+		{`{"url":"https://x.com/","name":"team/Collection/x"}`, http.StatusBadRequest, "", ""},
+		{`{"url":"https://x.com/","name":"a b"}`, http.StatusBadRequest, "", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Host = "sho.rt"
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		if rec.Code != tt.code {
+			t.Errorf("addHandler(%s) status = %v, want %v: %s", tt.body, rec.Code, tt.code, rec.Body.String())
+			continue
+		}
+		if tt.hide != "" && strings.Contains(rec.Body.String(), tt.hide) {
+			t.Errorf("addHandler(%s) = %s, want %s hidden", tt.body, rec.Body.String(), tt.hide)
+		}
+		if tt.abv != "" {
+			var result urlReturn
+			_ = json.Unmarshal(rec.Body.Bytes(), &result)
+			if result.Abv != tt.abv || result.UrlLink != "/"+tt.abv {
+				t.Errorf("addHandler(%s) = %+v, want %s", tt.body, result, tt.abv)
+			}
+		}
+	}
+
+	var result urlReturn
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"url":"https://wiki.com/x","name":"team/x"}`))
+	req.Host = "sho.rt"
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	_ = json.Unmarshal(rec.Body.Bytes(), &result)
+	if result.StatsLink != "/team%2Fx/stats" {
+		t.Errorf("StatsLink = %q, want the name escaped", result.StatsLink)
+	}
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, result.StatsLink, nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"abbreviation":"team/x"`) {
+		t.Errorf("GET %s = %d %s, want the stats of team/x", result.StatsLink, rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandlers_GetHandler_GoLinks(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+	_ = h.dao.Save("bug", "https://tracker.com/issues/{1}")
+	_ = h.dao.Save("team", "https://team.com/")
+	_ = h.dao.Save("team/infra", "https://infra.com/")
+	_ = h.dao.Save("team/infra/oncall", "https://pager.com/schedules/infra")
+	_ = h.dao.Save("docs", "https://docs.com/{*}")
+	_ = h.dao.Save("search", "https://find.com/?q={*}")
+	_ = h.dao.Save("pass", "https://pass.com/{1}")
+	_ = h.dao.SetOptions("pass", dao.Options{Passthrough: &dao.Passthrough{Path: true}})
+
+	tests := []struct {
+		path     string
+		code     int
+		location string
+	}{
+		{"/bug/1234", http.StatusFound, "https://tracker.com/issues/1234"},
+		{"/bug/12%2034", http.StatusFound, "https://tracker.com/issues/12%2034"},
+		{"/bug", http.StatusBadRequest, ""},
+		{"/bug/1/2", http.StatusNotFound, ""}, // the extra segment isn't passed through
+		{"/team/infra/oncall", http.StatusFound, "https://pager.com/schedules/infra"},
+		{"/team/infra", http.StatusFound, "https://infra.com/"},
+		{"/team%2Finfra", http.StatusFound, "https://infra.com/"},
+		{"/team/infra/unknown", http.StatusNotFound, ""},
+		{"/docs/a/b", http.StatusFound, "https://docs.com/a/b"},
+		{"/docs", http.StatusFound, "https://docs.com/"},
+		{"/search/go/links", http.StatusFound, "https://find.com/?q=go+links"},
+		{"/pass/x/y/z", http.StatusFound, "https://pass.com/x/y/z"},
+		{"/nothing/here", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		if rec.Code != tt.code || rec.Header().Get("Location") != tt.location {
+			t.Errorf("GET %s = %d to %q, want %d to %q", tt.path, rec.Code, rec.Header().Get("Location"), tt.code, tt.location)
+		}
+	}
+}
+
+func TestHandlers_SearchHandler(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+	_ = h.dao.Save("bug", "https://tracker.com/issues/{1}")
+	_ = h.dao.Save("team/infra", "https://infra.com/")
+	_ = h.dao.Save("team/web", "https://web.com/")
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/search?q=bug+1234", nil))
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/bug/1234" {
+		t.Errorf("search for bug 1234 = %d to %q, want a redirect to /bug/1234", rec.Code, rec.Header().Get("Location"))
+	}
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/search?q=team+data", nil))
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || !strings.Contains(body, "team/infra") || !strings.Contains(body, "team/web") {
+		t.Errorf("search for team data = %d, want the team links listed: %s", rec.Code, body)
+	}
+
+	// paths that don't match a link show the same page
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/team/<data>", nil))
+	body = rec.Body.String()
+	if rec.Code != http.StatusNotFound || !strings.Contains(body, "team/web") || !strings.Contains(body, "team/&lt;data&gt;") {
+		t.Errorf("GET /team/<data> = %d, want the search page: %s", rec.Code, body)
+	}
+	if h.metrics.Searches != 2 {
+		t.Errorf("metrics.Searches = %d, want 2", h.metrics.Searches)
+	}
+}
+
+func TestHandlers_LinksHandler(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+	_ = h.dao.Save("team/web", "https://web.com/")
+	_ = h.dao.Save("team/infra", "https://infra.com/")
+	_ = h.dao.Save("docs", "https://docs.com/")
+
+	for _, test := range []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"docs", "team/infra", "team/web"}},
+		{"?prefix=team/", []string{"team/infra", "team/web"}},
+		{"?prefix=team&limit=1", []string{"team/infra"}},
+		{"?prefix=nothing", nil},
+	} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/links"+test.query, nil))
+		var r linksReturn
+		if err := json.Unmarshal(rec.Body.Bytes(), &r); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("GET /api/links%s = %d, %v", test.query, rec.Code, err)
+		}
+		var got []string
+		for _, link := range r.Links {
+			got = append(got, link.Abbreviation)
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("GET /api/links%s = %v, want %v", test.query, got, test.want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/links?limit=5000", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("GET /api/links?limit=5000 = %d, want 400", rec.Code)
+	}
+}
+
+func TestHandlers_OpenSearchHandler(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+
+	req := httptest.NewRequest(http.MethodGet, "/opensearch.xml", nil)
+	req.Host = "go.example"
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/opensearchdescription+xml" {
+		t.Fatalf("openSearchHandler() = %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var description openSearchDescription
+	if err := xml.Unmarshal(rec.Body.Bytes(), &description); err != nil {
+		t.Fatalf("openSearchHandler() returned invalid XML: %v", err)
+	}
+	if want := "http://go.example/api/search?q={searchTerms}"; description.Url.Template != want {
+		t.Errorf("Url.Template = %q, want %q", description.Url.Template, want)
+	}
+}
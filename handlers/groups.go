@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/labstack/echo/v5"
+)
+
+const (
+	tagsPath            string = "/:abv/tags"
+	tagPath             string = "/:abv/tags/:tag"
+	collectionPath      string = "/:abv/collection"
+	tagLinksPath        string = "/api/tags/:tag"
+	tagStatsPath        string = "/api/tags/:tag/stats"
+	collectionLinksPath string = "/api/collections/:collection"
+	collectionStatsPath string = "/api/collections/:collection/stats"
+
+	maxTags                = 32
+	defaultGroupLinksLimit = 100
+	maxGroupLinksLimit     = 1000
+)
+
+type (
+	// groupsReturn is how a link is organized
+	groupsReturn struct {
+		Tags       []string `json:"tags"`
+		Collection string   `json:"collection"`
+	}
+
+	// groupLinksReturn is the links with a tag or in a collection
+	groupLinksReturn struct {
+		Kind  string     `json:"kind"`
+		Name  string     `json:"name"`
+		Links []dao.Link `json:"links"`
+	}
+
+	// groupStatsReturn summarizes the links with a tag or in a collection over a window of UTC dates
+	groupStatsReturn struct {
+		Kind       string          `json:"kind"`
+		Name       string          `json:"name"`
+		From       string          `json:"from"`
+		To         string          `json:"to"`
+		Limit      int             `json:"limit"`
+		Links      int             `json:"links"`
+		Hits       int             `json:"hits"`
+		WindowHits int             `json:"window_hits"`
+		Days       []groupDay      `json:"days"`
+		TopLinks   []dao.LinkCount `json:"top_links"`
+	}
+
+	// groupDay is the hits on the links of a group on a UTC date
+	groupDay struct {
+		Date string `json:"date"`
+		Hits int    `json:"hits"`
+	}
+)
+
+func newGroupsReturn(tags []string, collection string) groupsReturn {
+	if tags == nil {
+		tags = make([]string, 0)
+	}
+	return groupsReturn{Tags: tags, Collection: collection}
+}
+
+// addTagsHandler tags a link with each of the tags in the body, a JSON array
+func (h *Handlers) addTagsHandler(c *echo.Context) error {
+	atomic.AddUint64(&h.metrics.Groups, 1)
+
+	var tags []string
+	if err := json.NewDecoder(c.Request().Body).Decode(&tags); err != nil {
+		return c.String(http.StatusBadRequest, fmt.Sprintf("Error parsing tags: %v", err))
+	}
+	for i, tag := range tags {
+		normalized, err := dao.NormalizeGroupName(tag)
+		if err != nil {
+			return c.String(http.StatusBadRequest, fmt.Sprintf("Invalid tag: %v", err))
+		}
+		tags[i] = normalized
+	}
+
+	store := h.store(c)
+	abv := abvParam(c)
+	stats, err := store.GetStats(abv)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting link: %v", err))
+	}
+	if stats.Abbreviation == "" {
+		return c.String(http.StatusNotFound, "No link found")
+	}
+	merged := slices.Concat(stats.Tags, tags)
+	slices.Sort(merged)
+	if merged = slices.Compact(merged); len(merged) > maxTags {
+		return c.String(http.StatusBadRequest, fmt.Sprintf("Too many tags, links can have at most %d", maxTags))
+	}
+
+	if err := store.AddTags(abv, tags); err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error tagging link: %v", err))
+	}
+	return c.JSON(http.StatusOK, newGroupsReturn(merged, stats.Collection))
+}
+
+// removeTagHandler takes a tag off a link
+func (h *Handlers) removeTagHandler(c *echo.Context) error {
+	atomic.AddUint64(&h.metrics.Groups, 1)
+
+	tag, err := dao.NormalizeGroupName(c.Param("tag"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, fmt.Sprintf("Invalid tag: %v", err))
+	}
+
+	store := h.store(c)
+	abv := abvParam(c)
+	stats, err := store.GetStats(abv)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting link: %v", err))
+	}
+	if stats.Abbreviation == "" {
+		return c.String(http.StatusNotFound, "No link found")
+	}
+
+	if err := store.RemoveTags(abv, []string{tag}); err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error untagging link: %v", err))
+	}
+	tags := slices.DeleteFunc(stats.Tags, func(t string) bool { return t == tag })
+	return c.JSON(http.StatusOK, newGroupsReturn(tags, stats.Collection))
+}
+
+// setCollectionHandler puts a link in the collection named by the body, a JSON string. Sending "" takes it out.
+func (h *Handlers) setCollectionHandler(c *echo.Context) error {
+	atomic.AddUint64(&h.metrics.Groups, 1)
+
+	var collection string
+	if err := json.NewDecoder(c.Request().Body).Decode(&collection); err != nil {
+		return c.String(http.StatusBadRequest, fmt.Sprintf("Error parsing collection: %v", err))
+	}
+	if collection != "" {
+		normalized, err := dao.NormalizeGroupName(collection)
+		if err != nil {
+			return c.String(http.StatusBadRequest, fmt.Sprintf("Invalid collection: %v", err))
+		}
+		collection = normalized
+	}
+
+	store := h.store(c)
+	abv := abvParam(c)
+	stats, err := store.GetStats(abv)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting link: %v", err))
+	}
+	if stats.Abbreviation == "" {
+		return c.String(http.StatusNotFound, "No link found")
+	}
+
+	if err := store.SetCollection(abv, collection); err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error setting collection: %v", err))
+	}
+	return c.JSON(http.StatusOK, newGroupsReturn(stats.Tags, collection))
+}
+
+// groupParam returns the group named in the path, which is a tag unless the path has a collection
+func groupParam(c *echo.Context) (dao.Group, error) {
+	group := dao.Group{Kind: dao.TagGroup, Name: c.Param("tag")}
+	if collection := c.Param("collection"); collection != "" {
+		group = dao.Group{Kind: dao.CollectionGroup, Name: collection}
+	}
+	name, err := dao.NormalizeGroupName(group.Name)
+	if err != nil {
+		return group, fmt.Errorf("invalid %s: %v", group.Kind, err)
+	}
+	group.Name = name
+	return group, nil
+}
+
+// groupLinksHandler lists the links with a tag or in a collection, by name
+func (h *Handlers) groupLinksHandler(c *echo.Context) error {
+	atomic.AddUint64(&h.metrics.Groups, 1)
+
+	group, err := groupParam(c)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	limit, err := queryInt(c, "limit", defaultGroupLinksLimit, 1, maxGroupLinksLimit)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	links, err := h.store(c).GetGroupLinks(group, limit)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting links: %v", err))
+	}
+	return c.JSON(http.StatusOK, groupLinksReturn{Kind: group.Kind, Name: group.Name, Links: hideProtected(links)})
+}
+
+// groupStatsHandler adds up the hits of the links with a tag or in a collection, over the same window of
+// dates as the analytics
+func (h *Handlers) groupStatsHandler(c *echo.Context) error {
+	atomic.AddUint64(&h.metrics.Groups, 1)
+
+	group, err := groupParam(c)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	window, err := parseAnalyticsQuery(c)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	store := h.store(c)
+	stats, err := store.GetGroupStats(group, window.From, window.To, window.Limit)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting stats: %v", err))
+	}
+	if err := hideProtectedCounts(store, stats.TopLinks); err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting stats: %v", err))
+	}
+
+	r := groupStatsReturn{
+		Kind:     group.Kind,
+		Name:     group.Name,
+		From:     window.From,
+		To:       window.To,
+		Limit:    window.Limit,
+		Links:    stats.Links,
+		Hits:     stats.Hits,
+		Days:     make([]groupDay, 0),
+		TopLinks: stats.TopLinks,
+	}
+	from, _ := time.Parse(time.DateOnly, window.From)
+	to, _ := time.Parse(time.DateOnly, window.To)
+	for _, date := range dao.UTCDates(from, to.AddDate(0, 0, 1)) {
+		r.Days = append(r.Days, groupDay{Date: date, Hits: stats.HitsPerDay[date]})
+		r.WindowHits += stats.HitsPerDay[date]
+	}
+	return c.JSON(http.StatusOK, r)
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ericfialkowski/shorturl/dao"
+)
+
+func TestHandlers_Groups(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+
+	_ = h.dao.Save("g1", "https://g1.com")
+	_ = h.dao.Save("g2", "https://g2.com")
+	now := time.Now()
+	for range 2 {
+		_, _ = h.dao.GetUrlWithHit("g1", dao.Hit{Time: now})
+	}
+	_, _ = h.dao.GetUrlWithHit("g2", dao.Hit{Time: now})
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		method, path, body string
+		code               int
+		want               groupsReturn
+	}{
+		{http.MethodPost, "/g1/tags", `["Spring", "email"]`, http.StatusOK, groupsReturn{[]string{"email", "spring"}, ""}},
+		{http.MethodPost, "/g2/tags", `["spring"]`, http.StatusOK, groupsReturn{[]string{"spring"}, ""}},
+		{http.MethodPut, "/g1/collection", `"Launch"`, http.StatusOK, groupsReturn{[]string{"email", "spring"}, "launch"}},
+		{http.MethodDelete, "/g1/tags/email", ``, http.StatusOK, groupsReturn{[]string{"spring"}, "launch"}},
+		{http.MethodPost, "/g1/tags", `["not a tag"]`, http.StatusBadRequest, groupsReturn{}},
+		{http.MethodPost, "/g1/tags", `"spring"`, http.StatusBadRequest, groupsReturn{}},
+		{http.MethodPut, "/g1/collection", `"a/b"`, http.StatusBadRequest, groupsReturn{}},
+		{http.MethodPost, "/missing/tags", `["spring"]`, http.StatusNotFound, groupsReturn{}},
+	}
+	for _, tt := range tests {
+		rec := do(tt.method, tt.path, tt.body)
+		if rec.Code != tt.code {
+			t.Errorf("%s %s = %d, want %d: %s", tt.method, tt.path, rec.Code, tt.code, rec.Body)
+			continue
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+		var got groupsReturn
+		_ = json.Unmarshal(rec.Body.Bytes(), &got)
+		if !slices.Equal(got.Tags, tt.want.Tags) || got.Collection != tt.want.Collection {
+			t.Errorf("%s %s = %+v, want %+v", tt.method, tt.path, got, tt.want)
+		}
+	}
+
+	many := make([]string, maxTags)
+	for i := range many {
+		many[i] = "t" + strconv.Itoa(i)
+	}
+	body, _ := json.Marshal(many)
+	rec := do(http.MethodPost, "/g2/tags", string(body))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("POST /g2/tags with too many tags = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	var links groupLinksReturn
+	rec = do(http.MethodGet, "/api/tags/spring", "")
+	_ = json.Unmarshal(rec.Body.Bytes(), &links)
+	if rec.Code != http.StatusOK || links.Kind != dao.TagGroup || len(links.Links) != 2 || links.Links[0].Abbreviation != "g1" {
+		t.Errorf("GET /api/tags/spring = %d %+v, want g1 and g2", rec.Code, links)
+	}
+	rec = do(http.MethodGet, "/api/collections/launch", "")
+	_ = json.Unmarshal(rec.Body.Bytes(), &links)
+	if rec.Code != http.StatusOK || links.Kind != dao.CollectionGroup || len(links.Links) != 1 {
+		t.Errorf("GET /api/collections/launch = %d %+v, want g1", rec.Code, links)
+	}
+
+	var stats groupStatsReturn
+	rec = do(http.MethodGet, "/api/tags/spring/stats?days=3", "")
+	_ = json.Unmarshal(rec.Body.Bytes(), &stats)
+	if rec.Code != http.StatusOK || stats.Links != 2 || stats.Hits != 3 || stats.WindowHits != 3 || len(stats.Days) != 3 {
+		t.Errorf("GET /api/tags/spring/stats = %d %+v, want 2 links with 3 hits over 3 days", rec.Code, stats)
+	}
+	if len(stats.TopLinks) != 2 || stats.TopLinks[0].Abbreviation != "g1" || stats.TopLinks[0].Hits != 2 {
+		t.Errorf("GET /api/tags/spring/stats top links = %v, want g1 first with 2 hits", stats.TopLinks)
+	}
+	if rec = do(http.MethodGet, "/api/collections/launch/stats?limit=0", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("GET /api/collections/launch/stats?limit=0 = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if h.metrics.Groups == 0 {
+		t.Errorf("metrics.Groups = 0, want the group requests counted")
+	}
+}
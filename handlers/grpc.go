@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/ericfialkowski/shorturl/password"
+	shorturlv1 "github.com/ericfialkowski/shorturl/proto/shorturl/v1"
+	"github.com/ericfialkowski/shorturl/status"
+	"github.com/ericfialkowski/shorturl/tenant"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	grpcstatus "google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// how often Watch looks for changes of the status
+const healthWatchInterval = time.Second
+
+type (
+	// linkService is the gRPC face of the handlers, working on the same links with the same checks
+	linkService struct {
+		shorturlv1.UnimplementedShortUrlServiceServer
+		h *Handlers
+	}
+
+	// healthService answers the standard gRPC health checks from the same status as /diag/status
+	healthService struct {
+		grpc_health_v1.UnimplementedHealthServer
+		status *status.SimpleStatus
+	}
+)
+
+// RegisterGRPC serves the links on s too, along with the standard health service and reflection, so tools like
+// grpcurl can find the methods
+func (h *Handlers) RegisterGRPC(s *grpc.Server) {
+	shorturlv1.RegisterShortUrlServiceServer(s, &linkService{h: h})
+	grpc_health_v1.RegisterHealthServer(s, &healthService{status: h.status})
+	reflection.Register(s)
+}
+
+// grpcHost returns the host a call was made to, which picks its tenant like the Host header does over HTTP
+func grpcHost(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if authority := md.Get(":authority"); len(authority) > 0 {
+		return authority[0]
+	}
+	return ""
+}
+
+// grpcError turns the status of an HTTP answer into the gRPC code meaning the same
+func grpcError(httpStatus int, message string) error {
+	code := codes.Internal
+	switch httpStatus {
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusConflict:
+		code = codes.AlreadyExists
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusTooManyRequests:
+		code = codes.ResourceExhausted
+	}
+	return grpcstatus.Error(code, message)
+}
+
+func (s *linkService) tenant(ctx context.Context) (*tenant.Tenant, dao.ShortUrlDao) {
+	t := s.h.tenants.For(grpcHost(ctx))
+	return t, s.h.dao.ForDomain(t.Domain)
+}
+
+// unlock returns whether the password opens abv, whose password hash is hash. Guesses are limited the same
+// way as on the unlock form.
+func (s *linkService) unlock(ctx context.Context, t *tenant.Tenant, abv, hash, pw string) (bool, error) {
+	if hash == "" {
+		return true, nil
+	}
+	if pw == "" {
+		return false, nil
+	}
+
+	ip := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		ip, _, _ = net.SplitHostPort(p.Addr.String())
+	}
+	link := t.Domain + "\x00" + abv
+	if wait := s.h.unlock.attempt(link, ip, time.Now()); wait > 0 {
+		return false, grpcError(http.StatusTooManyRequests, "Too many attempts, try again later")
+	}
+	if !password.Verify(pw, hash) {
+		return false, grpcError(http.StatusForbidden, "That password isn't right")
+	}
+	s.h.unlock.forget(link, ip)
+	return true, nil
+}
+
+func (s *linkService) CreateLink(ctx context.Context, req *shorturlv1.CreateLinkRequest) (*shorturlv1.CreateLinkResponse, error) {
+	atomic.AddUint64(&s.h.metrics.NewUrls, 1)
+	s.h.recordOtelCounter(ctx, "create")
+
+	t, store := s.tenant(ctx)
+	plan, cerr := s.h.planLink(ctx, grpcHost(ctx), t, store, addRequest{Url: req.GetUrl(), Name: req.GetName()})
+	if cerr != nil {
+		return nil, grpcError(cerr.status, cerr.message)
+	}
+	if !plan.exists {
+		if err := store.Save(plan.abv, plan.url); err != nil {
+			return nil, grpcError(http.StatusInternalServerError, "Error saving url: "+err.Error())
+		}
+		s.h.unfurler.Describe(t.Domain, plan.abv, plan.url)
+		s.h.afterCreate(ctx, LinkEvent{Domain: t.Domain, Host: grpcHost(ctx), Abbreviation: plan.abv, Url: plan.url})
+	}
+	return &shorturlv1.CreateLinkResponse{
+		Link:    &shorturlv1.Link{Abbreviation: plan.abv, Url: plan.url},
+		Created: !plan.exists,
+	}, nil
+}
+
+func (s *linkService) ResolveLink(ctx context.Context, req *shorturlv1.ResolveLinkRequest) (*shorturlv1.ResolveLinkResponse, error) {
+	t, store := s.tenant(ctx)
+	link, err := store.FindLink([]string{req.GetAbbreviation()})
+	if err != nil {
+		return nil, grpcError(http.StatusInternalServerError, "Error finding link: "+err.Error())
+	}
+	if link.Abbreviation == "" {
+		return nil, grpcError(http.StatusNotFound, "No link found")
+	}
+
+	hash, err := store.GetPassword(link.Abbreviation)
+	if err != nil {
+		return nil, grpcError(http.StatusInternalServerError, "Error getting link: "+err.Error())
+	}
+	unlocked, err := s.unlock(ctx, t, link.Abbreviation, hash, req.GetPassword())
+	if err != nil {
+		return nil, err
+	}
+	r := &shorturlv1.Link{Abbreviation: link.Abbreviation, Url: link.Url, Protected: hash != ""}
+	if !unlocked {
+		r.Url = ""
+	}
+	return &shorturlv1.ResolveLinkResponse{Link: r}, nil
+}
+
+func (s *linkService) GetStats(ctx context.Context, req *shorturlv1.GetStatsRequest) (*shorturlv1.Stats, error) {
+	atomic.AddUint64(&s.h.metrics.UrlStats, 1)
+	s.h.recordOtelCounter(ctx, "stats")
+
+	t, store := s.tenant(ctx)
+	stats, err := store.GetStats(req.GetAbbreviation())
+	if err != nil {
+		return nil, grpcError(http.StatusInternalServerError, "Error getting stats: "+err.Error())
+	}
+	if stats.Abbreviation == "" {
+		return nil, grpcError(http.StatusNotFound, "No link found")
+	}
+
+	url := stats.Url
+	if stats.Protected {
+		hash, err := store.GetPassword(stats.Abbreviation)
+		if err != nil {
+			return nil, grpcError(http.StatusInternalServerError, "Error getting stats: "+err.Error())
+		}
+		unlocked, err := s.unlock(ctx, t, stats.Abbreviation, hash, req.GetPassword())
+		if err != nil {
+			return nil, err
+		}
+		if !unlocked {
+			url = ""
+		}
+	}
+
+	r := &shorturlv1.Stats{
+		Link:         &shorturlv1.Link{Abbreviation: stats.Abbreviation, Url: url, Protected: stats.Protected},
+		Domain:       stats.Domain,
+		Hits:         stats.Hits,
+		BotHits:      stats.BotHits,
+		Uniques:      stats.Uniques,
+		DailyHits:    int32Map(stats.DailyHits),
+		CountryHits:  int32Map(stats.CountryHits),
+		ReferrerHits: int32Map(stats.ReferrerHits),
+		Blocked:      stats.Blocked,
+		Tags:         stats.Tags,
+		Collection:   stats.Collection,
+	}
+	if !stats.LastAccess.IsZero() {
+		r.LastAccess = timestamppb.New(stats.LastAccess)
+	}
+	return r, nil
+}
+
+func int32Map(m map[string]int) map[string]int32 {
+	r := make(map[string]int32, len(m))
+	for k, v := range m {
+		r[k] = int32(v)
+	}
+	return r
+}
+
+func (s *linkService) DeleteLink(ctx context.Context, req *shorturlv1.DeleteLinkRequest) (*shorturlv1.DeleteLinkResponse, error) {
+	atomic.AddUint64(&s.h.metrics.Deletes, 1)
+	s.h.recordOtelCounter(ctx, "delete")
+
+	t, store := s.tenant(ctx)
+	e := s.h.deleteEvent(t.Domain, store, req.GetAbbreviation())
+	if err := store.DeleteAbv(req.GetAbbreviation()); err != nil {
+		return nil, grpcError(http.StatusInternalServerError, "Error deleting: "+err.Error())
+	}
+	s.h.afterDelete(ctx, e)
+	return &shorturlv1.DeleteLinkResponse{}, nil
+}
+
+func (s *linkService) ListLinks(ctx context.Context, req *shorturlv1.ListLinksRequest) (*shorturlv1.ListLinksResponse, error) {
+	atomic.AddUint64(&s.h.metrics.Searches, 1)
+
+	limit := int(req.GetLimit())
+	if limit == 0 {
+		limit = defaultGroupLinksLimit
+	}
+	if limit < 1 || limit > maxGroupLinksLimit {
+		return nil, grpcError(http.StatusBadRequest, "Invalid limit, expected 1 to 1000")
+	}
+	if req.GetTag() != "" && req.GetCollection() != "" {
+		return nil, grpcError(http.StatusBadRequest, "List the links with a tag or in a collection, not both")
+	}
+
+	_, store := s.tenant(ctx)
+	var links []dao.Link
+	var err error
+	switch {
+	case req.GetTag() != "" || req.GetCollection() != "":
+		group := dao.Group{Kind: dao.TagGroup, Name: req.GetTag()}
+		if req.GetCollection() != "" {
+			group = dao.Group{Kind: dao.CollectionGroup, Name: req.GetCollection()}
+		}
+		if group.Name, err = dao.NormalizeGroupName(group.Name); err != nil {
+			return nil, grpcError(http.StatusBadRequest, "Invalid "+group.Kind+": "+err.Error())
+		}
+		links, err = store.GetGroupLinks(group, limit)
+	default:
+		links, err = store.SearchLinks(req.GetPrefix(), limit)
+	}
+	if err != nil {
+		return nil, grpcError(http.StatusInternalServerError, "Error getting links: "+err.Error())
+	}
+
+	r := &shorturlv1.ListLinksResponse{}
+	for _, link := range links {
+		l := &shorturlv1.Link{Abbreviation: link.Abbreviation, Url: link.Url, Protected: link.Protected}
+		if link.Protected {
+			l.Url = ""
+		}
+		r.Links = append(r.Links, l)
+	}
+	return r, nil
+}
+
+// servingStatus is what the status means to health checks. Warnings are raised when the database is down, so
+// they mean the service can't serve.
+func servingStatus(s *status.SimpleStatus) grpc_health_v1.HealthCheckResponse_ServingStatus {
+	switch s.Code {
+	case status.OK:
+		return grpc_health_v1.HealthCheckResponse_SERVING
+	case status.Unknown:
+		return grpc_health_v1.HealthCheckResponse_UNKNOWN
+	default:
+		return grpc_health_v1.HealthCheckResponse_NOT_SERVING
+	}
+}
+
+// known returns whether service is one health is reported for, the empty name standing for the whole server
+func (g *healthService) known(service string) bool {
+	return service == "" || service == shorturlv1.ShortUrlService_ServiceDesc.ServiceName
+}
+
+func (g *healthService) Check(_ context.Context, req *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	if !g.known(req.GetService()) {
+		return nil, grpcError(http.StatusNotFound, "unknown service")
+	}
+	return &grpc_health_v1.HealthCheckResponse{Status: servingStatus(g.status)}, nil
+}
+
+func (g *healthService) List(context.Context, *grpc_health_v1.HealthListRequest) (*grpc_health_v1.HealthListResponse, error) {
+	r := &grpc_health_v1.HealthCheckResponse{Status: servingStatus(g.status)}
+	return &grpc_health_v1.HealthListResponse{Statuses: map[string]*grpc_health_v1.HealthCheckResponse{
+		"": r,
+		shorturlv1.ShortUrlService_ServiceDesc.ServiceName: r,
+	}}, nil
+}
+
+// Watch sends the status, then sends it again whenever it changes
+func (g *healthService) Watch(req *grpc_health_v1.HealthCheckRequest, stream grpc.ServerStreamingServer[grpc_health_v1.HealthCheckResponse]) error {
+	ticker := time.NewTicker(healthWatchInterval)
+	defer ticker.Stop()
+
+	last := grpc_health_v1.HealthCheckResponse_ServingStatus(-1)
+	for {
+		current := grpc_health_v1.HealthCheckResponse_SERVICE_UNKNOWN
+		if g.known(req.GetService()) {
+			current = servingStatus(g.status)
+		}
+		if current != last {
+			if err := stream.Send(&grpc_health_v1.HealthCheckResponse{Status: current}); err != nil {
+				return err
+			}
+			last = current
+		}
+		select {
+		case <-stream.Context().Done():
+			return grpcstatus.FromContextError(stream.Context().Err()).Err()
+		case <-ticker.C:
+		}
+	}
+}
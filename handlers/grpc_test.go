@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"slices"
+	"testing"
+
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/ericfialkowski/shorturl/password"
+	shorturlv1 "github.com/ericfialkowski/shorturl/proto/shorturl/v1"
+	"github.com/ericfialkowski/shorturl/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection/grpc_reflection_v1"
+	grpcstatus "google.golang.org/grpc/status"
+)
+
+// setupTestGRPC serves the handlers over gRPC on a local port, returning a connection to them
+func setupTestGRPC(t *testing.T) (*Handlers, *grpc.ClientConn) {
+	t.Helper()
+	db := dao.CreateMemoryDB()
+	s := status.NewStatus()
+	s.Ok("test")
+	h := CreateHandlers(db, s, "test-id", nil)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	srv := grpc.NewServer()
+	h.RegisterGRPC(srv)
+	go func() { _ = srv.Serve(lis) }()
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+		srv.Stop()
+		db.Cleanup()
+	})
+	return &h, conn
+}
+
+func TestHandlers_GRPC(t *testing.T) {
+	h, conn := setupTestGRPC(t)
+	client := shorturlv1.NewShortUrlServiceClient(conn)
+	ctx := context.Background()
+
+	created, err := client.CreateLink(ctx, &shorturlv1.CreateLinkRequest{Url: "https://example.com"})
+	if err != nil || !created.GetCreated() || created.GetLink().GetAbbreviation() == "" {
+		t.Fatalf("CreateLink() = %v, %v, want a new link", created, err)
+	}
+	abv := created.GetLink().GetAbbreviation()
+	again, err := client.CreateLink(ctx, &shorturlv1.CreateLinkRequest{Url: "https://example.com"})
+	if err != nil || again.GetCreated() || again.GetLink().GetAbbreviation() != abv {
+		t.Errorf("CreateLink() of the same url = %v, %v, want the existing %s", again, err, abv)
+	}
+	if _, err := client.CreateLink(ctx, &shorturlv1.CreateLinkRequest{Url: "https://docs.com", Name: "docs"}); err != nil {
+		t.Fatalf("CreateLink() with a name error = %v", err)
+	}
+
+	for _, tt := range []struct {
+		req  *shorturlv1.CreateLinkRequest
+		code codes.Code
+	}{
+		{&shorturlv1.CreateLinkRequest{Url: "not a url"}, codes.InvalidArgument},
+		{&shorturlv1.CreateLinkRequest{Url: "https://other.com", Name: "docs"}, codes.AlreadyExists},
+		{&shorturlv1.CreateLinkRequest{Url: "https://other.com", Name: "api"}, codes.InvalidArgument},
+	} {
+		if _, err := client.CreateLink(ctx, tt.req); grpcstatus.Code(err) != tt.code {
+			t.Errorf("CreateLink(%v) error = %v, want %v", tt.req, err, tt.code)
+		}
+	}
+
+	resolved, err := client.ResolveLink(ctx, &shorturlv1.ResolveLinkRequest{Abbreviation: abv})
+	if err != nil || resolved.GetLink().GetUrl() != "https://example.com" {
+		t.Errorf("ResolveLink() = %v, %v, want https://example.com", resolved, err)
+	}
+	stats, err := client.GetStats(ctx, &shorturlv1.GetStatsRequest{Abbreviation: abv})
+	if err != nil || stats.GetHits() != 0 || stats.GetLink().GetUrl() != "https://example.com" {
+		t.Errorf("GetStats() after resolving = %v, %v, want no hits", stats, err)
+	}
+	if _, err := client.ResolveLink(ctx, &shorturlv1.ResolveLinkRequest{Abbreviation: "missing"}); grpcstatus.Code(err) != codes.NotFound {
+		t.Errorf("ResolveLink() of a missing link error = %v, want %v", err, codes.NotFound)
+	}
+
+	hash, err := password.Hash("s3cret-pass")
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+	_ = h.dao.SetPassword("docs", hash)
+	locked, err := client.ResolveLink(ctx, &shorturlv1.ResolveLinkRequest{Abbreviation: "docs"})
+	if err != nil || locked.GetLink().GetUrl() != "" || !locked.GetLink().GetProtected() {
+		t.Errorf("ResolveLink() of a protected link = %v, %v, want it without its url", locked, err)
+	}
+	if _, err := client.ResolveLink(ctx, &shorturlv1.ResolveLinkRequest{Abbreviation: "docs", Password: "wrong"}); grpcstatus.Code(err) != codes.PermissionDenied {
+		t.Errorf("ResolveLink() with the wrong password error = %v, want %v", err, codes.PermissionDenied)
+	}
+	unlocked, err := client.GetStats(ctx, &shorturlv1.GetStatsRequest{Abbreviation: "docs", Password: "s3cret-pass"})
+	if err != nil || unlocked.GetLink().GetUrl() != "https://docs.com" {
+		t.Errorf("GetStats() with the password = %v, %v, want https://docs.com", unlocked, err)
+	}
+
+	_ = h.dao.AddTags(abv, []string{"launch"})
+	for _, tt := range []struct {
+		req  *shorturlv1.ListLinksRequest
+		want []string
+	}{
+		{&shorturlv1.ListLinksRequest{Prefix: "do"}, []string{"docs"}},
+		{&shorturlv1.ListLinksRequest{Tag: "Launch"}, []string{abv}},
+	} {
+		list, err := client.ListLinks(ctx, tt.req)
+		var got []string
+		for _, link := range list.GetLinks() {
+			got = append(got, link.GetAbbreviation())
+		}
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("ListLinks(%v) = %v, %v, want %v", tt.req, got, err, tt.want)
+		}
+	}
+	if _, err := client.ListLinks(ctx, &shorturlv1.ListLinksRequest{Limit: 5000}); grpcstatus.Code(err) != codes.InvalidArgument {
+		t.Errorf("ListLinks() over the limit error = %v, want %v", err, codes.InvalidArgument)
+	}
+
+	if _, err := client.DeleteLink(ctx, &shorturlv1.DeleteLinkRequest{Abbreviation: abv}); err != nil {
+		t.Fatalf("DeleteLink() error = %v", err)
+	}
+	if _, err := client.ResolveLink(ctx, &shorturlv1.ResolveLinkRequest{Abbreviation: abv}); grpcstatus.Code(err) != codes.NotFound {
+		t.Errorf("ResolveLink() after deleting error = %v, want %v", err, codes.NotFound)
+	}
+}
+
+func TestHandlers_GRPC_HealthAndReflection(t *testing.T) {
+	h, conn := setupTestGRPC(t)
+	health := grpc_health_v1.NewHealthClient(conn)
+	ctx := context.Background()
+
+	for _, service := range []string{"", "shorturl.v1.ShortUrlService"} {
+		r, err := health.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: service})
+		if err != nil || r.GetStatus() != grpc_health_v1.HealthCheckResponse_SERVING {
+			t.Errorf("Check(%q) = %v, %v, want SERVING", service, r, err)
+		}
+	}
+	if _, err := health.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: "other"}); grpcstatus.Code(err) != codes.NotFound {
+		t.Errorf("Check() of an unknown service error = %v, want %v", err, codes.NotFound)
+	}
+
+	h.status.Warn("Database is down")
+	if r, _ := health.Check(ctx, &grpc_health_v1.HealthCheckRequest{}); r.GetStatus() != grpc_health_v1.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("Check() while the database is down = %v, want NOT_SERVING", r)
+	}
+
+	stream, err := grpc_reflection_v1.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		t.Fatalf("ServerReflectionInfo() error = %v", err)
+	}
+	_ = stream.Send(&grpc_reflection_v1.ServerReflectionRequest{
+		MessageRequest: &grpc_reflection_v1.ServerReflectionRequest_ListServices{},
+	})
+	r, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("ServerReflectionInfo() Recv() error = %v", err)
+	}
+	var services []string
+	for _, service := range r.GetListServicesResponse().GetService() {
+		services = append(services, service.GetName())
+	}
+	if !slices.Contains(services, "shorturl.v1.ShortUrlService") || !slices.Contains(services, "grpc.health.v1.Health") {
+		t.Errorf("reflection lists %v, want the link and health services", services)
+	}
+}
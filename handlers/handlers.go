@@ -2,18 +2,33 @@ package handlers
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"html/template"
+	"image"
+	"log"
+	"net"
 	"net/http"
 	"net/url"
+	"strings"
 	"sync/atomic"
 	"time"
 
+	"github.com/ericfialkowski/shorturl/bots"
 	"github.com/ericfialkowski/shorturl/dao"
 	"github.com/ericfialkowski/shorturl/env"
+	"github.com/ericfialkowski/shorturl/geo"
+	"github.com/ericfialkowski/shorturl/golink"
+	"github.com/ericfialkowski/shorturl/linkcheck"
+	"github.com/ericfialkowski/shorturl/policy"
+	"github.com/ericfialkowski/shorturl/rules"
 	"github.com/ericfialkowski/shorturl/status"
 	"github.com/ericfialkowski/shorturl/telemetry"
+	"github.com/ericfialkowski/shorturl/tenant"
+	"github.com/ericfialkowski/shorturl/threats"
+	"github.com/ericfialkowski/shorturl/unfurl"
 	"github.com/labstack/echo/v5"
 	"github.com/labstack/echo/v5/middleware"
 	"go.opentelemetry.io/otel/attribute"
@@ -26,6 +41,9 @@ const (
 	statsUiPath string = "/:abv/stats/ui"
 	metricsPath string = "/diag/metrics"
 	statusPath  string = "/diag/status"
+
+	maxSeriesPoints   = 5000
+	maxReferrerLength = 255
 )
 
 type (
@@ -33,19 +51,82 @@ type (
 		dao         dao.ShortUrlDao
 		metrics     metrics
 		otelMetrics *telemetry.Metrics
-		startTime   time.Time
-		status      *status.SimpleStatus
-		id          string
+		locator     *geo.Locator
+		classifier  *bots.Classifier
+		qrLogo      image.Image
+		policy      *policy.Policy
+		threats     *threats.Lists
+		checker     *linkcheck.Checker
+		fallback    string // where visitors of links with dead destinations are sent, if anywhere
+		// status links redirect with unless they choose their own, and how long permanent redirects are cached
+		redirectStatus int
+		redirectMaxAge time.Duration
+		unfurler       *unfurl.Fetcher
+		unlock         *unlocker
+		tenants        *tenant.Tenants
+		hooks          hooks  // run around creates, deletes and redirects
+		prefix         string // path the routes are served under, which the links and pages returned point below
+		startTime      time.Time
+		status         *status.SimpleStatus
+		id             string
 	}
 
 	metrics struct {
-		Redirects uint64 `json:"redirect_counts"`
-		UrlStats  uint64 `json:"redirect_stats_counts"`
-		NewUrls   uint64 `json:"new_url_counts"`
-		Deletes   uint64 `json:"delete_counts"`
-		Metrics   uint64 `json:"metric_request_counts"`
-		Status    uint64 `json:"stats_requests_counts"`
-		Uptime    string `json:"uptime"`
+		Redirects    uint64 `json:"redirect_counts"`
+		BotRedirects uint64 `json:"bot_redirect_counts"`
+		UrlStats     uint64 `json:"redirect_stats_counts"`
+		NewUrls      uint64 `json:"new_url_counts"`
+		Rejected     uint64 `json:"rejected_url_counts"`
+		Blocked      uint64 `json:"blocked_redirect_counts"`
+		Unavailable  uint64 `json:"unavailable_redirect_counts"`
+		Deletes      uint64 `json:"delete_counts"`
+		Metrics      uint64 `json:"metric_request_counts"`
+		Status       uint64 `json:"stats_requests_counts"`
+		Analytics    uint64 `json:"analytics_request_counts"`
+		QrCodes      uint64 `json:"qr_code_counts"`
+		LinkHealth   uint64 `json:"link_health_request_counts"`
+		Options      uint64 `json:"options_request_counts"`
+		Searches     uint64 `json:"search_counts"`
+		Groups       uint64 `json:"group_request_counts"`
+		Uptime       string `json:"uptime"`
+	}
+
+	statsReturn struct {
+		dao.ShortUrl
+		Redirect redirectReturn `json:"redirect"`
+		Series   seriesReturn   `json:"series"`
+	}
+
+	seriesReturn struct {
+		From        time.Time         `json:"from"`
+		To          time.Time         `json:"to"`
+		Granularity dao.Granularity   `json:"granularity"`
+		TimeZone    string            `json:"tz"`
+		Uniques     int64             `json:"uniques"`
+		Points      []dao.SeriesPoint `json:"points"`
+	}
+
+	// addRequest creates a link with a chosen name rather than a generated one
+	addRequest struct {
+		Url     string     `json:"url"`
+		Name    string     `json:"name"`
+		Expires *time.Time `json:"expires"` // when the new link stops redirecting
+	}
+
+	// linkPlan is the link a create request leads to
+	linkPlan struct {
+		abv     string
+		url     string
+		named   bool       // whether abv was asked for rather than generated
+		exists  bool       // whether the link is already saved
+		expires *time.Time // when the new link stops redirecting, nil for never
+	}
+
+	// createError is why a create request failed, and the status to answer it with
+	createError struct {
+		status    int
+		message   string
+		rejection *policy.Rejection // set when the destination policy turned the url down
 	}
 
 	urlReturn struct {
@@ -53,47 +134,242 @@ type (
 		UrlLink     string `json:"url_link"`
 		StatsLink   string `json:"stats_link"`
 		StatsUiLink string `json:"stats_ui_link"`
+		QrLink      string `json:"qr_link"`
 	}
 )
 
-func createReturn(abv string) urlReturn {
+func (h *Handlers) createReturn(abv string) urlReturn {
 	return urlReturn{
 		Abv:         abv,
-		UrlLink:     fmt.Sprintf("/%s", abv),
-		StatsLink:   fmt.Sprintf("/%s/stats", abv),
-		StatsUiLink: fmt.Sprintf("/%s/stats/ui", abv),
+		UrlLink:     fmt.Sprintf("%s/%s", h.prefix, abv),
+		StatsLink:   fmt.Sprintf("%s/%s/stats", h.prefix, url.PathEscape(abv)),
+		StatsUiLink: fmt.Sprintf("%s/%s/stats/ui", h.prefix, url.PathEscape(abv)),
+		QrLink:      fmt.Sprintf("%s/%s/qr", h.prefix, url.PathEscape(abv)),
 	}
 }
 
+// send answers the request with the error, as the policy's rejection when there is one
+func (e *createError) send(c *echo.Context) error {
+	if e.rejection != nil {
+		return c.JSON(e.status, e.rejection)
+	}
+	return c.String(e.status, e.message)
+}
+
 func CreateHandlers(d dao.ShortUrlDao, s *status.SimpleStatus, id string, otel *telemetry.Metrics) Handlers {
-	return Handlers{dao: d, metrics: metrics{}, otelMetrics: otel, startTime: time.Now(), status: s, id: id}
+	return Handlers{dao: d, metrics: metrics{}, otelMetrics: otel, unlock: newUnlocker(), startTime: time.Now(), status: s, id: id}
+}
+
+// SetLocator sets the geolocation database used to record where hits come from.
+func (h *Handlers) SetLocator(l *geo.Locator) {
+	h.locator = l
+}
+
+// SetClassifier sets how bots are told apart from people. Without one the built-in patterns are used.
+func (h *Handlers) SetClassifier(c *bots.Classifier) {
+	h.classifier = c
+}
+
+// SetPolicy sets the policy new destinations are checked against
+func (h *Handlers) SetPolicy(p *policy.Policy) {
+	h.policy = p
+}
+
+// SetPrefix has the links and pages the handlers return point below prefix, like /links, for when they're served
+// there by a proxy or another app that strips it from the requests
+func (h *Handlers) SetPrefix(prefix string) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix != "" && !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	h.prefix = prefix
+}
+
+// SetUnfurler sets what fetches the titles and previews of new links' destinations
+func (h *Handlers) SetUnfurler(f *unfurl.Fetcher) {
+	h.unfurler = f
 }
 
 func (h *Handlers) getHandler(c *echo.Context) error {
 	atomic.AddUint64(&h.metrics.Redirects, 1)
 	h.recordOtelCounter(c.Request().Context(), "redirect")
 
-	abv := c.Param("abv")
-	u, err := h.dao.GetUrl(abv)
+	path, err := h.resolvePath(c)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	if path.abv == "" {
+		return h.notFoundHandler(c)
+	}
+	abv := path.abv
+	t := h.tenantOf(c)
+	store := h.dao.ForDomain(t.Domain)
+	options, err := store.GetOptions(abv)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting redirect: %v", err))
+	}
+	if options.Expired(time.Now()) {
+		return c.String(http.StatusGone, fmt.Sprintf("%s expired at %s", abv, options.Expires.UTC().Format(time.RFC3339)))
+	}
+	locked, hash, err := h.locked(c, abv)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting redirect: %v", err))
+	}
+	redirect := h.redirectFor(t, options, hash != "")
+	// other methods can only be redirected by statuses that keep them
+	if m := c.Request().Method; m != http.MethodGet && m != http.MethodHead && !preservesMethod(redirect.Status) {
+		return c.String(http.StatusMethodNotAllowed, fmt.Sprintf("%s redirects with %d, which turns %s into GET", abv, redirect.Status, m))
+	}
+	// a path left after the name only finds links that pass it through
+	if path.rest != "" && (options.Passthrough == nil || !options.Passthrough.Path) {
+		return h.notFoundHandler(c)
+	}
+	if locked {
+		return h.unlockFormHandler(c, abv, c.Request().RequestURI, "")
+	}
+
+	hit := h.newHit(c)
+	// rules come first, then experiments split whoever's left
+	dest, ruled := rules.Match(options.Rules, rules.NewVisitor(c.Request(), hit.Country))
+	if !ruled && options.Experiment != nil {
+		variant := h.chooseVariant(c, abv, options.Experiment)
+		hit.Variant = variant.Name
+		dest = variant.Url
+	}
+	u, err := store.LookupUrl(abv)
 
+	var blocked *dao.BlockedError
+	if errors.As(err, &blocked) {
+		return h.blockedHandler(c, blockedPage{Abv: abv, Url: u, Reason: blocked.Reason})
+	}
 	if err != nil {
 		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting redirect: %v", err))
 	}
 
 	if u == "" {
-		return c.String(http.StatusNotFound, "No link found")
+		return h.notFoundHandler(c)
 	}
 
-	http.Redirect(c.Response(), c.Request(), u, http.StatusFound)
+	if reason := h.blockIfThreat(store, abv, u); reason != "" {
+		return h.blockedHandler(c, blockedPage{Abv: abv, Url: u, Reason: reason})
+	}
+	if h.checker.Dead(t.Domain, abv, u) {
+		return h.unavailableHandler(c, unavailablePage{Abv: abv, Url: u})
+	}
+	if dest != "" {
+		if reason := h.blockIfThreat(store, abv, dest); reason != "" {
+			return h.blockedHandler(c, blockedPage{Abv: abv, Url: dest, Reason: reason})
+		}
+		u = dest
+	}
+
+	target, err := golink.Expand(u, path.args)
+	if err == nil {
+		target, err = passthrough(target, options.Passthrough, path.rest, c.Request().URL.Query())
+	}
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	if target != u {
+		if reason := h.threatReason(target); reason != "" {
+			return h.blockedHandler(c, blockedPage{Abv: abv, Url: target, Reason: reason})
+		}
+	}
+
+	e := RedirectEvent{Domain: t.Domain, Abbreviation: abv, Url: u, Target: target, Status: redirect.Status, Hit: hit, Request: c.Request()}
+	if veto := h.filterRedirect(c.Request().Context(), &e); veto != nil {
+		return c.String(veto.status(), veto.Message)
+	}
+	// a target the filters changed is checked like the destination of a new link
+	if e.Target != target {
+		if reason := h.targetRejection(e.Target, c.Request().Host); reason != "" {
+			return h.blockedHandler(c, blockedPage{Abv: abv, Url: e.Target, Reason: reason})
+		}
+	}
+
+	// the hit is only counted once nothing's stopped the redirect
+	if _, err := store.GetUrlWithHit(abv, hit); err != nil {
+		if errors.As(err, &blocked) {
+			return h.blockedHandler(c, blockedPage{Abv: abv, Url: u, Reason: blocked.Reason})
+		}
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting redirect: %v", err))
+	}
+	if hit.Bot != "" {
+		atomic.AddUint64(&h.metrics.BotRedirects, 1)
+	}
+	c.Response().Header().Set("Cache-Control", redirect.CacheControl)
+	http.Redirect(c.Response(), c.Request(), e.Target, redirect.Status)
+	h.afterRedirect(c.Request().Context(), e)
 	return nil
 }
 
+// targetRejection returns why visitors can't be sent to target, or an empty string if they can
+func (h *Handlers) targetRejection(target, host string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return fmt.Sprintf("the target isn't a valid url: %v", err)
+	}
+	if rejection := h.checkDestination(u, host); rejection != nil {
+		return rejection.Reason
+	}
+	return ""
+}
+
+// checkDestination returns why u can't be a destination of a link created at host, or nil if it can
+func (h *Handlers) checkDestination(u *url.URL, host string) *policy.Rejection {
+	if rejection := h.policy.Check(u, host); rejection != nil {
+		return rejection
+	}
+	if list, ok := h.threats.Check(u.String()); ok {
+		return &policy.Rejection{
+			Code:   policy.CodeThreat,
+			Reason: fmt.Sprintf("%s is on the %s threat list", u.Hostname(), list),
+			Rule:   list,
+		}
+	}
+	return nil
+}
+
+// newHit builds the details of a hit from the request
+func (h *Handlers) newHit(c *echo.Context) dao.Hit {
+	hit := dao.NewHit()
+	loc := h.locator.Locate(c.RealIP())
+	hit.Country = loc.Country
+	hit.Region = loc.Region
+	hit.Visitor = visitorId(c.RealIP(), c.Request().UserAgent())
+	hit.Bot = h.classifier.Classify(c.Request())
+	hit.Referrer = referrerHost(c.Request().Referer())
+	return hit
+}
+
+// referrerHost returns the lower case host of a web page referrer, or empty when there isn't a usable one
+func referrerHost(referrer string) string {
+	u, err := url.Parse(referrer)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	host := strings.ToLower(u.Hostname())
+	if len(host) > maxReferrerLength {
+		return ""
+	}
+	return host
+}
+
+// visitorId identifies a visitor for unique counts by hashing their address and user agent,
+// so the raw values are never stored
+func visitorId(ip, userAgent string) string {
+	sum := sha256.Sum256([]byte(ip + "\x00" + userAgent))
+	return hex.EncodeToString(sum[:16])
+}
+
 func (h *Handlers) statsHandler(c *echo.Context) error {
 	atomic.AddUint64(&h.metrics.UrlStats, 1)
 	h.recordOtelCounter(c.Request().Context(), "stats")
 
-	abv := c.Param("abv")
-	stats, err := h.dao.GetStats(abv)
+	abv := abvParam(c)
+	t := h.tenantOf(c)
+	store := h.dao.ForDomain(t.Domain)
+	stats, err := store.GetStats(abv)
 
 	if err != nil {
 		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting stats: %v", err))
@@ -102,88 +378,291 @@ func (h *Handlers) statsHandler(c *echo.Context) error {
 	if stats.Abbreviation == "" {
 		return c.String(http.StatusNotFound, "No link found")
 	}
+	redirect := h.redirectFor(t, linkOptions(stats), stats.Protected)
+	if err := h.hideIfLocked(c, &stats); err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting stats: %v", err))
+	}
+
+	series, err := parseSeriesQuery(c)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	if _, err := fillSeries(store, abv, &series); err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting stats: %v", err))
+	}
 
-	return c.JSON(http.StatusOK, stats)
+	return c.JSON(http.StatusOK, statsReturn{ShortUrl: stats, Redirect: redirect, Series: series})
 }
 
-func (h *Handlers) addHandler(c *echo.Context) error {
-	atomic.AddUint64(&h.metrics.NewUrls, 1)
-	h.recordOtelCounter(c.Request().Context(), "create")
+// parseSeriesQuery reads the from, to, granularity and tz query parameters. Times may be RFC 3339 or
+// a date/date-time in tz; a date-only "to" includes that whole day. Without from, a default window
+// for the granularity is used.
+func parseSeriesQuery(c *echo.Context) (seriesReturn, error) {
+	var series seriesReturn
 
-	var u string
+	loc, err := time.LoadLocation(c.QueryParam("tz"))
+	if err != nil {
+		return series, fmt.Errorf("unknown time zone %q", c.QueryParam("tz"))
+	}
+	series.TimeZone = loc.String()
 
-	if err := json.NewDecoder(c.Request().Body).Decode(&u); err != nil {
-		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error parsing url: %v", err))
+	if series.Granularity, err = dao.ParseGranularity(c.QueryParam("granularity")); err != nil {
+		return series, err
 	}
 
-	if u == "" {
-		return c.String(http.StatusBadRequest, "Empty url passed in")
+	series.To = time.Now().In(loc)
+	if to := c.QueryParam("to"); to != "" {
+		t, dateOnly, err := parseQueryTime(to, loc)
+		if err != nil {
+			return series, fmt.Errorf("invalid to: %v", err)
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		series.To = t
+	}
+
+	switch series.Granularity {
+	case dao.Hour:
+		series.From = series.To.Add(-48 * time.Hour)
+	case dao.Week:
+		series.From = series.To.AddDate(0, 0, -7*12)
+	case dao.Month:
+		series.From = series.To.AddDate(-1, 0, 0)
+	default:
+		series.From = series.To.AddDate(0, 0, -30)
+	}
+	if from := c.QueryParam("from"); from != "" {
+		if series.From, _, err = parseQueryTime(from, loc); err != nil {
+			return series, fmt.Errorf("invalid from: %v", err)
+		}
 	}
 
-	if parsedUrl, err := url.ParseRequestURI(u); err != nil ||
-		parsedUrl.Scheme == "" ||
-		parsedUrl.Host == "" {
-		return c.String(http.StatusBadRequest, "Invalid url passed in")
+	if !series.From.Before(series.To) {
+		return series, fmt.Errorf("from must be before to")
 	}
+	if series.To.Sub(series.From) > maxSeriesPoints*series.Granularity.Duration() {
+		return series, fmt.Errorf("range too large, at most %d %ss can be returned", maxSeriesPoints, series.Granularity)
+	}
+
+	return series, nil
+}
 
-	abv, _ := h.dao.GetAbv(u)
-	if abv != "" {
-		r := createReturn(abv)
-		return c.JSON(http.StatusOK, r)
+func parseQueryTime(s string, loc *time.Location) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.In(loc), false, nil
 	}
+	if t, err := time.ParseInLocation("2006-01-02T15:04", s, loc); err == nil {
+		return t, false, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, loc)
+	return t, true, err
+}
+
+// fillSeries reads the hourly hits of abv in d covering series and rolls them up into its points, returning
+// the hourly hits for other uses
+func fillSeries(d dao.ShortUrlDao, abv string, series *seriesReturn) (map[time.Time]int, error) {
+	loc, _ := time.LoadLocation(series.TimeZone)
+	start := series.Granularity.Truncate(series.From.In(loc))
 
-	abv, err := dao.CreateAbbreviation(u, h.dao)
+	hourly, err := d.GetHourlyHits(abv, start.UTC().Truncate(time.Hour), series.To)
 	if err != nil {
-		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error creating abbreviation: %v", err))
+		return nil, err
 	}
 
-	if err := h.dao.Save(abv, u); err != nil {
-		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error saving url: %v", err))
+	series.Points = dao.BuildSeries(hourly, series.From, series.To, series.Granularity, loc)
+
+	// uniques are kept per UTC day, so each bucket counts the visitors of the UTC days it overlaps;
+	// hourly buckets only get the total
+	var buckets [][]string
+	if series.Granularity != dao.Hour {
+		for _, p := range series.Points {
+			buckets = append(buckets, dao.UTCDates(p.Start, series.Granularity.Next(p.Start)))
+		}
 	}
+	buckets = append(buckets, dao.UTCDates(start, series.To))
 
-	r := createReturn(abv)
-	return c.JSON(http.StatusOK, r)
+	uniques, err := d.CountUniques(abv, buckets)
+	if err != nil {
+		return nil, err
+	}
+	series.Uniques = uniques[len(uniques)-1]
+	if series.Granularity != dao.Hour {
+		for i := range series.Points {
+			series.Points[i].Uniques = &uniques[i]
+		}
+	}
+	return hourly, nil
 }
 
-func (h *Handlers) deleteHandler(c *echo.Context) error {
-	atomic.AddUint64(&h.metrics.Deletes, 1)
-	h.recordOtelCounter(c.Request().Context(), "delete")
-
-	abv := c.Param("abv")
-	err := h.dao.DeleteAbv(abv)
+func (h *Handlers) addHandler(c *echo.Context) error {
+	atomic.AddUint64(&h.metrics.NewUrls, 1)
+	h.recordOtelCounter(c.Request().Context(), "create")
 
+	var body json.RawMessage
+	if err := json.NewDecoder(c.Request().Body).Decode(&body); err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error parsing url: %v", err))
+	}
+	req, err := parseAddRequest(body)
 	if err != nil {
-		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error deleting: %v", err))
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error parsing url: %v", err))
 	}
 
-	return c.JSON(http.StatusOK, "deleted")
+	t := h.tenantOf(c)
+	store := h.dao.ForDomain(t.Domain)
+	ctx := c.Request().Context()
+	plan, cerr := h.planLink(ctx, c.Request().Host, t, store, req)
+	if cerr != nil {
+		return cerr.send(c)
+	}
+	if !plan.exists {
+		if err := saveLink(store, plan); err != nil {
+			return c.String(http.StatusInternalServerError, fmt.Sprintf("Error saving url: %v", err))
+		}
+		h.unfurler.Describe(t.Domain, plan.abv, plan.url)
+		h.afterCreate(ctx, LinkEvent{Domain: t.Domain, Host: c.Request().Host, Abbreviation: plan.abv, Url: plan.url})
+	}
+	return c.JSON(http.StatusOK, h.createReturn(plan.abv))
 }
 
-func (h *Handlers) statsUiHandler(c *echo.Context) error {
-	abv := c.Param("abv")
-	stats, err := h.dao.GetStats(abv)
+// saveLink saves the new link of plan, along with when it expires
+func saveLink(store dao.ShortUrlDao, plan linkPlan) error {
+	if err := store.Save(plan.abv, plan.url); err != nil {
+		return err
+	}
+	if plan.expires != nil {
+		return store.SetOptions(plan.abv, dao.Options{Expires: plan.expires})
+	}
+	return nil
+}
+
+// parseAddRequest reads the body of a create request, which is the url, or an object with the url, a name for
+// the link and when it expires
+func parseAddRequest(body json.RawMessage) (addRequest, error) {
+	var req addRequest
+	if err := json.Unmarshal(body, &req.Url); err != nil {
+		if err := json.Unmarshal(body, &req); err != nil {
+			return req, err
+		}
+	}
+	return req, nil
+}
+
+// planLink works out the link req creates without saving it: the existing link to its url, the name it asks
+// for, or a generated one. Requests for links made on host are checked against the destination policy, then
+// the create validators. An expiry is only set on new links, so asking for one on an existing link fails.
+func (h *Handlers) planLink(ctx context.Context, host string, t *tenant.Tenant, store dao.ShortUrlDao, req addRequest) (linkPlan, *createError) {
+	u := req.Url
+	if u == "" {
+		return linkPlan{}, &createError{status: http.StatusBadRequest, message: "Empty url passed in"}
+	}
+	if req.Expires != nil && !req.Expires.After(time.Now()) {
+		return linkPlan{}, &createError{status: http.StatusBadRequest, message: "Expiry has already passed"}
+	}
+
+	parsedUrl, err := url.ParseRequestURI(u)
+	if err != nil || parsedUrl.Scheme == "" {
+		return linkPlan{}, &createError{status: http.StatusBadRequest, message: "Invalid url passed in"}
+	}
+	if rejection := h.checkDestination(parsedUrl, host); rejection != nil {
+		atomic.AddUint64(&h.metrics.Rejected, 1)
+		return linkPlan{}, &createError{status: http.StatusBadRequest, message: rejection.Error(), rejection: rejection}
+	}
+	if cerr := h.validateCreate(ctx, LinkEvent{Domain: t.Domain, Host: host, Abbreviation: req.Name, Url: u}); cerr != nil {
+		if cerr.rejection != nil {
+			atomic.AddUint64(&h.metrics.Rejected, 1)
+		}
+		return linkPlan{}, cerr
+	}
 
+	plan, cerr := planName(t, store, req.Name, u)
+	if cerr != nil {
+		return plan, cerr
+	}
+	if req.Expires != nil {
+		if plan.exists {
+			return linkPlan{}, &createError{status: http.StatusConflict, message: fmt.Sprintf("%s already links to %s without expiring", plan.abv, u)}
+		}
+		plan.expires = req.Expires
+	}
+	return plan, nil
+}
+
+// planName works out the name of the link to u: the one asked for, the existing link's or a generated one
+func planName(t *tenant.Tenant, store dao.ShortUrlDao, name, u string) (linkPlan, *createError) {
+	if name != "" {
+		return planNamed(store, name, u)
+	}
+
+	if abv, _ := store.GetAbv(u); abv != "" {
+		return linkPlan{abv: abv, url: u, exists: true}, nil
+	}
+	abv, err := t.Abbreviate(u, store)
 	if err != nil {
-		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting stats: %v", err))
+		return linkPlan{}, &createError{status: http.StatusInternalServerError, message: fmt.Sprintf("Error creating abbreviation: %v", err)}
 	}
+	return linkPlan{abv: abv, url: u}, nil
+}
 
-	if stats.Abbreviation == "" {
-		return c.String(http.StatusNotFound, "No link found")
+func (h *Handlers) deleteHandler(c *echo.Context) error {
+	atomic.AddUint64(&h.metrics.Deletes, 1)
+	h.recordOtelCounter(c.Request().Context(), "delete")
+
+	abv := abvParam(c)
+	t := h.tenantOf(c)
+	store := h.dao.ForDomain(t.Domain)
+	e := h.deleteEvent(t.Domain, store, abv)
+	err := store.DeleteAbv(abv)
+
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error deleting: %v", err))
 	}
+	h.afterDelete(c.Request().Context(), e)
 
-	tmpl := template.Must(template.ParseFiles("stats.html"))
-	return tmpl.Execute(c.Response(), stats)
+	return c.JSON(http.StatusOK, "deleted")
 }
 
 func (h *Handlers) SetUp(e *echo.Echo) {
-	e.File("/", "index.html")
-	e.File("/favicon.ico", "favicon.ico")
+	e.IPExtractor = ipExtractor(env.StringOrDefault("trusted_proxies", ""))
+
+	e.GET("/", h.indexHandler)
+	e.FileFS("/favicon.ico", "favicon.ico", staticFiles)
 	e.GET(statusPath, h.status.BackgroundHandler)
 	e.GET(metricsPath, h.metricsHandler)
 	e.GET(statsPath, h.statsHandler)
 	e.GET(statsUiPath, h.statsUiHandler)
+	e.GET(qrPath, h.qrHandler)
+	e.GET(analyticsPath, h.analyticsHandler)
+	e.GET(analyticsUiPath, h.analyticsUiHandler)
+	e.GET(unhealthyPath, h.unhealthyHandler)
+	e.GET(searchPath, h.searchHandler)
+	e.GET(linksPath, h.linksHandler)
+	e.GET(openSearchPath, h.openSearchHandler)
+	e.GET(openApiPath, h.openApiHandler)
+	e.GET(optionsPath, h.optionsHandler)
+	e.PUT(optionsPath, h.setOptionsHandler)
+	e.PUT(experimentPath, h.setExperimentHandler)
+	e.PUT(passwordPath, h.setPasswordHandler)
+	e.POST(unlockPath, h.unlockHandler)
+	e.POST(tagsPath, h.addTagsHandler)
+	e.DELETE(tagPath, h.removeTagHandler)
+	e.PUT(collectionPath, h.setCollectionHandler)
+	e.GET(tagLinksPath, h.groupLinksHandler)
+	e.GET(tagStatsPath, h.groupStatsHandler)
+	e.GET(collectionLinksPath, h.groupLinksHandler)
+	e.GET(collectionStatsPath, h.groupStatsHandler)
+	e.POST(batchPath, h.batchHandler)
 	e.DELETE(appPath, h.deleteHandler)
 	e.GET(appPath, h.getHandler)
+	e.HEAD(appPath, h.getHandler)
+	e.GET(passthroughPath, h.getHandler)
+	e.HEAD(passthroughPath, h.getHandler)
+	// links that redirect with 307 or 308 work for API requests too
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodPatch} {
+		e.Add(method, appPath, h.getHandler)
+		e.Add(method, passthroughPath, h.getHandler)
+	}
 	e.POST("/", h.addHandler)
 
 	e.Use(h.statusHitsCounter())
@@ -232,6 +711,33 @@ func (h *Handlers) idHeader() echo.MiddlewareFunc {
 	}
 }
 
+// ipExtractor returns an echo.IPExtractor that honors X-Forwarded-For from trusted proxies.
+// Loopback, link-local and private addresses (e.g. the bundled nginx) are always trusted;
+// trustedProxies is a comma separated list of additional CIDRs to trust.
+func ipExtractor(trustedProxies string) echo.IPExtractor {
+	var options []echo.TrustOption
+	for cidr := range strings.SplitSeq(trustedProxies, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		if !strings.Contains(cidr, "/") {
+			if strings.Contains(cidr, ":") {
+				cidr += "/128"
+			} else {
+				cidr += "/32"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			log.Printf("Ignoring invalid trusted proxy %q: %v", cidr, err)
+			continue
+		}
+		options = append(options, echo.TrustIPRange(ipNet))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
 // recordOtelCounter records a counter increment for the given operation type.
 func (h *Handlers) recordOtelCounter(ctx context.Context, operation string) {
 	if h.otelMetrics == nil {
@@ -241,6 +747,10 @@ func (h *Handlers) recordOtelCounter(ctx context.Context, operation string) {
 	switch operation {
 	case "redirect":
 		h.otelMetrics.Redirects.Add(ctx, 1)
+	case "blocked":
+		h.otelMetrics.Blocked.Add(ctx, 1)
+	case "unavailable":
+		h.otelMetrics.Unavailable.Add(ctx, 1)
 	case "stats":
 		h.otelMetrics.StatsRequests.Add(ctx, 1)
 	case "create":
@@ -6,9 +6,12 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/ericfialkowski/shorturl/policy"
 	"github.com/ericfialkowski/shorturl/status"
+	"github.com/ericfialkowski/shorturl/unfurl"
 	"github.com/labstack/echo/v5"
 )
 
@@ -38,6 +41,7 @@ func TestHandlers_AddHandler_ValidURL(t *testing.T) {
 
 	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`"https://example.com"`))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Host = "sho.rt" // httptest's default host is example.com, which would be a link to itself
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 
@@ -345,7 +349,7 @@ func TestHandlers_IdHeader(t *testing.T) {
 }
 
 func TestCreateReturn(t *testing.T) {
-	result := createReturn("abc")
+	result := (&Handlers{}).createReturn("abc")
 
 	if result.Abv != "abc" {
 		t.Errorf("createReturn().Abv = %v, want %v", result.Abv, "abc")
@@ -359,4 +363,346 @@ func TestCreateReturn(t *testing.T) {
 	if result.StatsUiLink != "/abc/stats/ui" {
 		t.Errorf("createReturn().StatsUiLink = %v, want %v", result.StatsUiLink, "/abc/stats/ui")
 	}
+	if result.QrLink != "/abc/qr" {
+		t.Errorf("createReturn().QrLink = %v, want %v", result.QrLink, "/abc/qr")
+	}
+}
+
+func TestHandlers_SetPrefix(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+	h.SetPrefix("links/")
+	_ = h.dao.Save("team/wiki", "https://wiki.com")
+	srv := http.StripPrefix("/links", e)
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/links/", strings.NewReader(`"https://other.com"`)))
+	var link urlReturn
+	if err := json.Unmarshal(rec.Body.Bytes(), &link); err != nil || !strings.HasPrefix(link.UrlLink, "/links/") || link.QrLink != link.UrlLink+"/qr" {
+		t.Errorf("POST /links/ = %d %s, want links below /links", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/links/api/search?q=team+wiki", nil))
+	if rec.Header().Get("Location") != "/links/team/wiki" {
+		t.Errorf("search redirected to %q, want /links/team/wiki", rec.Header().Get("Location"))
+	}
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/links/team", nil))
+	if body := rec.Body.String(); !strings.Contains(body, `href="/links/team/wiki"`) || !strings.Contains(body, `action="/links/api/search"`) {
+		t.Errorf("search page doesn't link below /links: %s", body)
+	}
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/links/team/wiki", nil))
+	if rec.Header().Get("Location") != "https://wiki.com" {
+		t.Errorf("GET /links/team/wiki redirected to %q, want https://wiki.com", rec.Header().Get("Location"))
+	}
+}
+
+func TestIpExtractor(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies string
+		remoteAddr     string
+		xff            string
+		want           string
+	}{
+		{"no proxy", "", "81.2.69.142:1234", "", "81.2.69.142"},
+		{"private proxy is trusted", "", "172.18.0.3:1234", "81.2.69.142", "81.2.69.142"},
+		{"public proxy is not trusted", "", "216.160.83.56:1234", "81.2.69.142", "216.160.83.56"},
+		{"configured proxy is trusted", "216.160.83.0/24", "216.160.83.56:1234", "81.2.69.142", "81.2.69.142"},
+		{"configured proxy without mask", "216.160.83.56", "216.160.83.56:1234", "81.2.69.142", "81.2.69.142"},
+		{"spoofed header behind proxy", "", "172.18.0.3:1234", "1.1.1.1, 81.2.69.142", "81.2.69.142"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				req.Header.Set(echo.HeaderXForwardedFor, tt.xff)
+			}
+
+			if got := ipExtractor(tt.trustedProxies)(req); got != tt.want {
+				t.Errorf("ipExtractor(%q) = %v, want %v", tt.trustedProxies, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlers_StatsHandler_Series(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+
+	_ = h.dao.Save("ser1", "https://series.com")
+	_, _ = h.dao.GetUrlWithHit("ser1", dao.Hit{Time: time.Date(2024, 3, 1, 20, 30, 0, 0, time.UTC)})
+	_, _ = h.dao.GetUrlWithHit("ser1", dao.Hit{Time: time.Date(2024, 3, 3, 1, 0, 0, 0, time.UTC)})
+
+	req := httptest.NewRequest(http.MethodGet, "/ser1/stats?from=2024-03-01&to=2024-03-03&tz=Asia/Tokyo", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/:abv/stats")
+	c.SetPathValues(echo.PathValues{{Name: "abv", Value: "ser1"}})
+
+	if err := h.statsHandler(c); err != nil {
+		t.Fatalf("statsHandler() error = %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("statsHandler() status = %v, want %v: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var result statsReturn
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	if result.Abbreviation != "ser1" || result.Hits != 2 {
+		t.Errorf("statsHandler() = %s with %d hits, want ser1 with 2", result.Abbreviation, result.Hits)
+	}
+	if result.Series.Granularity != dao.Day || result.Series.TimeZone != "Asia/Tokyo" {
+		t.Errorf("statsHandler() series = %s in %s, want day in Asia/Tokyo", result.Series.Granularity, result.Series.TimeZone)
+	}
+
+	// the to date is inclusive, and in Tokyo the hits land on March 2nd and 3rd, not the UTC dates of March 1st and 3rd
+	want := []int{0, 1, 1}
+	if len(result.Series.Points) != len(want) {
+		t.Fatalf("statsHandler() returned %d points, want %d", len(result.Series.Points), len(want))
+	}
+	for i, p := range result.Series.Points {
+		if p.Hits != want[i] {
+			t.Errorf("statsHandler() point %d (%v) hits = %d, want %d", i, p.Start, p.Hits, want[i])
+		}
+	}
+}
+
+func TestHandlers_GetHandler_CountsUniqueVisitors(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+
+	_ = h.dao.Save("uv1", "https://uniques.com")
+
+	visits := []struct{ ip, userAgent string }{
+		{"192.0.2.1", "firefox"},
+		{"192.0.2.1", "firefox"},
+		{"192.0.2.1", "curl"},
+		{"192.0.2.2", "firefox"},
+	}
+	for _, v := range visits {
+		req := httptest.NewRequest(http.MethodGet, "/uv1", nil)
+		req.RemoteAddr = v.ip + ":1234"
+		req.Header.Set("User-Agent", v.userAgent)
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.SetPath("/:abv")
+		c.SetPathValues(echo.PathValues{{Name: "abv", Value: "uv1"}})
+		if err := h.getHandler(c); err != nil {
+			t.Fatalf("getHandler() error = %v", err)
+		}
+	}
+
+	stats, _ := h.dao.GetStats("uv1")
+	if stats.Hits != 4 || stats.Uniques != 3 {
+		t.Errorf("GetStats() = %d hits and %d uniques, want 4 and 3", stats.Hits, stats.Uniques)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/uv1/stats", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/:abv/stats")
+	c.SetPathValues(echo.PathValues{{Name: "abv", Value: "uv1"}})
+	if err := h.statsHandler(c); err != nil {
+		t.Fatalf("statsHandler() error = %v", err)
+	}
+
+	var result statsReturn
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if result.Series.Uniques != 3 {
+		t.Errorf("statsHandler() series uniques = %d, want 3", result.Series.Uniques)
+	}
+	last := result.Series.Points[len(result.Series.Points)-1]
+	if last.Uniques == nil || *last.Uniques != 3 {
+		t.Errorf("statsHandler() last point uniques = %v, want 3", last.Uniques)
+	}
+}
+
+func TestHandlers_GetHandler_Bots(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+
+	_ = h.dao.Save("bot1", "https://bots.com")
+
+	requests := []struct {
+		method    string
+		userAgent string
+	}{
+		{http.MethodGet, "Mozilla/5.0 (X11; Linux x86_64) Firefox/120.0"},
+		{http.MethodGet, "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)"},
+		{http.MethodGet, "facebookexternalhit/1.1"},
+		{http.MethodHead, "Mozilla/5.0 (X11; Linux x86_64) Firefox/120.0"},
+	}
+	for _, r := range requests {
+		req := httptest.NewRequest(r.method, "/bot1", nil)
+		req.Header.Set("User-Agent", r.userAgent)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		// bots still get redirected
+		if rec.Code != http.StatusFound || rec.Header().Get("Location") != "https://bots.com" {
+			t.Errorf("%s %q = %d to %q, want a redirect", r.method, r.userAgent, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+
+	stats, _ := h.dao.GetStats("bot1")
+	if stats.Hits != 1 || stats.BotHits != 3 {
+		t.Errorf("GetStats() = %d hits and %d bot hits, want 1 and 3", stats.Hits, stats.BotHits)
+	}
+	if stats.BotFamilies["Slack"] != 1 || stats.BotFamilies["Facebook"] != 1 || stats.BotFamilies["HEAD request"] != 1 {
+		t.Errorf("GetStats().BotFamilies = %v", stats.BotFamilies)
+	}
+	if h.metrics.BotRedirects != 3 {
+		t.Errorf("metrics.BotRedirects = %d, want 3", h.metrics.BotRedirects)
+	}
+}
+
+func TestHandlers_StatsHandler_BadSeriesQuery(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+
+	_ = h.dao.Save("ser2", "https://series.com")
+
+	queries := []string{
+		"granularity=year",
+		"tz=Not/AZone",
+		"from=yesterday",
+		"from=2024-03-05&to=2024-03-01",
+		"granularity=hour&from=2000-01-01&to=2024-01-01",
+	}
+
+	for _, q := range queries {
+		req := httptest.NewRequest(http.MethodGet, "/ser2/stats?"+q, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/:abv/stats")
+		c.SetPathValues(echo.PathValues{{Name: "abv", Value: "ser2"}})
+
+		if err := h.statsHandler(c); err != nil {
+			t.Fatalf("statsHandler() error = %v", err)
+		}
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("statsHandler(%q) status = %v, want %v", q, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestReferrerHost(t *testing.T) {
+	tests := map[string]string{
+		"https://News.Example.com/item?id=1": "news.example.com",
+		"http://example.com:8080/":           "example.com",
+		"":                                   "",
+		"android-app://com.slack/":           "",
+		"not a url %":                        "",
+	}
+	for referrer, want := range tests {
+		if got := referrerHost(referrer); got != want {
+			t.Errorf("referrerHost(%q) = %q, want %q", referrer, got, want)
+		}
+	}
+}
+
+func TestHandlers_AddHandler_Rejected(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+
+	testCases := []struct {
+		url  string
+		code string
+	}{
+		{`"javascript://example.org/%0Aalert(1)"`, policy.CodeScheme},
+		{`"data:text/html,hello"`, policy.CodeScheme},
+		{`"https://bit.ly/abc"`, policy.CodeShortener},
+		{`"http://sho.rt/abc"`, policy.CodeSelf},
+	}
+
+	for _, tc := range testCases {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.url))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Host = "sho.rt:8800"
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		var rejection policy.Rejection
+		if err := json.Unmarshal(rec.Body.Bytes(), &rejection); err != nil {
+			t.Fatalf("addHandler(%s) response isn't a rejection: %s", tc.url, rec.Body.String())
+		}
+		if rec.Code != http.StatusBadRequest || rejection.Code != tc.code || rejection.Reason == "" {
+			t.Errorf("addHandler(%s) = %d %+v, want %d %s", tc.url, rec.Code, rejection, http.StatusBadRequest, tc.code)
+		}
+	}
+
+	if h.metrics.Rejected != uint64(len(testCases)) {
+		t.Errorf("metrics.Rejected = %d, want %d", h.metrics.Rejected, len(testCases))
+	}
+}
+
+func TestHandlers_AddHandler_Expires(t *testing.T) {
+	t.Setenv("logrequests", "false")
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+
+	expires := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	if rec := serve(e, http.MethodPost, "/", `{"url": "https://launch.com", "name": "launch", "expires": "`+expires+`"}`); rec.Code != http.StatusOK {
+		t.Fatalf("create of an expiring link = %d %s", rec.Code, rec.Body)
+	}
+	if rec := serve(e, http.MethodGet, "/launch", ""); rec.Code != http.StatusFound {
+		t.Errorf("GET /launch before it expires = %d, want %d", rec.Code, http.StatusFound)
+	}
+	if rec := serve(e, http.MethodPost, "/", `{"url": "https://launch.com", "expires": "`+expires+`"}`); rec.Code != http.StatusConflict {
+		t.Errorf("create of an expiring link to an existing link's url = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	if rec := serve(e, http.MethodPost, "/", `{"url": "https://past.com", "expires": "2020-01-01T00:00:00Z"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("create of a link that expired already = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	_ = h.dao.SetOptions("launch", dao.Options{Expires: &past})
+	if rec := serve(e, http.MethodGet, "/launch", ""); rec.Code != http.StatusGone || rec.Header().Get("Location") != "" {
+		t.Errorf("GET /launch after it expired = %d to %q, want %d", rec.Code, rec.Header().Get("Location"), http.StatusGone)
+	}
+}
+
+func TestHandlers_AddHandler_Metadata(t *testing.T) {
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<head><title>Destination</title></head>`))
+	}))
+	defer page.Close()
+	t.Setenv("metadata_private", "true")
+
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+	h.SetUnfurler(unfurl.NewFetcher(h.dao))
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`"`+page.URL+`/page"`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Host = "sho.rt"
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	var result urlReturn
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	// the metadata is fetched in the background
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if stats, _ := h.dao.GetStats(result.Abv); stats.Metadata != nil {
+			if stats.Metadata.Title != "Destination" {
+				t.Errorf("Metadata.Title = %q, want %q", stats.Metadata.Title, "Destination")
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("addHandler() didn't fetch the destination's metadata")
 }
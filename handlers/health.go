@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/ericfialkowski/shorturl/linkcheck"
+	"github.com/labstack/echo/v5"
+)
+
+const (
+	unhealthyPath string = "/api/links/unhealthy"
+
+	defaultUnhealthyLimit = 100
+	maxUnhealthyLimit     = 1000
+)
+
+// unhealthyReturn is the links whose last check failed
+type unhealthyReturn struct {
+	Links []dao.LinkHealth `json:"links"`
+}
+
+// unavailablePage is what the page shown instead of redirecting to a dead destination is filled in with
+type unavailablePage struct {
+	Abv string
+	Url string
+}
+
+// SetLinkChecker sets what knows which destinations are dead, and the URL visitors of dead links are sent
+// to instead. Without a fallback they're shown a page saying the destination is unavailable.
+func (h *Handlers) SetLinkChecker(checker *linkcheck.Checker, fallback string) {
+	h.checker = checker
+	h.fallback = fallback
+}
+
+// unhealthyHandler lists the tenant's links whose destinations failed their last check, dead ones first
+func (h *Handlers) unhealthyHandler(c *echo.Context) error {
+	atomic.AddUint64(&h.metrics.LinkHealth, 1)
+
+	limit, err := queryInt(c, "limit", defaultUnhealthyLimit, 1, maxUnhealthyLimit)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	links, err := h.store(c).GetUnhealthy(limit)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting unhealthy links: %v", err))
+	}
+	if err := h.hideLockedHealth(c, links); err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting unhealthy links: %v", err))
+	}
+	return c.JSON(http.StatusOK, unhealthyReturn{Links: links})
+}
+
+// unavailableHandler sends visitors of a link whose destination is dead to the fallback, or shows them
+// a page saying so with the destination, in case it works for them
+func (h *Handlers) unavailableHandler(c *echo.Context, page unavailablePage) error {
+	atomic.AddUint64(&h.metrics.Unavailable, 1)
+	h.recordOtelCounter(c.Request().Context(), "unavailable")
+
+	if h.fallback != "" {
+		http.Redirect(c.Response(), c.Request(), h.fallback, http.StatusFound)
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, "unavailable.html", page); err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error drawing page: %v", err))
+	}
+	return c.HTMLBlob(http.StatusNotFound, buf.Bytes())
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/ericfialkowski/shorturl/linkcheck"
+)
+
+// deadChecker returns a Checker that has loaded gone1 as dead
+func deadChecker(t *testing.T, d dao.ShortUrlDao) *linkcheck.Checker {
+	_ = d.Save("gone1", "https://gone.com")
+	_ = d.SetHealth("gone1", dao.Health{Status: 404, Error: "404 Not Found", Checked: time.Now(), Failures: 3, Dead: true})
+	t.Setenv("health_check_age", "1h")
+
+	checker := linkcheck.NewChecker(d)
+	if err := checker.Run(t.Context()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	return checker
+}
+
+func TestHandlers_GetHandler_Unavailable(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+	h.SetLinkChecker(deadChecker(t, h.dao), "")
+
+	req := httptest.NewRequest(http.MethodGet, "/gone1", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), `href="https://gone.com"`) {
+		t.Errorf("getHandler() = %d %s, want the unavailable page", rec.Code, rec.Body.String())
+	}
+	if h.metrics.Unavailable != 1 {
+		t.Errorf("metrics.Unavailable = %d, want 1", h.metrics.Unavailable)
+	}
+}
+
+func TestHandlers_GetHandler_Fallback(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+	_ = h.dao.Save("ok1", "https://ok.com")
+	h.SetLinkChecker(deadChecker(t, h.dao), "https://sho.rt/missing")
+
+	for abv, want := range map[string]string{"gone1": "https://sho.rt/missing", "ok1": "https://ok.com"} {
+		req := httptest.NewRequest(http.MethodGet, "/"+abv, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusFound || rec.Header().Get("Location") != want {
+			t.Errorf("getHandler(%s) = %d to %q, want a redirect to %s", abv, rec.Code, rec.Header().Get("Location"), want)
+		}
+	}
+}
+
+func TestHandlers_UnhealthyHandler(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+	_ = h.dao.Save("ok1", "https://ok.com")
+	_ = h.dao.Save("flaky1", "https://flaky.com")
+	_ = h.dao.SetHealth("ok1", dao.Health{Status: 200, Checked: time.Now()})
+	_ = h.dao.SetHealth("flaky1", dao.Health{Error: "connection refused", Checked: time.Now(), Failures: 1})
+	deadChecker(t, h.dao)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/links/unhealthy", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	var got unhealthyReturn
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("unhealthyHandler() isn't JSON: %s", rec.Body.String())
+	}
+	if len(got.Links) != 2 || got.Links[0].Abbreviation != "gone1" || got.Links[1].Abbreviation != "flaky1" {
+		t.Errorf("unhealthyHandler() = %+v, want gone1 then flaky1", got.Links)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/links/unhealthy?limit=0", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unhealthyHandler(limit=0) = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
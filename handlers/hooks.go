@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/ericfialkowski/shorturl/policy"
+)
+
+const (
+	defaultHookTimeout = time.Second
+	// CodeHook is the code of the rejections of urls a create validator turned down
+	CodeHook = "rejected_by_hook"
+)
+
+type (
+	// LinkEvent is a link being created or deleted. The context hooks are called with carries the values of the
+	// request's, so middleware can pass them who made it.
+	LinkEvent struct {
+		Domain       string // of the tenant the link belongs to, empty for the default one
+		Host         string // the request was made to, empty for deletes
+		Abbreviation string // empty when validating a create that lets the name be generated
+		Url          string // empty for deletes of links that weren't found
+	}
+
+	// RedirectEvent is a visitor being sent on by a link. Its hit is counted after the filters let it through, so
+	// one they veto isn't counted.
+	RedirectEvent struct {
+		Domain       string
+		Abbreviation string
+		Url          string // the link's destination
+		Target       string // where the visitor is sent, which redirect filters can change
+		Status       int
+		Hit          dao.Hit
+		Request      *http.Request
+	}
+
+	// CreateValidator checks links before they're created. An error turns the request down with a 400 and a
+	// rejection giving it as the reason.
+	CreateValidator interface {
+		ValidateCreate(ctx context.Context, e LinkEvent) error
+	}
+
+	// CreateHook is told about links after they're created
+	CreateHook interface {
+		AfterCreate(ctx context.Context, e LinkEvent)
+	}
+
+	// DeleteHook is told about links after they're deleted
+	DeleteHook interface {
+		AfterDelete(ctx context.Context, e LinkEvent)
+	}
+
+	// RedirectFilter runs before visitors are redirected. It can send them somewhere else by changing the
+	// event's Target, or answer them itself by returning a *Veto.
+	RedirectFilter interface {
+		BeforeRedirect(ctx context.Context, e *RedirectEvent) error
+	}
+
+	// RedirectHook is told about visitors after they're redirected
+	RedirectHook interface {
+		AfterRedirect(ctx context.Context, e RedirectEvent)
+	}
+
+	CreateValidatorFunc func(ctx context.Context, e LinkEvent) error
+	CreateHookFunc      func(ctx context.Context, e LinkEvent)
+	DeleteHookFunc      func(ctx context.Context, e LinkEvent)
+	RedirectFilterFunc  func(ctx context.Context, e *RedirectEvent) error
+	RedirectHookFunc    func(ctx context.Context, e RedirectEvent)
+
+	// Veto stops a redirect, answering the visitor with Status, 403 if it's not set, and Message
+	Veto struct {
+		Status  int
+		Message string
+	}
+
+	// HookOptions are how a hook is run
+	HookOptions struct {
+		Name    string        // used in logs and rejections, the hook's type by default
+		Order   int           // hooks run from the lowest order up, and in the order they were added within one
+		Timeout time.Duration // how long a call can take before it's given up on, a second by default
+	}
+
+	hook[T any] struct {
+		impl T
+		HookOptions
+	}
+
+	// hooks are what's registered on the handlers, each kind sorted in the order they run
+	hooks struct {
+		validators []hook[CreateValidator]
+		creates    []hook[CreateHook]
+		deletes    []hook[DeleteHook]
+		filters    []hook[RedirectFilter]
+		redirects  []hook[RedirectHook]
+	}
+
+	// hookFailure is a hook that panicked or ran out of time, rather than one that returned an error
+	hookFailure struct {
+		name   string
+		reason string
+	}
+)
+
+func (f CreateValidatorFunc) ValidateCreate(ctx context.Context, e LinkEvent) error { return f(ctx, e) }
+func (f CreateHookFunc) AfterCreate(ctx context.Context, e LinkEvent)               { f(ctx, e) }
+func (f DeleteHookFunc) AfterDelete(ctx context.Context, e LinkEvent)               { f(ctx, e) }
+func (f RedirectFilterFunc) BeforeRedirect(ctx context.Context, e *RedirectEvent) error {
+	return f(ctx, e)
+}
+func (f RedirectHookFunc) AfterRedirect(ctx context.Context, e RedirectEvent) { f(ctx, e) }
+
+func (v *Veto) Error() string {
+	return fmt.Sprintf("redirect vetoed with %d: %s", v.status(), v.Message)
+}
+
+func (v *Veto) status() int {
+	return cmp.Or(v.Status, http.StatusForbidden)
+}
+
+func (f *hookFailure) Error() string {
+	return fmt.Sprintf("hook %s %s", f.name, f.reason)
+}
+
+// AddCreateValidator has v check links before they're created, over HTTP, in batches and over gRPC. A validator
+// that panics or times out turns the request down with a 500. Hooks are added before the handlers serve requests.
+func (h *Handlers) AddCreateValidator(v CreateValidator, o HookOptions) {
+	h.hooks.validators = addHook(h.hooks.validators, v, o)
+}
+
+// AddCreateHook has hook told about links after they're created. It's called after the response is sent.
+func (h *Handlers) AddCreateHook(hook CreateHook, o HookOptions) {
+	h.hooks.creates = addHook(h.hooks.creates, hook, o)
+}
+
+// AddDeleteHook has hook told about links after they're deleted. It's called after the response is sent.
+func (h *Handlers) AddDeleteHook(hook DeleteHook, o HookOptions) {
+	h.hooks.deletes = addHook(h.hooks.deletes, hook, o)
+}
+
+// AddRedirectFilter has f run before visitors are redirected. Filters can't break redirects: one that returns an
+// error other than a *Veto, panics or times out is logged and skipped, and its changes are dropped.
+func (h *Handlers) AddRedirectFilter(f RedirectFilter, o HookOptions) {
+	h.hooks.filters = addHook(h.hooks.filters, f, o)
+}
+
+// AddRedirectHook has hook told about visitors after they're redirected. It's called after the response is sent.
+func (h *Handlers) AddRedirectHook(hook RedirectHook, o HookOptions) {
+	h.hooks.redirects = addHook(h.hooks.redirects, hook, o)
+}
+
+// addHook adds impl to list, keeping it sorted by order
+func addHook[T any](list []hook[T], impl T, o HookOptions) []hook[T] {
+	if o.Name == "" {
+		o.Name = reflect.TypeOf(impl).String()
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = defaultHookTimeout
+	}
+	list = append(list, hook[T]{impl: impl, HookOptions: o})
+	slices.SortStableFunc(list, func(a, b hook[T]) int { return cmp.Compare(a.Order, b.Order) })
+	return list
+}
+
+// callHook runs fn with a context that's done after the hook's timeout, returning its error, or a *hookFailure
+// when it panics or takes too long. A hook that takes too long is left to finish on its own.
+func callHook(ctx context.Context, o HookOptions, fn func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, o.Timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- &hookFailure{name: o.Name, reason: fmt.Sprintf("panicked: %v", r)}
+			}
+		}()
+		done <- fn(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return &hookFailure{name: o.Name, reason: fmt.Sprintf("timed out after %v", o.Timeout)}
+	}
+}
+
+// validateCreate runs the create validators in turn, returning why the first one that fails turned e down
+func (h *Handlers) validateCreate(ctx context.Context, e LinkEvent) *createError {
+	for _, v := range h.hooks.validators {
+		err := callHook(ctx, v.HookOptions, func(ctx context.Context) error {
+			return v.impl.ValidateCreate(ctx, e)
+		})
+		if err == nil {
+			continue
+		}
+		var failure *hookFailure
+		if errors.As(err, &failure) {
+			log.Printf("Error validating link to %s: %v", e.Url, err)
+			return &createError{status: http.StatusInternalServerError, message: fmt.Sprintf("Error validating url: %v", err)}
+		}
+		rejection := &policy.Rejection{Code: CodeHook, Reason: err.Error(), Rule: v.Name}
+		return &createError{status: http.StatusBadRequest, message: rejection.Error(), rejection: rejection}
+	}
+	return nil
+}
+
+// filterRedirect runs the redirect filters in turn on e, returning the veto of the first one that stops it
+func (h *Handlers) filterRedirect(ctx context.Context, e *RedirectEvent) *Veto {
+	for _, f := range h.hooks.filters {
+		// each filter works on a copy, so one that fails can't leave its changes behind
+		next := *e
+		err := callHook(ctx, f.HookOptions, func(ctx context.Context) error {
+			return f.impl.BeforeRedirect(ctx, &next)
+		})
+		var veto *Veto
+		switch {
+		case err == nil:
+			e.Target = next.Target
+		case errors.As(err, &veto):
+			return veto
+		default:
+			log.Printf("Error filtering redirect of %s, skipping it: %v", e.Abbreviation, err)
+		}
+	}
+	return nil
+}
+
+// afterCreate tells the create hooks about e once the request is done
+func (h *Handlers) afterCreate(ctx context.Context, e LinkEvent) {
+	afterwards(ctx, h.hooks.creates, func(ctx context.Context, hook CreateHook) { hook.AfterCreate(ctx, e) })
+}
+
+// afterDelete tells the delete hooks about e once the request is done
+func (h *Handlers) afterDelete(ctx context.Context, e LinkEvent) {
+	afterwards(ctx, h.hooks.deletes, func(ctx context.Context, hook DeleteHook) { hook.AfterDelete(ctx, e) })
+}
+
+// afterRedirect tells the redirect hooks about e once the request is done
+func (h *Handlers) afterRedirect(ctx context.Context, e RedirectEvent) {
+	afterwards(ctx, h.hooks.redirects, func(ctx context.Context, hook RedirectHook) { hook.AfterRedirect(ctx, e) })
+}
+
+// afterwards calls the hooks in turn in the background, with ctx's values but not its cancellation, as it
+// usually ends with the request they're about
+func afterwards[T any](ctx context.Context, list []hook[T], call func(context.Context, T)) {
+	if len(list) == 0 {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		for _, hook := range list {
+			err := callHook(ctx, hook.HookOptions, func(ctx context.Context) error {
+				call(ctx, hook.impl)
+				return nil
+			})
+			if err != nil {
+				log.Printf("Error running hook: %v", err)
+			}
+		}
+	}()
+}
+
+// deleteEvent is the event of abv being deleted, looking up its url when there are hooks to tell
+func (h *Handlers) deleteEvent(domain string, store dao.ShortUrlDao, abv string) LinkEvent {
+	e := LinkEvent{Domain: domain, Abbreviation: abv}
+	if len(h.hooks.deletes) > 0 {
+		if link, err := store.FindLink([]string{abv}); err == nil {
+			e.Url = link.Url
+		}
+	}
+	return e
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ericfialkowski/shorturl/policy"
+	"github.com/labstack/echo/v5"
+)
+
+func serve(e *echo.Echo, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Host = "sho.rt"
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandlers_CreateValidators(t *testing.T) {
+	t.Setenv("logrequests", "false")
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+
+	var (
+		mu           sync.Mutex // batches validate several requests at once
+		order, names []string
+	)
+	h.AddCreateValidator(CreateValidatorFunc(func(_ context.Context, ev LinkEvent) error {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, "second")
+		if !strings.Contains(ev.Url, "company.com") {
+			return errors.New("only company.com links can be made")
+		}
+		return nil
+	}), HookOptions{Name: "company-only", Order: 1})
+	h.AddCreateValidator(CreateValidatorFunc(func(_ context.Context, ev LinkEvent) error {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, "first")
+		names = append(names, ev.Abbreviation)
+		if ev.Host != "sho.rt" {
+			t.Errorf("ValidateCreate() event = %+v, want the request's host", ev)
+		}
+		return nil
+	}), HookOptions{})
+
+	rec := serve(e, http.MethodPost, "/", `{"url": "https://other.com", "name": "wiki"}`)
+	var rejection policy.Rejection
+	if rec.Code != http.StatusBadRequest || json.Unmarshal(rec.Body.Bytes(), &rejection) != nil ||
+		rejection.Code != CodeHook || rejection.Rule != "company-only" {
+		t.Errorf("create of a url turned down = %d %s", rec.Code, rec.Body)
+	}
+	if strings.Join(order, ",") != "first,second" || names[0] != "wiki" {
+		t.Errorf("validators ran in order %v for %v, want first,second for wiki", order, names)
+	}
+	if rec := serve(e, http.MethodPost, "/", `{"url": "https://company.com", "name": "wiki"}`); rec.Code != http.StatusOK {
+		t.Errorf("create of an allowed url = %d %s", rec.Code, rec.Body)
+	}
+	if rec := serve(e, http.MethodPost, "/api/links:batch", `["https://company.com/a", "https://other.com"]`); !strings.Contains(rec.Body.String(), CodeHook) {
+		t.Errorf("batch didn't run the validators: %d %s", rec.Code, rec.Body)
+	}
+
+	h.AddCreateValidator(CreateValidatorFunc(func(context.Context, LinkEvent) error {
+		panic("boom")
+	}), HookOptions{Order: 2})
+	if rec := serve(e, http.MethodPost, "/", `"https://company.com/b"`); rec.Code != http.StatusInternalServerError {
+		t.Errorf("create with a panicking validator = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestHandlers_RedirectFilters(t *testing.T) {
+	t.Setenv("logrequests", "false")
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+	_ = h.dao.Save("wiki", "https://wiki.com")
+	_ = h.dao.Save("secret", "https://secret.com")
+
+	h.AddRedirectFilter(RedirectFilterFunc(func(_ context.Context, ev *RedirectEvent) error {
+		ev.Target = "https://broken.com"
+		return errors.New("failed")
+	}), HookOptions{Name: "failing"})
+	h.AddRedirectFilter(RedirectFilterFunc(func(ctx context.Context, ev *RedirectEvent) error {
+		ev.Target = "https://slow.com"
+		<-ctx.Done()
+		return nil
+	}), HookOptions{Name: "slow", Timeout: 10 * time.Millisecond})
+	h.AddRedirectFilter(RedirectFilterFunc(func(context.Context, *RedirectEvent) error {
+		panic("boom")
+	}), HookOptions{})
+	h.AddRedirectFilter(RedirectFilterFunc(func(_ context.Context, ev *RedirectEvent) error {
+		if ev.Abbreviation == "secret" {
+			return &Veto{Message: "Not for you"}
+		}
+		ev.Target += "/?via=shorturl"
+		return nil
+	}), HookOptions{Order: 1})
+
+	rec := serve(e, http.MethodGet, "/wiki", "")
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "https://wiki.com/?via=shorturl" {
+		t.Errorf("GET /wiki = %d to %q, want the rewritten target", rec.Code, rec.Header().Get("Location"))
+	}
+	if rec := serve(e, http.MethodGet, "/secret", ""); rec.Code != http.StatusForbidden || rec.Body.String() != "Not for you" {
+		t.Errorf("GET /secret = %d %s, want the veto", rec.Code, rec.Body)
+	}
+	// the test requests have no user agent, so they count as bots
+	if stats, _ := h.dao.GetStats("secret"); stats.BotHits != 0 {
+		t.Errorf("GetStats(secret).BotHits = %d after a veto, want 0", stats.BotHits)
+	}
+	if stats, _ := h.dao.GetStats("wiki"); stats.BotHits != 1 {
+		t.Errorf("GetStats(wiki).BotHits = %d after a redirect, want 1", stats.BotHits)
+	}
+}
+
+func TestHandlers_RedirectFilters_CheckTarget(t *testing.T) {
+	t.Setenv("logrequests", "false")
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+	_ = h.dao.Save("wiki", "https://wiki.com")
+	_ = h.dao.Save("loop", "https://loop.com")
+	h.SetThreats(threatServer(t))
+
+	h.AddRedirectFilter(RedirectFilterFunc(func(_ context.Context, ev *RedirectEvent) error {
+		if ev.Abbreviation == "loop" {
+			ev.Target = "https://sho.rt/wiki"
+		} else {
+			ev.Target = "https://evil.example/download"
+		}
+		return nil
+	}), HookOptions{})
+
+	for _, abv := range []string{"wiki", "loop"} {
+		rec := serve(e, http.MethodGet, "/"+abv, "")
+		if rec.Code != http.StatusForbidden || rec.Header().Get("Location") != "" {
+			t.Errorf("GET /%s = %d to %q, want the rewritten target turned down", abv, rec.Code, rec.Header().Get("Location"))
+		}
+		if stats, _ := h.dao.GetStats(abv); stats.BotHits != 0 || stats.Blocked != "" {
+			t.Errorf("GetStats(%s) = %d hits, blocked %q, want the link left alone", abv, stats.BotHits, stats.Blocked)
+		}
+	}
+}
+
+func TestHandlers_AfterHooks(t *testing.T) {
+	t.Setenv("logrequests", "false")
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+
+	events := make(chan string, 10)
+	h.AddCreateHook(CreateHookFunc(func(context.Context, LinkEvent) {
+		panic("boom")
+	}), HookOptions{})
+	h.AddCreateHook(CreateHookFunc(func(_ context.Context, ev LinkEvent) {
+		events <- "created " + ev.Abbreviation + " " + ev.Url
+	}), HookOptions{Order: 1})
+	h.AddRedirectHook(RedirectHookFunc(func(_ context.Context, ev RedirectEvent) {
+		events <- "redirected " + ev.Abbreviation + " " + ev.Target
+	}), HookOptions{})
+	h.AddDeleteHook(DeleteHookFunc(func(_ context.Context, ev LinkEvent) {
+		events <- "deleted " + ev.Abbreviation + " " + ev.Url
+	}), HookOptions{})
+
+	for _, step := range []struct {
+		method, target, body, want string
+	}{
+		{http.MethodPost, "/", `{"url": "https://wiki.com", "name": "wiki"}`, "created wiki https://wiki.com"},
+		{http.MethodGet, "/wiki", "", "redirected wiki https://wiki.com"},
+		{http.MethodDelete, "/wiki", "", "deleted wiki https://wiki.com"},
+	} {
+		if rec := serve(e, step.method, step.target, step.body); rec.Code >= 400 {
+			t.Fatalf("%s %s = %d %s", step.method, step.target, rec.Code, rec.Body)
+		}
+		select {
+		case got := <-events:
+			if got != step.want {
+				t.Errorf("%s %s hook saw %q, want %q", step.method, step.target, got, step.want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s %s didn't call its hook", step.method, step.target)
+		}
+	}
+}
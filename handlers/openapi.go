@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/labstack/echo/v5"
+)
+
+const openApiPath string = "/api/openapi.json"
+
+// openApi describes the HTTP API. It's kept by hand next to the handlers, and the tests check the handlers'
+// responses against it.
+//
+//go:embed openapi.json
+var openApi []byte
+
+// openApiHandler returns the OpenAPI document of the HTTP API
+func (h *Handlers) openApiHandler(c *echo.Context) error {
+	return c.Blob(http.StatusOK, echo.MIMEApplicationJSON, openApi)
+}
@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/labstack/echo/v5"
+)
+
+// openApiSpec is the OpenAPI document, decoded just enough to check responses against it
+type openApiSpec struct {
+	doc map[string]any
+}
+
+func loadOpenApi(t *testing.T) openApiSpec {
+	t.Helper()
+	var doc map[string]any
+	if err := json.Unmarshal(openApi, &doc); err != nil {
+		t.Fatalf("openapi.json isn't JSON: %v", err)
+	}
+	return openApiSpec{doc: doc}
+}
+
+// resolve follows a $ref within the document
+func (s openApiSpec) resolve(node map[string]any) map[string]any {
+	for {
+		ref, ok := node["$ref"].(string)
+		if !ok {
+			return node
+		}
+		var next any = s.doc
+		for key := range strings.SplitSeq(strings.TrimPrefix(ref, "#/"), "/") {
+			next = next.(map[string]any)[key]
+		}
+		node = next.(map[string]any)
+	}
+}
+
+// operation returns the operation of method on the templated path, or nil when there isn't one
+func (s openApiSpec) operation(method, path string) map[string]any {
+	item, _ := s.doc["paths"].(map[string]any)[path].(map[string]any)
+	op, _ := item[strings.ToLower(method)].(map[string]any)
+	return op
+}
+
+// validate returns how v doesn't match schema, as paths into v and what's wrong there
+func (s openApiSpec) validate(schema map[string]any, v any, at string) []string {
+	schema = s.resolve(schema)
+	if v == nil {
+		if schema["nullable"] == true {
+			return nil
+		}
+		return []string{at + ": null isn't allowed"}
+	}
+	if oneOf, ok := schema["oneOf"].([]any); ok {
+		matches := 0
+		for _, option := range oneOf {
+			if len(s.validate(option.(map[string]any), v, at)) == 0 {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return []string{fmt.Sprintf("%s: matches %d of oneOf, want 1", at, matches)}
+		}
+		return nil
+	}
+	if enum, ok := schema["enum"].([]any); ok && !slices.Contains(enum, v) {
+		return []string{fmt.Sprintf("%s: %v isn't one of %v", at, v, enum)}
+	}
+
+	var problems []string
+	switch schema["type"] {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: %T isn't an object", at, v)}
+		}
+		required, _ := schema["required"].([]any)
+		for _, name := range required {
+			if _, ok := obj[name.(string)]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: %s is missing", at, name))
+			}
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		for name, value := range obj {
+			if property, ok := properties[name].(map[string]any); ok {
+				problems = append(problems, s.validate(property, value, at+"."+name)...)
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					problems = append(problems, fmt.Sprintf("%s: %s isn't in the schema", at, name))
+				}
+			case map[string]any:
+				problems = append(problems, s.validate(additional, value, at+"."+name)...)
+			}
+		}
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: %T isn't an array", at, v)}
+		}
+		for i, item := range arr {
+			problems = append(problems, s.validate(schema["items"].(map[string]any), item, at+"["+strconv.Itoa(i)+"]")...)
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return []string{fmt.Sprintf("%s: %T isn't a string", at, v)}
+		}
+		if pattern, ok := schema["pattern"].(string); ok && !regexp.MustCompile(pattern).MatchString(str) {
+			problems = append(problems, fmt.Sprintf("%s: %q doesn't match %s", at, str, pattern))
+		}
+		switch schema["format"] {
+		case "date-time":
+			if _, err := time.Parse(time.RFC3339, str); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %q isn't a date-time", at, str))
+			}
+		case "date":
+			if _, err := time.Parse(time.DateOnly, str); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %q isn't a date", at, str))
+			}
+		}
+	case "integer":
+		n, ok := v.(float64)
+		if !ok || n != float64(int64(n)) {
+			return []string{fmt.Sprintf("%s: %v isn't an integer", at, v)}
+		}
+		if lo, ok := schema["minimum"].(float64); ok && n < lo {
+			problems = append(problems, fmt.Sprintf("%s: %v is less than %v", at, n, lo))
+		}
+		if hi, ok := schema["maximum"].(float64); ok && n > hi {
+			problems = append(problems, fmt.Sprintf("%s: %v is more than %v", at, n, hi))
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return []string{fmt.Sprintf("%s: %T isn't a boolean", at, v)}
+		}
+	}
+	return problems
+}
+
+// checkResponse returns how the response to method on the templated path isn't what the document says
+func (s openApiSpec) checkResponse(method, path string, rec *httptest.ResponseRecorder) []string {
+	op := s.operation(method, path)
+	if op == nil {
+		return []string{fmt.Sprintf("%s %s isn't in the document", method, path)}
+	}
+	response, ok := op["responses"].(map[string]any)[strconv.Itoa(rec.Code)].(map[string]any)
+	if !ok {
+		return []string{fmt.Sprintf("status %d isn't documented", rec.Code)}
+	}
+	content, _ := s.resolve(response)["content"].(map[string]any)
+	if content == nil {
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(rec.Header().Get(echo.HeaderContentType))
+	media, ok := content[mediaType].(map[string]any)
+	if !ok {
+		return []string{fmt.Sprintf("content type %q isn't documented for status %d", mediaType, rec.Code)}
+	}
+	if mediaType != echo.MIMEApplicationJSON {
+		return nil
+	}
+	var body any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		return []string{fmt.Sprintf("body isn't JSON: %v", err)}
+	}
+	return s.validate(media["schema"].(map[string]any), body, "body")
+}
+
+func TestHandlers_OpenApiHandler(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/openapi.json = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var doc struct {
+		OpenApi string `json:"openapi"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil || !strings.HasPrefix(doc.OpenApi, "3.") {
+		t.Errorf("GET /api/openapi.json = %s, want an OpenAPI 3 document", rec.Body.String())
+	}
+}
+
+// TestOpenApi_Routes checks that the document and the routes have the same operations
+func TestOpenApi_Routes(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+	spec := loadOpenApi(t)
+
+	param := regexp.MustCompile(`:(\w+)`)
+	routed := make(map[string]bool)
+	for _, route := range e.Router().Routes() {
+		// HEAD goes with GET, and the redirects of the rest of a path and of API requests are described with
+		// the redirect of a link
+		if route.Method == http.MethodHead || strings.HasSuffix(route.Path, "*") {
+			continue
+		}
+		path := param.ReplaceAllString(strings.ReplaceAll(route.Path, `\:`, "\x00"), "{$1}")
+		path = strings.ReplaceAll(path, "\x00", ":")
+		if path == "/{abv}" && route.Method != http.MethodGet && route.Method != http.MethodDelete {
+			continue
+		}
+		routed[route.Method+" "+path] = true
+		if spec.operation(route.Method, path) == nil {
+			t.Errorf("%s %s isn't in openapi.json", route.Method, path)
+		}
+	}
+
+	for path, item := range spec.doc["paths"].(map[string]any) {
+		for method := range item.(map[string]any) {
+			if method == "parameters" {
+				continue
+			}
+			if key := strings.ToUpper(method) + " " + path; !routed[key] {
+				t.Errorf("%s is in openapi.json but isn't routed", key)
+			}
+		}
+	}
+}
+
+// TestOpenApi_Responses checks the responses of the handlers against the document
+func TestOpenApi_Responses(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+	spec := loadOpenApi(t)
+
+	_ = h.dao.Save("doc", "https://docs.com")
+	_ = h.dao.Save("team/wiki", "https://wiki.com")
+	_ = h.dao.SetOptions("team/wiki", dao.Options{
+		Passthrough: &dao.Passthrough{Path: true},
+		Experiment:  &dao.Experiment{Variants: []dao.Variant{{Name: "a", Url: "https://a.com", Weight: 1}}},
+	})
+	_ = h.dao.AddTags("doc", []string{"spring"})
+	_ = h.dao.SetCollection("doc", "launch")
+	hit := dao.NewHit()
+	hit.Country, hit.Region, hit.Visitor, hit.Referrer = "US", "US-CA", "v", "news.com"
+	_, _ = h.dao.GetUrlWithHit("doc", hit)
+
+	tests := []struct {
+		method, target, path, body string
+	}{
+		{http.MethodPost, "/", "/", `"https://example.com"`},
+		{http.MethodPost, "/", "/", `{"url": "https://named.com", "name": "named"}`},
+		{http.MethodPost, "/", "/", `{"url": "https://other.com", "name": "named"}`},
+		{http.MethodPost, "/", "/", `"https://bit.ly/abc"`},
+		{http.MethodPost, "/", "/", `""`},
+		{http.MethodGet, "/doc", "/{abv}", ``},
+		{http.MethodGet, "/missing", "/{abv}", ``},
+		{http.MethodGet, "/doc/stats", "/{abv}/stats", ``},
+		{http.MethodGet, "/team%2Fwiki/stats?granularity=hour", "/{abv}/stats", ``},
+		{http.MethodGet, "/doc/stats?granularity=week&tz=Europe/Berlin", "/{abv}/stats", ``},
+		{http.MethodGet, "/doc/stats?tz=Nowhere", "/{abv}/stats", ``},
+		{http.MethodGet, "/missing/stats", "/{abv}/stats", ``},
+		{http.MethodGet, "/doc/stats/ui", "/{abv}/stats/ui", ``},
+		{http.MethodGet, "/doc/qr", "/{abv}/qr", ``},
+		{http.MethodGet, "/doc/qr?format=svg", "/{abv}/qr", ``},
+		{http.MethodGet, "/doc/qr?size=1", "/{abv}/qr", ``},
+		{http.MethodGet, "/team%2Fwiki/options", "/{abv}/options", ``},
+		{http.MethodPut, "/doc/options", "/{abv}/options", `{"status": 301, "rules": [{"countries": ["US"], "url": "https://us.docs.com"}]}`},
+		{http.MethodPut, "/doc/options", "/{abv}/options", `{"rules": [{"url": "https://bit.ly/x"}]}`},
+		{http.MethodPut, "/doc/options", "/{abv}/options", `{"unknown": true}`},
+		{http.MethodPut, "/doc/experiment", "/{abv}/experiment", `{"variants": [{"name": "a", "url": "https://a.com", "weight": 1}]}`},
+		{http.MethodPut, "/doc/experiment", "/{abv}/experiment", `null`},
+		{http.MethodPost, "/doc/tags", "/{abv}/tags", `["email"]`},
+		{http.MethodDelete, "/doc/tags/email", "/{abv}/tags/{tag}", ``},
+		{http.MethodPut, "/doc/collection", "/{abv}/collection", `"launch"`},
+		{http.MethodGet, "/api/tags/spring", "/api/tags/{tag}", ``},
+		{http.MethodGet, "/api/tags/nothing", "/api/tags/{tag}", ``},
+		{http.MethodGet, "/api/tags/spring/stats", "/api/tags/{tag}/stats", ``},
+		{http.MethodGet, "/api/collections/launch", "/api/collections/{collection}", ``},
+		{http.MethodGet, "/api/collections/launch/stats?days=3", "/api/collections/{collection}/stats", ``},
+		{http.MethodGet, "/api/analytics", "/api/analytics", ``},
+		{http.MethodGet, "/api/analytics?days=0", "/api/analytics", ``},
+		{http.MethodGet, "/api/analytics/ui", "/api/analytics/ui", ``},
+		{http.MethodPost, "/api/links:batch", "/api/links:batch", `["https://one.com", {"url": "https://two.com", "name": "two"}, "ftp://three.com", 3]`},
+		{http.MethodPost, "/api/links:batch", "/api/links:batch", `[]`},
+		{http.MethodPost, "/api/links:batch?transactional=true", "/api/links:batch", `["https://one.com"]`},
+		{http.MethodGet, "/api/links?prefix=do", "/api/links", ``},
+		{http.MethodGet, "/api/links?limit=0", "/api/links", ``},
+		{http.MethodGet, "/api/links/unhealthy", "/api/links/unhealthy", ``},
+		{http.MethodGet, "/api/search?q=doc", "/api/search", ``},
+		{http.MethodGet, "/api/search?q=nothing", "/api/search", ``},
+		{http.MethodGet, "/opensearch.xml", "/opensearch.xml", ``},
+		{http.MethodGet, "/diag/status", "/diag/status", ``},
+		{http.MethodGet, "/diag/metrics", "/diag/metrics", ``},
+		{http.MethodGet, "/api/openapi.json", "/api/openapi.json", ``},
+		{http.MethodPut, "/doc/password", "/{abv}/password", `{"password": "short"}`},
+		{http.MethodPut, "/doc/password", "/{abv}/password", `{"password": "correct horse battery"}`},
+		{http.MethodGet, "/doc", "/{abv}", ``},
+		{http.MethodGet, "/doc/stats", "/{abv}/stats", ``},
+		{http.MethodGet, "/doc/options", "/{abv}/options", ``},
+		{http.MethodPost, "/doc/unlock", "/{abv}/unlock", `password=wrong+password`},
+		{http.MethodPost, "/doc/unlock", "/{abv}/unlock", `password=correct+horse+battery`},
+		{http.MethodDelete, "/doc", "/{abv}", ``},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		req.Host = "sho.rt"
+		if strings.HasSuffix(tt.path, "/unlock") {
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		} else if tt.body != "" {
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		for _, problem := range spec.checkResponse(tt.method, tt.path, rec) {
+			t.Errorf("%s %s %s = %d: %s", tt.method, tt.target, tt.body, rec.Code, problem)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/labstack/echo/v5"
+)
+
+const (
+	optionsPath     string = "/:abv/options"
+	experimentPath  string = "/:abv/experiment"
+	passthroughPath string = "/:abv/*"
+)
+
+// optionsHandler returns the options that change how a link redirects
+func (h *Handlers) optionsHandler(c *echo.Context) error {
+	atomic.AddUint64(&h.metrics.Options, 1)
+
+	abv := abvParam(c)
+	stats, err := h.store(c).GetStats(abv)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting link: %v", err))
+	}
+	if stats.Abbreviation == "" {
+		return c.String(http.StatusNotFound, "No link found")
+	}
+	if err := h.hideIfLocked(c, &stats); err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting link: %v", err))
+	}
+	if stats.Url == "" {
+		return c.String(http.StatusForbidden, "Link is password protected")
+	}
+
+	return c.JSON(http.StatusOK, linkOptions(stats))
+}
+
+// setOptionsHandler replaces the options of a link. Sending {} clears them.
+func (h *Handlers) setOptionsHandler(c *echo.Context) error {
+	atomic.AddUint64(&h.metrics.Options, 1)
+
+	var options dao.Options
+	decoder := json.NewDecoder(c.Request().Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&options); err != nil {
+		return c.String(http.StatusBadRequest, fmt.Sprintf("Error parsing options: %v", err))
+	}
+
+	abv := abvParam(c)
+	stats, err := h.store(c).GetStats(abv)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting link: %v", err))
+	}
+	if stats.Abbreviation == "" {
+		return c.String(http.StatusNotFound, "No link found")
+	}
+	return h.saveOptions(c, abv, options)
+}
+
+// setExperimentHandler replaces just the experiment of a link, to change its weights or declare a winner
+// without sending the rest of the options. Sending null ends it.
+func (h *Handlers) setExperimentHandler(c *echo.Context) error {
+	atomic.AddUint64(&h.metrics.Options, 1)
+
+	var experiment *dao.Experiment
+	decoder := json.NewDecoder(c.Request().Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&experiment); err != nil {
+		return c.String(http.StatusBadRequest, fmt.Sprintf("Error parsing experiment: %v", err))
+	}
+
+	abv := abvParam(c)
+	stats, err := h.store(c).GetStats(abv)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting link: %v", err))
+	}
+	if stats.Abbreviation == "" {
+		return c.String(http.StatusNotFound, "No link found")
+	}
+
+	options := linkOptions(stats)
+	options.Experiment = experiment
+	return h.saveOptions(c, abv, options)
+}
+
+// saveOptions checks options and stores them as the options of abv
+func (h *Handlers) saveOptions(c *echo.Context, abv string, options dao.Options) error {
+	if err := options.Validate(); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	// rules and variants lead to places that need to be as acceptable as the link's own destination
+	var destinations []string
+	for _, rule := range options.Rules {
+		destinations = append(destinations, rule.Url)
+	}
+	if options.Experiment != nil {
+		for _, variant := range options.Experiment.Variants {
+			destinations = append(destinations, variant.Url)
+		}
+	}
+	for _, dest := range destinations {
+		u, _ := url.ParseRequestURI(dest)
+		if rejection := h.checkDestination(u, c.Request().Host); rejection != nil {
+			atomic.AddUint64(&h.metrics.Rejected, 1)
+			return c.JSON(http.StatusBadRequest, rejection)
+		}
+	}
+
+	if err := h.store(c).SetOptions(abv, options); err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error saving options: %v", err))
+	}
+	return c.JSON(http.StatusOK, options)
+}
+
+// restOfPath returns the still escaped path after the abbreviation, without the slash between them
+func restOfPath(c *echo.Context) string {
+	escaped := strings.TrimPrefix(c.Request().URL.EscapedPath(), "/")
+	_, rest, _ := strings.Cut(escaped, "/")
+	return rest
+}
+
+// passthrough carries the rest of the request path and its query parameters over to the destination u,
+// as far as p allows. Path segments are re-escaped so they stay segments, and ones that would climb out
+// of the destination's path are refused.
+func passthrough(u string, p *dao.Passthrough, rest string, query url.Values) (string, error) {
+	if p == nil || (!p.Path || rest == "") && (!p.Query || len(query) == 0) {
+		return u, nil
+	}
+	dest, err := url.Parse(u)
+	if err != nil {
+		return "", fmt.Errorf("invalid destination: %v", err)
+	}
+
+	if p.Path && rest != "" {
+		segments := strings.Split(rest, "/")
+		for i, segment := range segments {
+			s, err := url.PathUnescape(segment)
+			if err != nil || s == "." || s == ".." {
+				return "", fmt.Errorf("invalid path %q", rest)
+			}
+			segments[i] = url.PathEscape(s)
+		}
+		joined := strings.TrimSuffix(dest.EscapedPath(), "/") + "/" + strings.Join(segments, "/")
+		dest.Path, _ = url.PathUnescape(joined)
+		dest.RawPath = joined
+	}
+
+	if p.Query && len(query) > 0 {
+		merged := dest.Query()
+		for key, values := range query {
+			_, conflict := merged[key]
+			switch {
+			case !conflict || p.Conflicts == dao.ConflictReplace:
+				merged[key] = values
+			case p.Conflicts == dao.ConflictAppend:
+				merged[key] = append(merged[key], values...)
+			}
+		}
+		dest.RawQuery = merged.Encode()
+	}
+	return dest.String(), nil
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/labstack/echo/v5"
+)
+
+func TestHandlers_OptionsHandler(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+	_ = h.dao.Save("opt1", "https://docs.com")
+
+	put := func(abv, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/"+abv+"/options", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := put("opt1", `{"passthrough":{"path":true,"query":true,"conflicts":"replace"}}`); rec.Code != http.StatusOK {
+		t.Fatalf("setOptionsHandler() status = %v, want %v: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	got, _ := h.dao.GetOptions("opt1")
+	if got.Passthrough == nil || !got.Passthrough.Path || !got.Passthrough.Query || got.Passthrough.Conflicts != dao.ConflictReplace {
+		t.Errorf("GetOptions() = %+v, want what was set", got.Passthrough)
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/opt1/options", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"conflicts":"replace"`) {
+		t.Errorf("optionsHandler() = %d %s, want the options", rec.Code, rec.Body.String())
+	}
+
+	tests := []struct {
+		abv  string
+		body string
+		want int
+	}{
+		{"opt1", `{"passthrough":{"conflicts":"merge"}}`, http.StatusBadRequest},
+		{"opt1", `{"passthru":{}}`, http.StatusBadRequest},
+		{"opt1", `not json`, http.StatusBadRequest},
+		{"missing", `{}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if rec := put(tt.abv, tt.body); rec.Code != tt.want {
+			t.Errorf("setOptionsHandler(%s, %s) status = %v, want %v", tt.abv, tt.body, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestHandlers_GetHandler_Passthrough(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+	_ = h.dao.Save("docs", "https://docs.com/guide/?lang=en")
+	_ = h.dao.Save("plain", "https://plain.com/")
+	_ = h.dao.SetOptions("docs", dao.Options{Passthrough: &dao.Passthrough{Path: true, Query: true}})
+
+	tests := []struct {
+		path     string
+		code     int
+		location string
+	}{
+		{"/docs/getting-started?ref=email", http.StatusFound, "https://docs.com/guide/getting-started?lang=en&ref=email"},
+		{"/docs?lang=fr", http.StatusFound, "https://docs.com/guide/?lang=en"},
+		{"/docs/a%20b/c%2Fd/", http.StatusFound, "https://docs.com/guide/a%20b/c%2Fd/?lang=en"},
+		{"/docs/../admin", http.StatusBadRequest, ""},
+		{"/docs/%2E%2E/admin", http.StatusBadRequest, ""},
+		{"/docs/stats", http.StatusOK, ""}, // the stats page wins
+		{"/plain/extra", http.StatusNotFound, ""},
+		{"/plain?ref=email", http.StatusFound, "https://plain.com/"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.URL, _ = url.Parse(tt.path) // keeps ".." that NewRequest would clean away
+		req.RequestURI = tt.path
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		if rec.Code != tt.code || rec.Header().Get("Location") != tt.location {
+			t.Errorf("GET %s = %d to %q, want %d to %q", tt.path, rec.Code, rec.Header().Get("Location"), tt.code, tt.location)
+		}
+	}
+}
+
+func TestPassthrough_Conflicts(t *testing.T) {
+	query := url.Values{"ref": {"email"}, "utm": {"a"}}
+	tests := map[string]string{
+		"":                  "https://d.com/?ref=site&utm=a",
+		dao.ConflictKeep:    "https://d.com/?ref=site&utm=a",
+		dao.ConflictReplace: "https://d.com/?ref=email&utm=a",
+		dao.ConflictAppend:  "https://d.com/?ref=site&ref=email&utm=a",
+	}
+	for conflicts, want := range tests {
+		got, err := passthrough("https://d.com/?ref=site", &dao.Passthrough{Query: true, Conflicts: conflicts}, "", query)
+		if err != nil || got != want {
+			t.Errorf("passthrough(%q) = %q, %v, want %q", conflicts, got, err, want)
+		}
+	}
+}
+
+func TestHandlers_GetHandler_Rules(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+	_ = h.dao.Save("pkg", "https://pkg.com/")
+
+	body := `{"rules":[
+		{"platforms":["ios"],"url":"https://apps.apple.com/app/pkg"},
+		{"platforms":["android"],"url":"https://play.google.com/store/apps/details?id=pkg"},
+		{"languages":["de"],"url":"https://pkg.com/de/"}
+	],"passthrough":{"query":true}}`
+	req := httptest.NewRequest(http.MethodPut, "/pkg/options", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("setOptionsHandler() status = %v, want %v: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	tests := []struct {
+		name      string
+		userAgent string
+		language  string
+		location  string
+	}{
+		{"iPhone", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X)", "de-DE", "https://apps.apple.com/app/pkg?ref=qr"},
+		{"Android", "Mozilla/5.0 (Linux; Android 14; Pixel 8)", "", "https://play.google.com/store/apps/details?id=pkg&ref=qr"},
+		{"German desktop", "Mozilla/5.0 (Windows NT 10.0; Win64; x64)", "de-AT,en;q=0.5", "https://pkg.com/de/?ref=qr"},
+		{"everyone else", "Mozilla/5.0 (Windows NT 10.0; Win64; x64)", "en-US", "https://pkg.com/?ref=qr"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/pkg?ref=qr", nil)
+			req.Header.Set("User-Agent", tt.userAgent)
+			req.Header.Set("Accept-Language", tt.language)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusFound || rec.Header().Get("Location") != tt.location {
+				t.Errorf("GET /pkg = %d to %q, want %d to %q", rec.Code, rec.Header().Get("Location"), http.StatusFound, tt.location)
+			}
+		})
+	}
+
+	for _, body := range []string{
+		`{"rules":[{"url":"https://pkg.com/all"}]}`,
+		`{"rules":[{"platforms":["palm"],"url":"https://pkg.com/palm"}]}`,
+		`{"rules":[{"platforms":["ios"],"url":"javascript:alert(1)"}]}`,
+	} {
+		req := httptest.NewRequest(http.MethodPut, "/pkg/options", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("setOptionsHandler(%s) status = %v, want %v", body, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
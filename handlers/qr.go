@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/ericfialkowski/shorturl/qr"
+	"github.com/labstack/echo/v5"
+)
+
+const (
+	qrPath string = "/:abv/qr"
+
+	defaultQrSize   = 256
+	minQrSize       = 32
+	maxQrSize       = 2048
+	defaultQrMargin = 4
+	maxQrMargin     = 32
+)
+
+// qrRequest is how a QR code was asked to be drawn
+type qrRequest struct {
+	svg   bool
+	level qr.Level
+	style qr.Style
+}
+
+// SetQrLogo sets the image that can be drawn in the center of QR codes
+func (h *Handlers) SetQrLogo(logo image.Image) {
+	h.qrLogo = logo
+}
+
+// qrHandler draws a QR code of the short link, which is the link on this host rather than the
+// original URL, so scans are counted
+func (h *Handlers) qrHandler(c *echo.Context) error {
+	atomic.AddUint64(&h.metrics.QrCodes, 1)
+	h.recordOtelCounter(c.Request().Context(), "qr")
+
+	abv := abvParam(c)
+	stats, err := h.store(c).GetStats(abv)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting link: %v", err))
+	}
+	if stats.Abbreviation == "" {
+		return c.String(http.StatusNotFound, "No link found")
+	}
+
+	r, err := h.parseQrQuery(c)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	link := fmt.Sprintf("%s://%s%s/%s", c.Scheme(), c.Request().Host, h.prefix, abv)
+	code, err := qr.Encode([]byte(link), r.level)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error encoding QR code: %v", err))
+	}
+
+	var buf bytes.Buffer
+	if r.svg {
+		if err := code.SVG(&buf, r.style); err != nil {
+			return c.String(http.StatusInternalServerError, fmt.Sprintf("Error drawing QR code: %v", err))
+		}
+		return c.Blob(http.StatusOK, "image/svg+xml", buf.Bytes())
+	}
+	if err := code.PNG(&buf, r.style); err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error drawing QR code: %v", err))
+	}
+	return c.Blob(http.StatusOK, "image/png", buf.Bytes())
+}
+
+// parseQrQuery reads the format, size, ecc, margin, fg, bg and logo query parameters. A logo needs
+// level Q or H to stay readable, so it defaults to H.
+func (h *Handlers) parseQrQuery(c *echo.Context) (qrRequest, error) {
+	r := qrRequest{style: qr.Style{Size: defaultQrSize, Margin: defaultQrMargin}}
+
+	switch format := c.QueryParam("format"); format {
+	case "", "png":
+	case "svg":
+		r.svg = true
+	default:
+		return r, fmt.Errorf("unknown format %q, must be png or svg", format)
+	}
+
+	var err error
+	if r.style.Size, err = queryInt(c, "size", defaultQrSize, minQrSize, maxQrSize); err != nil {
+		return r, err
+	}
+	if r.style.Margin, err = queryInt(c, "margin", defaultQrMargin, 0, maxQrMargin); err != nil {
+		return r, err
+	}
+	if r.style.Foreground, err = parseColor(c.QueryParam("fg"), color.Black); err != nil {
+		return r, fmt.Errorf("invalid fg: %v", err)
+	}
+	if r.style.Background, err = parseColor(c.QueryParam("bg"), color.White); err != nil {
+		return r, fmt.Errorf("invalid bg: %v", err)
+	}
+
+	logo := false
+	if s := c.QueryParam("logo"); s != "" {
+		if logo, err = strconv.ParseBool(s); err != nil {
+			return r, fmt.Errorf("invalid logo %q", s)
+		}
+	}
+	if logo {
+		if h.qrLogo == nil {
+			return r, fmt.Errorf("no logo is configured")
+		}
+		r.style.Logo = h.qrLogo
+	}
+
+	ecc := c.QueryParam("ecc")
+	if ecc == "" && logo {
+		ecc = "H"
+	}
+	if r.level, err = qr.ParseLevel(ecc); err != nil {
+		return r, err
+	}
+	if logo && r.level < qr.Q {
+		return r, fmt.Errorf("a logo needs error correction level Q or H")
+	}
+
+	return r, nil
+}
+
+// queryInt reads an integer query parameter between lo and hi
+func queryInt(c *echo.Context, name string, def, lo, hi int) (int, error) {
+	s := c.QueryParam(name)
+	if s == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < lo || n > hi {
+		return 0, fmt.Errorf("%s must be a number from %d to %d", name, lo, hi)
+	}
+	return n, nil
+}
+
+// parseColor reads a hex color as RGB, RGBA, RRGGBB or RRGGBBAA with an optional leading #
+func parseColor(s string, def color.Color) (color.Color, error) {
+	if s == "" {
+		return def, nil
+	}
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 || len(hex) == 4 {
+		var doubled strings.Builder
+		for _, r := range hex {
+			doubled.WriteRune(r)
+			doubled.WriteRune(r)
+		}
+		hex = doubled.String()
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 8 {
+		return nil, fmt.Errorf("%q isn't a hex color", s)
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlers_QrHandler(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+
+	_ = h.dao.Save("qr1", "https://qr.com")
+
+	req := httptest.NewRequest(http.MethodGet, "/qr1/qr?size=300&fg=%23c00&bg=ffffff", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("qrHandler() = %d %s, want a PNG: %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+	img, err := png.Decode(rec.Body)
+	if err != nil {
+		t.Fatalf("qrHandler() isn't a PNG: %v", err)
+	}
+	if img.Bounds().Dx() != 300 {
+		t.Errorf("qrHandler() width = %d, want 300", img.Bounds().Dx())
+	}
+	if got := color.NRGBAModel.Convert(img.At(0, 0)); got != (color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}) {
+		t.Errorf("qrHandler() margin = %v, want white", got)
+	}
+
+	// scanning the code shouldn't count as a hit
+	if stats, _ := h.dao.GetStats("qr1"); stats.Hits != 0 {
+		t.Errorf("qrHandler() counted %d hits", stats.Hits)
+	}
+	if h.metrics.QrCodes != 1 {
+		t.Errorf("metrics.QrCodes = %d, want 1", h.metrics.QrCodes)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/qr1/qr?format=svg&ecc=H&margin=0", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/svg+xml" {
+		t.Fatalf("qrHandler(svg) = %d %s, want an SVG", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if !strings.HasPrefix(rec.Body.String(), "<svg") {
+		t.Errorf("qrHandler(svg) = %s", rec.Body.String())
+	}
+}
+
+func TestHandlers_QrHandler_Logo(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+
+	_ = h.dao.Save("qr1", "https://qr.com")
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/qr1/qr?logo=true", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("qrHandler() without a configured logo = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	h.SetQrLogo(image.NewRGBA(image.Rect(0, 0, 10, 10)))
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/qr1/qr?logo=true&format=svg", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<image") {
+		t.Errorf("qrHandler() with a logo = %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/qr1/qr?logo=true&ecc=L", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("qrHandler() with a logo at level L = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandlers_QrHandler_BadQuery(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+
+	_ = h.dao.Save("qr1", "https://qr.com")
+
+	queries := []string{
+		"format=gif",
+		"size=10",
+		"size=big",
+		"margin=-1",
+		"ecc=X",
+		"fg=red",
+		"bg=%2312345",
+		"logo=maybe",
+	}
+	for _, q := range queries {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/qr1/qr?"+q, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("qrHandler(%s) status = %v, want %v", q, rec.Code, http.StatusBadRequest)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/missing/qr", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("qrHandler(missing) status = %v, want %v", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	tests := map[string]color.NRGBA{
+		"000":       {A: 0xff},
+		"#fff":      {R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+		"#f008":     {R: 0xff, A: 0x88},
+		"1a2b3c":    {R: 0x1a, G: 0x2b, B: 0x3c, A: 0xff},
+		"#1a2b3c00": {R: 0x1a, G: 0x2b, B: 0x3c},
+	}
+	for s, want := range tests {
+		got, err := parseColor(s, color.Black)
+		if err != nil || got != want {
+			t.Errorf("parseColor(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+}
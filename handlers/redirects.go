@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/ericfialkowski/shorturl/tenant"
+)
+
+// redirectReturn is how a link redirects and how long the redirect can be cached
+type redirectReturn struct {
+	Status       int    `json:"status"`
+	CacheControl string `json:"cache_control"`
+	Note         string `json:"note,omitempty"`
+}
+
+// SetRedirects sets the status links redirect with unless they choose their own, and how long browsers and
+// caches can keep permanent redirects
+func (h *Handlers) SetRedirects(status int, maxAge time.Duration) error {
+	if !dao.ValidRedirectStatus(status) {
+		return fmt.Errorf("invalid redirect status %d, want 301, 302, 307 or 308", status)
+	}
+	h.redirectStatus = status
+	h.redirectMaxAge = maxAge
+	return nil
+}
+
+// redirectFor returns how a link of tenant t with options redirects. Temporary redirects aren't cached, so every visit
+// reaches the service and is counted. Permanent ones are, only by browsers when rules or an experiment send
+// visitors to different places, and no longer than until the link expires. Redirects of protected links never are,
+// so a cache can't hand where they lead to visitors who haven't given the password.
+func (h *Handlers) redirectFor(t *tenant.Tenant, options dao.Options, protected bool) redirectReturn {
+	status := cmp.Or(options.Status, t.RedirectStatus, h.redirectStatus, http.StatusFound)
+	r := redirectReturn{Status: status, CacheControl: "no-store"}
+	// caches mustn't keep following a link after it expires
+	maxAge := h.redirectMaxAge
+	if options.Expires != nil {
+		maxAge = min(maxAge, time.Until(*options.Expires).Truncate(time.Second))
+	}
+	if !isPermanent(r.Status) || maxAge < time.Second {
+		return r
+	}
+	if protected {
+		r.Note = "Protected links aren't cached, so every visit needs the password or an unlock cookie"
+		return r
+	}
+
+	scope, by := "public", "Browsers and caches"
+	if len(options.Rules) > 0 || options.Experiment != nil {
+		scope, by = "private", "Browsers"
+	}
+	r.CacheControl = fmt.Sprintf("%s, max-age=%d", scope, int(maxAge.Seconds()))
+	r.Note = fmt.Sprintf("%s keep this permanent redirect for up to %s, so repeat visits in that time aren't counted",
+		by, maxAge)
+	return r
+}
+
+func isPermanent(status int) bool {
+	return status == http.StatusMovedPermanently || status == http.StatusPermanentRedirect
+}
+
+// preservesMethod returns whether clients follow a redirect with status using the method they requested it with
+func preservesMethod(status int) bool {
+	return status == http.StatusTemporaryRedirect || status == http.StatusPermanentRedirect
+}
+
+// linkOptions returns the options of the link stats are for
+func linkOptions(stats dao.ShortUrl) dao.Options {
+	if stats.Options == nil {
+		return dao.Options{}
+	}
+	return *stats.Options
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/ericfialkowski/shorturl/rules"
+	"github.com/ericfialkowski/shorturl/tenant"
+)
+
+func TestHandlers_SetRedirects(t *testing.T) {
+	h, _ := setupTestHandlers()
+	for _, status := range []int{0, http.StatusOK, http.StatusSeeOther} {
+		if err := h.SetRedirects(status, time.Hour); err == nil {
+			t.Errorf("SetRedirects(%d) succeeded, want an error", status)
+		}
+	}
+	if err := h.SetRedirects(http.StatusPermanentRedirect, time.Hour); err != nil {
+		t.Errorf("SetRedirects(308) error = %v", err)
+	}
+}
+
+func TestHandlers_GetHandler_RedirectStatus(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+	_ = h.SetRedirects(http.StatusFound, time.Hour)
+
+	_ = h.dao.Save("temp", "https://temp.com")
+	_ = h.dao.Save("perm", "https://perm.com")
+	_ = h.dao.SetOptions("perm", dao.Options{Status: http.StatusMovedPermanently})
+	_ = h.dao.Save("api", "https://api.com/v2")
+	_ = h.dao.SetOptions("api", dao.Options{Status: http.StatusPermanentRedirect, Passthrough: &dao.Passthrough{Path: true}})
+	_ = h.dao.Save("app", "https://app.com")
+	_ = h.dao.SetOptions("app", dao.Options{Status: http.StatusMovedPermanently,
+		Rules: []rules.Rule{{Platforms: []string{rules.PlatformIOS}, Url: "https://apps.apple.com/app"}}})
+
+	tests := []struct {
+		method       string
+		path         string
+		code         int
+		cacheControl string
+	}{
+		{http.MethodGet, "/temp", http.StatusFound, "no-store"},
+		{http.MethodGet, "/perm", http.StatusMovedPermanently, "public, max-age=3600"},
+		{http.MethodHead, "/perm", http.StatusMovedPermanently, "public, max-age=3600"},
+		{http.MethodGet, "/app", http.StatusMovedPermanently, "private, max-age=3600"},
+		{http.MethodPost, "/api/orders", http.StatusPermanentRedirect, "public, max-age=3600"},
+		{http.MethodPut, "/api", http.StatusPermanentRedirect, "public, max-age=3600"},
+		{http.MethodPost, "/temp", http.StatusMethodNotAllowed, ""},
+		{http.MethodPost, "/perm", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{}`))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		if rec.Code != tt.code || rec.Header().Get("Cache-Control") != tt.cacheControl {
+			t.Errorf("%s %s = %d with Cache-Control %q, want %d with %q", tt.method, tt.path,
+				rec.Code, rec.Header().Get("Cache-Control"), tt.code, tt.cacheControl)
+		}
+	}
+
+	// a protected link isn't cached even for a visitor who unlocked it
+	_ = h.dao.Save("secret", "https://secret.com")
+	_ = h.dao.SetOptions("secret", dao.Options{Status: http.StatusMovedPermanently})
+	_ = h.dao.SetPassword("secret", "hash")
+	unlocked := httptest.NewRecorder()
+	h.unlock.issue(e.NewContext(httptest.NewRequest(http.MethodPost, "/secret/unlock", nil), unlocked), "secret", "hash")
+	req := httptest.NewRequest(http.MethodGet, "/secret", nil)
+	req.AddCookie(unlocked.Result().Cookies()[0])
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("GET /secret unlocked = %d with Cache-Control %q, want an uncached 301", rec.Code, rec.Header().Get("Cache-Control"))
+	}
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/orders", nil))
+	if rec.Header().Get("Location") != "https://api.com/v2/orders" {
+		t.Errorf("POST /api/orders redirected to %q", rec.Header().Get("Location"))
+	}
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/perm/stats", nil))
+	var stats statsReturn
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("statsHandler() returned %s: %v", rec.Body.String(), err)
+	}
+	if stats.Redirect.Status != http.StatusMovedPermanently || !strings.Contains(stats.Redirect.Note, "aren't counted") {
+		t.Errorf("statsHandler().Redirect = %+v, want a permanent redirect with a note", stats.Redirect)
+	}
+}
+
+func TestHandlers_RedirectFor_Default(t *testing.T) {
+	h, _ := setupTestHandlers()
+	if r := h.redirectFor(&tenant.Tenant{}, dao.Options{}, false); r.Status != http.StatusFound || r.CacheControl != "no-store" || r.Note != "" {
+		t.Errorf("redirectFor() without defaults = %+v, want an uncached 302", r)
+	}
+
+	_ = h.SetRedirects(http.StatusMovedPermanently, 0)
+	if r := h.redirectFor(&tenant.Tenant{}, dao.Options{}, false); r.Status != http.StatusMovedPermanently || r.CacheControl != "no-store" {
+		t.Errorf("redirectFor() without caching = %+v, want an uncached 301", r)
+	}
+	if r := h.redirectFor(&tenant.Tenant{}, dao.Options{Status: http.StatusTemporaryRedirect}, false); r.Status != http.StatusTemporaryRedirect {
+		t.Errorf("redirectFor() of a 307 link = %+v, want the link's own status", r)
+	}
+	if r := h.redirectFor(&tenant.Tenant{RedirectStatus: http.StatusTemporaryRedirect}, dao.Options{}, false); r.Status != http.StatusTemporaryRedirect {
+		t.Errorf("redirectFor() of a tenant redirecting with 307 = %+v, want the tenant's status", r)
+	}
+
+	_ = h.SetRedirects(http.StatusMovedPermanently, time.Hour)
+	if r := h.redirectFor(&tenant.Tenant{}, dao.Options{}, true); r.Status != http.StatusMovedPermanently || r.CacheControl != "no-store" {
+		t.Errorf("redirectFor() of a protected link = %+v, want an uncached 301", r)
+	}
+	soon := time.Now().Add(time.Minute)
+	if r := h.redirectFor(&tenant.Tenant{}, dao.Options{Expires: &soon}, false); r.CacheControl == "public, max-age=3600" || !strings.HasPrefix(r.CacheControl, "public, max-age=") {
+		t.Errorf("redirectFor() of a link expiring in a minute = %+v, want it cached until then", r)
+	}
+}
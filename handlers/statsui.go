@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/ericfialkowski/shorturl/charts"
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/ericfialkowski/shorturl/tenant"
+	"github.com/labstack/echo/v5"
+)
+
+const maxChartBars = 20
+
+type (
+	// statsPage is what the stats page shows, with the charts already drawn
+	statsPage struct {
+		statsReturn
+		Prefix        string
+		Brand         tenant.Brand
+		Days          []statsDay
+		SeriesChart   template.HTML
+		HourlyChart   template.HTML
+		HeatmapChart  template.HTML
+		ReferrerChart template.HTML
+		CountryChart  template.HTML
+		RegionChart   template.HTML
+		BotChart      template.HTML
+	}
+
+	statsDay struct {
+		Date    string
+		Hits    int
+		Uniques int64
+	}
+)
+
+var (
+	weekdayLabels = []string{"Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"}
+	hourLabels    = func() []string {
+		labels := make([]string, 24)
+		for i := range labels {
+			labels[i] = fmt.Sprintf("%02d", i)
+		}
+		return labels
+	}()
+)
+
+func (h *Handlers) statsUiHandler(c *echo.Context) error {
+	abv := abvParam(c)
+	t := h.tenantOf(c)
+	store := h.dao.ForDomain(t.Domain)
+	stats, err := store.GetStats(abv)
+
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting stats: %v", err))
+	}
+
+	if stats.Abbreviation == "" {
+		return c.String(http.StatusNotFound, "No link found")
+	}
+	redirect := h.redirectFor(t, linkOptions(stats), stats.Protected)
+	if err := h.hideIfLocked(c, &stats); err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting stats: %v", err))
+	}
+
+	series, err := parseSeriesQuery(c)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	hourly, err := fillSeries(store, abv, &series)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting stats: %v", err))
+	}
+
+	page := newStatsPage(statsReturn{ShortUrl: stats, Redirect: redirect, Series: series}, hourly)
+	page.Brand = t.Brand
+	page.Prefix = h.prefix
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, "stats.html", page); err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error drawing page: %v", err))
+	}
+	return c.HTMLBlob(http.StatusOK, buf.Bytes())
+}
+
+// newStatsPage draws the charts for stats, using the hourly hits its series was built from for the
+// last two days and the hour of the week heatmap
+func newStatsPage(stats statsReturn, hourly map[time.Time]int) statsPage {
+	series := stats.Series
+	loc, _ := time.LoadLocation(series.TimeZone)
+
+	page := statsPage{
+		statsReturn:   stats,
+		SeriesChart:   charts.Line(fmt.Sprintf("Accesses per %s", series.Granularity), seriesPoints(series.Points, series.Granularity)),
+		ReferrerChart: charts.Bars("Referrers", charts.Sorted(stats.ReferrerHits, maxChartBars)),
+		CountryChart:  charts.Bars("Countries", charts.Sorted(stats.CountryHits, maxChartBars)),
+		RegionChart:   charts.Bars("Regions", charts.Sorted(stats.RegionHits, maxChartBars)),
+		BotChart:      charts.Bars("Bots", charts.Sorted(stats.BotFamilies, maxChartBars)),
+	}
+
+	if series.Granularity != dao.Hour {
+		from := series.To.Add(-48 * time.Hour)
+		if from.Before(series.From) {
+			from = series.From
+		}
+		points := dao.BuildSeries(hourly, from, series.To, dao.Hour, loc)
+		page.HourlyChart = charts.Line("Accesses per hour", seriesPoints(points, dao.Hour))
+	}
+
+	totals := dao.HourOfWeek(hourly, loc)
+	values := make([][]int, len(totals))
+	for i := range totals {
+		values[i] = totals[i][:]
+	}
+	page.HeatmapChart = charts.Heatmap(fmt.Sprintf("Accesses by hour of the week (%s)", series.TimeZone),
+		weekdayLabels, hourLabels, values)
+
+	// newest first
+	for _, date := range slices.Backward(slices.Sorted(maps.Keys(stats.DailyHits))) {
+		page.Days = append(page.Days, statsDay{Date: date, Hits: stats.DailyHits[date], Uniques: stats.DailyUniques[date]})
+	}
+
+	return page
+}
+
+// seriesPoints labels the points of a series to suit their granularity
+func seriesPoints(points []dao.SeriesPoint, g dao.Granularity) []charts.Point {
+	layout := time.DateOnly
+	switch g {
+	case dao.Hour:
+		layout = "01-02 15:04"
+	case dao.Month:
+		layout = "2006-01"
+	}
+
+	chartPoints := make([]charts.Point, len(points))
+	for i, p := range points {
+		chartPoints[i] = charts.Point{Label: p.Start.Format(layout), Value: p.Hits}
+	}
+	return chartPoints
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/ericfialkowski/shorturl/rules"
+)
+
+func TestHandlers_StatsUiHandler(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+
+	_ = h.dao.Save("ui1", "https://ui.com")
+	now := time.Now().UTC()
+	_, _ = h.dao.GetUrlWithHit("ui1", dao.Hit{Time: now.AddDate(0, 0, -2), Country: "SE"})
+	for _, referrer := range []string{"https://News.YCombinator.com/item?id=1", "https://news.ycombinator.com/", ""} {
+		req := httptest.NewRequest(http.MethodGet, "/ui1", nil)
+		req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) Firefox/120.0")
+		req.Header.Set("Referer", referrer)
+		e.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	_ = h.dao.SetHealth("ui1", dao.Health{Status: 200, Redirects: []string{"https://www.ui.com/"}, Checked: now})
+	_ = h.dao.SetMetadata("ui1", dao.Metadata{Title: "UI <Home>", Image: "https://ui.com/card.png", Fetched: now})
+	_ = h.dao.SetOptions("ui1", dao.Options{Rules: []rules.Rule{
+		{Platforms: []string{rules.PlatformIOS}, Days: []string{"sat"}, TimeZone: "Europe/Stockholm", Url: "https://apps.apple.com/ui"},
+	}, Experiment: &dao.Experiment{Variants: []dao.Variant{{Name: "v2", Url: "https://ui.com/v2", Weight: 1}}, Winner: "v2"}})
+	_, _ = h.dao.GetUrlWithHit("ui1", dao.Hit{Time: now, Variant: "v2"})
+
+	req := httptest.NewRequest(http.MethodGet, "/ui1/stats/ui", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("statsUiHandler() status = %v, want %v: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	body := rec.Body.String()
+	if strings.Contains(body, "<script") {
+		t.Error("statsUiHandler() page has scripts")
+	}
+	if got := strings.Count(body, "<svg"); got != 5 {
+		t.Errorf("statsUiHandler() has %d charts, want 5", got)
+	}
+	if !strings.Contains(body, "news.ycombinator.com: 2") {
+		t.Error("statsUiHandler() is missing the referrer chart")
+	}
+	if !strings.Contains(body, "Redirects through https://www.ui.com/") {
+		t.Error("statsUiHandler() is missing the destination check")
+	}
+	if !strings.Contains(body, "<h3>UI &lt;Home&gt;</h3>") || !strings.Contains(body, `src="https://ui.com/card.png"`) {
+		t.Error("statsUiHandler() is missing the destination's title and preview")
+	}
+	if !strings.Contains(body, "platform ios, sat Europe/Stockholm goes to") {
+		t.Error("statsUiHandler() is missing the link's rules")
+	}
+	if !strings.Contains(body, "Variant v2 (winner)") || !strings.Contains(body, "weight 1, 1 accesses") {
+		t.Error("statsUiHandler() is missing the link's experiment")
+	}
+
+	// days are listed newest first
+	today, earlier := strings.Index(body, now.Format(time.DateOnly)+"\n"), strings.Index(body, now.AddDate(0, 0, -2).Format(time.DateOnly)+"\n")
+	if today < 0 || earlier < 0 || today > earlier {
+		t.Errorf("statsUiHandler() day rows are out of order (%d, %d)", today, earlier)
+	}
+}
+
+func TestHandlers_StatsUiHandler_NotFound(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/missing/stats/ui", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("statsUiHandler() status = %v, want %v", rec.Code, http.StatusNotFound)
+	}
+}
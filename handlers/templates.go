@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"embed"
+	"html/template"
+)
+
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+// templates holds the HTML pages, parsed once from the files built into the binary
+var templates = template.Must(template.ParseFS(templateFiles, "templates/*.html"))
+
+// staticFiles are the add link page and the icon, built in so the handlers don't depend on the directory
+// they're run from
+//
+//go:embed index.html favicon.ico
+var staticFiles embed.FS
+
+// indexPage is the add link page, a template so each tenant's brand can be shown on it
+var indexPage = template.Must(template.ParseFS(staticFiles, "index.html"))
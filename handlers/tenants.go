@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/ericfialkowski/shorturl/tenant"
+	"github.com/labstack/echo/v5"
+)
+
+// SetTenants sets the domains with their own links and settings. Without them every host shares the same links.
+func (h *Handlers) SetTenants(t *tenant.Tenants) {
+	h.tenants = t
+}
+
+// tenantOf returns the tenant of the host the request was sent to
+func (h *Handlers) tenantOf(c *echo.Context) *tenant.Tenant {
+	return h.tenants.For(c.Request().Host)
+}
+
+// store returns the links of the tenant the request was sent to
+func (h *Handlers) store(c *echo.Context) dao.ShortUrlDao {
+	return h.dao.ForDomain(h.tenantOf(c).Domain)
+}
+
+func (h *Handlers) indexHandler(c *echo.Context) error {
+	var buf bytes.Buffer
+	if err := indexPage.Execute(&buf, h.tenantOf(c).Brand); err != nil {
+		log.Printf("error rendering index page: %v", err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.HTMLBlob(http.StatusOK, buf.Bytes())
+}
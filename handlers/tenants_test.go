@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/ericfialkowski/shorturl/tenant"
+)
+
+func TestHandlers_Tenants(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+	tenants, err := tenant.New([]*tenant.Tenant{{
+		Domain:         "acme.link",
+		Alphabet:       "xyz",
+		KeyLength:      4,
+		RedirectStatus: http.StatusMovedPermanently,
+		Brand:          tenant.Brand{Name: "Acme Links", Color: "#ff0000"},
+	}})
+	if err != nil {
+		t.Fatalf("tenant.New() error = %v", err)
+	}
+	h.SetTenants(tenants)
+
+	_ = h.dao.Save("same", "https://default.com")
+	_ = h.dao.ForDomain("acme.link").Save("same", "https://acme.com")
+
+	tests := []struct {
+		host     string
+		code     int
+		location string
+	}{
+		{"example.com", http.StatusFound, "https://default.com"},
+		{"acme.link", http.StatusMovedPermanently, "https://acme.com"},
+		{"ACME.link:8800", http.StatusMovedPermanently, "https://acme.com"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/same", nil)
+		req.Host = tt.host
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != tt.code || rec.Header().Get("Location") != tt.location {
+			t.Errorf("GET /same on %s = %d %s, want %d %s", tt.host, rec.Code, rec.Header().Get("Location"), tt.code, tt.location)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`"https://new.com"`))
+	req.Host = "acme.link"
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	var result map[string]string
+	_ = json.Unmarshal(rec.Body.Bytes(), &result)
+	if abv := result["abv"]; len(abv) != 4 || strings.Trim(abv, "xyz") != "" {
+		t.Errorf("POST / on acme.link made %q, want 4 characters from the tenant's alphabet", abv)
+	}
+	if u, _ := h.dao.GetUrl(result["abv"]); u != "" {
+		t.Errorf("link made on acme.link is in the default domain")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/same/stats/ui", nil)
+	req.Host = "acme.link"
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if body := rec.Body.String(); !strings.Contains(body, "Acme Links") || !strings.Contains(body, "https://acme.com") {
+		t.Errorf("GET /same/stats/ui on acme.link = %s, want the tenant's brand and link", body)
+	}
+}
+
+func TestHandlers_Tenants_Listings(t *testing.T) {
+	t.Setenv("logrequests", "false")
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+	tenants, err := tenant.New([]*tenant.Tenant{{Domain: "acme.link"}})
+	if err != nil {
+		t.Fatalf("tenant.New() error = %v", err)
+	}
+	h.SetTenants(tenants)
+
+	now := time.Now()
+	for host, d := range map[string]dao.ShortUrlDao{"default.com": h.dao, "acme.com": h.dao.ForDomain("acme.link")} {
+		_ = d.Save("mine", "https://"+host)
+		_, _ = d.GetUrlWithHit("mine", dao.Hit{Time: now})
+		_ = d.SetHealth("mine", dao.Health{Status: http.StatusNotFound, Checked: now, Failures: 1})
+	}
+
+	for _, tt := range []struct{ host, own, other string }{
+		{"example.com", "https://default.com", "https://acme.com"},
+		{"acme.link", "https://acme.com", "https://default.com"},
+	} {
+		for _, path := range []string{"/api/analytics", "/api/links/unhealthy"} {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.Host = tt.host
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if body := rec.Body.String(); rec.Code != http.StatusOK || !strings.Contains(body, tt.own) || strings.Contains(body, tt.other) {
+				t.Errorf("GET %s on %s = %d %s, want only %s", path, tt.host, rec.Code, body, tt.own)
+			}
+		}
+	}
+}
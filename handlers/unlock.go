@@ -0,0 +1,363 @@
+package handlers
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/ericfialkowski/shorturl/env"
+	"github.com/ericfialkowski/shorturl/password"
+	"github.com/labstack/echo/v5"
+)
+
+const (
+	unlockPath   string = "/:abv/unlock"
+	passwordPath string = "/:abv/password"
+
+	unlockCookiePrefix = "shorturl_u_"
+	// most guessers tracked at once, past which the one whose window started first is forgotten
+	maxTrackedAttempts = 10000
+)
+
+type (
+	// unlocker throttles guesses at the passwords of links and signs the cookies that let visitors who
+	// got them right follow the link without typing the password again
+	unlocker struct {
+		key             []byte
+		ttl             time.Duration
+		maxAttempts     int // wrong guesses from one address at one link per window
+		maxLinkAttempts int // wrong guesses from every address at one link per window
+		window          time.Duration
+
+		mu        sync.Mutex
+		byAddress *attemptTable // under the link and the address guessing
+		byLink    *attemptTable // under the link, so guessers can't get more tries by changing addresses
+	}
+
+	// attemptTable tracks the guesses under each key until their window has passed
+	attemptTable struct {
+		attempts map[string]*list.Element // of the *attempts under each key
+		order    list.List                // the attempts, from the one whose window started first
+		limit    int                      // most keys tracked at once, past which the first is forgotten; 0 for no limit
+	}
+
+	// attempts counts the guesses under one key since the window started
+	attempts struct {
+		key   string
+		count int
+		start time.Time
+	}
+
+	// unlockPage is what the password form shown instead of redirecting is filled in with
+	unlockPage struct {
+		Abv    string
+		Action string
+		Next   string
+		Error  string
+	}
+
+	// passwordRequest sets or, when empty, removes the password of a link
+	passwordRequest struct {
+		Password string `json:"password"`
+	}
+
+	passwordReturn struct {
+		Protected bool `json:"protected"`
+	}
+)
+
+// newUnlocker makes an unlocker configured from the environment. Without an unlock_secret cookies are signed
+// with a random key, so they stop working when the service restarts.
+func newUnlocker() *unlocker {
+	key := []byte(env.StringOrDefault("unlock_secret", ""))
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			log.Fatalf("Error making unlock key: %v", err)
+		}
+	}
+	return &unlocker{
+		key:             key,
+		ttl:             env.DurationOrDefault("unlock_ttl", 12*time.Hour),
+		maxAttempts:     env.IntOrDefault("unlock_max_attempts", 5),
+		maxLinkAttempts: env.IntOrDefault("unlock_max_link_attempts", 100),
+		window:          env.DurationOrDefault("unlock_window", 15*time.Minute),
+		byAddress:       newAttemptTable(maxTrackedAttempts),
+		// only protected links are tracked, so there are only as many of them as there are links
+		byLink: newAttemptTable(0),
+	}
+}
+
+func newAttemptTable(limit int) *attemptTable {
+	return &attemptTable{attempts: make(map[string]*list.Element), limit: limit}
+}
+
+// attempt counts a guess from addr at link, returning how long to wait when there have already been too many
+// from addr, or from everyone
+func (u *unlocker) attempt(link, addr string, now time.Time) time.Duration {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	a := u.byAddress.get(link+"\x00"+addr, now, u.window)
+	l := u.byLink.get(link, now, u.window)
+	var wait time.Duration
+	if a.count >= u.maxAttempts {
+		wait = a.start.Add(u.window).Sub(now)
+	}
+	if l.count >= u.maxLinkAttempts {
+		wait = max(wait, l.start.Add(u.window).Sub(now))
+	}
+	if wait > 0 {
+		return wait
+	}
+	a.count++
+	l.count++
+	return 0
+}
+
+// forget clears the guesses from addr at link once it gave the right password, which doesn't count towards the
+// link's either
+func (u *unlocker) forget(link, addr string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if e, ok := u.byAddress.attempts[link+"\x00"+addr]; ok {
+		u.byAddress.remove(e)
+	}
+	if e, ok := u.byLink.attempts[link]; ok && e.Value.(*attempts).count > 0 {
+		e.Value.(*attempts).count--
+	}
+}
+
+// get returns the attempts under key in the window that now is in, starting one when there isn't
+func (t *attemptTable) get(key string, now time.Time, window time.Duration) *attempts {
+	// windows that started first end first, so the expired ones are at the front
+	for e := t.order.Front(); e != nil && now.Sub(e.Value.(*attempts).start) >= window; e = t.order.Front() {
+		t.remove(e)
+	}
+
+	if e, ok := t.attempts[key]; ok {
+		if a := e.Value.(*attempts); now.Sub(a.start) < window {
+			return a
+		}
+		t.remove(e)
+	}
+	if t.limit > 0 && len(t.attempts) >= t.limit {
+		t.remove(t.order.Front())
+	}
+	a := &attempts{key: key, start: now}
+	t.attempts[key] = t.order.PushBack(a)
+	return a
+}
+
+// remove stops tracking the attempts of e
+func (t *attemptTable) remove(e *list.Element) {
+	delete(t.attempts, t.order.Remove(e).(*attempts).key)
+}
+
+// sign returns the signature of a cookie unlocking abv until expiry. The hash is part of it, so changing the
+// password locks out everyone who unlocked the link with the old one.
+func (u *unlocker) sign(abv, hash string, expiry int64) string {
+	mac := hmac.New(sha256.New, u.key)
+	mac.Write([]byte(abv + "\x00" + strconv.FormatInt(expiry, 10) + "\x00" + hash))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// issue sets the cookie that unlocks abv for the visitor
+func (u *unlocker) issue(c *echo.Context, abv, hash string) {
+	expiry := time.Now().Add(u.ttl).Unix()
+	http.SetCookie(c.Response(), &http.Cookie{
+		Name:     linkCookieName(unlockCookiePrefix, abv),
+		Value:    strconv.FormatInt(expiry, 10) + "." + u.sign(abv, hash, expiry),
+		Path:     "/",
+		MaxAge:   int(u.ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// unlocked returns whether the request carries an unexpired cookie unlocking abv with the password hash is of
+func (u *unlocker) unlocked(r *http.Request, abv, hash string) bool {
+	cookie, err := r.Cookie(linkCookieName(unlockCookiePrefix, abv))
+	if err != nil {
+		return false
+	}
+	expires, sig, ok := strings.Cut(cookie.Value, ".")
+	if !ok {
+		return false
+	}
+	expiry, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() >= expiry {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(u.sign(abv, hash, expiry)))
+}
+
+// locked returns whether abv has a password the visitor hasn't unlocked it with, along with its hash
+func (h *Handlers) locked(c *echo.Context, abv string) (bool, string, error) {
+	hash, err := h.store(c).GetPassword(abv)
+	if err != nil || hash == "" {
+		return false, hash, err
+	}
+	return !h.unlock.unlocked(c.Request(), abv, hash), hash, nil
+}
+
+// hideIfLocked clears where a protected link leads from its stats unless the visitor has unlocked it
+func (h *Handlers) hideIfLocked(c *echo.Context, stats *dao.ShortUrl) error {
+	if !stats.Protected {
+		return nil
+	}
+	locked, _, err := h.locked(c, stats.Abbreviation)
+	if err != nil || !locked {
+		return err
+	}
+	stats.Url = ""
+	stats.Options = nil
+	stats.Health = nil
+	stats.Metadata = nil
+	return nil
+}
+
+// hideProtected clears where the protected links of a listing lead, which it shows to anyone
+func hideProtected(links []dao.Link) []dao.Link {
+	for i := range links {
+		if links[i].Protected {
+			links[i].Url = ""
+		}
+	}
+	return links
+}
+
+// hideProtectedCounts clears where the protected links of counts lead, looking each up in its own domain
+func hideProtectedCounts(store dao.ShortUrlDao, counts []dao.LinkCount) error {
+	for i := range counts {
+		hash, err := store.ForDomain(counts[i].Domain).GetPassword(counts[i].Abbreviation)
+		if err != nil {
+			return err
+		}
+		if hash != "" {
+			counts[i].Url = ""
+		}
+	}
+	return nil
+}
+
+// hideLockedHealth clears where the protected links of a health listing lead, and the redirects and errors of
+// their checks that would tell, unless the visitor has unlocked them
+func (h *Handlers) hideLockedHealth(c *echo.Context, links []dao.LinkHealth) error {
+	for i := range links {
+		if !links[i].Protected {
+			continue
+		}
+		hash, err := h.dao.ForDomain(links[i].Domain).GetPassword(links[i].Abbreviation)
+		if err != nil {
+			return err
+		}
+		if !h.unlock.unlocked(c.Request(), links[i].Abbreviation, hash) {
+			links[i].Url = ""
+			links[i].Health.Redirects = nil
+			links[i].Health.Error = ""
+		}
+	}
+	return nil
+}
+
+// unlockFormHandler shows the password form in place of the redirect of a protected link
+func (h *Handlers) unlockFormHandler(c *echo.Context, abv, next, message string) error {
+	page := unlockPage{Abv: abv, Action: h.prefix + "/" + url.PathEscape(abv) + "/unlock", Next: next, Error: message}
+
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, "unlock.html", page); err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error drawing page: %v", err))
+	}
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.HTMLBlob(http.StatusForbidden, buf.Bytes())
+}
+
+// unlockHandler checks the password sent by the form and, when it's right, sets the cookie unlocking the link
+// and goes back to where the visitor was going
+func (h *Handlers) unlockHandler(c *echo.Context) error {
+	abv := abvParam(c)
+	next := localPath(c.FormValue("next"), h.prefix+"/"+url.PathEscape(abv))
+
+	hash, err := h.store(c).GetPassword(abv)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting link: %v", err))
+	}
+	if hash == "" {
+		http.Redirect(c.Response(), c.Request(), next, http.StatusSeeOther)
+		return nil
+	}
+
+	link := h.tenantOf(c).Domain + "\x00" + abv
+	if wait := h.unlock.attempt(link, c.RealIP(), time.Now()); wait > 0 {
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		return c.String(http.StatusTooManyRequests, "Too many attempts, try again later")
+	}
+	if !password.Verify(c.FormValue("password"), hash) {
+		return h.unlockFormHandler(c, abv, next, "That password isn't right")
+	}
+
+	h.unlock.forget(link, c.RealIP())
+	h.unlock.issue(c, abv, hash)
+	http.Redirect(c.Response(), c.Request(), next, http.StatusSeeOther)
+	return nil
+}
+
+// localPath returns next when it's a path on this service, so the form can't send visitors elsewhere, or def
+func localPath(next, def string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return def
+	}
+	u, err := url.Parse(next)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return def
+	}
+	return next
+}
+
+// setPasswordHandler protects a link with a password, or removes its protection when the password is empty
+func (h *Handlers) setPasswordHandler(c *echo.Context) error {
+	atomic.AddUint64(&h.metrics.Options, 1)
+
+	var request passwordRequest
+	decoder := json.NewDecoder(c.Request().Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		return c.String(http.StatusBadRequest, fmt.Sprintf("Error parsing password: %v", err))
+	}
+
+	abv := abvParam(c)
+	stats, err := h.store(c).GetStats(abv)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting link: %v", err))
+	}
+	if stats.Abbreviation == "" {
+		return c.String(http.StatusNotFound, "No link found")
+	}
+
+	hash := ""
+	if request.Password != "" {
+		if hash, err = password.Hash(request.Password); err != nil {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+	}
+	if err := h.store(c).SetPassword(abv, hash); err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error saving password: %v", err))
+	}
+	return c.JSON(http.StatusOK, passwordReturn{Protected: hash != ""})
+}
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/labstack/echo/v5"
+)
+
+func TestHandlers_Unlock(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+	_ = h.dao.Save("docs", "https://internal.example.com/docs")
+
+	setPassword := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/docs/password", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	unlock := func(pw, next string) *httptest.ResponseRecorder {
+		form := url.Values{"password": {pw}, "next": {next}}
+		req := httptest.NewRequest(http.MethodPost, "/docs/unlock", strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	get := func(path string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := setPassword(`{"password": "short"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("setPasswordHandler() of a short password status = %v, want %v", rec.Code, http.StatusBadRequest)
+	}
+	if rec := setPassword(`{"password": "open sesame"}`); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"protected":true`) {
+		t.Fatalf("setPasswordHandler() = %v %s, want the link protected", rec.Code, rec.Body.String())
+	}
+	if hash, _ := h.dao.GetPassword("docs"); strings.Contains(hash, "open sesame") {
+		t.Errorf("GetPassword() = %q, want a hash", hash)
+	}
+
+	rec := get("/docs?page=2", nil)
+	if rec.Code != http.StatusForbidden || rec.Header().Get("Location") != "" || !strings.Contains(rec.Body.String(), `type="password"`) {
+		t.Fatalf("GET /docs = %v to %q, want the unlock form", rec.Code, rec.Header().Get("Location"))
+	}
+	if strings.Contains(rec.Body.String(), "internal.example.com") {
+		t.Error("unlock form shows the destination")
+	}
+
+	var stats statsReturn
+	_ = json.Unmarshal(get("/docs/stats", nil).Body.Bytes(), &stats)
+	if stats.Url != "" || !stats.Protected {
+		t.Errorf("statsHandler() of a locked link = %q, want the destination hidden", stats.Url)
+	}
+	if rec := get("/docs/options", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("optionsHandler() of a locked link status = %v, want %v", rec.Code, http.StatusForbidden)
+	}
+
+	if rec := unlock("wrong password", "/docs"); rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "That password isn") {
+		t.Errorf("unlockHandler() with the wrong password = %v, want the form again", rec.Code)
+	}
+
+	rec = unlock("open sesame", "/docs?page=2")
+	cookies := rec.Result().Cookies()
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/docs?page=2" || len(cookies) != 1 {
+		t.Fatalf("unlockHandler() = %v to %q with cookies %v, want a cookie and the way back", rec.Code, rec.Header().Get("Location"), cookies)
+	}
+	if rec := get("/docs", cookies[0]); rec.Header().Get("Location") != "https://internal.example.com/docs" {
+		t.Errorf("GET /docs with the cookie = %v to %q, want the redirect", rec.Code, rec.Header().Get("Location"))
+	}
+	stats = statsReturn{}
+	_ = json.Unmarshal(get("/docs/stats", cookies[0]).Body.Bytes(), &stats)
+	if stats.Url != "https://internal.example.com/docs" {
+		t.Errorf("statsHandler() of an unlocked link = %q, want the destination", stats.Url)
+	}
+
+	// a tampered cookie, or one for an old password, doesn't unlock it
+	forged := *cookies[0]
+	forged.Value = strings.Replace(forged.Value, ".", "9.", 1)
+	if rec := get("/docs", &forged); rec.Code != http.StatusForbidden {
+		t.Errorf("GET /docs with a tampered cookie status = %v, want %v", rec.Code, http.StatusForbidden)
+	}
+	_ = setPassword(`{"password": "new password"}`)
+	if rec := get("/docs", cookies[0]); rec.Code != http.StatusForbidden {
+		t.Errorf("GET /docs after the password changed status = %v, want %v", rec.Code, http.StatusForbidden)
+	}
+
+	if rec := setPassword(`{"password": ""}`); !strings.Contains(rec.Body.String(), `"protected":false`) {
+		t.Errorf("setPasswordHandler() of no password = %s, want the protection removed", rec.Body.String())
+	}
+	if rec := get("/docs", nil); rec.Code != http.StatusFound {
+		t.Errorf("GET /docs without a password status = %v, want %v", rec.Code, http.StatusFound)
+	}
+}
+
+func TestHandlers_ListsHideProtected(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+	_ = h.dao.Save("docs", "https://internal.example.com/docs")
+	_ = h.dao.SetPassword("docs", "hash")
+	_ = h.dao.AddTags("docs", []string{"internal"})
+	_, _ = h.dao.GetUrlWithHit("docs", dao.Hit{Time: time.Now()})
+	_ = h.dao.SetHealth("docs", dao.Health{
+		Status:    http.StatusNotFound,
+		Redirects: []string{"https://internal.example.com/docs/"},
+		Checked:   time.Now(),
+		Failures:  1,
+	})
+
+	for _, tt := range []struct{ path, listed string }{
+		{"/api/links", `"docs"`},
+		{"/api/tags/internal", `"docs"`},
+		{"/api/tags/internal/stats", `"docs"`},
+		{"/api/analytics", `"docs"`},
+		{"/api/analytics/ui", "/docs/stats/ui"},
+		{"/api/links/unhealthy", `"docs"`},
+	} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), tt.listed) {
+			t.Errorf("GET %s = %d %s, want the link listed", tt.path, rec.Code, rec.Body)
+		}
+		if strings.Contains(rec.Body.String(), "internal.example.com") {
+			t.Errorf("GET %s = %s, want the protected link's url hidden", tt.path, rec.Body)
+		}
+	}
+}
+
+func TestHandlers_Unlock_Throttled(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+	_ = h.dao.Save("docs", "https://internal.example.com/docs")
+	_ = h.dao.SetPassword("docs", "pbkdf2-sha256$1$c2FsdA$a2V5")
+	h.unlock.maxAttempts = 2
+
+	for i, want := range []int{http.StatusForbidden, http.StatusForbidden, http.StatusTooManyRequests} {
+		req := httptest.NewRequest(http.MethodPost, "/docs/unlock", strings.NewReader("password=guess"))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("attempt %d status = %v, want %v", i+1, rec.Code, want)
+		}
+		if want == http.StatusTooManyRequests && rec.Header().Get("Retry-After") == "" {
+			t.Error("throttled attempt has no Retry-After")
+		}
+	}
+}
+
+func TestUnlocker_Attempt(t *testing.T) {
+	u := &unlocker{maxAttempts: 2, maxLinkAttempts: 5, window: time.Minute, byAddress: newAttemptTable(2), byLink: newAttemptTable(0)}
+	now := time.Now()
+	if u.attempt("a", "1", now) != 0 || u.attempt("a", "1", now) != 0 {
+		t.Fatal("attempt() throttled the first attempts")
+	}
+	if wait := u.attempt("a", "1", now.Add(10*time.Second)); wait != 50*time.Second {
+		t.Errorf("attempt() over the limit = %v, want 50s", wait)
+	}
+	if u.attempt("b", "1", now) != 0 || u.attempt("a", "2", now) != 0 {
+		t.Error("attempt() throttled another link or address")
+	}
+	if u.attempt("a", "1", now.Add(time.Minute)) != 0 {
+		t.Error("attempt() throttled after the window passed")
+	}
+	u.attempt("a", "1", now.Add(time.Minute))
+	u.forget("a", "1")
+	if u.attempt("a", "1", now.Add(time.Minute)) != 0 {
+		t.Error("attempt() throttled after forget()")
+	}
+
+	// past the limit the guesser whose window started first is forgotten, and expired ones go as others guess
+	later := now.Add(2 * time.Minute)
+	for _, addr := range []string{"3", "3", "4", "5"} {
+		u.attempt("c", addr, later)
+	}
+	if len(u.byAddress.attempts) != 2 || u.byAddress.order.Len() != 2 || u.byAddress.attempts["c\x003"] != nil {
+		t.Errorf("attempt() tracks %d addresses, want the limit of 2 without 3", len(u.byAddress.attempts))
+	}
+	u.attempt("d", "6", later.Add(time.Minute))
+	if len(u.byAddress.attempts) != 1 || u.byAddress.order.Len() != 1 {
+		t.Errorf("attempt() tracks %d addresses after the others expired, want 1", len(u.byAddress.attempts))
+	}
+
+	// new addresses, or pushing the others out, don't get a link more guesses than its own limit
+	later = later.Add(2 * time.Minute)
+	for i := range 5 {
+		if u.attempt("e", strconv.Itoa(i), later) != 0 {
+			t.Fatalf("attempt() throttled guess %d at a link", i)
+		}
+	}
+	if wait := u.attempt("e", "new", later.Add(20*time.Second)); wait != 40*time.Second {
+		t.Errorf("attempt() over the link's limit = %v, want 40s", wait)
+	}
+	// right passwords don't count towards it
+	u.forget("e", "4")
+	if u.attempt("e", "new", later) != 0 {
+		t.Error("attempt() throttled a link after a right password")
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	tests := []struct {
+		next string
+		want string
+	}{
+		{"/docs?page=2", "/docs?page=2"},
+		{"/team%2Fdocs/intro", "/team%2Fdocs/intro"},
+		{"", "/docs"},
+		{"https://evil.com", "/docs"},
+		{"//evil.com", "/docs"},
+		{"/\\evil.com", "/docs"},
+		{"docs", "/docs"},
+	}
+	for _, tt := range tests {
+		if got := localPath(tt.next, "/docs"); got != tt.want {
+			t.Errorf("localPath(%q) = %q, want %q", tt.next, got, tt.want)
+		}
+	}
+}
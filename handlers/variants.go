@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/ericfialkowski/shorturl/env"
+	"github.com/labstack/echo/v5"
+)
+
+const variantCookiePrefix = "shorturl_v_"
+
+// chooseVariant returns the variant of the experiment on abv that the visitor goes to. It's the winner when
+// there is one, otherwise the one the visitor's cookie names if it still has weight, otherwise a weighted
+// random pick that the cookie then remembers.
+func (h *Handlers) chooseVariant(c *echo.Context, abv string, e *dao.Experiment) dao.Variant {
+	if v, ok := e.Find(e.Winner); ok {
+		return v
+	}
+
+	name := linkCookieName(variantCookiePrefix, abv)
+	if cookie, err := c.Request().Cookie(name); err == nil {
+		if v, ok := e.Find(cookie.Value); ok && v.Weight > 0 {
+			return v
+		}
+	}
+
+	v := pickVariant(e.Variants)
+	http.SetCookie(c.Response(), &http.Cookie{
+		Name:     name,
+		Value:    v.Name,
+		Path:     "/",
+		MaxAge:   int(env.DurationOrDefault("variant_cookie_max_age", 30*24*time.Hour).Seconds()),
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+	return v
+}
+
+// linkCookieName is the name of a cookie about abv. Link names can hold characters cookie names can't, so
+// it's named by a hash of the link's name.
+func linkCookieName(prefix, abv string) string {
+	sum := sha256.Sum256([]byte(abv))
+	return prefix + hex.EncodeToString(sum[:8])
+}
+
+// pickVariant picks one of variants at random in proportion to their weights
+func pickVariant(variants []dao.Variant) dao.Variant {
+	total := 0
+	for _, v := range variants {
+		total += v.Weight
+	}
+	n := rand.IntN(max(total, 1))
+	for _, v := range variants {
+		if n < v.Weight {
+			return v
+		}
+		n -= v.Weight
+	}
+	return variants[len(variants)-1]
+}
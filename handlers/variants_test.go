@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/ericfialkowski/shorturl/rules"
+	"github.com/labstack/echo/v5"
+)
+
+func TestPickVariant(t *testing.T) {
+	variants := []dao.Variant{{Name: "a", Weight: 3}, {Name: "off", Weight: 0}, {Name: "b", Weight: 1}}
+	counts := make(map[string]int)
+	for range 4000 {
+		counts[pickVariant(variants).Name]++
+	}
+	if counts["off"] != 0 {
+		t.Errorf("pickVariant() picked a variant without weight %d times", counts["off"])
+	}
+	if counts["a"] < 2700 || counts["a"] > 3300 {
+		t.Errorf("pickVariant() picked a %d times out of 4000, want about 3000", counts["a"])
+	}
+}
+
+func TestHandlers_GetHandler_Experiment(t *testing.T) {
+	h, e := setupTestHandlers()
+	defer h.dao.Cleanup()
+	_ = h.dao.Save("promo", "https://promo.com/")
+	_ = h.dao.SetOptions("promo", dao.Options{
+		Rules: []rules.Rule{{Platforms: []string{rules.PlatformIOS}, Url: "https://apps.apple.com/promo"}},
+	})
+
+	setExperiment := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/promo/experiment", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	get := func(cookie *http.Cookie, userAgent string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/promo", nil)
+		req.Header.Set("User-Agent", userAgent)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	const desktop = "Mozilla/5.0 (Windows NT 10.0; Win64; x64)"
+
+	rec := setExperiment(`{"variants":[{"name":"a","url":"https://promo.com/a","weight":1},{"name":"b","url":"https://promo.com/b","weight":0}]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("setExperimentHandler() status = %v, want %v: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if options, _ := h.dao.GetOptions("promo"); len(options.Rules) != 1 {
+		t.Errorf("setExperimentHandler() changed the rules to %+v", options.Rules)
+	}
+
+	rec = get(nil, desktop)
+	cookies := rec.Result().Cookies()
+	if rec.Header().Get("Location") != "https://promo.com/a" || len(cookies) != 1 || cookies[0].Value != "a" {
+		t.Fatalf("GET /promo = %q with cookies %v, want variant a remembered", rec.Header().Get("Location"), cookies)
+	}
+	sticky := cookies[0]
+
+	// returning visitors keep their variant
+	_ = setExperiment(`{"variants":[{"name":"a","url":"https://promo.com/a","weight":1},{"name":"b","url":"https://promo.com/b","weight":100}]}`)
+	if rec := get(sticky, desktop); rec.Header().Get("Location") != "https://promo.com/a" || len(rec.Result().Cookies()) != 0 {
+		t.Errorf("GET /promo with a cookie = %q, want the remembered variant a", rec.Header().Get("Location"))
+	}
+
+	// rules come before the experiment
+	if rec := get(nil, "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X)"); rec.Header().Get("Location") != "https://apps.apple.com/promo" {
+		t.Errorf("GET /promo on iOS = %q, want the rule's destination", rec.Header().Get("Location"))
+	}
+
+	// visitors on a variant that lost its weight are moved
+	_ = setExperiment(`{"variants":[{"name":"a","url":"https://promo.com/a","weight":0},{"name":"b","url":"https://promo.com/b","weight":1}]}`)
+	if rec := get(sticky, desktop); rec.Header().Get("Location") != "https://promo.com/b" {
+		t.Errorf("GET /promo after a lost its weight = %q, want variant b", rec.Header().Get("Location"))
+	}
+
+	// everyone goes to the winner
+	_ = setExperiment(`{"variants":[{"name":"a","url":"https://promo.com/a","weight":1},{"name":"b","url":"https://promo.com/b","weight":1}],"winner":"a"}`)
+	for range 5 {
+		if rec := get(nil, desktop); rec.Header().Get("Location") != "https://promo.com/a" {
+			t.Fatalf("GET /promo with winner a = %q", rec.Header().Get("Location"))
+		}
+	}
+
+	stats, _ := h.dao.GetStats("promo")
+	if stats.VariantHits["a"] != 7 || stats.VariantHits["b"] != 1 {
+		t.Errorf("GetStats().VariantHits = %v, want a: 7 and b: 1", stats.VariantHits)
+	}
+
+	tests := []string{
+		`{"variants":[]}`,
+		`{"variants":[{"name":"a.b","url":"https://promo.com/a","weight":1}]}`,
+		`{"variants":[{"name":"a","url":"https://promo.com/a","weight":1},{"name":"a","url":"https://promo.com/b","weight":1}]}`,
+		`{"variants":[{"name":"a","url":"https://promo.com/a","weight":0}]}`,
+		`{"variants":[{"name":"a","url":"https://promo.com/a","weight":1}],"winner":"c"}`,
+		`{"variants":[{"name":"a","url":"ftp://promo.com/a","weight":1}]}`,
+	}
+	for _, body := range tests {
+		if rec := setExperiment(body); rec.Code != http.StatusBadRequest {
+			t.Errorf("setExperimentHandler(%s) status = %v, want %v", body, rec.Code, http.StatusBadRequest)
+		}
+	}
+
+	if rec := setExperiment(`null`); rec.Code != http.StatusOK {
+		t.Errorf("setExperimentHandler(null) status = %v, want %v", rec.Code, http.StatusOK)
+	}
+	if rec := get(nil, desktop); rec.Header().Get("Location") != "https://promo.com/" {
+		t.Errorf("GET /promo after the experiment ended = %q, want the link's own url", rec.Header().Get("Location"))
+	}
+}
@@ -0,0 +1,174 @@
+package hll
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+const (
+	precision = 12 // 4096 registers, ~1.6% standard error
+	registers = 1 << precision
+
+	version     = 1
+	formatDense = 1
+	// sparse sketches store (uint16 index, uint8 value) pairs, which is smaller until a quarter of the registers are set
+	formatSparse    = 2
+	sparseThreshold = registers / 4
+)
+
+// Sketch is a HyperLogLog sketch for approximately counting distinct items. Sketches are mergeable
+// and serialize compactly so they can be stored per link per day. The zero value is an empty sketch.
+type Sketch struct {
+	registers []uint8
+}
+
+// New returns an empty sketch
+func New() *Sketch {
+	return &Sketch{}
+}
+
+// Add adds item to the sketch and reports whether the sketch changed.
+func (s *Sketch) Add(item string) bool {
+	x := hash(item)
+	idx := x >> (64 - precision)
+	rho := uint8(bits.LeadingZeros64(x<<precision|1<<(precision-1)) + 1)
+
+	if s.registers == nil {
+		s.registers = make([]uint8, registers)
+	}
+	if rho > s.registers[idx] {
+		s.registers[idx] = rho
+		return true
+	}
+	return false
+}
+
+// Merge adds all the items in other to s
+func (s *Sketch) Merge(other *Sketch) {
+	if other == nil || other.registers == nil {
+		return
+	}
+	if s.registers == nil {
+		s.registers = make([]uint8, registers)
+	}
+	for i, v := range other.registers {
+		if v > s.registers[i] {
+			s.registers[i] = v
+		}
+	}
+}
+
+// Count returns the estimated number of distinct items added
+func (s *Sketch) Count() int64 {
+	if s == nil || s.registers == nil {
+		return 0
+	}
+
+	sum := 0.0
+	zeros := 0
+	for _, v := range s.registers {
+		sum += 1.0 / float64(uint64(1)<<v)
+		if v == 0 {
+			zeros++
+		}
+	}
+
+	m := float64(registers)
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+
+	// linear counting is more accurate for small cardinalities
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+
+	return int64(estimate + 0.5)
+}
+
+// MarshalBinary encodes the sketch, using a sparse encoding when few registers are set
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	set := 0
+	for _, v := range s.registers {
+		if v != 0 {
+			set++
+		}
+	}
+
+	if set < sparseThreshold {
+		b := make([]byte, 2, 2+set*3)
+		b[0], b[1] = version, formatSparse
+		for i, v := range s.registers {
+			if v != 0 {
+				b = binary.BigEndian.AppendUint16(b, uint16(i))
+				b = append(b, v)
+			}
+		}
+		return b, nil
+	}
+
+	b := make([]byte, 2, 2+registers)
+	b[0], b[1] = version, formatDense
+	return append(b, s.registers...), nil
+}
+
+// UnmarshalBinary decodes a sketch written by MarshalBinary. Empty data is an empty sketch.
+func (s *Sketch) UnmarshalBinary(data []byte) error {
+	s.registers = nil
+	if len(data) == 0 {
+		return nil
+	}
+	if len(data) < 2 || data[0] != version {
+		return errors.New("hll: unsupported sketch encoding")
+	}
+
+	switch data[1] {
+	case formatDense:
+		if len(data) != 2+registers {
+			return errors.New("hll: invalid dense sketch length")
+		}
+		s.registers = append([]uint8(nil), data[2:]...)
+	case formatSparse:
+		pairs := data[2:]
+		if len(pairs)%3 != 0 {
+			return errors.New("hll: invalid sparse sketch length")
+		}
+		s.registers = make([]uint8, registers)
+		for i := 0; i < len(pairs); i += 3 {
+			idx := binary.BigEndian.Uint16(pairs[i:])
+			if int(idx) >= registers {
+				return errors.New("hll: invalid sparse sketch index")
+			}
+			s.registers[idx] = pairs[i+2]
+		}
+	default:
+		return errors.New("hll: unsupported sketch encoding")
+	}
+	return nil
+}
+
+// Parse decodes a sketch written by MarshalBinary
+func Parse(data []byte) (*Sketch, error) {
+	s := New()
+	if err := s.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// hash is a stable 64-bit hash, so sketches written by one process can be merged by another
+func hash(item string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(item))
+	x := h.Sum64()
+
+	// fnv's high bits are poorly distributed for short inputs, so finish with the splitmix64 mixer
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
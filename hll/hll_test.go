@@ -0,0 +1,115 @@
+package hll
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func within(got int64, want int, tolerance float64) bool {
+	return math.Abs(float64(got)-float64(want)) <= float64(want)*tolerance
+}
+
+func TestSketch_Empty(t *testing.T) {
+	var s Sketch
+	if c := s.Count(); c != 0 {
+		t.Errorf("empty Count() = %d, want 0", c)
+	}
+	var nilSketch *Sketch
+	if c := nilSketch.Count(); c != 0 {
+		t.Errorf("nil Count() = %d, want 0", c)
+	}
+}
+
+func TestSketch_Count(t *testing.T) {
+	for _, n := range []int{1, 10, 100, 1000, 10000, 100000} {
+		s := New()
+		for i := range n {
+			s.Add(fmt.Sprintf("visitor-%d", i))
+		}
+		if c := s.Count(); !within(c, n, 0.05) {
+			t.Errorf("Count() after %d distinct adds = %d", n, c)
+		}
+	}
+}
+
+func TestSketch_Duplicates(t *testing.T) {
+	s := New()
+	if !s.Add("same") {
+		t.Error("first Add() should change the sketch")
+	}
+	for range 1000 {
+		if s.Add("same") {
+			t.Error("repeated Add() should not change the sketch")
+		}
+	}
+	if c := s.Count(); c != 1 {
+		t.Errorf("Count() = %d, want 1", c)
+	}
+}
+
+func TestSketch_Merge(t *testing.T) {
+	a, b := New(), New()
+	for i := range 3000 {
+		a.Add(fmt.Sprintf("v%d", i))
+	}
+	for i := 2000; i < 5000; i++ {
+		b.Add(fmt.Sprintf("v%d", i))
+	}
+
+	a.Merge(b)
+	if c := a.Count(); !within(c, 5000, 0.05) {
+		t.Errorf("merged Count() = %d, want ~5000", c)
+	}
+
+	empty := New()
+	empty.Merge(nil)
+	empty.Merge(New())
+	if c := empty.Count(); c != 0 {
+		t.Errorf("Count() after merging empty sketches = %d, want 0", c)
+	}
+}
+
+func TestSketch_MarshalRoundTrip(t *testing.T) {
+	for _, n := range []int{0, 5, 500, 50000} {
+		s := New()
+		for i := range n {
+			s.Add(fmt.Sprintf("visitor-%d", i))
+		}
+
+		b, err := s.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary() error = %v", err)
+		}
+		if n < 100 && len(b) > 2+3*n {
+			t.Errorf("MarshalBinary() of %d items is %d bytes, expected sparse encoding", n, len(b))
+		}
+
+		parsed, err := Parse(b)
+		if err != nil {
+			t.Fatalf("Parse() error = %v", err)
+		}
+		if parsed.Count() != s.Count() {
+			t.Errorf("Parse() Count() = %d, want %d", parsed.Count(), s.Count())
+		}
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, b := range [][]byte{
+		{9, 1},
+		{version, 7},
+		{version, formatDense, 1, 2, 3},
+		{version, formatSparse, 1, 2},
+		{version, formatSparse, 0xff, 0xff, 1},
+	} {
+		if _, err := Parse(b); err == nil {
+			t.Errorf("Parse(%v) returned no error", b)
+		}
+	}
+
+	s, err := Parse(nil)
+	if err != nil || s.Count() != 0 {
+		t.Errorf("Parse(nil) = %v, %v, want empty sketch", s, err)
+	}
+}
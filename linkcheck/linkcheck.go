@@ -0,0 +1,246 @@
+// Package linkcheck checks in the background that the destinations of links still work
+package linkcheck
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/ericfialkowski/shorturl/env"
+	"github.com/ericfialkowski/shorturl/golink"
+	"github.com/ericfialkowski/shorturl/netguard"
+)
+
+const (
+	maxRedirects = 10
+	maxDeadLinks = 100_000
+	userAgent    = "Mozilla/5.0 (compatible; shorturl-linkcheck/1.0)"
+)
+
+// Checker checks the destinations of links that haven't been checked recently and remembers which are dead.
+// A link is dead once it has failed enough checks in a row. A nil Checker is valid and finds nothing dead.
+type Checker struct {
+	dao         dao.ShortUrlDao
+	client      *http.Client
+	concurrency int           // checks run at once
+	hostDelay   time.Duration // least time between requests to the same host
+	deadAfter   int           // consecutive failures before a link is dead
+	maxAge      time.Duration // how long a check is good for
+	batch       int           // most links checked in a run
+
+	mu    sync.Mutex
+	dead  map[string]string    // deadKey of the link -> destination found dead
+	hosts map[string]time.Time // host -> earliest time of its next request
+}
+
+// NewChecker returns a Checker that stores its results in d
+func NewChecker(d dao.ShortUrlDao) *Checker {
+	c := &Checker{
+		dao:         d,
+		concurrency: max(1, env.IntOrDefault("health_check_concurrency", 4)),
+		hostDelay:   env.DurationOrDefault("health_check_host_delay", time.Second),
+		deadAfter:   max(1, env.IntOrDefault("health_check_dead_after", 3)),
+		maxAge:      env.DurationOrDefault("health_check_age", 24*time.Hour),
+		batch:       env.IntOrDefault("health_check_batch", 500),
+		dead:        make(map[string]string),
+		hosts:       make(map[string]time.Time),
+	}
+
+	timeout := env.DurationOrDefault("health_check_timeout", 10*time.Second)
+	c.client = netguard.NewClient(timeout, env.BoolOrDefault("health_check_private", false))
+	// redirects are followed by Check so the chain can be recorded
+	c.client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return c
+}
+
+// Run checks a batch of the links that are due, waiting for them all to finish or ctx to be done.
+// The dead links are reloaded first, so results recorded by other instances are picked up.
+func (c *Checker) Run(ctx context.Context) error {
+	if c == nil {
+		return nil
+	}
+
+	dead, err := c.dao.GetDeadLinks(maxDeadLinks)
+	if err != nil {
+		return fmt.Errorf("error loading dead links: %v", err)
+	}
+	links, err := c.dao.GetLinksToCheck(time.Now().Add(-c.maxAge), c.batch)
+	if err != nil {
+		return fmt.Errorf("error loading links to check: %v", err)
+	}
+
+	c.mu.Lock()
+	clear(c.dead)
+	for _, link := range dead {
+		c.dead[deadKey(link.Domain, link.Abbreviation)] = link.Url
+	}
+	clear(c.hosts)
+	c.mu.Unlock()
+
+	jobs := make(chan dao.LinkHealth)
+	var wg sync.WaitGroup
+	for range c.concurrency {
+		wg.Go(func() {
+			for link := range jobs {
+				c.checkLink(ctx, link)
+			}
+		})
+	}
+send:
+	for _, link := range links {
+		select {
+		case jobs <- link:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if len(links) > 0 {
+		log.Printf("Checked %d link destinations", len(links))
+	}
+	return ctx.Err()
+}
+
+// Dead returns whether the destination u of abv in domain is known to be dead
+func (c *Checker) Dead(domain, abv, u string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.dead[deadKey(domain, abv)] == u
+}
+
+// deadKey is what the dead link abv in domain is remembered under
+func deadKey(domain, abv string) string {
+	return domain + "\x00" + abv
+}
+
+// checkLink checks the destination of link and records the result, counting failures in a row
+func (c *Checker) checkLink(ctx context.Context, link dao.LinkHealth) {
+	// templates are checked up to their first placeholder
+	health := c.Check(ctx, golink.Base(link.Url))
+	if ctx.Err() != nil {
+		return
+	}
+	if health.Error != "" {
+		health.Failures = link.Health.Failures + 1
+		health.Dead = health.Failures >= c.deadAfter
+	}
+
+	if err := c.dao.ForDomain(link.Domain).SetHealth(link.Abbreviation, health); err != nil {
+		log.Printf("Error recording health of %s: %v", link.Abbreviation, err)
+	}
+
+	c.mu.Lock()
+	if health.Dead {
+		c.dead[deadKey(link.Domain, link.Abbreviation)] = link.Url
+	} else {
+		delete(c.dead, deadKey(link.Domain, link.Abbreviation))
+	}
+	c.mu.Unlock()
+}
+
+// Check requests rawURL, following its redirects, and returns how that went. HEAD is tried first, then
+// GET for servers that don't handle HEAD. Error is empty when the destination works. Sites that refuse
+// automated requests with 401, 403 or 429 count as working, since they would likely serve a person.
+func (c *Checker) Check(ctx context.Context, rawURL string) dao.Health {
+	health := dao.Health{Checked: time.Now()}
+
+	target := rawURL
+	for {
+		resp, err := c.request(ctx, http.MethodHead, target)
+		if err == nil && resp.StatusCode >= http.StatusBadRequest {
+			resp, err = c.request(ctx, http.MethodGet, target)
+		}
+		if err != nil {
+			health.Error = err.Error()
+			return health
+		}
+		health.Status = resp.StatusCode
+
+		location := resp.Header.Get("Location")
+		if resp.StatusCode >= 300 && resp.StatusCode < 400 && location != "" {
+			next, err := resp.Request.URL.Parse(location)
+			if err != nil {
+				health.Error = fmt.Sprintf("invalid redirect to %q", location)
+				return health
+			}
+			if len(health.Redirects) == maxRedirects {
+				health.Error = "too many redirects"
+				return health
+			}
+			target = next.String()
+			health.Redirects = append(health.Redirects, target)
+			continue
+		}
+
+		if !working(resp.StatusCode) {
+			health.Error = resp.Status
+		}
+		return health
+	}
+}
+
+func working(status int) bool {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests:
+		return true
+	}
+	return status < http.StatusBadRequest
+}
+
+// request makes a single request once the host is due another, closing the body without reading it
+func (c *Checker) request(ctx context.Context, method, target string) (*http.Response, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("can't check %s URLs", u.Scheme)
+	}
+	if err := c.wait(ctx, u.Hostname()); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	_ = resp.Body.Close()
+	return resp, nil
+}
+
+// wait blocks until host can be sent another request, keeping requests to a host hostDelay apart
+func (c *Checker) wait(ctx context.Context, host string) error {
+	c.mu.Lock()
+	next := time.Now()
+	if due := c.hosts[host]; due.After(next) {
+		next = due
+	}
+	c.hosts[host] = next.Add(c.hostDelay)
+	c.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,151 @@
+package linkcheck
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/ericfialkowski/shorturl/netguard"
+)
+
+func testServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/nohead", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/nohead", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/private", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func testChecker(t *testing.T, d dao.ShortUrlDao) *Checker {
+	t.Setenv("health_check_private", "true")
+	c := NewChecker(d)
+	c.hostDelay = 0
+	return c
+}
+
+func TestChecker_Check(t *testing.T) {
+	server := testServer(t)
+	c := testChecker(t, dao.CreateMemoryDB())
+
+	tests := []struct {
+		path      string
+		status    int
+		redirects []string
+		failed    bool
+	}{
+		{"/ok", http.StatusOK, nil, false},
+		{"/nohead", http.StatusOK, nil, false},
+		{"/moved", http.StatusOK, []string{server.URL + "/nohead"}, false},
+		{"/private", http.StatusForbidden, nil, false},
+		{"/missing", http.StatusNotFound, nil, true},
+		{"/loop", http.StatusFound, nil, true},
+	}
+	for _, tt := range tests {
+		h := c.Check(context.Background(), server.URL+tt.path)
+		if h.Status != tt.status || (h.Error != "") != tt.failed || h.Checked.IsZero() {
+			t.Errorf("Check(%s) = %+v, want status %d and failed %v", tt.path, h, tt.status, tt.failed)
+		}
+		if tt.path != "/loop" && !slices.Equal(h.Redirects, tt.redirects) {
+			t.Errorf("Check(%s).Redirects = %v, want %v", tt.path, h.Redirects, tt.redirects)
+		}
+	}
+	if h := c.Check(context.Background(), server.URL+"/loop"); len(h.Redirects) != maxRedirects {
+		t.Errorf("Check(/loop) followed %d redirects, want %d", len(h.Redirects), maxRedirects)
+	}
+}
+
+func TestChecker_CheckPrivate(t *testing.T) {
+	server := testServer(t)
+	c := NewChecker(dao.CreateMemoryDB())
+
+	h := c.Check(context.Background(), server.URL+"/ok")
+	if !strings.Contains(h.Error, netguard.ErrPrivateAddress.Error()) {
+		t.Errorf("Check() of a loopback address = %+v, want it refused", h)
+	}
+	if h := c.Check(context.Background(), "ftp://example.com/file"); h.Error == "" {
+		t.Errorf("Check() of an ftp URL = %+v, want an error", h)
+	}
+}
+
+func TestChecker_Run(t *testing.T) {
+	server := testServer(t)
+	db := dao.CreateMemoryDB()
+	_ = db.Save("ok", server.URL+"/ok")
+	_ = db.Save("gone", server.URL+"/missing")
+	c := testChecker(t, db)
+	c.deadAfter = 2
+	c.maxAge = 0
+
+	for run := 1; run <= 2; run++ {
+		if err := c.Run(context.Background()); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		if dead := c.Dead("", "gone", server.URL+"/missing"); dead != (run == 2) {
+			t.Errorf("Dead() after run %d = %v, want %v", run, dead, run == 2)
+		}
+	}
+	if c.Dead("", "ok", server.URL+"/ok") {
+		t.Errorf("Dead() = true for a working link")
+	}
+	if c.Dead("", "gone", "https://elsewhere.com") {
+		t.Errorf("Dead() = true for a link that was recreated with another destination")
+	}
+
+	unhealthy, _ := db.GetUnhealthy(10)
+	if len(unhealthy) != 1 || unhealthy[0].Health.Failures != 2 || unhealthy[0].Health.Status != http.StatusNotFound {
+		t.Errorf("GetUnhealthy() = %+v, want gone with 2 failures", unhealthy)
+	}
+
+	// a new checker with nothing due picks up what was recorded
+	fresh := testChecker(t, db)
+	fresh.maxAge = time.Hour
+	if err := fresh.Run(context.Background()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !fresh.Dead("", "gone", server.URL+"/missing") {
+		t.Errorf("Dead() = false on a new checker, want the recorded result")
+	}
+}
+
+func TestChecker_HostDelay(t *testing.T) {
+	server := testServer(t)
+	c := testChecker(t, dao.CreateMemoryDB())
+	c.hostDelay = 50 * time.Millisecond
+
+	start := time.Now()
+	for range 3 {
+		c.Check(context.Background(), server.URL+"/ok")
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("3 requests to one host took %v, want at least 100ms", elapsed)
+	}
+}
+
+func TestChecker_Nil(t *testing.T) {
+	var c *Checker
+	if err := c.Run(context.Background()); err != nil {
+		t.Errorf("Run() error = %v", err)
+	}
+	if c.Dead("", "abc", "https://example.com") {
+		t.Errorf("Dead() = true on nil Checker")
+	}
+}
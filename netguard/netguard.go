@@ -0,0 +1,40 @@
+// Package netguard makes HTTP clients for requesting URLs that people supplied, which mustn't be able to
+// reach the private networks the service runs in
+package netguard
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateAddress is why a connection to a loopback, private or link-local address was refused
+var ErrPrivateAddress = errors.New("destination is a private address")
+
+// NewClient returns a client with timeout that refuses to connect to private addresses unless allowPrivate.
+// Addresses are checked once names are resolved, so names resolving to them are refused too. Proxies aren't
+// used, since the proxy's address would be the one checked.
+func NewClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !allowPrivate {
+		dialer.Control = checkAddress
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+	return &http.Client{Transport: transport, Timeout: timeout}
+}
+
+func checkAddress(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+		return ErrPrivateAddress
+	}
+	return nil
+}
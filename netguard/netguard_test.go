@@ -0,0 +1,42 @@
+package netguard
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	if _, err := NewClient(time.Second, false).Get(server.URL); !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("Get() of a loopback address error = %v, want %v", err, ErrPrivateAddress)
+	}
+	resp, err := NewClient(time.Second, true).Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get() with private addresses allowed error = %v", err)
+	}
+	_ = resp.Body.Close()
+}
+
+func TestCheckAddress(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1:80":       false,
+		"[::1]:443":          false,
+		"10.1.2.3:80":        false,
+		"192.168.0.10:8080":  false,
+		"169.254.169.254:80": false,
+		"0.0.0.0:80":         false,
+		"[fe80::1]:80":       false,
+		"93.184.216.34:443":  true,
+		"[2606:4700::1]:443": true,
+	}
+	for address, allowed := range tests {
+		if err := checkAddress("tcp", address, nil); (err == nil) != allowed {
+			t.Errorf("checkAddress(%s) = %v, want allowed %v", address, err, allowed)
+		}
+	}
+}
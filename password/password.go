@@ -0,0 +1,66 @@
+// Package password hashes the passwords protecting links with PBKDF2, so they aren't stored as they are
+package password
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	algorithm  = "pbkdf2-sha256"
+	iterations = 600000 // what OWASP recommends for PBKDF2 with SHA-256
+	saltLength = 16
+	keyLength  = 32
+
+	MinLength = 8
+	MaxLength = 256
+)
+
+// Hash returns a salted hash of password, encoded along with how it was made as
+// pbkdf2-sha256$<iterations>$<salt>$<key>
+func Hash(password string) (string, error) {
+	if len(password) < MinLength || len(password) > MaxLength {
+		return "", fmt.Errorf("passwords need between %d and %d characters", MinLength, MaxLength)
+	}
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("error making salt: %v", err)
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, keyLength)
+	if err != nil {
+		return "", fmt.Errorf("error hashing password: %v", err)
+	}
+	return strings.Join([]string{algorithm, strconv.Itoa(iterations), encode(salt), encode(key)}, "$"), nil
+}
+
+// Verify returns whether password is the one hash was made from
+func Verify(password, hash string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != algorithm {
+		return false
+	}
+	n, err := strconv.Atoi(parts[1])
+	if err != nil || n < 1 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(want) == 0 {
+		return false
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, n, len(want))
+	return err == nil && subtle.ConstantTimeCompare(key, want) == 1
+}
+
+func encode(b []byte) string {
+	return base64.RawStdEncoding.EncodeToString(b)
+}
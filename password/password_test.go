@@ -0,0 +1,50 @@
+package password
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHashAndVerify(t *testing.T) {
+	hash, err := Hash("correct horse")
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+	if !strings.HasPrefix(hash, "pbkdf2-sha256$600000$") || strings.Contains(hash, "correct horse") {
+		t.Errorf("Hash() = %q, want an encoded PBKDF2 hash", hash)
+	}
+	if !Verify("correct horse", hash) {
+		t.Error("Verify() of the right password = false")
+	}
+	if Verify("correct horsE", hash) {
+		t.Error("Verify() of the wrong password = true")
+	}
+
+	other, _ := Hash("correct horse")
+	if other == hash {
+		t.Error("Hash() gave the same hash twice, want different salts")
+	}
+}
+
+func TestHash_Length(t *testing.T) {
+	for _, pw := range []string{"", "short", strings.Repeat("x", MaxLength+1)} {
+		if _, err := Hash(pw); err == nil {
+			t.Errorf("Hash() of %d characters succeeded, want an error", len(pw))
+		}
+	}
+}
+
+func TestVerify_Malformed(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"plain text",
+		"bcrypt$10$c2FsdA$a2V5",
+		"pbkdf2-sha256$0$c2FsdA$a2V5",
+		"pbkdf2-sha256$1$not base64!$a2V5",
+		"pbkdf2-sha256$1$c2FsdA$",
+	} {
+		if Verify("anything", hash) {
+			t.Errorf("Verify(%q) = true, want false", hash)
+		}
+	}
+}
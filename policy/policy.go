@@ -0,0 +1,219 @@
+// Package policy decides which destinations can be shortened
+package policy
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Codes of the reasons a destination is rejected
+const (
+	CodeInvalid    = "invalid_url"
+	CodeScheme     = "scheme_not_allowed"
+	CodeSelf       = "self_referential"
+	CodeDenied     = "domain_denied"
+	CodeNotAllowed = "domain_not_allowed"
+	CodeShortener  = "known_shortener"
+	CodeThreat     = "known_threat" // on a threat list, which is checked after the policy
+)
+
+// DefaultSchemes are the schemes allowed when none are configured
+const DefaultSchemes = "http,https"
+
+// shorteners are other link shortening services. Shortening their links hides the real destination
+// from the rest of the policy, and can chain back to this service.
+var shorteners = []string{
+	"bit.ly", "bitly.com", "buff.ly", "cutt.ly", "goo.gl", "is.gd", "lnkd.in", "ow.ly", "rb.gy", "rebrand.ly",
+	"s.id", "shorturl.at", "t.co", "t.ly", "tiny.cc", "tinyurl.com", "trib.al", "v.gd",
+}
+
+// Rejection is why a destination isn't allowed
+type Rejection struct {
+	Code   string `json:"code"`
+	Reason string `json:"reason"`
+	Rule   string `json:"rule,omitempty"`
+}
+
+func (r *Rejection) Error() string {
+	return r.Reason
+}
+
+type rule struct {
+	text string
+	re   *regexp.Regexp
+}
+
+// Policy checks destinations against the allowed schemes, allow and deny lists of domains, known
+// shorteners and the hosts of this service. A nil Policy is valid and only applies the defaults.
+type Policy struct {
+	schemes    map[string]bool
+	selfHosts  map[string]bool
+	allow      []rule
+	deny       []rule
+	shorteners []rule
+}
+
+var defaultPolicy = sync.OnceValue(func() *Policy {
+	p, _ := NewPolicy("", "", "")
+	return p
+})
+
+// NewPolicy returns a Policy allowing the comma separated schemes (DefaultSchemes when empty), treating
+// the comma separated selfHosts as names of this service, with the rules in the file at path.
+//
+// Each line of the file is an action, allow, deny or shortener, then whitespace and a pattern for the
+// host. A pattern is a domain, which also matches its subdomains, a domain with * wildcards, or a
+// case-insensitive regular expression between slashes. Blank lines and lines starting with # are ignored.
+// Denied domains are always rejected. When there are allow rules, only domains matching one are accepted,
+// and they're accepted even when they're known shorteners.
+func NewPolicy(path, schemes, selfHosts string) (*Policy, error) {
+	p := &Policy{schemes: make(map[string]bool), selfHosts: make(map[string]bool)}
+
+	if strings.TrimSpace(schemes) == "" {
+		schemes = DefaultSchemes
+	}
+	for s := range strings.SplitSeq(schemes, ",") {
+		if s = strings.ToLower(strings.TrimSpace(s)); s != "" {
+			p.schemes[s] = true
+		}
+	}
+	for h := range strings.SplitSeq(selfHosts, ",") {
+		if h = normalizeHost(h); h != "" {
+			p.selfHosts[h] = true
+		}
+	}
+
+	if path != "" {
+		if err := p.load(path); err != nil {
+			return nil, err
+		}
+		log.Printf("Loaded %d allow, %d deny and %d shortener rules from %s", len(p.allow), len(p.deny), len(p.shorteners), path)
+	}
+
+	for _, s := range shorteners {
+		r, _ := compile(s)
+		p.shorteners = append(p.shorteners, r)
+	}
+	return p, nil
+}
+
+func (p *Policy) load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return fmt.Errorf("%s:%d: expected an action and a pattern", path, n)
+		}
+		r, err := compile(fields[1])
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+
+		switch strings.ToLower(fields[0]) {
+		case "allow":
+			p.allow = append(p.allow, r)
+		case "deny":
+			p.deny = append(p.deny, r)
+		case "shortener":
+			p.shorteners = append(p.shorteners, r)
+		default:
+			return fmt.Errorf("%s:%d: unknown action %q, must be allow, deny or shortener", path, n, fields[0])
+		}
+	}
+	return scanner.Err()
+}
+
+// compile turns a pattern into a regular expression matching whole host names
+func compile(pattern string) (rule, error) {
+	var expr string
+	switch {
+	case len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/"):
+		expr = pattern[1 : len(pattern)-1]
+	case strings.Contains(pattern, "*"):
+		expr = "^" + strings.ReplaceAll(regexp.QuoteMeta(normalizeHost(pattern)), `\*`, ".*") + "$"
+	default:
+		expr = `^(.*\.)?` + regexp.QuoteMeta(normalizeHost(pattern)) + "$"
+	}
+
+	re, err := regexp.Compile("(?i)" + expr)
+	if err != nil {
+		return rule{}, err
+	}
+	return rule{text: pattern, re: re}, nil
+}
+
+// Check returns why u can't be shortened, or nil if it can. requestHost is the host the request to
+// shorten it was made to, which is also treated as this service.
+func (p *Policy) Check(u *url.URL, requestHost string) *Rejection {
+	if p == nil {
+		p = defaultPolicy()
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if !p.schemes[scheme] {
+		return &Rejection{Code: CodeScheme, Reason: fmt.Sprintf("%q URLs can't be shortened", scheme), Rule: scheme}
+	}
+
+	host := normalizeHost(u.Hostname())
+	if host == "" {
+		return &Rejection{Code: CodeInvalid, Reason: "the URL has no host"}
+	}
+
+	if p.selfHosts[host] || host == normalizeHost(stripPort(requestHost)) {
+		return &Rejection{Code: CodeSelf, Reason: "links to this service would redirect in a loop", Rule: host}
+	}
+
+	if r, ok := match(p.deny, host); ok {
+		return &Rejection{Code: CodeDenied, Reason: fmt.Sprintf("links to %s aren't allowed", host), Rule: r.text}
+	}
+
+	if len(p.allow) > 0 {
+		if _, ok := match(p.allow, host); !ok {
+			return &Rejection{Code: CodeNotAllowed, Reason: fmt.Sprintf("%s isn't on the list of allowed domains", host)}
+		}
+		return nil
+	}
+
+	if r, ok := match(p.shorteners, host); ok {
+		return &Rejection{Code: CodeShortener, Reason: fmt.Sprintf("%s is a link shortener, use the destination it links to", host), Rule: r.text}
+	}
+	return nil
+}
+
+func match(rules []rule, host string) (rule, bool) {
+	for _, r := range rules {
+		if r.re.MatchString(host) {
+			return r, true
+		}
+	}
+	return rule{}, false
+}
+
+// normalizeHost lower cases a host name and removes the trailing dot of a fully qualified one
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
+
+func stripPort(hostport string) string {
+	u := url.URL{Host: hostport}
+	return u.Hostname()
+}
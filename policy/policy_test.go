@@ -0,0 +1,124 @@
+package policy
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func check(t *testing.T, p *Policy, destination, requestHost string) string {
+	t.Helper()
+	u, err := url.Parse(destination)
+	if err != nil {
+		t.Fatalf("url.Parse(%q) error = %v", destination, err)
+	}
+	if r := p.Check(u, requestHost); r != nil {
+		return r.Code
+	}
+	return ""
+}
+
+func TestPolicy_Check_Defaults(t *testing.T) {
+	tests := []struct {
+		name        string
+		destination string
+		want        string
+	}{
+		{"https", "https://example.com/page", ""},
+		{"http", "http://example.com", ""},
+		{"javascript", "javascript://example.com/%0Aalert(1)", CodeScheme},
+		{"data", "data:text/html,<script>alert(1)</script>", CodeScheme},
+		{"ftp", "ftp://files.example.com/a.zip", CodeScheme},
+		{"no host", "https:///path", CodeInvalid},
+		{"self", "https://sho.rt/abc", CodeSelf},
+		{"self with port and case", "http://SHO.RT:8800/abc", CodeSelf},
+		{"shortener", "https://bit.ly/xyz", CodeShortener},
+		{"shortener subdomain", "https://www.tinyurl.com/xyz", CodeShortener},
+		{"similar name", "https://notbit.ly/xyz", ""},
+	}
+
+	var p *Policy
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := check(t, p, tt.destination, "sho.rt:8800"); got != tt.want {
+				t.Errorf("Check(%q) = %q, want %q", tt.destination, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPolicy_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.txt")
+	content := "# destinations\n\ndeny *.evil.com\ndeny /^login-.*$/\nshortener go.example.net\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewPolicy(path, "https, mailto", "links.example.org")
+	if err != nil {
+		t.Fatalf("NewPolicy() error = %v", err)
+	}
+
+	tests := map[string]string{
+		"https://example.com":            "",
+		"http://example.com":             CodeScheme,
+		"https://www.evil.com/x":         CodeDenied,
+		"https://evil.com/x":             "",
+		"https://LOGIN-bank.example/":    CodeDenied,
+		"https://go.example.net/x":       CodeShortener,
+		"https://links.example.org/abc":  CodeSelf,
+		"https://links.example.org./abc": CodeSelf,
+	}
+	for destination, want := range tests {
+		if got := check(t, p, destination, "localhost:8800"); got != want {
+			t.Errorf("Check(%q) = %q, want %q", destination, got, want)
+		}
+	}
+}
+
+func TestNewPolicy_AllowList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.txt")
+	content := "allow example.com\nallow bit.ly\ndeny private.example.com\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewPolicy(path, "", "")
+	if err != nil {
+		t.Fatalf("NewPolicy() error = %v", err)
+	}
+
+	tests := map[string]string{
+		"https://example.com":             "",
+		"https://docs.example.com":        "",
+		"https://private.example.com":     CodeDenied,
+		"https://other.com":               CodeNotAllowed,
+		"https://bit.ly/allowed-explicit": "",
+	}
+	for destination, want := range tests {
+		if got := check(t, p, destination, "localhost"); got != want {
+			t.Errorf("Check(%q) = %q, want %q", destination, got, want)
+		}
+	}
+}
+
+func TestNewPolicy_BadFile(t *testing.T) {
+	for name, content := range map[string]string{
+		"missing pattern": "deny\n",
+		"unknown action":  "block evil.com\n",
+		"bad regexp":      "deny /(/\n",
+	} {
+		path := filepath.Join(t.TempDir(), "policy.txt")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewPolicy(path, "", ""); err == nil {
+			t.Errorf("NewPolicy() with %s should fail", name)
+		}
+	}
+
+	if _, err := NewPolicy(filepath.Join(t.TempDir(), "missing.txt"), "", ""); err == nil {
+		t.Error("NewPolicy() with a missing file should fail")
+	}
+}
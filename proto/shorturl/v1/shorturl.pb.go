@@ -0,0 +1,824 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: shorturl/v1/shorturl.proto
+
+package shorturlv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Link is a link's name and where it leads.
+type Link struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	Abbreviation string                 `protobuf:"bytes,1,opt,name=abbreviation,proto3" json:"abbreviation,omitempty"`
+	// Empty for protected links unless their password was given.
+	Url string `protobuf:"bytes,2,opt,name=url,proto3" json:"url,omitempty"`
+	// Whether visitors need a password to follow the link.
+	Protected     bool `protobuf:"varint,3,opt,name=protected,proto3" json:"protected,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Link) Reset() {
+	*x = Link{}
+	mi := &file_shorturl_v1_shorturl_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Link) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Link) ProtoMessage() {}
+
+func (x *Link) ProtoReflect() protoreflect.Message {
+	mi := &file_shorturl_v1_shorturl_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Link.ProtoReflect.Descriptor instead.
+func (*Link) Descriptor() ([]byte, []int) {
+	return file_shorturl_v1_shorturl_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Link) GetAbbreviation() string {
+	if x != nil {
+		return x.Abbreviation
+	}
+	return ""
+}
+
+func (x *Link) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *Link) GetProtected() bool {
+	if x != nil {
+		return x.Protected
+	}
+	return false
+}
+
+type CreateLinkRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Url   string                 `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
+	// The name to give the link, generated when empty.
+	Name          string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateLinkRequest) Reset() {
+	*x = CreateLinkRequest{}
+	mi := &file_shorturl_v1_shorturl_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateLinkRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateLinkRequest) ProtoMessage() {}
+
+func (x *CreateLinkRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_shorturl_v1_shorturl_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateLinkRequest.ProtoReflect.Descriptor instead.
+func (*CreateLinkRequest) Descriptor() ([]byte, []int) {
+	return file_shorturl_v1_shorturl_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *CreateLinkRequest) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *CreateLinkRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type CreateLinkResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Link  *Link                  `protobuf:"bytes,1,opt,name=link,proto3" json:"link,omitempty"`
+	// False when the link already existed.
+	Created       bool `protobuf:"varint,2,opt,name=created,proto3" json:"created,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateLinkResponse) Reset() {
+	*x = CreateLinkResponse{}
+	mi := &file_shorturl_v1_shorturl_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateLinkResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateLinkResponse) ProtoMessage() {}
+
+func (x *CreateLinkResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_shorturl_v1_shorturl_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateLinkResponse.ProtoReflect.Descriptor instead.
+func (*CreateLinkResponse) Descriptor() ([]byte, []int) {
+	return file_shorturl_v1_shorturl_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *CreateLinkResponse) GetLink() *Link {
+	if x != nil {
+		return x.Link
+	}
+	return nil
+}
+
+func (x *CreateLinkResponse) GetCreated() bool {
+	if x != nil {
+		return x.Created
+	}
+	return false
+}
+
+type ResolveLinkRequest struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	Abbreviation string                 `protobuf:"bytes,1,opt,name=abbreviation,proto3" json:"abbreviation,omitempty"`
+	// The password of a protected link, without which its url isn't returned.
+	Password      string `protobuf:"bytes,2,opt,name=password,proto3" json:"password,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResolveLinkRequest) Reset() {
+	*x = ResolveLinkRequest{}
+	mi := &file_shorturl_v1_shorturl_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResolveLinkRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResolveLinkRequest) ProtoMessage() {}
+
+func (x *ResolveLinkRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_shorturl_v1_shorturl_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResolveLinkRequest.ProtoReflect.Descriptor instead.
+func (*ResolveLinkRequest) Descriptor() ([]byte, []int) {
+	return file_shorturl_v1_shorturl_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ResolveLinkRequest) GetAbbreviation() string {
+	if x != nil {
+		return x.Abbreviation
+	}
+	return ""
+}
+
+func (x *ResolveLinkRequest) GetPassword() string {
+	if x != nil {
+		return x.Password
+	}
+	return ""
+}
+
+type ResolveLinkResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Link          *Link                  `protobuf:"bytes,1,opt,name=link,proto3" json:"link,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResolveLinkResponse) Reset() {
+	*x = ResolveLinkResponse{}
+	mi := &file_shorturl_v1_shorturl_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResolveLinkResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResolveLinkResponse) ProtoMessage() {}
+
+func (x *ResolveLinkResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_shorturl_v1_shorturl_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResolveLinkResponse.ProtoReflect.Descriptor instead.
+func (*ResolveLinkResponse) Descriptor() ([]byte, []int) {
+	return file_shorturl_v1_shorturl_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ResolveLinkResponse) GetLink() *Link {
+	if x != nil {
+		return x.Link
+	}
+	return nil
+}
+
+type GetStatsRequest struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	Abbreviation string                 `protobuf:"bytes,1,opt,name=abbreviation,proto3" json:"abbreviation,omitempty"`
+	// The password of a protected link, without which its url isn't returned.
+	Password      string `protobuf:"bytes,2,opt,name=password,proto3" json:"password,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStatsRequest) Reset() {
+	*x = GetStatsRequest{}
+	mi := &file_shorturl_v1_shorturl_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStatsRequest) ProtoMessage() {}
+
+func (x *GetStatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_shorturl_v1_shorturl_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStatsRequest.ProtoReflect.Descriptor instead.
+func (*GetStatsRequest) Descriptor() ([]byte, []int) {
+	return file_shorturl_v1_shorturl_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *GetStatsRequest) GetAbbreviation() string {
+	if x != nil {
+		return x.Abbreviation
+	}
+	return ""
+}
+
+func (x *GetStatsRequest) GetPassword() string {
+	if x != nil {
+		return x.Password
+	}
+	return ""
+}
+
+// Stats are the hits on a link. Hits by day, country and referrer are keyed by UTC date, ISO 3166-1 alpha-2
+// code and host.
+type Stats struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Link  *Link                  `protobuf:"bytes,1,opt,name=link,proto3" json:"link,omitempty"`
+	// The domain the link belongs to, empty for the default one.
+	Domain  string `protobuf:"bytes,2,opt,name=domain,proto3" json:"domain,omitempty"`
+	Hits    int32  `protobuf:"varint,3,opt,name=hits,proto3" json:"hits,omitempty"`
+	BotHits int32  `protobuf:"varint,4,opt,name=bot_hits,json=botHits,proto3" json:"bot_hits,omitempty"`
+	// Approximate number of distinct visitors.
+	Uniques      int64                  `protobuf:"varint,5,opt,name=uniques,proto3" json:"uniques,omitempty"`
+	LastAccess   *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=last_access,json=lastAccess,proto3" json:"last_access,omitempty"`
+	DailyHits    map[string]int32       `protobuf:"bytes,7,rep,name=daily_hits,json=dailyHits,proto3" json:"daily_hits,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	CountryHits  map[string]int32       `protobuf:"bytes,8,rep,name=country_hits,json=countryHits,proto3" json:"country_hits,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	ReferrerHits map[string]int32       `protobuf:"bytes,9,rep,name=referrer_hits,json=referrerHits,proto3" json:"referrer_hits,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	// Why the link no longer redirects, empty while it works.
+	Blocked       string   `protobuf:"bytes,10,opt,name=blocked,proto3" json:"blocked,omitempty"`
+	Tags          []string `protobuf:"bytes,11,rep,name=tags,proto3" json:"tags,omitempty"`
+	Collection    string   `protobuf:"bytes,12,opt,name=collection,proto3" json:"collection,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Stats) Reset() {
+	*x = Stats{}
+	mi := &file_shorturl_v1_shorturl_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Stats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Stats) ProtoMessage() {}
+
+func (x *Stats) ProtoReflect() protoreflect.Message {
+	mi := &file_shorturl_v1_shorturl_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Stats.ProtoReflect.Descriptor instead.
+func (*Stats) Descriptor() ([]byte, []int) {
+	return file_shorturl_v1_shorturl_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Stats) GetLink() *Link {
+	if x != nil {
+		return x.Link
+	}
+	return nil
+}
+
+func (x *Stats) GetDomain() string {
+	if x != nil {
+		return x.Domain
+	}
+	return ""
+}
+
+func (x *Stats) GetHits() int32 {
+	if x != nil {
+		return x.Hits
+	}
+	return 0
+}
+
+func (x *Stats) GetBotHits() int32 {
+	if x != nil {
+		return x.BotHits
+	}
+	return 0
+}
+
+func (x *Stats) GetUniques() int64 {
+	if x != nil {
+		return x.Uniques
+	}
+	return 0
+}
+
+func (x *Stats) GetLastAccess() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastAccess
+	}
+	return nil
+}
+
+func (x *Stats) GetDailyHits() map[string]int32 {
+	if x != nil {
+		return x.DailyHits
+	}
+	return nil
+}
+
+func (x *Stats) GetCountryHits() map[string]int32 {
+	if x != nil {
+		return x.CountryHits
+	}
+	return nil
+}
+
+func (x *Stats) GetReferrerHits() map[string]int32 {
+	if x != nil {
+		return x.ReferrerHits
+	}
+	return nil
+}
+
+func (x *Stats) GetBlocked() string {
+	if x != nil {
+		return x.Blocked
+	}
+	return ""
+}
+
+func (x *Stats) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+func (x *Stats) GetCollection() string {
+	if x != nil {
+		return x.Collection
+	}
+	return ""
+}
+
+type DeleteLinkRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Abbreviation  string                 `protobuf:"bytes,1,opt,name=abbreviation,proto3" json:"abbreviation,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteLinkRequest) Reset() {
+	*x = DeleteLinkRequest{}
+	mi := &file_shorturl_v1_shorturl_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteLinkRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteLinkRequest) ProtoMessage() {}
+
+func (x *DeleteLinkRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_shorturl_v1_shorturl_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteLinkRequest.ProtoReflect.Descriptor instead.
+func (*DeleteLinkRequest) Descriptor() ([]byte, []int) {
+	return file_shorturl_v1_shorturl_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *DeleteLinkRequest) GetAbbreviation() string {
+	if x != nil {
+		return x.Abbreviation
+	}
+	return ""
+}
+
+type DeleteLinkResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteLinkResponse) Reset() {
+	*x = DeleteLinkResponse{}
+	mi := &file_shorturl_v1_shorturl_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteLinkResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteLinkResponse) ProtoMessage() {}
+
+func (x *DeleteLinkResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_shorturl_v1_shorturl_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteLinkResponse.ProtoReflect.Descriptor instead.
+func (*DeleteLinkResponse) Descriptor() ([]byte, []int) {
+	return file_shorturl_v1_shorturl_proto_rawDescGZIP(), []int{8}
+}
+
+type ListLinksRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Lists the links whose names start with prefix, unless tag or collection is set.
+	Prefix     string `protobuf:"bytes,1,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	Tag        string `protobuf:"bytes,2,opt,name=tag,proto3" json:"tag,omitempty"`
+	Collection string `protobuf:"bytes,3,opt,name=collection,proto3" json:"collection,omitempty"`
+	// Most links returned, 100 by default and at most 1000.
+	Limit         int32 `protobuf:"varint,4,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListLinksRequest) Reset() {
+	*x = ListLinksRequest{}
+	mi := &file_shorturl_v1_shorturl_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListLinksRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListLinksRequest) ProtoMessage() {}
+
+func (x *ListLinksRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_shorturl_v1_shorturl_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListLinksRequest.ProtoReflect.Descriptor instead.
+func (*ListLinksRequest) Descriptor() ([]byte, []int) {
+	return file_shorturl_v1_shorturl_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ListLinksRequest) GetPrefix() string {
+	if x != nil {
+		return x.Prefix
+	}
+	return ""
+}
+
+func (x *ListLinksRequest) GetTag() string {
+	if x != nil {
+		return x.Tag
+	}
+	return ""
+}
+
+func (x *ListLinksRequest) GetCollection() string {
+	if x != nil {
+		return x.Collection
+	}
+	return ""
+}
+
+func (x *ListLinksRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type ListLinksResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Links         []*Link                `protobuf:"bytes,1,rep,name=links,proto3" json:"links,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListLinksResponse) Reset() {
+	*x = ListLinksResponse{}
+	mi := &file_shorturl_v1_shorturl_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListLinksResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListLinksResponse) ProtoMessage() {}
+
+func (x *ListLinksResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_shorturl_v1_shorturl_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListLinksResponse.ProtoReflect.Descriptor instead.
+func (*ListLinksResponse) Descriptor() ([]byte, []int) {
+	return file_shorturl_v1_shorturl_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ListLinksResponse) GetLinks() []*Link {
+	if x != nil {
+		return x.Links
+	}
+	return nil
+}
+
+var File_shorturl_v1_shorturl_proto protoreflect.FileDescriptor
+
+const file_shorturl_v1_shorturl_proto_rawDesc = "" +
+	"\n" +
+	"\x1ashorturl/v1/shorturl.proto\x12\vshorturl.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"Z\n" +
+	"\x04Link\x12\"\n" +
+	"\fabbreviation\x18\x01 \x01(\tR\fabbreviation\x12\x10\n" +
+	"\x03url\x18\x02 \x01(\tR\x03url\x12\x1c\n" +
+	"\tprotected\x18\x03 \x01(\bR\tprotected\"9\n" +
+	"\x11CreateLinkRequest\x12\x10\n" +
+	"\x03url\x18\x01 \x01(\tR\x03url\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\"U\n" +
+	"\x12CreateLinkResponse\x12%\n" +
+	"\x04link\x18\x01 \x01(\v2\x11.shorturl.v1.LinkR\x04link\x12\x18\n" +
+	"\acreated\x18\x02 \x01(\bR\acreated\"T\n" +
+	"\x12ResolveLinkRequest\x12\"\n" +
+	"\fabbreviation\x18\x01 \x01(\tR\fabbreviation\x12\x1a\n" +
+	"\bpassword\x18\x02 \x01(\tR\bpassword\"<\n" +
+	"\x13ResolveLinkResponse\x12%\n" +
+	"\x04link\x18\x01 \x01(\v2\x11.shorturl.v1.LinkR\x04link\"Q\n" +
+	"\x0fGetStatsRequest\x12\"\n" +
+	"\fabbreviation\x18\x01 \x01(\tR\fabbreviation\x12\x1a\n" +
+	"\bpassword\x18\x02 \x01(\tR\bpassword\"\xae\x05\n" +
+	"\x05Stats\x12%\n" +
+	"\x04link\x18\x01 \x01(\v2\x11.shorturl.v1.LinkR\x04link\x12\x16\n" +
+	"\x06domain\x18\x02 \x01(\tR\x06domain\x12\x12\n" +
+	"\x04hits\x18\x03 \x01(\x05R\x04hits\x12\x19\n" +
+	"\bbot_hits\x18\x04 \x01(\x05R\abotHits\x12\x18\n" +
+	"\auniques\x18\x05 \x01(\x03R\auniques\x12;\n" +
+	"\vlast_access\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"lastAccess\x12@\n" +
+	"\n" +
+	"daily_hits\x18\a \x03(\v2!.shorturl.v1.Stats.DailyHitsEntryR\tdailyHits\x12F\n" +
+	"\fcountry_hits\x18\b \x03(\v2#.shorturl.v1.Stats.CountryHitsEntryR\vcountryHits\x12I\n" +
+	"\rreferrer_hits\x18\t \x03(\v2$.shorturl.v1.Stats.ReferrerHitsEntryR\freferrerHits\x12\x18\n" +
+	"\ablocked\x18\n" +
+	" \x01(\tR\ablocked\x12\x12\n" +
+	"\x04tags\x18\v \x03(\tR\x04tags\x12\x1e\n" +
+	"\n" +
+	"collection\x18\f \x01(\tR\n" +
+	"collection\x1a<\n" +
+	"\x0eDailyHitsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x05R\x05value:\x028\x01\x1a>\n" +
+	"\x10CountryHitsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x05R\x05value:\x028\x01\x1a?\n" +
+	"\x11ReferrerHitsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x05R\x05value:\x028\x01\"7\n" +
+	"\x11DeleteLinkRequest\x12\"\n" +
+	"\fabbreviation\x18\x01 \x01(\tR\fabbreviation\"\x14\n" +
+	"\x12DeleteLinkResponse\"r\n" +
+	"\x10ListLinksRequest\x12\x16\n" +
+	"\x06prefix\x18\x01 \x01(\tR\x06prefix\x12\x10\n" +
+	"\x03tag\x18\x02 \x01(\tR\x03tag\x12\x1e\n" +
+	"\n" +
+	"collection\x18\x03 \x01(\tR\n" +
+	"collection\x12\x14\n" +
+	"\x05limit\x18\x04 \x01(\x05R\x05limit\"<\n" +
+	"\x11ListLinksResponse\x12'\n" +
+	"\x05links\x18\x01 \x03(\v2\x11.shorturl.v1.LinkR\x05links2\x8b\x03\n" +
+	"\x0fShortUrlService\x12M\n" +
+	"\n" +
+	"CreateLink\x12\x1e.shorturl.v1.CreateLinkRequest\x1a\x1f.shorturl.v1.CreateLinkResponse\x12P\n" +
+	"\vResolveLink\x12\x1f.shorturl.v1.ResolveLinkRequest\x1a .shorturl.v1.ResolveLinkResponse\x12<\n" +
+	"\bGetStats\x12\x1c.shorturl.v1.GetStatsRequest\x1a\x12.shorturl.v1.Stats\x12M\n" +
+	"\n" +
+	"DeleteLink\x12\x1e.shorturl.v1.DeleteLinkRequest\x1a\x1f.shorturl.v1.DeleteLinkResponse\x12J\n" +
+	"\tListLinks\x12\x1d.shorturl.v1.ListLinksRequest\x1a\x1e.shorturl.v1.ListLinksResponseBAZ?github.com/ericfialkowski/shorturl/proto/shorturl/v1;shorturlv1b\x06proto3"
+
+var (
+	file_shorturl_v1_shorturl_proto_rawDescOnce sync.Once
+	file_shorturl_v1_shorturl_proto_rawDescData []byte
+)
+
+func file_shorturl_v1_shorturl_proto_rawDescGZIP() []byte {
+	file_shorturl_v1_shorturl_proto_rawDescOnce.Do(func() {
+		file_shorturl_v1_shorturl_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_shorturl_v1_shorturl_proto_rawDesc), len(file_shorturl_v1_shorturl_proto_rawDesc)))
+	})
+	return file_shorturl_v1_shorturl_proto_rawDescData
+}
+
+var file_shorturl_v1_shorturl_proto_msgTypes = make([]protoimpl.MessageInfo, 14)
+var file_shorturl_v1_shorturl_proto_goTypes = []any{
+	(*Link)(nil),                  // 0: shorturl.v1.Link
+	(*CreateLinkRequest)(nil),     // 1: shorturl.v1.CreateLinkRequest
+	(*CreateLinkResponse)(nil),    // 2: shorturl.v1.CreateLinkResponse
+	(*ResolveLinkRequest)(nil),    // 3: shorturl.v1.ResolveLinkRequest
+	(*ResolveLinkResponse)(nil),   // 4: shorturl.v1.ResolveLinkResponse
+	(*GetStatsRequest)(nil),       // 5: shorturl.v1.GetStatsRequest
+	(*Stats)(nil),                 // 6: shorturl.v1.Stats
+	(*DeleteLinkRequest)(nil),     // 7: shorturl.v1.DeleteLinkRequest
+	(*DeleteLinkResponse)(nil),    // 8: shorturl.v1.DeleteLinkResponse
+	(*ListLinksRequest)(nil),      // 9: shorturl.v1.ListLinksRequest
+	(*ListLinksResponse)(nil),     // 10: shorturl.v1.ListLinksResponse
+	nil,                           // 11: shorturl.v1.Stats.DailyHitsEntry
+	nil,                           // 12: shorturl.v1.Stats.CountryHitsEntry
+	nil,                           // 13: shorturl.v1.Stats.ReferrerHitsEntry
+	(*timestamppb.Timestamp)(nil), // 14: google.protobuf.Timestamp
+}
+var file_shorturl_v1_shorturl_proto_depIdxs = []int32{
+	0,  // 0: shorturl.v1.CreateLinkResponse.link:type_name -> shorturl.v1.Link
+	0,  // 1: shorturl.v1.ResolveLinkResponse.link:type_name -> shorturl.v1.Link
+	0,  // 2: shorturl.v1.Stats.link:type_name -> shorturl.v1.Link
+	14, // 3: shorturl.v1.Stats.last_access:type_name -> google.protobuf.Timestamp
+	11, // 4: shorturl.v1.Stats.daily_hits:type_name -> shorturl.v1.Stats.DailyHitsEntry
+	12, // 5: shorturl.v1.Stats.country_hits:type_name -> shorturl.v1.Stats.CountryHitsEntry
+	13, // 6: shorturl.v1.Stats.referrer_hits:type_name -> shorturl.v1.Stats.ReferrerHitsEntry
+	0,  // 7: shorturl.v1.ListLinksResponse.links:type_name -> shorturl.v1.Link
+	1,  // 8: shorturl.v1.ShortUrlService.CreateLink:input_type -> shorturl.v1.CreateLinkRequest
+	3,  // 9: shorturl.v1.ShortUrlService.ResolveLink:input_type -> shorturl.v1.ResolveLinkRequest
+	5,  // 10: shorturl.v1.ShortUrlService.GetStats:input_type -> shorturl.v1.GetStatsRequest
+	7,  // 11: shorturl.v1.ShortUrlService.DeleteLink:input_type -> shorturl.v1.DeleteLinkRequest
+	9,  // 12: shorturl.v1.ShortUrlService.ListLinks:input_type -> shorturl.v1.ListLinksRequest
+	2,  // 13: shorturl.v1.ShortUrlService.CreateLink:output_type -> shorturl.v1.CreateLinkResponse
+	4,  // 14: shorturl.v1.ShortUrlService.ResolveLink:output_type -> shorturl.v1.ResolveLinkResponse
+	6,  // 15: shorturl.v1.ShortUrlService.GetStats:output_type -> shorturl.v1.Stats
+	8,  // 16: shorturl.v1.ShortUrlService.DeleteLink:output_type -> shorturl.v1.DeleteLinkResponse
+	10, // 17: shorturl.v1.ShortUrlService.ListLinks:output_type -> shorturl.v1.ListLinksResponse
+	13, // [13:18] is the sub-list for method output_type
+	8,  // [8:13] is the sub-list for method input_type
+	8,  // [8:8] is the sub-list for extension type_name
+	8,  // [8:8] is the sub-list for extension extendee
+	0,  // [0:8] is the sub-list for field type_name
+}
+
+func init() { file_shorturl_v1_shorturl_proto_init() }
+func file_shorturl_v1_shorturl_proto_init() {
+	if File_shorturl_v1_shorturl_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_shorturl_v1_shorturl_proto_rawDesc), len(file_shorturl_v1_shorturl_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   14,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_shorturl_v1_shorturl_proto_goTypes,
+		DependencyIndexes: file_shorturl_v1_shorturl_proto_depIdxs,
+		MessageInfos:      file_shorturl_v1_shorturl_proto_msgTypes,
+	}.Build()
+	File_shorturl_v1_shorturl_proto = out.File
+	file_shorturl_v1_shorturl_proto_goTypes = nil
+	file_shorturl_v1_shorturl_proto_depIdxs = nil
+}
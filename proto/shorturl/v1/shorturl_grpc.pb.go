@@ -0,0 +1,289 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.1
+// - protoc             (unknown)
+// source: shorturl/v1/shorturl.proto
+
+package shorturlv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	ShortUrlService_CreateLink_FullMethodName  = "/shorturl.v1.ShortUrlService/CreateLink"
+	ShortUrlService_ResolveLink_FullMethodName = "/shorturl.v1.ShortUrlService/ResolveLink"
+	ShortUrlService_GetStats_FullMethodName    = "/shorturl.v1.ShortUrlService/GetStats"
+	ShortUrlService_DeleteLink_FullMethodName  = "/shorturl.v1.ShortUrlService/DeleteLink"
+	ShortUrlService_ListLinks_FullMethodName   = "/shorturl.v1.ShortUrlService/ListLinks"
+)
+
+// ShortUrlServiceClient is the client API for ShortUrlService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// ShortUrlService creates and looks up the links of the domain named by the :authority of the call, the way
+// the HTTP API uses the Host header.
+type ShortUrlServiceClient interface {
+	// CreateLink makes a link to a url, or returns the one it already has.
+	CreateLink(ctx context.Context, in *CreateLinkRequest, opts ...grpc.CallOption) (*CreateLinkResponse, error)
+	// ResolveLink returns where a link leads, without counting a hit.
+	ResolveLink(ctx context.Context, in *ResolveLinkRequest, opts ...grpc.CallOption) (*ResolveLinkResponse, error)
+	// GetStats returns the hits on a link.
+	GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*Stats, error)
+	// DeleteLink deletes a link.
+	DeleteLink(ctx context.Context, in *DeleteLinkRequest, opts ...grpc.CallOption) (*DeleteLinkResponse, error)
+	// ListLinks lists links by name, or the ones with a tag or in a collection.
+	ListLinks(ctx context.Context, in *ListLinksRequest, opts ...grpc.CallOption) (*ListLinksResponse, error)
+}
+
+type shortUrlServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewShortUrlServiceClient(cc grpc.ClientConnInterface) ShortUrlServiceClient {
+	return &shortUrlServiceClient{cc}
+}
+
+func (c *shortUrlServiceClient) CreateLink(ctx context.Context, in *CreateLinkRequest, opts ...grpc.CallOption) (*CreateLinkResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CreateLinkResponse)
+	err := c.cc.Invoke(ctx, ShortUrlService_CreateLink_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortUrlServiceClient) ResolveLink(ctx context.Context, in *ResolveLinkRequest, opts ...grpc.CallOption) (*ResolveLinkResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ResolveLinkResponse)
+	err := c.cc.Invoke(ctx, ShortUrlService_ResolveLink_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortUrlServiceClient) GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*Stats, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Stats)
+	err := c.cc.Invoke(ctx, ShortUrlService_GetStats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortUrlServiceClient) DeleteLink(ctx context.Context, in *DeleteLinkRequest, opts ...grpc.CallOption) (*DeleteLinkResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteLinkResponse)
+	err := c.cc.Invoke(ctx, ShortUrlService_DeleteLink_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortUrlServiceClient) ListLinks(ctx context.Context, in *ListLinksRequest, opts ...grpc.CallOption) (*ListLinksResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListLinksResponse)
+	err := c.cc.Invoke(ctx, ShortUrlService_ListLinks_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ShortUrlServiceServer is the server API for ShortUrlService service.
+// All implementations must embed UnimplementedShortUrlServiceServer
+// for forward compatibility.
+//
+// ShortUrlService creates and looks up the links of the domain named by the :authority of the call, the way
+// the HTTP API uses the Host header.
+type ShortUrlServiceServer interface {
+	// CreateLink makes a link to a url, or returns the one it already has.
+	CreateLink(context.Context, *CreateLinkRequest) (*CreateLinkResponse, error)
+	// ResolveLink returns where a link leads, without counting a hit.
+	ResolveLink(context.Context, *ResolveLinkRequest) (*ResolveLinkResponse, error)
+	// GetStats returns the hits on a link.
+	GetStats(context.Context, *GetStatsRequest) (*Stats, error)
+	// DeleteLink deletes a link.
+	DeleteLink(context.Context, *DeleteLinkRequest) (*DeleteLinkResponse, error)
+	// ListLinks lists links by name, or the ones with a tag or in a collection.
+	ListLinks(context.Context, *ListLinksRequest) (*ListLinksResponse, error)
+	mustEmbedUnimplementedShortUrlServiceServer()
+}
+
+// UnimplementedShortUrlServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedShortUrlServiceServer struct{}
+
+func (UnimplementedShortUrlServiceServer) CreateLink(context.Context, *CreateLinkRequest) (*CreateLinkResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method CreateLink not implemented")
+}
+func (UnimplementedShortUrlServiceServer) ResolveLink(context.Context, *ResolveLinkRequest) (*ResolveLinkResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ResolveLink not implemented")
+}
+func (UnimplementedShortUrlServiceServer) GetStats(context.Context, *GetStatsRequest) (*Stats, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetStats not implemented")
+}
+func (UnimplementedShortUrlServiceServer) DeleteLink(context.Context, *DeleteLinkRequest) (*DeleteLinkResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method DeleteLink not implemented")
+}
+func (UnimplementedShortUrlServiceServer) ListLinks(context.Context, *ListLinksRequest) (*ListLinksResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListLinks not implemented")
+}
+func (UnimplementedShortUrlServiceServer) mustEmbedUnimplementedShortUrlServiceServer() {}
+func (UnimplementedShortUrlServiceServer) testEmbeddedByValue()                         {}
+
+// UnsafeShortUrlServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ShortUrlServiceServer will
+// result in compilation errors.
+type UnsafeShortUrlServiceServer interface {
+	mustEmbedUnimplementedShortUrlServiceServer()
+}
+
+func RegisterShortUrlServiceServer(s grpc.ServiceRegistrar, srv ShortUrlServiceServer) {
+	// If the following call panics, it indicates UnimplementedShortUrlServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&ShortUrlService_ServiceDesc, srv)
+}
+
+func _ShortUrlService_CreateLink_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateLinkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortUrlServiceServer).CreateLink(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ShortUrlService_CreateLink_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortUrlServiceServer).CreateLink(ctx, req.(*CreateLinkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ShortUrlService_ResolveLink_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResolveLinkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortUrlServiceServer).ResolveLink(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ShortUrlService_ResolveLink_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortUrlServiceServer).ResolveLink(ctx, req.(*ResolveLinkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ShortUrlService_GetStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortUrlServiceServer).GetStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ShortUrlService_GetStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortUrlServiceServer).GetStats(ctx, req.(*GetStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ShortUrlService_DeleteLink_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteLinkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortUrlServiceServer).DeleteLink(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ShortUrlService_DeleteLink_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortUrlServiceServer).DeleteLink(ctx, req.(*DeleteLinkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ShortUrlService_ListLinks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListLinksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortUrlServiceServer).ListLinks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ShortUrlService_ListLinks_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortUrlServiceServer).ListLinks(ctx, req.(*ListLinksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// ShortUrlService_ServiceDesc is the grpc.ServiceDesc for ShortUrlService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ShortUrlService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "shorturl.v1.ShortUrlService",
+	HandlerType: (*ShortUrlServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateLink",
+			Handler:    _ShortUrlService_CreateLink_Handler,
+		},
+		{
+			MethodName: "ResolveLink",
+			Handler:    _ShortUrlService_ResolveLink_Handler,
+		},
+		{
+			MethodName: "GetStats",
+			Handler:    _ShortUrlService_GetStats_Handler,
+		},
+		{
+			MethodName: "DeleteLink",
+			Handler:    _ShortUrlService_DeleteLink_Handler,
+		},
+		{
+			MethodName: "ListLinks",
+			Handler:    _ShortUrlService_ListLinks_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "shorturl/v1/shorturl.proto",
+}
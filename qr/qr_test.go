@@ -0,0 +1,100 @@
+package qr
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	// checked against another encoder, and readable by phone cameras
+	want := []string{
+		"#######...#.#.#...#######",
+		"#.....#.##..##....#.....#",
+		"#.###.#...#.#..#..#.###.#",
+		"#.###.#..###.#....#.###.#",
+		"#.###.#.##.###..#.#.###.#",
+		"#.....#..#.#..###.#.....#",
+		"#######.#.#.#.#.#.#######",
+		".........#..#..#.........",
+		"#.#.#.#...##....#...#..#.",
+		"#....#..##.###..###.....#",
+		"#####.#.#.#...#....#..###",
+		"###.#.....#####.##.#...#.",
+		"...#.##..#....######.#.##",
+		"...##...#.##..#..##..#..#",
+		"#..#####..#..#..##.#..###",
+		".###.#.....#...##.#.#..#.",
+		"#..#..###...#...######...",
+		"........##.###..#...##.##",
+		"#######...###.###.#.##.##",
+		"#.....#..##.###.#...##.#.",
+		"#.###.#.#.##..#.######..#",
+		"#.###.#...##..####.####..",
+		"#.###.#.##...#..#...#...#",
+		"#.....#..#.#....#.#.##.#.",
+		"#######.###.#..##..#...##",
+	}
+
+	c, err := Encode([]byte("https://sho.rt/a"), M)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if c.Version != 2 || c.Size != len(want) {
+		t.Fatalf("Encode() = version %d size %d, want version 2 size %d", c.Version, c.Size, len(want))
+	}
+	for y, row := range want {
+		var got strings.Builder
+		for x := range c.Size {
+			if c.Black(x, y) {
+				got.WriteByte('#')
+			} else {
+				got.WriteByte('.')
+			}
+		}
+		if got.String() != row {
+			t.Errorf("Encode() row %d = %s, want %s", y, got.String(), row)
+		}
+	}
+}
+
+func TestEncode_Versions(t *testing.T) {
+	tests := []struct {
+		length  int
+		level   Level
+		version int
+	}{
+		{17, L, 1},
+		{18, L, 2},
+		{14, M, 1},
+		{7, H, 1},
+		{8, H, 2},
+		{2953, L, 40},
+		{1273, H, 40},
+	}
+	for _, tt := range tests {
+		c, err := Encode(make([]byte, tt.length), tt.level)
+		if err != nil {
+			t.Errorf("Encode(%d bytes, %s) error = %v", tt.length, tt.level, err)
+			continue
+		}
+		if c.Version != tt.version || c.Size != tt.version*4+17 {
+			t.Errorf("Encode(%d bytes, %s) = version %d size %d, want version %d", tt.length, tt.level, c.Version, c.Size, tt.version)
+		}
+	}
+
+	if _, err := Encode(make([]byte, 2954), L); err == nil {
+		t.Error("Encode(2954 bytes, L) should be too long")
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := map[string]Level{"": M, "l": L, "M": M, "q": Q, "H": H}
+	for s, want := range tests {
+		if got, err := ParseLevel(s); err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+	if _, err := ParseLevel("X"); err == nil {
+		t.Error("ParseLevel(X) should fail")
+	}
+}
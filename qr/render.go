@@ -0,0 +1,171 @@
+package qr
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"  // logo formats
+	_ "image/jpeg" // logo formats
+	"image/png"
+	"io"
+	"os"
+	"strings"
+)
+
+// logoShare is the widest the logo can be, as a share of the code's width. It covers under 7% of
+// the modules, which level Q or H can correct.
+const logoShare = 0.25
+
+// Style is how a code is drawn
+type Style struct {
+	Size       int // width and height in pixels, at least one pixel per module
+	Margin     int // quiet zone around the code, in modules
+	Foreground color.Color
+	Background color.Color
+	Logo       image.Image // drawn over the center when set
+}
+
+// LoadLogo reads a PNG, JPEG or GIF image to draw in the center of codes
+func LoadLogo(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open logo %s: %v", path, err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	logo, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode logo %s: %v", path, err)
+	}
+	return logo, nil
+}
+
+// Image draws the code as an image of s.Size pixels square
+func (c *Code) Image(s Style) image.Image {
+	modules := c.Size + 2*s.Margin
+	size := max(s.Size, modules)
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+
+	fg, bg := color.RGBAModel.Convert(s.Foreground), color.RGBAModel.Convert(s.Background)
+	for py := range size {
+		y := py*modules/size - s.Margin
+		for px := range size {
+			x := px*modules/size - s.Margin
+			if c.Black(x, y) {
+				img.Set(px, py, fg)
+			} else {
+				img.Set(px, py, bg)
+			}
+		}
+	}
+
+	if s.Logo != nil {
+		box := c.logoBox(s.Logo.Bounds(), float64(size)/float64(modules), float64(s.Margin))
+		pixels := image.Rect(int(box.x), int(box.y), int(box.x+box.w), int(box.y+box.h))
+		draw.Draw(img, pixels.Inset(-1), image.NewUniform(bg), image.Point{}, draw.Src)
+		draw.Draw(img, pixels, scale(s.Logo, pixels.Dx(), pixels.Dy()), image.Point{}, draw.Over)
+	}
+
+	return img
+}
+
+// PNG writes the code as a PNG image
+func (c *Code) PNG(w io.Writer, s Style) error {
+	return png.Encode(w, c.Image(s))
+}
+
+// SVG writes the code as an SVG image, with the dark modules as a single path
+func (c *Code) SVG(w io.Writer, s Style) error {
+	modules := c.Size + 2*s.Margin
+	size := max(s.Size, modules)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		size, size, modules, modules)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" %s/>`, modules, modules, fill(s.Background))
+
+	b.WriteString(`<path d="`)
+	for y := range c.Size {
+		for x := 0; x < c.Size; x++ {
+			if !c.Black(x, y) {
+				continue
+			}
+			run := 1
+			for c.Black(x+run, y) {
+				run++
+			}
+			fmt.Fprintf(&b, "M%d,%dh%dv1h-%dz", x+s.Margin, y+s.Margin, run, run)
+			x += run
+		}
+	}
+	fmt.Fprintf(&b, `" %s/>`, fill(s.Foreground))
+
+	if s.Logo != nil {
+		var encoded bytes.Buffer
+		if err := png.Encode(&encoded, s.Logo); err != nil {
+			return fmt.Errorf("couldn't encode logo: %v", err)
+		}
+		box := c.logoBox(s.Logo.Bounds(), 1, float64(s.Margin))
+		fmt.Fprintf(&b, `<rect x="%.2f" y="%.2f" width="%.2f" height="%.2f" %s/>`, box.x, box.y, box.w, box.h, fill(s.Background))
+		fmt.Fprintf(&b, `<image x="%.2f" y="%.2f" width="%.2f" height="%.2f" href="data:image/png;base64,%s"/>`,
+			box.x, box.y, box.w, box.h, base64.StdEncoding.EncodeToString(encoded.Bytes()))
+	}
+
+	b.WriteString(`</svg>`)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type rect struct {
+	x, y, w, h float64
+}
+
+// logoBox centers a logo of bounds on the code, keeping its aspect ratio, in units of scale per module
+func (c *Code) logoBox(bounds image.Rectangle, scale, margin float64) rect {
+	side := float64(c.Size) * logoShare
+	w, h := side, side
+	if bounds.Dx() > bounds.Dy() {
+		h = side * float64(bounds.Dy()) / float64(bounds.Dx())
+	} else if bounds.Dy() > bounds.Dx() {
+		w = side * float64(bounds.Dx()) / float64(bounds.Dy())
+	}
+	center := margin + float64(c.Size)/2
+	return rect{x: (center - w/2) * scale, y: (center - h/2) * scale, w: w * scale, h: h * scale}
+}
+
+// scale resizes img to w by h pixels, averaging the source pixels under each one
+func scale(img image.Image, w, h int) image.Image {
+	bounds := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		y0 := bounds.Min.Y + y*bounds.Dy()/h
+		y1 := max(bounds.Min.Y+(y+1)*bounds.Dy()/h, y0+1)
+		for x := range w {
+			x0 := bounds.Min.X + x*bounds.Dx()/w
+			x1 := max(bounds.Min.X+(x+1)*bounds.Dx()/w, x0+1)
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, a, n = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa), n+1
+				}
+			}
+			dst.Set(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)})
+		}
+	}
+	return dst
+}
+
+// fill is the SVG fill attribute for a color
+func fill(c color.Color) string {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	if n.A == 0xff {
+		return fmt.Sprintf(`fill="#%02x%02x%02x"`, n.R, n.G, n.B)
+	}
+	return fmt.Sprintf(`fill="#%02x%02x%02x" fill-opacity="%.3f"`, n.R, n.G, n.B, float64(n.A)/0xff)
+}
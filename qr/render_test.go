@@ -0,0 +1,89 @@
+package qr
+
+import (
+	"bytes"
+	"encoding/xml"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+)
+
+var (
+	red  = color.RGBA{R: 0xff, A: 0xff}
+	blue = color.RGBA{B: 0xff, A: 0xff}
+)
+
+func TestCode_PNG(t *testing.T) {
+	c, _ := Encode([]byte("https://sho.rt/a"), M)
+
+	var buf bytes.Buffer
+	if err := c.PNG(&buf, Style{Size: 290, Margin: 4, Foreground: red, Background: blue}); err != nil {
+		t.Fatalf("PNG() error = %v", err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("PNG() isn't a PNG: %v", err)
+	}
+
+	// 33 modules with the margin, so each is 8 or 9 pixels
+	if img.Bounds() != image.Rect(0, 0, 290, 290) {
+		t.Errorf("PNG() bounds = %v, want 290x290", img.Bounds())
+	}
+	if got := color.RGBAModel.Convert(img.At(0, 0)); got != blue {
+		t.Errorf("PNG() margin = %v, want the background", got)
+	}
+	if got := color.RGBAModel.Convert(img.At(40, 40)); got != red {
+		t.Errorf("PNG() finder corner = %v, want the foreground", got)
+	}
+}
+
+func TestCode_PNG_Logo(t *testing.T) {
+	c, _ := Encode([]byte("https://sho.rt/a"), H)
+	green := color.RGBA{G: 0xff, A: 0xff}
+	logo := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	draw.Draw(logo, logo.Bounds(), image.NewUniform(green), image.Point{}, draw.Src)
+
+	img := c.Image(Style{Size: 300, Margin: 0, Foreground: color.Black, Background: color.White, Logo: logo})
+	if got := color.RGBAModel.Convert(img.At(150, 150)); got != green {
+		t.Errorf("Image() center = %v, want the logo", got)
+	}
+}
+
+func TestCode_SVG(t *testing.T) {
+	c, _ := Encode([]byte("https://sho.rt/a"), M)
+	logo := image.NewRGBA(image.Rect(0, 0, 4, 2))
+
+	var buf bytes.Buffer
+	err := c.SVG(&buf, Style{Size: 200, Margin: 2, Foreground: color.Black, Background: color.Transparent, Logo: logo})
+	if err != nil {
+		t.Fatalf("SVG() error = %v", err)
+	}
+	svg := buf.String()
+
+	counts := make(map[string]int)
+	decoder := xml.NewDecoder(strings.NewReader(svg))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("SVG() is invalid: %v", err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			counts[start.Name.Local]++
+		}
+	}
+	if counts["path"] != 1 || counts["image"] != 1 {
+		t.Errorf("SVG() has %v, want a path and a logo", counts)
+	}
+	for _, want := range []string{`viewBox="0 0 29 29"`, `width="200"`, `M2,2h7v1h-7z`, `fill-opacity="0.000"`} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("SVG() is missing %s", want)
+		}
+	}
+}
@@ -6,14 +6,20 @@ import (
 	"time"
 )
 
-const chars string = "abcdefghijklmnopqrstuvwxyz0123456789"
+// Chars are the characters random strings are made of unless another alphabet is given
+const Chars string = "abcdefghijklmnopqrstuvwxyz0123456789"
 
 var r = rand.New(rand.NewSource(time.Now().UnixNano()))
 
 func RandStrn(length int) string {
+	return RandStrnFrom(Chars, length)
+}
+
+// RandStrnFrom returns a random string of length bytes from alphabet, which must be ASCII
+func RandStrnFrom(alphabet string, length int) string {
 	var b strings.Builder
 	for range length {
-		b.WriteByte(chars[r.Intn(len(chars))])
+		b.WriteByte(alphabet[r.Intn(len(alphabet))])
 	}
 	return b.String()
 }
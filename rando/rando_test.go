@@ -68,3 +68,12 @@ func BenchmarkRandStrn(b *testing.B) {
 		RandStrn(10)
 	}
 }
+
+func TestRandStrnFrom(t *testing.T) {
+	for range 100 {
+		result := RandStrnFrom("AB", 8)
+		if len(result) != 8 || strings.Trim(result, "AB") != "" {
+			t.Errorf("RandStrnFrom(\"AB\", 8) = %q, want 8 of A and B", result)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+// Package rules decides where a link sends a visitor from their device, language, country and the time,
+// so one link can lead to an app store on phones and a website on desktops
+package rules
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Platforms a rule can match. Mobile and desktop match any of the platforms in them.
+const (
+	PlatformIOS      = "ios"
+	PlatformAndroid  = "android"
+	PlatformWindows  = "windows"
+	PlatformMacOS    = "macos"
+	PlatformLinux    = "linux"
+	PlatformChromeOS = "chromeos"
+	PlatformOther    = "other"
+	PlatformMobile   = "mobile"
+	PlatformDesktop  = "desktop"
+
+	MaxRules   = 50
+	timeLayout = "15:04"
+)
+
+var (
+	platforms = []string{PlatformIOS, PlatformAndroid, PlatformWindows, PlatformMacOS, PlatformLinux, PlatformChromeOS,
+		PlatformOther, PlatformMobile, PlatformDesktop}
+	days = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+	locations sync.Map // time zone name -> *time.Location, since loading one reads the zone database
+)
+
+// Rule sends visitors that meet all of its conditions to Url. Conditions that are left empty match
+// everyone, and a list matches when any of its values do.
+type Rule struct {
+	Platforms []string `json:"platforms,omitempty" bson:"platforms,omitempty"`
+	Languages []string `json:"languages,omitempty" bson:"languages,omitempty"` // matched against the preferred language, "en" matches "en-GB"
+	Countries []string `json:"countries,omitempty" bson:"countries,omitempty"` // ISO 3166-1 alpha-2 codes
+	Days      []string `json:"days,omitempty" bson:"days,omitempty"`           // sun, mon, tue, wed, thu, fri or sat
+	From      string   `json:"from,omitempty" bson:"from,omitempty"`           // start of a daily window, like 09:00
+	To        string   `json:"to,omitempty" bson:"to,omitempty"`               // end of the window, which can be past midnight
+	TimeZone  string   `json:"tz,omitempty" bson:"tz,omitempty"`               // IANA zone of the days and window, UTC by default
+	Url       string   `json:"url" bson:"url"`
+}
+
+// Visitor is what rules are matched against
+type Visitor struct {
+	Platform string
+	Language string // preferred language tag, lower case
+	Country  string
+	Time     time.Time
+}
+
+// NewVisitor describes whoever made r, who was located in country
+func NewVisitor(r *http.Request, country string) Visitor {
+	return Visitor{
+		Platform: Platform(r.UserAgent()),
+		Language: PreferredLanguage(r.Header.Get("Accept-Language")),
+		Country:  country,
+		Time:     time.Now(),
+	}
+}
+
+// Match returns the url of the first of rules that v meets, and whether there was one
+func Match(rules []Rule, v Visitor) (string, bool) {
+	for _, rule := range rules {
+		if rule.matches(v) {
+			return rule.Url, true
+		}
+	}
+	return "", false
+}
+
+// Conditions describes what a visitor needs to meet r, like "platform ios, language fr or de"
+func (r Rule) Conditions() string {
+	var conditions []string
+	if len(r.Platforms) > 0 {
+		conditions = append(conditions, "platform "+strings.Join(r.Platforms, " or "))
+	}
+	if len(r.Languages) > 0 {
+		conditions = append(conditions, "language "+strings.Join(r.Languages, " or "))
+	}
+	if len(r.Countries) > 0 {
+		conditions = append(conditions, "country "+strings.Join(r.Countries, " or "))
+	}
+	if len(r.Days) > 0 {
+		conditions = append(conditions, strings.Join(r.Days, " or "))
+	}
+	if r.From != "" {
+		conditions = append(conditions, r.From+" to "+r.To)
+	}
+	if r.TimeZone != "" && (len(r.Days) > 0 || r.From != "") {
+		conditions[len(conditions)-1] += " " + r.TimeZone
+	}
+	return strings.Join(conditions, ", ")
+}
+
+func (r Rule) matches(v Visitor) bool {
+	if len(r.Platforms) > 0 && !slices.ContainsFunc(r.Platforms, func(p string) bool { return platformMatches(p, v.Platform) }) {
+		return false
+	}
+	if len(r.Languages) > 0 && !slices.ContainsFunc(r.Languages, func(l string) bool { return languageMatches(l, v.Language) }) {
+		return false
+	}
+	if len(r.Countries) > 0 && !slices.ContainsFunc(r.Countries, func(c string) bool { return strings.EqualFold(c, v.Country) }) {
+		return false
+	}
+	if len(r.Days) == 0 && r.From == "" {
+		return true
+	}
+
+	t := v.Time.In(location(r.TimeZone))
+	if len(r.Days) > 0 && !slices.Contains(r.Days, days[t.Weekday()]) {
+		return false
+	}
+	if r.From != "" {
+		from, _ := time.Parse(timeLayout, r.From)
+		to, _ := time.Parse(timeLayout, r.To)
+		start, end, now := minutes(from), minutes(to), t.Hour()*60+t.Minute()
+		if start <= end {
+			return start <= now && now < end
+		}
+		return now >= start || now < end
+	}
+	return true
+}
+
+func platformMatches(want, platform string) bool {
+	switch want {
+	case PlatformMobile:
+		return platform == PlatformIOS || platform == PlatformAndroid
+	case PlatformDesktop:
+		return platform == PlatformWindows || platform == PlatformMacOS || platform == PlatformLinux || platform == PlatformChromeOS
+	}
+	return want == platform
+}
+
+func languageMatches(want, language string) bool {
+	want = strings.ToLower(want)
+	return language == want || strings.HasPrefix(language, want+"-")
+}
+
+func minutes(t time.Time) int {
+	return t.Hour()*60 + t.Minute()
+}
+
+func location(name string) *time.Location {
+	if name == "" {
+		return time.UTC
+	}
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	locations.Store(name, loc)
+	return loc
+}
+
+// Platform returns the platform a user agent is on. iPads asking for desktop sites can't be told from Macs.
+func Platform(userAgent string) string {
+	switch {
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"), strings.Contains(userAgent, "iPod"):
+		return PlatformIOS
+	case strings.Contains(userAgent, "Android"):
+		return PlatformAndroid
+	case strings.Contains(userAgent, "CrOS"):
+		return PlatformChromeOS
+	case strings.Contains(userAgent, "Windows"):
+		return PlatformWindows
+	case strings.Contains(userAgent, "Macintosh"), strings.Contains(userAgent, "Mac OS X"):
+		return PlatformMacOS
+	case strings.Contains(userAgent, "Linux"), strings.Contains(userAgent, "X11"):
+		return PlatformLinux
+	}
+	return PlatformOther
+}
+
+// PreferredLanguage returns the language tag of an Accept-Language header with the highest weight, lower
+// cased, or empty when there isn't one
+func PreferredLanguage(acceptLanguage string) string {
+	type weighted struct {
+		tag    string
+		weight float64
+	}
+	var languages []weighted
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		weight := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if w, err := strconv.ParseFloat(q, 64); err == nil {
+				weight = w
+			}
+		}
+		if weight > 0 {
+			languages = append(languages, weighted{tag, weight})
+		}
+	}
+	if len(languages) == 0 {
+		return ""
+	}
+	// ties keep the order they were listed in
+	sort.SliceStable(languages, func(i, j int) bool { return languages[i].weight > languages[j].weight })
+	return languages[0].tag
+}
+
+// Validate returns why rules can't be used, or nil if they can
+func Validate(rules []Rule) error {
+	if len(rules) > MaxRules {
+		return fmt.Errorf("more than %d rules", MaxRules)
+	}
+	for i, r := range rules {
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("rule %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (r Rule) validate() error {
+	u, err := url.ParseRequestURI(r.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("invalid url %q", r.Url)
+	}
+	if len(r.Platforms) == 0 && len(r.Languages) == 0 && len(r.Countries) == 0 && len(r.Days) == 0 && r.From == "" {
+		return fmt.Errorf("no conditions, the link's own url is where everyone else goes")
+	}
+	for _, p := range r.Platforms {
+		if !slices.Contains(platforms, p) {
+			return fmt.Errorf("unknown platform %q, want one of %s", p, strings.Join(platforms, ", "))
+		}
+	}
+	for _, l := range r.Languages {
+		if l == "" || strings.ContainsAny(l, " ,;*") {
+			return fmt.Errorf("invalid language %q", l)
+		}
+	}
+	for _, c := range r.Countries {
+		if len(c) != 2 {
+			return fmt.Errorf("invalid country %q, want a two letter code", c)
+		}
+	}
+	for _, d := range r.Days {
+		if !slices.Contains(days, d) {
+			return fmt.Errorf("unknown day %q, want one of %s", d, strings.Join(days, ", "))
+		}
+	}
+	if (r.From == "") != (r.To == "") {
+		return fmt.Errorf("from and to go together")
+	}
+	if r.From != "" {
+		if _, err := time.Parse(timeLayout, r.From); err != nil {
+			return fmt.Errorf("invalid from %q, want a time like 09:00", r.From)
+		}
+		if _, err := time.Parse(timeLayout, r.To); err != nil {
+			return fmt.Errorf("invalid to %q, want a time like 17:30", r.To)
+		}
+	}
+	if r.TimeZone != "" {
+		if _, err := time.LoadLocation(r.TimeZone); err != nil {
+			return fmt.Errorf("unknown time zone %q", r.TimeZone)
+		}
+	}
+	return nil
+}
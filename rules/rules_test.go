@@ -0,0 +1,134 @@
+package rules
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const (
+	iPhone  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1"
+	android = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0 Mobile Safari/537.36"
+	windows = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0 Safari/537.36"
+	mac     = "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_4) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Safari/605.1.15"
+	linux   = "Mozilla/5.0 (X11; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0"
+	crOS    = "Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0 Safari/537.36"
+)
+
+func TestPlatform(t *testing.T) {
+	tests := map[string]string{
+		iPhone:       PlatformIOS,
+		android:      PlatformAndroid,
+		windows:      PlatformWindows,
+		mac:          PlatformMacOS,
+		linux:        PlatformLinux,
+		crOS:         PlatformChromeOS,
+		"curl/8.5.0": PlatformOther,
+		"":           PlatformOther,
+		"Mozilla (iPad; CPU OS 17_4 like Mac OS X)": PlatformIOS,
+	}
+	for ua, want := range tests {
+		if got := Platform(ua); got != want {
+			t.Errorf("Platform(%q) = %q, want %q", ua, got, want)
+		}
+	}
+}
+
+func TestPreferredLanguage(t *testing.T) {
+	tests := map[string]string{
+		"":                            "",
+		"*":                           "",
+		"fr-CA":                       "fr-ca",
+		"en;q=0.5, de":                "de",
+		"fr-CH, fr;q=0.9, en;q=0.8":   "fr-ch",
+		"de;q=0.7, en;q=0.7":          "de",
+		"en;q=0, es":                  "es",
+		"  pt-BR ; q=0.9 ,ja;q=0.95 ": "ja",
+	}
+	for header, want := range tests {
+		if got := PreferredLanguage(header); got != want {
+			t.Errorf("PreferredLanguage(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	// a Saturday
+	saturday := time.Date(2024, 6, 1, 23, 30, 0, 0, time.UTC)
+	rules := []Rule{
+		{Platforms: []string{PlatformIOS}, Url: "https://apps.apple.com/app"},
+		{Platforms: []string{PlatformAndroid}, Url: "https://play.google.com/app"},
+		{Languages: []string{"fr"}, Url: "https://example.com/fr"},
+		{Countries: []string{"de", "AT"}, Url: "https://example.de"},
+		{Days: []string{"sat", "sun"}, From: "22:00", To: "06:00", Url: "https://example.com/night"},
+		{Platforms: []string{PlatformDesktop}, Days: []string{"mon"}, TimeZone: "Asia/Tokyo", Url: "https://example.com/tokyo-monday"},
+	}
+
+	tests := []struct {
+		name    string
+		visitor Visitor
+		want    string
+	}{
+		{"iOS", Visitor{Platform: PlatformIOS, Language: "fr", Time: saturday}, "https://apps.apple.com/app"},
+		{"Android", Visitor{Platform: PlatformAndroid, Time: saturday}, "https://play.google.com/app"},
+		{"language prefix", Visitor{Platform: PlatformWindows, Language: "fr-ca", Time: saturday}, "https://example.com/fr"},
+		{"language isn't a prefix of a longer one", Visitor{Platform: PlatformWindows, Language: "fry", Time: saturday.Add(-2 * time.Hour)}, ""},
+		{"country ignores case", Visitor{Platform: PlatformLinux, Country: "DE", Time: saturday}, "https://example.de"},
+		{"window past midnight", Visitor{Platform: PlatformLinux, Time: saturday}, "https://example.com/night"},
+		{"window ends", Visitor{Platform: PlatformLinux, Time: saturday.Add(-2 * time.Hour)}, ""},
+		{"window carries into the morning", Visitor{Platform: PlatformLinux, Time: saturday.Add(6*time.Hour + 29*time.Minute)}, "https://example.com/night"},
+		{"time zone", Visitor{Platform: PlatformMacOS, Time: saturday.Add(25 * time.Hour)}, "https://example.com/tokyo-monday"},
+		{"desktop group", Visitor{Platform: PlatformOther, Time: saturday.Add(25 * time.Hour)}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Match(rules, tt.visitor)
+			if got != tt.want || ok != (tt.want != "") {
+				t.Errorf("Match() = %q, %v, want %q", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewVisitor(t *testing.T) {
+	req := httptest.NewRequest("GET", "/a", nil)
+	req.Header.Set("User-Agent", android)
+	req.Header.Set("Accept-Language", "es-MX,es;q=0.9")
+
+	v := NewVisitor(req, "MX")
+	if v.Platform != PlatformAndroid || v.Language != "es-mx" || v.Country != "MX" || v.Time.IsZero() {
+		t.Errorf("NewVisitor() = %+v", v)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr bool
+	}{
+		{"valid", Rule{Platforms: []string{PlatformMobile}, Languages: []string{"en-GB"}, Url: "https://example.com"}, false},
+		{"window", Rule{Days: []string{"mon"}, From: "09:00", To: "17:30", TimeZone: "America/Chicago", Url: "https://example.com"}, false},
+		{"no conditions", Rule{Url: "https://example.com"}, true},
+		{"no url", Rule{Platforms: []string{PlatformIOS}}, true},
+		{"not http", Rule{Platforms: []string{PlatformIOS}, Url: "itms-apps://app"}, true},
+		{"unknown platform", Rule{Platforms: []string{"blackberry"}, Url: "https://example.com"}, true},
+		{"bad language", Rule{Languages: []string{"en, fr"}, Url: "https://example.com"}, true},
+		{"bad country", Rule{Countries: []string{"USA"}, Url: "https://example.com"}, true},
+		{"unknown day", Rule{Days: []string{"monday"}, Url: "https://example.com"}, true},
+		{"from without to", Rule{From: "09:00", Url: "https://example.com"}, true},
+		{"bad time", Rule{From: "9am", To: "17:00", Url: "https://example.com"}, true},
+		{"unknown time zone", Rule{Days: []string{"mon"}, TimeZone: "Mars/Olympus", Url: "https://example.com"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate([]Rule{tt.rule}); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := Validate(make([]Rule, MaxRules+1)); err == nil {
+		t.Errorf("Validate() of %d rules succeeded, want an error", MaxRules+1)
+	}
+}
@@ -0,0 +1,356 @@
+// Package server runs the shortener: it picks the database, starts the jobs that keep links checked and
+// described, and serves the handlers over HTTP, and over gRPC when asked to. A Server can listen on its own or be
+// mounted on another echo app, so the shortener can be embedded in other services or started by integration tests.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ericfialkowski/shorturl/bots"
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/ericfialkowski/shorturl/env"
+	"github.com/ericfialkowski/shorturl/geo"
+	"github.com/ericfialkowski/shorturl/handlers"
+	"github.com/ericfialkowski/shorturl/linkcheck"
+	"github.com/ericfialkowski/shorturl/policy"
+	"github.com/ericfialkowski/shorturl/qr"
+	"github.com/ericfialkowski/shorturl/status"
+	"github.com/ericfialkowski/shorturl/telemetry"
+	"github.com/ericfialkowski/shorturl/tenant"
+	"github.com/ericfialkowski/shorturl/threats"
+	"github.com/ericfialkowski/shorturl/unfurl"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v5"
+	"google.golang.org/grpc"
+)
+
+// Options are how a Server is put together. Whatever they leave out is configured by the environment, the same
+// way as for the shorturl command.
+type Options struct {
+	// DB stores the links. When it's nil, OpenDB picks one and Shutdown closes it.
+	DB dao.ShortUrlDao
+	// Listener is where HTTP requests are accepted. When it's nil, Addr is listened on.
+	Listener net.Listener
+	// Addr is the address listened on when there's no Listener, :8800 by default
+	Addr string
+	// GrpcListener is where the gRPC API is served, which it isn't when it's nil
+	GrpcListener net.Listener
+	// Metrics records OpenTelemetry metrics, which aren't recorded when it's nil
+	Metrics *telemetry.Metrics
+	// Middleware wraps every request to the shortener, ahead of its own middleware
+	Middleware []echo.MiddlewareFunc
+	// Prefix is the path the shortener is served below, like /links. The links and pages it returns point below it.
+	Prefix string
+	// Echo is an app to mount the shortener on, below Prefix, instead of listening on its own. The app's own routes
+	// come first, and it's up to its owner to serve it.
+	Echo *echo.Echo
+	// Configure is called with the handlers once the environment has configured them, to change them further
+	Configure func(*handlers.Handlers) error
+	// ID tells instances apart in the x-instance-uuid header, a random one by default
+	ID string
+}
+
+// Server is the shortener, ready to Start
+type Server struct {
+	options  Options
+	db       dao.ShortUrlDao
+	ownsDB   bool
+	status   *status.SimpleStatus
+	handlers *handlers.Handlers
+	app      *echo.Echo   // the shortener's own routes
+	http     *http.Server // nil when mounted on another app
+	listener net.Listener
+	grpc     *grpc.Server
+	threats  *threats.Lists
+	checker  *linkcheck.Checker
+	unfurler *unfurl.Fetcher
+	stop     context.CancelFunc // stops the background jobs
+	jobs     sync.WaitGroup
+}
+
+// New puts a Server together from options and the environment. It connects to the database, but doesn't accept
+// requests or start any background jobs until it's started.
+func New(options Options) (*Server, error) {
+	if options.ID == "" {
+		options.ID = uuid.New().String()
+	}
+	options.Prefix = strings.TrimSuffix(options.Prefix, "/")
+	if options.Prefix != "" && !strings.HasPrefix(options.Prefix, "/") {
+		options.Prefix = "/" + options.Prefix
+	}
+	if options.Addr == "" {
+		options.Addr = fmt.Sprintf("%s:%d", env.StringOrDefault("ip", ""), env.IntOrDefault("port", 8800))
+	}
+	s := &Server{options: options, db: options.DB, status: status.NewStatus()}
+
+	// Load the GeoIP database used for per-country stats
+	locator, err := geo.NewLocator(env.StringOrDefault("geoip_db", "")) // ./GeoLite2-City.mmdb
+	if err != nil {
+		log.Printf("Warning: failed to load GeoIP database: %v", err)
+	}
+
+	// Load extra bot patterns so crawlers don't count as visitors
+	classifier, err := bots.NewClassifier(env.StringOrDefault("bot_patterns", "")) // ./bots.txt
+	if err != nil {
+		log.Printf("Warning: failed to load bot patterns, using the built-in ones: %v", err)
+	}
+
+	// Load the rules for which destinations can be shortened
+	destinations, err := policy.NewPolicy(env.StringOrDefault("policy_rules", ""), // ./policy.txt
+		env.StringOrDefault("allowed_schemes", policy.DefaultSchemes),
+		env.StringOrDefault("self_hosts", ""))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load the destination policy: %v", err)
+	}
+
+	// Load the domains that get their own links and settings
+	tenants, err := tenant.Load(env.StringOrDefault("tenants_file", "")) // ./tenants.json
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load the tenants: %v", err)
+	}
+
+	// Load the logo that can be drawn in the middle of QR codes
+	var logo image.Image
+	if qrLogo := env.StringOrDefault("qr_logo", ""); qrLogo != "" { // ./logo.png
+		if logo, err = qr.LoadLogo(qrLogo); err != nil {
+			log.Printf("Warning: failed to load QR code logo: %v", err)
+		}
+	}
+
+	if s.db == nil {
+		if s.db, err = OpenDB(); err != nil {
+			return nil, err
+		}
+		s.ownsDB = true
+	}
+
+	s.threats = threats.NewLists(env.StringOrDefault("threat_list_url", ""))
+	if env.DurationOrDefault("health_check_interval", 0) > 0 {
+		s.checker = linkcheck.NewChecker(s.db)
+	}
+	if env.BoolOrDefault("metadata_fetch", true) {
+		s.unfurler = unfurl.NewFetcher(s.db)
+	}
+
+	h := handlers.CreateHandlers(s.db, s.status, options.ID, options.Metrics)
+	s.handlers = &h
+	h.SetLocator(locator)
+	h.SetClassifier(classifier)
+	h.SetQrLogo(logo)
+	h.SetPolicy(destinations)
+	h.SetThreats(s.threats)
+	h.SetLinkChecker(s.checker, env.StringOrDefault("dead_link_fallback", ""))
+	h.SetUnfurler(s.unfurler)
+	h.SetTenants(tenants)
+	h.SetPrefix(options.Prefix)
+	if err := h.SetRedirects(env.IntOrDefault("redirect_status", http.StatusFound),
+		env.DurationOrDefault("redirect_cache_max_age", 24*time.Hour)); err != nil {
+		s.close()
+		return nil, fmt.Errorf("couldn't set up redirects: %v", err)
+	}
+	if options.Configure != nil {
+		if err := options.Configure(&h); err != nil {
+			s.close()
+			return nil, err
+		}
+	}
+
+	s.app = echo.New()
+	s.app.Use(options.Middleware...)
+	h.SetUp(s.app)
+
+	handler := below(options.Prefix, s.app)
+	if options.Echo != nil {
+		options.Echo.Any(options.Prefix+"/*", echo.WrapHandler(handler))
+		if options.Prefix != "" {
+			options.Echo.Any(options.Prefix, echo.WrapHandler(handler))
+		}
+		return s, nil
+	}
+	s.http = &http.Server{
+		// Good practice to set timeouts to avoid Slowloris attacks.
+		WriteTimeout: env.DurationOrDefault("http_write_timeout", time.Second*10),
+		ReadTimeout:  env.DurationOrDefault("http_read_timeout", time.Second*15),
+		IdleTimeout:  env.DurationOrDefault("http_idle_timeout", time.Second*60),
+		Handler:      handler,
+	}
+	return s, nil
+}
+
+// Handlers returns the shortener's handlers
+func (s *Server) Handlers() *handlers.Handlers {
+	return s.handlers
+}
+
+// Handler returns what serves the shortener's requests, below the prefix
+func (s *Server) Handler() http.Handler {
+	return below(s.options.Prefix, s.app)
+}
+
+// Addr returns the address HTTP requests are accepted on once the server has started, or nil when it's mounted on
+// another app
+func (s *Server) Addr() net.Addr {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// Start starts the background jobs, which run until ctx is done or the server is shut down, and starts accepting
+// requests without waiting for them
+func (s *Server) Start(ctx context.Context) error {
+	if s.http != nil {
+		s.listener = s.options.Listener
+		if s.listener == nil {
+			l, err := net.Listen("tcp", s.options.Addr)
+			if err != nil {
+				return fmt.Errorf("couldn't listen on %q: %v", s.options.Addr, err)
+			}
+			s.listener = l
+		}
+		log.Printf("Server id %q listening to %q", s.options.ID, s.listener.Addr())
+		go func() {
+			if err := s.http.Serve(s.listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Println(err)
+			}
+		}()
+	}
+
+	// serve the same links over gRPC, when enabled
+	if s.options.GrpcListener != nil {
+		s.grpc = grpc.NewServer()
+		s.handlers.RegisterGRPC(s.grpc)
+		log.Printf("Serving gRPC on %q", s.options.GrpcListener.Addr())
+		go func() {
+			if err := s.grpc.Serve(s.options.GrpcListener); err != nil {
+				log.Println(err)
+			}
+		}()
+	}
+
+	ctx, s.stop = context.WithCancel(ctx)
+
+	// keep the status up to date with the database's
+	s.every(ctx, env.DurationOrDefault("status_interval", time.Second*30), false, func(context.Context) error {
+		if !s.db.IsLikelyOk() {
+			s.status.Warn("Database is down")
+		} else {
+			s.status.Ok("All good")
+		}
+		return nil
+	}, "")
+
+	// Keep the lists of known threats up to date in the background
+	if s.threats != nil {
+		s.every(ctx, env.DurationOrDefault("threat_list_interval", time.Minute*30), true, s.threats.Sync,
+			"Warning: failed to sync threat lists: %v")
+	}
+
+	// check that destinations still work, when enabled
+	if s.checker != nil {
+		s.every(ctx, env.DurationOrDefault("health_check_interval", 0), true, s.checker.Run,
+			"Warning: failed to check link destinations: %v")
+	}
+
+	// fetch the titles and previews of destinations, unless turned off
+	if s.unfurler != nil {
+		s.every(ctx, env.DurationOrDefault("metadata_refresh_interval", time.Hour), true, s.unfurler.Run,
+			"Warning: failed to fetch link metadata: %v")
+	}
+
+	// we're ready to accept requests
+	s.status.Ok("All good")
+	return nil
+}
+
+// every runs job each interval until ctx is done, right away too when now is set, logging its errors with format
+func (s *Server) every(ctx context.Context, interval time.Duration, now bool, job func(context.Context) error, format string) {
+	s.jobs.Add(1)
+	go func() {
+		defer s.jobs.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for run := now; ; run = true {
+			if run {
+				if err := job(ctx); err != nil && ctx.Err() == nil {
+					log.Printf(format, err)
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Shutdown stops accepting requests and waits for the ones in flight, and the background jobs, until ctx is done.
+// A database the server opened itself is closed.
+func (s *Server) Shutdown(ctx context.Context) error {
+	var err error
+	if s.http != nil {
+		// Doesn't block if no connections, but will otherwise wait until the deadline.
+		err = s.http.Shutdown(ctx)
+	}
+	if s.grpc != nil {
+		stopped := make(chan struct{})
+		go func() {
+			s.grpc.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			s.grpc.Stop()
+		}
+	}
+
+	if s.stop != nil {
+		s.stop()
+		finished := make(chan struct{})
+		go func() {
+			s.jobs.Wait()
+			close(finished)
+		}()
+		select {
+		case <-finished:
+		case <-ctx.Done():
+		}
+	}
+	s.close()
+	return err
+}
+
+func (s *Server) close() {
+	if s.ownsDB {
+		s.db.Cleanup()
+	}
+}
+
+// below serves next the requests for paths below prefix, with prefix stripped off them
+func below(prefix string, next http.Handler) http.Handler {
+	if prefix == "" {
+		return next
+	}
+	strip := http.StripPrefix(prefix, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == prefix:
+			http.Redirect(w, r, prefix+"/", http.StatusPermanentRedirect)
+		case strings.HasPrefix(r.URL.Path, prefix+"/"):
+			strip.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ericfialkowski/shorturl/client"
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/ericfialkowski/shorturl/handlers"
+	"github.com/labstack/echo/v5"
+)
+
+// quiet keeps the server from logging requests or fetching the destinations of the links tests create
+func quiet(t *testing.T) {
+	t.Setenv("logrequests", "false")
+	t.Setenv("metadata_fetch", "false")
+}
+
+func TestServer_StartShutdown(t *testing.T) {
+	quiet(t)
+	ctx := context.Background()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var requests atomic.Int32
+	configured := false
+	s, err := New(Options{
+		DB:           dao.CreateMemoryDB(),
+		Listener:     listener,
+		GrpcListener: grpcListener,
+		Middleware: []echo.MiddlewareFunc{func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c *echo.Context) error {
+				requests.Add(1)
+				return next(c)
+			}
+		}},
+		Configure: func(h *handlers.Handlers) error {
+			configured = h != nil
+			return nil
+		},
+		ID: "test-id",
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if !configured {
+		t.Error("Configure wasn't called with the handlers")
+	}
+	if err := s.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	c, _ := client.New("http://" + s.Addr().String())
+	link, err := c.Create(ctx, "https://example.com")
+	if err != nil || link.UrlLink != "/"+link.Abv {
+		t.Fatalf("Create() = %+v, %v", link, err)
+	}
+	if dest, err := c.Follow(ctx, link.Abv); err != nil || dest != "https://example.com" {
+		t.Errorf("Follow() = %q, %v", dest, err)
+	}
+	if status, err := c.Status(ctx); err != nil || status.Code != 0 {
+		t.Errorf("Status() = %+v, %v, want ok", status, err)
+	}
+	if requests.Load() != 3 {
+		t.Errorf("middleware saw %d requests, want 3", requests.Load())
+	}
+	if conn, err := net.Dial("tcp", grpcListener.Addr().String()); err != nil {
+		t.Errorf("gRPC isn't served: %v", err)
+	} else {
+		_ = conn.Close()
+	}
+
+	// the client keeps its connections open, which Shutdown would wait out
+	http.DefaultClient.CloseIdleConnections()
+	shutdownCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+	if _, err := http.Get("http://" + s.Addr().String() + "/diag/status"); err == nil {
+		t.Error("requests are still accepted after Shutdown()")
+	}
+}
+
+func TestServer_Mounted(t *testing.T) {
+	quiet(t)
+	ctx := context.Background()
+	app := echo.New()
+	app.GET("/hello", func(c *echo.Context) error {
+		return c.String(http.StatusOK, "hello")
+	})
+
+	s, err := New(Options{Echo: app, Prefix: "links/"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := s.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer func() { _ = s.Shutdown(ctx) }()
+	if s.Addr() != nil {
+		t.Errorf("Addr() = %v, want nil when mounted", s.Addr())
+	}
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	c, _ := client.New(srv.URL + "/links")
+	link, err := c.CreateLink(ctx, client.CreateRequest{Url: "https://wiki.com", Name: "team/wiki"})
+	if err != nil || link.UrlLink != "/links/team/wiki" || link.StatsLink != "/links/team%2Fwiki/stats" {
+		t.Fatalf("CreateLink() = %+v, %v, want links below /links", link, err)
+	}
+	if dest, err := c.Follow(ctx, "team/wiki"); err != nil || dest != "https://wiki.com" {
+		t.Errorf("Follow() = %q, %v", dest, err)
+	}
+
+	noRedirects := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	for path, want := range map[string]int{"/hello": http.StatusOK, "/links": http.StatusPermanentRedirect, "/links/diag/status": http.StatusOK, "/team/wiki": http.StatusNotFound,
+		// the page and icon are built in, so they're found from the package's directory too
+		"/links/": http.StatusOK, "/links/favicon.ico": http.StatusOK} {
+		resp, err := noRedirects.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s error = %v", path, err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("GET %s = %d, want %d", path, resp.StatusCode, want)
+		}
+	}
+}
+
+func TestOpenDB(t *testing.T) {
+	for _, key := range []string{"postgres_uri", "mysql_dsn", "mongo_uri", "redis_uri", "sqlite_path"} {
+		t.Setenv(key, "")
+	}
+	db, err := OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB() error = %v", err)
+	}
+	if _, ok := db.(*dao.MemoryDB); !ok {
+		t.Errorf("OpenDB() = %T, want the in-memory database", db)
+	}
+	db.Cleanup()
+
+	t.Setenv("sqlite_path", ":memory:")
+	t.Setenv("redis_uri", "localhost:6379")
+	if _, err := OpenDB(); err == nil {
+		t.Error("OpenDB() with two databases = nil error, want one")
+	}
+}
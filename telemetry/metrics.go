@@ -21,6 +21,8 @@ var (
 // Metrics holds all the OpenTelemetry metric instruments for the application.
 type Metrics struct {
 	Redirects       metric.Int64Counter
+	Blocked         metric.Int64Counter
+	Unavailable     metric.Int64Counter
 	UrlsCreated     metric.Int64Counter
 	UrlsDeleted     metric.Int64Counter
 	StatsRequests   metric.Int64Counter
@@ -64,6 +66,22 @@ func NewMetrics(ctx context.Context) (*Metrics, error) {
 		return nil, err
 	}
 
+	blocked, err := meter.Int64Counter("shorturl.redirects.blocked",
+		metric.WithDescription("Number of redirects stopped because the link or its destination is blocked"),
+		metric.WithUnit("{redirect}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	unavailable, err := meter.Int64Counter("shorturl.redirects.unavailable",
+		metric.WithDescription("Number of redirects not made because the destination is dead"),
+		metric.WithUnit("{redirect}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
 	urlsCreated, err := meter.Int64Counter("shorturl.urls.created",
 		metric.WithDescription("Number of new short URLs created"),
 		metric.WithUnit("{url}"),
@@ -100,6 +118,8 @@ func NewMetrics(ctx context.Context) (*Metrics, error) {
 
 	return &Metrics{
 		Redirects:       redirects,
+		Blocked:         blocked,
+		Unavailable:     unavailable,
 		UrlsCreated:     urlsCreated,
 		UrlsDeleted:     urlsDeleted,
 		StatsRequests:   statsRequests,
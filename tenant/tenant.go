@@ -0,0 +1,178 @@
+// Package tenant gives each domain the service is reached on its own namespace of links and settings
+package tenant
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/ericfialkowski/shorturl/rando"
+)
+
+const (
+	maxKeyLength   = 32
+	maxBrandLength = 100
+)
+
+var (
+	domainPattern   = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)*$`)
+	alphabetPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	colorPattern    = regexp.MustCompile(`^#([0-9a-fA-F]{3,4}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+)
+
+type (
+	// Brand is how the pages of a tenant are dressed
+	Brand struct {
+		Name  string `json:"name,omitempty"`
+		Logo  string `json:"logo,omitempty"`  // http(s) URL or path of an image shown next to the name
+		Color string `json:"color,omitempty"` // CSS hex color of the header
+	}
+
+	// Tenant is a domain with its own links. Settings left empty fall back to the service's own.
+	Tenant struct {
+		Domain         string `json:"domain"`
+		Alphabet       string `json:"alphabet,omitempty"`
+		KeyLength      int    `json:"key_length,omitempty"`
+		RedirectStatus int    `json:"redirect_status,omitempty"`
+		Brand          Brand  `json:"brand"`
+
+		abbreviator *dao.Abbreviator
+	}
+
+	// Tenants finds the tenant of a host. Hosts that aren't a tenant share the default namespace, whose
+	// settings are those of the tenant with an empty domain, if there is one. A nil Tenants is valid and
+	// puts every host in the default namespace.
+	Tenants struct {
+		byDomain map[string]*Tenant
+		fallback *Tenant
+	}
+)
+
+var defaultTenant = &Tenant{}
+
+// Load reads the tenants from a JSON array of them in the file at path. No path means no tenants.
+func Load(path string) (*Tenants, error) {
+	if path == "" {
+		return nil, nil
+	}
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var list []*Tenant
+	if err := json.Unmarshal(buf, &list); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	tenants, err := New(list)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	log.Printf("Loaded %d tenants from %s", len(list), path)
+	return tenants, nil
+}
+
+// New checks the settings of each of list and returns them as Tenants
+func New(list []*Tenant) (*Tenants, error) {
+	t := &Tenants{byDomain: make(map[string]*Tenant), fallback: defaultTenant}
+	for _, tenant := range list {
+		tenant.Domain = normalizeHost(tenant.Domain)
+		if err := tenant.validate(); err != nil {
+			return nil, fmt.Errorf("tenant %q: %v", tenant.Domain, err)
+		}
+		if tenant.Alphabet != "" || tenant.KeyLength != 0 {
+			tenant.abbreviator = dao.NewAbbreviator(cmp.Or(tenant.Alphabet, rando.Chars), cmp.Or(tenant.KeyLength, 1))
+		}
+
+		if tenant.Domain == "" {
+			if t.fallback != defaultTenant {
+				return nil, fmt.Errorf("more than one tenant for the default domain")
+			}
+			t.fallback = tenant
+			continue
+		}
+		if _, ok := t.byDomain[tenant.Domain]; ok {
+			return nil, fmt.Errorf("more than one tenant for %s", tenant.Domain)
+		}
+		t.byDomain[tenant.Domain] = tenant
+	}
+	return t, nil
+}
+
+func (t *Tenant) validate() error {
+	if t.Domain != "" && !domainPattern.MatchString(t.Domain) {
+		return fmt.Errorf("domain isn't a host name")
+	}
+	if t.Alphabet != "" {
+		if !alphabetPattern.MatchString(t.Alphabet) {
+			return fmt.Errorf("alphabet can only have letters, digits, - and _")
+		}
+		seen := make(map[rune]bool)
+		for _, r := range t.Alphabet {
+			if seen[r] {
+				return fmt.Errorf("alphabet has %q more than once", r)
+			}
+			seen[r] = true
+		}
+		if len(seen) < 2 {
+			return fmt.Errorf("alphabet needs at least 2 characters")
+		}
+	}
+	if t.KeyLength < 0 || t.KeyLength > maxKeyLength {
+		return fmt.Errorf("key_length must be between 1 and %d", maxKeyLength)
+	}
+	if t.RedirectStatus != 0 && !dao.ValidRedirectStatus(t.RedirectStatus) {
+		return fmt.Errorf("redirect_status must be 301, 302, 307 or 308")
+	}
+	if len(t.Brand.Name) > maxBrandLength {
+		return fmt.Errorf("brand name is longer than %d characters", maxBrandLength)
+	}
+	if t.Brand.Color != "" && !colorPattern.MatchString(t.Brand.Color) {
+		return fmt.Errorf("brand color must be a hex color like #1a2b3c")
+	}
+	if t.Brand.Logo != "" {
+		u, err := url.Parse(t.Brand.Logo)
+		local := err == nil && u.Scheme == "" && u.Host == "" && strings.HasPrefix(u.Path, "/") && !strings.HasPrefix(t.Brand.Logo, "//")
+		remote := err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+		if !local && !remote {
+			return fmt.Errorf("brand logo must be an http(s) URL or a path")
+		}
+	}
+	return nil
+}
+
+// For returns the tenant of host, which can have a port
+func (t *Tenants) For(host string) *Tenant {
+	if t == nil {
+		return defaultTenant
+	}
+	if tenant, ok := t.byDomain[normalizeHost(stripPort(host))]; ok {
+		return tenant
+	}
+	return t.fallback
+}
+
+// Abbreviate returns a new abbreviation for u, made from the tenant's alphabet and key length
+func (t *Tenant) Abbreviate(u string, d dao.ShortUrlDao) (string, error) {
+	if t.abbreviator == nil {
+		return dao.CreateAbbreviation(u, d)
+	}
+	return t.abbreviator.Create(u, d)
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
+
+func stripPort(hostport string) string {
+	if host, _, err := net.SplitHostPort(hostport); err == nil {
+		return host
+	}
+	return hostport
+}
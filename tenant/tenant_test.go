@@ -0,0 +1,114 @@
+package tenant
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ericfialkowski/shorturl/dao"
+)
+
+func TestTenants_For(t *testing.T) {
+	tenants, err := New([]*Tenant{
+		{Domain: "Go.Acme.com", RedirectStatus: 301},
+		{Domain: "acme.link", Brand: Brand{Name: "Acme"}},
+		{Domain: "", KeyLength: 4},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"go.acme.com", "go.acme.com"},
+		{"GO.ACME.COM:8800", "go.acme.com"},
+		{"acme.link.", "acme.link"},
+		{"localhost:8800", ""},
+		{"[::1]:8800", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := tenants.For(tt.host); got.Domain != tt.want {
+			t.Errorf("For(%q) = %q, want %q", tt.host, got.Domain, tt.want)
+		}
+	}
+	if got := tenants.For("example.com"); got.KeyLength != 4 {
+		t.Errorf("For() of another host = %+v, want the default domain's settings", got)
+	}
+
+	var none *Tenants
+	if got := none.For("go.acme.com"); got.Domain != "" {
+		t.Errorf("nil For() = %q, want the default domain", got.Domain)
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		tenant Tenant
+		want   string
+	}{
+		{"domain", Tenant{Domain: "acme.com/sale"}, "domain"},
+		{"alphabet characters", Tenant{Domain: "a.com", Alphabet: "ab@"}, "alphabet"},
+		{"alphabet repeats", Tenant{Domain: "a.com", Alphabet: "abca"}, "more than once"},
+		{"alphabet too short", Tenant{Domain: "a.com", Alphabet: "a"}, "at least 2"},
+		{"key length", Tenant{Domain: "a.com", KeyLength: 33}, "key_length"},
+		{"redirect status", Tenant{Domain: "a.com", RedirectStatus: 303}, "redirect_status"},
+		{"color", Tenant{Domain: "a.com", Brand: Brand{Color: "red; background: url(x)"}}, "color"},
+		{"logo", Tenant{Domain: "a.com", Brand: Brand{Logo: "javascript:alert(1)"}}, "logo"},
+		{"protocol relative logo", Tenant{Domain: "a.com", Brand: Brand{Logo: "//evil.com/x.png"}}, "logo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenant := tt.tenant
+			if _, err := New([]*Tenant{&tenant}); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("New() error = %v, want one about %s", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := New([]*Tenant{{Domain: "a.com"}, {Domain: "A.com"}}); err == nil {
+		t.Error("New() of a repeated domain didn't fail")
+	}
+}
+
+func TestTenant_Abbreviate(t *testing.T) {
+	tenants, err := New([]*Tenant{{Domain: "acme.link", Alphabet: "AB", KeyLength: 10}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	d := dao.CreateMemoryDB()
+	defer d.Cleanup()
+
+	abv, err := tenants.For("acme.link").Abbreviate("https://example.com", d)
+	if err != nil {
+		t.Fatalf("Abbreviate() error = %v", err)
+	}
+	if len(abv) != 10 || strings.Trim(abv, "AB") != "" {
+		t.Errorf("Abbreviate() = %q, want 10 of A and B", abv)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	if tenants, err := Load(""); tenants != nil || err != nil {
+		t.Errorf("Load(\"\") = %v, %v, want no tenants", tenants, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	_ = os.WriteFile(path, []byte(`[{"domain": "acme.link", "brand": {"name": "Acme", "color": "#c00"}}]`), 0o600)
+	tenants, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := tenants.For("acme.link").Brand; got.Name != "Acme" || got.Color != "#c00" {
+		t.Errorf("Load() brand = %+v, want Acme's", got)
+	}
+
+	_ = os.WriteFile(path, []byte(`[{"domain": "acme.link", "key_length": -1}]`), 0o600)
+	if _, err := Load(path); err == nil {
+		t.Error("Load() of an invalid tenant didn't fail")
+	}
+}
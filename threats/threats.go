@@ -0,0 +1,230 @@
+// Package threats checks URLs against lists of known threats, kept locally as SHA-256 hash prefixes
+// in the style of Safe Browsing and synced from an HTTP endpoint
+package threats
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ericfialkowski/shorturl/env"
+)
+
+const (
+	minPrefixLength = 4
+	maxListSize     = 64 << 20
+
+	maxHostSuffixes = 4
+	maxPathPrefixes = 4
+)
+
+// update is the body served by the list endpoint. Prefixes are hex encoded and 4 to 32 bytes long;
+// 32 bytes is a full hash.
+type update struct {
+	Lists []struct {
+		Name     string   `json:"name"`
+		Prefixes []string `json:"prefixes"`
+	} `json:"lists"`
+}
+
+// Lists holds the hash prefixes of every threat list. A nil Lists is valid and matches nothing.
+type Lists struct {
+	source string
+	client *http.Client
+
+	mu       sync.RWMutex
+	etag     string
+	prefixes map[string][]string // raw prefix -> names of the lists it's on
+	lengths  []int               // distinct prefix lengths, shortest first
+}
+
+// NewLists returns Lists synced from the source URL. An empty source disables threat checks and
+// returns a nil Lists. Nothing matches until the first Sync.
+func NewLists(source string) *Lists {
+	if source == "" {
+		return nil
+	}
+	return &Lists{
+		source:   source,
+		client:   &http.Client{Timeout: env.DurationOrDefault("threat_list_timeout", 30*time.Second)},
+		prefixes: make(map[string][]string),
+	}
+}
+
+// Sync fetches the lists from the source, replacing the ones held when they've changed
+func (l *Lists) Sync(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, l.source, nil)
+	if err != nil {
+		return fmt.Errorf("invalid threat list url: %v", err)
+	}
+	l.mu.RLock()
+	if l.etag != "" {
+		req.Header.Set("If-None-Match", l.etag)
+	}
+	l.mu.RUnlock()
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error fetching threat lists: %v", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return nil
+	case http.StatusOK:
+	default:
+		return fmt.Errorf("error fetching threat lists: %s", resp.Status)
+	}
+
+	var u update
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxListSize)).Decode(&u); err != nil {
+		return fmt.Errorf("error parsing threat lists: %v", err)
+	}
+
+	prefixes := make(map[string][]string)
+	var lengths []int
+	for _, list := range u.Lists {
+		if list.Name == "" {
+			return fmt.Errorf("error parsing threat lists: a list has no name")
+		}
+		for _, p := range list.Prefixes {
+			raw, err := hex.DecodeString(p)
+			if err != nil || len(raw) < minPrefixLength || len(raw) > sha256.Size {
+				return fmt.Errorf("error parsing threat lists: %q on %s isn't a hex prefix of 4 to 32 bytes", p, list.Name)
+			}
+			if !slices.Contains(prefixes[string(raw)], list.Name) {
+				prefixes[string(raw)] = append(prefixes[string(raw)], list.Name)
+			}
+			if !slices.Contains(lengths, len(raw)) {
+				lengths = append(lengths, len(raw))
+			}
+		}
+	}
+	slices.Sort(lengths)
+
+	l.mu.Lock()
+	l.etag = resp.Header.Get("ETag")
+	l.prefixes = prefixes
+	l.lengths = lengths
+	l.mu.Unlock()
+
+	log.Printf("Loaded %d threat list prefixes from %d lists", len(prefixes), len(u.Lists))
+	return nil
+}
+
+// Check returns the name of a list rawURL is on. Every host suffix and path prefix the URL could be
+// listed under is checked, so listing a domain or a directory covers everything below it.
+func (l *Lists) Check(rawURL string) (string, bool) {
+	if l == nil {
+		return "", false
+	}
+
+	expressions := Expressions(rawURL)
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if len(l.prefixes) == 0 {
+		return "", false
+	}
+	for _, expr := range expressions {
+		hash := sha256.Sum256([]byte(expr))
+		for _, n := range l.lengths {
+			if names, ok := l.prefixes[string(hash[:n])]; ok {
+				return names[0], true
+			}
+		}
+	}
+	return "", false
+}
+
+// Expressions returns the host suffix and path prefix combinations rawURL is checked under, such as
+// "a.b.c/1/2.html?x", "b.c/1/" and "c.d/". A list prefix is the start of the SHA-256 of one of them.
+func Expressions(rawURL string) []string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil
+	}
+	host := canonicalHost(u.Hostname())
+	if host == "" {
+		return nil
+	}
+
+	var expressions []string
+	for _, h := range hostSuffixes(host) {
+		for _, p := range pathPrefixes(u) {
+			expressions = append(expressions, h+p)
+		}
+	}
+	return expressions
+}
+
+// canonicalHost lower cases host and removes empty labels, such as leading, trailing and repeated dots
+func canonicalHost(host string) string {
+	labels := strings.FieldsFunc(strings.ToLower(host), func(r rune) bool { return r == '.' })
+	return strings.Join(labels, ".")
+}
+
+// hostSuffixes is the host then up to 4 of its parent domains, not counting the top level domain
+func hostSuffixes(host string) []string {
+	suffixes := []string{host}
+	if net.ParseIP(host) != nil {
+		return suffixes
+	}
+	labels := strings.Split(host, ".")
+	for i := max(1, len(labels)-1-maxHostSuffixes); i < len(labels)-1 && len(suffixes) <= maxHostSuffixes; i++ {
+		suffixes = append(suffixes, strings.Join(labels[i:], "."))
+	}
+	return suffixes
+}
+
+// pathPrefixes is the path with and without the query, then up to 4 of its directories starting at the root
+func pathPrefixes(u *url.URL) []string {
+	p := u.EscapedPath()
+	if p == "" {
+		p = "/"
+	}
+	trailing := strings.HasSuffix(p, "/")
+	p = path.Clean(p)
+	if trailing && p != "/" {
+		p += "/"
+	}
+
+	var prefixes []string
+	if u.RawQuery != "" {
+		prefixes = append(prefixes, p+"?"+u.RawQuery)
+	}
+	prefixes = append(prefixes, p)
+
+	dir := "/"
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	for i := 0; i < maxPathPrefixes; i++ {
+		if !slices.Contains(prefixes, dir) {
+			prefixes = append(prefixes, dir)
+		}
+		if i >= len(parts)-1 {
+			break
+		}
+		dir += parts[i] + "/"
+	}
+	return prefixes
+}
@@ -0,0 +1,134 @@
+package threats
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func prefix(expression string, n int) string {
+	hash := sha256.Sum256([]byte(expression))
+	return hex.EncodeToString(hash[:n])
+}
+
+func TestExpressions(t *testing.T) {
+	tests := []struct {
+		url  string
+		want []string
+	}{
+		{"http://a.b.c/1/2.html?param=1", []string{
+			"a.b.c/1/2.html?param=1", "a.b.c/1/2.html", "a.b.c/", "a.b.c/1/",
+			"b.c/1/2.html?param=1", "b.c/1/2.html", "b.c/", "b.c/1/",
+		}},
+		{"https://A.B.C.D.E.F.G:8443/1.html#frag", []string{
+			"a.b.c.d.e.f.g/1.html", "a.b.c.d.e.f.g/",
+			"c.d.e.f.g/1.html", "c.d.e.f.g/",
+			"d.e.f.g/1.html", "d.e.f.g/",
+			"e.f.g/1.html", "e.f.g/",
+			"f.g/1.html", "f.g/",
+		}},
+		{"http://1.2.3.4/a/./b/../c/", []string{"1.2.3.4/a/c/", "1.2.3.4/", "1.2.3.4/a/"}},
+		{"https://example.com", []string{"example.com/"}},
+		{"mailto:someone", nil},
+	}
+	for _, tt := range tests {
+		if got := Expressions(tt.url); !slices.Equal(got, tt.want) {
+			t.Errorf("Expressions(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestLists_Sync(t *testing.T) {
+	body := fmt.Sprintf(`{"lists": [
+		{"name": "malware", "prefixes": [%q, %q]},
+		{"name": "phishing", "prefixes": [%q]}
+	]}`, prefix("evil.example/", 4), prefix("ok.example/bad/", 32), prefix("phish.example/login", 6))
+
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	l := NewLists(server.URL)
+	if _, ok := l.Check("https://evil.example/"); ok {
+		t.Errorf("Check() matched before the lists were synced")
+	}
+	for range 2 {
+		if err := l.Sync(context.Background()); err != nil {
+			t.Fatalf("Sync() error = %v", err)
+		}
+	}
+	if fetches != 2 {
+		t.Errorf("Sync() fetched %d times, want 2", fetches)
+	}
+
+	tests := []struct {
+		url  string
+		list string
+	}{
+		{"https://evil.example/", "malware"},
+		{"http://www.evil.example/any/path?q=1", "malware"},
+		{"https://ok.example/bad/page.html", "malware"},
+		{"https://ok.example/good/page.html", ""},
+		{"https://phish.example/login", "phishing"},
+		{"https://phish.example/login/other", ""},
+		{"https://example.com/", ""},
+	}
+	for _, tt := range tests {
+		list, ok := l.Check(tt.url)
+		if list != tt.list || ok != (tt.list != "") {
+			t.Errorf("Check(%q) = %q, %v, want %q", tt.url, list, ok, tt.list)
+		}
+	}
+}
+
+func TestLists_SyncErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{"server error", http.StatusInternalServerError, ""},
+		{"not json", http.StatusOK, "evil.example"},
+		{"short prefix", http.StatusOK, `{"lists": [{"name": "malware", "prefixes": ["abcd"]}]}`},
+		{"no name", http.StatusOK, `{"lists": [{"prefixes": ["abcdef01"]}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			if err := NewLists(server.URL).Sync(context.Background()); err == nil {
+				t.Errorf("Sync() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestLists_Nil(t *testing.T) {
+	l := NewLists("")
+	if l != nil {
+		t.Fatalf("NewLists(\"\") = %v, want nil", l)
+	}
+	if err := l.Sync(context.Background()); err != nil {
+		t.Errorf("Sync() error = %v", err)
+	}
+	if _, ok := l.Check("https://evil.example/"); ok {
+		t.Errorf("Check() matched on nil Lists")
+	}
+}
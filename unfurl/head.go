@@ -0,0 +1,166 @@
+package unfurl
+
+import (
+	"html"
+	"strings"
+)
+
+// head is what was found in the head of a page
+type head struct {
+	title     string
+	meta      map[string]string // first content of each meta property or name, lower cased
+	icon      string
+	touchIcon string
+}
+
+// scanHead reads the title, meta tags and icon links from the head of doc. It only understands as much
+// HTML as it needs to: comments, scripts and styles are skipped, and it stops at the body.
+func scanHead(doc string) head {
+	h := head{meta: make(map[string]string)}
+	lower := asciiLower(doc)
+
+	for i := 0; i < len(doc); {
+		lt := strings.IndexByte(doc[i:], '<')
+		if lt < 0 {
+			break
+		}
+		i += lt
+		if strings.HasPrefix(doc[i:], "<!--") {
+			end := strings.Index(doc[i+4:], "-->")
+			if end < 0 {
+				break
+			}
+			i += 4 + end + 3
+			continue
+		}
+
+		name, attrs, n := readTag(doc[i:])
+		if n == 0 {
+			i++
+			continue
+		}
+		i += n
+
+		switch name {
+		case "title":
+			end := closing(lower[i:], name)
+			if h.title == "" {
+				h.title = html.UnescapeString(doc[i : i+end])
+			}
+			i += end
+		case "script", "style", "template", "noscript", "textarea":
+			i += closing(lower[i:], name)
+		case "meta":
+			key := attrs["property"]
+			if key == "" {
+				key = attrs["name"]
+			}
+			key = strings.ToLower(strings.TrimSpace(key))
+			if _, ok := h.meta[key]; key != "" && !ok {
+				h.meta[key] = attrs["content"]
+			}
+		case "link":
+			for _, rel := range strings.Fields(strings.ToLower(attrs["rel"])) {
+				switch {
+				case rel == "icon" && h.icon == "":
+					h.icon = attrs["href"]
+				case rel == "apple-touch-icon" && h.touchIcon == "":
+					h.touchIcon = attrs["href"]
+				}
+			}
+		case "body", "/head":
+			return h
+		}
+	}
+	return h
+}
+
+// closing returns where the closing tag of name starts in lower, or its length if there isn't one
+func closing(lower, name string) int {
+	if end := strings.Index(lower, "</"+name); end >= 0 {
+		return end
+	}
+	return len(lower)
+}
+
+// readTag reads the tag at the start of s, returning its lower cased name and attributes, and how much of
+// s it takes up. n is 0 when s doesn't start with a tag.
+func readTag(s string) (name string, attrs map[string]string, n int) {
+	i := 1
+	if i < len(s) && (s[i] == '/' || s[i] == '!' || s[i] == '?') {
+		i++
+	}
+	start := i
+	for i < len(s) && isNameByte(s[i]) {
+		i++
+	}
+	if i == start {
+		return "", nil, 0
+	}
+	name = asciiLower(s[1:i])
+
+	attrs = make(map[string]string)
+	for i < len(s) {
+		if s[i] == '>' {
+			return name, attrs, i + 1
+		}
+		if isSpace(s[i]) || s[i] == '/' || s[i] == '=' {
+			i++
+			continue
+		}
+
+		k := i
+		for i < len(s) && !isSpace(s[i]) && s[i] != '=' && s[i] != '>' && s[i] != '/' {
+			i++
+		}
+		key := asciiLower(s[k:i])
+		for i < len(s) && isSpace(s[i]) {
+			i++
+		}
+		value := ""
+		if i < len(s) && s[i] == '=' {
+			i++
+			for i < len(s) && isSpace(s[i]) {
+				i++
+			}
+			if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+				end := strings.IndexByte(s[i+1:], s[i])
+				if end < 0 {
+					return name, attrs, len(s)
+				}
+				value = s[i+1 : i+1+end]
+				i += end + 2
+			} else {
+				v := i
+				for i < len(s) && !isSpace(s[i]) && s[i] != '>' {
+					i++
+				}
+				value = s[v:i]
+			}
+		}
+		// like browsers, the first of a repeated attribute wins
+		if _, ok := attrs[key]; !ok {
+			attrs[key] = html.UnescapeString(value)
+		}
+	}
+	return name, attrs, len(s)
+}
+
+func isNameByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == ':'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// asciiLower lower cases only ASCII letters, so offsets into the result are offsets into s
+func asciiLower(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c >= 'A' && c <= 'Z' {
+			b[i] = c + 'a' - 'A'
+		}
+	}
+	return string(b)
+}
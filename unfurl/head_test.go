@@ -0,0 +1,55 @@
+package unfurl
+
+import "testing"
+
+func TestScanHead(t *testing.T) {
+	doc := `<!DOCTYPE html>
+<HTML lang=en>
+<head>
+  <meta charset="utf-8">
+  <!-- <title>Commented out</title> -->
+  <TITLE>Fish &amp; Chips</TITLE>
+  <script>var s = "<meta property='og:title' content='From a script'>";</script>
+  <meta property="og:title" content="The &quot;Best&quot; Fish">
+  <meta property="og:title" content="Second og:title">
+  <meta name=Description content='Where to eat'>
+  <meta name="twitter:image" content="/img/card.png"/>
+  <link rel="shortcut icon" href="/static/icon.png">
+  <link rel=apple-touch-icon href=/touch.png>
+</head>
+<body>
+  <meta property="og:site_name" content="In the body">
+</body>
+</HTML>`
+
+	h := scanHead(doc)
+	if h.title != "Fish & Chips" {
+		t.Errorf("title = %q, want %q", h.title, "Fish & Chips")
+	}
+	want := map[string]string{
+		"og:title":      `The "Best" Fish`,
+		"description":   "Where to eat",
+		"twitter:image": "/img/card.png",
+	}
+	for key, value := range want {
+		if h.meta[key] != value {
+			t.Errorf("meta[%s] = %q, want %q", key, h.meta[key], value)
+		}
+	}
+	if _, ok := h.meta["og:site_name"]; ok {
+		t.Errorf("meta[og:site_name] was read from the body")
+	}
+	if h.icon != "/static/icon.png" || h.touchIcon != "/touch.png" {
+		t.Errorf("icon = %q and touchIcon = %q, want /static/icon.png and /touch.png", h.icon, h.touchIcon)
+	}
+}
+
+func TestScanHead_Truncated(t *testing.T) {
+	for _, doc := range []string{"", "<", "<title>Cut off", `<meta property="og:title" content="Cut`, "<!-- never closed", "< not a tag"} {
+		// mustn't panic or loop
+		_ = scanHead(doc)
+	}
+	if h := scanHead("<title>Cut off"); h.title != "Cut off" {
+		t.Errorf("title of a truncated page = %q, want %q", h.title, "Cut off")
+	}
+}
@@ -0,0 +1,241 @@
+// Package unfurl fetches the title, description, preview image and favicon of the pages links lead to
+package unfurl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/ericfialkowski/shorturl/env"
+	"github.com/ericfialkowski/shorturl/golink"
+	"github.com/ericfialkowski/shorturl/netguard"
+)
+
+const (
+	userAgent      = "Mozilla/5.0 (compatible; shorturl-unfurl/1.0)"
+	maxTitle       = 300
+	maxDescription = 1000
+	maxUrl         = 2048
+)
+
+// Fetcher fetches the metadata of link destinations and stores it. Pages are read up to a size limit, and
+// only as far as the end of their head. A nil Fetcher is valid and fetches nothing.
+type Fetcher struct {
+	dao         dao.ShortUrlDao
+	client      *http.Client
+	maxBytes    int64         // most of a page that is read
+	maxAge      time.Duration // how long fetched metadata is good for
+	batch       int           // most links refreshed in a run
+	concurrency int           // fetches run at once by a refresh
+
+	pending chan struct{} // one per fetch started by Describe that hasn't finished
+	wg      sync.WaitGroup
+}
+
+// NewFetcher returns a Fetcher that stores what it fetches in d
+func NewFetcher(d dao.ShortUrlDao) *Fetcher {
+	timeout := env.DurationOrDefault("metadata_timeout", 10*time.Second)
+	return &Fetcher{
+		dao:         d,
+		client:      netguard.NewClient(timeout, env.BoolOrDefault("metadata_private", false)),
+		maxBytes:    int64(max(1024, env.IntOrDefault("metadata_max_bytes", 512*1024))),
+		maxAge:      env.DurationOrDefault("metadata_max_age", 7*24*time.Hour),
+		batch:       env.IntOrDefault("metadata_batch", 500),
+		concurrency: max(1, env.IntOrDefault("metadata_concurrency", 4)),
+		pending:     make(chan struct{}, max(1, env.IntOrDefault("metadata_queue", 16))),
+	}
+}
+
+// Describe fetches the metadata of the new link abv in domain in the background. When too many fetches are already
+// running it's skipped, and the next refresh picks the link up since it's never been fetched.
+func (f *Fetcher) Describe(domain, abv, u string) {
+	if f == nil {
+		return
+	}
+	select {
+	case f.pending <- struct{}{}:
+	default:
+		return
+	}
+	f.wg.Go(func() {
+		defer func() { <-f.pending }()
+		f.update(context.Background(), dao.LinkMetadata{Domain: domain, Abbreviation: abv, Url: u})
+	})
+}
+
+// Run refreshes a batch of the links whose metadata is missing or stale, waiting for them all to finish
+// or ctx to be done
+func (f *Fetcher) Run(ctx context.Context) error {
+	if f == nil {
+		return nil
+	}
+
+	links, err := f.dao.GetStaleMetadata(time.Now().Add(-f.maxAge), f.batch)
+	if err != nil {
+		return fmt.Errorf("error loading links to describe: %v", err)
+	}
+
+	jobs := make(chan dao.LinkMetadata)
+	var wg sync.WaitGroup
+	for range f.concurrency {
+		wg.Go(func() {
+			for link := range jobs {
+				f.update(ctx, link)
+			}
+		})
+	}
+send:
+	for _, link := range links {
+		select {
+		case jobs <- link:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if len(links) > 0 {
+		log.Printf("Fetched metadata of %d link destinations", len(links))
+	}
+	return ctx.Err()
+}
+
+// update fetches the metadata of link and stores it. When the fetch fails what was fetched before is kept
+// along with the error.
+func (f *Fetcher) update(ctx context.Context, link dao.LinkMetadata) {
+	// templates are described by where they lead without any arguments
+	metadata := f.Fetch(ctx, golink.Base(link.Url))
+	if ctx.Err() != nil {
+		return
+	}
+	if metadata.Error != "" {
+		previous := link.Metadata
+		previous.Error = metadata.Error
+		previous.Fetched = metadata.Fetched
+		metadata = previous
+	}
+	if err := f.dao.ForDomain(link.Domain).SetMetadata(link.Abbreviation, metadata); err != nil {
+		log.Printf("Error recording metadata of %s: %v", link.Abbreviation, err)
+	}
+}
+
+// Fetch requests the page at rawURL and reads its metadata. OpenGraph tags are preferred to Twitter card
+// tags, which are preferred to the plain title and description. The favicon is the one the page links to,
+// or /favicon.ico if the site has one. Error is set when the page couldn't be read.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) dao.Metadata {
+	metadata := dao.Metadata{Fetched: time.Now()}
+
+	resp, err := f.request(ctx, http.MethodGet, rawURL)
+	if err != nil {
+		metadata.Error = err.Error()
+		return metadata
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		metadata.Error = resp.Status
+		return metadata
+	}
+	if !isHTML(resp.Header.Get("Content-Type")) {
+		metadata.Error = fmt.Sprintf("not an HTML page (%s)", resp.Header.Get("Content-Type"))
+		return metadata
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, f.maxBytes))
+	if err != nil {
+		metadata.Error = fmt.Sprintf("error reading page: %v", err)
+		return metadata
+	}
+
+	// relative URLs are relative to where any redirects ended up
+	base := resp.Request.URL
+	h := scanHead(strings.ToValidUTF8(string(body), "�"))
+	metadata.Title = text(maxTitle, h.meta["og:title"], h.meta["twitter:title"], h.title)
+	metadata.Description = text(maxDescription, h.meta["og:description"], h.meta["twitter:description"], h.meta["description"])
+	metadata.SiteName = text(maxTitle, h.meta["og:site_name"], h.meta["application-name"])
+	metadata.Image = link(base, h.meta["og:image"], h.meta["og:image:url"], h.meta["twitter:image"], h.meta["twitter:image:src"])
+	metadata.Favicon = link(base, h.icon, h.touchIcon)
+	if metadata.Favicon == "" {
+		metadata.Favicon = f.defaultFavicon(ctx, base)
+	}
+	return metadata
+}
+
+// defaultFavicon returns the URL of the /favicon.ico of the site at base if it has one
+func (f *Fetcher) defaultFavicon(ctx context.Context, base *url.URL) string {
+	icon := base.ResolveReference(&url.URL{Path: "/favicon.ico"}).String()
+	resp, err := f.request(ctx, http.MethodHead, icon)
+	if err != nil {
+		return ""
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || isHTML(resp.Header.Get("Content-Type")) {
+		return ""
+	}
+	return icon
+}
+
+func (f *Fetcher) request(ctx context.Context, method, target string) (*http.Response, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("can't fetch %s URLs", u.Scheme)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	return f.client.Do(req)
+}
+
+func isHTML(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml")
+}
+
+// text returns the first of values that isn't blank with its whitespace collapsed, cut to limit characters
+func text(limit int, values ...string) string {
+	for _, v := range values {
+		v = strings.Join(strings.Fields(v), " ")
+		if v == "" {
+			continue
+		}
+		if utf8.RuneCountInString(v) > limit {
+			v = string([]rune(v)[:limit-1]) + "…"
+		}
+		return v
+	}
+	return ""
+}
+
+// link returns the first of refs that is a usable http or https URL, resolved against base
+func link(base *url.URL, refs ...string) string {
+	for _, ref := range refs {
+		ref = strings.TrimSpace(ref)
+		if ref == "" {
+			continue
+		}
+		u, err := base.Parse(ref)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			continue
+		}
+		if s := u.String(); len(s) <= maxUrl {
+			return s
+		}
+	}
+	return ""
+}
@@ -0,0 +1,145 @@
+package unfurl
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ericfialkowski/shorturl/dao"
+	"github.com/ericfialkowski/shorturl/netguard"
+)
+
+const testPage = `<html><head>
+<title>  Plain
+  title </title>
+<meta name="description" content="Plain description">
+<meta name="twitter:description" content="Card description">
+<meta property="og:site_name" content="Example">
+<meta property="og:image" content="images/preview.png">
+</head><body>` + "</body></html>"
+
+func testServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(testPage))
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/docs/page", http.StatusFound)
+	})
+	mux.HandleFunc("/docs/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<head><link rel="icon" href="icon.svg"><meta property="og:image" content="javascript:alert(1)">`))
+	})
+	mux.HandleFunc("/huge", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<head>" + strings.Repeat("<!-- padding -->", 1000) + "<title>Too far in</title>"))
+	})
+	mux.HandleFunc("/file.pdf", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+	})
+	mux.HandleFunc("/favicon.ico", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/x-icon")
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func testFetcher(t *testing.T, d dao.ShortUrlDao) *Fetcher {
+	t.Setenv("metadata_private", "true")
+	t.Setenv("metadata_max_bytes", "4096")
+	return NewFetcher(d)
+}
+
+func TestFetcher_Fetch(t *testing.T) {
+	server := testServer(t)
+	f := testFetcher(t, dao.CreateMemoryDB())
+
+	m := f.Fetch(context.Background(), server.URL+"/page")
+	want := dao.Metadata{
+		Title:       "Plain title",
+		Description: "Card description",
+		SiteName:    "Example",
+		Image:       server.URL + "/images/preview.png",
+		Favicon:     server.URL + "/favicon.ico",
+	}
+	m.Fetched = time.Time{}
+	if m != want {
+		t.Errorf("Fetch(/page) = %+v, want %+v", m, want)
+	}
+
+	m = f.Fetch(context.Background(), server.URL+"/moved")
+	if m.Favicon != server.URL+"/docs/icon.svg" {
+		t.Errorf("Fetch(/moved).Favicon = %q, want it relative to where the redirect went", m.Favicon)
+	}
+	if m.Image != "" {
+		t.Errorf("Fetch(/moved).Image = %q, want javascript URLs dropped", m.Image)
+	}
+
+	if m = f.Fetch(context.Background(), server.URL+"/huge"); m.Title != "" || m.Error != "" {
+		t.Errorf("Fetch(/huge) = %+v, want the page read only up to the limit", m)
+	}
+	if m = f.Fetch(context.Background(), server.URL+"/file.pdf"); !strings.Contains(m.Error, "not an HTML page") {
+		t.Errorf("Fetch(/file.pdf).Error = %q, want it refused", m.Error)
+	}
+	if m = f.Fetch(context.Background(), server.URL+"/missing"); m.Error != "404 Not Found" {
+		t.Errorf("Fetch(/missing).Error = %q, want 404 Not Found", m.Error)
+	}
+}
+
+func TestFetcher_FetchPrivate(t *testing.T) {
+	server := testServer(t)
+	f := NewFetcher(dao.CreateMemoryDB())
+
+	if m := f.Fetch(context.Background(), server.URL+"/page"); !strings.Contains(m.Error, netguard.ErrPrivateAddress.Error()) {
+		t.Errorf("Fetch() of a loopback address = %+v, want it refused", m)
+	}
+}
+
+func TestFetcher_Describe(t *testing.T) {
+	server := testServer(t)
+	db := dao.CreateMemoryDB()
+	_ = db.Save("page", server.URL+"/page")
+	f := testFetcher(t, db)
+
+	f.Describe("", "page", server.URL+"/page")
+	f.wg.Wait()
+
+	stats, _ := db.GetStats("page")
+	if stats.Metadata == nil || stats.Metadata.Title != "Plain title" {
+		t.Errorf("GetStats().Metadata = %+v, want the page's metadata", stats.Metadata)
+	}
+}
+
+func TestFetcher_Run(t *testing.T) {
+	server := testServer(t)
+	db := dao.CreateMemoryDB()
+	_ = db.Save("page", server.URL+"/page")
+	_ = db.Save("gone", server.URL+"/missing")
+	_ = db.SetMetadata("gone", dao.Metadata{Title: "Still here", Fetched: time.Now().Add(-30 * 24 * time.Hour)})
+	f := testFetcher(t, db)
+
+	if err := f.Run(context.Background()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	stale, _ := db.GetStaleMetadata(time.Now().Add(-time.Hour), 10)
+	if len(stale) != 0 {
+		t.Errorf("GetStaleMetadata() = %+v after Run(), want none", stale)
+	}
+	stats, _ := db.GetStats("gone")
+	if stats.Metadata == nil || stats.Metadata.Title != "Still here" || stats.Metadata.Error != "404 Not Found" {
+		t.Errorf("GetStats().Metadata = %+v, want the old title kept with the error", stats.Metadata)
+	}
+}
+
+func TestFetcher_Nil(t *testing.T) {
+	var f *Fetcher
+	f.Describe("", "abc", "https://example.com")
+	if err := f.Run(context.Background()); err != nil {
+		t.Errorf("Run() on a nil Fetcher error = %v", err)
+	}
+}